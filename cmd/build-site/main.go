@@ -0,0 +1,82 @@
+// build-site 将一棵家族树导出为静态网站（每人一页、姓氏和地点索引、浏览器端搜索）
+//
+// 用法:
+//
+//	go run ./cmd/build-site -config config.json -tree 1 -out site -as-of 2024-01-01
+//
+// 可能在世的人（无死亡记录且出生不足 -living-years 年）只显示姓氏。
+// 指定 -as-of 后输出与运行日期无关，同样的数据总是生成相同的文件。
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"familytree/config"
+	"familytree/models"
+	"familytree/pkg/site"
+	"familytree/repository"
+	"familytree/services"
+)
+
+func main() {
+	configPath := flag.String("config", "config.json", "配置文件路径")
+	dbPath := flag.String("db", "", "数据库路径（覆盖配置文件）")
+	treeID := flag.Int("tree", 0, "家族树ID")
+	outDir := flag.String("out", "site", "输出目录")
+	asOf := flag.String("as-of", "", "判断是否在世的基准日期（YYYY-MM-DD），默认当天")
+	livingYears := flag.Int("living-years", site.DefaultLivingYears, "无死亡记录且出生不足该年数的人视为在世")
+	photos := flag.Bool("photos", false, "下载照片到输出目录，否则页面直接引用照片地址")
+	clean := flag.Bool("clean", false, "生成前清空输出目录，去掉已删除人物的旧页面")
+	flag.Parse()
+
+	if *treeID <= 0 {
+		log.Fatal("❌ 请用 -tree 指定家族树ID")
+	}
+	opts := models.SiteOptions{LivingYears: *livingYears, Photos: *photos}
+	if *asOf != "" {
+		date, err := time.Parse("2006-01-02", *asOf)
+		if err != nil {
+			log.Fatalf("❌ 无效的基准日期: %v", err)
+		}
+		opts.AsOf = date
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("❌ 加载配置失败: %v", err)
+	}
+	if *dbPath != "" {
+		cfg.Database.Path = *dbPath
+	}
+
+	repo, err := repository.NewSQLiteRepository(cfg.GetDatabaseDSN())
+	if err != nil {
+		log.Fatalf("❌ 打开数据库失败: %v", err)
+	}
+	defer repo.Close()
+
+	if *clean {
+		if err := os.RemoveAll(*outDir); err != nil {
+			log.Fatalf("❌ 清空输出目录失败: %v", err)
+		}
+	}
+
+	log.Printf("🔄 正在生成家族树 %d 的静态网站: %s", *treeID, *outDir)
+	service := services.NewSiteService(repo, repo, repo, repo)
+	result, err := service.GenerateSite(context.Background(), *treeID, *outDir, opts)
+	if err != nil {
+		log.Fatalf("❌ 生成失败: %v", err)
+	}
+
+	fmt.Printf("✅ 生成完成: %s\n", result.Dir)
+	fmt.Printf("   人物: %d（在世隐去 %d）\n", result.People, result.Redacted)
+	fmt.Printf("   文件: %d\n", result.Files)
+	if *photos {
+		fmt.Printf("   照片: %d\n", result.Photos)
+	}
+}
@@ -0,0 +1,62 @@
+// rebuild-lineage 从现有个人、家庭和子女记录完整重建世系闭包表
+//
+// 用法:
+//
+//	go run ./cmd/rebuild-lineage -config config.json
+//
+// 需要在项目根目录运行（数据库初始化脚本按相对路径读取）。
+// 服务端只有在配置 genealogy.lineage_closure 为 true 时才会使用闭包表；未开启时服务启动会删除维护触发器，
+// 闭包表随之过期，开启后重新启动时自动重建。
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"familytree/config"
+	"familytree/repository"
+)
+
+func main() {
+	configPath := flag.String("config", "config.json", "配置文件路径")
+	dbPath := flag.String("db", "", "数据库路径（覆盖配置文件）")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("❌ 加载配置失败: %v", err)
+	}
+	if *dbPath != "" {
+		cfg.Database.Path = *dbPath
+	}
+
+	repo, err := repository.NewSQLiteRepository(cfg.GetDatabaseDSN())
+	if err != nil {
+		log.Fatalf("❌ 打开数据库失败: %v", err)
+	}
+	defer repo.Close()
+
+	log.Printf("🔄 正在重建世系闭包表: %s", cfg.GetDatabaseDSN())
+	result, err := repo.RebuildLineageClosure(context.Background())
+	if err != nil {
+		log.Fatalf("❌ 重建失败: %v", err)
+	}
+
+	fmt.Printf("✅ 重建完成，耗时 %v\n", result.Duration)
+	fmt.Printf("   个人: %d\n", result.IndividualCount)
+	fmt.Printf("   父母-子女边: %d\n", result.EdgeCount)
+	fmt.Printf("   闭包记录: %d\n", result.ClosureRows)
+
+	if len(result.SkippedEdges) > 0 {
+		fmt.Printf("⚠️  以下 %d 条边会形成循环关系，已跳过，请修正数据后重新运行:\n", len(result.SkippedEdges))
+		for _, edge := range result.SkippedEdges {
+			fmt.Printf("   父母 %d -> 子女 %d\n", edge.ParentID, edge.ChildID)
+		}
+	}
+
+	if !cfg.Genealogy.LineageClosure {
+		fmt.Println("ℹ️  当前配置未启用 genealogy.lineage_closure：开启后再启动服务即可直接使用；若在开启前以未开启的配置启动过服务，闭包表会过期并在开启时重建")
+	}
+}
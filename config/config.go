@@ -33,6 +33,18 @@ type Config struct {
 
 	// 中间件配置
 	Middleware MiddlewareConfig `json:"middleware"`
+
+	// 家谱查询配置
+	Genealogy GenealogyConfig `json:"genealogy"`
+
+	// 家谱书籍配置
+	Book BookConfig `json:"book"`
+
+	// 时间线配置
+	Timeline TimelineConfig `json:"timeline"`
+
+	// 回收站配置
+	Trash TrashConfig `json:"trash"`
 }
 
 // DatabaseConfig 数据库配置
@@ -79,6 +91,30 @@ type MiddlewareConfig struct {
 	RateLimit       RateLimitConfig `json:"rate_limit"`
 }
 
+// GenealogyConfig 家谱查询配置
+type GenealogyConfig struct {
+	MaxGenerations int  `json:"max_generations"` // 祖先/后代查询的最大代数
+	LineageClosure bool `json:"lineage_closure"` // 是否启用世系闭包表
+}
+
+// BookConfig 家谱书籍生成配置
+type BookConfig struct {
+	FontPath       string `json:"font_path"`         // TrueType 中文字体文件，未配置时不能生成书籍
+	OutputDir      string `json:"output_dir"`        // 生成文件存放目录，为空时使用系统临时目录
+	RetentionHours int    `json:"retention_hours"`   // 生成文件保留时长
+	MaxJobsPerUser int    `json:"max_jobs_per_user"` // 每个用户同时排队或生成中的任务数上限
+}
+
+// TimelineConfig 个人时间线配置
+type TimelineConfig struct {
+	HistoryPath string `json:"history_path"` // 历史事件列表（JSON），为空或文件不存在时不穿插历史事件
+}
+
+// TrashConfig 回收站配置
+type TrashConfig struct {
+	RetentionDays int `json:"retention_days"` // 删除的记录在回收站中保留的天数，之后自动清除
+}
+
 // RateLimitConfig 限流配置
 type RateLimitConfig struct {
 	RequestsPerMinute int `json:"requests_per_minute"`
@@ -130,6 +166,19 @@ func DefaultConfig() *Config {
 				Burst:             10,
 			},
 		},
+		Genealogy: GenealogyConfig{
+			MaxGenerations: 30,
+		},
+		Book: BookConfig{
+			RetentionHours: 24,
+			MaxJobsPerUser: 2,
+		},
+		Timeline: TimelineConfig{
+			HistoryPath: "data/historical_events.json",
+		},
+		Trash: TrashConfig{
+			RetentionDays: 30,
+		},
 	}
 }
 
@@ -185,6 +234,30 @@ func loadFromEnv(config *Config) {
 			config.WorkerPool.WorkerCount = count
 		}
 	}
+	if maxGenerations := os.Getenv("MAX_GENERATIONS"); maxGenerations != "" {
+		if generations, err := strconv.Atoi(maxGenerations); err == nil {
+			config.Genealogy.MaxGenerations = generations
+		}
+	}
+	if lineageClosure := os.Getenv("LINEAGE_CLOSURE"); lineageClosure != "" {
+		if enabled, err := strconv.ParseBool(lineageClosure); err == nil {
+			config.Genealogy.LineageClosure = enabled
+		}
+	}
+	if fontPath := os.Getenv("BOOK_FONT_PATH"); fontPath != "" {
+		config.Book.FontPath = fontPath
+	}
+	if outputDir := os.Getenv("BOOK_OUTPUT_DIR"); outputDir != "" {
+		config.Book.OutputDir = outputDir
+	}
+	if historyPath := os.Getenv("TIMELINE_HISTORY_PATH"); historyPath != "" {
+		config.Timeline.HistoryPath = historyPath
+	}
+	if retentionDays := os.Getenv("TRASH_RETENTION_DAYS"); retentionDays != "" {
+		if days, err := strconv.Atoi(retentionDays); err == nil {
+			config.Trash.RetentionDays = days
+		}
+	}
 }
 
 // loadFromFile 从配置文件加载配置
@@ -215,6 +288,18 @@ func validate(config *Config) error {
 		return fmt.Errorf("工作池大小必须大于0")
 	}
 
+	if config.Genealogy.MaxGenerations <= 0 {
+		return fmt.Errorf("最大查询代数必须大于0")
+	}
+
+	if config.Book.RetentionHours <= 0 {
+		return fmt.Errorf("书籍保留时长必须大于0")
+	}
+
+	if config.Trash.RetentionDays <= 0 {
+		return fmt.Errorf("回收站保留天数必须大于0")
+	}
+
 	return nil
 }
 
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"familytree/interfaces"
+	"familytree/models"
+	"familytree/pkg/errors"
+	"familytree/pkg/middleware"
+)
+
+// BatchHandler 批量操作处理器
+type BatchHandler struct {
+	service interfaces.BatchService
+}
+
+// NewBatchHandler 创建批量操作处理器
+func NewBatchHandler(service interfaces.BatchService) *BatchHandler {
+	return &BatchHandler{service: service}
+}
+
+// ExecuteBatch 按顺序执行 {"operations": [...]}，全部成功或全部回滚，返回临时ID到实际ID的对应
+func (h *BatchHandler) ExecuteBatch(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "用户未认证",
+			Code:    string(errors.ErrCodeUnauthorized),
+		})
+		return
+	}
+
+	var req models.BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的请求数据",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	result, err := h.service.Execute(r.Context(), user.UserID, &req)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    result,
+		Message: "批量操作已完成",
+	})
+}
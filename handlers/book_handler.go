@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"familytree/interfaces"
+	"familytree/models"
+	"familytree/pkg/errors"
+	"familytree/pkg/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// BookHandler 家谱书籍处理器
+type BookHandler struct {
+	service interfaces.BookService
+}
+
+// NewBookHandler 创建家谱书籍处理器
+func NewBookHandler(service interfaces.BookService) *BookHandler {
+	return &BookHandler{service: service}
+}
+
+// StartBook 提交书籍生成任务，立即返回任务，生成完成后通过下载接口获取
+func (h *BookHandler) StartBook(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "用户未认证",
+			Code:    string(errors.ErrCodeUnauthorized),
+		})
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的ID",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	// 请求体可以为空，全部使用默认选项
+	var req models.BookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的请求数据",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	job, err := h.service.StartBook(r.Context(), user.UserID, id, &req)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/v1/books/"+job.JobID)
+	respondJSON(w, http.StatusAccepted, APIResponse{
+		Success: true,
+		Data:    job,
+		Message: "书籍生成任务已提交",
+	})
+}
+
+// GetBookJob 查询书籍生成进度
+func (h *BookHandler) GetBookJob(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "用户未认证",
+			Code:    string(errors.ErrCodeUnauthorized),
+		})
+		return
+	}
+
+	job, err := h.service.GetBookJob(r.Context(), user.UserID, mux.Vars(r)["jobId"])
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    job,
+	})
+}
+
+// DownloadBook 下载已生成的书籍
+func (h *BookHandler) DownloadBook(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "用户未认证",
+			Code:    string(errors.ErrCodeUnauthorized),
+		})
+		return
+	}
+
+	job, file, err := h.service.OpenBook(r.Context(), user.UserID, mux.Vars(r)["jobId"])
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="book-%s.pdf"; filename*=UTF-8''%s`,
+		job.JobID, url.PathEscape(job.Title+".pdf")))
+	if job.Size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(job.Size, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, file)
+}
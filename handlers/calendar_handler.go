@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"familytree/interfaces"
+	"familytree/models"
+	"familytree/pkg/errors"
+	"familytree/pkg/ical"
+	"familytree/pkg/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// feedRefresh 建议日历应用刷新订阅的间隔
+const feedRefresh = 12 * time.Hour
+
+// CalendarHandler 生日与纪念日日历处理器
+type CalendarHandler struct {
+	service interfaces.CalendarService
+}
+
+// NewCalendarHandler 创建生日与纪念日日历处理器
+func NewCalendarHandler(service interfaces.CalendarService) *CalendarHandler {
+	return &CalendarHandler{service: service}
+}
+
+// GetAnniversaries 家族树近期的生日与纪念日。
+// from 为 YYYY-MM-DD（默认当天），days 为天数（默认 30），calendar 为 gregorian、lunar 或 both，
+// types 为逗号分隔的 birthday、wedding、death
+func (h *CalendarHandler) GetAnniversaries(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "用户未认证",
+			Code:    string(errors.ErrCodeUnauthorized),
+		})
+		return
+	}
+
+	vars := mux.Vars(r)
+	familyTreeID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的家族树ID",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	query := r.URL.Query()
+	var opts models.CalendarOptions
+	if v := query.Get("from"); v != "" {
+		if opts.From, err = time.Parse("2006-01-02", v); err != nil {
+			respondJSON(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "from 的格式应为 YYYY-MM-DD",
+				Code:    string(errors.ErrCodeInvalidInput),
+			})
+			return
+		}
+	}
+	if v := query.Get("days"); v != "" {
+		if opts.Days, err = strconv.Atoi(v); err != nil || opts.Days <= 0 {
+			respondJSON(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "无效的天数",
+				Code:    string(errors.ErrCodeInvalidInput),
+			})
+			return
+		}
+	}
+	if v := query.Get("calendar"); v != "" && v != "both" {
+		opts.Calendars = []string{v}
+	}
+	if v := query.Get("types"); v != "" {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				opts.Types = append(opts.Types, t)
+			}
+		}
+	}
+
+	result, err := h.service.GetAnniversaries(r.Context(), user.UserID, familyTreeID, opts)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    result,
+	})
+}
+
+// CreateFeed 创建或更换订阅链接，令牌只在此时返回一次
+func (h *CalendarHandler) CreateFeed(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "用户未认证",
+			Code:    string(errors.ErrCodeUnauthorized),
+		})
+		return
+	}
+
+	feed, err := h.service.CreateFeed(r.Context(), user.UserID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	feed.URL = feedURL(r, feed.Token)
+	respondJSON(w, http.StatusCreated, APIResponse{
+		Success: true,
+		Data:    feed,
+		Message: "订阅链接已生成，请妥善保存，旧链接已失效",
+	})
+}
+
+// GetFeedInfo 订阅的创建和最近访问时间
+func (h *CalendarHandler) GetFeedInfo(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "用户未认证",
+			Code:    string(errors.ErrCodeUnauthorized),
+		})
+		return
+	}
+
+	feed, err := h.service.GetFeedInfo(r.Context(), user.UserID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    feed,
+	})
+}
+
+// RevokeFeed 取消订阅
+func (h *CalendarHandler) RevokeFeed(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "用户未认证",
+			Code:    string(errors.ErrCodeUnauthorized),
+		})
+		return
+	}
+
+	if err := h.service.RevokeFeed(r.Context(), user.UserID); err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "日历订阅已取消",
+	})
+}
+
+// GetFeed iCalendar 订阅，以链接中的令牌代替登录
+func (h *CalendarHandler) GetFeed(w http.ResponseWriter, r *http.Request) {
+	result, err := h.service.GetFeed(r.Context(), mux.Vars(r)["token"])
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	cal := &ical.Calendar{
+		Name:        result.Name,
+		Description: "家族成员的生日、结婚纪念日和忌日，农历纪念日已换算为公历",
+		Refresh:     feedRefresh,
+		Events:      make([]ical.Event, 0, len(result.Entries)),
+	}
+	for _, a := range result.Entries {
+		event := ical.Event{
+			UID:        anniversaryUID(a),
+			Date:       a.Date,
+			Summary:    a.Title,
+			Categories: []string{anniversaryCategories[a.Type]},
+		}
+		if a.Calendar == models.CalendarLunar {
+			event.Categories = append(event.Categories, "农历")
+		}
+		event.Description = fmt.Sprintf("%s：%s", anniversaryCategories[a.Type], a.OriginalDate.Format("2006-01-02"))
+		cal.Events = append(cal.Events, event)
+	}
+
+	w.Header().Set("Content-Type", ical.ContentType)
+	w.Header().Set("Content-Disposition", `inline; filename="familytree.ics"`)
+	w.WriteHeader(http.StatusOK)
+	ical.Write(w, cal, time.Now())
+}
+
+// anniversaryCategories 纪念日类型在日历中的分类名称
+var anniversaryCategories = map[string]string{
+	models.AnniversaryBirthday: "生日",
+	models.AnniversaryWedding:  "结婚纪念日",
+	models.AnniversaryDeath:    "忌日",
+}
+
+// anniversaryUID 同一纪念日每次生成的 UID 相同，日历应用据此更新而不是重复添加
+func anniversaryUID(a models.Anniversary) string {
+	id := a.IndividualID
+	if a.Type == models.AnniversaryWedding {
+		id = a.FamilyID
+	}
+	return fmt.Sprintf("%s-%s-%d-%d-%d@familytree", a.Type, a.Calendar, a.FamilyTreeID, id, a.Years)
+}
+
+// feedURL 订阅链接的完整地址
+func feedURL(r *http.Request, token string) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/api/v1/calendar/%s.ics", scheme, r.Host, token)
+}
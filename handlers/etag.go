@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"familytree/pkg/errors"
+)
+
+// setETag 把记录的版本号作为 ETag 返回
+func setETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", `"`+strconv.Itoa(version)+`"`)
+}
+
+// parseIfMatch 解析 If-Match 请求头中的版本号，支持 "3" 和 W/"3"；
+// 未提供或为 * 时返回 nil，无法解析时直接响应 400
+func parseIfMatch(w http.ResponseWriter, r *http.Request) (*int, bool) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" || value == "*" {
+		return nil, true
+	}
+	value = strings.Trim(strings.TrimPrefix(value, "W/"), `"`)
+	version, err := strconv.Atoi(value)
+	if err != nil || version <= 0 {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的 If-Match 版本",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return nil, false
+	}
+	return &version, true
+}
+
+// isVersionMismatch 判断是否为版本不一致
+func isVersionMismatch(err error) bool {
+	appErr, ok := err.(*errors.AppError)
+	return ok && appErr.Code == errors.ErrCodeVersionMismatch
+}
+
+// respondVersionMismatch 响应 412，并带上记录的当前版本
+func respondVersionMismatch(w http.ResponseWriter, currentVersion int) {
+	setETag(w, currentVersion)
+	respondJSON(w, http.StatusPreconditionFailed, APIResponse{
+		Success: false,
+		Data:    map[string]int{"current_version": currentVersion},
+		Message: errors.ErrVersionMismatch.Message,
+		Code:    string(errors.ErrCodeVersionMismatch),
+	})
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"familytree/interfaces"
+	"familytree/models"
+	"familytree/pkg/errors"
+	"familytree/pkg/middleware"
+	"familytree/pkg/spreadsheet"
+
+	"github.com/gorilla/mux"
+)
+
+// ExportHandler 表格导出处理器
+type ExportHandler struct {
+	service interfaces.ExportService
+}
+
+// NewExportHandler 创建表格导出处理器
+func NewExportHandler(service interfaces.ExportService) *ExportHandler {
+	return &ExportHandler{service: service}
+}
+
+// GetExportColumns 数据集（people、families、children、events）可以选择的列
+func (h *ExportHandler) GetExportColumns(w http.ResponseWriter, r *http.Request) {
+	if _, ok := middleware.GetUserFromContext(r.Context()); !ok {
+		respondJSON(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "用户未认证",
+			Code:    string(errors.ErrCodeUnauthorized),
+		})
+		return
+	}
+
+	columns, err := h.service.Columns(mux.Vars(r)["dataset"])
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    columns,
+	})
+}
+
+// ExportTable 把数据集导出为 CSV（默认）或 XLSX：format 选择格式，columns 以逗号分隔选择列及其顺序，
+// q 或 query 与个人搜索相同，筛选姓名或备注包含该文字的人。记录逐行写出，不在内存中生成整个文件
+func (h *ExportHandler) ExportTable(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "用户未认证",
+			Code:    string(errors.ErrCodeUnauthorized),
+		})
+		return
+	}
+
+	vars := mux.Vars(r)
+	familyTreeID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的家族树ID",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	params := r.URL.Query()
+	req := &models.ExportRequest{
+		Dataset: vars["dataset"],
+		Format:  params.Get("format"),
+		Filter:  models.ExportFilter{Query: params.Get("query")},
+	}
+	if req.Filter.Query == "" {
+		req.Filter.Query = params.Get("q")
+	}
+	for _, value := range params["columns"] {
+		for _, key := range strings.Split(value, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				req.Columns = append(req.Columns, key)
+			}
+		}
+	}
+
+	format := spreadsheet.Format(strings.ToLower(req.Format))
+	if format == "" {
+		format = spreadsheet.FormatCSV
+	}
+	out := &exportResponse{
+		w:           w,
+		contentType: format.ContentType(),
+		filename:    fmt.Sprintf("family-tree-%d-%s.%s", familyTreeID, req.Dataset, format),
+	}
+	if err := h.service.Export(r.Context(), user.UserID, familyTreeID, req, out); err != nil && !out.started {
+		handleError(w, err)
+	}
+	// 已开始写出时无法再返回错误，响应在出错处截断
+}
+
+// exportResponse 第一次写入时才发送响应头，导出在写出任何内容前失败时仍可返回 JSON 错误
+type exportResponse struct {
+	w           http.ResponseWriter
+	contentType string
+	filename    string
+	started     bool
+}
+
+func (e *exportResponse) Write(p []byte) (int, error) {
+	if !e.started {
+		e.started = true
+		e.w.Header().Set("Content-Type", e.contentType)
+		e.w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, e.filename))
+		e.w.WriteHeader(http.StatusOK)
+	}
+	return e.w.Write(p)
+}
@@ -151,13 +151,14 @@ func (h *FamilyHandler) GetFamily(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setETag(w, family.Version)
 	respondJSON(w, http.StatusOK, APIResponse{
 		Success: true,
 		Data:    family,
 	})
 }
 
-// UpdateFamily 更新家庭关系
+// UpdateFamily 更新家庭关系，带 If-Match（或请求体中的 version）时记录已被他人修改则返回 412
 func (h *FamilyHandler) UpdateFamily(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
@@ -177,9 +178,22 @@ func (h *FamilyHandler) UpdateFamily(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	version, ok := parseIfMatch(w, r)
+	if !ok {
+		return
+	}
+	if version != nil {
+		req.Version = version
+	}
 
 	family, err := h.service.Update(r.Context(), id, &req)
 	if err != nil {
+		if isVersionMismatch(err) {
+			if current, getErr := h.service.GetByID(r.Context(), id); getErr == nil {
+				respondVersionMismatch(w, current.Version)
+				return
+			}
+		}
 		respondJSON(w, http.StatusInternalServerError, APIResponse{
 			Success: false,
 			Message: err.Error(),
@@ -187,6 +201,7 @@ func (h *FamilyHandler) UpdateFamily(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setETag(w, family.Version)
 	respondJSON(w, http.StatusOK, APIResponse{
 		Success: true,
 		Data:    family,
@@ -194,7 +209,7 @@ func (h *FamilyHandler) UpdateFamily(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// DeleteFamily 删除家庭关系
+// DeleteFamily 删除家庭关系，带 If-Match 时记录已被他人修改则返回 412
 func (h *FamilyHandler) DeleteFamily(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
@@ -206,7 +221,18 @@ func (h *FamilyHandler) DeleteFamily(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.service.Delete(r.Context(), id); err != nil {
+	version, ok := parseIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Delete(r.Context(), id, version); err != nil {
+		if isVersionMismatch(err) {
+			if current, getErr := h.service.GetByID(r.Context(), id); getErr == nil {
+				respondVersionMismatch(w, current.Version)
+				return
+			}
+		}
 		respondJSON(w, http.StatusInternalServerError, APIResponse{
 			Success: false,
 			Message: err.Error(),
@@ -216,7 +242,7 @@ func (h *FamilyHandler) DeleteFamily(w http.ResponseWriter, r *http.Request) {
 
 	respondJSON(w, http.StatusOK, APIResponse{
 		Success: true,
-		Message: "删除成功",
+		Message: "删除成功，可在回收站中恢复",
 	})
 }
 
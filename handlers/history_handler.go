@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"familytree/interfaces"
+	"familytree/models"
+	"familytree/pkg/errors"
+	"familytree/pkg/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// historyEntityTypes 路径和查询参数中的记录类型名称
+var historyEntityTypes = map[string]models.EntityType{
+	"individual": models.EntityTypeIndividual,
+	"family":     models.EntityTypeFamily,
+	"child":      models.EntityTypeChild,
+	"event":      models.EntityTypeEvent,
+}
+
+// historyUnrecordedTypes 需求中列出、但因没有写入接口而未实现变更历史的记录类型
+var historyUnrecordedTypes = map[string]bool{"place": true, "source": true, "citation": true, "note": true}
+
+// parseHistoryEntityType 解析记录类型名称，不支持时返回错误信息
+func parseHistoryEntityType(name string) (models.EntityType, string) {
+	if entityType, ok := historyEntityTypes[name]; ok {
+		return entityType, ""
+	}
+	if historyUnrecordedTypes[name] {
+		return "", "地点、来源、引用和备注没有写入接口，不记录变更历史"
+	}
+	return "", "不支持的记录类型"
+}
+
+// HistoryHandler 变更历史处理器
+type HistoryHandler struct {
+	service interfaces.HistoryService
+}
+
+// NewHistoryHandler 创建变更历史处理器
+func NewHistoryHandler(service interfaces.HistoryService) *HistoryHandler {
+	return &HistoryHandler{service: service}
+}
+
+// GetEntityHistory 某条记录的变更历史，子女关系的ID为 "家庭ID/个人ID"
+func (h *HistoryHandler) GetEntityHistory(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "用户未认证",
+			Code:    string(errors.ErrCodeUnauthorized),
+		})
+		return
+	}
+
+	vars := mux.Vars(r)
+	entityType, message := parseHistoryEntityType(vars["entityType"])
+	if message != "" {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: message,
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	query, message := parseAuditQuery(r)
+	if message != "" {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: message,
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	entries, total, err := h.service.GetEntityHistory(r.Context(), user.UserID, entityType, vars["entityId"], query.Limit, query.Offset)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondHistory(w, entries, total, query)
+}
+
+// GetTreeHistory 家族树的变更历史。可按 user_id、entity_type、since、until（YYYY-MM-DD 或 RFC 3339）筛选，limit 默认 50
+func (h *HistoryHandler) GetTreeHistory(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "用户未认证",
+			Code:    string(errors.ErrCodeUnauthorized),
+		})
+		return
+	}
+
+	vars := mux.Vars(r)
+	familyTreeID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的家族树ID",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	query, message := parseAuditQuery(r)
+	if message != "" {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: message,
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	entries, total, err := h.service.GetTreeHistory(r.Context(), user.UserID, familyTreeID, query)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondHistory(w, entries, total, query)
+}
+
+// GetUserHistory 当前用户做过的修改，可按 family_tree_id、entity_type、since、until 筛选
+func (h *HistoryHandler) GetUserHistory(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "用户未认证",
+			Code:    string(errors.ErrCodeUnauthorized),
+		})
+		return
+	}
+
+	query, message := parseAuditQuery(r)
+	if message != "" {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: message,
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+	if v := r.URL.Query().Get("family_tree_id"); v != "" {
+		if query.FamilyTreeID, _ = strconv.Atoi(v); query.FamilyTreeID <= 0 {
+			respondJSON(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "无效的家族树ID",
+				Code:    string(errors.ErrCodeInvalidInput),
+			})
+			return
+		}
+	}
+
+	entries, total, err := h.service.GetUserHistory(r.Context(), user.UserID, query)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondHistory(w, entries, total, query)
+}
+
+// GetChangeSet 一个变更集中的全部修改，变更集ID见写操作响应头 X-Change-Set
+func (h *HistoryHandler) GetChangeSet(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "用户未认证",
+			Code:    string(errors.ErrCodeUnauthorized),
+		})
+		return
+	}
+
+	entries, err := h.service.GetChangeSet(r.Context(), user.UserID, mux.Vars(r)["changeSet"])
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    entries,
+	})
+}
+
+// RevertRecord 把个人或家庭恢复到某条变更之后的状态：{"audit_id", "force"}。
+// 记录在之后又被修改时返回 409 和冲突列表，force 为 true 时仍然覆盖
+func (h *HistoryHandler) RevertRecord(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "用户未认证",
+			Code:    string(errors.ErrCodeUnauthorized),
+		})
+		return
+	}
+
+	vars := mux.Vars(r)
+	entityType, message := parseHistoryEntityType(vars["entityType"])
+	if message != "" {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: message,
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	var req models.RevertRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的请求数据",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	result, err := h.service.RevertRecord(r.Context(), user.UserID, entityType, vars["entityId"], &req)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondRevert(w, result)
+}
+
+// UndoChangeSet 撤销一个变更集中的全部修改，请求体可以为空或 {"force": true}
+func (h *HistoryHandler) UndoChangeSet(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "用户未认证",
+			Code:    string(errors.ErrCodeUnauthorized),
+		})
+		return
+	}
+
+	var req models.RevertRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的请求数据",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	result, err := h.service.UndoChangeSet(r.Context(), user.UserID, mux.Vars(r)["changeSet"], &req)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondRevert(w, result)
+}
+
+// respondRevert 恢复成功返回新的变更记录，有冲突未执行时返回 409 和冲突列表
+func respondRevert(w http.ResponseWriter, result *models.RevertResult) {
+	if !result.Applied {
+		respondJSON(w, http.StatusConflict, APIResponse{
+			Success: false,
+			Data:    result,
+			Message: "存在冲突，未执行恢复",
+			Code:    string(errors.ErrCodeConflict),
+		})
+		return
+	}
+	respondJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    result,
+	})
+}
+
+// parseAuditQuery 解析变更历史的筛选和分页参数，出错时返回提示信息
+func parseAuditQuery(r *http.Request) (models.AuditQuery, string) {
+	values := r.URL.Query()
+	var query models.AuditQuery
+	var err error
+
+	if v := values.Get("user_id"); v != "" {
+		if query.UserID, err = strconv.Atoi(v); err != nil || query.UserID <= 0 {
+			return query, "无效的用户ID"
+		}
+	}
+	if v := values.Get("entity_type"); v != "" {
+		entityType, message := parseHistoryEntityType(v)
+		if message != "" {
+			return query, message
+		}
+		query.EntityType = entityType
+	}
+	for name, target := range map[string]**time.Time{"since": &query.Since, "until": &query.Until} {
+		v := values.Get(name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			if t, err = time.ParseInLocation("2006-01-02", v, time.Local); err != nil {
+				return query, name + " 的格式应为 YYYY-MM-DD 或 RFC 3339"
+			}
+		}
+		*target = &t
+	}
+	if v := values.Get("limit"); v != "" {
+		if query.Limit, err = strconv.Atoi(v); err != nil || query.Limit <= 0 {
+			return query, "无效的条数"
+		}
+	}
+	if v := values.Get("offset"); v != "" {
+		if query.Offset, err = strconv.Atoi(v); err != nil || query.Offset < 0 {
+			return query, "无效的偏移量"
+		}
+	}
+	return query, ""
+}
+
+// respondHistory 分页返回变更记录，未指定 limit 时不回显
+func respondHistory(w http.ResponseWriter, entries []models.AuditEntry, total int, query models.AuditQuery) {
+	response := APIResponse{
+		Success: true,
+		Data:    entries,
+		Total:   &total,
+		Offset:  &query.Offset,
+	}
+	if query.Limit > 0 {
+		response.Limit = &query.Limit
+	}
+	respondJSON(w, http.StatusOK, response)
+}
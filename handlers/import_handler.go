@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+
+	"familytree/interfaces"
+	"familytree/models"
+	"familytree/pkg/errors"
+	"familytree/pkg/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// maxImportUpload 上传表格的最大字节数
+const maxImportUpload = 10 << 20
+
+// ImportHandler 表格导入处理器
+type ImportHandler struct {
+	service interfaces.ImportService
+}
+
+// NewImportHandler 创建表格导入处理器
+func NewImportHandler(service interfaces.ImportService) *ImportHandler {
+	return &ImportHandler{service: service}
+}
+
+// GetImportColumns 上传表格（multipart 的 file 字段，XLSX 可用 sheet 选择工作表），返回表头、示例行和推测的列映射
+func (h *ImportHandler) GetImportColumns(w http.ResponseWriter, r *http.Request) {
+	user, familyTreeID, file, header, ok := parseImportUpload(w, r)
+	if !ok {
+		return
+	}
+	defer file.Close()
+
+	columns, err := h.service.Columns(r.Context(), user.UserID, familyTreeID, file, header.Filename, r.FormValue("sheet"))
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    columns,
+	})
+}
+
+// ImportSpreadsheet 按 mapping 字段中的列映射（JSON）导入表格；dry_run=true 时只校验，
+// match=false 时不与已有的人匹配。有行出错时返回 400 和每行的错误，不导入任何数据
+func (h *ImportHandler) ImportSpreadsheet(w http.ResponseWriter, r *http.Request) {
+	user, familyTreeID, file, header, ok := parseImportUpload(w, r)
+	if !ok {
+		return
+	}
+	defer file.Close()
+
+	req := models.ImportRequest{Sheet: r.FormValue("sheet")}
+	if err := json.Unmarshal([]byte(r.FormValue("mapping")), &req.Mapping); err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的列映射",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+	dryRun, err := formBool(r, "dry_run", false)
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的参数 dry_run",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+	match, err := formBool(r, "match", true)
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的参数 match",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+	req.DryRun, req.NoMatch = dryRun, !match
+
+	result, err := h.service.Import(r.Context(), user.UserID, familyTreeID, file, header.Filename, &req)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	if result.Summary.Invalid > 0 && !result.DryRun {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Data:    result,
+			Message: "有 " + strconv.Itoa(result.Summary.Invalid) + " 行数据有误，未导入",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+	message := "导入完成"
+	if result.DryRun {
+		message = "预览，未导入"
+	}
+	respondJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    result,
+		Message: message,
+	})
+}
+
+// parseImportUpload 解析家族树ID和上传的表格，出错时已写入响应
+func parseImportUpload(w http.ResponseWriter, r *http.Request) (*models.AuthContext, int, multipart.File, *multipart.FileHeader, bool) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "用户未认证",
+			Code:    string(errors.ErrCodeUnauthorized),
+		})
+		return nil, 0, nil, nil, false
+	}
+
+	familyTreeID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的家族树ID",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return nil, 0, nil, nil, false
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportUpload)
+	if err := r.ParseMultipartForm(maxImportUpload); err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的上传数据，文件不能超过 10MB",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return nil, 0, nil, nil, false
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "缺少上传的文件",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return nil, 0, nil, nil, false
+	}
+	return user, familyTreeID, file, header, true
+}
+
+// formBool 表单中的布尔参数，未提供时返回 def
+func formBool(r *http.Request, name string, def bool) (bool, error) {
+	v := r.FormValue(name)
+	if v == "" {
+		return def, nil
+	}
+	return strconv.ParseBool(v)
+}
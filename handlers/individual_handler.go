@@ -1,10 +1,15 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
 	"familytree/interfaces"
 	"familytree/models"
+	"familytree/pkg/chart"
+	"familytree/pkg/dot"
 	"familytree/pkg/errors"
+	"familytree/pkg/layout"
+	"familytree/pkg/lineagechart"
 	"familytree/pkg/middleware"
 	"fmt"
 	"net/http"
@@ -115,13 +120,14 @@ func (h *IndividualHandler) GetIndividual(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	setETag(w, individual.Version)
 	respondJSON(w, http.StatusOK, APIResponse{
 		Success: true,
 		Data:    individual,
 	})
 }
 
-// UpdateIndividual 更新个人信息
+// UpdateIndividual 更新个人信息，带 If-Match（或请求体中的 version）时记录已被他人修改则返回 412
 func (h *IndividualHandler) UpdateIndividual(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
@@ -143,13 +149,27 @@ func (h *IndividualHandler) UpdateIndividual(w http.ResponseWriter, r *http.Requ
 		})
 		return
 	}
+	version, ok := parseIfMatch(w, r)
+	if !ok {
+		return
+	}
+	if version != nil {
+		req.Version = version
+	}
 
 	individual, err := h.service.Update(r.Context(), id, &req)
 	if err != nil {
+		if isVersionMismatch(err) {
+			if current, getErr := h.service.GetByID(r.Context(), id); getErr == nil {
+				respondVersionMismatch(w, current.Version)
+				return
+			}
+		}
 		handleError(w, err)
 		return
 	}
 
+	setETag(w, individual.Version)
 	respondJSON(w, http.StatusOK, APIResponse{
 		Success: true,
 		Data:    individual,
@@ -157,7 +177,7 @@ func (h *IndividualHandler) UpdateIndividual(w http.ResponseWriter, r *http.Requ
 	})
 }
 
-// DeleteIndividual 删除个人信息
+// DeleteIndividual 删除个人信息，带 If-Match 时记录已被他人修改则返回 412
 func (h *IndividualHandler) DeleteIndividual(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
@@ -169,15 +189,25 @@ func (h *IndividualHandler) DeleteIndividual(w http.ResponseWriter, r *http.Requ
 		})
 		return
 	}
+	version, ok := parseIfMatch(w, r)
+	if !ok {
+		return
+	}
 
-	if err := h.service.Delete(r.Context(), id); err != nil {
+	if err := h.service.Delete(r.Context(), id, version); err != nil {
+		if isVersionMismatch(err) {
+			if current, getErr := h.service.GetByID(r.Context(), id); getErr == nil {
+				respondVersionMismatch(w, current.Version)
+				return
+			}
+		}
 		handleError(w, err)
 		return
 	}
 
 	respondJSON(w, http.StatusOK, APIResponse{
 		Success: true,
-		Message: "删除成功",
+		Message: "删除成功，可在回收站中恢复",
 	})
 }
 
@@ -417,6 +447,521 @@ func (h *IndividualHandler) GetDescendants(w http.ResponseWriter, r *http.Reques
 	})
 }
 
+// GetLineage 获取带代数和父母边的祖先或后代世系
+func (h *IndividualHandler) GetLineage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的ID",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	generations := 0 // 由服务层决定默认代数
+	if generationsStr := r.URL.Query().Get("generations"); generationsStr != "" {
+		if g, err := strconv.Atoi(generationsStr); err == nil && g > 0 {
+			generations = g
+		}
+	}
+
+	var lineage []models.LineageEntry
+	switch direction := r.URL.Query().Get("direction"); direction {
+	case "", "ancestors":
+		lineage, err = h.service.GetAncestorLineage(r.Context(), id, generations)
+	case "descendants":
+		lineage, err = h.service.GetDescendantLineage(r.Context(), id, generations)
+	default:
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "direction 只能是 ancestors 或 descendants",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    lineage,
+	})
+}
+
+// GetRelationship 计算两人之间的血缘关系
+func (h *IndividualHandler) GetRelationship(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的ID",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+	otherID, err := strconv.Atoi(vars["otherId"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的对方ID",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	relationship, err := h.service.GetRelationship(r.Context(), id, otherID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    relationship,
+	})
+}
+
+// GetHourglass 获取沙漏图（祖先与后代），支持嵌套树和平铺图两种格式
+func (h *IndividualHandler) GetHourglass(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的ID",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	query := r.URL.Query()
+	ancestors, descendants := 3, 3 // 默认上下各3代
+	if v := query.Get("ancestors"); v != "" {
+		if g, err := strconv.Atoi(v); err == nil && g >= 0 {
+			ancestors = g
+		}
+	}
+	if v := query.Get("descendants"); v != "" {
+		if g, err := strconv.Atoi(v); err == nil && g >= 0 {
+			descendants = g
+		}
+	}
+
+	format := query.Get("format")
+	if format != "" && format != "nested" && format != "graph" && format != "both" {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "format 只能是 nested、graph 或 both",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	hourglass, err := h.service.GetHourglass(r.Context(), id, ancestors, descendants)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	switch format {
+	case "nested":
+		hourglass.Graph = nil
+	case "graph":
+		hourglass.Tree = nil
+	}
+
+	respondJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    hourglass,
+	})
+}
+
+// GetLayout 获取服务端计算的家族树布局坐标
+func (h *IndividualHandler) GetLayout(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的ID",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	query := r.URL.Query()
+	orientation := layout.Orientation(query.Get("orientation"))
+	if orientation == "" {
+		orientation = layout.OrientationDescendant
+	}
+
+	generations := 3
+	if v := query.Get("generations"); v != "" {
+		if g, err := strconv.Atoi(v); err == nil && g >= 0 {
+			generations = g
+		}
+	}
+
+	var ancestors, descendants int
+	switch orientation {
+	case layout.OrientationDescendant:
+		descendants = generations
+	case layout.OrientationAncestor:
+		ancestors = generations
+	case layout.OrientationHourglass:
+		ancestors, descendants = generations, generations
+	default:
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "orientation 只能是 descendant、ancestor 或 hourglass",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	hourglass, err := h.service.GetHourglass(r.Context(), id, ancestors, descendants)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	opts := layout.DefaultOptions()
+	for name, target := range map[string]*float64{
+		"node_width":  &opts.NodeWidth,
+		"node_height": &opts.NodeHeight,
+		"spouse_gap":  &opts.SpouseGap,
+		"sibling_gap": &opts.SiblingGap,
+		"level_gap":   &opts.LevelGap,
+	} {
+		if v, err := strconv.ParseFloat(query.Get(name), 64); err == nil && v > 0 {
+			*target = v
+		}
+	}
+
+	var result *layout.Layout
+	switch orientation {
+	case layout.OrientationDescendant:
+		result = layout.Descendants(hourglass.Tree, opts)
+	case layout.OrientationAncestor:
+		result = layout.Ancestors(hourglass.Tree, opts)
+	default:
+		result = layout.Hourglass(hourglass.Tree, opts)
+	}
+
+	respondJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    result,
+	})
+}
+
+// GetChart 渲染 SVG 图表
+func (h *IndividualHandler) GetChart(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的ID",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	query := r.URL.Query()
+	opts := chart.DefaultOptions()
+	if v := query.Get("type"); v != "" {
+		chartType, ok := chart.ParseType(v)
+		if !ok {
+			respondJSON(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "type 只能是 pedigree、descendant、fan 或 hourglass",
+				Code:    string(errors.ErrCodeInvalidInput),
+			})
+			return
+		}
+		opts.Type = chartType
+	}
+	if v := query.Get("color"); v != "" {
+		colorMode, ok := chart.ParseColorMode(v)
+		if !ok {
+			respondJSON(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "color 只能是 gender、lineage 或 none",
+				Code:    string(errors.ErrCodeInvalidInput),
+			})
+			return
+		}
+		opts.ColorBy = colorMode
+	}
+	if v, err := strconv.ParseBool(query.Get("photos")); err == nil {
+		opts.ShowPhotos = v
+	}
+	if v, err := strconv.ParseBool(query.Get("dates")); err == nil {
+		opts.ShowDates = v
+	}
+	if v := query.Get("font"); v != "" {
+		if !chart.ValidFontFamily(v) {
+			respondJSON(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "无效的字体，只能包含文字、数字、空格、逗号、单引号和连字符",
+				Code:    string(errors.ErrCodeInvalidInput),
+			})
+			return
+		}
+		opts.FontFamily = v
+	}
+
+	generations := 4
+	if v := query.Get("generations"); v != "" {
+		if g, err := strconv.Atoi(v); err == nil && g >= 0 {
+			generations = g
+		}
+	}
+
+	var ancestors, descendants int
+	switch opts.Type {
+	case chart.TypePedigree, chart.TypeFan:
+		ancestors = generations
+	case chart.TypeDescendant:
+		descendants = generations
+	case chart.TypeHourglass:
+		ancestors, descendants = generations, generations
+	}
+
+	hourglass, err := h.service.GetHourglass(r.Context(), id, ancestors, descendants)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	var svg bytes.Buffer
+	if err := chart.Render(&svg, hourglass.Tree, opts); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	svg.WriteTo(w)
+}
+
+// GetGraphDot 导出 Graphviz DOT：direction 为 ancestors、descendants 或 both（默认），generations 默认 4
+func (h *IndividualHandler) GetGraphDot(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的ID",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	query := r.URL.Query()
+	generations := 4
+	if v := query.Get("generations"); v != "" {
+		if g, err := strconv.Atoi(v); err == nil && g >= 0 {
+			generations = g
+		}
+	}
+
+	var ancestors, descendants int
+	switch query.Get("direction") {
+	case "", "both":
+		ancestors, descendants = generations, generations
+	case "ancestors":
+		ancestors = generations
+	case "descendants":
+		descendants = generations
+	default:
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "direction 只能是 ancestors、descendants 或 both",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	hourglass, err := h.service.GetHourglass(r.Context(), id, ancestors, descendants)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	opts := dot.Options{RootID: id}
+	if hourglass.Tree != nil {
+		opts.Title = hourglass.Tree.Individual.FullName
+	}
+	var out bytes.Buffer
+	if err := dot.Write(&out, hourglass.Graph, opts); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	out.WriteTo(w)
+}
+
+// GetLineageChart 生成欧式、苏式世系图
+func (h *IndividualHandler) GetLineageChart(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的ID",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	query := r.URL.Query()
+	opts := lineagechart.DefaultOptions()
+	if v := query.Get("style"); v != "" {
+		style, ok := lineagechart.ParseStyle(v)
+		if !ok {
+			respondJSON(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "style 只能是 ou 或 su",
+				Code:    string(errors.ErrCodeInvalidInput),
+			})
+			return
+		}
+		opts.Style = style
+	}
+	opts.Title = query.Get("title")
+
+	format := query.Get("format")
+	if format == "" {
+		format = "html"
+	}
+	if format != "html" && format != "svg" {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "format 只能是 html 或 svg",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	generations := 10
+	if v := query.Get("generations"); v != "" {
+		if g, err := strconv.Atoi(v); err == nil && g > 0 {
+			generations = g
+		}
+	}
+
+	hourglass, err := h.service.GetHourglass(r.Context(), id, 0, generations)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	var out bytes.Buffer
+	chart := lineagechart.Build(hourglass.Tree, opts)
+	if format == "svg" {
+		err = chart.WriteSVG(&out)
+		w.Header().Set("Content-Type", "image/svg+xml; charset=utf-8")
+	} else {
+		err = chart.WriteHTML(&out)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	if err != nil {
+		w.Header().Del("Content-Type")
+		handleError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	out.WriteTo(w)
+}
+
+// GetAlternateNames 获取个人的字、号
+func (h *IndividualHandler) GetAlternateNames(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的ID",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	names, err := h.service.GetAlternateNames(r.Context(), id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	// 字号属于个人，ETag 为个人的版本
+	if current, err := h.service.GetByID(r.Context(), id); err == nil {
+		setETag(w, current.Version)
+	}
+
+	respondJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    names,
+	})
+}
+
+// UpdateAlternateNames 更新个人的字、号，带 If-Match 时与个人的版本比较，已被他人修改则返回 412
+func (h *IndividualHandler) UpdateAlternateNames(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的ID",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	var req models.AlternateNames
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的请求数据",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	version, ok := parseIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	names, err := h.service.UpdateAlternateNames(r.Context(), id, &req, version)
+	if err != nil {
+		if isVersionMismatch(err) {
+			if current, getErr := h.service.GetByID(r.Context(), id); getErr == nil {
+				respondVersionMismatch(w, current.Version)
+				return
+			}
+		}
+		handleError(w, err)
+		return
+	}
+	if current, err := h.service.GetByID(r.Context(), id); err == nil {
+		setETag(w, current.Version)
+	}
+
+	respondJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    names,
+		Message: "更新成功",
+	})
+}
+
 // GetFamilyTree 获取家族树
 func (h *IndividualHandler) GetFamilyTree(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
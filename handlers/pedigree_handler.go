@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"familytree/interfaces"
+	"familytree/pkg/errors"
+	"familytree/pkg/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// PedigreeHandler 家谱结构分析处理器
+type PedigreeHandler struct {
+	service interfaces.PedigreeService
+}
+
+// NewPedigreeHandler 创建家谱结构分析处理器
+func NewPedigreeHandler(service interfaces.PedigreeService) *PedigreeHandler {
+	return &PedigreeHandler{service: service}
+}
+
+// AnalyzeFamilyTree 分析家族树中的循环关系与祖先重叠
+func (h *PedigreeHandler) AnalyzeFamilyTree(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "用户未认证",
+			Code:    string(errors.ErrCodeUnauthorized),
+		})
+		return
+	}
+
+	vars := mux.Vars(r)
+	familyTreeID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的家族树ID",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	var rootID *int
+	if rootStr := r.URL.Query().Get("root_id"); rootStr != "" {
+		id, err := strconv.Atoi(rootStr)
+		if err != nil || id <= 0 {
+			respondJSON(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "无效的根节点ID",
+				Code:    string(errors.ErrCodeInvalidInput),
+			})
+			return
+		}
+		rootID = &id
+	}
+
+	analysis, err := h.service.AnalyzeFamilyTree(r.Context(), user.UserID, familyTreeID, rootID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    analysis,
+	})
+}
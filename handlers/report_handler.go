@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"familytree/interfaces"
+	"familytree/models"
+	"familytree/pkg/book"
+	"familytree/pkg/errors"
+	"familytree/pkg/report"
+
+	"github.com/gorilla/mux"
+)
+
+// ReportHandler 世系报告处理器
+type ReportHandler struct {
+	service  interfaces.ReportService
+	fontPath string // PDF 家庭表使用的字体，与书籍相同
+}
+
+// NewReportHandler 创建世系报告处理器
+func NewReportHandler(service interfaces.ReportService, fontPath string) *ReportHandler {
+	return &ReportHandler{service: service, fontPath: fontPath}
+}
+
+// GetReport 生成世系报告，format 为 json（默认）、text、markdown 或 html
+func (h *ReportHandler) GetReport(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的ID",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	switch format {
+	case "", "json", report.FormatText, report.FormatMarkdown, report.FormatHTML:
+	default:
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "format 只能是 json、text、markdown 或 html",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	opts := models.ReportOptions{
+		Type:      query.Get("type"),
+		Style:     query.Get("style"),
+		Numbering: query.Get("numbering"),
+	}
+	if v := query.Get("generations"); v != "" {
+		if opts.Generations, err = strconv.Atoi(v); err != nil {
+			respondJSON(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "无效的代数",
+				Code:    string(errors.ErrCodeInvalidInput),
+			})
+			return
+		}
+	}
+
+	result, err := h.service.GetReport(r.Context(), id, opts)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if format == "" || format == "json" {
+		respondJSON(w, http.StatusOK, APIResponse{
+			Success: true,
+			Data:    result,
+		})
+		return
+	}
+	w.Header().Set("Content-Type", report.ContentType(format))
+	w.WriteHeader(http.StatusOK)
+	report.Write(w, result, format)
+}
+
+// GetFamilyGroupSheet 家庭表，format 为 json（默认）、html 或 pdf
+func (h *ReportHandler) GetFamilyGroupSheet(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的家庭ID",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "", "json", "html":
+	case "pdf":
+		if h.fontPath == "" {
+			respondJSON(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "未配置书籍字体，请设置 BOOK_FONT_PATH",
+				Code:    string(errors.ErrCodeInvalidInput),
+			})
+			return
+		}
+	default:
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "format 只能是 json、html 或 pdf",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	sheet, err := h.service.GetFamilyGroupSheet(r.Context(), id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	switch format {
+	case "html":
+		w.Header().Set("Content-Type", report.ContentType(report.FormatHTML))
+		w.WriteHeader(http.StatusOK)
+		report.WriteFamilyGroupSheetHTML(w, sheet)
+	case "pdf":
+		// 先写入缓冲区，排版失败时仍可返回 JSON 错误
+		var buf bytes.Buffer
+		if err := book.WriteFamilyGroupSheet(&buf, sheet, h.fontPath); err != nil {
+			handleError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="family-%d.pdf"; filename*=UTF-8''%s`,
+			id, url.PathEscape(sheet.Title+".pdf")))
+		w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+		w.WriteHeader(http.StatusOK)
+		buf.WriteTo(w)
+	default:
+		respondJSON(w, http.StatusOK, APIResponse{
+			Success: true,
+			Data:    sheet,
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"familytree/interfaces"
+	"familytree/models"
+	"familytree/pkg/errors"
+	"familytree/pkg/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// ResearchHandler 资料完整度与研究缺口处理器
+type ResearchHandler struct {
+	service interfaces.ResearchService
+}
+
+// NewResearchHandler 创建资料完整度与研究缺口处理器
+func NewResearchHandler(service interfaces.ResearchService) *ResearchHandler {
+	return &ResearchHandler{service: service}
+}
+
+// GetCompleteness 个人资料的完整度评分
+func (h *ResearchHandler) GetCompleteness(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的ID",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	result, err := h.service.GetCompleteness(r.Context(), id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    result,
+	})
+}
+
+// GetTreeCompleteness 家族树全体成员的完整度评分
+func (h *ResearchHandler) GetTreeCompleteness(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "用户未认证",
+			Code:    string(errors.ErrCodeUnauthorized),
+		})
+		return
+	}
+
+	vars := mux.Vars(r)
+	familyTreeID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的家族树ID",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	result, err := h.service.GetTreeCompleteness(r.Context(), user.UserID, familyTreeID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    result,
+	})
+}
+
+// GetResearchGaps 研究缺口。root_id 默认为家族树的起始人物，
+// types 为逗号分隔的 end_of_line、missing_birth_date、unsourced_fact，limit 默认 100
+func (h *ResearchHandler) GetResearchGaps(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "用户未认证",
+			Code:    string(errors.ErrCodeUnauthorized),
+		})
+		return
+	}
+
+	vars := mux.Vars(r)
+	familyTreeID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的家族树ID",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	query := r.URL.Query()
+	var opts models.GapOptions
+	if v := query.Get("root_id"); v != "" {
+		rootID, err := strconv.Atoi(v)
+		if err != nil || rootID <= 0 {
+			respondJSON(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "无效的起始人物ID",
+				Code:    string(errors.ErrCodeInvalidInput),
+			})
+			return
+		}
+		opts.RootID = &rootID
+	}
+	if v := query.Get("types"); v != "" {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				opts.Types = append(opts.Types, t)
+			}
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		if opts.Limit, err = strconv.Atoi(v); err != nil || opts.Limit <= 0 {
+			respondJSON(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "无效的条数",
+				Code:    string(errors.ErrCodeInvalidInput),
+			})
+			return
+		}
+	}
+
+	result, err := h.service.GetResearchGaps(r.Context(), user.UserID, familyTreeID, opts)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    result,
+	})
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"familytree/interfaces"
+	"familytree/models"
+	"familytree/pkg/errors"
+	"familytree/pkg/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// SnapshotHandler 家族树快照处理器
+type SnapshotHandler struct {
+	service interfaces.SnapshotService
+}
+
+// NewSnapshotHandler 创建家族树快照处理器
+func NewSnapshotHandler(service interfaces.SnapshotService) *SnapshotHandler {
+	return &SnapshotHandler{service: service}
+}
+
+// CreateSnapshot 保存家族树当前状态：{"name", "description"}
+func (h *SnapshotHandler) CreateSnapshot(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "用户未认证",
+			Code:    string(errors.ErrCodeUnauthorized),
+		})
+		return
+	}
+
+	familyTreeID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的家族树ID",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	var req models.CreateSnapshotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的请求数据",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	snapshot, err := h.service.CreateSnapshot(r.Context(), user.UserID, familyTreeID, &req)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, APIResponse{
+		Success: true,
+		Data:    snapshot,
+		Message: "快照已保存",
+	})
+}
+
+// GetSnapshots 家族树的全部快照
+func (h *SnapshotHandler) GetSnapshots(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "用户未认证",
+			Code:    string(errors.ErrCodeUnauthorized),
+		})
+		return
+	}
+
+	familyTreeID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的家族树ID",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	snapshots, err := h.service.GetSnapshots(r.Context(), user.UserID, familyTreeID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    snapshots,
+	})
+}
+
+// DeleteSnapshot 删除快照
+func (h *SnapshotHandler) DeleteSnapshot(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "用户未认证",
+			Code:    string(errors.ErrCodeUnauthorized),
+		})
+		return
+	}
+
+	snapshotID, ok := parseSnapshotID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.service.DeleteSnapshot(r.Context(), user.UserID, snapshotID); err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "快照已删除",
+	})
+}
+
+// DiffSnapshot 快照与另一个快照（查询参数 to）或当前状态之间的差异
+func (h *SnapshotHandler) DiffSnapshot(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "用户未认证",
+			Code:    string(errors.ErrCodeUnauthorized),
+		})
+		return
+	}
+
+	snapshotID, ok := parseSnapshotID(w, r)
+	if !ok {
+		return
+	}
+	var toSnapshotID int
+	if v := r.URL.Query().Get("to"); v != "" && v != "current" {
+		var err error
+		if toSnapshotID, err = strconv.Atoi(v); err != nil || toSnapshotID <= 0 {
+			respondJSON(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "to 应为快照ID或 current",
+				Code:    string(errors.ErrCodeInvalidInput),
+			})
+			return
+		}
+	}
+
+	diff, err := h.service.DiffSnapshot(r.Context(), user.UserID, snapshotID, toSnapshotID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    diff,
+	})
+}
+
+// RollbackToSnapshot 把家族树回滚到快照时的状态
+func (h *SnapshotHandler) RollbackToSnapshot(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "用户未认证",
+			Code:    string(errors.ErrCodeUnauthorized),
+		})
+		return
+	}
+
+	snapshotID, ok := parseSnapshotID(w, r)
+	if !ok {
+		return
+	}
+	result, err := h.service.RollbackToSnapshot(r.Context(), user.UserID, snapshotID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    result,
+		Message: "已回滚到快照",
+	})
+}
+
+// parseSnapshotID 解析路径中的快照ID，无效时直接响应 400
+func parseSnapshotID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	snapshotID, err := strconv.Atoi(mux.Vars(r)["snapshotId"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的快照ID",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return 0, false
+	}
+	return snapshotID, true
+}
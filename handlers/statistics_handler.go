@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"familytree/interfaces"
+	"familytree/pkg/errors"
+	"familytree/pkg/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// StatisticsHandler 家族树统计处理器
+type StatisticsHandler struct {
+	service interfaces.StatisticsService
+}
+
+// NewStatisticsHandler 创建家族树统计处理器
+func NewStatisticsHandler(service interfaces.StatisticsService) *StatisticsHandler {
+	return &StatisticsHandler{service: service}
+}
+
+// GetTreeStatistics 家族树统计，top 为各类排行的条数（默认 10）
+func (h *StatisticsHandler) GetTreeStatistics(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "用户未认证",
+			Code:    string(errors.ErrCodeUnauthorized),
+		})
+		return
+	}
+
+	vars := mux.Vars(r)
+	familyTreeID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的家族树ID",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	top := 0
+	if v := r.URL.Query().Get("top"); v != "" {
+		if top, err = strconv.Atoi(v); err != nil || top <= 0 {
+			respondJSON(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "无效的排行条数",
+				Code:    string(errors.ErrCodeInvalidInput),
+			})
+			return
+		}
+	}
+
+	stats, err := h.service.GetTreeStatistics(r.Context(), user.UserID, familyTreeID, top)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    stats,
+	})
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"familytree/interfaces"
+	"familytree/pkg/errors"
+
+	"github.com/gorilla/mux"
+)
+
+// TimelineHandler 个人时间线处理器
+type TimelineHandler struct {
+	service interfaces.TimelineService
+}
+
+// NewTimelineHandler 创建个人时间线处理器
+func NewTimelineHandler(service interfaces.TimelineService) *TimelineHandler {
+	return &TimelineHandler{service: service}
+}
+
+// GetTimeline 个人时间线，history=true 时穿插历史事件
+func (h *TimelineHandler) GetTimeline(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的ID",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	includeHistory := false
+	if v := r.URL.Query().Get("history"); v != "" {
+		if includeHistory, err = strconv.ParseBool(v); err != nil {
+			respondJSON(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "history 只能是 true 或 false",
+				Code:    string(errors.ErrCodeInvalidInput),
+			})
+			return
+		}
+	}
+
+	timeline, err := h.service.GetTimeline(r.Context(), id, includeHistory)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    timeline,
+	})
+}
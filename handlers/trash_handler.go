@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"familytree/interfaces"
+	"familytree/pkg/errors"
+	"familytree/pkg/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// TrashHandler 回收站处理器
+type TrashHandler struct {
+	service interfaces.TrashService
+}
+
+// NewTrashHandler 创建回收站处理器
+func NewTrashHandler(service interfaces.TrashService) *TrashHandler {
+	return &TrashHandler{service: service}
+}
+
+// GetTrash 家族树回收站中的记录，最近删除的在前，limit 默认 50
+func (h *TrashHandler) GetTrash(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "用户未认证",
+			Code:    string(errors.ErrCodeUnauthorized),
+		})
+		return
+	}
+
+	vars := mux.Vars(r)
+	familyTreeID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的家族树ID",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	var limit, offset int
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			respondJSON(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "无效的条数",
+				Code:    string(errors.ErrCodeInvalidInput),
+			})
+			return
+		}
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			respondJSON(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "无效的偏移量",
+				Code:    string(errors.ErrCodeInvalidInput),
+			})
+			return
+		}
+	}
+
+	items, total, err := h.service.GetTrash(r.Context(), user.UserID, familyTreeID, limit, offset)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	response := APIResponse{
+		Success: true,
+		Data:    items,
+		Total:   &total,
+		Offset:  &offset,
+	}
+	if limit > 0 {
+		response.Limit = &limit
+	}
+	respondJSON(w, http.StatusOK, response)
+}
+
+// RestoreTrash 从回收站恢复，引用的父母、配偶仍在回收站中时返回 409 和冲突列表
+func (h *TrashHandler) RestoreTrash(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "用户未认证",
+			Code:    string(errors.ErrCodeUnauthorized),
+		})
+		return
+	}
+
+	trashID, err := strconv.Atoi(mux.Vars(r)["trashId"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的回收站记录ID",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	result, err := h.service.Restore(r.Context(), user.UserID, trashID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	respondRevert(w, result)
+}
+
+// PurgeTrash 从回收站永久删除
+func (h *TrashHandler) PurgeTrash(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "用户未认证",
+			Code:    string(errors.ErrCodeUnauthorized),
+		})
+		return
+	}
+
+	trashID, err := strconv.Atoi(mux.Vars(r)["trashId"])
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "无效的回收站记录ID",
+			Code:    string(errors.ErrCodeInvalidInput),
+		})
+		return
+	}
+
+	if err := h.service.Purge(r.Context(), user.UserID, trashID); err != nil {
+		handleError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "已永久删除",
+	})
+}
@@ -3,6 +3,8 @@ package interfaces
 import (
 	"context"
 	"familytree/models"
+	"io"
+	"time"
 )
 
 // IndividualService 个人信息服务接口
@@ -18,8 +20,8 @@ type IndividualService interface {
 	// 更新个人信息
 	Update(ctx context.Context, id int, req *models.UpdateIndividualRequest) (*models.Individual, error)
 
-	// 删除个人信息
-	Delete(ctx context.Context, id int) error
+	// 删除个人信息，version 非空时与当前版本不一致则不删除
+	Delete(ctx context.Context, id int, version *int) error
 
 	// 搜索个人信息
 	Search(ctx context.Context, query string, limit, offset int) ([]models.Individual, int, error)
@@ -44,9 +46,23 @@ type IndividualService interface {
 	// 获取个人的所有后代
 	GetDescendants(ctx context.Context, id int, generations int) ([]models.Individual, error)
 
+	// 获取带代数和父母边的祖先/后代世系
+	GetAncestorLineage(ctx context.Context, id int, generations int) ([]models.LineageEntry, error)
+	GetDescendantLineage(ctx context.Context, id int, generations int) ([]models.LineageEntry, error)
+
 	// 获取家族树
 	GetFamilyTree(ctx context.Context, rootID int, generations int) (*models.FamilyTreeNode, error)
 
+	// 计算两人之间的血缘关系
+	GetRelationship(ctx context.Context, id1, id2 int) (*models.Relationship, error)
+
+	// 获取沙漏图：向上若干代祖先、向下若干代后代（按家庭分组并附带配偶）
+	GetHourglass(ctx context.Context, rootID int, ancestorGenerations, descendantGenerations int) (*models.Hourglass, error)
+
+	// 获取、更新个人的字、号
+	GetAlternateNames(ctx context.Context, id int) (*models.AlternateNames, error)
+	UpdateAlternateNames(ctx context.Context, id int, names *models.AlternateNames, version *int) (*models.AlternateNames, error)
+
 	// 向上添加父母
 	AddParent(ctx context.Context, childID int, req *models.AddParentRequest) (*models.Individual, error)
 }
@@ -62,8 +78,8 @@ type FamilyService interface {
 	// 更新家庭关系
 	Update(ctx context.Context, id int, req *models.CreateFamilyRequest) (*models.Family, error)
 
-	// 删除家庭关系
-	Delete(ctx context.Context, id int) error
+	// 删除家庭关系，version 非空时与当前版本不一致则不删除
+	Delete(ctx context.Context, id int, version *int) error
 
 	// 根据夫妻ID获取家庭关系
 	GetBySpouses(ctx context.Context, husbandID, wifeID int) (*models.Family, error)
@@ -84,6 +100,159 @@ type FamilyService interface {
 	GetChildren(ctx context.Context, familyID int) ([]models.Child, error)
 }
 
+// PedigreeService 家谱结构分析服务接口
+type PedigreeService interface {
+	// 分析家族树中的循环关系与祖先重叠，rootID 不为空时仅分析该人及其祖先
+	AnalyzeFamilyTree(ctx context.Context, userID, familyTreeID int, rootID *int) (*models.PedigreeAnalysis, error)
+}
+
+// BookService 家谱书籍生成服务接口
+type BookService interface {
+	// 提交书籍生成任务，任务在后台执行
+	StartBook(ctx context.Context, userID, rootID int, req *models.BookRequest) (*models.BookJob, error)
+
+	// 查询书籍生成任务
+	GetBookJob(ctx context.Context, userID int, jobID string) (*models.BookJob, error)
+
+	// 打开已生成的书籍文件
+	OpenBook(ctx context.Context, userID int, jobID string) (*models.BookJob, io.ReadCloser, error)
+}
+
+// ReportService 世系报告服务接口
+type ReportService interface {
+	// 生成后代报告（Register/NGSQ 体例）或祖先报告（Ahnentafel 编号）
+	GetReport(ctx context.Context, individualID int, opts models.ReportOptions) (*models.Report, error)
+
+	// 生成家庭表：夫妻、婚姻、子女及来源
+	GetFamilyGroupSheet(ctx context.Context, familyID int) (*models.FamilyGroupSheet, error)
+}
+
+// TimelineService 个人时间线服务接口
+type TimelineService interface {
+	// 本人事件与亲属的出生、婚姻、去世按时间合并，可选穿插历史事件
+	GetTimeline(ctx context.Context, individualID int, includeHistory bool) (*models.Timeline, error)
+}
+
+// SiteService 静态网站生成服务接口
+type SiteService interface {
+	// 将家族树导出为静态网站，在世的人隐去信息
+	GenerateSite(ctx context.Context, familyTreeID int, dir string, opts models.SiteOptions) (*models.SiteResult, error)
+}
+
+// CalendarService 生日与纪念日日历服务接口
+type CalendarService interface {
+	// 列出家族树在一段时间内的生日、结婚纪念日和忌日，按公历和农历分别计算
+	GetAnniversaries(ctx context.Context, userID, familyTreeID int, opts models.CalendarOptions) (*models.AnniversaryCalendar, error)
+
+	// 创建或更换用户的订阅令牌，旧链接随即失效
+	CreateFeed(ctx context.Context, userID int) (*models.CalendarFeed, error)
+
+	// 获取用户的订阅信息
+	GetFeedInfo(ctx context.Context, userID int) (*models.CalendarFeed, error)
+
+	// 取消订阅
+	RevokeFeed(ctx context.Context, userID int) error
+
+	// 按订阅令牌生成用户全部家族树的纪念日
+	GetFeed(ctx context.Context, token string) (*models.AnniversaryCalendar, error)
+}
+
+// StatisticsService 家族树统计服务接口
+type StatisticsService interface {
+	// 人口构成、寿命、婚育年龄、姓名、职业、出生地等统计，top 为各类排行的条数
+	GetTreeStatistics(ctx context.Context, userID, familyTreeID int, top int) (*models.TreeStatistics, error)
+}
+
+// ResearchService 资料完整度与研究缺口服务接口
+type ResearchService interface {
+	// 个人资料的完整度评分
+	GetCompleteness(ctx context.Context, individualID int) (*models.Completeness, error)
+
+	// 家族树全体成员的完整度评分
+	GetTreeCompleteness(ctx context.Context, userID, familyTreeID int) (*models.TreeCompleteness, error)
+
+	// 列出断线祖先、缺少出生日期的人和没有来源的事实，按与起始人物相隔的代数排列
+	GetResearchGaps(ctx context.Context, userID, familyTreeID int, opts models.GapOptions) (*models.ResearchGaps, error)
+}
+
+// HistoryService 变更历史服务接口
+type HistoryService interface {
+	// 某条记录的变更历史
+	GetEntityHistory(ctx context.Context, userID int, entityType models.EntityType, entityID string, limit, offset int) ([]models.AuditEntry, int, error)
+
+	// 家族树的变更历史，可按操作人、记录类型和时间筛选
+	GetTreeHistory(ctx context.Context, userID, familyTreeID int, query models.AuditQuery) ([]models.AuditEntry, int, error)
+
+	// 用户本人做过的修改
+	GetUserHistory(ctx context.Context, userID int, query models.AuditQuery) ([]models.AuditEntry, int, error)
+
+	// 一个变更集（一次请求）中的全部修改
+	GetChangeSet(ctx context.Context, userID int, changeSet string) ([]models.AuditEntry, error)
+
+	// 把个人或家庭恢复到某条变更之后的状态
+	RevertRecord(ctx context.Context, userID int, entityType models.EntityType, entityID string, req *models.RevertRequest) (*models.RevertResult, error)
+
+	// 撤销一个变更集中的全部修改
+	UndoChangeSet(ctx context.Context, userID int, changeSet string, req *models.RevertRequest) (*models.RevertResult, error)
+}
+
+// TrashService 回收站服务接口
+type TrashService interface {
+	// 家族树回收站中的记录
+	GetTrash(ctx context.Context, userID, familyTreeID, limit, offset int) ([]models.TrashItem, int, error)
+
+	// 从回收站恢复
+	Restore(ctx context.Context, userID, trashID int) (*models.RevertResult, error)
+
+	// 从回收站永久删除
+	Purge(ctx context.Context, userID, trashID int) error
+
+	// 清除超过保留期限的记录
+	PurgeExpired(ctx context.Context) (int, error)
+}
+
+// SnapshotService 家族树快照服务接口
+type SnapshotService interface {
+	// 保存家族树当前状态的命名快照
+	CreateSnapshot(ctx context.Context, userID, familyTreeID int, req *models.CreateSnapshotRequest) (*models.TreeSnapshot, error)
+
+	// 家族树的全部快照
+	GetSnapshots(ctx context.Context, userID, familyTreeID int) ([]models.TreeSnapshot, error)
+
+	// 删除快照
+	DeleteSnapshot(ctx context.Context, userID, snapshotID int) error
+
+	// 比较快照与另一个快照，toSnapshotID 为 0 时与当前状态比较
+	DiffSnapshot(ctx context.Context, userID, snapshotID, toSnapshotID int) (*models.TreeDiff, error)
+
+	// 把家族树回滚到快照时的状态
+	RollbackToSnapshot(ctx context.Context, userID, snapshotID int) (*models.SnapshotRollbackResult, error)
+}
+
+// BatchService 批量操作服务接口
+type BatchService interface {
+	// 按顺序在同一事务中执行批量操作，任一步失败时全部回滚
+	Execute(ctx context.Context, userID int, req *models.BatchRequest) (*models.BatchResult, error)
+}
+
+// ImportService 表格导入服务接口
+type ImportService interface {
+	// 读取上传的表格，返回表头、示例行和推测的列映射
+	Columns(ctx context.Context, userID, familyTreeID int, file io.Reader, filename, sheet string) (*models.ImportColumns, error)
+
+	// 按列映射校验表格并导入家族树；预览或有行出错时不做任何修改
+	Import(ctx context.Context, userID, familyTreeID int, file io.Reader, filename string, req *models.ImportRequest) (*models.ImportResult, error)
+}
+
+// ExportService 表格导出服务接口
+type ExportService interface {
+	// 数据集可以选择的列
+	Columns(dataset string) ([]models.ExportColumn, error)
+
+	// 校验后把数据集逐行写出为 CSV 或 XLSX；校验失败时不写出任何内容
+	Export(ctx context.Context, userID, familyTreeID int, req *models.ExportRequest, w io.Writer) error
+}
+
 // EventService 事件服务接口
 type EventService interface {
 	// 创建事件
@@ -92,7 +261,7 @@ type EventService interface {
 	// 根据ID获取事件
 	GetByID(ctx context.Context, id int) (*models.Event, error)
 
-	// 更新事件
+	// 更新事件，event.Version 非零且与当前版本不一致时返回 412（VERSION_MISMATCH）
 	Update(ctx context.Context, id int, event *models.Event) (*models.Event, error)
 
 	// 删除事件
@@ -119,7 +288,7 @@ type PlaceService interface {
 	// 根据ID获取地点
 	GetByID(ctx context.Context, id int) (*models.Place, error)
 
-	// 更新地点
+	// 更新地点，place.Version 非零且与当前版本不一致时返回 412（VERSION_MISMATCH）
 	Update(ctx context.Context, id int, place *models.Place) (*models.Place, error)
 
 	// 删除地点
@@ -140,7 +309,7 @@ type SourceService interface {
 	// 根据ID获取信息来源
 	GetByID(ctx context.Context, id int) (*models.Source, error)
 
-	// 更新信息来源
+	// 更新信息来源，source.Version 非零且与当前版本不一致时返回 412（VERSION_MISMATCH）
 	Update(ctx context.Context, id int, source *models.Source) (*models.Source, error)
 
 	// 删除信息来源
@@ -164,7 +333,7 @@ type CitationService interface {
 	// 根据ID获取引用
 	GetByID(ctx context.Context, id int) (*models.Citation, error)
 
-	// 更新引用
+	// 更新引用，citation.Version 非零且与当前版本不一致时返回 412（VERSION_MISMATCH）
 	Update(ctx context.Context, id int, citation *models.Citation) (*models.Citation, error)
 
 	// 删除引用
@@ -185,7 +354,7 @@ type NoteService interface {
 	// 根据ID获取备注
 	GetByID(ctx context.Context, id int) (*models.Note, error)
 
-	// 更新备注
+	// 更新备注，note.Version 非零且与当前版本不一致时返回 412（VERSION_MISMATCH）
 	Update(ctx context.Context, id int, note *models.Note) (*models.Note, error)
 
 	// 删除备注
@@ -213,7 +382,9 @@ type Repository interface {
 type IndividualRepository interface {
 	CreateIndividual(ctx context.Context, individual *models.Individual) (*models.Individual, error)
 	CreateIndividualForUser(ctx context.Context, userID int, individual *models.Individual) (*models.Individual, error)
+	CreateIndividualInTree(ctx context.Context, userID, familyTreeID int, individual *models.Individual) (*models.Individual, error)
 	GetIndividualByID(ctx context.Context, id int) (*models.Individual, error)
+	GetIndividualVersion(ctx context.Context, id int) (int, error)
 	UpdateIndividual(ctx context.Context, id int, individual *models.Individual) (*models.Individual, error)
 	DeleteIndividual(ctx context.Context, id int) error
 	SearchIndividuals(ctx context.Context, query string, limit, offset int) ([]models.Individual, int, error)
@@ -221,18 +392,36 @@ type IndividualRepository interface {
 	GetIndividualsByParentID(ctx context.Context, parentID int) ([]models.Individual, error)
 	GetIndividualsByIDs(ctx context.Context, ids []int) ([]models.Individual, error)
 	GetSpouses(ctx context.Context, individualID int) ([]models.Individual, error)
+	GetIndividualsByFamilyTreeID(ctx context.Context, familyTreeID int) ([]models.Individual, error)
+	GetAncestorLineage(ctx context.Context, individualID int, generations int) ([]models.LineageEntry, error)
+	GetDescendantLineage(ctx context.Context, individualID int, generations int) ([]models.LineageEntry, error)
+	IsAncestor(ctx context.Context, ancestorID, descendantID int) (bool, error)
+	GetCommonAncestors(ctx context.Context, individualID1, individualID2 int, generations int) ([]models.CommonAncestor, error)
+	GetAlternateNames(ctx context.Context, ids []int) (map[int]models.AlternateNames, error)
+	SetAlternateNames(ctx context.Context, individualID int, names models.AlternateNames) error
+	GetParentIDs(ctx context.Context, ids []int) (map[int][]int, error)
+}
+
+// LineageClosureRepository 世系闭包表维护接口
+type LineageClosureRepository interface {
+	EnableLineageClosure(ctx context.Context) error
+	DisableLineageClosure(ctx context.Context) error
+	RebuildLineageClosure(ctx context.Context) (*models.LineageClosureRebuildResult, error)
 }
 
 // FamilyRepository 家庭关系数据访问接口
 type FamilyRepository interface {
 	CreateFamily(ctx context.Context, family *models.Family) (*models.Family, error)
+	// GetFamilyByID 获取家庭关系，同时填充夫妻、结婚地点和子女关系
 	GetFamilyByID(ctx context.Context, id int) (*models.Family, error)
 	UpdateFamily(ctx context.Context, id int, family *models.Family) (*models.Family, error)
 	DeleteFamily(ctx context.Context, id int) error
 	GetFamiliesByIndividualID(ctx context.Context, individualID int) ([]models.Family, error)
+	GetFamiliesByIndividualIDs(ctx context.Context, individualIDs []int) ([]models.Family, error)
 	CreateChild(ctx context.Context, child *models.Child) (*models.Child, error)
 	DeleteChild(ctx context.Context, familyID, individualID int) error
 	GetChildrenByFamilyID(ctx context.Context, familyID int) ([]models.Child, error)
+	GetChildrenByFamilyIDs(ctx context.Context, familyIDs []int) ([]models.Child, error)
 }
 
 // EventRepository 事件数据访问接口
@@ -278,6 +467,22 @@ type CitationRepository interface {
 	GetCitationsBySourceID(ctx context.Context, sourceID int, limit, offset int) ([]models.Citation, int, error)
 }
 
+// RecordRepository 事件、地点、引用的批量只读查询，供报告、书籍生成和表格导入使用
+type RecordRepository interface {
+	GetEventsByIndividualIDs(ctx context.Context, ids []int) ([]models.Event, error)
+	GetPlacesByIDs(ctx context.Context, ids []int) ([]models.Place, error)
+	GetPlacesByNames(ctx context.Context, familyTreeID int, names []string) ([]models.Place, error)
+	GetCitationsByEntities(ctx context.Context, entityType models.EntityType, ids []int) ([]models.Citation, error)
+}
+
+// ExportRepository 表格导出数据访问接口，逐行回调 fn，fn 返回错误时停止
+type ExportRepository interface {
+	ExportPeople(ctx context.Context, familyTreeID int, filter models.ExportFilter, fn func(*models.ExportPerson) error) error
+	ExportFamilies(ctx context.Context, familyTreeID int, filter models.ExportFilter, fn func(*models.ExportFamily) error) error
+	ExportChildren(ctx context.Context, familyTreeID int, filter models.ExportFilter, fn func(*models.ExportChild) error) error
+	ExportEvents(ctx context.Context, familyTreeID int, filter models.ExportFilter, fn func(*models.ExportEvent) error) error
+}
+
 // NoteRepository 备注数据访问接口
 type NoteRepository interface {
 	CreateNote(ctx context.Context, note *models.Note) (*models.Note, error)
@@ -369,3 +574,54 @@ type FamilyTreeRepository interface {
 	SetDefaultFamilyTree(ctx context.Context, userID int, familyTreeID int) error
 	GetDefaultFamilyTree(ctx context.Context, userID int) (*models.UserFamilyTree, error)
 }
+
+// CalendarFeedRepository 日历订阅数据访问接口
+type CalendarFeedRepository interface {
+	SaveCalendarFeed(ctx context.Context, userID int, tokenHash string) (*models.CalendarFeed, error)
+	GetCalendarFeed(ctx context.Context, userID int) (*models.CalendarFeed, error)
+	GetCalendarFeedUserID(ctx context.Context, tokenHash string) (int, error)
+	DeleteCalendarFeed(ctx context.Context, userID int) error
+}
+
+// OwnershipRepository 记录所属家族树的数据访问接口，entity 为个人或家庭
+type OwnershipRepository interface {
+	GetOwningTreeIDs(ctx context.Context, entity models.EntityType, ids []int) (map[int]int, error)
+}
+
+// StatisticsRepository 家族树统计数据访问接口
+type StatisticsRepository interface {
+	GetTreeStatistics(ctx context.Context, familyTreeID int, top int) (*models.TreeStatistics, error)
+}
+
+// AuditRepository 变更记录数据访问接口
+type AuditRepository interface {
+	GetAuditEntries(ctx context.Context, query models.AuditQuery) ([]models.AuditEntry, int, error)
+	GetAuditEntry(ctx context.Context, auditID int) (*models.AuditEntry, error)
+	RestoreRecords(ctx context.Context, restores []models.RecordRestore, force bool) ([]models.RevertConflict, error)
+}
+
+// TrashRepository 回收站数据访问接口
+type TrashRepository interface {
+	GetTrashItems(ctx context.Context, familyTreeID, limit, offset int) ([]models.TrashItem, int, error)
+	GetTrashItem(ctx context.Context, trashID int) (*models.TrashItem, error)
+	RestoreTrashItem(ctx context.Context, trashID int) ([]models.RevertConflict, error)
+	PurgeTrashItem(ctx context.Context, trashID int) error
+	PurgeTrash(ctx context.Context, before time.Time) (int, error)
+}
+
+// SnapshotRepository 家族树快照数据访问接口
+type SnapshotRepository interface {
+	CreateSnapshot(ctx context.Context, snapshot *models.TreeSnapshot) (*models.TreeSnapshot, error)
+	GetSnapshots(ctx context.Context, familyTreeID int) ([]models.TreeSnapshot, error)
+	GetSnapshot(ctx context.Context, snapshotID int) (*models.TreeSnapshot, error)
+	GetSnapshotState(ctx context.Context, snapshotID int) (*models.TreeState, error)
+	GetTreeState(ctx context.Context, familyTreeID int) (*models.TreeState, error)
+	DeleteSnapshot(ctx context.Context, snapshotID int) error
+	RollbackToSnapshot(ctx context.Context, snapshotID int) error
+}
+
+// UnitOfWork 工作单元：fn 中用收到的 ctx 调用的个人、家庭等数据访问方法在同一事务中执行，
+// fn 返回错误时全部回滚；嵌套调用复用外层事务
+type UnitOfWork interface {
+	WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
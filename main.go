@@ -19,6 +19,7 @@ import (
 	"familytree/config"
 	"familytree/handlers"
 	"familytree/interfaces"
+	"familytree/models"
 	"familytree/pkg/di"
 	"familytree/pkg/middleware"
 	"familytree/pkg/workerpool"
@@ -148,6 +149,16 @@ func createSQLiteApp(cfg *config.Config, container *di.Container, workerPool *wo
 	// 注册存储库到容器
 	container.Register(repo)
 
+	// 配置世系闭包表
+	if cfg.Genealogy.LineageClosure {
+		if err := repo.EnableLineageClosure(context.Background()); err != nil {
+			return nil, fmt.Errorf("启用世系闭包表失败: %v", err)
+		}
+		log.Println("✅ 世系闭包表已启用")
+	} else if err := repo.DisableLineageClosure(context.Background()); err != nil {
+		return nil, fmt.Errorf("停用世系闭包表失败: %v", err)
+	}
+
 	// 初始化数据库连接池清理
 	if closer, ok := interface{}(repo).(interface{ Close() error }); ok {
 		cleanupFuncs = append(cleanupFuncs, func() {
@@ -177,42 +188,131 @@ func createSQLiteApp(cfg *config.Config, container *di.Container, workerPool *wo
 	}
 
 	// 创建服务层
-	baseIndividualService := services.NewIndividualService(repo, repo)
-	baseFamilyService := services.NewFamilyService(repo, repo)
+	baseIndividualService := services.NewIndividualServiceWithConfig(repo, repo, repo, services.IndividualServiceConfig{
+		MaxGenerations: cfg.Genealogy.MaxGenerations,
+	})
+	baseFamilyService := services.NewFamilyService(repo, repo, repo)
 	userService := services.NewUserService(repo)
 	familyTreeService := services.NewFamilyTreeService(repo, repo, baseIndividualService)
 	authService := services.NewAuthService(repo, repo)
+	pedigreeService := services.NewPedigreeService(repo, repo)
 
 	// 如果有缓存，使用缓存装饰器
 	var individualService interfaces.IndividualService
 	if cacheRepo != nil {
-		individualService = services.NewCachedIndividualService(baseIndividualService, cacheRepo)
+		individualService = services.NewCachedIndividualService(baseIndividualService, repo, cacheRepo)
 		log.Println("✅ 个人信息服务（带缓存）已创建")
 	} else {
 		individualService = baseIndividualService
 		log.Println("✅ 个人信息服务已创建")
 	}
 
+	// 书籍生成依赖个人信息服务的沙漏图查询，在工作池中后台执行
+	bookService := services.NewBookService(individualService, repo, workerPool, services.BookServiceConfig{
+		FontPath:       cfg.Book.FontPath,
+		OutputDir:      cfg.Book.OutputDir,
+		Retention:      time.Duration(cfg.Book.RetentionHours) * time.Hour,
+		MaxJobsPerUser: cfg.Book.MaxJobsPerUser,
+	})
+	reportService := services.NewReportService(individualService, repo, repo, repo)
+
+	// 时间线穿插的历史事件来自本地文件，读取失败时只显示家族事件
+	var history []models.HistoricalEvent
+	if cfg.Timeline.HistoryPath != "" {
+		if history, err = services.LoadHistoricalEvents(cfg.Timeline.HistoryPath); err != nil {
+			log.Printf("⚠️  加载历史事件失败: %v，时间线将不包含历史事件", err)
+		} else {
+			log.Printf("✅ 已加载 %d 条历史事件", len(history))
+		}
+	}
+	timelineService := services.NewTimelineService(individualService, repo, repo, repo, history)
+	calendarService := services.NewCalendarService(repo, repo, repo, repo)
+	statisticsService := services.NewStatisticsService(repo, repo)
+	researchService := services.NewResearchService(repo, repo, repo, repo)
+	historyService := services.NewHistoryService(repo, repo)
+	trashService := services.NewTrashService(repo, repo, repo, time.Duration(cfg.Trash.RetentionDays)*24*time.Hour)
+	cleanupFuncs = append(cleanupFuncs, services.StartTrashPurge(trashService, time.Hour))
+	snapshotService := services.NewSnapshotService(repo, repo)
+	batchService := services.NewBatchService(baseIndividualService, baseFamilyService, repo, repo, repo, repo, cacheRepo)
+	importService := services.NewImportService(repo, repo, repo, repo, repo)
+	exportService := services.NewExportService(repo, repo)
+
 	// 注册服务到容器
 	container.Register(individualService)
 	container.Register(baseFamilyService)
 	container.Register(userService)
 	container.Register(familyTreeService)
 	container.Register(authService)
+	container.Register(pedigreeService)
+	container.Register(bookService)
+	container.Register(reportService)
+	container.Register(timelineService)
+	container.Register(calendarService)
+	container.Register(statisticsService)
+	container.Register(researchService)
+	container.Register(historyService)
+	container.Register(trashService)
+	container.Register(snapshotService)
+	container.Register(batchService)
+	container.Register(importService)
+	container.Register(exportService)
 
 	// 创建处理器
 	individualHandler := handlers.NewIndividualHandler(individualService)
 	familyHandler := handlers.NewFamilyHandler(baseFamilyService)
 	authHandler := handlers.NewAuthHandler(authService, userService)
+	pedigreeHandler := handlers.NewPedigreeHandler(pedigreeService)
+	bookHandler := handlers.NewBookHandler(bookService)
+	reportHandler := handlers.NewReportHandler(reportService, cfg.Book.FontPath)
+	timelineHandler := handlers.NewTimelineHandler(timelineService)
+	calendarHandler := handlers.NewCalendarHandler(calendarService)
+	statisticsHandler := handlers.NewStatisticsHandler(statisticsService)
+	researchHandler := handlers.NewResearchHandler(researchService)
+	historyHandler := handlers.NewHistoryHandler(historyService)
+	trashHandler := handlers.NewTrashHandler(trashService)
+	snapshotHandler := handlers.NewSnapshotHandler(snapshotService)
+	batchHandler := handlers.NewBatchHandler(batchService)
+	importHandler := handlers.NewImportHandler(importService)
+	exportHandler := handlers.NewExportHandler(exportService)
 	log.Println("✅ HTTP处理器已创建")
 
 	// 注册处理器到容器
 	container.Register(individualHandler)
 	container.Register(familyHandler)
 	container.Register(authHandler)
+	container.Register(pedigreeHandler)
+	container.Register(bookHandler)
+	container.Register(reportHandler)
+	container.Register(timelineHandler)
+	container.Register(calendarHandler)
+	container.Register(statisticsHandler)
+	container.Register(researchHandler)
+	container.Register(historyHandler)
+	container.Register(trashHandler)
+	container.Register(snapshotHandler)
+	container.Register(batchHandler)
+	container.Register(importHandler)
+	container.Register(exportHandler)
 
 	// 设置路由（集成高级中间件）
-	router := setupAdvancedRouter(individualHandler, familyHandler, authHandler, cfg)
+	router := setupAdvancedRouter(&routeHandlers{
+		individual: individualHandler,
+		family:     familyHandler,
+		auth:       authHandler,
+		pedigree:   pedigreeHandler,
+		book:       bookHandler,
+		report:     reportHandler,
+		timeline:   timelineHandler,
+		calendar:   calendarHandler,
+		statistics: statisticsHandler,
+		research:   researchHandler,
+		history:    historyHandler,
+		trash:      trashHandler,
+		snapshot:   snapshotHandler,
+		batch:      batchHandler,
+		imports:    importHandler,
+		exports:    exportHandler,
+	}, cfg)
 	log.Println("✅ 高级路由和中间件已配置")
 
 	// 构建最终的清理函数
@@ -231,8 +331,29 @@ func createSQLiteApp(cfg *config.Config, container *di.Container, workerPool *wo
 	}, nil
 }
 
+// routeHandlers 路由所需的全部HTTP处理器
+type routeHandlers struct {
+	individual *handlers.IndividualHandler
+	family     *handlers.FamilyHandler
+	auth       *handlers.AuthHandler
+	pedigree   *handlers.PedigreeHandler
+	book       *handlers.BookHandler
+	report     *handlers.ReportHandler
+	timeline   *handlers.TimelineHandler
+	calendar   *handlers.CalendarHandler
+	statistics *handlers.StatisticsHandler
+	research   *handlers.ResearchHandler
+	history    *handlers.HistoryHandler
+	trash      *handlers.TrashHandler
+	snapshot   *handlers.SnapshotHandler
+	batch      *handlers.BatchHandler
+	imports    *handlers.ImportHandler
+	exports    *handlers.ExportHandler
+}
+
 // setupAdvancedRouter 设置带高级中间件的路由
-func setupAdvancedRouter(individualHandler *handlers.IndividualHandler, familyHandler *handlers.FamilyHandler, authHandler *handlers.AuthHandler, cfg *config.Config) *mux.Router {
+func setupAdvancedRouter(h *routeHandlers, cfg *config.Config) *mux.Router {
+	individualHandler, familyHandler, authHandler := h.individual, h.family, h.auth
 	router := mux.NewRouter()
 
 	// 添加中间件（使用Gorilla mux兼容的方式）
@@ -292,6 +413,11 @@ func setupAdvancedRouter(individualHandler *handlers.IndividualHandler, familyHa
 		return timeoutMiddleware(next)
 	})
 
+	// 变更集中间件：同一请求中的全部修改记在同一个变更集下
+	api.Use(func(next http.Handler) http.Handler {
+		return middleware.ChangeSet(next)
+	})
+
 	// 认证路由（不需要认证的路由）
 	auth := api.PathPrefix("/auth").Subrouter()
 	auth.HandleFunc("/register", authHandler.Register).Methods("POST")
@@ -299,6 +425,9 @@ func setupAdvancedRouter(individualHandler *handlers.IndividualHandler, familyHa
 	auth.HandleFunc("/refresh", authHandler.RefreshToken).Methods("POST")
 	auth.HandleFunc("/logout", authHandler.Logout).Methods("POST")
 
+	// 日历订阅以链接中的令牌认证，供日历应用直接访问
+	api.HandleFunc("/calendar/{token:[0-9a-f]{64}}.ics", h.calendar.GetFeed).Methods("GET")
+
 	// 需要认证的API路由
 	protectedAPI := api.PathPrefix("").Subrouter()
 	protectedAPI.Use(func(next http.Handler) http.Handler {
@@ -312,6 +441,10 @@ func setupAdvancedRouter(individualHandler *handlers.IndividualHandler, familyHa
 	user.HandleFunc("/profile", authHandler.UpdateProfile).Methods("PUT")
 	user.HandleFunc("/password", authHandler.ChangePassword).Methods("PUT")
 	user.HandleFunc("/validate", authHandler.ValidateToken).Methods("GET")
+	user.HandleFunc("/calendar-feed", h.calendar.GetFeedInfo).Methods("GET")
+	user.HandleFunc("/calendar-feed", h.calendar.CreateFeed).Methods("POST")
+	user.HandleFunc("/calendar-feed", h.calendar.RevokeFeed).Methods("DELETE")
+	user.HandleFunc("/history", h.history.GetUserHistory).Methods("GET")
 
 	// 个人信息路由（需要认证）
 	individuals := protectedAPI.PathPrefix("/individuals").Subrouter()
@@ -328,7 +461,20 @@ func setupAdvancedRouter(individualHandler *handlers.IndividualHandler, familyHa
 	individuals.HandleFunc("/{id:[0-9]+}/spouses", individualHandler.GetSpouses).Methods("GET")
 	individuals.HandleFunc("/{id:[0-9]+}/ancestors", individualHandler.GetAncestors).Methods("GET")
 	individuals.HandleFunc("/{id:[0-9]+}/descendants", individualHandler.GetDescendants).Methods("GET")
+	individuals.HandleFunc("/{id:[0-9]+}/lineage", individualHandler.GetLineage).Methods("GET")
 	individuals.HandleFunc("/{id:[0-9]+}/family-tree", individualHandler.GetFamilyTree).Methods("GET")
+	individuals.HandleFunc("/{id:[0-9]+}/hourglass", individualHandler.GetHourglass).Methods("GET")
+	individuals.HandleFunc("/{id:[0-9]+}/layout", individualHandler.GetLayout).Methods("GET")
+	individuals.HandleFunc("/{id:[0-9]+}/chart.svg", individualHandler.GetChart).Methods("GET")
+	individuals.HandleFunc("/{id:[0-9]+}/graph.dot", individualHandler.GetGraphDot).Methods("GET")
+	individuals.HandleFunc("/{id:[0-9]+}/lineage-chart", individualHandler.GetLineageChart).Methods("GET")
+	individuals.HandleFunc("/{id:[0-9]+}/alternate-names", individualHandler.GetAlternateNames).Methods("GET")
+	individuals.HandleFunc("/{id:[0-9]+}/alternate-names", individualHandler.UpdateAlternateNames).Methods("PUT")
+	individuals.HandleFunc("/{id:[0-9]+}/relationship/{otherId:[0-9]+}", individualHandler.GetRelationship).Methods("GET")
+	individuals.HandleFunc("/{id:[0-9]+}/book", h.book.StartBook).Methods("POST")
+	individuals.HandleFunc("/{id:[0-9]+}/report", h.report.GetReport).Methods("GET")
+	individuals.HandleFunc("/{id:[0-9]+}/timeline", h.timeline.GetTimeline).Methods("GET")
+	individuals.HandleFunc("/{id:[0-9]+}/completeness", h.research.GetCompleteness).Methods("GET")
 
 	// 添加父母路由（需要认证）
 	individuals.HandleFunc("/{id:[0-9]+}/parents", individualHandler.AddParent).Methods("POST")
@@ -345,6 +491,46 @@ func setupAdvancedRouter(individualHandler *handlers.IndividualHandler, familyHa
 	families.HandleFunc("/{id:[0-9]+}/children", familyHandler.AddChild).Methods("POST")
 	families.HandleFunc("/{id:[0-9]+}/children/{childId:[0-9]+}", familyHandler.RemoveChild).Methods("DELETE")
 	families.HandleFunc("/husband/{id:[0-9]+}", familyHandler.GetFamiliesByHusband).Methods("GET")
+	families.HandleFunc("/{id:[0-9]+}/group-sheet", h.report.GetFamilyGroupSheet).Methods("GET")
+
+	// 家族树路由
+	familyTrees := protectedAPI.PathPrefix("/family-trees").Subrouter()
+	familyTrees.HandleFunc("/{id:[0-9]+}/pedigree-analysis", h.pedigree.AnalyzeFamilyTree).Methods("GET")
+	familyTrees.HandleFunc("/{id:[0-9]+}/calendar", h.calendar.GetAnniversaries).Methods("GET")
+	familyTrees.HandleFunc("/{id:[0-9]+}/statistics", h.statistics.GetTreeStatistics).Methods("GET")
+	familyTrees.HandleFunc("/{id:[0-9]+}/completeness", h.research.GetTreeCompleteness).Methods("GET")
+	familyTrees.HandleFunc("/{id:[0-9]+}/gaps", h.research.GetResearchGaps).Methods("GET")
+	familyTrees.HandleFunc("/{id:[0-9]+}/history", h.history.GetTreeHistory).Methods("GET")
+	familyTrees.HandleFunc("/{id:[0-9]+}/trash", h.trash.GetTrash).Methods("GET")
+	familyTrees.HandleFunc("/{id:[0-9]+}/snapshots", h.snapshot.CreateSnapshot).Methods("POST")
+	familyTrees.HandleFunc("/{id:[0-9]+}/snapshots", h.snapshot.GetSnapshots).Methods("GET")
+	familyTrees.HandleFunc("/{id:[0-9]+}/import/columns", h.imports.GetImportColumns).Methods("POST")
+	familyTrees.HandleFunc("/{id:[0-9]+}/import", h.imports.ImportSpreadsheet).Methods("POST")
+	familyTrees.HandleFunc("/{id:[0-9]+}/export/{dataset:[a-z]+}/columns", h.exports.GetExportColumns).Methods("GET")
+	familyTrees.HandleFunc("/{id:[0-9]+}/export/{dataset:[a-z]+}", h.exports.ExportTable).Methods("GET")
+
+	// 变更历史路由
+	protectedAPI.HandleFunc("/history/{entityType:[a-z]+}/{entityId:[0-9]+(?:/[0-9]+)?}", h.history.GetEntityHistory).Methods("GET")
+	protectedAPI.HandleFunc("/history/{entityType:[a-z]+}/{entityId:[0-9]+}/revert", h.history.RevertRecord).Methods("POST")
+	protectedAPI.HandleFunc("/change-sets/{changeSet:[0-9a-f]{32}}", h.history.GetChangeSet).Methods("GET")
+	protectedAPI.HandleFunc("/change-sets/{changeSet:[0-9a-f]{32}}/undo", h.history.UndoChangeSet).Methods("POST")
+
+	// 回收站路由
+	protectedAPI.HandleFunc("/trash/{trashId:[0-9]+}/restore", h.trash.RestoreTrash).Methods("POST")
+	protectedAPI.HandleFunc("/trash/{trashId:[0-9]+}", h.trash.PurgeTrash).Methods("DELETE")
+
+	// 快照路由
+	protectedAPI.HandleFunc("/snapshots/{snapshotId:[0-9]+}", h.snapshot.DeleteSnapshot).Methods("DELETE")
+	protectedAPI.HandleFunc("/snapshots/{snapshotId:[0-9]+}/diff", h.snapshot.DiffSnapshot).Methods("GET")
+	protectedAPI.HandleFunc("/snapshots/{snapshotId:[0-9]+}/rollback", h.snapshot.RollbackToSnapshot).Methods("POST")
+
+	// 批量操作路由
+	protectedAPI.HandleFunc("/batch", h.batch.ExecuteBatch).Methods("POST")
+
+	// 家谱书籍路由
+	books := protectedAPI.PathPrefix("/books").Subrouter()
+	books.HandleFunc("/{jobId:[0-9a-f]+}", h.book.GetBookJob).Methods("GET")
+	books.HandleFunc("/{jobId:[0-9a-f]+}/download", h.book.DownloadBook).Methods("GET")
 
 	// 健康检查（带缓存检查）
 	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -2,6 +2,8 @@ package models
 
 import (
 	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -46,8 +48,14 @@ const (
 	EntityTypeEvent      EntityType = "Event"
 	EntityTypeSource     EntityType = "Source"
 	EntityTypePlace      EntityType = "Place"
+	EntityTypeChild      EntityType = "Child"
+	EntityTypeCitation   EntityType = "Citation"
+	EntityTypeNote       EntityType = "Note"
 )
 
+// ErrVersionConflict 按版本更新时记录已被他人修改，数据访问层返回此错误
+var ErrVersionConflict = errors.New("记录已被修改")
+
 // Individual 个人信息结构体
 type Individual struct {
 	IndividualID  int        `json:"individual_id" db:"individual_id"`
@@ -66,6 +74,7 @@ type Individual struct {
 	PhotoURL      *string    `json:"photo_url,omitempty" db:"photo_url"`
 	FatherID      *int       `json:"father_id,omitempty" db:"father_id"`
 	MotherID      *int       `json:"mother_id,omitempty" db:"mother_id"`
+	Version       int        `json:"version" db:"version"` // 行版本，每次修改加一，用作 ETag
 	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt     time.Time  `json:"updated_at" db:"updated_at"`
 
@@ -77,6 +86,8 @@ type Individual struct {
 	Mother         *Individual  `json:"mother,omitempty" db:"-"`
 	Children       []Individual `json:"children,omitempty" db:"-"`
 	MarriageOrder  int          `json:"marriage_order,omitempty" db:"-"`
+	CourtesyName   *string      `json:"courtesy_name,omitempty" db:"-"` // 字
+	ArtName        *string      `json:"art_name,omitempty" db:"-"`      // 号
 }
 
 // Family 家庭关系结构体
@@ -89,6 +100,7 @@ type Family struct {
 	MarriagePlaceID *int       `json:"marriage_place_id,omitempty" db:"marriage_place_id"`
 	DivorceDate     *time.Time `json:"divorce_date,omitempty" db:"divorce_date"`
 	Notes           string     `json:"notes,omitempty" db:"notes"`
+	Version         int        `json:"version" db:"version"`
 	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
 
@@ -215,6 +227,9 @@ type UpdateIndividualRequest struct {
 	PhotoURL      *string    `json:"photo_url,omitempty"`
 	FatherID      *int       `json:"father_id,omitempty"`
 	MotherID      *int       `json:"mother_id,omitempty"`
+
+	// 客户端读取时的版本（If-Match），非空且与当前版本不一致时拒绝更新
+	Version *int `json:"version,omitempty"`
 }
 
 // CreateFamilyRequest 创建家庭关系请求
@@ -225,6 +240,9 @@ type CreateFamilyRequest struct {
 	MarriagePlaceID *int       `json:"marriage_place_id,omitempty"`
 	DivorceDate     *time.Time `json:"divorce_date,omitempty"`
 	Notes           string     `json:"notes,omitempty"`
+
+	// 客户端读取时的版本（If-Match），仅更新时使用
+	Version *int `json:"version,omitempty"`
 }
 
 // AddParentRequest 添加父母请求
@@ -330,3 +348,913 @@ type AuthContext struct {
 	Username string
 	Email    string
 }
+
+// PedigreeCycle 家谱循环（某人直接或间接成为自己的祖先）
+type PedigreeCycle struct {
+	IndividualIDs []int        `json:"individual_ids"`
+	Members       []Individual `json:"members"`
+}
+
+// PedigreeCollapse 祖先重叠（同一祖先经由多条路径到达同一后代）
+type PedigreeCollapse struct {
+	Descendant  Individual `json:"descendant"`
+	Ancestor    Individual `json:"ancestor"`
+	PathCount   int        `json:"path_count"`
+	Generations []int      `json:"generations"`
+	// 是否为最近的汇合点：该祖先的子女中没有同样经由多条路径到达的
+	Nearest bool `json:"nearest"`
+}
+
+// PedigreeAnalysis 家谱结构分析结果
+type PedigreeAnalysis struct {
+	FamilyTreeID    int                `json:"family_tree_id"`
+	RootPersonID    *int               `json:"root_person_id,omitempty"`
+	IndividualCount int                `json:"individual_count"`
+	Cycles          []PedigreeCycle    `json:"cycles"`
+	Collapses       []PedigreeCollapse `json:"collapses"`
+}
+
+// LineageEntry 世系查询结果项：个人、与起点相隔的代数以及连接它的父母边
+type LineageEntry struct {
+	Individual Individual `json:"individual"`
+	Generation int        `json:"generation"`
+	// 祖先查询中为其子女ID，后代查询中为其父亲或母亲ID
+	LinkedID int `json:"linked_id"`
+	// 该边上父母一方的角色：father 或 mother
+	ParentRole string `json:"parent_role"`
+}
+
+// LineageEdge 世系父母-子女边
+type LineageEdge struct {
+	ParentID int `json:"parent_id"`
+	ChildID  int `json:"child_id"`
+}
+
+// LineageClosureRebuildResult 闭包表重建结果
+type LineageClosureRebuildResult struct {
+	IndividualCount int           `json:"individual_count"`
+	EdgeCount       int           `json:"edge_count"`
+	ClosureRows     int           `json:"closure_rows"`
+	SkippedEdges    []LineageEdge `json:"skipped_edges,omitempty"` // 因形成循环而被跳过的边
+	Duration        time.Duration `json:"duration"`
+}
+
+// CommonAncestor 共同祖先及两人各自与其相隔的代数
+type CommonAncestor struct {
+	AncestorID   int         `json:"ancestor_id"`
+	Ancestor     *Individual `json:"ancestor,omitempty"`
+	Generations1 int         `json:"generations1"`
+	Generations2 int         `json:"generations2"`
+}
+
+// Relationship 两人之间的血缘关系
+type Relationship struct {
+	Person1         *Individual      `json:"person1"`
+	Person2         *Individual      `json:"person2"`
+	Related         bool             `json:"related"`
+	Description     string           `json:"description"` // person2 是 person1 的…
+	CommonAncestors []CommonAncestor `json:"common_ancestors,omitempty"`
+}
+
+// HourglassNode 沙漏图中的个人节点，向上展开父母、向下展开家庭
+type HourglassNode struct {
+	Individual Individual        `json:"individual"`
+	Generation int               `json:"generation"` // 相对根节点的代数，祖先为负数
+	Father     *HourglassNode    `json:"father,omitempty"`
+	Mother     *HourglassNode    `json:"mother,omitempty"`
+	Families   []HourglassFamily `json:"families,omitempty"`
+}
+
+// HourglassFamily 某人的一段婚姻及其子女
+type HourglassFamily struct {
+	Family   *Family         `json:"family,omitempty"` // 没有家庭记录时为空
+	Spouse   *Individual     `json:"spouse,omitempty"`
+	Children []HourglassNode `json:"children,omitempty"`
+}
+
+// GraphNode 平铺图节点
+type GraphNode struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"` // individual 或 family
+	Generation int         `json:"generation"`
+	Individual *Individual `json:"individual,omitempty"`
+	Family     *Family     `json:"family,omitempty"`
+}
+
+// GraphEdge 平铺图的边：partner 由个人指向家庭，child 由家庭指向子女
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Type string `json:"type"`
+	Role string `json:"role,omitempty"` // husband/wife/partner 或子女关系类型
+}
+
+// FamilyGraph 平铺的个人-家庭图，便于前端自行布局
+type FamilyGraph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// Hourglass 沙漏图
+type Hourglass struct {
+	RootID                int            `json:"root_id"`
+	AncestorGenerations   int            `json:"ancestor_generations"`
+	DescendantGenerations int            `json:"descendant_generations"`
+	Tree                  *HourglassNode `json:"tree,omitempty"`
+	Graph                 *FamilyGraph   `json:"graph,omitempty"`
+}
+
+// 平铺图节点与边类型
+const (
+	GraphNodeIndividual = "individual"
+	GraphNodeFamily     = "family"
+	GraphEdgePartner    = "partner"
+	GraphEdgeChild      = "child"
+)
+
+// AlternateNames 个人的字、号，保存在 individual_names 表中
+type AlternateNames struct {
+	CourtesyName string `json:"courtesy_name"` // 字
+	ArtName      string `json:"art_name"`      // 号
+}
+
+// BookJobStatus 书籍生成任务状态
+type BookJobStatus string
+
+const (
+	BookJobPending   BookJobStatus = "pending"
+	BookJobRunning   BookJobStatus = "running"
+	BookJobCompleted BookJobStatus = "completed"
+	BookJobFailed    BookJobStatus = "failed"
+)
+
+// BookRequest 书籍生成请求
+type BookRequest struct {
+	Title         string `json:"title"`
+	Subtitle      string `json:"subtitle"`
+	Compiler      string `json:"compiler"`       // 编者
+	Generations   int    `json:"generations"`    // 收录的后代代数，0 使用默认值
+	IncludePhotos *bool  `json:"include_photos"` // 默认收录照片
+}
+
+// BookJob 书籍生成任务
+type BookJob struct {
+	JobID       string        `json:"job_id"`
+	RootID      int           `json:"root_id"`
+	Title       string        `json:"title"`
+	Status      BookJobStatus `json:"status"`
+	Error       string        `json:"error,omitempty"`
+	Pages       int           `json:"pages,omitempty"`
+	People      int           `json:"people,omitempty"`
+	Size        int64         `json:"size,omitempty"` // 字节
+	CreatedAt   time.Time     `json:"created_at"`
+	CompletedAt *time.Time    `json:"completed_at,omitempty"`
+}
+
+// 世系报告类型、体例和编号方式
+const (
+	ReportDescendant = "descendant"
+	ReportAncestor   = "ancestor"
+
+	ReportStyleRegister = "register" // 只有留下后代的人才编号
+	ReportStyleNGSQ     = "ngsq"     // 每位后代都编号
+
+	NumberingRegister   = "register"   // 按出现顺序连续编号
+	NumberingHenry      = "henry"      // 1、11、12、111……
+	NumberingDAboville  = "daboville"  // 1、1.1、1.2、1.1.1……
+	NumberingAhnentafel = "ahnentafel" // 祖先报告：父 2n，母 2n+1
+)
+
+// ReportOptions 世系报告选项
+type ReportOptions struct {
+	Type        string `json:"type"`
+	Style       string `json:"style"`
+	Numbering   string `json:"numbering"`
+	Generations int    `json:"generations"`
+}
+
+// Report 世系报告
+type Report struct {
+	Title       string             `json:"title"`
+	RootID      int                `json:"root_id"`
+	Type        string             `json:"type"`
+	Style       string             `json:"style,omitempty"`
+	Numbering   string             `json:"numbering"`
+	Generations []ReportGeneration `json:"generations"`
+	Footnotes   []ReportFootnote   `json:"footnotes"`
+}
+
+// ReportGeneration 报告中的一代
+type ReportGeneration struct {
+	Generation int           `json:"generation"` // 起点为 1
+	Title      string        `json:"title"`
+	Entries    []ReportEntry `json:"entries"`
+}
+
+// ReportEntry 报告中单列一段的人物
+type ReportEntry struct {
+	Number       string           `json:"number"`
+	IndividualID int              `json:"individual_id"`
+	Name         string           `json:"name"`
+	Sentences    []ReportSentence `json:"sentences"`
+	Families     []ReportFamily   `json:"families,omitempty"`
+}
+
+// ReportSentence 叙述中的一句话及其脚注编号
+type ReportSentence struct {
+	Text  string `json:"text"`
+	Notes []int  `json:"notes,omitempty"`
+}
+
+// ReportFamily 一段婚姻下的子女列表
+type ReportFamily struct {
+	Title    string        `json:"title"`
+	Children []ReportChild `json:"children"`
+}
+
+// ReportChild 子女列表中的一项
+type ReportChild struct {
+	Ordinal      string         `json:"ordinal"` // 罗马数字排行
+	Number       string         `json:"number,omitempty"`
+	Continued    bool           `json:"continued"` // 在下一代中另有专段
+	IndividualID int            `json:"individual_id"`
+	Name         string         `json:"name"`
+	Summary      ReportSentence `json:"summary"`
+}
+
+// ReportFootnote 脚注
+type ReportFootnote struct {
+	Number int    `json:"number"`
+	Text   string `json:"text"`
+}
+
+// FamilyGroupSheet 家庭表：夫妻、婚姻、全部子女及来源
+type FamilyGroupSheet struct {
+	Title   string            `json:"title"`
+	Family  *Family           `json:"family"` // 已填充 Husband、Wife、MarriagePlace、Children
+	Husband *GroupSheetPerson `json:"husband,omitempty"`
+	Wife    *GroupSheetPerson `json:"wife,omitempty"`
+	// MarriageSources 婚姻记录引用的来源编号
+	MarriageSources []int              `json:"marriage_sources,omitempty"`
+	Children        []GroupSheetPerson `json:"children"`
+	Sources         []ReportFootnote   `json:"sources"`
+}
+
+// GroupSheetPerson 家庭表中的一人
+type GroupSheetPerson struct {
+	Individual   *Individual  `json:"individual"`
+	BirthPlace   string       `json:"birth_place,omitempty"`
+	DeathPlace   string       `json:"death_place,omitempty"`
+	BurialPlace  string       `json:"burial_place,omitempty"`
+	Father       *Individual  `json:"father,omitempty"`
+	Mother       *Individual  `json:"mother,omitempty"`
+	Relationship string       `json:"relationship,omitempty"` // 子女与父母的关系
+	Spouses      []Individual `json:"spouses,omitempty"`      // 子女的配偶
+	Events       []Event      `json:"events,omitempty"`       // 已填充 EventPlace
+	Sources      []int        `json:"sources,omitempty"`      // 个人及其事件引用的来源编号
+}
+
+// SiteOptions 静态网站生成选项
+type SiteOptions struct {
+	// AsOf 判断是否在世的基准日期，为零时取当天；固定该值可使输出可重复
+	AsOf time.Time `json:"as_of"`
+	// LivingYears 无死亡记录且出生不足该年数的人视为在世，默认 100
+	LivingYears int  `json:"living_years"`
+	Photos      bool `json:"photos"` // 下载照片到 photos/ 目录，否则直接引用原地址
+}
+
+// SiteResult 静态网站生成结果
+type SiteResult struct {
+	FamilyTreeID int    `json:"family_tree_id"`
+	Dir          string `json:"dir"`
+	People       int    `json:"people"`
+	Redacted     int    `json:"redacted"` // 按在世处理、隐去信息的人数
+	Files        int    `json:"files"`
+	Photos       int    `json:"photos"`
+}
+
+// 时间线条目类别
+const (
+	TimelineOwn        = "own"        // 本人事件
+	TimelineFamily     = "family"     // 父母、兄弟姐妹、配偶、子女的出生、婚姻、去世
+	TimelineHistorical = "historical" // 历史事件
+)
+
+// Timeline 个人时间线
+type Timeline struct {
+	Individual *Individual     `json:"individual"`
+	Entries    []TimelineEntry `json:"entries"`
+}
+
+// TimelineEntry 时间线上的一条记录
+type TimelineEntry struct {
+	Date         *time.Time `json:"date,omitempty"`
+	EndDate      *time.Time `json:"end_date,omitempty"` // 持续一段时间的历史事件
+	Category     string     `json:"category"`
+	EventType    string     `json:"event_type,omitempty"` // birth、death、marriage 等
+	Title        string     `json:"title"`
+	Description  string     `json:"description,omitempty"`
+	Place        string     `json:"place,omitempty"`
+	Age          *int       `json:"age,omitempty"`           // 本人当时的周岁
+	IndividualID int        `json:"individual_id,omitempty"` // 事件当事人
+	Relation     string     `json:"relation,omitempty"`      // 当事人与本人的关系，如 父亲、妹妹
+	EventID      int        `json:"event_id,omitempty"`
+}
+
+// HistoricalEvent 本地配置的历史事件，日期为 YYYY、YYYY-MM 或 YYYY-MM-DD
+type HistoricalEvent struct {
+	Date        string `json:"date"`
+	EndDate     string `json:"end_date,omitempty"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Category    string `json:"category,omitempty"` // 如 war、famine、dynasty、migration
+	Region      string `json:"region,omitempty"`
+}
+
+// 纪念日类型
+const (
+	AnniversaryBirthday = "birthday" // 生日，已故者为诞辰
+	AnniversaryWedding  = "wedding"  // 结婚纪念日
+	AnniversaryDeath    = "death"    // 忌日
+)
+
+// 纪念日历法
+const (
+	CalendarGregorian = "gregorian"
+	CalendarLunar     = "lunar"
+)
+
+// CalendarOptions 纪念日查询选项
+type CalendarOptions struct {
+	From      time.Time // 起始日期，为零时取当天
+	Days      int       // 查询天数，含起始日
+	Calendars []string  // gregorian、lunar，为空时两种都计算
+	Types     []string  // birthday、wedding、death，为空时全部
+}
+
+// AnniversaryCalendar 一段时间内的生日与纪念日
+type AnniversaryCalendar struct {
+	FamilyTreeID int           `json:"family_tree_id,omitempty"` // 订阅日历包含用户的全部家族树，为 0
+	Name         string        `json:"name"`
+	From         time.Time     `json:"from"`
+	To           time.Time     `json:"to"`
+	Entries      []Anniversary `json:"entries"`
+}
+
+// Anniversary 一次生日或纪念日
+type Anniversary struct {
+	Date         time.Time `json:"date"` // 本次纪念日的公历日期
+	Type         string    `json:"type"`
+	Calendar     string    `json:"calendar"` // 按公历还是农历计算
+	Title        string    `json:"title"`
+	Years        int       `json:"years"`                // 周岁或周年
+	LunarDate    string    `json:"lunar_date,omitempty"` // 农历月日，如 八月十五
+	OriginalDate time.Time `json:"original_date"`        // 出生、结婚或去世的公历日期
+	Deceased     bool      `json:"deceased,omitempty"`   // 生日的主人已故
+	IndividualID int       `json:"individual_id,omitempty"`
+	FamilyID     int       `json:"family_id,omitempty"`
+	FamilyTreeID int       `json:"family_tree_id"`
+}
+
+// CalendarFeed 用户的 iCalendar 订阅
+type CalendarFeed struct {
+	Token      string     `json:"token,omitempty"` // 只在创建时返回，数据库只保存摘要
+	URL        string     `json:"url,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// TreeStatistics 家族树统计
+type TreeStatistics struct {
+	FamilyTreeID      int              `json:"family_tree_id"`
+	Individuals       int              `json:"individuals"`
+	Families          int              `json:"families"`
+	Living            int              `json:"living"` // 没有死亡记录的人
+	Deceased          int              `json:"deceased"`
+	Genders           []StatCount      `json:"genders"`
+	Generations       []GenerationStat `json:"generations"` // 第 1 世为没有已知父母的始祖，姻亲与配偶同世
+	LifespanByDecade  []LifespanStat   `json:"lifespan_by_decade"`
+	MarriageAge       []AgeStat        `json:"marriage_age"`    // 按性别统计初婚年龄
+	FirstChildAge     []AgeStat        `json:"first_child_age"` // 按性别统计生育第一个子女的年龄
+	ChildrenPerFamily ChildrenStat     `json:"children_per_family"`
+	Surnames          []StatCount      `json:"surnames"`
+	GivenNames        []StatCount      `json:"given_names"`
+	Occupations       []StatCount      `json:"occupations"`
+	BirthPlaces       []StatCount      `json:"birth_places"`
+	Centuries         []StatCount      `json:"centuries"` // 按出生世纪
+	Records           []StatRecord     `json:"records"`
+}
+
+// StatCount 分类计数
+type StatCount struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+// GenerationStat 一世的人数
+type GenerationStat struct {
+	Generation int `json:"generation"` // 0 表示无法确定
+	Total      int `json:"total"`
+	Male       int `json:"male"`
+	Female     int `json:"female"`
+	Unknown    int `json:"unknown"`
+}
+
+// LifespanStat 按出生年代统计的寿命
+type LifespanStat struct {
+	Decade  int     `json:"decade"` // 出生年代，如 1920
+	Count   int     `json:"count"`
+	Average float64 `json:"average"` // 平均寿命（岁）
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+}
+
+// AgeStat 年龄统计
+type AgeStat struct {
+	Gender  Gender  `json:"gender"`
+	Count   int     `json:"count"`
+	Average float64 `json:"average"`
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+}
+
+// ChildrenStat 每个家庭的子女数
+type ChildrenStat struct {
+	Families     int         `json:"families"`
+	Average      float64     `json:"average"`
+	Max          int         `json:"max"`
+	Distribution []StatCount `json:"distribution"` // 子女数 -> 家庭数
+}
+
+// 统计纪录类型
+const (
+	RecordLongestLived  = "longest_lived"  // 寿命最长的已故者
+	RecordShortestLived = "shortest_lived" // 寿命最短的已故者
+	RecordEarliestBirth = "earliest_birth"
+	RecordLatestBirth   = "latest_birth"
+	RecordOldestLiving  = "oldest_living" // 没有死亡记录的人中出生最早的
+)
+
+// StatRecord 最早、最晚、最长寿等纪录
+type StatRecord struct {
+	Type         string     `json:"type"`
+	IndividualID int        `json:"individual_id"`
+	FullName     string     `json:"full_name"`
+	BirthDate    *time.Time `json:"birth_date,omitempty"`
+	DeathDate    *time.Time `json:"death_date,omitempty"`
+	Age          *float64   `json:"age,omitempty"` // 去世时或当前的年龄
+}
+
+// 完整度评分项
+const (
+	CompletenessBirthDate  = "birth_date"
+	CompletenessDeathDate  = "death_date"
+	CompletenessBirthPlace = "birth_place"
+	CompletenessDeathPlace = "death_place"
+	CompletenessParents    = "parents"
+	CompletenessSpouse     = "spouse"
+	CompletenessSources    = "sources"
+	CompletenessPhoto      = "photo"
+)
+
+// Completeness 个人资料的完整度，满分 100
+type Completeness struct {
+	IndividualID int                `json:"individual_id"`
+	FullName     string             `json:"full_name"`
+	Score        int                `json:"score"`
+	Items        []CompletenessItem `json:"items"`
+	Missing      []string           `json:"missing,omitempty"` // 未得满分的项目名称
+}
+
+// CompletenessItem 一个评分项
+type CompletenessItem struct {
+	Key        string  `json:"key"`
+	Label      string  `json:"label"`
+	Weight     int     `json:"weight"`
+	Earned     float64 `json:"earned"`
+	Applicable bool    `json:"applicable"` // 在世的人不要求去世日期和地点，此时直接得分
+	Detail     string  `json:"detail,omitempty"`
+}
+
+// TreeCompleteness 家族树全体成员的完整度，按得分从低到高排列
+type TreeCompleteness struct {
+	FamilyTreeID int            `json:"family_tree_id"`
+	Average      float64        `json:"average"`
+	People       []Completeness `json:"people"`
+}
+
+// 研究缺口类型
+const (
+	GapEndOfLine        = "end_of_line"        // 没有已知父母的祖先
+	GapMissingBirthDate = "missing_birth_date" // 缺少出生日期
+	GapUnsourcedFact    = "unsourced_fact"     // 没有来源的事实
+)
+
+// GapOptions 研究缺口查询选项
+type GapOptions struct {
+	RootID *int     // 为空时使用家族树的 RootPersonID
+	Types  []string // 为空时全部
+	Limit  int
+}
+
+// ResearchGaps 研究缺口列表，按与起始人物相隔的代数排列
+type ResearchGaps struct {
+	FamilyTreeID int           `json:"family_tree_id"`
+	RootPersonID int           `json:"root_person_id"`
+	Total        int           `json:"total"`
+	Gaps         []ResearchGap `json:"gaps"`
+}
+
+// ResearchGap 一处研究缺口
+type ResearchGap struct {
+	Type         string `json:"type"`
+	IndividualID int    `json:"individual_id"`
+	FullName     string `json:"full_name"`
+	Distance     int    `json:"distance"`           // 与起始人物相隔的代数（配偶不计），-1 表示没有关联
+	Fact         string `json:"fact,omitempty"`     // 没有来源的事实：birth、death 或事件类型
+	EventID      int    `json:"event_id,omitempty"` // 事实来自事件时的事件ID
+	Description  string `json:"description"`
+}
+
+// 变更历史的操作类型
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+)
+
+// AuditEntry 一条变更记录：谁在何时对哪条记录做了什么修改
+type AuditEntry struct {
+	AuditID      int                    `json:"audit_id"`
+	ChangeSet    string                 `json:"change_set"`
+	FamilyTreeID *int                   `json:"family_tree_id,omitempty"`
+	EntityType   EntityType             `json:"entity_type"`
+	EntityID     string                 `json:"entity_id"` // 子女关系为 "家庭ID/个人ID"
+	Action       string                 `json:"action"`
+	UserID       *int                   `json:"user_id,omitempty"`
+	Username     string                 `json:"username,omitempty"`
+	Changes      []FieldChange          `json:"changes"`
+	Before       map[string]interface{} `json:"before,omitempty"`
+	After        map[string]interface{} `json:"after,omitempty"`
+	CreatedAt    time.Time              `json:"created_at"`
+}
+
+// FieldChange 单个字段修改前后的值
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// AuditQuery 变更历史查询条件，零值表示不限
+type AuditQuery struct {
+	FamilyTreeID int
+	UserID       int
+	EntityType   EntityType
+	EntityID     string
+	ChangeSet    string
+	Since        *time.Time
+	Until        *time.Time
+	Limit        int
+	Offset       int
+}
+
+// RevertRequest 恢复记录或撤销变更集的请求
+type RevertRequest struct {
+	AuditID int  `json:"audit_id"` // 恢复到这条变更之后的状态，撤销变更集时不需要
+	Force   bool `json:"force"`    // 与之后的修改冲突时仍然覆盖
+}
+
+// RecordRestore 一条记录的恢复操作
+type RecordRestore struct {
+	EntityType EntityType
+	EntityID   string
+	Expected   map[string]interface{} // 恢复前应有的字段值，nil 表示记录应当不存在
+	Target     map[string]interface{} // 恢复后的字段值，nil 表示删除记录
+}
+
+// RevertConflict 恢复时发现的冲突：记录在之后又被修改过
+type RevertConflict struct {
+	EntityType EntityType  `json:"entity_type"`
+	EntityID   string      `json:"entity_id"`
+	Field      string      `json:"field,omitempty"` // 为空表示记录本身已被删除或重新创建
+	Expected   interface{} `json:"expected,omitempty"`
+	Current    interface{} `json:"current,omitempty"`
+	Reason     string      `json:"reason"`
+}
+
+// RevertResult 恢复或撤销的结果。有冲突且未强制时不做任何修改
+type RevertResult struct {
+	Applied   bool             `json:"applied"`
+	ChangeSet string           `json:"change_set,omitempty"` // 本次恢复自身的变更集，可以再次撤销
+	Changes   []AuditEntry     `json:"changes"`
+	Conflicts []RevertConflict `json:"conflicts,omitempty"`
+}
+
+// TrashItem 回收站中的一次删除：被删除的个人或家庭，以及随之删除的子女关系和事件
+type TrashItem struct {
+	TrashID       int           `json:"trash_id"`
+	FamilyTreeID  *int          `json:"family_tree_id,omitempty"`
+	EntityType    EntityType    `json:"entity_type"`
+	EntityID      string        `json:"entity_id"`
+	Label         string        `json:"label"` // 个人姓名，或家庭的夫妻姓名
+	Records       []TrashRecord `json:"records"`
+	DeletedBy     *int          `json:"deleted_by,omitempty"`
+	DeletedByName string        `json:"deleted_by_name,omitempty"`
+	ChangeSet     string        `json:"change_set"`
+	DeletedAt     time.Time     `json:"deleted_at"`
+	PurgeAt       time.Time     `json:"purge_at"` // 超过保留期限后自动清除
+}
+
+// TrashRecord 回收站中的一条记录
+type TrashRecord struct {
+	EntityType EntityType `json:"entity_type"`
+	EntityID   string     `json:"entity_id"`
+}
+
+// TreeSnapshot 家族树的命名快照，保存个人（含字、号）、家庭和子女关系
+type TreeSnapshot struct {
+	SnapshotID      int       `json:"snapshot_id"`
+	FamilyTreeID    int       `json:"family_tree_id"`
+	Name            string    `json:"name"`
+	Description     string    `json:"description,omitempty"`
+	UserID          *int      `json:"user_id,omitempty"`
+	Username        string    `json:"username,omitempty"`
+	IndividualCount int       `json:"individual_count"`
+	FamilyCount     int       `json:"family_count"`
+	ChildCount      int       `json:"child_count"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// CreateSnapshotRequest 创建快照请求
+type CreateSnapshotRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// TreeState 家族树在某一时刻的全部记录，按记录ID索引，字段与变更记录中的快照一致
+type TreeState struct {
+	Individuals map[string]map[string]interface{} `json:"individuals"`
+	Families    map[string]map[string]interface{} `json:"families"`
+	Children    map[string]map[string]interface{} `json:"children"`
+	Events      map[string]map[string]interface{} `json:"events"` // 早期的快照不含事件，为 nil
+}
+
+// 快照差异中的变化类型
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// RecordDiff 一条记录在两个版本之间的变化
+type RecordDiff struct {
+	EntityType EntityType    `json:"entity_type"`
+	EntityID   string        `json:"entity_id"`
+	Label      string        `json:"label"`
+	Change     string        `json:"change"`
+	Changes    []FieldChange `json:"changes,omitempty"` // 仅 changed
+}
+
+// TreeDiffSummary 差异统计，关系包括家庭（婚姻）和子女关系
+type TreeDiffSummary struct {
+	PeopleAdded          int `json:"people_added"`
+	PeopleRemoved        int `json:"people_removed"`
+	PeopleChanged        int `json:"people_changed"`
+	RelationshipsAdded   int `json:"relationships_added"`
+	RelationshipsRemoved int `json:"relationships_removed"`
+	RelationshipsChanged int `json:"relationships_changed"`
+	EventsAdded          int `json:"events_added"`
+	EventsRemoved        int `json:"events_removed"`
+	EventsChanged        int `json:"events_changed"`
+}
+
+// TreeDiff 家族树两个版本之间的结构差异
+type TreeDiff struct {
+	From          string          `json:"from"` // 快照名称，或 "current" 表示当前状态
+	To            string          `json:"to"`
+	Summary       TreeDiffSummary `json:"summary"`
+	People        []RecordDiff    `json:"people"`
+	Relationships []RecordDiff    `json:"relationships"`
+	Events        []RecordDiff    `json:"events"`
+}
+
+// SnapshotRollbackResult 回滚到快照的结果，回滚本身是一个可以撤销的变更集
+type SnapshotRollbackResult struct {
+	ChangeSet string    `json:"change_set"`
+	Diff      *TreeDiff `json:"diff"`
+}
+
+// 批量操作的类型
+const (
+	BatchOpCreate = "create"
+	BatchOpUpdate = "update"
+	BatchOpDelete = "delete"
+	BatchOpLink   = "link"
+)
+
+// 批量操作的对象：create/update/delete 作用于个人或家庭，link 建立配偶或子女关系
+const (
+	BatchTypeIndividual = "individual"
+	BatchTypeFamily     = "family"
+	BatchTypeSpouse     = "spouse"
+	BatchTypeChild      = "child"
+)
+
+// BatchRequest 批量操作请求，按顺序在同一事务中执行
+type BatchRequest struct {
+	Operations []BatchOperation `json:"operations"`
+}
+
+// BatchOperation 批量操作中的一步。TempID 为本步创建的记录命名，之后的操作可以在 id 和
+// data 中以 *_id 结尾的字段里用 "$临时ID" 引用它。data 的格式与单独调用相应接口时的请求体相同，
+// link 时为 BatchLink
+type BatchOperation struct {
+	Op     string          `json:"op"`
+	Type   string          `json:"type"`
+	TempID string          `json:"temp_id,omitempty"`
+	ID     json.RawMessage `json:"id,omitempty"` // update、delete 的记录ID，数字或 "$临时ID"
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+// BatchLink 批量操作中建立的关系：spouse 为 individual_id 与 spouse_id 建立婚姻，
+// child 把 child_id 加入 family_id，并在其父母为空时设为该家庭的夫妻
+type BatchLink struct {
+	IndividualID int    `json:"individual_id,omitempty"`
+	SpouseID     int    `json:"spouse_id,omitempty"`
+	FamilyID     int    `json:"family_id,omitempty"`
+	ChildID      int    `json:"child_id,omitempty"`
+	Relationship string `json:"relationship,omitempty"`
+}
+
+// BatchOperationResult 一步操作的结果，ID 为创建、修改或删除的记录；link spouse 时为家庭，link child 时为子女
+type BatchOperationResult struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	Type   string `json:"type"`
+	TempID string `json:"temp_id,omitempty"`
+	ID     int    `json:"id"`
+}
+
+// BatchResult 批量操作的结果，IDs 为临时ID到实际ID的对应
+type BatchResult struct {
+	IDs     map[string]int         `json:"ids"`
+	Results []BatchOperationResult `json:"results"`
+}
+
+// ImportMapping 表格列到个人字段的对应，值为表头名称，为空表示不导入该字段。
+// 父亲、母亲、配偶列可以填姓名，或用 "#编号" 引用表格中的另一行：指定了 RowID 列时为该列的值，否则为行号
+type ImportMapping struct {
+	RowID      string `json:"row_id,omitempty"`
+	FullName   string `json:"full_name"`
+	Gender     string `json:"gender,omitempty"`
+	BirthDate  string `json:"birth_date,omitempty"`
+	BirthPlace string `json:"birth_place,omitempty"`
+	DeathDate  string `json:"death_date,omitempty"`
+	DeathPlace string `json:"death_place,omitempty"`
+	Occupation string `json:"occupation,omitempty"`
+	Notes      string `json:"notes,omitempty"`
+	Father     string `json:"father,omitempty"`
+	Mother     string `json:"mother,omitempty"`
+	Spouse     string `json:"spouse,omitempty"`
+}
+
+// ImportColumns 上传表格后的列映射步骤：表头、前几行示例和按表头推测的映射
+type ImportColumns struct {
+	Sheet   string        `json:"sheet,omitempty"`
+	Columns []string      `json:"columns"`
+	Sample  [][]string    `json:"sample"`
+	Rows    int           `json:"rows"`
+	Mapping ImportMapping `json:"mapping"`
+}
+
+// ImportRequest 导入选项
+type ImportRequest struct {
+	Mapping ImportMapping `json:"mapping"`
+	Sheet   string        `json:"sheet,omitempty"`
+	DryRun  bool          `json:"dry_run"`
+	NoMatch bool          `json:"no_match"` // 不与家族树中已有的人匹配，每行都新建
+}
+
+// 导入时每行的处理方式
+const (
+	ImportActionCreate = "create" // 新建个人
+	ImportActionMatch  = "match"  // 与家族树中已有的人是同一人，不新建，只补充其空缺的父母
+)
+
+// ImportRowResult 一行的校验和导入结果，有错误时 Action 为空
+type ImportRowResult struct {
+	Row          int      `json:"row"`
+	FullName     string   `json:"full_name"`
+	Action       string   `json:"action,omitempty"`
+	IndividualID *int     `json:"individual_id,omitempty"` // 匹配到的已有个人，或导入后新建的个人
+	Errors       []string `json:"errors,omitempty"`
+	Warnings     []string `json:"warnings,omitempty"`
+}
+
+// ImportSummary 导入统计，Families 为新建的家庭（婚姻）
+type ImportSummary struct {
+	Rows     int `json:"rows"`
+	Create   int `json:"create"`
+	Match    int `json:"match"`
+	Invalid  int `json:"invalid"`
+	Families int `json:"families"`
+}
+
+// ImportResult 导入或预览的结果。有任一行出错时不导入任何数据
+type ImportResult struct {
+	DryRun    bool              `json:"dry_run"`
+	Applied   bool              `json:"applied"`
+	ChangeSet string            `json:"change_set,omitempty"` // 导入的变更集，可以整体撤销
+	Summary   ImportSummary     `json:"summary"`
+	Rows      []ImportRowResult `json:"rows"`
+}
+
+// 表格导出的数据集
+const (
+	ExportDatasetPeople   = "people"   // 个人
+	ExportDatasetFamilies = "families" // 家庭（婚姻）
+	ExportDatasetChildren = "children" // 家庭与子女的关系
+	ExportDatasetEvents   = "events"   // 事件
+)
+
+// ExportColumn 导出表格中可以选择的列
+type ExportColumn struct {
+	Key    string `json:"key"`
+	Header string `json:"header"`
+}
+
+// ExportFilter 导出的筛选条件，与个人搜索相同：姓名或备注包含 Query。
+// 家庭按夫妻、子女关系按子女、事件按当事人筛选
+type ExportFilter struct {
+	Query string `json:"query,omitempty"`
+}
+
+// ExportRequest 表格导出请求，Columns 为空时导出全部列
+type ExportRequest struct {
+	Dataset string       `json:"dataset"`
+	Format  string       `json:"format"`
+	Columns []string     `json:"columns,omitempty"`
+	Filter  ExportFilter `json:"filter"`
+}
+
+// ExportPerson 导出的个人，地点与父母、配偶已解析为名称
+type ExportPerson struct {
+	IndividualID int
+	FullName     string
+	Gender       Gender
+	BirthDate    string
+	BirthPlace   string
+	DeathDate    string
+	DeathPlace   string
+	BurialPlace  string
+	Occupation   string
+	Notes        string
+	FatherID     *int
+	FatherName   string
+	MotherID     *int
+	MotherName   string
+	Spouses      string // 配偶姓名，按婚姻次序以“、”分隔
+}
+
+// ExportFamily 导出的家庭
+type ExportFamily struct {
+	FamilyID      int
+	HusbandID     *int
+	HusbandName   string
+	WifeID        *int
+	WifeName      string
+	MarriageOrder int
+	MarriageDate  string
+	MarriagePlace string
+	DivorceDate   string
+	DivorcePlace  string
+	Children      int
+	Notes         string
+}
+
+// ExportChild 导出的子女关系，父母为家庭的丈夫和妻子
+type ExportChild struct {
+	FamilyID     int
+	IndividualID int
+	FullName     string
+	Gender       Gender
+	BirthDate    string
+	Relationship string
+	FatherID     *int
+	FatherName   string
+	MotherID     *int
+	MotherName   string
+}
+
+// ExportEvent 导出的事件
+type ExportEvent struct {
+	EventID      int
+	IndividualID int
+	FullName     string
+	EventType    string
+	EventDate    string
+	Place        string
+	Description  string
+	Notes        string
+}
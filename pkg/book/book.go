@@ -0,0 +1,314 @@
+// Package book 生成可打印的家谱书籍（PDF）
+//
+// 全书依次为封面、目录、世系叙述、人物小传、家庭表、参考文献和人名索引。
+// 世系按代排列，每位后代按出现顺序编号（NGSQ 体例），有配偶或子女者单列一段，
+// 子女列表中以 + 标出另有专段的人。目录页码需要先排一遍才能确定，因此全书排版两遍。
+package book
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"familytree/models"
+)
+
+// Options 书籍选项
+type Options struct {
+	Title    string
+	Subtitle string
+	Compiler string    // 编者
+	Date     time.Time // 成书日期，为零时取当前时间
+	// FontPath TrueType 字体文件，必须覆盖书中用到的全部文字，含中文时需使用中文字体
+	FontPath    string
+	Photos      bool
+	PhotoLoader PhotoLoader
+}
+
+// PhotoLoader 按 photo_url 读取照片内容
+type PhotoLoader func(url string) ([]byte, error)
+
+// Data 书籍内容
+type Data struct {
+	Root      *models.HourglassNode // GetHourglass 返回的后代树
+	Events    []models.Event
+	Places    []models.Place
+	Citations []models.Citation // 个人、家庭、事件的引用，Source 必须已填充
+}
+
+// Result 生成结果
+type Result struct {
+	Pages  int
+	People int
+}
+
+// person 书中的一个人
+type person struct {
+	ind        *models.Individual
+	number     int // 世系编号，配偶为 0
+	generation int // 一世为 1，配偶与其配偶同世
+	parent     *person
+	queued     bool
+	families   []*family
+	events     []models.Event
+	sources    []citationRef
+}
+
+// family 一个家庭
+type family struct {
+	record        *models.Family // 没有家庭记录时为空
+	husband, wife *person
+	children      []*person
+	sources       []citationRef
+}
+
+// citationRef 对参考文献的一次引用
+type citationRef struct {
+	source *source
+	page   string
+}
+
+// source 参考文献
+type source struct {
+	number int
+	record *models.Source
+}
+
+// book 整理后的书籍内容
+type book struct {
+	opts        Options
+	root        *person
+	people      map[int]*person
+	descendants []*person   // 按世系编号排列
+	generations [][]*person // generations[i] 为第 i+1 世
+	spouses     []*person   // 非后代的配偶，按姓名排列
+	families    []*family
+	sources     []*source
+	places      map[int]models.Place
+}
+
+// collect 按世次广度优先遍历后代树，编号并整理家庭、事件和引用
+func collect(data *Data, opts Options) (*book, error) {
+	if data == nil || data.Root == nil {
+		return nil, fmt.Errorf("书籍内容为空")
+	}
+	b := &book{opts: opts, people: map[int]*person{}, places: map[int]models.Place{}}
+	for _, place := range data.Places {
+		b.places[place.PlaceID] = place
+	}
+
+	lookup := func(ind *models.Individual) *person {
+		p, ok := b.people[ind.IndividualID]
+		if !ok {
+			copied := *ind
+			p = &person{ind: &copied}
+			b.people[ind.IndividualID] = p
+		}
+		return p
+	}
+
+	type item struct {
+		node *models.HourglassNode
+		p    *person
+	}
+	b.root = lookup(&data.Root.Individual)
+	b.root.generation, b.root.queued = 1, true
+	queue := []item{{data.Root, b.root}}
+	familyIDs := map[int]bool{}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		p := current.p
+		p.number = len(b.descendants) + 1
+		b.descendants = append(b.descendants, p)
+		for len(b.generations) < p.generation {
+			b.generations = append(b.generations, nil)
+		}
+		b.generations[p.generation-1] = append(b.generations[p.generation-1], p)
+
+		for i := range current.node.Families {
+			hf := &current.node.Families[i]
+			// 夫妻都是后代时，同一家庭会从双方各出现一次
+			if hf.Family != nil && familyIDs[hf.Family.FamilyID] {
+				continue
+			}
+			f := &family{record: hf.Family}
+			if hf.Family != nil {
+				familyIDs[hf.Family.FamilyID] = true
+			}
+			var spouse *person
+			if hf.Spouse != nil {
+				spouse = lookup(hf.Spouse)
+				if spouse.generation == 0 {
+					spouse.generation = p.generation
+				}
+				spouse.families = append(spouse.families, f)
+			}
+			f.husband, f.wife = partners(hf.Family, p, spouse)
+			p.families = append(p.families, f)
+			b.families = append(b.families, f)
+
+			for j := range hf.Children {
+				childNode := &hf.Children[j]
+				child := lookup(&childNode.Individual)
+				f.children = append(f.children, child)
+				// 近亲婚姻时同一子女会出现在父母双方的树下，只展开一次
+				if child.queued {
+					continue
+				}
+				child.queued, child.parent, child.generation = true, p, p.generation+1
+				queue = append(queue, item{childNode, child})
+			}
+		}
+	}
+
+	for _, p := range b.people {
+		if p.number == 0 {
+			b.spouses = append(b.spouses, p)
+		}
+	}
+	sort.Slice(b.spouses, func(i, j int) bool {
+		if b.spouses[i].ind.FullName != b.spouses[j].ind.FullName {
+			return b.spouses[i].ind.FullName < b.spouses[j].ind.FullName
+		}
+		return b.spouses[i].ind.IndividualID < b.spouses[j].ind.IndividualID
+	})
+
+	eventOwner := map[int]*person{}
+	for _, event := range data.Events {
+		if p, ok := b.people[event.IndividualID]; ok {
+			p.events = append(p.events, event)
+			eventOwner[event.EventID] = p
+		}
+	}
+	b.collectSources(data.Citations, eventOwner)
+	return b, nil
+}
+
+// partners 按家庭记录确定夫妻，没有记录时按性别判断
+func partners(record *models.Family, p, spouse *person) (husband, wife *person) {
+	if record != nil {
+		if record.WifeID != nil && *record.WifeID == p.ind.IndividualID {
+			return spouse, p
+		}
+		if record.HusbandID != nil && *record.HusbandID == p.ind.IndividualID {
+			return p, spouse
+		}
+	}
+	if p.ind.Gender == models.GenderFemale {
+		return spouse, p
+	}
+	return p, spouse
+}
+
+// collectSources 整理参考文献：按作者、标题排序编号，并把引用挂到个人和家庭上
+func (b *book) collectSources(citations []models.Citation, eventOwner map[int]*person) {
+	byID := map[int]*source{}
+	for _, c := range citations {
+		if c.Source == nil {
+			continue
+		}
+		if _, ok := byID[c.SourceID]; !ok {
+			s := &source{record: c.Source}
+			byID[c.SourceID] = s
+			b.sources = append(b.sources, s)
+		}
+	}
+	sort.Slice(b.sources, func(i, j int) bool {
+		a, c := b.sources[i].record, b.sources[j].record
+		if a.Author != c.Author {
+			return a.Author < c.Author
+		}
+		if a.Title != c.Title {
+			return a.Title < c.Title
+		}
+		return a.SourceID < c.SourceID
+	})
+	for i, s := range b.sources {
+		s.number = i + 1
+	}
+
+	families := map[int]*family{}
+	for _, f := range b.families {
+		if f.record != nil {
+			families[f.record.FamilyID] = f
+		}
+	}
+	for _, c := range citations {
+		s, ok := byID[c.SourceID]
+		if !ok {
+			continue
+		}
+		ref := citationRef{source: s, page: strings.TrimSpace(c.PageNumber)}
+		switch c.EntityType {
+		case models.EntityTypeIndividual:
+			if p, ok := b.people[c.EntityID]; ok {
+				p.sources = append(p.sources, ref)
+			}
+		case models.EntityTypeEvent:
+			if p, ok := eventOwner[c.EntityID]; ok {
+				p.sources = append(p.sources, ref)
+			}
+		case models.EntityTypeFamily:
+			if f, ok := families[c.EntityID]; ok {
+				f.sources = append(f.sources, ref)
+			}
+		}
+	}
+}
+
+// place 地点名称，优先使用地点表
+func (b *book) place(id *int, text *string) string {
+	if id != nil {
+		if place, ok := b.places[*id]; ok && place.PlaceName != "" {
+			return place.PlaceName
+		}
+	}
+	if text != nil {
+		return strings.TrimSpace(*text)
+	}
+	return ""
+}
+
+// spouseOf 家庭中 p 的配偶
+func (f *family) spouseOf(p *person) *person {
+	if f.husband == p {
+		return f.wife
+	}
+	return f.husband
+}
+
+// title 家庭标题，如 张三 与 李四
+func (f *family) title() string {
+	var names []string
+	for _, p := range []*person{f.husband, f.wife} {
+		if p != nil {
+			names = append(names, p.ind.FullName)
+		}
+	}
+	return strings.Join(names, " 与 ")
+}
+
+// hasOwnParagraph 有配偶或子女的后代在世系中单列一段
+func (p *person) hasOwnParagraph() bool {
+	return p.number > 0 && len(p.families) > 0
+}
+
+// refs 引用标记，如 [1][3]
+func refs(list []citationRef) string {
+	seen := map[int]bool{}
+	var numbers []int
+	for _, ref := range list {
+		if !seen[ref.source.number] {
+			seen[ref.source.number] = true
+			numbers = append(numbers, ref.source.number)
+		}
+	}
+	sort.Ints(numbers)
+	var b strings.Builder
+	for _, n := range numbers {
+		fmt.Fprintf(&b, "[%d]", n)
+	}
+	return b.String()
+}
@@ -0,0 +1,199 @@
+package book
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"familytree/models"
+)
+
+// testFont 使用 gofpdf 自带的 DejaVu 字体，中文字形缺失不影响排版流程
+func testFont(t *testing.T) string {
+	t.Helper()
+	out, err := exec.Command("go", "list", "-m", "-f", "{{.Dir}}", "github.com/jung-kurt/gofpdf").Output()
+	if err != nil {
+		t.Skipf("找不到 gofpdf 模块目录: %v", err)
+	}
+	return filepath.Join(strings.TrimSpace(string(out)), "font", "DejaVuSansCondensed.ttf")
+}
+
+func sampleData() *Data {
+	person := func(id int, name string, gender models.Gender, year int) models.Individual {
+		born := time.Date(year, 5, 1, 0, 0, 0, 0, time.UTC)
+		return models.Individual{IndividualID: id, FullName: name, Gender: gender, BirthDate: &born}
+	}
+	photo := "https://example.com/1.png"
+	placeID := 7
+
+	root := person(1, "张大山", models.GenderMale, 1900)
+	root.PhotoURL = &photo
+	root.BirthPlaceID = &placeID
+	root.Notes = "创修族谱，迁居北京。"
+	wife := person(2, "李秀英", models.GenderFemale, 1902)
+	son := person(3, "张明", models.GenderMale, 1925)
+	daughter := person(4, "张丽", models.GenderFemale, 1928)
+	daughterInLaw := person(5, "王芳", models.GenderFemale, 1927)
+	grandson := person(6, "张小明", models.GenderMale, 1950)
+	husbandID, wifeID := 1, 2
+
+	return &Data{
+		Root: &models.HourglassNode{
+			Individual: root,
+			Families: []models.HourglassFamily{{
+				Family: &models.Family{FamilyID: 10, HusbandID: &husbandID, WifeID: &wifeID},
+				Spouse: &wife,
+				Children: []models.HourglassNode{
+					{Individual: son, Families: []models.HourglassFamily{{
+						Spouse:   &daughterInLaw,
+						Children: []models.HourglassNode{{Individual: grandson}},
+					}}},
+					{Individual: daughter},
+				},
+			}},
+		},
+		Places: []models.Place{{PlaceID: placeID, PlaceName: "北京"}},
+		Events: []models.Event{{EventID: 100, IndividualID: 3, EventType: "graduation", Description: "Peking University"}},
+		Citations: []models.Citation{
+			{SourceID: 1, EntityType: models.EntityTypeIndividual, EntityID: 1, PageNumber: "p. 12", Source: &models.Source{SourceID: 1, Title: "Zhang Family Register", Author: "Zhang"}},
+			{SourceID: 2, EntityType: models.EntityTypeEvent, EntityID: 100, Source: &models.Source{SourceID: 2, Title: "Alumni List", Author: "A"}},
+			{SourceID: 1, EntityType: models.EntityTypeFamily, EntityID: 10, Source: &models.Source{SourceID: 1, Title: "Zhang Family Register", Author: "Zhang"}},
+		},
+	}
+}
+
+func TestCollectNumbersByGeneration(t *testing.T) {
+	b, err := collect(sampleData(), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var numbers []string
+	for _, p := range b.descendants {
+		numbers = append(numbers, p.ind.FullName)
+	}
+	if got := strings.Join(numbers, ","); got != "张大山,张明,张丽,张小明" {
+		t.Errorf("世系编号顺序错误: %s", got)
+	}
+	if len(b.generations) != 3 || len(b.spouses) != 2 {
+		t.Errorf("世数或配偶数错误: %d %d", len(b.generations), len(b.spouses))
+	}
+	if !b.people[3].hasOwnParagraph() || b.people[4].hasOwnParagraph() {
+		t.Errorf("只有有家庭的后代单列一段")
+	}
+
+	// 参考文献按作者排序：A 在 Zhang 之前
+	if b.sources[0].record.Title != "Alumni List" || refs(b.people[3].sources) != "[1]" || refs(b.people[1].sources) != "[2]" {
+		t.Errorf("参考文献编号错误: %s %s", refs(b.people[3].sources), refs(b.people[1].sources))
+	}
+	if f := b.people[1].families[0]; f.husband != b.people[1] || f.wife != b.people[2] || refs(f.sources) != "[2]" {
+		t.Errorf("家庭整理错误")
+	}
+}
+
+func TestWriteBook(t *testing.T) {
+	var img bytes.Buffer
+	canvas := image.NewRGBA(image.Rect(0, 0, 30, 40))
+	canvas.Set(1, 1, color.Black)
+	if err := png.Encode(&img, canvas); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := Options{
+		Title:    "Zhang Family",
+		Compiler: "Zhang Ming",
+		Date:     time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		FontPath: testFont(t),
+		Photos:   true,
+		PhotoLoader: func(url string) ([]byte, error) {
+			return img.Bytes(), nil
+		},
+	}
+	var out bytes.Buffer
+	result, err := Write(&out, sampleData(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(out.Bytes(), []byte("%PDF-")) {
+		t.Fatal("输出不是 PDF")
+	}
+	// 封面、目录、世系、六人各一页小传、两个家庭表、参考文献、索引
+	if result.Pages != 13 || result.People != 6 {
+		t.Errorf("页数或人数错误: %d %d", result.Pages, result.People)
+	}
+
+	// 两遍排版的目录页码必须一致
+	b, _ := collect(sampleData(), opts)
+	b.opts.Title = opts.Title
+	font, err := os.ReadFile(opts.FontPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	photos := b.loadPhotos()
+	first := &renderer{book: b, font: font, photos: photos}
+	if err := first.render(); err != nil {
+		t.Fatal(err)
+	}
+	second := &renderer{book: b, font: font, photos: photos, pages: first.toc}
+	if err := second.render(); err != nil {
+		t.Fatal(err)
+	}
+	if len(first.toc) != len(first.plannedTOC()) {
+		t.Fatalf("目录项数与预排不一致: %d %d", len(first.toc), len(first.plannedTOC()))
+	}
+	for i := range first.toc {
+		if first.toc[i] != second.toc[i] {
+			t.Errorf("目录页码不一致: %v %v", first.toc[i], second.toc[i])
+		}
+	}
+	if len(photos) != 1 {
+		t.Errorf("照片应加载一张，实际 %d", len(photos))
+	}
+
+	// 根节点出现在世系、小传和家庭表中，索引页码递增
+	pages := second.mentions[1]
+	if len(pages) < 3 {
+		t.Fatalf("索引页码过少: %v", pages)
+	}
+	for i := 1; i < len(pages); i++ {
+		if pages[i] <= pages[i-1] {
+			t.Errorf("索引页码应递增: %v", pages)
+		}
+	}
+}
+
+func TestWriteRequiresFont(t *testing.T) {
+	if _, err := Write(&bytes.Buffer{}, sampleData(), Options{}); err == nil {
+		t.Fatal("未配置字体时应返回错误")
+	}
+}
+
+func TestWriteFamilyGroupSheet(t *testing.T) {
+	husbandID := 1
+	sheet := &models.FamilyGroupSheet{
+		Title:   "Zhang Family",
+		Family:  &models.Family{FamilyID: 10, HusbandID: &husbandID},
+		Husband: &models.GroupSheetPerson{Individual: &models.Individual{IndividualID: 1, FullName: "Zhang Dashan"}},
+		Children: []models.GroupSheetPerson{
+			{Individual: &models.Individual{IndividualID: 3, FullName: "Zhang Ming"}, Spouses: []models.Individual{{FullName: "Wang Fang"}}},
+		},
+		Sources: []models.ReportFootnote{{Number: 1, Text: "Zhang Family Register"}},
+	}
+	var out bytes.Buffer
+	if err := WriteFamilyGroupSheet(&out, sheet, testFont(t)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(out.Bytes(), []byte("%PDF-")) {
+		t.Fatal("输出不是 PDF")
+	}
+	if err := WriteFamilyGroupSheet(&bytes.Buffer{}, sheet, ""); err == nil {
+		t.Error("未配置字体时应返回错误")
+	}
+}
@@ -0,0 +1,893 @@
+package book
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif" // 注册照片解码器
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jung-kurt/gofpdf"
+
+	"familytree/models"
+	"familytree/pkg/narrative"
+)
+
+// 版面尺寸，单位毫米
+const (
+	pageWidth    = 210.0
+	pageHeight   = 297.0
+	marginX      = 20.0
+	marginTop    = 22.0
+	marginBottom = 22.0
+	contentWidth = pageWidth - 2*marginX
+	photoWidth   = 40.0
+	photoHeight  = 52.0
+	labelWidth   = 22.0
+	fontFamily   = "book"
+	bodySize     = 10.5
+	smallSize    = 8.5
+)
+
+// photo 已读取并校验过的照片
+type photo struct {
+	name          string
+	data          []byte
+	kind          string
+	width, height int
+}
+
+// tocEntry 目录项
+type tocEntry struct {
+	title string
+	level int
+	page  int
+}
+
+// renderer 一遍排版的状态
+type renderer struct {
+	*book
+	pdf      *gofpdf.Fpdf
+	font     []byte
+	photos   map[int]*photo
+	toc      []tocEntry
+	pages    []tocEntry // 上一遍得到的目录页码
+	mentions map[int][]int
+	section  string
+	y        float64
+}
+
+// Write 生成 PDF 书籍
+func Write(w io.Writer, data *Data, opts Options) (*Result, error) {
+	if opts.FontPath == "" {
+		return nil, fmt.Errorf("未配置书籍字体文件")
+	}
+	font, err := os.ReadFile(opts.FontPath)
+	if err != nil {
+		return nil, fmt.Errorf("读取字体文件失败: %v", err)
+	}
+	if opts.Date.IsZero() {
+		opts.Date = time.Now()
+	}
+
+	b, err := collect(data, opts)
+	if err != nil {
+		return nil, err
+	}
+	if b.opts.Title == "" {
+		b.opts.Title = narrative.Surname(b.root.ind.FullName) + "氏家谱"
+	}
+	photos := b.loadPhotos()
+
+	// 第一遍只为取得各节的起始页码
+	first := &renderer{book: b, font: font, photos: photos}
+	if err := first.render(); err != nil {
+		return nil, err
+	}
+	second := &renderer{book: b, font: font, photos: photos, pages: first.toc}
+	if err := second.render(); err != nil {
+		return nil, err
+	}
+	if err := second.pdf.Output(w); err != nil {
+		return nil, fmt.Errorf("输出PDF失败: %v", err)
+	}
+	return &Result{Pages: second.pdf.PageNo(), People: len(b.people)}, nil
+}
+
+// loadPhotos 读取照片，读取或解码失败的照片直接略过，不影响成书
+func (b *book) loadPhotos() map[int]*photo {
+	photos := map[int]*photo{}
+	if !b.opts.Photos || b.opts.PhotoLoader == nil {
+		return photos
+	}
+	for id, p := range b.people {
+		if p.ind.PhotoURL == nil || strings.TrimSpace(*p.ind.PhotoURL) == "" {
+			continue
+		}
+		data, err := b.opts.PhotoLoader(strings.TrimSpace(*p.ind.PhotoURL))
+		if err != nil {
+			continue
+		}
+		config, format, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil || config.Width == 0 || config.Height == 0 {
+			continue
+		}
+		kinds := map[string]string{"jpeg": "JPG", "png": "PNG", "gif": "GIF"}
+		if kind, ok := kinds[format]; ok {
+			photos[id] = &photo{name: fmt.Sprintf("photo-%d", id), data: data, kind: kind, width: config.Width, height: config.Height}
+		}
+	}
+	return photos
+}
+
+// render 排版全书
+func (r *renderer) render() error {
+	if err := r.start(); err != nil {
+		return err
+	}
+
+	r.titlePage()
+	r.contents()
+	r.register()
+	r.personPages()
+	r.familySheets()
+	r.bibliography()
+	r.index()
+
+	if err := r.pdf.Error(); err != nil {
+		return fmt.Errorf("排版PDF失败: %v", err)
+	}
+	return nil
+}
+
+// start 创建 PDF 文档并登记字体和照片
+func (r *renderer) start() error {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	r.pdf = pdf
+	r.mentions = map[int][]int{}
+	pdf.SetAutoPageBreak(false, marginBottom)
+	pdf.SetMargins(marginX, marginTop, marginX)
+	pdf.SetCompression(true)
+	pdf.SetCatalogSort(true)
+	pdf.SetCreationDate(r.opts.Date)
+	pdf.SetModificationDate(r.opts.Date)
+	pdf.SetTitle(r.opts.Title, true)
+	pdf.SetAuthor(r.opts.Compiler, true)
+	pdf.SetCreator("familytree", true)
+	pdf.AddUTF8FontFromBytes(fontFamily, "", r.font)
+	for _, ph := range r.photos {
+		pdf.RegisterImageOptionsReader(ph.name, gofpdf.ImageOptions{ImageType: ph.kind}, bytes.NewReader(ph.data))
+	}
+	if err := pdf.Error(); err != nil {
+		return fmt.Errorf("初始化PDF失败: %v", err)
+	}
+	return nil
+}
+
+// newPage 新起一页，标题页以外的页面带页眉和页码
+func (r *renderer) newPage() {
+	r.pdf.AddPage()
+	r.y = marginTop
+	page := r.pdf.PageNo()
+	if page == 1 {
+		return
+	}
+	r.setFont(smallSize, 120)
+	if r.section != "" {
+		r.pdf.Text(pageWidth-marginX-r.pdf.GetStringWidth(r.section), 14, r.section)
+	}
+	r.pdf.Text(marginX, 14, r.opts.Title)
+	r.pdf.SetDrawColor(180, 180, 180)
+	r.pdf.SetLineWidth(0.2)
+	r.pdf.Line(marginX, 16, pageWidth-marginX, 16)
+	number := fmt.Sprintf("%d", page)
+	r.pdf.Text((pageWidth-r.pdf.GetStringWidth(number))/2, pageHeight-10, number)
+}
+
+// startSection 开始新的一节：另起一页并登记目录
+func (r *renderer) startSection(title string) {
+	r.section = title
+	r.newPage()
+	r.addTOC(title, 0)
+	r.setFont(20, 0)
+	r.pdf.Text(marginX, r.y+8, title)
+	r.y += 16
+}
+
+// addTOC 登记目录和书签
+func (r *renderer) addTOC(title string, level int) {
+	r.toc = append(r.toc, tocEntry{title: title, level: level, page: r.pdf.PageNo()})
+	r.pdf.Bookmark(title, level, r.y)
+}
+
+// setFont 设置字号和灰度
+func (r *renderer) setFont(size float64, gray int) {
+	r.pdf.SetFont(fontFamily, "", size)
+	r.pdf.SetTextColor(gray, gray, gray)
+}
+
+// lineHeight 行高
+func lineHeight(size float64) float64 {
+	return size * 0.3528 * 1.6
+}
+
+// ensure 剩余空间不足时换页
+func (r *renderer) ensure(height float64) {
+	if r.y+height > pageHeight-marginBottom {
+		r.newPage()
+	}
+}
+
+// line 输出一行文字
+func (r *renderer) line(x float64, text string, size float64) {
+	h := lineHeight(size)
+	r.ensure(h)
+	r.pdf.Text(x, r.y+h*0.72, text)
+	r.y += h
+}
+
+// paragraph 输出自动换行的段落，hang 为第二行起的缩进
+func (r *renderer) paragraph(x, width float64, text string, size, hang float64) {
+	r.setFont(size, 0)
+	for i, line := range r.wrap(text, width, width-hang) {
+		if i == 0 {
+			r.line(x, line, size)
+		} else {
+			r.line(x+hang, line, size)
+		}
+	}
+}
+
+// wrap 按宽度断行：拉丁文在空格处断开，中文可在任意字间断开，行首标点挤回上一行
+func (r *renderer) wrap(text string, first, rest float64) []string {
+	var lines []string
+	width := first
+	for _, para := range strings.Split(text, "\n") {
+		runes := []rune(para)
+		if len(runes) == 0 {
+			lines = append(lines, "")
+			width = rest
+		}
+		for len(runes) > 0 {
+			n, breakAt, w := 0, 0, 0.0
+			for n < len(runes) {
+				cw := r.pdf.GetStringWidth(string(runes[n]))
+				if n > 0 && w+cw > width {
+					break
+				}
+				w += cw
+				n++
+				if n < len(runes) && canBreak(runes[n-1], runes[n]) {
+					breakAt = n
+				}
+			}
+			if n < len(runes) {
+				if breakAt > 0 && !canBreak(runes[n-1], runes[n]) {
+					n = breakAt
+				}
+				for n < len(runes) && strings.ContainsRune(closingPunctuation, runes[n]) {
+					n++
+				}
+			}
+			lines = append(lines, strings.TrimRightFunc(string(runes[:n]), unicode.IsSpace))
+			runes = []rune(strings.TrimLeftFunc(string(runes[n:]), unicode.IsSpace))
+			width = rest
+		}
+	}
+	return lines
+}
+
+// closingPunctuation 不能出现在行首的标点
+const closingPunctuation = "，。、；：？！）》」』”’,.;:!?)"
+
+// canBreak 两字之间能否断行
+func canBreak(before, after rune) bool {
+	return unicode.IsSpace(before) || unicode.IsSpace(after) || isCJK(before) || isCJK(after)
+}
+
+// isCJK 中日韩文字和全角标点
+func isCJK(c rune) bool {
+	return unicode.Is(unicode.Han, c) || (c >= 0x3000 && c <= 0x303f) || (c >= 0xff00 && c <= 0xffef)
+}
+
+// fit 超出宽度时截断并加省略号
+func (r *renderer) fit(text string, width float64) string {
+	if r.pdf.GetStringWidth(text) <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && r.pdf.GetStringWidth(string(runes)+"…") > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
+
+// mention 记录某人出现在当前页，供人名索引使用
+func (r *renderer) mention(p *person) {
+	if p == nil {
+		return
+	}
+	page := r.pdf.PageNo()
+	pages := r.mentions[p.ind.IndividualID]
+	if len(pages) == 0 || pages[len(pages)-1] != page {
+		r.mentions[p.ind.IndividualID] = append(pages, page)
+	}
+}
+
+// titlePage 封面
+func (r *renderer) titlePage() {
+	r.newPage()
+	center := func(text string, y, size float64, gray int) {
+		r.setFont(size, gray)
+		r.pdf.Text((pageWidth-r.pdf.GetStringWidth(text))/2, y, text)
+	}
+	center(r.opts.Title, 110, 32, 0)
+	if r.opts.Subtitle != "" {
+		center(r.opts.Subtitle, 126, 16, 60)
+	}
+	r.pdf.SetDrawColor(120, 120, 120)
+	r.pdf.SetLineWidth(0.4)
+	r.pdf.Line(pageWidth/2-40, 136, pageWidth/2+40, 136)
+	if r.opts.Compiler != "" {
+		center("编者："+r.opts.Compiler, 200, 13, 40)
+	}
+	center(fmt.Sprintf("%d年%d月", r.opts.Date.Year(), int(r.opts.Date.Month())), 212, 12, 80)
+	center(fmt.Sprintf("收录 %d 人 · %d 世", len(r.people), len(r.generations)), 224, 10, 120)
+}
+
+// contents 目录，页码取自上一遍排版；两遍的目录项数相同，篇幅不会变化
+func (r *renderer) contents() {
+	r.section = "目录"
+	r.newPage()
+	r.setFont(20, 0)
+	r.pdf.Text(marginX, r.y+8, "目录")
+	r.y += 18
+
+	entries := r.pages
+	if entries == nil {
+		entries = r.plannedTOC()
+	}
+	for _, entry := range entries {
+		size, indent := 12.0, 0.0
+		if entry.level > 0 {
+			size, indent = bodySize, 8
+		}
+		r.setFont(size, 0)
+		r.ensure(lineHeight(size))
+		number := fmt.Sprintf("%d", entry.page)
+		title := entry.title
+		left := marginX + indent + r.pdf.GetStringWidth(title) + 2
+		right := pageWidth - marginX - r.pdf.GetStringWidth(number) - 2
+		dots := ""
+		if dot := r.pdf.GetStringWidth("."); dot > 0 && right > left {
+			dots = strings.Repeat(".", int((right-left)/dot))
+		}
+		baseline := r.y + lineHeight(size)*0.72
+		r.pdf.Text(marginX+indent, baseline, title)
+		r.setFont(size, 150)
+		r.pdf.Text(right-r.pdf.GetStringWidth(dots), baseline, dots)
+		r.setFont(size, 0)
+		r.pdf.Text(pageWidth-marginX-r.pdf.GetStringWidth(number), baseline, number)
+		r.y += lineHeight(size) + 1
+	}
+}
+
+// plannedTOC 第一遍排版时的目录项，与实际登记的目录项一一对应
+func (r *renderer) plannedTOC() []tocEntry {
+	entries := []tocEntry{{title: "世系", level: 0}}
+	for i := range r.generations {
+		entries = append(entries, tocEntry{title: fmt.Sprintf("第%s世", narrative.ChineseNumber(i+1)), level: 1})
+	}
+	for _, title := range []string{"人物小传", "家庭表", "参考文献", "人名索引"} {
+		entries = append(entries, tocEntry{title: title})
+	}
+	return entries
+}
+
+// register 世系叙述：按世排列，每位有家庭的后代单列一段，后接子女列表
+func (r *renderer) register() {
+	r.startSection("世系")
+	for i, generation := range r.generations {
+		title := fmt.Sprintf("第%s世", narrative.ChineseNumber(i+1))
+		r.ensure(30)
+		r.y += 2
+		r.addTOC(title, 1)
+		r.setFont(14, 40)
+		r.line(marginX, title, 14)
+		r.y += 2
+
+		for _, p := range generation {
+			if !p.hasOwnParagraph() && p != r.root {
+				continue
+			}
+			r.ensure(20)
+			r.setFont(12, 0)
+			heading := fmt.Sprintf("%d. %s", p.number, p.ind.FullName)
+			if names := narrative.AlternateNames(p.ind); names != "" {
+				heading += "（" + names + "）"
+			}
+			r.line(marginX, heading, 12)
+			r.mention(p)
+			r.paragraph(marginX+6, contentWidth-6, r.narrative(p), bodySize, 0)
+			for _, f := range p.families {
+				r.childList(p, f)
+			}
+			r.y += 3
+		}
+	}
+}
+
+// narrative 一个人的叙述段落
+func (r *renderer) narrative(p *person) string {
+	ind := p.ind
+	var text strings.Builder
+	var origin string
+	if p.parent != nil {
+		origin = fmt.Sprintf("%s（%d）之%s", p.parent.ind.FullName, p.parent.number, narrative.ChildWord(ind.Gender))
+	}
+	text.WriteString(narrative.Sentence(ind.FullName, origin,
+		narrative.Dated(ind.BirthDate, r.place(ind.BirthPlaceID, ind.BirthPlace), "生"),
+		narrative.Dated(ind.DeathDate, r.place(ind.DeathPlaceID, ind.DeathPlace), "卒")))
+	if place := r.place(ind.BurialPlaceID, ind.BurialPlace); place != "" {
+		text.WriteString(narrative.Sentence("葬于" + place))
+	}
+	if occupation := strings.TrimSpace(ind.Occupation); occupation != "" {
+		text.WriteString(narrative.Sentence("业" + occupation))
+	}
+	for _, event := range p.events {
+		if s := r.eventText(event); s != "" {
+			text.WriteString(narrative.Sentence(s))
+		}
+	}
+	for _, f := range p.families {
+		spouse := f.spouseOf(p)
+		if spouse == nil {
+			continue
+		}
+		marriage := "配" + spouse.ind.FullName
+		if f.record != nil {
+			if m := narrative.Dated(f.record.MarriageDate, r.place(f.record.MarriagePlaceID, nil), "成婚"); m != "" {
+				marriage += "，" + m
+			}
+		}
+		var about []string
+		if spouse.number > 0 {
+			about = append(about, fmt.Sprintf("即第%d号", spouse.number))
+		} else {
+			about = append(about, r.spouseParents(spouse))
+			about = append(about,
+				narrative.Dated(spouse.ind.BirthDate, r.place(spouse.ind.BirthPlaceID, spouse.ind.BirthPlace), "生"),
+				narrative.Dated(spouse.ind.DeathDate, r.place(spouse.ind.DeathPlaceID, spouse.ind.DeathPlace), "卒"))
+		}
+		text.WriteString(narrative.Sentence(append([]string{marriage}, about...)...))
+		text.WriteString(refs(f.sources))
+		r.mention(spouse)
+	}
+	if notes := strings.TrimSpace(ind.Notes); notes != "" {
+		text.WriteString(notes)
+	}
+	text.WriteString(refs(p.sources))
+	return text.String()
+}
+
+// spouseParents 配偶的父母（仅限书中收录的人）
+func (r *renderer) spouseParents(spouse *person) string {
+	var parents []string
+	for _, id := range []*int{spouse.ind.FatherID, spouse.ind.MotherID} {
+		if id == nil {
+			continue
+		}
+		if parent, ok := r.people[*id]; ok {
+			parents = append(parents, parent.ind.FullName)
+		}
+	}
+	if len(parents) == 0 {
+		return ""
+	}
+	return strings.Join(parents, "、") + "之" + narrative.ChildWord(spouse.ind.Gender)
+}
+
+// eventText 事件叙述，出生、逝世等已在正文中的事件略过
+func (r *renderer) eventText(event models.Event) string {
+	switch strings.ToLower(event.EventType) {
+	case "birth", "death", "burial", "marriage":
+		return ""
+	}
+	s := narrative.Dated(event.EventDate, r.place(event.EventPlaceID, nil), narrative.EventName(event.EventType))
+	if s == "" {
+		s = narrative.EventName(event.EventType)
+	}
+	if description := strings.TrimSpace(event.Description); description != "" {
+		s += "：" + description
+	}
+	return s
+}
+
+// childList 家庭的子女列表，另有专段的子女前加 +
+func (r *renderer) childList(p *person, f *family) {
+	if len(f.children) == 0 {
+		return
+	}
+	intro := "子女："
+	if spouse := f.spouseOf(p); spouse != nil {
+		intro = fmt.Sprintf("%s与%s的子女：", p.ind.FullName, spouse.ind.FullName)
+	}
+	r.setFont(bodySize, 60)
+	r.line(marginX+6, intro, bodySize)
+	for _, child := range f.children {
+		marker := "  "
+		if child.hasOwnParagraph() {
+			marker = "+"
+		}
+		var text string
+		if child.parent != p && child.parent != f.spouseOf(p) {
+			text = fmt.Sprintf("%d. %s，见上", child.number, child.ind.FullName)
+		} else {
+			details := []string{fmt.Sprintf("%d. %s", child.number, child.ind.FullName)}
+			if !child.hasOwnParagraph() {
+				details = append(details,
+					narrative.Dated(child.ind.BirthDate, r.place(child.ind.BirthPlaceID, child.ind.BirthPlace), "生"),
+					narrative.Dated(child.ind.DeathDate, r.place(child.ind.DeathPlaceID, child.ind.DeathPlace), "卒"))
+			} else if span := narrative.Lifespan(child.ind); span != "" {
+				details[0] += "（" + span + "）"
+			}
+			text = strings.TrimSuffix(narrative.Sentence(details...), "。")
+		}
+		r.setFont(bodySize, 0)
+		r.pdf.Text(marginX+10, r.y+lineHeight(bodySize)*0.72, marker)
+		r.paragraph(marginX+14, contentWidth-14, text, bodySize, 4)
+		r.mention(child)
+	}
+}
+
+// personPages 人物小传：每人一页，后代按编号、配偶按姓名排列
+func (r *renderer) personPages() {
+	r.startSection("人物小传")
+	people := append(append([]*person{}, r.descendants...), r.spouses...)
+	for i, p := range people {
+		if i > 0 {
+			r.newPage()
+		}
+		r.personPage(p)
+	}
+}
+
+// personPage 一人的小传页
+func (r *renderer) personPage(p *person) {
+	ind := p.ind
+	r.mention(p)
+	r.setFont(18, 0)
+	r.line(marginX, ind.FullName, 18)
+	r.setFont(bodySize, 100)
+	if p.number > 0 {
+		r.line(marginX, fmt.Sprintf("世系编号 %d · 第%s世", p.number, narrative.ChineseNumber(p.generation)), bodySize)
+	} else {
+		r.line(marginX, "配偶", bodySize)
+	}
+	r.y += 3
+
+	// 照片放在右上角，事实列表在左侧让出照片的宽度
+	width, photoBottom := contentWidth, 0.0
+	if ph, ok := r.photos[ind.IndividualID]; ok {
+		w, h := photoWidth, photoWidth*float64(ph.height)/float64(ph.width)
+		if h > photoHeight {
+			w, h = photoHeight*float64(ph.width)/float64(ph.height), photoHeight
+		}
+		r.pdf.ImageOptions(ph.name, pageWidth-marginX-w, r.y, w, h, false, gofpdf.ImageOptions{ImageType: ph.kind}, 0, "")
+		width, photoBottom = contentWidth-photoWidth-6, r.y+h+4
+	}
+	photoPage := r.pdf.PageNo()
+
+	var fathers, mothers []string
+	if ind.FatherID != nil {
+		if father, ok := r.people[*ind.FatherID]; ok {
+			fathers = append(fathers, father.ind.FullName)
+			r.mention(father)
+		}
+	}
+	if ind.MotherID != nil {
+		if mother, ok := r.people[*ind.MotherID]; ok {
+			mothers = append(mothers, mother.ind.FullName)
+			r.mention(mother)
+		}
+	}
+	var spouses, children []string
+	for _, f := range p.families {
+		if spouse := f.spouseOf(p); spouse != nil {
+			spouses = append(spouses, spouse.ind.FullName)
+		}
+		for _, child := range f.children {
+			children = append(children, child.ind.FullName)
+		}
+	}
+
+	facts := [][2]string{
+		{"性别", narrative.GenderName(ind.Gender)},
+		{"字号", narrative.AlternateNames(ind)},
+		{"出生", strings.TrimSpace(narrative.FormatDate(ind.BirthDate) + " " + r.place(ind.BirthPlaceID, ind.BirthPlace))},
+		{"逝世", strings.TrimSpace(narrative.FormatDate(ind.DeathDate) + " " + r.place(ind.DeathPlaceID, ind.DeathPlace))},
+		{"安葬", r.place(ind.BurialPlaceID, ind.BurialPlace)},
+		{"职业", strings.TrimSpace(ind.Occupation)},
+		{"父亲", strings.Join(fathers, "、")},
+		{"母亲", strings.Join(mothers, "、")},
+		{"配偶", strings.Join(spouses, "、")},
+		{"子女", strings.Join(children, "、")},
+	}
+	for _, fact := range facts {
+		if fact[1] == "" {
+			continue
+		}
+		r.setFont(bodySize, 110)
+		r.ensure(lineHeight(bodySize))
+		r.pdf.Text(marginX, r.y+lineHeight(bodySize)*0.72, fact[0])
+		r.paragraph(marginX+labelWidth, width-labelWidth, fact[1], bodySize, 0)
+	}
+	if r.pdf.PageNo() == photoPage && r.y < photoBottom {
+		r.y = photoBottom
+	}
+
+	var events []string
+	for _, event := range p.events {
+		line := strings.TrimSpace(narrative.FormatDate(event.EventDate) + " " + narrative.EventName(event.EventType))
+		if place := r.place(event.EventPlaceID, nil); place != "" {
+			line += "，" + place
+		}
+		if description := strings.TrimSpace(event.Description); description != "" {
+			line += "：" + description
+		}
+		events = append(events, line)
+	}
+	r.block("生平", events)
+	if notes := strings.TrimSpace(ind.Notes); notes != "" {
+		r.block("传略", []string{notes})
+	}
+
+	var cited []string
+	seen := map[int]bool{}
+	for _, ref := range p.sources {
+		key := fmt.Sprintf("[%d] %s", ref.source.number, ref.source.record.Title)
+		if ref.page != "" {
+			key += "，" + ref.page
+		}
+		if !seen[ref.source.number] || ref.page != "" {
+			cited = append(cited, key)
+		}
+		seen[ref.source.number] = true
+	}
+	r.block("来源", cited)
+}
+
+// block 带小标题的列表
+func (r *renderer) block(title string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	r.y += 3
+	r.ensure(lineHeight(12) + lineHeight(bodySize))
+	r.setFont(12, 40)
+	r.line(marginX, title, 12)
+	for _, item := range items {
+		r.paragraph(marginX+4, contentWidth-4, item, bodySize, 4)
+	}
+}
+
+// familySheets 家庭表：每个家庭一页
+func (r *renderer) familySheets() {
+	r.startSection("家庭表")
+	for i, f := range r.families {
+		if i > 0 {
+			r.newPage()
+		}
+		r.familySheet(f)
+	}
+}
+
+// familySheet 一个家庭的家庭表
+func (r *renderer) familySheet(f *family) {
+	r.setFont(16, 0)
+	r.line(marginX, f.title(), 16)
+	r.y += 3
+
+	for _, partner := range []struct {
+		role string
+		p    *person
+	}{{"丈夫", f.husband}, {"妻子", f.wife}} {
+		rows := [][2]string{{"姓名", ""}}
+		if p := partner.p; p != nil {
+			r.mention(p)
+			rows = [][2]string{
+				{"姓名", p.ind.FullName},
+				{"出生", narrative.FormatDate(p.ind.BirthDate)},
+				{"出生地", r.place(p.ind.BirthPlaceID, p.ind.BirthPlace)},
+				{"逝世", narrative.FormatDate(p.ind.DeathDate)},
+				{"逝世地", r.place(p.ind.DeathPlaceID, p.ind.DeathPlace)},
+				{"父亲", r.nameOf(p.ind.FatherID)},
+				{"母亲", r.nameOf(p.ind.MotherID)},
+			}
+		}
+		r.table(partner.role, []float64{labelWidth, contentWidth - labelWidth}, rows)
+	}
+
+	var marriage [][2]string
+	if f.record != nil {
+		marriage = append(marriage,
+			[2]string{"结婚日期", narrative.FormatDate(f.record.MarriageDate)},
+			[2]string{"结婚地点", r.place(f.record.MarriagePlaceID, nil)})
+		if f.record.DivorceDate != nil {
+			marriage = append(marriage, [2]string{"离婚日期", narrative.FormatDate(f.record.DivorceDate)})
+		}
+	}
+	if len(marriage) > 0 {
+		r.table("婚姻", []float64{labelWidth, contentWidth - labelWidth}, marriage)
+	}
+
+	if len(f.children) > 0 {
+		r.y += 2
+		r.setFont(12, 40)
+		r.line(marginX, "子女", 12)
+		columns := []float64{12, 12, 40, 34, 34, contentWidth - 132}
+		r.row(columns, []string{"序", "性别", "姓名", "出生", "逝世", "配偶"}, true)
+		for i, child := range f.children {
+			var spouses []string
+			for _, cf := range child.families {
+				if spouse := cf.spouseOf(child); spouse != nil {
+					spouses = append(spouses, spouse.ind.FullName)
+				}
+			}
+			r.row(columns, []string{
+				fmt.Sprintf("%d", i+1), narrative.GenderName(child.ind.Gender), child.ind.FullName,
+				narrative.FormatDate(child.ind.BirthDate), narrative.FormatDate(child.ind.DeathDate), strings.Join(spouses, "、"),
+			}, false)
+			r.mention(child)
+		}
+	}
+	if cited := refs(f.sources); cited != "" {
+		r.y += 2
+		r.paragraph(marginX, contentWidth, "来源："+cited, smallSize, 0)
+	}
+}
+
+// nameOf 书中收录的人的姓名
+func (r *renderer) nameOf(id *int) string {
+	if id == nil {
+		return ""
+	}
+	if p, ok := r.people[*id]; ok {
+		return p.ind.FullName
+	}
+	return ""
+}
+
+// table 带标题的两列表格
+func (r *renderer) table(title string, columns []float64, rows [][2]string) {
+	r.y += 2
+	r.ensure(lineHeight(12) + 7)
+	r.setFont(12, 40)
+	r.line(marginX, title, 12)
+	for _, row := range rows {
+		r.row(columns, row[:], false)
+	}
+}
+
+// row 表格的一行，单元格内容过长时截断
+func (r *renderer) row(columns []float64, cells []string, header bool) {
+	const height = 7.0
+	r.ensure(height)
+	x := marginX
+	r.pdf.SetDrawColor(160, 160, 160)
+	r.pdf.SetFillColor(240, 240, 240)
+	r.pdf.SetLineWidth(0.2)
+	for i, width := range columns {
+		// 表头和两列表格的标签列加底色
+		style := "D"
+		if header || (len(columns) == 2 && i == 0) {
+			style = "FD"
+		}
+		r.pdf.Rect(x, r.y, width, height, style)
+		if i < len(cells) {
+			r.setFont(9.5, 0)
+			r.pdf.Text(x+1.5, r.y+height*0.68, r.fit(cells[i], width-3))
+		}
+		x += width
+	}
+	r.y += height
+}
+
+// bibliography 参考文献
+func (r *renderer) bibliography() {
+	r.startSection("参考文献")
+	if len(r.sources) == 0 {
+		r.paragraph(marginX, contentWidth, "本书未引用参考文献。", bodySize, 0)
+		return
+	}
+	for _, s := range r.sources {
+		src := s.record
+		parts := []string{}
+		if src.Author != "" {
+			parts = append(parts, src.Author)
+		}
+		parts = append(parts, "《"+src.Title+"》")
+		if src.Publisher != "" {
+			parts = append(parts, src.Publisher)
+		}
+		if src.PublicationYear != nil {
+			parts = append(parts, fmt.Sprintf("%d年", *src.PublicationYear))
+		}
+		text := fmt.Sprintf("[%d] %s", s.number, narrative.Sentence(parts...))
+		if src.Location != "" {
+			text += "藏于" + src.Location + "。"
+		}
+		r.paragraph(marginX, contentWidth, text, bodySize, 8)
+		r.y += 1.5
+	}
+}
+
+// index 人名索引：两栏，按姓名排列，同名者以生卒年区分
+func (r *renderer) index() {
+	r.startSection("人名索引")
+	var people []*person
+	for _, p := range r.people {
+		people = append(people, p)
+	}
+	sort.Slice(people, func(i, j int) bool {
+		if people[i].ind.FullName != people[j].ind.FullName {
+			return people[i].ind.FullName < people[j].ind.FullName
+		}
+		return people[i].ind.IndividualID < people[j].ind.IndividualID
+	})
+
+	const gap = 10.0
+	columnWidth := (contentWidth - gap) / 2
+	column, top := 0, r.y
+	h := lineHeight(bodySize)
+	next := func(height float64) {
+		if r.y+height <= pageHeight-marginBottom {
+			return
+		}
+		if column == 0 {
+			column, r.y = 1, top
+			return
+		}
+		r.newPage()
+		column, top = 0, r.y
+	}
+
+	var group rune
+	for _, p := range people {
+		first, _ := utf8.DecodeRuneInString(p.ind.FullName)
+		if first != group {
+			group = first
+			next(h * 2.5)
+			r.y += h * 0.4
+			r.setFont(12, 40)
+			r.pdf.Text(marginX+float64(column)*(columnWidth+gap), r.y+h*0.72, string(group))
+			r.y += h * 1.2
+		}
+
+		pages := r.mentions[p.ind.IndividualID]
+		numbers := make([]string, len(pages))
+		for i, page := range pages {
+			numbers[i] = fmt.Sprintf("%d", page)
+		}
+		name := p.ind.FullName
+		if span := narrative.Lifespan(p.ind); span != "" {
+			name += "（" + span + "）"
+		}
+		next(h)
+		x := marginX + float64(column)*(columnWidth+gap)
+		r.setFont(9.5, 0)
+		pageText := strings.Join(numbers, ", ")
+		textWidth := r.pdf.GetStringWidth(pageText)
+		r.pdf.Text(x, r.y+h*0.72, r.fit(name, columnWidth-textWidth-4))
+		r.pdf.Text(x+columnWidth-textWidth, r.y+h*0.72, pageText)
+		r.y += h
+	}
+}
@@ -0,0 +1,72 @@
+package book
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"familytree/models"
+	"familytree/pkg/report"
+)
+
+// WriteFamilyGroupSheet 输出单页（内容多时自动续页）的 PDF 家庭表，版式与书中的家庭表一致
+func WriteFamilyGroupSheet(w io.Writer, sheet *models.FamilyGroupSheet, fontPath string) error {
+	if fontPath == "" {
+		return fmt.Errorf("未配置书籍字体文件")
+	}
+	font, err := os.ReadFile(fontPath)
+	if err != nil {
+		return fmt.Errorf("读取字体文件失败: %v", err)
+	}
+
+	r := &renderer{book: &book{opts: Options{Title: sheet.Title, Date: time.Now()}}, font: font}
+	if err := r.start(); err != nil {
+		return err
+	}
+	r.newPage()
+	r.setFont(16, 0)
+	r.line(marginX, sheet.Title, 16)
+	r.y += 3
+
+	columns := []float64{labelWidth, contentWidth - labelWidth}
+	for _, part := range []struct {
+		title string
+		rows  []report.SheetRow
+	}{
+		{"丈夫", report.PersonRows(sheet.Husband)},
+		{"妻子", report.PersonRows(sheet.Wife)},
+		{"婚姻", report.MarriageRows(sheet)},
+	} {
+		rows := make([][2]string, 0, len(part.rows))
+		for _, row := range part.rows {
+			rows = append(rows, [2]string{row.Label, row.Value})
+		}
+		r.table(part.title, columns, rows)
+	}
+
+	if len(sheet.Children) > 0 {
+		r.y += 2
+		r.setFont(12, 40)
+		r.line(marginX, "子女", 12)
+		childColumns := []float64{9, 10, 34, 38, 38, 22, contentWidth - 151}
+		r.row(childColumns, report.ChildColumns, true)
+		for i := range sheet.Children {
+			r.row(childColumns, report.ChildCells(i, &sheet.Children[i]), false)
+		}
+	}
+
+	var sources []string
+	for _, source := range sheet.Sources {
+		sources = append(sources, fmt.Sprintf("[%d] %s", source.Number, source.Text))
+	}
+	r.block("来源", sources)
+
+	if err := r.pdf.Error(); err != nil {
+		return fmt.Errorf("排版PDF失败: %v", err)
+	}
+	if err := r.pdf.Output(w); err != nil {
+		return fmt.Errorf("输出PDF失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,379 @@
+// Package chart 将家族树渲染为独立的 SVG 图表
+//
+// 谱系图、后代图和沙漏图直接使用 pkg/layout 的布局结果，扇形图按阿嫩塔费尔编号排布祖先。
+// 输出的 SVG 不依赖外部样式表，可以直接打印或嵌入其他文档。
+package chart
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"familytree/models"
+	"familytree/pkg/errors"
+	"familytree/pkg/layout"
+)
+
+// Type 图表类型
+type Type string
+
+const (
+	TypePedigree   Type = "pedigree"   // 谱系图（祖先）
+	TypeDescendant Type = "descendant" // 后代图
+	TypeFan        Type = "fan"        // 半圆扇形祖先图
+	TypeHourglass  Type = "hourglass"  // 沙漏图
+)
+
+// ColorMode 节点着色方式
+type ColorMode string
+
+const (
+	ColorByGender  ColorMode = "gender"  // 按性别
+	ColorByLineage ColorMode = "lineage" // 按支系：祖先按四位祖父母区分，后代按根节点的子女区分
+	ColorNone      ColorMode = "none"
+)
+
+// DefaultFontFamily 默认字体，优先使用常见的中日韩字体
+const DefaultFontFamily = `"Noto Sans CJK SC", "Source Han Sans SC", "PingFang SC", "Microsoft YaHei", "SimSun", sans-serif`
+
+// fontFamilyPattern 用户指定的字体只能包含文字、数字、空格、逗号、单引号和连字符，
+// 不能带有可以结束 CSS 声明或规则的字符
+var fontFamilyPattern = regexp.MustCompile(`^[\p{L}\p{N} ,'-]+$`)
+
+// ValidFontFamily 字体是否可以写入样式：默认字体，或只含文字、数字、空格、逗号、单引号和连字符的字体列表
+func ValidFontFamily(s string) bool {
+	return s == DefaultFontFamily || fontFamilyPattern.MatchString(s)
+}
+
+// Options 图表选项
+type Options struct {
+	Type       Type
+	ShowPhotos bool
+	ShowDates  bool
+	ColorBy    ColorMode
+	FontFamily string
+	Layout     layout.Options // 谱系图、后代图和沙漏图的布局尺寸
+}
+
+// DefaultOptions 默认图表选项
+func DefaultOptions() Options {
+	return Options{
+		Type:       TypePedigree,
+		ShowDates:  true,
+		ColorBy:    ColorByGender,
+		FontFamily: DefaultFontFamily,
+		Layout:     layout.DefaultOptions(),
+	}
+}
+
+// ParseType 解析图表类型
+func ParseType(s string) (Type, bool) {
+	switch t := Type(s); t {
+	case TypePedigree, TypeDescendant, TypeFan, TypeHourglass:
+		return t, true
+	}
+	return "", false
+}
+
+// ParseColorMode 解析着色方式
+func ParseColorMode(s string) (ColorMode, bool) {
+	switch m := ColorMode(s); m {
+	case ColorByGender, ColorByLineage, ColorNone:
+		return m, true
+	}
+	return "", false
+}
+
+const (
+	margin      = 20.0
+	fontSize    = 14.0
+	smallSize   = 11.0
+	photoInset  = 6.0
+	lineColor   = "#6b7280"
+	borderColor = "#9ca3af"
+)
+
+// palette 支系配色：填充色和描边色
+var palette = [][2]string{
+	{"#dbeafe", "#2563eb"},
+	{"#dcfce7", "#16a34a"},
+	{"#fef3c7", "#d97706"},
+	{"#fce7f3", "#db2777"},
+	{"#ede9fe", "#7c3aed"},
+	{"#cffafe", "#0891b2"},
+	{"#fee2e2", "#dc2626"},
+	{"#e0e7ff", "#4f46e5"},
+}
+
+// Render 渲染图表，root 为 GetHourglass 返回的树，生成代数由调用方在查询时决定
+func Render(w io.Writer, root *models.HourglassNode, opts Options) error {
+	if root == nil {
+		return errors.New(errors.ErrCodeInvalidInput, "缺少图表根节点")
+	}
+	if opts.FontFamily == "" {
+		opts.FontFamily = DefaultFontFamily
+	}
+	if !ValidFontFamily(opts.FontFamily) {
+		return errors.New(errors.ErrCodeInvalidInput, "无效的字体", opts.FontFamily)
+	}
+
+	c := &canvas{opts: opts, branches: lineageBranches(root)}
+	switch opts.Type {
+	case TypePedigree:
+		c.tree(layout.Ancestors(root, opts.Layout))
+	case TypeDescendant:
+		c.tree(layout.Descendants(root, opts.Layout))
+	case TypeHourglass:
+		c.tree(layout.Hourglass(root, opts.Layout))
+	case TypeFan:
+		c.fan(root)
+	default:
+		return errors.New(errors.ErrCodeInvalidInput, "不支持的图表类型", string(opts.Type))
+	}
+
+	_, err := c.writeTo(w)
+	return err
+}
+
+// canvas 收集图形元素后统一输出
+type canvas struct {
+	opts          Options
+	branches      map[int]int
+	width, height float64
+	defs          bytes.Buffer
+	body          bytes.Buffer
+	clipCount     int
+}
+
+func (c *canvas) writeTo(w io.Writer) (int64, error) {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(&out, `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="%s" height="%s" viewBox="0 0 %s %s">`+"\n",
+		num(c.width), num(c.height), num(c.width), num(c.height))
+	fmt.Fprintf(&out, "<style>text{font-family:%s;fill:#111827}.dates{fill:#4b5563}.edge{fill:none;stroke:%s;stroke-width:1.5}.partner{stroke-width:2}</style>\n",
+		html.EscapeString(c.opts.FontFamily), lineColor)
+	if c.defs.Len() > 0 {
+		out.WriteString("<defs>\n")
+		out.Write(c.defs.Bytes())
+		out.WriteString("</defs>\n")
+	}
+	fmt.Fprintf(&out, `<rect width="100%%" height="100%%" fill="#ffffff"/>`+"\n")
+	out.Write(c.body.Bytes())
+	out.WriteString("</svg>\n")
+	return out.WriteTo(w)
+}
+
+// tree 渲染基于布局结果的图表
+func (c *canvas) tree(l *layout.Layout) {
+	c.width, c.height = l.Bounds.Width+2*margin, l.Bounds.Height+2*margin
+	fmt.Fprintf(&c.body, `<g transform="translate(%s,%s)">`+"\n", num(margin), num(margin))
+
+	for _, edge := range l.Edges {
+		points := make([]string, len(edge.Points))
+		for i, p := range edge.Points {
+			points[i] = num(p.X) + "," + num(p.Y)
+		}
+		class := "edge"
+		if edge.Type == layout.EdgePartner {
+			class += " partner"
+		}
+		fmt.Fprintf(&c.body, `<polyline class="%s" points="%s"/>`+"\n", class, strings.Join(points, " "))
+	}
+
+	for _, n := range l.Nodes {
+		c.node(n)
+	}
+	c.body.WriteString("</g>\n")
+}
+
+// node 渲染单个人物框
+func (c *canvas) node(n layout.Node) {
+	fill, stroke := c.colors(n.Individual, n.Spouse)
+	box := n.Box
+	fmt.Fprintf(&c.body, `<g id="%s">`+"\n", html.EscapeString(n.ID))
+	fmt.Fprintf(&c.body, `<rect x="%s" y="%s" width="%s" height="%s" rx="6" fill="%s" stroke="%s" stroke-width="1.5"/>`+"\n",
+		num(box.X), num(box.Y), num(box.Width), num(box.Height), fill, stroke)
+
+	textX, textWidth := box.X+box.Width/2, box.Width-2*photoInset
+	if size := box.Height - 2*photoInset; c.opts.ShowPhotos && size > 0 && c.photo(n.Individual, box.X+photoInset, box.Y+photoInset, size) {
+		textX = box.X + photoInset + size + (box.Width-photoInset-size)/2
+		textWidth = box.Width - 3*photoInset - size
+	}
+
+	lines := c.labels(n.Individual, textWidth)
+	y := box.Y + box.Height/2 - float64(len(lines)-1)*(fontSize+2)/2 + fontSize/3
+	for i, line := range lines {
+		class, size := "", fontSize
+		if i > 0 {
+			class, size = ` class="dates"`, smallSize
+		}
+		fmt.Fprintf(&c.body, `<text x="%s" y="%s" font-size="%s" text-anchor="middle"%s>%s</text>`+"\n",
+			num(textX), num(y), num(size), class, html.EscapeString(line))
+		y += fontSize + 2
+	}
+	c.body.WriteString("</g>\n")
+}
+
+// photo 渲染头像，没有照片或照片地址不是 http(s) 时返回 false
+func (c *canvas) photo(individual *models.Individual, x, y, size float64) bool {
+	if individual == nil || individual.PhotoURL == nil {
+		return false
+	}
+	photoURL := strings.TrimSpace(*individual.PhotoURL)
+	if !isWebURL(photoURL) {
+		return false
+	}
+	c.clipCount++
+	clipID := fmt.Sprintf("photo-clip-%d", c.clipCount)
+	fmt.Fprintf(&c.defs, `<clipPath id="%s"><rect x="%s" y="%s" width="%s" height="%s" rx="4"/></clipPath>`+"\n",
+		clipID, num(x), num(y), num(size), num(size))
+	fmt.Fprintf(&c.body, `<image x="%s" y="%s" width="%s" height="%s" preserveAspectRatio="xMidYMid slice" clip-path="url(#%s)" xlink:href="%s"/>`+"\n",
+		num(x), num(y), num(size), num(size), clipID, html.EscapeString(photoURL))
+	return true
+}
+
+// isWebURL 只接受 http(s) 地址，javascript:、data: 等地址在 SVG 中可能执行脚本或嵌入任意内容
+func isWebURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// labels 生成人物框内的文字行：姓名和生卒年
+func (c *canvas) labels(individual *models.Individual, width float64) []string {
+	if individual == nil {
+		return []string{"?"}
+	}
+	lines := []string{fitText(individual.FullName, width, fontSize)}
+	if c.opts.ShowDates {
+		if span := lifespan(individual); span != "" {
+			lines = append(lines, fitText(span, width, smallSize))
+		}
+	}
+	return lines
+}
+
+// colors 按着色方式返回填充色和描边色
+func (c *canvas) colors(individual *models.Individual, spouse bool) (string, string) {
+	switch c.opts.ColorBy {
+	case ColorByLineage:
+		if individual != nil {
+			if branch, ok := c.branches[individual.IndividualID]; ok && !spouse {
+				colors := palette[branch%len(palette)]
+				return colors[0], colors[1]
+			}
+		}
+		return "#f9fafb", borderColor
+	case ColorByGender:
+		if individual != nil {
+			switch individual.Gender {
+			case models.GenderMale:
+				return "#dbeafe", "#3b82f6"
+			case models.GenderFemale:
+				return "#fce7f3", "#ec4899"
+			}
+		}
+	}
+	return "#f9fafb", borderColor
+}
+
+// lineageBranches 计算每个人所属的支系：父亲一侧为 0/1、母亲一侧为 2/3（按祖父母细分），
+// 后代按根节点的第几个子女从 4 开始编号；以配偶身份出现的人不属于任何支系
+func lineageBranches(root *models.HourglassNode) map[int]int {
+	branches := make(map[int]int)
+	set := func(id, branch int) {
+		if _, ok := branches[id]; !ok {
+			branches[id] = branch
+		}
+	}
+
+	var up func(n *models.HourglassNode, branch int)
+	up = func(n *models.HourglassNode, branch int) {
+		if n == nil {
+			return
+		}
+		set(n.Individual.IndividualID, branch)
+		up(n.Father, branch)
+		up(n.Mother, branch)
+	}
+	for side, parent := range []*models.HourglassNode{root.Father, root.Mother} {
+		if parent == nil {
+			continue
+		}
+		set(parent.Individual.IndividualID, side*2)
+		up(parent.Father, side*2)
+		up(parent.Mother, side*2+1)
+	}
+
+	var down func(n *models.HourglassNode, branch int)
+	down = func(n *models.HourglassNode, branch int) {
+		set(n.Individual.IndividualID, branch)
+		for _, f := range n.Families {
+			for i := range f.Children {
+				down(&f.Children[i], branch)
+			}
+		}
+	}
+	branch := 4
+	for _, f := range root.Families {
+		for i := range f.Children {
+			down(&f.Children[i], branch)
+			branch++
+		}
+	}
+	return branches
+}
+
+// lifespan 生卒年，如 1901–1975
+func lifespan(individual *models.Individual) string {
+	var birth, death string
+	if individual.BirthDate != nil {
+		birth = fmt.Sprintf("%d", individual.BirthDate.Year())
+	}
+	if individual.DeathDate != nil {
+		death = fmt.Sprintf("%d", individual.DeathDate.Year())
+	}
+	if birth == "" && death == "" {
+		return ""
+	}
+	return birth + "–" + death
+}
+
+// fitText 按估算宽度截断文字，中日韩字符按一个字宽、其他字符按半个字宽计算
+func fitText(s string, width, size float64) string {
+	if textWidth(s, size) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && textWidth(string(runes)+"…", size) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
+
+func textWidth(s string, size float64) float64 {
+	total := 0.0
+	for _, r := range s {
+		if utf8.RuneLen(r) > 2 {
+			total += size
+		} else {
+			total += size * 0.6
+		}
+	}
+	return total
+}
+
+// num 格式化坐标，保留两位小数并去掉多余的零
+func num(v float64) string {
+	s := fmt.Sprintf("%.2f", v)
+	s = strings.TrimRight(s, "0")
+	s = strings.TrimSuffix(s, ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
@@ -0,0 +1,149 @@
+package chart
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"familytree/models"
+)
+
+func sampleTree() *models.HourglassNode {
+	born := time.Date(1901, 3, 1, 0, 0, 0, 0, time.UTC)
+	photo := "https://example.com/a.jpg?x=1&y=2"
+	person := func(id int, name string, gender models.Gender) models.Individual {
+		return models.Individual{IndividualID: id, FullName: name, Gender: gender}
+	}
+	wife := person(2, "王<秀英>", models.GenderFemale)
+
+	root := &models.HourglassNode{Individual: person(1, "李明", models.GenderMale)}
+	root.Individual.BirthDate = &born
+	root.Individual.PhotoURL = &photo
+	root.Families = []models.HourglassFamily{{
+		Spouse:   &wife,
+		Children: []models.HourglassNode{{Individual: person(3, "李华", models.GenderMale)}},
+	}}
+	root.Father = &models.HourglassNode{
+		Individual: person(10, "李大山", models.GenderMale),
+		Father:     &models.HourglassNode{Individual: person(20, "李老太爷", models.GenderMale)},
+		Mother:     &models.HourglassNode{Individual: person(21, "张氏", models.GenderFemale)},
+	}
+	root.Mother = &models.HourglassNode{Individual: person(11, "陈氏", models.GenderFemale)}
+	return root
+}
+
+// assertWellFormed SVG 必须是合法的 XML
+func assertWellFormed(t *testing.T, svg []byte) {
+	t.Helper()
+	decoder := xml.NewDecoder(bytes.NewReader(svg))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatalf("SVG 不是合法的 XML: %v\n%s", err, svg)
+		}
+	}
+}
+
+func TestRenderAllTypes(t *testing.T) {
+	for _, chartType := range []Type{TypePedigree, TypeDescendant, TypeFan, TypeHourglass} {
+		for _, color := range []ColorMode{ColorByGender, ColorByLineage, ColorNone} {
+			opts := DefaultOptions()
+			opts.Type, opts.ColorBy, opts.ShowPhotos = chartType, color, true
+
+			var buf bytes.Buffer
+			if err := Render(&buf, sampleTree(), opts); err != nil {
+				t.Fatalf("%s/%s: %v", chartType, color, err)
+			}
+			svg := buf.Bytes()
+			assertWellFormed(t, svg)
+
+			out := buf.String()
+			if !strings.Contains(out, "李明") || !strings.Contains(out, "1901–") {
+				t.Errorf("%s: 缺少姓名或生卒年", chartType)
+			}
+			if !strings.Contains(out, "Noto Sans CJK SC") {
+				t.Errorf("%s: 缺少中文字体", chartType)
+			}
+			if !strings.Contains(out, "xlink:href") {
+				t.Errorf("%s: 缺少照片", chartType)
+			}
+			if chartType != TypeDescendant && !strings.Contains(out, "李老太爷") {
+				t.Errorf("%s: 缺少祖先", chartType)
+			}
+		}
+	}
+}
+
+func TestPhotoURLSchemes(t *testing.T) {
+	for photo, want := range map[string]bool{
+		"https://example.com/a.jpg":                  true,
+		"HTTP://example.com/a.jpg":                   true,
+		"javascript:alert(1)":                        false,
+		"data:image/svg+xml;base64,PHN2Zz48L3N2Zz4=": false,
+		"file:///etc/passwd":                         false,
+		"//example.com/a.jpg":                        false,
+		" ":                                          false,
+	} {
+		tree := sampleTree()
+		tree.Individual.PhotoURL = &photo
+		opts := DefaultOptions()
+		opts.Type, opts.ShowPhotos = TypePedigree, true
+
+		var buf bytes.Buffer
+		if err := Render(&buf, tree, opts); err != nil {
+			t.Fatalf("%q: %v", photo, err)
+		}
+		if got := strings.Contains(buf.String(), "xlink:href"); got != want {
+			t.Errorf("%q: 渲染照片 %v, want %v", photo, got, want)
+		}
+	}
+}
+
+func TestRenderRejectsUnknownType(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Type = "circle"
+	if err := Render(io.Discard, sampleTree(), opts); err == nil {
+		t.Fatal("应拒绝不支持的图表类型")
+	}
+}
+
+func TestFontFamily(t *testing.T) {
+	for font, want := range map[string]bool{
+		DefaultFontFamily:            true,
+		"'Noto Serif SC', 宋体, serif": true,
+		"x;}*{display:none":          false,
+		"Arial</style><script>":      false,
+		`"Arial"`:                    false,
+	} {
+		if got := ValidFontFamily(font); got != want {
+			t.Errorf("%q: %v", font, got)
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.FontFamily = "x;}text{fill:red"
+	if err := Render(io.Discard, sampleTree(), opts); err == nil {
+		t.Fatal("应拒绝可以注入样式的字体")
+	}
+	var buf bytes.Buffer
+	opts.FontFamily = "'Noto Serif SC', serif"
+	if err := Render(&buf, sampleTree(), opts); err != nil || !strings.Contains(buf.String(), "font-family:&#39;Noto Serif SC&#39;, serif;") {
+		t.Fatalf("字体: %v", err)
+	}
+}
+
+func TestFitText(t *testing.T) {
+	if got := fitText("李明", 100, 14); got != "李明" {
+		t.Errorf("短文字不应截断: %s", got)
+	}
+	got := fitText("欧阳诸葛司马上官长名字", 60, 14)
+	if !strings.HasSuffix(got, "…") || textWidth(got, 14) > 60 {
+		t.Errorf("长文字应截断并加省略号: %s", got)
+	}
+}
@@ -0,0 +1,121 @@
+package chart
+
+import (
+	"fmt"
+	"html"
+	"math"
+
+	"familytree/models"
+)
+
+const (
+	fanCenterRadius = 70.0
+	fanRingWidth    = 90.0
+	fanRadialFrom   = 4 // 从第几代开始文字沿半径方向排列
+)
+
+// fanSlot 扇形图中的一个祖先位置
+type fanSlot struct {
+	node       *models.HourglassNode
+	generation int
+	index      int // 在该代中从左到右的序号，父亲为 2k、母亲为 2k+1
+}
+
+// fan 渲染半圆扇形祖先图：根节点在圆心，每代一环，父系在左、母系在右
+func (c *canvas) fan(root *models.HourglassNode) {
+	var slots []fanSlot
+	depth := 0
+	var walk func(n *models.HourglassNode, generation, index int)
+	walk = func(n *models.HourglassNode, generation, index int) {
+		if n == nil {
+			return
+		}
+		if generation > depth {
+			depth = generation
+		}
+		if generation > 0 {
+			slots = append(slots, fanSlot{node: n, generation: generation, index: index})
+		}
+		walk(n.Father, generation+1, index*2)
+		walk(n.Mother, generation+1, index*2+1)
+	}
+	walk(root, 0, 0)
+
+	radius := fanCenterRadius + float64(depth)*fanRingWidth
+	c.width, c.height = 2*(radius+margin), radius+fanCenterRadius/2+2*margin
+	cx, cy := margin+radius, margin+radius
+
+	for _, slot := range slots {
+		c.fanSlot(slot, cx, cy)
+	}
+
+	// 根节点：圆心处的半圆
+	fill, stroke := c.colors(&root.Individual, false)
+	fmt.Fprintf(&c.body, `<path d="M %s %s A %s %s 0 0 1 %s %s Z" fill="%s" stroke="%s" stroke-width="1.5"/>`+"\n",
+		num(cx-fanCenterRadius), num(cy), num(fanCenterRadius), num(fanCenterRadius), num(cx+fanCenterRadius), num(cy), fill, stroke)
+	textY := cy - fanCenterRadius/3
+	if size := fanCenterRadius * 0.6; c.opts.ShowPhotos && c.photo(&root.Individual, cx-size/2, cy-fanCenterRadius+4, size) {
+		textY = cy + fontSize + 4
+	}
+	for i, line := range c.labels(&root.Individual, 2*fanCenterRadius-2*photoInset) {
+		size, class := fontSize, ""
+		if i > 0 {
+			size, class = smallSize, ` class="dates"`
+		}
+		fmt.Fprintf(&c.body, `<text x="%s" y="%s" font-size="%s" text-anchor="middle"%s>%s</text>`+"\n",
+			num(cx), num(textY), num(size), class, html.EscapeString(line))
+		textY += fontSize + 2
+	}
+}
+
+// fanSlot 渲染一个环形扇区及其中的文字
+func (c *canvas) fanSlot(slot fanSlot, cx, cy float64) {
+	step := math.Pi / math.Pow(2, float64(slot.generation))
+	from := math.Pi - float64(slot.index)*step
+	to := from - step
+	inner := fanCenterRadius + float64(slot.generation-1)*fanRingWidth
+	outer := inner + fanRingWidth
+
+	point := func(r, angle float64) (string, string) {
+		return num(cx + r*math.Cos(angle)), num(cy - r*math.Sin(angle))
+	}
+	x1, y1 := point(outer, from)
+	x2, y2 := point(outer, to)
+	x3, y3 := point(inner, to)
+	x4, y4 := point(inner, from)
+
+	fill, stroke := c.colors(&slot.node.Individual, false)
+	fmt.Fprintf(&c.body, `<path d="M %s %s A %s %s 0 0 1 %s %s L %s %s A %s %s 0 0 0 %s %s Z" fill="%s" stroke="%s" stroke-width="1"/>`+"\n",
+		x1, y1, num(outer), num(outer), x2, y2, x3, y3, num(inner), num(inner), x4, y4, fill, stroke)
+
+	// 内圈文字沿切线方向排列，外圈扇区太窄时沿半径方向排列
+	mid := (from + to) / 2
+	degrees := mid * 180 / math.Pi
+	rotation, available := 90-degrees, step*(inner+outer)/2-2*photoInset
+	if slot.generation >= fanRadialFrom {
+		rotation, available = -degrees, fanRingWidth-2*photoInset
+		if degrees > 90 {
+			rotation = 180 - degrees
+		}
+	}
+
+	lines := c.labels(&slot.node.Individual, available)
+	lineHeight := fontSize + 2
+	if slot.generation >= fanRadialFrom && step*inner < float64(len(lines))*lineHeight {
+		lines = lines[:1] // 扇区容不下两行时只显示姓名
+	}
+	r := (inner + outer) / 2
+	x, y := point(r, mid)
+	fmt.Fprintf(&c.body, `<g transform="translate(%s,%s) rotate(%s)">`+"\n", x, y, num(rotation))
+	offset := -float64(len(lines)-1)*lineHeight/2 + fontSize/3
+	for i, line := range lines {
+		size, class := fontSize, ""
+		if i > 0 {
+			size, class = smallSize, ` class="dates"`
+		}
+		fmt.Fprintf(&c.body, `<text x="0" y="%s" font-size="%s" text-anchor="middle"%s>%s</text>`+"\n",
+			num(offset), num(size), class, html.EscapeString(line))
+		offset += lineHeight
+	}
+	c.body.WriteString("</g>\n")
+}
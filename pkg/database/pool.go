@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"sync"
@@ -133,6 +134,11 @@ func (p *Pool) Transaction(fn func(*sql.Tx) error) error {
 	return tx.Commit()
 }
 
+// TransactionContext 执行事务，fn 中通过 ctx 使用 Conn、Stmt、Begin 的操作都在同一事务中，详见 WithTransaction
+func (p *Pool) TransactionContext(ctx context.Context, fn func(ctx context.Context) error) error {
+	return WithTransaction(ctx, p.db, fn)
+}
+
 // PreparedStatement 预处理语句管理器
 type PreparedStatement struct {
 	pool       *Pool
@@ -0,0 +1,144 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// BusyTimeout 写入时等待其他连接释放数据库锁的最长时间，超过后才返回 SQLITE_BUSY
+const BusyTimeout = 5 * time.Second
+
+// SQLiteDSN 在数据库路径后加上连接参数：每个连接设置忙等待超时，事务以 BEGIN IMMEDIATE 开始。
+// 事务中先读后写时，DEFERRED 事务升级为写锁失败会直接返回 SQLITE_BUSY 而不等待，
+// 开始时就取得写锁，并发的写事务改为排队等待
+func SQLiteDSN(path string) string {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return fmt.Sprintf("%s%s_pragma=busy_timeout(%d)&_txlock=immediate", path, sep, BusyTimeout.Milliseconds())
+}
+
+// txContextKey 上下文中当前事务的键
+type txContextKey struct{}
+
+// savepointSeq 保存点名称序号
+var savepointSeq atomic.Uint64
+
+// Executor *sql.DB 与 *sql.Tx 共有的方法
+type Executor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Tx 事务。在 WithTransaction 开启的外层事务中开始时是一个保存点：
+// 提交只释放保存点，回滚只撤销保存点之后的修改，整体仍由外层事务提交或回滚
+type Tx struct {
+	*sql.Tx
+	savepoint string
+	done      bool
+}
+
+// Begin 开始事务；ctx 中已有事务时在其中创建保存点。
+// 连接通过 SQLiteDSN 打开时事务以 BEGIN IMMEDIATE 开始
+func Begin(ctx context.Context, db *sql.DB) (*Tx, error) {
+	outer, ok := ctx.Value(txContextKey{}).(*sql.Tx)
+	if !ok {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &Tx{Tx: tx}, nil
+	}
+
+	savepoint := fmt.Sprintf("sp_%d", savepointSeq.Add(1))
+	if _, err := outer.ExecContext(ctx, "SAVEPOINT "+savepoint); err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: outer, savepoint: savepoint}, nil
+}
+
+// Commit 提交事务或释放保存点
+func (t *Tx) Commit() error {
+	if t.savepoint == "" {
+		return t.Tx.Commit()
+	}
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	_, err := t.Tx.Exec("RELEASE SAVEPOINT " + t.savepoint)
+	return err
+}
+
+// Rollback 回滚事务或撤销到保存点；已提交时与 *sql.Tx 一样返回 sql.ErrTxDone，可以放在 defer 中
+func (t *Tx) Rollback() error {
+	if t.savepoint == "" {
+		return t.Tx.Rollback()
+	}
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	if _, err := t.Tx.Exec("ROLLBACK TO SAVEPOINT " + t.savepoint); err != nil {
+		return err
+	}
+	_, err := t.Tx.Exec("RELEASE SAVEPOINT " + t.savepoint)
+	return err
+}
+
+// WithTransaction 在一个事务中执行 fn。fn 收到的 ctx 携带该事务，通过它调用的 Conn、Stmt、Begin 都在同一事务中执行；
+// fn 返回错误或 panic 时回滚。ctx 中已有事务时作为保存点嵌套执行
+func WithTransaction(ctx context.Context, db *sql.DB, fn func(ctx context.Context) error) (err error) {
+	tx, err := Begin(ctx, db)
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %v", err)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	txCtx := ctx
+	if tx.savepoint == "" {
+		txCtx = context.WithValue(ctx, txContextKey{}, tx.Tx)
+	}
+	if err := fn(txCtx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %v", err)
+	}
+	return nil
+}
+
+// InTransaction ctx 是否处于 WithTransaction 开启的事务中
+func InTransaction(ctx context.Context) bool {
+	_, ok := ctx.Value(txContextKey{}).(*sql.Tx)
+	return ok
+}
+
+// Conn ctx 中的事务，没有时返回连接池
+func Conn(ctx context.Context, db *sql.DB) Executor {
+	if tx, ok := ctx.Value(txContextKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return db
+}
+
+// Stmt 预处理语句在 ctx 中事务上的版本，没有事务时原样返回
+func Stmt(ctx context.Context, stmt *sql.Stmt) *sql.Stmt {
+	if tx, ok := ctx.Value(txContextKey{}).(*sql.Tx); ok {
+		return tx.StmtContext(ctx, stmt)
+	}
+	return stmt
+}
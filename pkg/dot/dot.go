@@ -0,0 +1,173 @@
+// Package dot 将个人-家庭平铺图导出为 Graphviz DOT 文本
+//
+// 输入直接使用沙漏图服务返回的 models.FamilyGraph：个人为方框，家庭为连接夫妻与子女的小圆点，
+// 子女边按关系类型（亲生、收养、继亲、寄养）区分线型，同一代的节点放在同一个 cluster 中。
+package dot
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"familytree/models"
+	"familytree/pkg/narrative"
+)
+
+// Options 导出选项
+type Options struct {
+	Title  string // 图名，通常为起点人物姓名
+	RootID int    // 起点人物 ID，加粗显示
+}
+
+// edgeStyle 子女关系对应的线型
+type edgeStyle struct {
+	style, color, label string
+}
+
+// childStyles 子女关系类型到线型的映射，未列出的类型按 other 处理
+var childStyles = map[string]edgeStyle{
+	"":           {style: "solid", color: "black"},
+	"biological": {style: "solid", color: "black"},
+	"adopted":    {style: "dashed", color: "blue", label: "收养"},
+	"step":       {style: "dotted", color: "darkgreen", label: "继亲"},
+	"foster":     {style: "dashed", color: "orange", label: "寄养"},
+	"other":      {style: "dotted", color: "gray40"},
+}
+
+// genderColors 个人节点按性别填色
+var genderColors = map[models.Gender]string{
+	models.GenderMale:   "#dbeafe",
+	models.GenderFemale: "#fce7f3",
+}
+
+// Write 输出 DOT 文本，节点与边的顺序与输入一致，结果可重复
+func Write(w io.Writer, graph *models.FamilyGraph, opts Options) error {
+	b := bufio.NewWriter(w)
+	title := opts.Title
+	if title == "" {
+		title = "family"
+	}
+	fmt.Fprintf(b, "digraph %s {\n", quote(title))
+	b.WriteString("\tgraph [rankdir=TB, newrank=true, charset=\"UTF-8\", fontname=\"sans-serif\"];\n")
+	b.WriteString("\tnode [fontname=\"sans-serif\", fontsize=10];\n")
+	b.WriteString("\tedge [arrowsize=0.6];\n")
+
+	if graph != nil {
+		// 按代分组，cluster 内 rank=same 使同代节点排在同一行
+		byGeneration := map[int][]models.GraphNode{}
+		var generations []int
+		for _, node := range graph.Nodes {
+			if _, ok := byGeneration[node.Generation]; !ok {
+				generations = append(generations, node.Generation)
+			}
+			byGeneration[node.Generation] = append(byGeneration[node.Generation], node)
+		}
+		sort.Ints(generations)
+
+		for _, generation := range generations {
+			fmt.Fprintf(b, "\n\tsubgraph %s {\n", quote(fmt.Sprintf("cluster_gen_%d", generation)))
+			fmt.Fprintf(b, "\t\tlabel=%s;\n", quote(generationLabel(generation)))
+			b.WriteString("\t\trank=same; style=dashed; color=gray70; fontcolor=gray40;\n")
+			for _, node := range byGeneration[generation] {
+				fmt.Fprintf(b, "\t\t%s [%s];\n", quote(node.ID), nodeAttrs(node, opts.RootID))
+			}
+			b.WriteString("\t}\n")
+		}
+
+		if len(graph.Edges) > 0 {
+			b.WriteString("\n")
+		}
+		for _, edge := range graph.Edges {
+			fmt.Fprintf(b, "\t%s -> %s [%s];\n", quote(edge.From), quote(edge.To), edgeAttrs(edge))
+		}
+	}
+	b.WriteString("}\n")
+	return b.Flush()
+}
+
+// nodeAttrs 节点属性
+func nodeAttrs(node models.GraphNode, rootID int) string {
+	if node.Type == models.GraphNodeFamily {
+		attrs := []string{"shape=point", "width=0.12"}
+		if node.Family != nil {
+			var tip []string
+			if node.Family.MarriageDate != nil {
+				tip = append(tip, narrative.FormatDate(node.Family.MarriageDate)+"成婚")
+			}
+			if node.Family.DivorceDate != nil {
+				tip = append(tip, narrative.FormatDate(node.Family.DivorceDate)+"离婚")
+			}
+			if len(tip) > 0 {
+				attrs = append(attrs, "tooltip="+quote(strings.Join(tip, "，")))
+			}
+		}
+		return strings.Join(attrs, ", ")
+	}
+
+	label := node.ID
+	fill := "#f3f4f6"
+	if person := node.Individual; person != nil {
+		label = person.FullName
+		if lifespan := narrative.Lifespan(person); lifespan != "" {
+			label += "\n" + lifespan
+		}
+		if color, ok := genderColors[person.Gender]; ok {
+			fill = color
+		}
+	}
+	attrs := []string{"shape=box", "style=\"rounded,filled\"", "fillcolor=" + quote(fill), "label=" + quote(label)}
+	if node.Individual != nil && node.Individual.IndividualID == rootID {
+		attrs = append(attrs, "penwidth=2.5")
+	}
+	return strings.Join(attrs, ", ")
+}
+
+// edgeAttrs 边属性：夫妻边无箭头，子女边按关系类型区分线型
+func edgeAttrs(edge models.GraphEdge) string {
+	if edge.Type == models.GraphEdgePartner {
+		return "arrowhead=none, color=gray30"
+	}
+	style, ok := childStyles[edge.Role]
+	if !ok {
+		style = childStyles["other"]
+		style.label = edge.Role
+	}
+	attrs := []string{"style=" + style.style, "color=" + quote(style.color)}
+	if style.label != "" {
+		attrs = append(attrs, "label="+quote(style.label), "fontsize=8", "fontcolor="+quote(style.color))
+	}
+	return strings.Join(attrs, ", ")
+}
+
+// generationLabel 代的名称：本代、上一代、下二代
+func generationLabel(generation int) string {
+	switch {
+	case generation < 0:
+		return "上" + narrative.ChineseNumber(-generation) + "代"
+	case generation > 0:
+		return "下" + narrative.ChineseNumber(generation) + "代"
+	}
+	return "本代"
+}
+
+// quote 生成 DOT 双引号字符串，换行写作 \n
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,54 @@
+package dot
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"familytree/models"
+)
+
+func TestWrite(t *testing.T) {
+	father := &models.Individual{IndividualID: 1, FullName: `张"大山"`, Gender: models.GenderMale}
+	child := &models.Individual{IndividualID: 2, FullName: "张明", Gender: models.GenderMale}
+	adopted := &models.Individual{IndividualID: 3, FullName: "张丽", Gender: models.GenderFemale}
+	graph := &models.FamilyGraph{
+		Nodes: []models.GraphNode{
+			{ID: "I2", Type: models.GraphNodeIndividual, Generation: 0, Individual: child},
+			{ID: "I1", Type: models.GraphNodeIndividual, Generation: -1, Individual: father},
+			{ID: "F1", Type: models.GraphNodeFamily, Generation: -1, Family: &models.Family{FamilyID: 1}},
+			{ID: "I3", Type: models.GraphNodeIndividual, Generation: 0, Individual: adopted},
+		},
+		Edges: []models.GraphEdge{
+			{From: "I1", To: "F1", Type: models.GraphEdgePartner, Role: "husband"},
+			{From: "F1", To: "I2", Type: models.GraphEdgeChild, Role: "biological"},
+			{From: "F1", To: "I3", Type: models.GraphEdgeChild, Role: "adopted"},
+		},
+	}
+
+	var out bytes.Buffer
+	if err := Write(&out, graph, Options{Title: "张明", RootID: 2}); err != nil {
+		t.Fatal(err)
+	}
+	got := out.String()
+	for _, s := range []string{
+		`digraph "张明" {`,
+		`label="上一代";`,
+		`label="张\"大山\""`,
+		`"F1" [shape=point`,
+		`"I1" -> "F1" [arrowhead=none`,
+		`"F1" -> "I2" [style=solid`,
+		`"F1" -> "I3" [style=dashed, color="blue", label="收养"`,
+	} {
+		if !strings.Contains(got, s) {
+			t.Errorf("输出缺少 %q:\n%s", s, got)
+		}
+	}
+	// 代数从小到大输出，上一代在前
+	if strings.Index(got, "cluster_gen_-1") > strings.Index(got, "cluster_gen_0") {
+		t.Errorf("cluster 顺序错误:\n%s", got)
+	}
+	if !strings.Contains(got, `label="张明", penwidth=2.5`) {
+		t.Errorf("起点人物未加粗:\n%s", got)
+	}
+}
@@ -16,6 +16,8 @@ const (
 	ErrCodeInternalError ErrorCode = "INTERNAL_ERROR"
 	ErrCodeUnauthorized  ErrorCode = "UNAUTHORIZED"
 	ErrCodeForbidden     ErrorCode = "FORBIDDEN"
+	ErrCodeTooMany       ErrorCode = "TOO_MANY_REQUESTS"
+	ErrCodeUnavailable   ErrorCode = "SERVICE_UNAVAILABLE"
 
 	// 业务错误码
 	ErrCodeInvalidRelation  ErrorCode = "INVALID_RELATION"
@@ -23,6 +25,8 @@ const (
 	ErrCodeGenderMismatch   ErrorCode = "GENDER_MISMATCH"
 	ErrCodeHasChildren      ErrorCode = "HAS_CHILDREN"
 	ErrCodeInFamily         ErrorCode = "IN_FAMILY"
+	ErrCodeConflict         ErrorCode = "CONFLICT"
+	ErrCodeVersionMismatch  ErrorCode = "VERSION_MISMATCH"
 )
 
 // AppError 应用错误结构
@@ -53,8 +57,14 @@ func (e *AppError) HTTPStatus() int {
 		return http.StatusUnauthorized
 	case ErrCodeForbidden:
 		return http.StatusForbidden
-	case ErrCodeHasChildren, ErrCodeInFamily:
+	case ErrCodeTooMany:
+		return http.StatusTooManyRequests
+	case ErrCodeUnavailable:
+		return http.StatusServiceUnavailable
+	case ErrCodeHasChildren, ErrCodeInFamily, ErrCodeConflict:
 		return http.StatusConflict
+	case ErrCodeVersionMismatch:
+		return http.StatusPreconditionFailed
 	default:
 		return http.StatusInternalServerError
 	}
@@ -92,4 +102,5 @@ var (
 	ErrGenderMismatch   = New(ErrCodeGenderMismatch, "性别不匹配")
 	ErrHasChildren      = New(ErrCodeHasChildren, "该个人有子女记录，不能删除")
 	ErrInFamily         = New(ErrCodeInFamily, "该个人仍存在于家庭关系中，不能删除")
+	ErrVersionMismatch  = New(ErrCodeVersionMismatch, "记录已被他人修改，请刷新后重试")
 )
@@ -0,0 +1,121 @@
+// Package ical 输出 iCalendar（RFC 5545）格式的订阅日历
+//
+// 只包含全天事件，足以满足生日、纪念日一类的提醒。行按 75 字节折行，
+// 折行不会切断多字节字符。
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ContentType iCalendar 的 MIME 类型
+const ContentType = "text/calendar; charset=utf-8"
+
+// maxLineOctets 每行最多字节数（不含换行）
+const maxLineOctets = 75
+
+// Calendar 日历
+type Calendar struct {
+	Name        string        // 日历名称，显示在日历应用中
+	Description string        // 日历说明
+	Refresh     time.Duration // 建议的刷新间隔，为 0 时不输出
+	Events      []Event
+}
+
+// Event 全天事件
+type Event struct {
+	UID         string    // 全局唯一且稳定，日历应用依此更新事件
+	Date        time.Time // 只使用年月日
+	Summary     string
+	Description string
+	Categories  []string
+}
+
+// Write 输出日历，stamp 为 DTSTAMP 时间
+func Write(w io.Writer, cal *Calendar, stamp time.Time) error {
+	b := bufio.NewWriter(w)
+	line := func(s string) {
+		writeFolded(b, s)
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//familytree//calendar//ZH")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	if cal.Name != "" {
+		line("X-WR-CALNAME:" + escape(cal.Name))
+	}
+	if cal.Description != "" {
+		line("X-WR-CALDESC:" + escape(cal.Description))
+	}
+	if cal.Refresh > 0 {
+		duration := fmt.Sprintf("PT%dH", int(cal.Refresh.Hours()))
+		line("REFRESH-INTERVAL;VALUE=DURATION:" + duration)
+		line("X-PUBLISHED-TTL:" + duration)
+	}
+
+	dtstamp := stamp.UTC().Format("20060102T150405Z")
+	for _, event := range cal.Events {
+		line("BEGIN:VEVENT")
+		line("UID:" + escape(event.UID))
+		line("DTSTAMP:" + dtstamp)
+		line("DTSTART;VALUE=DATE:" + event.Date.Format("20060102"))
+		line("DTEND;VALUE=DATE:" + event.Date.AddDate(0, 0, 1).Format("20060102"))
+		line("SUMMARY:" + escape(event.Summary))
+		if event.Description != "" {
+			line("DESCRIPTION:" + escape(event.Description))
+		}
+		if len(event.Categories) > 0 {
+			escaped := make([]string, len(event.Categories))
+			for i, c := range event.Categories {
+				escaped[i] = escape(c)
+			}
+			line("CATEGORIES:" + strings.Join(escaped, ","))
+		}
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return b.Flush()
+}
+
+// escape 转义 TEXT 值中的反斜杠、分号、逗号和换行
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '\\', ';', ',':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// writeFolded 写入一行，超过 75 字节时折行，续行以空格开头
+func writeFolded(b *bufio.Writer, s string) {
+	limit := maxLineOctets
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		limit = maxLineOctets - 1
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+}
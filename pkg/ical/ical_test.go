@@ -0,0 +1,59 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestWrite(t *testing.T) {
+	cal := &Calendar{
+		Name:    "张氏家族纪念日",
+		Refresh: 12 * time.Hour,
+		Events: []Event{{
+			UID:         "birthday-1-2026@familytree",
+			Date:        time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC),
+			Summary:     "张德高 生日; 农历九月初八",
+			Description: strings.Repeat("家族成员的生日提醒，", 10) + "\n第二行",
+			Categories:  []string{"生日", "农历"},
+		}},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, cal, time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"X-WR-CALNAME:张氏家族纪念日\r\n",
+		"REFRESH-INTERVAL;VALUE=DURATION:PT12H\r\n",
+		"UID:birthday-1-2026@familytree\r\n",
+		"DTSTAMP:20260101T080000Z\r\n",
+		"DTSTART;VALUE=DATE:20261018\r\n",
+		"DTEND;VALUE=DATE:20261019\r\n",
+		"SUMMARY:张德高 生日\\; 农历九月初八\r\n",
+		"CATEGORIES:生日,农历\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+		if len(line) > maxLineOctets {
+			t.Errorf("line too long (%d): %q", len(line), line)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("folding split a character: %q", line)
+		}
+	}
+
+	unfolded := strings.ReplaceAll(out, "\r\n ", "")
+	if !strings.Contains(unfolded, "DESCRIPTION:"+strings.Repeat("家族成员的生日提醒，", 10)+"\\n第二行\r\n") {
+		t.Errorf("description not escaped or unfolded correctly:\n%s", unfolded)
+	}
+}
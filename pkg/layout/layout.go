@@ -0,0 +1,499 @@
+// Package layout 服务端家族树布局引擎
+//
+// 使用 Reingold–Tilford 轮廓算法计算节点坐标、连线路径和边界框，本人与配偶并排组成一个布局单元。
+// 坐标以整张图的左上角为原点，单位与 Options 一致。前端页面和各种导出、渲染器都应直接使用这里的结果，
+// 保证不同出口画出的图完全一致。
+package layout
+
+import (
+	"fmt"
+	"math"
+
+	"familytree/models"
+)
+
+// Orientation 布局方向
+type Orientation string
+
+const (
+	OrientationDescendant Orientation = "descendant" // 后代图，根在上方
+	OrientationAncestor   Orientation = "ancestor"   // 祖先图（谱系图），根在下方
+	OrientationHourglass  Orientation = "hourglass"  // 沙漏图，祖先在上、后代在下
+)
+
+// 连线类型
+const (
+	EdgePartner = "partner"
+	EdgeChild   = "child"
+)
+
+// Options 布局尺寸参数
+type Options struct {
+	NodeWidth  float64 `json:"node_width"`
+	NodeHeight float64 `json:"node_height"`
+	SpouseGap  float64 `json:"spouse_gap"`  // 夫妻框之间的间距
+	SiblingGap float64 `json:"sibling_gap"` // 同一代相邻子树之间的最小间距
+	LevelGap   float64 `json:"level_gap"`   // 相邻两代之间的垂直间距
+}
+
+// DefaultOptions 默认布局尺寸
+func DefaultOptions() Options {
+	return Options{
+		NodeWidth:  160,
+		NodeHeight: 60,
+		SpouseGap:  20,
+		SiblingGap: 30,
+		LevelGap:   60,
+	}
+}
+
+// Point 坐标点
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Rect 矩形，X/Y 为左上角
+type Rect struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// Node 布局后的个人节点
+type Node struct {
+	ID           string             `json:"id"` // 同一人在图中多次出现时以 #n 区分
+	IndividualID int                `json:"individual_id"`
+	Individual   *models.Individual `json:"individual"`
+	Generation   int                `json:"generation"`       // 相对根节点的代数，祖先为负数
+	Spouse       bool               `json:"spouse,omitempty"` // 以配偶身份出现，不继续展开
+	X            float64            `json:"x"`                // 中心点
+	Y            float64            `json:"y"`
+	Box          Rect               `json:"box"`
+}
+
+// Edge 连线，Points 为正交折线路径
+type Edge struct {
+	Type   string  `json:"type"`
+	From   string  `json:"from"`
+	To     string  `json:"to"`
+	Points []Point `json:"points"`
+}
+
+// Layout 布局结果
+type Layout struct {
+	Orientation Orientation `json:"orientation"`
+	RootID      string      `json:"root_id"`
+	Options     Options     `json:"options"`
+	Nodes       []Node      `json:"nodes"`
+	Edges       []Edge      `json:"edges"`
+	Bounds      Rect        `json:"bounds"`
+}
+
+// Descendants 后代图布局，同一人的多段婚姻各自带出子女
+func Descendants(root *models.HourglassNode, opts Options) *Layout {
+	if root == nil {
+		return nil
+	}
+	e := newEngine(opts)
+	down := e.descendantUnit(root)
+	e.place(down)
+	e.assign(down, 0, 0, 1)
+	e.descendantEdges(down)
+	return e.finish(OrientationDescendant, down.self)
+}
+
+// Ancestors 祖先图布局，只展开父母
+func Ancestors(root *models.HourglassNode, opts Options) *Layout {
+	if root == nil {
+		return nil
+	}
+	e := newEngine(opts)
+	up := e.ancestorUnit(root, nil)
+	e.place(up)
+	e.assign(up, 0, 0, -1)
+	e.ancestorEdges(up)
+	return e.finish(OrientationAncestor, up.self)
+}
+
+// Hourglass 沙漏图布局，上下两半共用根节点
+func Hourglass(root *models.HourglassNode, opts Options) *Layout {
+	if root == nil {
+		return nil
+	}
+	e := newEngine(opts)
+	down := e.descendantUnit(root)
+	e.place(down)
+	e.assign(down, 0, 0, 1)
+	e.descendantEdges(down)
+
+	up := e.ancestorUnit(root, down.self)
+	e.place(up)
+	e.assign(up, down.self.X, 0, -1)
+	e.ancestorEdges(up)
+	return e.finish(OrientationHourglass, down.self)
+}
+
+// FamilyTree 对 GetFamilyTree 的结果做后代图布局
+func FamilyTree(root *models.FamilyTreeNode, opts Options) *Layout {
+	return Descendants(fromFamilyTree(root), opts)
+}
+
+// fromFamilyTree 将家族树节点转换为沙漏节点，每人只有一个家庭
+func fromFamilyTree(n *models.FamilyTreeNode) *models.HourglassNode {
+	if n == nil || n.Individual == nil {
+		return nil
+	}
+	node := &models.HourglassNode{Individual: *n.Individual}
+	family := models.HourglassFamily{Spouse: n.Spouse}
+	for i := range n.Children {
+		if child := fromFamilyTree(&n.Children[i]); child != nil {
+			family.Children = append(family.Children, *child)
+		}
+	}
+	if family.Spouse != nil || len(family.Children) > 0 {
+		node.Families = []models.HourglassFamily{family}
+	}
+	return node
+}
+
+// unit 布局单元：本人及其配偶并排组成的一组框
+type unit struct {
+	nodes  []*Node // 从左到右
+	self   *Node
+	groups []group
+	offset float64 // 相对上一级单元中心的水平偏移
+	width  float64
+}
+
+// group 单元下的一组子单元：后代图中为一段婚姻的子女，祖先图中为父母
+type group struct {
+	partner *Node // 配偶，未知时为空
+	kids    []*unit
+}
+
+// kids 按从左到右顺序返回全部子单元
+func (u *unit) kids() []*unit {
+	var kids []*unit
+	for _, g := range u.groups {
+		kids = append(kids, g.kids...)
+	}
+	return kids
+}
+
+// contour 子树每一层相对单元中心的左右边界
+type contour struct {
+	left, right []float64
+}
+
+type engine struct {
+	opts  Options
+	nodes []*Node
+	edges []Edge
+	seen  map[int]int
+}
+
+// newEngine 零值参数使用默认尺寸，非法值回退为默认值
+func newEngine(opts Options) *engine {
+	defaults := DefaultOptions()
+	if opts == (Options{}) {
+		opts = defaults
+	}
+	if opts.NodeWidth <= 0 {
+		opts.NodeWidth = defaults.NodeWidth
+	}
+	if opts.NodeHeight <= 0 {
+		opts.NodeHeight = defaults.NodeHeight
+	}
+	if opts.SpouseGap < 0 {
+		opts.SpouseGap = 0
+	}
+	if opts.SiblingGap < 0 {
+		opts.SiblingGap = 0
+	}
+	if opts.LevelGap <= 0 {
+		opts.LevelGap = defaults.LevelGap
+	}
+	return &engine{opts: opts, seen: make(map[int]int)}
+}
+
+// newNode 创建节点，重复出现的人（如近亲婚姻）使用带序号的ID
+func (e *engine) newNode(individual models.Individual, spouse bool) *Node {
+	e.seen[individual.IndividualID]++
+	id := fmt.Sprintf("I%d", individual.IndividualID)
+	if n := e.seen[individual.IndividualID]; n > 1 {
+		id = fmt.Sprintf("%s#%d", id, n)
+	}
+	node := &Node{ID: id, IndividualID: individual.IndividualID, Individual: &individual, Spouse: spouse}
+	e.nodes = append(e.nodes, node)
+	return node
+}
+
+// descendantUnit 构建后代单元，配偶依次交替排在本人右侧和左侧
+func (e *engine) descendantUnit(n *models.HourglassNode) *unit {
+	u := &unit{self: e.newNode(n.Individual, false)}
+	var left, right []*Node
+	for _, f := range n.Families {
+		g := group{}
+		if f.Spouse != nil {
+			g.partner = e.newNode(*f.Spouse, true)
+			if len(right) <= len(left) {
+				right = append(right, g.partner)
+			} else {
+				left = append(left, g.partner)
+			}
+		}
+		for i := range f.Children {
+			g.kids = append(g.kids, e.descendantUnit(&f.Children[i]))
+		}
+		u.groups = append(u.groups, g)
+	}
+
+	for i := len(left) - 1; i >= 0; i-- {
+		u.nodes = append(u.nodes, left[i])
+	}
+	u.nodes = append(u.nodes, u.self)
+	u.nodes = append(u.nodes, right...)
+	u.width = float64(len(u.nodes))*e.opts.NodeWidth + float64(len(u.nodes)-1)*e.opts.SpouseGap
+	return u
+}
+
+// ancestorUnit 构建祖先单元，父亲在左、母亲在右；self 不为空时复用已有的根节点
+func (e *engine) ancestorUnit(n *models.HourglassNode, self *Node) *unit {
+	if self == nil {
+		self = e.newNode(n.Individual, false)
+	}
+	u := &unit{self: self, nodes: []*Node{self}, width: e.opts.NodeWidth}
+	g := group{}
+	for _, parent := range []*models.HourglassNode{n.Father, n.Mother} {
+		if parent != nil {
+			g.kids = append(g.kids, e.ancestorUnit(parent, nil))
+		}
+	}
+	if len(g.kids) > 0 {
+		u.groups = []group{g}
+	}
+	return u
+}
+
+// place 自底向上放置子树：相邻子树按轮廓尽量靠拢，父单元居中于首尾子单元之上
+func (e *engine) place(u *unit) contour {
+	own := contour{left: []float64{-u.width / 2}, right: []float64{u.width / 2}}
+	kids := u.kids()
+	if len(kids) == 0 {
+		return own
+	}
+
+	positions := make([]float64, len(kids))
+	var merged contour
+	for i, kid := range kids {
+		c := e.place(kid)
+		if i == 0 {
+			merged = c
+			continue
+		}
+		shift := math.Inf(-1)
+		for d := 0; d < len(merged.right) && d < len(c.left); d++ {
+			shift = math.Max(shift, merged.right[d]-c.left[d]+e.opts.SiblingGap)
+		}
+		positions[i] = shift
+		for d := range c.left {
+			if d < len(merged.right) {
+				merged.right[d] = c.right[d] + shift
+			} else {
+				merged.left = append(merged.left, c.left[d]+shift)
+				merged.right = append(merged.right, c.right[d]+shift)
+			}
+		}
+	}
+
+	mid := (positions[0] + positions[len(positions)-1]) / 2
+	for i, kid := range kids {
+		kid.offset = positions[i] - mid
+	}
+	for d := range merged.left {
+		own.left = append(own.left, merged.left[d]-mid)
+		own.right = append(own.right, merged.right[d]-mid)
+	}
+	return own
+}
+
+// assign 自顶向下计算绝对坐标，direction 为 1 时向下展开，-1 时向上展开
+func (e *engine) assign(u *unit, center float64, level, direction int) {
+	w, h := e.opts.NodeWidth, e.opts.NodeHeight
+	y := float64(level*direction) * (h + e.opts.LevelGap)
+	x := center - u.width/2
+	for _, n := range u.nodes {
+		n.Generation = level * direction
+		n.Box = Rect{X: x, Y: y, Width: w, Height: h}
+		n.X, n.Y = x+w/2, y+h/2
+		x += w + e.opts.SpouseGap
+	}
+	for _, kid := range u.kids() {
+		e.assign(kid, center+kid.offset, level+1, direction)
+	}
+}
+
+// descendantEdges 生成后代图的夫妻连线和子女连线
+func (e *engine) descendantEdges(u *unit) {
+	self := u.self
+	bottom := self.Box.Y + self.Box.Height
+	for i, g := range u.groups {
+		// 每段婚姻的子女使用不同高度的横线，避免多段婚姻的连线重叠
+		busY := bottom + e.opts.LevelGap*float64(i+1)/float64(len(u.groups)+1)
+		anchor := Point{X: self.X, Y: bottom}
+		if g.partner != nil {
+			anchor = e.partnerEdge(u, g.partner, i)
+		}
+		for _, kid := range g.kids {
+			child := kid.self
+			e.edges = append(e.edges, Edge{
+				Type: EdgeChild,
+				From: self.ID,
+				To:   child.ID,
+				Points: route(anchor, Point{X: anchor.X, Y: busY},
+					Point{X: child.X, Y: busY}, Point{X: child.X, Y: child.Box.Y}),
+			})
+			e.descendantEdges(kid)
+		}
+	}
+}
+
+// partnerEdge 生成本人与配偶的连线，返回子女连线的起点。
+// 相邻的配偶在两框之间直连；不相邻的配偶从框顶绕过，子女从配偶框下方引出
+func (e *engine) partnerEdge(u *unit, partner *Node, index int) Point {
+	self := u.self
+	selfIndex, partnerIndex := indexOf(u.nodes, self), indexOf(u.nodes, partner)
+
+	if diff := partnerIndex - selfIndex; diff == 1 || diff == -1 {
+		fromX, toX := self.Box.X+self.Box.Width, partner.Box.X
+		if diff < 0 {
+			fromX, toX = self.Box.X, partner.Box.X+partner.Box.Width
+		}
+		e.edges = append(e.edges, Edge{
+			Type:   EdgePartner,
+			From:   self.ID,
+			To:     partner.ID,
+			Points: []Point{{X: fromX, Y: self.Y}, {X: toX, Y: self.Y}},
+		})
+		return Point{X: (fromX + toX) / 2, Y: self.Y}
+	}
+
+	liftY := self.Box.Y - e.opts.LevelGap*float64(index+1)/float64(2*(len(u.groups)+1))
+	e.edges = append(e.edges, Edge{
+		Type: EdgePartner,
+		From: self.ID,
+		To:   partner.ID,
+		Points: route(Point{X: self.X, Y: self.Box.Y}, Point{X: self.X, Y: liftY},
+			Point{X: partner.X, Y: liftY}, Point{X: partner.X, Y: partner.Box.Y}),
+	})
+	return Point{X: partner.X, Y: partner.Box.Y + partner.Box.Height}
+}
+
+// ancestorEdges 生成祖先图中父母之间的连线和父母到子女的连线
+func (e *engine) ancestorEdges(u *unit) {
+	kids := u.kids()
+	if len(kids) == 0 {
+		return
+	}
+
+	self := u.self
+	first := kids[0].self
+	parentBottom := first.Box.Y + first.Box.Height
+	anchor := Point{X: first.X, Y: parentBottom}
+	if len(kids) == 2 {
+		second := kids[1].self
+		fromX, toX := first.Box.X+first.Box.Width, second.Box.X
+		e.edges = append(e.edges, Edge{
+			Type:   EdgePartner,
+			From:   first.ID,
+			To:     second.ID,
+			Points: []Point{{X: fromX, Y: first.Y}, {X: toX, Y: first.Y}},
+		})
+		anchor = Point{X: (fromX + toX) / 2, Y: first.Y}
+	}
+
+	busY := parentBottom + e.opts.LevelGap/2
+	e.edges = append(e.edges, Edge{
+		Type: EdgeChild,
+		From: first.ID,
+		To:   self.ID,
+		Points: route(anchor, Point{X: anchor.X, Y: busY},
+			Point{X: self.X, Y: busY}, Point{X: self.X, Y: self.Box.Y}),
+	})
+
+	for _, kid := range kids {
+		e.ancestorEdges(kid)
+	}
+}
+
+// finish 把整张图平移到以左上角为原点并计算边界框
+func (e *engine) finish(orientation Orientation, root *Node) *Layout {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	extend := func(x, y float64) {
+		minX, minY = math.Min(minX, x), math.Min(minY, y)
+		maxX, maxY = math.Max(maxX, x), math.Max(maxY, y)
+	}
+	for _, n := range e.nodes {
+		extend(n.Box.X, n.Box.Y)
+		extend(n.Box.X+n.Box.Width, n.Box.Y+n.Box.Height)
+	}
+	for _, edge := range e.edges {
+		for _, p := range edge.Points {
+			extend(p.X, p.Y)
+		}
+	}
+
+	result := &Layout{
+		Orientation: orientation,
+		RootID:      root.ID,
+		Options:     e.opts,
+		Nodes:       make([]Node, 0, len(e.nodes)),
+		Edges:       make([]Edge, 0, len(e.edges)),
+		Bounds:      Rect{Width: maxX - minX, Height: maxY - minY},
+	}
+	for _, n := range e.nodes {
+		node := *n
+		node.X, node.Y = node.X-minX, node.Y-minY
+		node.Box.X, node.Box.Y = node.Box.X-minX, node.Box.Y-minY
+		result.Nodes = append(result.Nodes, node)
+	}
+	for _, edge := range e.edges {
+		for i := range edge.Points {
+			edge.Points[i].X -= minX
+			edge.Points[i].Y -= minY
+		}
+		result.Edges = append(result.Edges, edge)
+	}
+	return result
+}
+
+// route 去掉折线中重复和共线的点
+func route(points ...Point) []Point {
+	result := make([]Point, 0, len(points))
+	for _, p := range points {
+		if n := len(result); n > 0 && result[n-1] == p {
+			continue
+		}
+		if n := len(result); n >= 2 {
+			a, b := result[n-2], result[n-1]
+			if (a.X == b.X && b.X == p.X) || (a.Y == b.Y && b.Y == p.Y) {
+				result[n-1] = p
+				continue
+			}
+		}
+		result = append(result, p)
+	}
+	return result
+}
+
+func indexOf(nodes []*Node, target *Node) int {
+	for i, n := range nodes {
+		if n == target {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,207 @@
+package layout
+
+import (
+	"math"
+	"testing"
+
+	"familytree/models"
+)
+
+func person(id int) models.Individual {
+	return models.Individual{IndividualID: id}
+}
+
+func spouse(id int) *models.Individual {
+	p := person(id)
+	return &p
+}
+
+func leaf(id int) models.HourglassNode {
+	return models.HourglassNode{Individual: person(id)}
+}
+
+// wideFamily 两段婚姻、子女数量差异较大的后代树
+func wideFamily() *models.HourglassNode {
+	return &models.HourglassNode{
+		Individual: person(1),
+		Families: []models.HourglassFamily{
+			{Spouse: spouse(2), Children: []models.HourglassNode{
+				leaf(10),
+				{Individual: person(11), Families: []models.HourglassFamily{
+					{Spouse: spouse(12), Children: []models.HourglassNode{leaf(20), leaf(21), leaf(22), leaf(23)}},
+				}},
+				leaf(13),
+			}},
+			{Spouse: spouse(3), Children: []models.HourglassNode{leaf(14)}},
+			{Spouse: spouse(4)},
+		},
+		Father: &models.HourglassNode{
+			Individual: person(100),
+			Father:     &models.HourglassNode{Individual: person(200)},
+			Mother:     &models.HourglassNode{Individual: person(201)},
+		},
+		Mother: &models.HourglassNode{Individual: person(101)},
+	}
+}
+
+func nodesByID(l *Layout) map[string]Node {
+	byID := make(map[string]Node, len(l.Nodes))
+	for _, n := range l.Nodes {
+		byID[n.ID] = n
+	}
+	return byID
+}
+
+// assertNoOverlap 同一代的节点框不能重叠
+func assertNoOverlap(t *testing.T, l *Layout) {
+	t.Helper()
+	for i, a := range l.Nodes {
+		for _, b := range l.Nodes[i+1:] {
+			if a.Box.Y != b.Box.Y {
+				continue
+			}
+			if a.Box.X < b.Box.X+b.Box.Width && b.Box.X < a.Box.X+a.Box.Width {
+				t.Errorf("节点 %s 与 %s 重叠: %+v %+v", a.ID, b.ID, a.Box, b.Box)
+			}
+		}
+	}
+}
+
+// assertInBounds 所有节点和连线都在边界框内，且边界框以原点为左上角
+func assertInBounds(t *testing.T, l *Layout) {
+	t.Helper()
+	if l.Bounds.X != 0 || l.Bounds.Y != 0 {
+		t.Errorf("边界框应以原点为左上角: %+v", l.Bounds)
+	}
+	inside := func(x, y float64) bool {
+		return x >= -1e-9 && y >= -1e-9 && x <= l.Bounds.Width+1e-9 && y <= l.Bounds.Height+1e-9
+	}
+	for _, n := range l.Nodes {
+		if !inside(n.Box.X, n.Box.Y) || !inside(n.Box.X+n.Box.Width, n.Box.Y+n.Box.Height) {
+			t.Errorf("节点 %s 超出边界框", n.ID)
+		}
+	}
+	for _, e := range l.Edges {
+		for _, p := range e.Points {
+			if !inside(p.X, p.Y) {
+				t.Errorf("连线 %s->%s 超出边界框", e.From, e.To)
+			}
+		}
+	}
+}
+
+func TestDescendantLayout(t *testing.T) {
+	l := Descendants(wideFamily(), DefaultOptions())
+	assertNoOverlap(t, l)
+	assertInBounds(t, l)
+
+	nodes := nodesByID(l)
+	root := nodes["I1"]
+	if l.RootID != "I1" || root.Generation != 0 {
+		t.Fatalf("根节点错误: %s %+v", l.RootID, root)
+	}
+
+	// 配偶与本人在同一行并排
+	for _, id := range []string{"I2", "I3", "I4"} {
+		if nodes[id].Y != root.Y || !nodes[id].Spouse {
+			t.Errorf("配偶 %s 应与本人同行: %+v", id, nodes[id])
+		}
+	}
+	if nodes["I2"].X <= root.X || nodes["I3"].X >= root.X || nodes["I4"].X <= nodes["I2"].X {
+		t.Errorf("配偶应依次排在本人右侧、左侧、右侧")
+	}
+
+	// 父单元居中于首尾子女之上
+	first, last := nodes["I20"], nodes["I23"]
+	if parent := nodes["I11"]; math.Abs(parent.X+(nodes["I12"].X-parent.X)/2-(first.X+last.X)/2) > 1e-9 {
+		t.Errorf("夫妻单元应居中于子女之上")
+	}
+	if nodes["I20"].Generation != 2 || nodes["I20"].Y <= nodes["I11"].Y {
+		t.Errorf("孙辈应位于第二代")
+	}
+
+	children, partners := 0, 0
+	for _, e := range l.Edges {
+		switch e.Type {
+		case EdgeChild:
+			children++
+			end := e.Points[len(e.Points)-1]
+			child := nodes[e.To]
+			if end.X != child.X || end.Y != child.Box.Y {
+				t.Errorf("子女连线 %s 应终止于子女框顶部", e.To)
+			}
+		case EdgePartner:
+			partners++
+		}
+	}
+	if children != 8 || partners != 4 {
+		t.Errorf("连线数量错误: 子女 %d 夫妻 %d", children, partners)
+	}
+}
+
+func TestAncestorLayout(t *testing.T) {
+	l := Ancestors(wideFamily(), DefaultOptions())
+	assertNoOverlap(t, l)
+	assertInBounds(t, l)
+
+	nodes := nodesByID(l)
+	root, father, mother := nodes["I1"], nodes["I100"], nodes["I101"]
+	if father.Generation != -1 || father.Y >= root.Y || father.Y != mother.Y {
+		t.Errorf("父母应位于根节点上方同一行")
+	}
+	if father.X >= mother.X || math.Abs(root.X-(father.X+mother.X)/2) > 1e-9 {
+		t.Errorf("父亲在左、母亲在右，子女居中于父母之下")
+	}
+	if _, ok := nodes["I10"]; ok {
+		t.Errorf("祖先图不应包含后代")
+	}
+}
+
+func TestHourglassLayout(t *testing.T) {
+	l := Hourglass(wideFamily(), DefaultOptions())
+	assertNoOverlap(t, l)
+	assertInBounds(t, l)
+
+	count := 0
+	for _, n := range l.Nodes {
+		if n.IndividualID == 1 {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Fatalf("根节点应只出现一次，实际 %d 次", count)
+	}
+
+	nodes := nodesByID(l)
+	root := nodes["I1"]
+	if nodes["I200"].Generation != -2 || nodes["I200"].Y >= nodes["I100"].Y || nodes["I100"].Y >= root.Y {
+		t.Errorf("祖先应依次位于根节点上方")
+	}
+	if nodes["I10"].Y <= root.Y {
+		t.Errorf("后代应位于根节点下方")
+	}
+	if math.Abs(root.X-(nodes["I100"].X+nodes["I101"].X)/2) > 1e-9 {
+		t.Errorf("祖先部分应以根节点为中心")
+	}
+}
+
+func TestFamilyTreeLayout(t *testing.T) {
+	root := &models.FamilyTreeNode{
+		Individual: spouse(1),
+		Spouse:     spouse(2),
+		Children: []models.FamilyTreeNode{
+			{Individual: spouse(3)},
+			{Individual: spouse(1)}, // 同一人再次出现
+		},
+	}
+	l := FamilyTree(root, Options{})
+	assertNoOverlap(t, l)
+
+	nodes := nodesByID(l)
+	if _, ok := nodes["I1#2"]; !ok {
+		t.Errorf("重复出现的人应使用带序号的节点ID: %v", nodes)
+	}
+	if l.Options != DefaultOptions() {
+		t.Errorf("未设置的尺寸应使用默认值: %+v", l.Options)
+	}
+}
@@ -0,0 +1,367 @@
+// Package lineagechart 生成传统的欧式、苏式世系图
+//
+// 按父系（男性后代）展开后代树，每表五世，第五世有子者在下一表中作为首世重新起表。
+// 人物从右向左排列、文字竖排，每人列出名讳、字号、生卒、配偶、子女和传略。
+// 欧式按世分格、父居诸子正中；苏式不分格，父与长子垂直吊线相连，诸弟依次排在左侧。
+package lineagechart
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"familytree/models"
+	"familytree/pkg/narrative"
+)
+
+// Style 世系图体例
+type Style string
+
+const (
+	StyleOu Style = "ou" // 欧式：五世一表，按世分格
+	StyleSu Style = "su" // 苏式：垂直吊线
+)
+
+// GenerationsPerTable 每表世数
+const GenerationsPerTable = 5
+
+// Options 世系图选项
+type Options struct {
+	Style           Style
+	Title           string
+	FontFamily      string
+	BiographyLength int // 传略最多字数，0 表示不显示
+}
+
+// DefaultFontFamily 默认使用宋体类字体，更接近传统谱牒
+const DefaultFontFamily = `"Noto Serif CJK SC", "Source Han Serif SC", "Songti SC", "SimSun", serif`
+
+// DefaultOptions 默认选项
+func DefaultOptions() Options {
+	return Options{
+		Style:           StyleOu,
+		FontFamily:      DefaultFontFamily,
+		BiographyLength: 60,
+	}
+}
+
+// ParseStyle 解析体例
+func ParseStyle(s string) (Style, bool) {
+	switch style := Style(s); style {
+	case StyleOu, StyleSu:
+		return style, true
+	}
+	return "", false
+}
+
+// Entry 世系图中的一个人
+type Entry struct {
+	IndividualID int
+	Generation   int // 世，图中第一人为一世
+	Name         string
+	Details      []string // 字号、生卒、配偶、子女、传略，每项另起一行
+	Sons         []*Entry
+}
+
+// Table 一张世系表
+type Table struct {
+	Number          int
+	FirstGeneration int
+	LastGeneration  int
+	Width, Height   float64
+	entries         []placed
+	links           [][4]float64 // 连线段 x1, y1, x2, y2
+	rows            int
+}
+
+// placed 已排版的人物
+type placed struct {
+	entry *Entry
+	slot  float64 // 从右向左的位置序号
+	row   int
+	x, y  float64 // 左上角
+	note  string  // 上承、下接某表
+}
+
+// Chart 世系图
+type Chart struct {
+	Title  string
+	Style  Style
+	Tables []*Table
+	opts   Options
+}
+
+// 排版尺寸
+const (
+	margin      = 30.0
+	titleHeight = 56.0
+	labelWidth  = 40.0
+	slotWidth   = 120.0
+	entryWidth  = 108.0
+	rowHeight   = 250.0
+	entryHeight = 220.0
+	nameSize    = 18.0
+	detailSize  = 12.0
+	columnGap   = 4.0
+)
+
+// Build 由 GetHourglass 返回的后代树生成世系图
+func Build(root *models.HourglassNode, opts Options) *Chart {
+	if opts.Style == "" {
+		opts.Style = StyleOu
+	}
+	if opts.FontFamily == "" {
+		opts.FontFamily = DefaultFontFamily
+	}
+	if opts.Title == "" && root != nil {
+		opts.Title = narrative.Surname(root.Individual.FullName) + "氏世系图"
+	}
+
+	chart := &Chart{Title: opts.Title, Style: opts.Style, opts: opts}
+	if root == nil {
+		return chart
+	}
+
+	head := buildEntry(root, 1, opts)
+	heads := []*Entry{head}
+	origin := map[*Entry]int{} // 续表首人来自第几表
+	for len(heads) > 0 {
+		head, heads = heads[0], heads[1:]
+		table := &Table{Number: len(chart.Tables) + 1, FirstGeneration: head.Generation}
+		chart.Tables = append(chart.Tables, table)
+		continued := layoutTable(table, head, opts.Style)
+		table.LastGeneration = head.Generation + table.rows - 1
+
+		if from, ok := origin[head]; ok {
+			table.entries[0].note = fmt.Sprintf("上承第%s表", chineseNumber(from))
+		}
+		for _, index := range continued {
+			next := table.entries[index].entry
+			origin[next] = table.Number
+			table.entries[index].note = fmt.Sprintf("下接第%s表", chineseNumber(table.Number+len(heads)+1))
+			heads = append(heads, next)
+		}
+	}
+	return chart
+}
+
+// buildEntry 递归生成人物条目，只有儿子继续展开，女儿记在父亲条目中
+func buildEntry(node *models.HourglassNode, generation int, opts Options) *Entry {
+	person := node.Individual
+	entry := &Entry{IndividualID: person.IndividualID, Generation: generation, Name: person.FullName}
+
+	var names []string
+	if person.CourtesyName != nil && *person.CourtesyName != "" {
+		names = append(names, "字"+*person.CourtesyName)
+	}
+	if person.ArtName != nil && *person.ArtName != "" {
+		names = append(names, "号"+*person.ArtName)
+	}
+	if len(names) > 0 {
+		entry.Details = append(entry.Details, strings.Join(names, "，"))
+	}
+
+	var life []string
+	if person.BirthDate != nil {
+		life = append(life, "生于"+chineseDate(person.BirthDate.Year(), int(person.BirthDate.Month()), person.BirthDate.Day()))
+	}
+	if person.DeathDate != nil {
+		life = append(life, "卒于"+chineseDate(person.DeathDate.Year(), int(person.DeathDate.Month()), person.DeathDate.Day()))
+	}
+	if len(life) > 0 {
+		entry.Details = append(entry.Details, strings.Join(life, "，"))
+	}
+
+	var spouses, sons, daughters []string
+	for _, family := range node.Families {
+		if family.Spouse != nil {
+			prefix := "配"
+			if len(spouses) > 0 {
+				prefix = "继配"
+			}
+			spouses = append(spouses, prefix+family.Spouse.FullName)
+		}
+		for i := range family.Children {
+			child := &family.Children[i]
+			if child.Individual.Gender == models.GenderFemale {
+				daughters = append(daughters, child.Individual.FullName)
+				continue
+			}
+			sons = append(sons, child.Individual.FullName)
+			entry.Sons = append(entry.Sons, buildEntry(child, generation+1, opts))
+		}
+	}
+	if len(spouses) > 0 {
+		entry.Details = append(entry.Details, strings.Join(spouses, "，"))
+	}
+	if len(sons) > 0 {
+		entry.Details = append(entry.Details, fmt.Sprintf("子%s：%s", chineseNumber(len(sons)), strings.Join(sons, "、")))
+	}
+	if len(daughters) > 0 {
+		entry.Details = append(entry.Details, fmt.Sprintf("女%s：%s", chineseNumber(len(daughters)), strings.Join(daughters, "、")))
+	}
+
+	if biography := strings.TrimSpace(person.Notes); biography != "" && opts.BiographyLength > 0 {
+		if utf8.RuneCountInString(biography) > opts.BiographyLength {
+			biography = string([]rune(biography)[:opts.BiographyLength]) + "…"
+		}
+		entry.Details = append(entry.Details, biography)
+	}
+	return entry
+}
+
+// layoutTable 排版一张表，返回第五世中还有儿子、需要续表的人物下标
+func layoutTable(table *Table, head *Entry, style Style) []int {
+	next := 0.0
+	var continued []int
+
+	var place func(entry *Entry, row int) float64
+	place = func(entry *Entry, row int) float64 {
+		index := len(table.entries)
+		table.entries = append(table.entries, placed{entry: entry, row: row})
+		if row+1 > table.rows {
+			table.rows = row + 1
+		}
+
+		var slot float64
+		switch {
+		case len(entry.Sons) == 0:
+			slot = next
+			next++
+		case row == GenerationsPerTable-1:
+			slot = next
+			next++
+			continued = append(continued, index)
+		default:
+			first, last := 0.0, 0.0
+			for i, son := range entry.Sons {
+				s := place(son, row+1)
+				if i == 0 {
+					first = s
+				}
+				last = s
+			}
+			slot = (first + last) / 2
+			if style == StyleSu {
+				slot = first // 苏式：父与长子同列
+			}
+		}
+		table.entries[index].slot = slot
+		return slot
+	}
+	place(head, 0)
+
+	slots := next
+	table.Width = 2*margin + labelWidth + slots*slotWidth
+	table.Height = titleHeight + float64(table.rows)*rowHeight + margin
+
+	positions := make(map[*Entry]*placed, len(table.entries))
+	for i := range table.entries {
+		p := &table.entries[i]
+		p.x = table.Width - margin - labelWidth - (p.slot+1)*slotWidth + (slotWidth-entryWidth)/2
+		p.y = titleHeight + float64(p.row)*rowHeight
+		positions[p.entry] = p
+	}
+
+	// 父亲底部下垂到横线，再分别垂到各子顶部
+	for _, p := range table.entries {
+		var sons []*placed
+		for _, son := range p.entry.Sons {
+			if s, ok := positions[son]; ok && s.row == p.row+1 {
+				sons = append(sons, s)
+			}
+		}
+		if len(sons) == 0 {
+			continue
+		}
+		cx := p.x + entryWidth/2
+		busY := p.y + entryHeight + (rowHeight-entryHeight)/2
+		minX, maxX := cx, cx
+		table.links = append(table.links, [4]float64{cx, p.y + entryHeight, cx, busY})
+		for _, s := range sons {
+			sx := s.x + entryWidth/2
+			table.links = append(table.links, [4]float64{sx, busY, sx, s.y})
+			if sx < minX {
+				minX = sx
+			}
+			if sx > maxX {
+				maxX = sx
+			}
+		}
+		if maxX > minX {
+			table.links = append(table.links, [4]float64{minX, busY, maxX, busY})
+		}
+	}
+	return continued
+}
+
+// columns 将人物条目拆成竖排的文字列，超出时截断；noteFrom 为续表说明开始的列号
+func columns(p placed) (details []string, noteFrom int) {
+	height, width := entryHeight-8, entryWidth-nameSize-columnGap
+	perColumn := int(height / detailSize)
+	maxColumns := int(width / (detailSize + columnGap))
+
+	split := func(item string) {
+		runes := []rune(item)
+		for len(runes) > 0 {
+			n := perColumn
+			if n > len(runes) {
+				n = len(runes)
+			}
+			details = append(details, string(runes[:n]))
+			runes = runes[n:]
+		}
+	}
+
+	for _, item := range p.entry.Details {
+		split(item)
+	}
+	// 续表说明必须保留，优先截断前面的说明
+	limit := maxColumns
+	if p.note != "" {
+		limit--
+	}
+	if len(details) > limit {
+		details = details[:limit]
+		last := []rune(details[limit-1])
+		if len(last) >= perColumn {
+			last = last[:perColumn-1]
+		}
+		details[limit-1] = string(last) + "…"
+	}
+	noteFrom = len(details)
+	if p.note != "" {
+		details = append(details, p.note)
+	}
+	return details, noteFrom
+}
+
+// chineseDate 中文日期，如 一九二〇年三月十五日
+func chineseDate(year, month, day int) string {
+	digits := []rune("〇一二三四五六七八九")
+	var b strings.Builder
+	for _, r := range fmt.Sprintf("%d", year) {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(digits[r-'0'])
+		}
+	}
+	return fmt.Sprintf("%s年%s月%s日", b.String(), chineseNumber(month), chineseNumber(day))
+}
+
+// chineseNumber 将 1-99 的整数转为中文数字
+func chineseNumber(n int) string {
+	digits := []string{"零", "一", "二", "三", "四", "五", "六", "七", "八", "九"}
+	switch {
+	case n < 0 || n >= 100:
+		return fmt.Sprintf("%d", n)
+	case n < 10:
+		return digits[n]
+	case n == 10:
+		return "十"
+	case n < 20:
+		return "十" + digits[n%10]
+	case n%10 == 0:
+		return digits[n/10] + "十"
+	}
+	return digits[n/10] + "十" + digits[n%10]
+}
@@ -0,0 +1,139 @@
+package lineagechart
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"familytree/models"
+)
+
+// chain 生成 depth 代的父系树，每代有两个儿子和一个女儿，只有长子继续向下
+func chain(id *int, depth int) models.HourglassNode {
+	*id++
+	node := models.HourglassNode{Individual: models.Individual{
+		IndividualID: *id,
+		FullName:     fmt.Sprintf("张%d", *id),
+		Gender:       models.GenderMale,
+	}}
+	if depth <= 1 {
+		return node
+	}
+
+	eldest := chain(id, depth-1)
+	*id++
+	younger := models.HourglassNode{Individual: models.Individual{IndividualID: *id, FullName: fmt.Sprintf("张%d", *id), Gender: models.GenderMale}}
+	*id++
+	daughter := models.HourglassNode{Individual: models.Individual{IndividualID: *id, FullName: fmt.Sprintf("张%d", *id), Gender: models.GenderFemale}}
+	node.Families = []models.HourglassFamily{{
+		Spouse:   &models.Individual{FullName: "李氏"},
+		Children: []models.HourglassNode{eldest, younger, daughter},
+	}}
+	return node
+}
+
+func TestBuildPaginatesFiveGenerationsPerTable(t *testing.T) {
+	id := 0
+	root := chain(&id, 9)
+	courtesy, born := "子明", time.Date(1920, 3, 15, 0, 0, 0, 0, time.UTC)
+	root.Individual.CourtesyName = &courtesy
+	root.Individual.BirthDate = &born
+
+	chart := Build(&root, DefaultOptions())
+	if chart.Title != "张氏世系图" {
+		t.Errorf("标题错误: %s", chart.Title)
+	}
+	if len(chart.Tables) != 2 {
+		t.Fatalf("九世应分为两表，实际 %d 表", len(chart.Tables))
+	}
+
+	first, second := chart.Tables[0], chart.Tables[1]
+	if first.FirstGeneration != 1 || first.LastGeneration != 5 || second.FirstGeneration != 5 || second.LastGeneration != 9 {
+		t.Errorf("世次范围错误: %d-%d, %d-%d", first.FirstGeneration, first.LastGeneration, second.FirstGeneration, second.LastGeneration)
+	}
+
+	// 第五世在两表中各出现一次，分别注明下接和上承
+	var down, up string
+	for _, p := range first.entries {
+		if p.row == 4 && p.note != "" {
+			down = p.note
+		}
+	}
+	up = second.entries[0].note
+	if down != "下接第二表" || up != "上承第一表" {
+		t.Errorf("续表说明错误: %q %q", down, up)
+	}
+
+	details := strings.Join(first.entries[0].entry.Details, "|")
+	for _, want := range []string{"字子明", "生于一九二〇年三月十五日", "配李氏", "子二：", "女一："} {
+		if !strings.Contains(details, want) {
+			t.Errorf("条目缺少 %q: %s", want, details)
+		}
+	}
+
+	daughterID := root.Families[0].Children[2].Individual.IndividualID
+	for _, table := range chart.Tables {
+		for _, p := range table.entries {
+			if p.entry.IndividualID == daughterID {
+				t.Errorf("女儿不应单独列出")
+			}
+		}
+	}
+}
+
+func TestSuStyleAlignsEldestSon(t *testing.T) {
+	id := 0
+	root := chain(&id, 3)
+
+	opts := DefaultOptions()
+	opts.Style = StyleSu
+	su := Build(&root, opts).Tables[0]
+	if head, eldest := su.entries[0], su.entries[1]; head.x != eldest.x {
+		t.Errorf("苏式父与长子应同列: %v %v", head.x, eldest.x)
+	}
+
+	ou := Build(&root, DefaultOptions()).Tables[0]
+	if head, eldest := ou.entries[0], ou.entries[1]; head.x == eldest.x || head.x <= ou.entries[len(ou.entries)-1].x {
+		t.Errorf("欧式父应居诸子正中")
+	}
+}
+
+func TestWriteSVGAndHTML(t *testing.T) {
+	id := 0
+	root := chain(&id, 7)
+	root.Individual.Notes = "<创修族谱>"
+
+	for _, style := range []Style{StyleOu, StyleSu} {
+		opts := DefaultOptions()
+		opts.Style = style
+		chart := Build(&root, opts)
+
+		var svg bytes.Buffer
+		if err := chart.WriteSVG(&svg); err != nil {
+			t.Fatal(err)
+		}
+		decoder := xml.NewDecoder(bytes.NewReader(svg.Bytes()))
+		for {
+			if _, err := decoder.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: SVG 不是合法的 XML: %v", style, err)
+			}
+		}
+		if !strings.Contains(svg.String(), "vertical-rl") || !strings.Contains(svg.String(), "第二表") {
+			t.Errorf("%s: SVG 缺少竖排文字或续表", style)
+		}
+
+		var page bytes.Buffer
+		if err := chart.WriteHTML(&page); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(page.String(), "&lt;创修族谱&gt;") || !strings.Contains(page.String(), "writing-mode:vertical-rl") {
+			t.Errorf("%s: HTML 缺少转义后的传略或竖排样式", style)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package lineagechart
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+const (
+	inkColor  = "#1f2937"
+	ruleColor = "#9ca3af"
+	noteColor = "#6b7280"
+)
+
+// verticalText 竖排文字的属性，同时提供 SVG 1.1 和 CSS 写法以兼容不同的渲染器
+const verticalText = `writing-mode="tb-rl" style="writing-mode:vertical-rl;text-orientation:upright"`
+
+// tableTitle 表头，如 第一表 一世至五世
+func (t *Table) tableTitle() string {
+	if t.FirstGeneration == t.LastGeneration {
+		return fmt.Sprintf("第%s表　%s世", chineseNumber(t.Number), chineseNumber(t.FirstGeneration))
+	}
+	return fmt.Sprintf("第%s表　%s世至%s世", chineseNumber(t.Number),
+		chineseNumber(t.FirstGeneration), chineseNumber(t.LastGeneration))
+}
+
+// WriteSVG 输出单个 SVG，各表自上而下依次排列
+func (c *Chart) WriteSVG(w io.Writer) error {
+	width, height := 0.0, titleHeight
+	for _, t := range c.Tables {
+		if t.Width > width {
+			width = t.Width
+		}
+		height += t.Height
+	}
+	if width == 0 {
+		width = 2 * margin
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(&out, `<svg xmlns="http://www.w3.org/2000/svg" width="%s" height="%s" viewBox="0 0 %s %s">`+"\n",
+		num(width), num(height), num(width), num(height))
+	fmt.Fprintf(&out, "<style>text{font-family:%s;fill:%s}.note{fill:%s}.link{stroke:%s;stroke-width:1.2}.rule{stroke:%s;stroke-width:0.8;fill:none}</style>\n",
+		html.EscapeString(c.opts.FontFamily), inkColor, noteColor, inkColor, ruleColor)
+	fmt.Fprintf(&out, `<rect width="100%%" height="100%%" fill="#fffdf7"/>`+"\n")
+	fmt.Fprintf(&out, `<text x="%s" y="%s" font-size="24" text-anchor="middle">%s</text>`+"\n",
+		num(width/2), num(titleHeight*0.65), html.EscapeString(c.Title))
+
+	offset := titleHeight
+	for _, t := range c.Tables {
+		fmt.Fprintf(&out, `<g transform="translate(%s,%s)">`+"\n", num(width-t.Width), num(offset))
+		c.writeTableSVG(&out, t)
+		out.WriteString("</g>\n")
+		offset += t.Height
+	}
+	out.WriteString("</svg>\n")
+
+	_, err := out.WriteTo(w)
+	return err
+}
+
+// writeTableSVG 输出一张表的图形，坐标相对表的左上角
+func (c *Chart) writeTableSVG(out *bytes.Buffer, t *Table) {
+	c.writeFrame(out, t, true)
+	for _, link := range t.links {
+		fmt.Fprintf(out, `<line class="link" x1="%s" y1="%s" x2="%s" y2="%s"/>`+"\n",
+			num(link[0]), num(link[1]), num(link[2]), num(link[3]))
+	}
+
+	for _, p := range t.entries {
+		details, noteFrom := columns(p)
+		x := p.x + entryWidth - nameSize/2
+		fmt.Fprintf(out, `<text x="%s" y="%s" font-size="%s" font-weight="bold" %s>%s</text>`+"\n",
+			num(x), num(p.y+4), num(nameSize), verticalText, html.EscapeString(p.entry.Name))
+		x -= nameSize/2 + columnGap + detailSize/2
+		for i, column := range details {
+			class := ""
+			if i >= noteFrom {
+				class = ` class="note"`
+			}
+			fmt.Fprintf(out, `<text x="%s" y="%s" font-size="%s"%s %s>%s</text>`+"\n",
+				num(x), num(p.y+4), num(detailSize), class, verticalText, html.EscapeString(column))
+			x -= detailSize + columnGap
+		}
+	}
+}
+
+// writeFrame 输出欧式的外框和分世横线，withText 时同时输出表头和右侧世次标签
+func (c *Chart) writeFrame(out *bytes.Buffer, t *Table, withText bool) {
+
+	top := titleHeight - (rowHeight-entryHeight)/2
+	bottom := top + float64(t.rows)*rowHeight
+	labelX := t.Width - margin - labelWidth
+	if c.Style == StyleOu {
+		fmt.Fprintf(out, `<rect class="rule" x="%s" y="%s" width="%s" height="%s"/>`+"\n",
+			num(margin), num(top), num(t.Width-2*margin), num(bottom-top))
+		fmt.Fprintf(out, `<line class="rule" x1="%s" y1="%s" x2="%s" y2="%s"/>`+"\n",
+			num(labelX), num(top), num(labelX), num(bottom))
+		for row := 1; row < t.rows; row++ {
+			y := top + float64(row)*rowHeight
+			fmt.Fprintf(out, `<line class="rule" x1="%s" y1="%s" x2="%s" y2="%s"/>`+"\n",
+				num(margin), num(y), num(t.Width-margin), num(y))
+		}
+	}
+	if !withText {
+		return
+	}
+	fmt.Fprintf(out, `<text x="%s" y="%s" font-size="16" text-anchor="end">%s</text>`+"\n",
+		num(t.Width-margin), num(titleHeight*0.6), html.EscapeString(t.tableTitle()))
+	for row := 0; row < t.rows; row++ {
+		fmt.Fprintf(out, `<text x="%s" y="%s" font-size="16" %s>%s世</text>`+"\n",
+			num(labelX+labelWidth/2), num(top+float64(row)*rowHeight+12), verticalText,
+			chineseNumber(t.FirstGeneration+row))
+	}
+}
+
+// WriteHTML 输出 HTML 页面：连线和表格用内嵌 SVG，人物文字用 CSS 竖排，便于复制和检索
+func (c *Chart) WriteHTML(w io.Writer) error {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "<!DOCTYPE html>\n<html lang=\"zh-CN\">\n<head>\n<meta charset=\"UTF-8\">\n<title>%s</title>\n", html.EscapeString(c.Title))
+	fmt.Fprintf(&out, `<style>
+body{margin:0;padding:24px;background:#fffdf7;color:%s;font-family:%s}
+h1{text-align:center;font-size:28px;letter-spacing:8px}
+.table{position:relative;margin:0 auto 48px;page-break-after:always}
+.table h2{position:absolute;right:%spx;top:0;margin:0;font-size:16px;font-weight:normal}
+.table svg{position:absolute;left:0;top:0}
+.entry{position:absolute;writing-mode:vertical-rl;text-orientation:upright;overflow:hidden;font-size:%spx;line-height:%spx}
+.entry .name{font-size:%spx;font-weight:bold}
+.entry .note{color:%s}
+.generation{position:absolute;writing-mode:vertical-rl;text-orientation:upright;font-size:16px}
+</style>
+</head>
+<body>
+`, inkColor, html.EscapeString(c.opts.FontFamily), num(margin), num(detailSize), num(detailSize+columnGap), num(nameSize), noteColor)
+	fmt.Fprintf(&out, "<h1>%s</h1>\n", html.EscapeString(c.Title))
+
+	for _, t := range c.Tables {
+		fmt.Fprintf(&out, `<section class="table" style="width:%spx;height:%spx">`+"\n", num(t.Width), num(t.Height))
+		fmt.Fprintf(&out, "<h2>%s</h2>\n", html.EscapeString(t.tableTitle()))
+
+		fmt.Fprintf(&out, `<svg width="%s" height="%s" viewBox="0 0 %s %s"><style>.link{stroke:%s;stroke-width:1.2}.rule{stroke:%s;stroke-width:0.8;fill:none}</style>`+"\n",
+			num(t.Width), num(t.Height), num(t.Width), num(t.Height), inkColor, ruleColor)
+		c.writeFrame(&out, t, false) // 文字部分由 HTML 输出
+		for _, link := range t.links {
+			fmt.Fprintf(&out, `<line class="link" x1="%s" y1="%s" x2="%s" y2="%s"/>`+"\n",
+				num(link[0]), num(link[1]), num(link[2]), num(link[3]))
+		}
+		out.WriteString("</svg>\n")
+
+		top := titleHeight - (rowHeight-entryHeight)/2
+		for row := 0; row < t.rows; row++ {
+			fmt.Fprintf(&out, `<div class="generation" style="left:%spx;top:%spx">%s世</div>`+"\n",
+				num(t.Width-margin-labelWidth/2-8), num(top+float64(row)*rowHeight+4), chineseNumber(t.FirstGeneration+row))
+		}
+
+		for _, p := range t.entries {
+			fmt.Fprintf(&out, `<div class="entry" data-id="%d" style="left:%spx;top:%spx;width:%spx;height:%spx">`,
+				p.entry.IndividualID, num(p.x), num(p.y), num(entryWidth), num(entryHeight))
+			fmt.Fprintf(&out, `<div class="name">%s</div>`, html.EscapeString(p.entry.Name))
+			for _, detail := range p.entry.Details {
+				fmt.Fprintf(&out, `<div>%s</div>`, html.EscapeString(detail))
+			}
+			if p.note != "" {
+				fmt.Fprintf(&out, `<div class="note">%s</div>`, html.EscapeString(p.note))
+			}
+			out.WriteString("</div>\n")
+		}
+		out.WriteString("</section>\n")
+	}
+	out.WriteString("</body>\n</html>\n")
+
+	_, err := out.WriteTo(w)
+	return err
+}
+
+// num 格式化坐标，保留两位小数并去掉多余的零
+func num(v float64) string {
+	s := fmt.Sprintf("%.2f", v)
+	s = strings.TrimRight(s, "0")
+	s = strings.TrimSuffix(s, ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
@@ -0,0 +1,225 @@
+// Package lunar 公历与农历（夏历）互相换算
+//
+// 采用 1900—2100 年的农历数据表，每年一个编码：低 4 位为闰月月份（0 表示无闰月），
+// 第 5—16 位依次表示正月到十二月是否为大月（30 天），第 17 位表示闰月是否为大月。
+// 表的起点为 1900 年正月初一，即公历 1900-01-31。
+package lunar
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 支持的农历年份范围
+const (
+	MinYear = 1900
+	MaxYear = 2100
+)
+
+// ErrOutOfRange 日期超出农历数据表的范围
+var ErrOutOfRange = errors.New("日期超出农历换算范围（1900—2100 年）")
+
+// yearInfo 1900—2100 年农历数据
+var yearInfo = [...]int{
+	0x04bd8, 0x04ae0, 0x0a570, 0x054d5, 0x0d260, 0x0d950, 0x16554, 0x056a0, 0x09ad0, 0x055d2, // 1900—1909
+	0x04ae0, 0x0a5b6, 0x0a4d0, 0x0d250, 0x1d255, 0x0b540, 0x0d6a0, 0x0ada2, 0x095b0, 0x14977, // 1910—1919
+	0x04970, 0x0a4b0, 0x0b4b5, 0x06a50, 0x06d40, 0x1ab54, 0x02b60, 0x09570, 0x052f2, 0x04970, // 1920—1929
+	0x06566, 0x0d4a0, 0x0ea50, 0x16a95, 0x05ad0, 0x02b60, 0x186e3, 0x092e0, 0x1c8d7, 0x0c950, // 1930—1939
+	0x0d4a0, 0x1d8a6, 0x0b550, 0x056a0, 0x1a5b4, 0x025d0, 0x092d0, 0x0d2b2, 0x0a950, 0x0b557, // 1940—1949
+	0x06ca0, 0x0b550, 0x15355, 0x04da0, 0x0a5b0, 0x14573, 0x052b0, 0x0a9a8, 0x0e950, 0x06aa0, // 1950—1959
+	0x0aea6, 0x0ab50, 0x04b60, 0x0aae4, 0x0a570, 0x05260, 0x0f263, 0x0d950, 0x05b57, 0x056a0, // 1960—1969
+	0x096d0, 0x04dd5, 0x04ad0, 0x0a4d0, 0x0d4d4, 0x0d250, 0x0d558, 0x0b540, 0x0b6a0, 0x195a6, // 1970—1979
+	0x095b0, 0x049b0, 0x0a974, 0x0a4b0, 0x0b27a, 0x06a50, 0x06d40, 0x0af46, 0x0ab60, 0x09570, // 1980—1989
+	0x04af5, 0x04970, 0x064b0, 0x074a3, 0x0ea50, 0x06b58, 0x05ac0, 0x0ab60, 0x096d5, 0x092e0, // 1990—1999
+	0x0c960, 0x0d954, 0x0d4a0, 0x0da50, 0x07552, 0x056a0, 0x0abb7, 0x025d0, 0x092d0, 0x0cab5, // 2000—2009
+	0x0a950, 0x0b4a0, 0x0baa4, 0x0ad50, 0x055d9, 0x04ba0, 0x0a5b0, 0x15176, 0x052b0, 0x0a930, // 2010—2019
+	0x07954, 0x06aa0, 0x0ad50, 0x05b52, 0x04b60, 0x0a6e6, 0x0a4e0, 0x0d260, 0x0ea65, 0x0d530, // 2020—2029
+	0x05aa0, 0x076a3, 0x096d0, 0x04afb, 0x04ad0, 0x0a4d0, 0x1d0b6, 0x0d250, 0x0d520, 0x0dd45, // 2030—2039
+	0x0b5a0, 0x056d0, 0x055b2, 0x049b0, 0x0a577, 0x0a4b0, 0x0aa50, 0x1b255, 0x06d20, 0x0ada0, // 2040—2049
+	0x14b63, 0x09370, 0x049f8, 0x04970, 0x064b0, 0x168a6, 0x0ea50, 0x06b20, 0x1a6c4, 0x0aae0, // 2050—2059
+	0x092e0, 0x0d2e3, 0x0c960, 0x0d557, 0x0d4a0, 0x0da50, 0x05d55, 0x056a0, 0x0a6d0, 0x055d4, // 2060—2069
+	0x052d0, 0x0a9b8, 0x0a950, 0x0b4a0, 0x0b6a6, 0x0ad50, 0x055a0, 0x0aba4, 0x0a5b0, 0x052b0, // 2070—2079
+	0x0b273, 0x06930, 0x07337, 0x06aa0, 0x0ad50, 0x14b55, 0x04b60, 0x0a570, 0x054e4, 0x0d160, // 2080—2089
+	0x0e968, 0x0d520, 0x0daa0, 0x16aa6, 0x056d0, 0x04ae0, 0x0a9d4, 0x0a2d0, 0x0d150, 0x0f252, // 2090—2099
+	0x0d520, // 2100
+}
+
+// epoch 1900 年正月初一
+var epoch = time.Date(1900, 1, 31, 0, 0, 0, 0, time.UTC)
+
+// Date 农历日期
+type Date struct {
+	Year  int  `json:"year"`
+	Month int  `json:"month"`
+	Day   int  `json:"day"`
+	Leap  bool `json:"leap"` // 闰月
+}
+
+// LeapMonth 该年闰几月，没有闰月返回 0
+func LeapMonth(year int) int {
+	if year < MinYear || year > MaxYear {
+		return 0
+	}
+	return yearInfo[year-MinYear] & 0xf
+}
+
+// MonthDays 该年某月的天数（29 或 30），月份不存在时返回 0
+func MonthDays(year, month int, leap bool) int {
+	if year < MinYear || year > MaxYear || month < 1 || month > 12 {
+		return 0
+	}
+	info := yearInfo[year-MinYear]
+	if leap {
+		if info&0xf != month {
+			return 0
+		}
+		if info&0x10000 != 0 {
+			return 30
+		}
+		return 29
+	}
+	if info&(0x10000>>month) != 0 {
+		return 30
+	}
+	return 29
+}
+
+// YearDays 该年的总天数
+func YearDays(year int) int {
+	days := 0
+	for month := 1; month <= 12; month++ {
+		days += MonthDays(year, month, false)
+	}
+	if leap := LeapMonth(year); leap > 0 {
+		days += MonthDays(year, leap, true)
+	}
+	return days
+}
+
+// FromSolar 公历日期换算为农历，只使用 t 的年月日
+func FromSolar(t time.Time) (Date, error) {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	offset := int(day.Sub(epoch).Hours() / 24)
+	if offset < 0 {
+		return Date{}, ErrOutOfRange
+	}
+
+	year := MinYear
+	for ; year <= MaxYear; year++ {
+		days := YearDays(year)
+		if offset < days {
+			break
+		}
+		offset -= days
+	}
+	if year > MaxYear {
+		return Date{}, ErrOutOfRange
+	}
+
+	leap := LeapMonth(year)
+	for month := 1; month <= 12; month++ {
+		days := MonthDays(year, month, false)
+		if offset < days {
+			return Date{Year: year, Month: month, Day: offset + 1}, nil
+		}
+		offset -= days
+		if month == leap {
+			days = MonthDays(year, month, true)
+			if offset < days {
+				return Date{Year: year, Month: month, Day: offset + 1, Leap: true}, nil
+			}
+			offset -= days
+		}
+	}
+	return Date{}, ErrOutOfRange
+}
+
+// ToSolar 农历日期换算为公历（UTC 零点）
+func ToSolar(d Date) (time.Time, error) {
+	if d.Year < MinYear || d.Year > MaxYear {
+		return time.Time{}, ErrOutOfRange
+	}
+	days := MonthDays(d.Year, d.Month, d.Leap)
+	if days == 0 || d.Day < 1 || d.Day > days {
+		return time.Time{}, fmt.Errorf("农历 %d 年没有%s", d.Year, d.String())
+	}
+
+	offset := 0
+	for year := MinYear; year < d.Year; year++ {
+		offset += YearDays(year)
+	}
+	leap := LeapMonth(d.Year)
+	for month := 1; month < d.Month; month++ {
+		offset += MonthDays(d.Year, month, false)
+		if month == leap {
+			offset += MonthDays(d.Year, month, true)
+		}
+	}
+	if d.Leap {
+		offset += MonthDays(d.Year, d.Month, false)
+	}
+	return epoch.AddDate(0, 0, offset+d.Day-1), nil
+}
+
+// Anniversary 农历纪念日在 year 年对应的日期：闰月出生的按当年的正常月份计算，
+// 当月只有 29 天时三十改为廿九
+func Anniversary(d Date, year int) (Date, error) {
+	if year < MinYear || year > MaxYear {
+		return Date{}, ErrOutOfRange
+	}
+	day := d.Day
+	if days := MonthDays(year, d.Month, false); day > days {
+		day = days
+	}
+	return Date{Year: year, Month: d.Month, Day: day}, nil
+}
+
+var (
+	monthNames = [...]string{"正", "二", "三", "四", "五", "六", "七", "八", "九", "十", "冬", "腊"}
+	dayTens    = [...]string{"初", "十", "廿", "三"}
+	digits     = [...]string{"", "一", "二", "三", "四", "五", "六", "七", "八", "九", "十"}
+	stems      = [...]string{"甲", "乙", "丙", "丁", "戊", "己", "庚", "辛", "壬", "癸"}
+	branches   = [...]string{"子", "丑", "寅", "卯", "辰", "巳", "午", "未", "申", "酉", "戌", "亥"}
+)
+
+// MonthName 月份名称，如“正月”“闰四月”“腊月”
+func (d Date) MonthName() string {
+	if d.Month < 1 || d.Month > 12 {
+		return ""
+	}
+	name := monthNames[d.Month-1] + "月"
+	if d.Leap {
+		name = "闰" + name
+	}
+	return name
+}
+
+// DayName 日的名称，如“初一”“十五”“廿九”“三十”
+func (d Date) DayName() string {
+	switch {
+	case d.Day < 1 || d.Day > 30:
+		return ""
+	case d.Day == 10:
+		return "初十"
+	case d.Day == 20:
+		return "二十"
+	case d.Day == 30:
+		return "三十"
+	}
+	return dayTens[d.Day/10] + digits[d.Day%10]
+}
+
+// String 月日的中文写法，如“八月十五”
+func (d Date) String() string {
+	return d.MonthName() + d.DayName()
+}
+
+// YearName 干支纪年，如“甲子年”
+func YearName(year int) string {
+	n := (year - 4) % 60
+	if n < 0 {
+		n += 60
+	}
+	return stems[n%10] + branches[n%12] + "年"
+}
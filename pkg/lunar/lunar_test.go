@@ -0,0 +1,100 @@
+package lunar
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFromSolar(t *testing.T) {
+	cases := []struct {
+		solar string
+		want  Date
+		text  string
+	}{
+		{"1900-01-31", Date{Year: 1900, Month: 1, Day: 1}, "正月初一"},
+		{"1949-10-01", Date{Year: 1949, Month: 8, Day: 10}, "八月初十"},
+		{"2000-02-05", Date{Year: 2000, Month: 1, Day: 1}, "正月初一"},
+		{"2020-01-25", Date{Year: 2020, Month: 1, Day: 1}, "正月初一"},
+		{"2020-05-23", Date{Year: 2020, Month: 4, Day: 1, Leap: true}, "闰四月初一"},
+		{"2023-03-22", Date{Year: 2023, Month: 2, Day: 1, Leap: true}, "闰二月初一"},
+		{"2024-02-09", Date{Year: 2023, Month: 12, Day: 30}, "腊月三十"},
+		{"2025-10-06", Date{Year: 2025, Month: 8, Day: 15}, "八月十五"},
+		{"2026-02-17", Date{Year: 2026, Month: 1, Day: 1}, "正月初一"},
+	}
+	for _, c := range cases {
+		solar, _ := time.Parse("2006-01-02", c.solar)
+		got, err := FromSolar(solar)
+		if err != nil {
+			t.Fatalf("%s: %v", c.solar, err)
+		}
+		if got != c.want {
+			t.Errorf("%s: got %+v, want %+v", c.solar, got, c.want)
+		}
+		if got.String() != c.text {
+			t.Errorf("%s: got %q, want %q", c.solar, got.String(), c.text)
+		}
+
+		back, err := ToSolar(got)
+		if err != nil {
+			t.Fatalf("%s: %v", c.solar, err)
+		}
+		if !back.Equal(solar) {
+			t.Errorf("%s: round trip gave %s", c.solar, back.Format("2006-01-02"))
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	day := time.Date(1900, 1, 31, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2100, 12, 31, 0, 0, 0, 0, time.UTC)
+	prev := Date{}
+	for ; !day.After(end); day = day.AddDate(0, 0, 1) {
+		d, err := FromSolar(day)
+		if err != nil {
+			t.Fatalf("%s: %v", day.Format("2006-01-02"), err)
+		}
+		if d == prev {
+			t.Fatalf("%s: repeated %+v", day.Format("2006-01-02"), d)
+		}
+		prev = d
+		back, err := ToSolar(d)
+		if err != nil || !back.Equal(day) {
+			t.Fatalf("%s: round trip gave %s, %v", day.Format("2006-01-02"), back.Format("2006-01-02"), err)
+		}
+	}
+
+	if _, err := FromSolar(time.Date(1899, 12, 31, 0, 0, 0, 0, time.UTC)); err != ErrOutOfRange {
+		t.Errorf("expected ErrOutOfRange, got %v", err)
+	}
+}
+
+func TestAnniversary(t *testing.T) {
+	// 2020 年闰四月出生，2021 年按四月计算
+	got, err := Anniversary(Date{Year: 2020, Month: 4, Day: 1, Leap: true}, 2021)
+	if err != nil || got != (Date{Year: 2021, Month: 4, Day: 1}) {
+		t.Errorf("leap month: got %+v, %v", got, err)
+	}
+
+	// 腊月三十出生，当年腊月只有 29 天时改为廿九
+	for year := 2024; year <= 2030; year++ {
+		got, err := Anniversary(Date{Year: 2023, Month: 12, Day: 30}, year)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Day != MonthDays(year, 12, false) {
+			t.Errorf("%d: got %+v", year, got)
+		}
+		if _, err := ToSolar(got); err != nil {
+			t.Errorf("%d: %v", year, err)
+		}
+	}
+}
+
+func TestYearName(t *testing.T) {
+	cases := map[int]string{1984: "甲子年", 2024: "甲辰年", 1949: "己丑年", 1900: "庚子年"}
+	for year, want := range cases {
+		if got := YearName(year); got != want {
+			t.Errorf("%d: got %s, want %s", year, got, want)
+		}
+	}
+}
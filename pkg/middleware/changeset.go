@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+)
+
+// ChangeSetContextKey 变更集上下文键
+const ChangeSetContextKey ContextKey = "change_set"
+
+// ChangeSetHeader 响应头中的变更集ID，客户端可据此查询或撤销本次请求的修改
+const ChangeSetHeader = "X-Change-Set"
+
+// ChangeSet 为每个请求分配变更集ID，同一请求中的全部修改记在同一个变更集下
+func ChangeSet(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		changeSet, err := NewChangeSetID()
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		ctx := context.WithValue(r.Context(), ChangeSetContextKey, changeSet)
+		w.Header().Set(ChangeSetHeader, changeSet)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// WithChangeSet 分配新的变更集ID，供命令行工具和后台任务在 HTTP 请求之外使用
+func WithChangeSet(ctx context.Context) (context.Context, error) {
+	changeSet, err := NewChangeSetID()
+	if err != nil {
+		return ctx, err
+	}
+	return context.WithValue(ctx, ChangeSetContextKey, changeSet), nil
+}
+
+// GetChangeSetFromContext 从上下文获取变更集ID
+func GetChangeSetFromContext(ctx context.Context) (string, bool) {
+	changeSet, ok := ctx.Value(ChangeSetContextKey).(string)
+	return changeSet, ok && changeSet != ""
+}
+
+// NewChangeSetID 生成随机的变更集ID
+func NewChangeSetID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("生成变更集ID失败: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
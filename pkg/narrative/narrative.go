@@ -0,0 +1,186 @@
+// Package narrative 提供生成中文世系叙述的文字工具：事件名称、日期、生卒年和句子拼接
+package narrative
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"familytree/models"
+)
+
+// eventNames 常见事件类型的中文名称，其余类型原样输出
+var eventNames = map[string]string{
+	"birth":       "出生",
+	"death":       "逝世",
+	"burial":      "安葬",
+	"marriage":    "结婚",
+	"divorce":     "离婚",
+	"baptism":     "受洗",
+	"christening": "受洗",
+	"residence":   "居住",
+	"education":   "求学",
+	"graduation":  "毕业",
+	"occupation":  "任职",
+	"military":    "从军",
+	"immigration": "迁入",
+	"emigration":  "迁出",
+	"retirement":  "退休",
+	"census":      "人口普查",
+	"career":      "任职",
+	"business":    "经商",
+	"achievement": "成就",
+}
+
+// EventName 事件类型名称
+func EventName(eventType string) string {
+	if name, ok := eventNames[strings.ToLower(eventType)]; ok {
+		return name
+	}
+	return eventType
+}
+
+// FormatDate 中文日期，如 1920年3月15日
+func FormatDate(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d年%d月%d日", t.Year(), int(t.Month()), t.Day())
+}
+
+// Lifespan 生卒年，如 1920–1990、1920–、–1990
+func Lifespan(person *models.Individual) string {
+	if person.BirthDate == nil && person.DeathDate == nil {
+		return ""
+	}
+	var birth, death string
+	if person.BirthDate != nil {
+		birth = fmt.Sprintf("%d", person.BirthDate.Year())
+	}
+	if person.DeathDate != nil {
+		death = fmt.Sprintf("%d", person.DeathDate.Year())
+	}
+	return birth + "–" + death
+}
+
+// GenderName 性别
+func GenderName(gender models.Gender) string {
+	switch gender {
+	case models.GenderMale:
+		return "男"
+	case models.GenderFemale:
+		return "女"
+	}
+	return "未详"
+}
+
+// ChildWord 子女称谓
+func ChildWord(gender models.Gender) string {
+	switch gender {
+	case models.GenderMale:
+		return "子"
+	case models.GenderFemale:
+		return "女"
+	}
+	return "子女"
+}
+
+// AlternateNames 字号，如 字子明，号东山
+func AlternateNames(person *models.Individual) string {
+	var names []string
+	if person.CourtesyName != nil && *person.CourtesyName != "" {
+		names = append(names, "字"+*person.CourtesyName)
+	}
+	if person.ArtName != nil && *person.ArtName != "" {
+		names = append(names, "号"+*person.ArtName)
+	}
+	return strings.Join(names, "，")
+}
+
+// Dated 组合日期和地点，如 1920年3月15日生于北京
+func Dated(date *time.Time, place, verb string) string {
+	switch d := FormatDate(date); {
+	case d != "" && place != "":
+		return d + verb + "于" + place
+	case d != "":
+		return d + verb
+	case place != "":
+		return verb + "于" + place
+	}
+	return ""
+}
+
+// ChineseNumber 将 1-99 的整数转为中文数字
+func ChineseNumber(n int) string {
+	digits := []string{"零", "一", "二", "三", "四", "五", "六", "七", "八", "九"}
+	switch {
+	case n < 0 || n >= 100:
+		return fmt.Sprintf("%d", n)
+	case n < 10:
+		return digits[n]
+	case n == 10:
+		return "十"
+	case n < 20:
+		return "十" + digits[n%10]
+	case n%10 == 0:
+		return digits[n/10] + "十"
+	}
+	return digits[n/10] + "十" + digits[n%10]
+}
+
+// Sentence 用中文逗号连接非空片段并以句号结尾
+func Sentence(parts ...string) string {
+	var kept []string
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			kept = append(kept, part)
+		}
+	}
+	if len(kept) == 0 {
+		return ""
+	}
+	s := strings.Join(kept, "，")
+	if !strings.HasSuffix(s, "。") {
+		s += "。"
+	}
+	return s
+}
+
+// SourceText 来源引用文字，如 张某，《张氏族谱》，1936年，国家图书馆藏，卷三。
+func SourceText(src *models.Source, page string) string {
+	var parts []string
+	if src.Author != "" {
+		parts = append(parts, src.Author)
+	}
+	parts = append(parts, "《"+src.Title+"》")
+	if src.Publisher != "" {
+		parts = append(parts, src.Publisher)
+	}
+	if src.PublicationYear != nil {
+		parts = append(parts, fmt.Sprintf("%d年", *src.PublicationYear))
+	}
+	if src.Location != "" {
+		parts = append(parts, src.Location+"藏")
+	}
+	return Sentence(append(parts, page)...)
+}
+
+// CompoundSurnames 常见复姓
+var CompoundSurnames = []string{"欧阳", "司马", "诸葛", "上官", "东方", "皇甫", "令狐", "慕容", "司徒", "夏侯", "尉迟", "长孙", "宇文", "公孙", "端木"}
+
+// Surname 取姓氏，常见复姓取前两字
+func Surname(fullName string) string {
+	runes := []rune(strings.TrimSpace(fullName))
+	if len(runes) == 0 {
+		return ""
+	}
+	if len(runes) > 2 {
+		prefix := string(runes[:2])
+		for _, compound := range CompoundSurnames {
+			if prefix == compound {
+				return prefix
+			}
+		}
+	}
+	return string(runes[:1])
+}
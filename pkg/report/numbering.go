@@ -0,0 +1,37 @@
+package report
+
+import (
+	"strconv"
+	"strings"
+)
+
+// henryDigit Henry 编号中第 k 个子女的一位：1-9 原样，10 为 X，其后依次为 A、B、C……
+func henryDigit(k int) string {
+	switch {
+	case k < 10:
+		return strconv.Itoa(k)
+	case k == 10:
+		return "X"
+	case k-11 < 26:
+		return string(rune('A' + k - 11))
+	}
+	// 极少见的超大家庭，用括号保留数字避免歧义
+	return "(" + strconv.Itoa(k) + ")"
+}
+
+// roman 小写罗马数字，用于子女排行
+func roman(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	values := []int{1000, 900, 500, 400, 100, 90, 50, 40, 10, 9, 5, 4, 1}
+	symbols := []string{"m", "cm", "d", "cd", "c", "xc", "l", "xl", "x", "ix", "v", "iv", "i"}
+	var b strings.Builder
+	for i, v := range values {
+		for n >= v {
+			b.WriteString(symbols[i])
+			n -= v
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,527 @@
+// Package report 生成世系报告（Register / NGSQ 体例的后代报告、Ahnentafel 编号的祖先报告）
+//
+// 报告按代分组，单列一段的人物有一段由生卒、婚姻、职业和事件组成的叙述，
+// 后代报告在叙述后列出子女，子女以罗马数字排行，另有专段者前加 +。
+// 引用整理为脚注，同一来源同一页码只编号一次。
+package report
+
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+
+	"familytree/models"
+	"familytree/pkg/narrative"
+)
+
+// Data 报告所需的数据
+type Data struct {
+	Root models.Individual
+	// Lineage GetDescendantLineage 或 GetAncestorLineage 的结果
+	Lineage []models.LineageEntry
+	// People 世系之外需要提及的人，如配偶及配偶的父母
+	People    []models.Individual
+	Families  []models.Family // 报告中人物所在的家庭
+	Events    []models.Event
+	Places    []models.Place
+	Citations []models.Citation // 个人、家庭、事件的引用，Source 必须已填充
+}
+
+// builder 生成报告时的查找表和脚注状态
+type builder struct {
+	people    map[int]*models.Individual
+	families  map[int][]models.Family // 按夫妻任一方索引
+	events    map[int][]models.Event
+	places    map[int]models.Place
+	citations map[citedEntity][]models.Citation
+	labels    map[int]string // 报告中的编号，用于交叉引用
+
+	footnotes []models.ReportFootnote
+	noteIndex map[noteKey]int
+}
+
+// citedEntity 被引用的实体
+type citedEntity struct {
+	entityType models.EntityType
+	id         int
+}
+
+// noteKey 同一来源同一页码共用一个脚注
+type noteKey struct {
+	sourceID int
+	page     string
+}
+
+func newBuilder(data *Data) *builder {
+	b := &builder{
+		people:    map[int]*models.Individual{},
+		families:  map[int][]models.Family{},
+		events:    map[int][]models.Event{},
+		places:    map[int]models.Place{},
+		citations: map[citedEntity][]models.Citation{},
+		labels:    map[int]string{},
+		noteIndex: map[noteKey]int{},
+	}
+	add := func(ind models.Individual) {
+		// 家庭表没有起点，Root 为零值
+		if ind.IndividualID == 0 {
+			return
+		}
+		if _, ok := b.people[ind.IndividualID]; !ok {
+			copied := ind
+			b.people[ind.IndividualID] = &copied
+		}
+	}
+	add(data.Root)
+	for _, entry := range data.Lineage {
+		add(entry.Individual)
+	}
+	for _, ind := range data.People {
+		add(ind)
+	}
+
+	familySeen := map[int]bool{}
+	for _, family := range data.Families {
+		if familySeen[family.FamilyID] {
+			continue
+		}
+		familySeen[family.FamilyID] = true
+		for _, partnerID := range []*int{family.HusbandID, family.WifeID} {
+			if partnerID != nil {
+				b.families[*partnerID] = append(b.families[*partnerID], family)
+			}
+		}
+	}
+	for _, event := range data.Events {
+		b.events[event.IndividualID] = append(b.events[event.IndividualID], event)
+	}
+	for _, place := range data.Places {
+		b.places[place.PlaceID] = place
+	}
+	for _, c := range data.Citations {
+		if c.Source != nil {
+			key := citedEntity{c.EntityType, c.EntityID}
+			b.citations[key] = append(b.citations[key], c)
+		}
+	}
+	return b
+}
+
+// BuildDescendants 生成后代报告，numbering 为 register、henry 或 daboville
+func BuildDescendants(data *Data, opts models.ReportOptions) *models.Report {
+	b := newBuilder(data)
+	rootID := data.Root.IndividualID
+
+	// 按父母分组子女；查询已按父母、出生日期排序
+	childrenOf := map[int][]int{}
+	linked := map[[2]int]bool{}
+	for _, entry := range data.Lineage {
+		key := [2]int{entry.LinkedID, entry.Individual.IndividualID}
+		if !linked[key] {
+			linked[key] = true
+			childrenOf[entry.LinkedID] = append(childrenOf[entry.LinkedID], entry.Individual.IndividualID)
+		}
+	}
+
+	// 广度优先确定代数和主要父母；父母双方都是后代时，子女归在先出现的一方
+	order := []int{rootID}
+	generation := map[int]int{rootID: 1}
+	primary := map[int]int{}
+	for i := 0; i < len(order); i++ {
+		id := order[i]
+		for _, childID := range childrenOf[id] {
+			if _, ok := generation[childID]; !ok {
+				generation[childID] = generation[id] + 1
+				primary[childID] = id
+				order = append(order, childID)
+			}
+		}
+	}
+	hasEntry := func(id int) bool {
+		return id == rootID || len(childrenOf[id]) > 0
+	}
+
+	switch opts.Numbering {
+	case models.NumberingHenry, models.NumberingDAboville:
+		b.labels[rootID] = "1"
+		for _, id := range order {
+			for k, childID := range childrenOf[id] {
+				if primary[childID] != id {
+					continue
+				}
+				if opts.Numbering == models.NumberingHenry {
+					b.labels[childID] = b.labels[id] + henryDigit(k+1)
+				} else {
+					b.labels[childID] = b.labels[id] + "." + strconv.Itoa(k+1)
+				}
+			}
+		}
+	default:
+		// Register 体例只给留下后代的人编号，NGSQ 体例给每位后代编号
+		next := 1
+		for _, id := range order {
+			if opts.Style == models.ReportStyleNGSQ || hasEntry(id) {
+				b.labels[id] = strconv.Itoa(next)
+				next++
+			}
+		}
+	}
+
+	report := &models.Report{
+		Title:     data.Root.FullName + "后代世系报告",
+		RootID:    rootID,
+		Type:      models.ReportDescendant,
+		Style:     opts.Style,
+		Numbering: opts.Numbering,
+	}
+	for _, id := range order {
+		if !hasEntry(id) {
+			continue
+		}
+		p := b.people[id]
+		var origin string
+		if parentID, ok := primary[id]; ok {
+			origin = b.origin(p, parentID)
+		}
+		entry := b.entry(p, origin)
+		for _, group := range b.childGroups(p, childrenOf[id]) {
+			family := models.ReportFamily{Title: p.FullName + "的子女"}
+			if spouse, ok := b.people[group.spouseID]; ok {
+				family.Title = fmt.Sprintf("%s与%s的子女", p.FullName, spouse.FullName)
+			}
+			for _, childID := range group.children {
+				child := b.people[childID]
+				family.Children = append(family.Children, models.ReportChild{
+					Ordinal:      roman(group.ordinals[childID]),
+					Number:       b.labels[childID],
+					Continued:    hasEntry(childID) && primary[childID] == id,
+					IndividualID: childID,
+					Name:         child.FullName,
+					Summary:      b.childSummary(child, hasEntry(childID)),
+				})
+			}
+			entry.Families = append(entry.Families, family)
+		}
+		report.Generations = addEntry(report.Generations, generation[id], entry)
+	}
+	report.Footnotes = b.footnotes
+	return report
+}
+
+// BuildAncestors 生成 Ahnentafel 编号的祖先报告：本人为 1，父 2n，母 2n+1。
+// 近亲婚姻使同一祖先有多个编号时，只在最小编号处单列一段并注明其余编号
+func BuildAncestors(data *Data) *models.Report {
+	b := newBuilder(data)
+	rootID := data.Root.IndividualID
+
+	// 编号按 (个人, 代数) 记录：同一人在不同代出现时，其父母只能继承对应代的编号
+	numbersAt := map[[2]int][]int{{rootID, 0}: {1}}
+	numbers := map[int][]int{rootID: {1}}
+	for _, entry := range data.Lineage {
+		id := entry.Individual.IndividualID
+		for _, n := range numbersAt[[2]int{entry.LinkedID, entry.Generation - 1}] {
+			m := 2 * n
+			if entry.ParentRole == "mother" {
+				m++
+			}
+			key := [2]int{id, entry.Generation}
+			numbersAt[key] = append(numbersAt[key], m)
+			numbers[id] = append(numbers[id], m)
+		}
+	}
+
+	owners := map[int]int{}
+	ids := make([]int, 0, len(numbers))
+	for id, list := range numbers {
+		sort.Ints(list)
+		numbers[id] = uniqueInts(list)
+		for _, n := range numbers[id] {
+			owners[n] = id
+		}
+		b.labels[id] = strconv.Itoa(numbers[id][0])
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return numbers[ids[i]][0] < numbers[ids[j]][0] })
+
+	report := &models.Report{
+		Title:     data.Root.FullName + "祖先世系报告",
+		RootID:    rootID,
+		Type:      models.ReportAncestor,
+		Numbering: models.NumberingAhnentafel,
+	}
+	for _, id := range ids {
+		p := b.people[id]
+		n := numbers[id][0]
+		var origin string
+		if n > 1 {
+			if child, ok := b.people[owners[n/2]]; ok {
+				origin = fmt.Sprintf("%s（%d）之%s", child.FullName, n/2, parentWord(n))
+			}
+		}
+		entry := b.entry(p, origin)
+		if len(numbers[id]) > 1 {
+			var others []string
+			for _, m := range numbers[id][1:] {
+				others = append(others, strconv.Itoa(m))
+			}
+			entry.Sentences = append(entry.Sentences[:1], append([]models.ReportSentence{
+				{Text: "亦为第" + strings.Join(others, "、") + "号。"},
+			}, entry.Sentences[1:]...)...)
+		}
+		report.Generations = addEntry(report.Generations, bits.Len(uint(n)), entry)
+	}
+	report.Footnotes = b.footnotes
+	return report
+}
+
+// addEntry 将段落加入对应的代，代按出现顺序递增
+func addEntry(generations []models.ReportGeneration, generation int, entry models.ReportEntry) []models.ReportGeneration {
+	if n := len(generations); n == 0 || generations[n-1].Generation != generation {
+		generations = append(generations, models.ReportGeneration{
+			Generation: generation,
+			Title:      "第" + narrative.ChineseNumber(generation) + "代",
+		})
+	}
+	last := &generations[len(generations)-1]
+	last.Entries = append(last.Entries, entry)
+	return generations
+}
+
+// entry 人物叙述：身份与生卒、安葬、职业、事件、婚姻、备注
+func (b *builder) entry(p *models.Individual, origin string) models.ReportEntry {
+	entry := models.ReportEntry{
+		Number:       b.labels[p.IndividualID],
+		IndividualID: p.IndividualID,
+		Name:         p.FullName,
+	}
+	add := func(text string, notes []int) {
+		if text != "" {
+			entry.Sentences = append(entry.Sentences, models.ReportSentence{Text: text, Notes: notes})
+		}
+	}
+
+	add(narrative.Sentence(p.FullName, narrative.AlternateNames(p), origin,
+		narrative.Dated(p.BirthDate, b.place(p.BirthPlaceID, p.BirthPlace), "生"),
+		narrative.Dated(p.DeathDate, b.place(p.DeathPlaceID, p.DeathPlace), "卒")),
+		b.cite(models.EntityTypeIndividual, p.IndividualID))
+	if place := b.place(p.BurialPlaceID, p.BurialPlace); place != "" {
+		add(narrative.Sentence("葬于"+place), nil)
+	}
+	if occupation := strings.TrimSpace(p.Occupation); occupation != "" {
+		add(narrative.Sentence("业"+occupation), nil)
+	}
+	for _, event := range b.events[p.IndividualID] {
+		if text := b.eventText(event); text != "" {
+			add(narrative.Sentence(text), b.cite(models.EntityTypeEvent, event.EventID))
+		}
+	}
+	for _, family := range b.families[p.IndividualID] {
+		spouse, ok := b.people[spouseID(family, p.IndividualID)]
+		if !ok {
+			continue
+		}
+		parts := []string{"配" + spouse.FullName,
+			narrative.Dated(family.MarriageDate, b.place(family.MarriagePlaceID, nil), "成婚")}
+		if label, ok := b.labels[spouse.IndividualID]; ok {
+			parts = append(parts, "即第"+label+"号")
+		} else {
+			parts = append(parts, b.parentsOf(spouse),
+				narrative.Dated(spouse.BirthDate, b.place(spouse.BirthPlaceID, spouse.BirthPlace), "生"),
+				narrative.Dated(spouse.DeathDate, b.place(spouse.DeathPlaceID, spouse.DeathPlace), "卒"))
+		}
+		add(narrative.Sentence(parts...), b.cite(models.EntityTypeFamily, family.FamilyID))
+	}
+	if notes := strings.TrimSpace(p.Notes); notes != "" {
+		add(narrative.Sentence(notes), nil)
+	}
+	return entry
+}
+
+// childSummary 子女列表中的简述；另有专段的子女只列生卒年，引用留到专段
+func (b *builder) childSummary(child *models.Individual, continued bool) models.ReportSentence {
+	name := child.FullName
+	if names := narrative.AlternateNames(child); names != "" {
+		name += "，" + names
+	}
+	if continued {
+		if span := narrative.Lifespan(child); span != "" {
+			name += "（" + span + "）"
+		}
+		return models.ReportSentence{Text: name + "。"}
+	}
+
+	parts := []string{name,
+		narrative.Dated(child.BirthDate, b.place(child.BirthPlaceID, child.BirthPlace), "生"),
+		narrative.Dated(child.DeathDate, b.place(child.DeathPlaceID, child.DeathPlace), "卒")}
+	var notes []int
+	for _, family := range b.families[child.IndividualID] {
+		if spouse, ok := b.people[spouseID(family, child.IndividualID)]; ok {
+			parts = append(parts, "配"+spouse.FullName)
+		}
+		notes = append(notes, b.cite(models.EntityTypeFamily, family.FamilyID)...)
+	}
+	notes = append(b.cite(models.EntityTypeIndividual, child.IndividualID), notes...)
+	sort.Ints(notes)
+	return models.ReportSentence{Text: narrative.Sentence(parts...), Notes: uniqueInts(notes)}
+}
+
+// childGroup 同一配偶所生的子女
+type childGroup struct {
+	spouseID int
+	children []int
+	ordinals map[int]int // 子女在该人全部子女中的排行
+}
+
+// childGroups 按另一位父母分组子女，有家庭记录的婚姻按记录顺序在前
+func (b *builder) childGroups(p *models.Individual, children []int) []childGroup {
+	var groups []childGroup
+	index := map[int]int{}
+	group := func(spouseID int) *childGroup {
+		i, ok := index[spouseID]
+		if !ok {
+			i = len(groups)
+			index[spouseID] = i
+			groups = append(groups, childGroup{spouseID: spouseID, ordinals: map[int]int{}})
+		}
+		return &groups[i]
+	}
+	for _, family := range b.families[p.IndividualID] {
+		group(spouseID(family, p.IndividualID))
+	}
+	for k, childID := range children {
+		g := group(otherParentID(b.people[childID], p.IndividualID))
+		g.children = append(g.children, childID)
+		g.ordinals[childID] = k + 1
+	}
+
+	kept := groups[:0]
+	for _, g := range groups {
+		if len(g.children) > 0 {
+			kept = append(kept, g)
+		}
+	}
+	return kept
+}
+
+// origin 后代的出身，如 张大山（1）与李秀英之子
+func (b *builder) origin(p *models.Individual, parentID int) string {
+	parent := b.people[parentID]
+	text := parent.FullName
+	if label, ok := b.labels[parentID]; ok {
+		text += "（" + label + "）"
+	}
+	if other, ok := b.people[otherParentID(p, parentID)]; ok {
+		text += "与" + other.FullName
+	}
+	return text + "之" + narrative.ChildWord(p.Gender)
+}
+
+// parentsOf 配偶的父母，如 王某、李某之女
+func (b *builder) parentsOf(p *models.Individual) string {
+	var parents []string
+	for _, id := range []*int{p.FatherID, p.MotherID} {
+		if id == nil {
+			continue
+		}
+		if parent, ok := b.people[*id]; ok {
+			parents = append(parents, parent.FullName)
+		}
+	}
+	if len(parents) == 0 {
+		return ""
+	}
+	return strings.Join(parents, "、") + "之" + narrative.ChildWord(p.Gender)
+}
+
+// eventText 事件叙述，出生、逝世等已在正文中的事件略过
+func (b *builder) eventText(event models.Event) string {
+	switch strings.ToLower(event.EventType) {
+	case "birth", "death", "burial", "marriage":
+		return ""
+	}
+	s := narrative.Dated(event.EventDate, b.place(event.EventPlaceID, nil), narrative.EventName(event.EventType))
+	if s == "" {
+		s = narrative.EventName(event.EventType)
+	}
+	if description := strings.TrimSpace(event.Description); description != "" {
+		s += "：" + description
+	}
+	return s
+}
+
+// place 地点名称，优先使用地点表
+func (b *builder) place(id *int, text *string) string {
+	if id != nil {
+		if place, ok := b.places[*id]; ok && place.PlaceName != "" {
+			return place.PlaceName
+		}
+	}
+	if text != nil {
+		return strings.TrimSpace(*text)
+	}
+	return ""
+}
+
+// cite 实体的脚注编号，首次引用时按出现顺序编号
+func (b *builder) cite(entityType models.EntityType, id int) []int {
+	var notes []int
+	for _, c := range b.citations[citedEntity{entityType, id}] {
+		key := noteKey{c.SourceID, strings.TrimSpace(c.PageNumber)}
+		n, ok := b.noteIndex[key]
+		if !ok {
+			n = len(b.footnotes) + 1
+			b.noteIndex[key] = n
+			b.footnotes = append(b.footnotes, models.ReportFootnote{Number: n, Text: narrative.SourceText(c.Source, key.page)})
+		}
+		notes = append(notes, n)
+	}
+	sort.Ints(notes)
+	return uniqueInts(notes)
+}
+
+// spouseID 家庭中另一方的ID，没有时为 0
+func spouseID(family models.Family, id int) int {
+	if family.HusbandID != nil && *family.HusbandID == id {
+		if family.WifeID != nil {
+			return *family.WifeID
+		}
+		return 0
+	}
+	if family.HusbandID != nil {
+		return *family.HusbandID
+	}
+	return 0
+}
+
+// otherParentID 子女的另一位父母ID，没有时为 0
+func otherParentID(child *models.Individual, parentID int) int {
+	other := child.MotherID
+	if child.MotherID != nil && *child.MotherID == parentID {
+		other = child.FatherID
+	}
+	if other == nil {
+		return 0
+	}
+	return *other
+}
+
+// parentWord 按 Ahnentafel 编号奇偶区分父母
+func parentWord(n int) string {
+	if n%2 == 0 {
+		return "父"
+	}
+	return "母"
+}
+
+// uniqueInts 去除已排序切片中的重复项
+func uniqueInts(list []int) []int {
+	kept := list[:0]
+	for i, n := range list {
+		if i == 0 || n != list[i-1] {
+			kept = append(kept, n)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,205 @@
+package report
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"familytree/models"
+)
+
+func sampleData() *Data {
+	person := func(id int, name string, gender models.Gender, year int, father, mother *int) models.Individual {
+		born := time.Date(year, 5, 1, 0, 0, 0, 0, time.UTC)
+		return models.Individual{IndividualID: id, FullName: name, Gender: gender, BirthDate: &born, FatherID: father, MotherID: mother}
+	}
+	ids := []int{0, 1, 2, 3, 4, 5}
+	placeID := 7
+
+	root := person(1, "张大山", models.GenderMale, 1900, nil, nil)
+	root.BirthPlaceID = &placeID
+	son := person(3, "张明", models.GenderMale, 1925, &ids[1], &ids[2])
+	son.Occupation = "教师"
+	daughter := person(4, "张丽", models.GenderFemale, 1928, &ids[1], &ids[2])
+	grandson := person(6, "张小明", models.GenderMale, 1950, &ids[3], &ids[5])
+
+	married := time.Date(1922, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := &models.Source{SourceID: 1, Title: "张氏族谱", Author: "张某"}
+	return &Data{
+		Root: root,
+		Lineage: []models.LineageEntry{
+			{Individual: son, Generation: 1, LinkedID: 1, ParentRole: "father"},
+			{Individual: daughter, Generation: 1, LinkedID: 1, ParentRole: "father"},
+			{Individual: grandson, Generation: 2, LinkedID: 3, ParentRole: "father"},
+		},
+		People: []models.Individual{
+			person(2, "李秀英", models.GenderFemale, 1902, nil, nil),
+			person(5, "王芳", models.GenderFemale, 1927, nil, nil),
+		},
+		Families: []models.Family{
+			{FamilyID: 10, HusbandID: &ids[1], WifeID: &ids[2], MarriageDate: &married},
+			{FamilyID: 11, HusbandID: &ids[3], WifeID: &ids[5]},
+		},
+		Events: []models.Event{{EventID: 100, IndividualID: 3, EventType: "graduation", Description: "燕京大学"}},
+		Places: []models.Place{{PlaceID: placeID, PlaceName: "北京"}},
+		Citations: []models.Citation{
+			{SourceID: 1, EntityType: models.EntityTypeIndividual, EntityID: 1, PageNumber: "卷一", Source: source},
+			{SourceID: 1, EntityType: models.EntityTypeEvent, EntityID: 100, PageNumber: "卷二", Source: source},
+			{SourceID: 1, EntityType: models.EntityTypeFamily, EntityID: 10, PageNumber: "卷一", Source: source},
+		},
+	}
+}
+
+func TestBuildDescendantsNumbering(t *testing.T) {
+	cases := []struct {
+		style, numbering string
+		want             string // 各段编号
+		children         string // 第一段的子女编号
+	}{
+		{models.ReportStyleRegister, models.NumberingRegister, "1,2", "+ 2 i.|  ii."},
+		{models.ReportStyleNGSQ, models.NumberingRegister, "1,2", "+ 2 i.|  3 ii."},
+		{models.ReportStyleRegister, models.NumberingHenry, "1,11", "+ 11 i.|  12 ii."},
+		{models.ReportStyleRegister, models.NumberingDAboville, "1,1.1", "+ 1.1 i.|  1.2 ii."},
+	}
+	for _, tc := range cases {
+		report := BuildDescendants(sampleData(), models.ReportOptions{Style: tc.style, Numbering: tc.numbering})
+		var numbers []string
+		for _, generation := range report.Generations {
+			for _, entry := range generation.Entries {
+				numbers = append(numbers, entry.Number)
+			}
+		}
+		if got := strings.Join(numbers, ","); got != tc.want {
+			t.Errorf("%s/%s 段落编号错误: %s", tc.style, tc.numbering, got)
+		}
+		var children []string
+		for _, child := range report.Generations[0].Entries[0].Families[0].Children {
+			children = append(children, childPrefix(child)+child.Ordinal+".")
+		}
+		if got := strings.Join(children, "|"); got != tc.children {
+			t.Errorf("%s/%s 子女编号错误: %s", tc.style, tc.numbering, got)
+		}
+	}
+}
+
+func TestBuildDescendantsNarrative(t *testing.T) {
+	report := BuildDescendants(sampleData(), models.ReportOptions{Style: models.ReportStyleRegister, Numbering: models.NumberingRegister})
+	if len(report.Generations) != 2 || report.Generations[1].Title != "第二代" {
+		t.Fatalf("代数分组错误: %+v", report.Generations)
+	}
+
+	root := report.Generations[0].Entries[0]
+	if root.Sentences[0].Text != "张大山，1900年5月1日生于北京。" || len(root.Sentences[0].Notes) != 1 {
+		t.Errorf("生平叙述错误: %+v", root.Sentences[0])
+	}
+	// 家庭引用与个人引用同源同页，共用脚注 1
+	marriage := root.Sentences[1]
+	if marriage.Text != "配李秀英，1922年1月1日成婚，1902年5月1日生。" || marriage.Notes[0] != 1 {
+		t.Errorf("婚姻叙述错误: %+v", marriage)
+	}
+	if root.Families[0].Title != "张大山与李秀英的子女" {
+		t.Errorf("子女分组标题错误: %s", root.Families[0].Title)
+	}
+
+	son := report.Generations[1].Entries[0]
+	if !strings.HasPrefix(son.Sentences[0].Text, "张明，张大山（1）与李秀英之子") {
+		t.Errorf("出身叙述错误: %s", son.Sentences[0].Text)
+	}
+	if len(report.Footnotes) != 2 || report.Footnotes[1].Text != "张某，《张氏族谱》，卷二。" {
+		t.Errorf("脚注错误: %+v", report.Footnotes)
+	}
+}
+
+func TestBuildAncestors(t *testing.T) {
+	ids := []int{0, 1, 2, 3, 4, 5, 6}
+	person := func(id int, name string, gender models.Gender, father, mother *int) models.Individual {
+		return models.Individual{IndividualID: id, FullName: name, Gender: gender, FatherID: father, MotherID: mother}
+	}
+	// 表亲婚姻：1 的父亲 2 与母亲 3 共同的祖父为 6
+	data := &Data{
+		Root: person(1, "本人", models.GenderMale, &ids[2], &ids[3]),
+		Lineage: []models.LineageEntry{
+			{Individual: person(2, "父", models.GenderMale, &ids[4], nil), Generation: 1, LinkedID: 1, ParentRole: "father"},
+			{Individual: person(3, "母", models.GenderFemale, &ids[5], nil), Generation: 1, LinkedID: 1, ParentRole: "mother"},
+			{Individual: person(4, "祖父", models.GenderMale, &ids[6], nil), Generation: 2, LinkedID: 2, ParentRole: "father"},
+			{Individual: person(5, "外祖父", models.GenderMale, &ids[6], nil), Generation: 2, LinkedID: 3, ParentRole: "father"},
+			{Individual: person(6, "曾祖父", models.GenderMale, nil, nil), Generation: 3, LinkedID: 4, ParentRole: "father"},
+			{Individual: person(6, "曾祖父", models.GenderMale, nil, nil), Generation: 3, LinkedID: 5, ParentRole: "father"},
+		},
+	}
+	report := BuildAncestors(data)
+
+	var numbers []string
+	for _, generation := range report.Generations {
+		for _, entry := range generation.Entries {
+			numbers = append(numbers, entry.Number+entry.Name)
+		}
+	}
+	if got := strings.Join(numbers, ","); got != "1本人,2父,3母,4祖父,6外祖父,8曾祖父" {
+		t.Errorf("Ahnentafel 编号错误: %s", got)
+	}
+	last := report.Generations[3].Entries[0]
+	if last.Sentences[0].Text != "曾祖父，祖父（4）之父。" || last.Sentences[1].Text != "亦为第12号。" {
+		t.Errorf("祖先重叠说明错误: %+v", last.Sentences)
+	}
+}
+
+func TestWriteFormats(t *testing.T) {
+	report := BuildDescendants(sampleData(), models.ReportOptions{Style: models.ReportStyleRegister, Numbering: models.NumberingRegister})
+	for format, want := range map[string][]string{
+		FormatText:     {"1. 张大山，1900年5月1日生于北京。[1]", "    + 2 i. 张明（1925–）。", "[2] 张某，《张氏族谱》，卷二。"},
+		FormatMarkdown: {"**1.** 张大山", `- \+ 2 i. [张明](#p3)（1925–）。`, "[^1]: 张某"},
+		FormatHTML:     {`<p id="p1"><strong>1.</strong>`, `<sup><a href="#fn1" id="ref1">1</a></sup>`, `<li id="fn2">`},
+	} {
+		var out bytes.Buffer
+		if err := Write(&out, report, format); err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range want {
+			if !strings.Contains(out.String(), s) {
+				t.Errorf("%s 输出缺少 %q:\n%s", format, s, out.String())
+			}
+		}
+	}
+	if err := Write(&bytes.Buffer{}, report, "pdf"); err == nil {
+		t.Error("不支持的格式应返回错误")
+	}
+}
+
+func TestBuildFamilyGroupSheet(t *testing.T) {
+	data := sampleData()
+	data.People = append(data.People, data.Root, data.Lineage[0].Individual, data.Lineage[1].Individual)
+	data.Root = models.Individual{}
+	data.Lineage = nil
+	family := data.Families[0]
+	family.Children = []models.Child{
+		{FamilyID: 10, IndividualID: 3, RelationshipToParents: "biological"},
+		{FamilyID: 10, IndividualID: 4, RelationshipToParents: "adopted"},
+	}
+
+	sheet := BuildFamilyGroupSheet(&family, data)
+	if sheet.Title != "张大山与李秀英家庭表" || sheet.Family.Husband == nil || sheet.Family.Wife == nil || len(sheet.Family.Children) != 2 {
+		t.Fatalf("家庭关联字段未填充: %+v", sheet.Family)
+	}
+	if sheet.Husband.BirthPlace != "北京" || len(sheet.Husband.Sources) != 1 || sheet.MarriageSources[0] != sheet.Husband.Sources[0] {
+		t.Errorf("丈夫信息错误: %+v", sheet.Husband)
+	}
+	son := sheet.Children[0]
+	if len(son.Spouses) != 1 || son.Spouses[0].FullName != "王芳" || son.Father.FullName != "张大山" || len(son.Events) != 1 {
+		t.Errorf("子女信息错误: %+v", son)
+	}
+	if cells := ChildCells(1, &sheet.Children[1]); cells[2] != "张丽（养子女）" {
+		t.Errorf("子女关系未标注: %v", cells)
+	}
+
+	var out bytes.Buffer
+	if err := WriteFamilyGroupSheetHTML(&out, sheet); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"<h1>张大山与李秀英家庭表</h1>", "<td>1925年5月1日</td>", `<li value="2">张某，《张氏族谱》，卷二。</li>`} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("HTML 缺少 %q", s)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package report
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strings"
+
+	"familytree/models"
+	"familytree/pkg/narrative"
+)
+
+// BuildFamilyGroupSheet 生成家庭表，子女按 family.Children 的顺序列出。data.People 需包含夫妻、夫妻的父母、子女及子女的配偶，
+// data.Families 需包含该家庭和子女的家庭；来源按丈夫、妻子、婚姻、子女的顺序编号
+func BuildFamilyGroupSheet(family *models.Family, data *Data) *models.FamilyGroupSheet {
+	b := newBuilder(data)
+	record := *family
+	sheet := &models.FamilyGroupSheet{Family: &record}
+
+	var names []string
+	if record.HusbandID != nil {
+		if sheet.Husband = b.sheetPerson(*record.HusbandID); sheet.Husband != nil {
+			record.Husband = sheet.Husband.Individual
+			names = append(names, record.Husband.FullName)
+		}
+	}
+	if record.WifeID != nil {
+		if sheet.Wife = b.sheetPerson(*record.WifeID); sheet.Wife != nil {
+			record.Wife = sheet.Wife.Individual
+			names = append(names, record.Wife.FullName)
+		}
+	}
+	sheet.Title = strings.Join(names, "与") + "家庭表"
+	if record.MarriagePlaceID != nil {
+		if place, ok := b.places[*record.MarriagePlaceID]; ok {
+			record.MarriagePlace = &place
+		}
+	}
+	sheet.MarriageSources = b.cite(models.EntityTypeFamily, record.FamilyID)
+
+	sheet.Children = []models.GroupSheetPerson{}
+	for _, child := range record.Children {
+		p := b.sheetPerson(child.IndividualID)
+		if p == nil {
+			continue
+		}
+		p.Relationship = child.RelationshipToParents
+		for _, f := range b.families[child.IndividualID] {
+			if spouse, ok := b.people[spouseID(f, child.IndividualID)]; ok {
+				p.Spouses = append(p.Spouses, *spouse)
+			}
+		}
+		sheet.Children = append(sheet.Children, *p)
+	}
+
+	sheet.Sources = b.footnotes
+	if sheet.Sources == nil {
+		sheet.Sources = []models.ReportFootnote{}
+	}
+	return sheet
+}
+
+// sheetPerson 家庭表中一人的生卒、父母、事件和来源
+func (b *builder) sheetPerson(id int) *models.GroupSheetPerson {
+	ind, ok := b.people[id]
+	if !ok {
+		return nil
+	}
+	p := &models.GroupSheetPerson{
+		Individual:  ind,
+		BirthPlace:  b.place(ind.BirthPlaceID, ind.BirthPlace),
+		DeathPlace:  b.place(ind.DeathPlaceID, ind.DeathPlace),
+		BurialPlace: b.place(ind.BurialPlaceID, ind.BurialPlace),
+	}
+	if ind.FatherID != nil {
+		p.Father = b.people[*ind.FatherID]
+	}
+	if ind.MotherID != nil {
+		p.Mother = b.people[*ind.MotherID]
+	}
+
+	p.Sources = b.cite(models.EntityTypeIndividual, id)
+	for _, event := range b.events[id] {
+		if event.EventPlaceID != nil {
+			if place, ok := b.places[*event.EventPlaceID]; ok {
+				event.EventPlace = &place
+			}
+		}
+		p.Events = append(p.Events, event)
+		p.Sources = append(p.Sources, b.cite(models.EntityTypeEvent, event.EventID)...)
+	}
+	sort.Ints(p.Sources)
+	p.Sources = uniqueInts(p.Sources)
+	return p
+}
+
+// SheetRow 家庭表中的一行
+type SheetRow struct {
+	Label, Value string
+}
+
+// PersonRows 夫妻栏目的各行，PDF 和 HTML 版式共用
+func PersonRows(p *models.GroupSheetPerson) []SheetRow {
+	if p == nil {
+		return []SheetRow{{"姓名", ""}}
+	}
+	ind := p.Individual
+	name := ind.FullName
+	if names := narrative.AlternateNames(ind); names != "" {
+		name += "（" + names + "）"
+	}
+	rows := []SheetRow{
+		{"姓名", name},
+		{"出生", joinNonEmpty(narrative.FormatDate(ind.BirthDate), p.BirthPlace)},
+		{"逝世", joinNonEmpty(narrative.FormatDate(ind.DeathDate), p.DeathPlace)},
+	}
+	if p.BurialPlace != "" {
+		rows = append(rows, SheetRow{"安葬", p.BurialPlace})
+	}
+	if occupation := strings.TrimSpace(ind.Occupation); occupation != "" {
+		rows = append(rows, SheetRow{"职业", occupation})
+	}
+	rows = append(rows, SheetRow{"父亲", nameOf(p.Father)}, SheetRow{"母亲", nameOf(p.Mother)})
+	for _, event := range p.Events {
+		switch strings.ToLower(event.EventType) {
+		case "birth", "death", "burial", "marriage":
+			continue
+		}
+		var place string
+		if event.EventPlace != nil {
+			place = event.EventPlace.PlaceName
+		}
+		rows = append(rows, SheetRow{narrative.EventName(event.EventType),
+			joinNonEmpty(narrative.FormatDate(event.EventDate), place, strings.TrimSpace(event.Description))})
+	}
+	if len(p.Sources) > 0 {
+		rows = append(rows, SheetRow{"来源", sourceRefs(p.Sources)})
+	}
+	return rows
+}
+
+// MarriageRows 婚姻栏目的各行
+func MarriageRows(sheet *models.FamilyGroupSheet) []SheetRow {
+	f := sheet.Family
+	var place string
+	if f.MarriagePlace != nil {
+		place = f.MarriagePlace.PlaceName
+	}
+	rows := []SheetRow{{"结婚日期", narrative.FormatDate(f.MarriageDate)}, {"结婚地点", place}}
+	if f.DivorceDate != nil {
+		rows = append(rows, SheetRow{"离婚日期", narrative.FormatDate(f.DivorceDate)})
+	}
+	if notes := strings.TrimSpace(f.Notes); notes != "" {
+		rows = append(rows, SheetRow{"备注", notes})
+	}
+	if len(sheet.MarriageSources) > 0 {
+		rows = append(rows, SheetRow{"来源", sourceRefs(sheet.MarriageSources)})
+	}
+	return rows
+}
+
+// ChildColumns 子女表的列
+var ChildColumns = []string{"序", "性别", "姓名", "出生", "逝世", "配偶", "来源"}
+
+// ChildCells 子女表中一行的各列
+func ChildCells(i int, child *models.GroupSheetPerson) []string {
+	ind := child.Individual
+	name := ind.FullName
+	if child.Relationship != "" && child.Relationship != "biological" {
+		name += "（" + relationshipName(child.Relationship) + "）"
+	}
+	var spouses []string
+	for _, spouse := range child.Spouses {
+		spouses = append(spouses, spouse.FullName)
+	}
+	return []string{
+		fmt.Sprintf("%d", i+1), narrative.GenderName(ind.Gender), name,
+		joinNonEmpty(narrative.FormatDate(ind.BirthDate), child.BirthPlace),
+		joinNonEmpty(narrative.FormatDate(ind.DeathDate), child.DeathPlace),
+		strings.Join(spouses, "、"), sourceRefs(child.Sources),
+	}
+}
+
+// relationshipNames 子女关系类型的中文名称
+var relationshipNames = map[string]string{
+	"adopted": "养子女",
+	"step":    "继子女",
+	"foster":  "寄养",
+}
+
+// relationshipName 子女关系类型名称
+func relationshipName(relationship string) string {
+	if name, ok := relationshipNames[relationship]; ok {
+		return name
+	}
+	return relationship
+}
+
+// sourceRefs 来源编号，如 [1][3]
+func sourceRefs(numbers []int) string {
+	var b strings.Builder
+	for _, n := range numbers {
+		fmt.Fprintf(&b, "[%d]", n)
+	}
+	return b.String()
+}
+
+// nameOf 姓名，没有时为空
+func nameOf(p *models.Individual) string {
+	if p == nil {
+		return ""
+	}
+	return p.FullName
+}
+
+// joinNonEmpty 用中文逗号连接非空片段
+func joinNonEmpty(parts ...string) string {
+	var kept []string
+	for _, part := range parts {
+		if part != "" {
+			kept = append(kept, part)
+		}
+	}
+	return strings.Join(kept, "，")
+}
+
+// WriteFamilyGroupSheetHTML 输出可打印的 HTML 家庭表
+func WriteFamilyGroupSheetHTML(w io.Writer, sheet *models.FamilyGroupSheet) error {
+	bw := bufio.NewWriter(w)
+	esc := html.EscapeString
+	table := func(title string, rows []SheetRow) {
+		fmt.Fprintf(bw, "<h2>%s</h2>\n<table class=\"facts\">\n", esc(title))
+		for _, row := range rows {
+			fmt.Fprintf(bw, "<tr><th>%s</th><td>%s</td></tr>\n", esc(row.Label), esc(row.Value))
+		}
+		bw.WriteString("</table>\n")
+	}
+
+	fmt.Fprintf(bw, "<!DOCTYPE html>\n<html lang=\"zh\">\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n", esc(sheet.Title))
+	bw.WriteString("<style>body{font-family:serif;max-width:52em;margin:2em auto}" +
+		"table{border-collapse:collapse;width:100%;margin-bottom:1em}th,td{border:1px solid #999;padding:.3em .5em;text-align:left}" +
+		"table.facts th{width:7em;background:#f0f0f0}thead th{background:#f0f0f0}" +
+		"@media print{body{margin:0}h2{page-break-after:avoid}}</style>\n")
+	fmt.Fprintf(bw, "</head>\n<body>\n<h1>%s</h1>\n", esc(sheet.Title))
+	table("丈夫", PersonRows(sheet.Husband))
+	table("妻子", PersonRows(sheet.Wife))
+	table("婚姻", MarriageRows(sheet))
+
+	if len(sheet.Children) > 0 {
+		bw.WriteString("<h2>子女</h2>\n<table>\n<thead><tr>")
+		for _, column := range ChildColumns {
+			fmt.Fprintf(bw, "<th>%s</th>", esc(column))
+		}
+		bw.WriteString("</tr></thead>\n<tbody>\n")
+		for i := range sheet.Children {
+			bw.WriteString("<tr>")
+			for _, cell := range ChildCells(i, &sheet.Children[i]) {
+				fmt.Fprintf(bw, "<td>%s</td>", esc(cell))
+			}
+			bw.WriteString("</tr>\n")
+		}
+		bw.WriteString("</tbody>\n</table>\n")
+	}
+
+	if len(sheet.Sources) > 0 {
+		bw.WriteString("<h2>来源</h2>\n<ol>\n")
+		for _, source := range sheet.Sources {
+			fmt.Fprintf(bw, "<li value=\"%d\">%s</li>\n", source.Number, esc(source.Text))
+		}
+		bw.WriteString("</ol>\n")
+	}
+	bw.WriteString("</body>\n</html>\n")
+	return bw.Flush()
+}
@@ -0,0 +1,180 @@
+package report
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+
+	"familytree/models"
+)
+
+// 输出格式
+const (
+	FormatText     = "text"
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+)
+
+// ContentType 各输出格式的 MIME 类型
+func ContentType(format string) string {
+	switch format {
+	case FormatMarkdown:
+		return "text/markdown; charset=utf-8"
+	case FormatHTML:
+		return "text/html; charset=utf-8"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// Write 按格式输出报告
+func Write(w io.Writer, report *models.Report, format string) error {
+	bw := bufio.NewWriter(w)
+	switch format {
+	case FormatText:
+		writeText(bw, report)
+	case FormatMarkdown:
+		writeMarkdown(bw, report)
+	case FormatHTML:
+		writeHTML(bw, report)
+	default:
+		return fmt.Errorf("不支持的报告格式: %s", format)
+	}
+	return bw.Flush()
+}
+
+// paragraph 拼接叙述，marker 生成脚注标记
+func paragraph(sentences []models.ReportSentence, escape func(string) string, marker func(int) string) string {
+	var b strings.Builder
+	for _, s := range sentences {
+		b.WriteString(escape(s.Text))
+		for _, n := range s.Notes {
+			b.WriteString(marker(n))
+		}
+	}
+	return b.String()
+}
+
+// childPrefix 子女编号，另有专段者前加 +
+func childPrefix(child models.ReportChild) string {
+	prefix := "  "
+	if child.Continued {
+		prefix = "+ "
+	}
+	if child.Number != "" {
+		prefix += child.Number + " "
+	}
+	return prefix
+}
+
+func writeText(w *bufio.Writer, report *models.Report) {
+	plain := func(s string) string { return s }
+	marker := func(n int) string { return fmt.Sprintf("[%d]", n) }
+
+	fmt.Fprintf(w, "%s\n\n", report.Title)
+	for _, generation := range report.Generations {
+		fmt.Fprintf(w, "%s\n\n", generation.Title)
+		for _, entry := range generation.Entries {
+			fmt.Fprintf(w, "%s. %s\n", entry.Number, paragraph(entry.Sentences, plain, marker))
+			for _, family := range entry.Families {
+				fmt.Fprintf(w, "\n    %s：\n", family.Title)
+				for _, child := range family.Children {
+					fmt.Fprintf(w, "    %s%s. %s\n", childPrefix(child), child.Ordinal,
+						paragraph([]models.ReportSentence{child.Summary}, plain, marker))
+				}
+			}
+			w.WriteString("\n")
+		}
+	}
+	if len(report.Footnotes) > 0 {
+		w.WriteString("注释\n\n")
+		for _, note := range report.Footnotes {
+			fmt.Fprintf(w, "[%d] %s\n", note.Number, note.Text)
+		}
+	}
+}
+
+// markdownEscaper 转义 Markdown 中有特殊含义的字符
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`, "#", `\#`, "`", "\\`",
+)
+
+func writeMarkdown(w *bufio.Writer, report *models.Report) {
+	marker := func(n int) string { return fmt.Sprintf("[^%d]", n) }
+
+	fmt.Fprintf(w, "# %s\n", markdownEscaper.Replace(report.Title))
+	for _, generation := range report.Generations {
+		fmt.Fprintf(w, "\n## %s\n", generation.Title)
+		for _, entry := range generation.Entries {
+			fmt.Fprintf(w, "\n<a id=\"p%d\"></a>**%s.** %s\n", entry.IndividualID, markdownEscaper.Replace(entry.Number),
+				paragraph(entry.Sentences, markdownEscaper.Replace, marker))
+			for _, family := range entry.Families {
+				fmt.Fprintf(w, "\n%s：\n\n", markdownEscaper.Replace(family.Title))
+				for _, child := range family.Children {
+					prefix := strings.TrimSpace(childPrefix(child))
+					if child.Continued {
+						prefix = `\` + prefix
+					}
+					text := paragraph([]models.ReportSentence{child.Summary}, markdownEscaper.Replace, marker)
+					if child.Continued {
+						text = fmt.Sprintf("[%s](#p%d)%s", markdownEscaper.Replace(child.Name), child.IndividualID,
+							strings.TrimPrefix(text, markdownEscaper.Replace(child.Name)))
+					}
+					fmt.Fprintf(w, "- %s %s. %s\n", prefix, child.Ordinal, text)
+				}
+			}
+		}
+	}
+	if len(report.Footnotes) > 0 {
+		w.WriteString("\n")
+		for _, note := range report.Footnotes {
+			fmt.Fprintf(w, "[^%d]: %s\n", note.Number, markdownEscaper.Replace(note.Text))
+		}
+	}
+}
+
+func writeHTML(w *bufio.Writer, report *models.Report) {
+	// 同一脚注可被多次引用，只有第一次引用带返回锚点
+	referenced := map[int]bool{}
+	htmlMarker := func(n int) string {
+		if referenced[n] {
+			return fmt.Sprintf(`<sup><a href="#fn%d">%d</a></sup>`, n, n)
+		}
+		referenced[n] = true
+		return fmt.Sprintf(`<sup><a href="#fn%d" id="ref%d">%d</a></sup>`, n, n, n)
+	}
+	esc := html.EscapeString
+
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html lang=\"zh\">\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n", esc(report.Title))
+	w.WriteString("<style>body{font-family:serif;max-width:48em;margin:2em auto;line-height:1.7}" +
+		"ol.children{list-style:none;padding-left:1.5em}.footnotes{font-size:.9em;border-top:1px solid #999}</style>\n")
+	fmt.Fprintf(w, "</head>\n<body>\n<h1>%s</h1>\n", esc(report.Title))
+	for _, generation := range report.Generations {
+		fmt.Fprintf(w, "<h2>%s</h2>\n", esc(generation.Title))
+		for _, entry := range generation.Entries {
+			fmt.Fprintf(w, "<p id=\"p%d\"><strong>%s.</strong> %s</p>\n", entry.IndividualID, esc(entry.Number),
+				paragraph(entry.Sentences, esc, htmlMarker))
+			for _, family := range entry.Families {
+				fmt.Fprintf(w, "<p>%s：</p>\n<ol class=\"children\">\n", esc(family.Title))
+				for _, child := range family.Children {
+					text := paragraph([]models.ReportSentence{child.Summary}, esc, htmlMarker)
+					if child.Continued {
+						text = fmt.Sprintf(`<a href="#p%d">%s</a>%s`, child.IndividualID, esc(child.Name),
+							strings.TrimPrefix(text, esc(child.Name)))
+					}
+					fmt.Fprintf(w, "<li>%s%s. %s</li>\n", esc(childPrefix(child)), child.Ordinal, text)
+				}
+				w.WriteString("</ol>\n")
+			}
+		}
+	}
+	if len(report.Footnotes) > 0 {
+		w.WriteString("<ol class=\"footnotes\">\n")
+		for _, note := range report.Footnotes {
+			fmt.Fprintf(w, "<li id=\"fn%d\">%s <a href=\"#ref%d\">↩</a></li>\n", note.Number, esc(note.Text), note.Number)
+		}
+		w.WriteString("</ol>\n")
+	}
+	w.WriteString("</body>\n</html>\n")
+}
@@ -0,0 +1,565 @@
+package site
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"familytree/models"
+	"familytree/pkg/narrative"
+)
+
+// page 页面公共字段
+type page struct {
+	Title string
+	Site  string // 网站名称
+	Root  string // 到站点根目录的相对路径，如 ../
+}
+
+// link 指向人物页的链接
+type link struct {
+	Href     string
+	Name     string
+	Lifespan string
+	Note     string // 关系说明，如 收养
+}
+
+// fact 人物页的一项基本信息
+type fact struct {
+	Label, Value string
+}
+
+// familyView 一段婚姻及其子女，没有配偶信息时 Spouse 为空
+type familyView struct {
+	Spouse   *link
+	Marriage string
+	Children []link
+}
+
+// eventView 一条事件
+type eventView struct {
+	Date        string
+	Name        string
+	Place       string
+	Description string
+	Notes       []int
+}
+
+// personView 人物页
+type personView struct {
+	page
+	Name     string
+	Living   bool
+	Photo    string
+	Facts    []fact
+	Parents  []link
+	Families []familyView
+	Events   []eventView
+	Sources  []models.ReportFootnote
+}
+
+// indexEntry 索引中的一人及其说明
+type indexEntry struct {
+	link
+	Detail string
+}
+
+// indexGroup 索引中的一组（一个姓氏或一个地点）
+type indexGroup struct {
+	Anchor  string
+	Name    string
+	Entries []indexEntry
+}
+
+// homeView 首页
+type homeView struct {
+	page
+	Description string
+	Start       *link // 家族树的起始人物
+	Public      int
+	Redacted    int
+	Surnames    []indexGroup
+}
+
+// indexView 姓氏、地点索引页
+type indexView struct {
+	page
+	Groups []indexGroup
+}
+
+// searchEntry 搜索索引中的一条
+type searchEntry struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Alt    string `json:"alt,omitempty"`
+	Years  string `json:"years,omitempty"`
+	Places string `json:"places,omitempty"`
+	URL    string `json:"url"`
+}
+
+// relationshipNotes 非亲生子女的标注
+var relationshipNotes = map[string]string{
+	"adopted": "收养",
+	"step":    "继子女",
+	"foster":  "寄养",
+}
+
+// parentPrefixes 非亲生父母的称谓前缀
+var parentPrefixes = map[string]string{
+	"adopted": "养",
+	"step":    "继",
+	"foster":  "寄养",
+}
+
+// siteName 网站名称
+func (g *generator) siteName() string {
+	if name := strings.TrimSpace(g.data.Tree.FamilyTreeName); name != "" {
+		return name
+	}
+	return "家谱"
+}
+
+// displayName 对外显示的姓名，在世的人只保留姓氏
+func (p *person) displayName() string {
+	if p.living {
+		if p.surname == "" {
+			return "在世人员"
+		}
+		return p.surname + "（在世）"
+	}
+	return p.ind.FullName
+}
+
+// linkTo 从 root 指向某人页面的链接，不在家族树中的人没有链接
+func (g *generator) linkTo(id int, root string) *link {
+	p, ok := g.people[id]
+	if !ok {
+		return nil
+	}
+	l := &link{Href: fmt.Sprintf("%speople/%d.html", root, id), Name: p.displayName()}
+	if !p.living {
+		l.Lifespan = narrative.Lifespan(p.ind)
+	}
+	return l
+}
+
+// placeName 地点名称，优先使用地点记录
+func (g *generator) placeName(id *int, text *string) string {
+	if id != nil {
+		if name, ok := g.places[*id]; ok {
+			return name
+		}
+	}
+	if text != nil {
+		return strings.TrimSpace(*text)
+	}
+	return ""
+}
+
+// personPage 组装人物页，在世的人只列出父母
+func (g *generator) personPage(p *person) *personView {
+	ind := p.ind
+	view := &personView{
+		page:   page{Title: p.displayName(), Site: g.siteName(), Root: "../"},
+		Name:   p.displayName(),
+		Living: p.living,
+		Photo:  p.photo,
+	}
+	if p.photo != "" && !strings.Contains(p.photo, "://") {
+		view.Photo = view.Root + p.photo
+	}
+	view.Parents = g.parents(p)
+	if p.living {
+		return view
+	}
+
+	add := func(label, value string) {
+		if value = strings.TrimSpace(value); value != "" {
+			view.Facts = append(view.Facts, fact{label, value})
+		}
+	}
+	add("字号", narrative.AlternateNames(ind))
+	add("性别", narrative.GenderName(ind.Gender))
+	add("出生", joinNonEmpty(narrative.FormatDate(ind.BirthDate), g.placeName(ind.BirthPlaceID, ind.BirthPlace)))
+	add("逝世", joinNonEmpty(narrative.FormatDate(ind.DeathDate), g.placeName(ind.DeathPlaceID, ind.DeathPlace)))
+	add("安葬", g.placeName(ind.BurialPlaceID, ind.BurialPlace))
+	add("职业", ind.Occupation)
+	add("备注", ind.Notes)
+
+	view.Families = g.familyViews(p)
+
+	// 来源按个人、事件、家庭的顺序编号，同一来源同一页只编一次
+	refs := map[string]int{}
+	cite := func(entityType models.EntityType, id int) []int {
+		var numbers []int
+		for _, c := range g.citations[entityType][id] {
+			key := fmt.Sprintf("%d\x00%s", c.SourceID, c.PageNumber)
+			n, ok := refs[key]
+			if !ok {
+				n = len(view.Sources) + 1
+				refs[key] = n
+				view.Sources = append(view.Sources, models.ReportFootnote{Number: n, Text: narrative.SourceText(c.Source, c.PageNumber)})
+			}
+			numbers = appendUnique(numbers, n)
+		}
+		return numbers
+	}
+	cite(models.EntityTypeIndividual, ind.IndividualID)
+	for _, event := range p.events {
+		view.Events = append(view.Events, eventView{
+			Date:        narrative.FormatDate(event.EventDate),
+			Name:        narrative.EventName(event.EventType),
+			Place:       g.placeName(event.EventPlaceID, nil),
+			Description: event.Description,
+			Notes:       cite(models.EntityTypeEvent, event.EventID),
+		})
+	}
+	for _, family := range g.families[ind.IndividualID] {
+		cite(models.EntityTypeFamily, family.FamilyID)
+	}
+	return view
+}
+
+// parents 父母：father_id/mother_id 之外，children 表中的非亲生父母一并列出
+func (g *generator) parents(p *person) []link {
+	var list []link
+	seen := map[int]bool{}
+	addParent := func(id int, note string) {
+		if seen[id] {
+			return
+		}
+		seen[id] = true
+		if l := g.linkTo(id, "../"); l != nil {
+			l.Note = note
+			list = append(list, *l)
+		}
+	}
+	if p.ind.FatherID != nil {
+		addParent(*p.ind.FatherID, "父亲")
+	}
+	if p.ind.MotherID != nil {
+		addParent(*p.ind.MotherID, "母亲")
+	}
+	for _, row := range g.childRows[p.ind.IndividualID] {
+		prefix := parentPrefixes[row.RelationshipToParents]
+		family := g.familyByID[row.FamilyID]
+		if family.HusbandID != nil {
+			addParent(*family.HusbandID, prefix+"父")
+		}
+		if family.WifeID != nil {
+			addParent(*family.WifeID, prefix+"母")
+		}
+	}
+	return list
+}
+
+// familyViews 按婚姻分组的配偶与子女，找不到对应家庭的子女按另一方父母归组
+func (g *generator) familyViews(p *person) []familyView {
+	id := p.ind.IndividualID
+	var views []familyView
+	byFamily := map[int]int{} // 家庭ID -> views 下标
+	bySpouse := map[int]int{} // 配偶ID -> views 下标
+	for _, family := range g.families[id] {
+		view := familyView{}
+		spouse := otherPartner(family, id)
+		if spouse != 0 {
+			view.Spouse = g.linkTo(spouse, "../")
+			if _, ok := bySpouse[spouse]; !ok {
+				bySpouse[spouse] = len(views)
+			}
+		}
+		place := g.placeName(family.MarriagePlaceID, nil)
+		if g.people[spouse] == nil || !g.people[spouse].living {
+			view.Marriage = narrative.Dated(family.MarriageDate, place, "结婚")
+			if family.DivorceDate != nil {
+				view.Marriage = joinNonEmpty(view.Marriage, narrative.FormatDate(family.DivorceDate)+"离婚")
+			}
+		}
+		byFamily[family.FamilyID] = len(views)
+		views = append(views, view)
+	}
+
+	type grouped struct {
+		index int
+		child childLink
+	}
+	var others []int // 没有家庭记录的另一方父母，0 表示不详
+	extra := map[int][]childLink{}
+	var placed []grouped
+	for _, child := range g.children[id] {
+		if i, ok := byFamily[child.familyID]; ok && child.familyID != 0 {
+			placed = append(placed, grouped{i, child})
+			continue
+		}
+		other := 0
+		if c, ok := g.people[child.id]; ok {
+			other = otherParent(c.ind, id)
+		}
+		if i, ok := bySpouse[other]; ok && other != 0 {
+			placed = append(placed, grouped{i, child})
+			continue
+		}
+		if _, ok := extra[other]; !ok {
+			others = append(others, other)
+		}
+		extra[other] = append(extra[other], child)
+	}
+	sort.Ints(others)
+	for _, other := range others {
+		view := familyView{}
+		if other != 0 {
+			view.Spouse = g.linkTo(other, "../")
+		}
+		for _, child := range extra[other] {
+			placed = append(placed, grouped{len(views), child})
+		}
+		views = append(views, view)
+	}
+
+	sort.SliceStable(placed, func(i, j int) bool {
+		if placed[i].index != placed[j].index {
+			return placed[i].index < placed[j].index
+		}
+		return g.bornBefore(placed[i].child.id, placed[j].child.id)
+	})
+	for _, item := range placed {
+		if l := g.linkTo(item.child.id, "../"); l != nil {
+			l.Note = relationshipNotes[item.child.relationship]
+			views[item.index].Children = append(views[item.index].Children, *l)
+		}
+	}
+
+	// 去掉既无配偶又无子女的空家庭
+	kept := views[:0]
+	for _, view := range views {
+		if view.Spouse != nil || len(view.Children) > 0 {
+			kept = append(kept, view)
+		}
+	}
+	return kept
+}
+
+// bornBefore 按出生日期排序，无日期的按ID排在最后
+func (g *generator) bornBefore(a, b int) bool {
+	var da, db *time.Time
+	if p, ok := g.people[a]; ok {
+		da = p.ind.BirthDate
+	}
+	if p, ok := g.people[b]; ok {
+		db = p.ind.BirthDate
+	}
+	switch {
+	case da != nil && db != nil && !da.Equal(*db):
+		return da.Before(*db)
+	case da != nil && db == nil:
+		return true
+	case da == nil && db != nil:
+		return false
+	}
+	return a < b
+}
+
+// writeIndexes 写入首页、姓氏索引、地点索引和搜索页
+func (g *generator) writeIndexes() error {
+	var public []*person
+	redacted := 0
+	for _, p := range g.order {
+		if p.living {
+			redacted++
+		} else {
+			public = append(public, p)
+		}
+	}
+	sort.SliceStable(public, func(i, j int) bool {
+		return g.bornBefore(public[i].ind.IndividualID, public[j].ind.IndividualID)
+	})
+
+	surnames := g.surnameGroups(public)
+	home := &homeView{
+		page:        page{Title: g.siteName(), Site: g.siteName()},
+		Description: g.data.Tree.Description,
+		Public:      len(public),
+		Redacted:    redacted,
+		Surnames:    surnames,
+	}
+	if root := g.data.Tree.RootPersonID; root != nil {
+		home.Start = g.linkTo(*root, "")
+	}
+	if err := g.writePage("index.html", "home", home); err != nil {
+		return err
+	}
+	if err := g.writePage("surnames.html", "index", &indexView{
+		page:   page{Title: "姓氏索引", Site: g.siteName()},
+		Groups: surnames,
+	}); err != nil {
+		return err
+	}
+	if err := g.writePage("places.html", "index", &indexView{
+		page:   page{Title: "地点索引", Site: g.siteName()},
+		Groups: g.placeGroups(public),
+	}); err != nil {
+		return err
+	}
+	if err := g.writePage("search.html", "search", &page{Title: "搜索", Site: g.siteName()}); err != nil {
+		return err
+	}
+	return g.writeSearchIndex(public)
+}
+
+// surnameGroups 按姓氏分组
+func (g *generator) surnameGroups(public []*person) []indexGroup {
+	groups := map[string][]indexEntry{}
+	for _, p := range public {
+		groups[p.surname] = append(groups[p.surname], indexEntry{link: *g.linkTo(p.ind.IndividualID, ""), Detail: narrative.AlternateNames(p.ind)})
+	}
+	return sortedGroups(groups, "s")
+}
+
+// placeGroups 按地点分组，列出在该地出生、逝世、安葬、结婚及发生其他事件的人
+func (g *generator) placeGroups(public []*person) []indexGroup {
+	groups := map[string][]indexEntry{}
+	seen := map[string]bool{}
+	add := func(p *person, place, what string) {
+		// 个人、家庭中的地点与出生、结婚等事件常常重复，只列一次
+		key := fmt.Sprintf("%s\x00%d\x00%s", place, p.ind.IndividualID, what)
+		if place == "" || seen[key] {
+			return
+		}
+		seen[key] = true
+		l := g.linkTo(p.ind.IndividualID, "")
+		groups[place] = append(groups[place], indexEntry{link: *l, Detail: what})
+	}
+	for _, p := range public {
+		ind := p.ind
+		add(p, g.placeName(ind.BirthPlaceID, ind.BirthPlace), joinNonEmpty("出生", narrative.FormatDate(ind.BirthDate)))
+		add(p, g.placeName(ind.DeathPlaceID, ind.DeathPlace), joinNonEmpty("逝世", narrative.FormatDate(ind.DeathDate)))
+		add(p, g.placeName(ind.BurialPlaceID, ind.BurialPlace), "安葬")
+		for _, family := range g.families[ind.IndividualID] {
+			if spouse, ok := g.people[otherPartner(family, ind.IndividualID)]; ok && spouse.living {
+				continue
+			}
+			add(p, g.placeName(family.MarriagePlaceID, nil), joinNonEmpty("结婚", narrative.FormatDate(family.MarriageDate)))
+		}
+		for _, event := range p.events {
+			add(p, g.placeName(event.EventPlaceID, nil), joinNonEmpty(narrative.EventName(event.EventType), narrative.FormatDate(event.EventDate)))
+		}
+	}
+	return sortedGroups(groups, "p")
+}
+
+// writeSearchIndex 写入搜索索引，以脚本形式加载，直接打开本地文件时也能使用
+func (g *generator) writeSearchIndex(public []*person) error {
+	entries := make([]searchEntry, 0, len(public))
+	for _, p := range public {
+		ind := p.ind
+		var places []string
+		for _, place := range []string{
+			g.placeName(ind.BirthPlaceID, ind.BirthPlace),
+			g.placeName(ind.DeathPlaceID, ind.DeathPlace),
+			g.placeName(ind.BurialPlaceID, ind.BurialPlace),
+		} {
+			if place != "" && !contains(places, place) {
+				places = append(places, place)
+			}
+		}
+		entries = append(entries, searchEntry{
+			ID:     ind.IndividualID,
+			Name:   ind.FullName,
+			Alt:    narrative.AlternateNames(ind),
+			Years:  narrative.Lifespan(ind),
+			Places: strings.Join(places, " "),
+			URL:    fmt.Sprintf("people/%d.html", ind.IndividualID),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return g.writeFile("search-index.js", []byte("window.SEARCH_INDEX = "+string(data)+";\n"))
+}
+
+// writeAssets 写入样式表和搜索脚本
+func (g *generator) writeAssets() error {
+	if err := g.writeFile("style.css", []byte(styleSheet)); err != nil {
+		return err
+	}
+	return g.writeFile("search.js", []byte(searchScript))
+}
+
+// writePage 用模板渲染一页
+func (g *generator) writePage(name, tmpl string, data interface{}) error {
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, tmpl, data); err != nil {
+		return fmt.Errorf("渲染 %s 失败: %w", name, err)
+	}
+	return g.writeFile(name, buf.Bytes())
+}
+
+// sortedGroups 分组按名称排序，锚点按顺序编号
+func sortedGroups(groups map[string][]indexEntry, prefix string) []indexGroup {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	result := make([]indexGroup, 0, len(names))
+	for i, name := range names {
+		result = append(result, indexGroup{Anchor: fmt.Sprintf("%s%d", prefix, i+1), Name: name, Entries: groups[name]})
+	}
+	return result
+}
+
+// otherPartner 家庭中另一方的ID，没有时为 0
+func otherPartner(family models.Family, id int) int {
+	for _, partner := range partners(family) {
+		if partner != id {
+			return partner
+		}
+	}
+	return 0
+}
+
+// otherParent 子女的另一位父母，没有时为 0
+func otherParent(child *models.Individual, parentID int) int {
+	for _, id := range []*int{child.FatherID, child.MotherID} {
+		if id != nil && *id != parentID {
+			return *id
+		}
+	}
+	return 0
+}
+
+// joinNonEmpty 用中文逗号连接非空片段
+func joinNonEmpty(parts ...string) string {
+	var kept []string
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			kept = append(kept, part)
+		}
+	}
+	return strings.Join(kept, "，")
+}
+
+// contains 字符串切片中是否已有 s
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// appendUnique 追加不重复的编号
+func appendUnique(list []int, n int) []int {
+	for _, v := range list {
+		if v == n {
+			return list
+		}
+	}
+	return append(list, n)
+}
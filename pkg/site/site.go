@@ -0,0 +1,332 @@
+// Package site 将一棵家族树导出为可离线浏览的静态网站
+//
+// 每人一页（父母、配偶、子女、事件、来源和照片），另有姓氏索引、地点索引和浏览器端搜索。
+// 可能在世的人只保留姓氏，不出现在索引和搜索中。输出不含生成时间，
+// 所有列表都按固定顺序排列，同样的数据总是生成完全相同的文件，便于比对和托管。
+package site
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"familytree/models"
+	"familytree/pkg/narrative"
+)
+
+// DefaultLivingYears 默认的在世判断年限
+const DefaultLivingYears = 100
+
+// Options 生成选项
+type Options struct {
+	AsOf        time.Time // 判断是否在世的基准日期，为零时取当天
+	LivingYears int       // 为 0 时使用 DefaultLivingYears
+	PhotoLoader PhotoLoader
+}
+
+// PhotoLoader 按 photo_url 读取照片内容，为空时页面直接引用原地址
+type PhotoLoader func(url string) ([]byte, error)
+
+// Data 网站内容
+type Data struct {
+	Tree      models.UserFamilyTree
+	People    []models.Individual // 家族树全部成员，已填充字、号
+	Families  []models.Family
+	Children  []models.Child
+	Events    []models.Event
+	Places    []models.Place
+	Citations []models.Citation // 个人、家庭、事件的引用，Source 必须已填充
+}
+
+// photoTypes 支持的照片类型及扩展名
+var photoTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// person 网站中的一人
+type person struct {
+	ind     *models.Individual
+	living  bool
+	surname string
+	events  []models.Event
+	photo   string // 相对站点根目录的路径或原始地址
+}
+
+// childLink 子女与所在家庭
+type childLink struct {
+	id           int
+	familyID     int // 来自 father_id/mother_id 时为 0
+	relationship string
+}
+
+// generator 生成过程中的索引
+type generator struct {
+	dir        string
+	data       *Data
+	opts       Options
+	people     map[int]*person
+	order      []*person // 按 ID 排序
+	places     map[int]string
+	familyByID map[int]models.Family
+	families   map[int][]models.Family // 按伴侣索引
+	childRows  map[int][]models.Child  // 按子女索引
+	children   map[int][]childLink     // 按父母索引
+	citations  map[models.EntityType]map[int][]models.Citation
+	files      int
+	photoCount int
+}
+
+// Generate 在 dir 下生成静态网站，已存在的同名文件会被覆盖
+func Generate(dir string, data *Data, opts Options) (*models.SiteResult, error) {
+	if opts.AsOf.IsZero() {
+		opts.AsOf = time.Now()
+	}
+	if opts.LivingYears <= 0 {
+		opts.LivingYears = DefaultLivingYears
+	}
+	g := newGenerator(dir, data, opts)
+
+	for _, sub := range []string{"", "people"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, fmt.Errorf("创建目录失败: %w", err)
+		}
+	}
+	g.loadPhotos()
+
+	if err := g.writeAssets(); err != nil {
+		return nil, err
+	}
+	for _, p := range g.order {
+		if err := g.writePage(filepath.Join("people", fmt.Sprintf("%d.html", p.ind.IndividualID)), "person", g.personPage(p)); err != nil {
+			return nil, err
+		}
+	}
+	if err := g.writeIndexes(); err != nil {
+		return nil, err
+	}
+
+	result := &models.SiteResult{
+		FamilyTreeID: data.Tree.FamilyTreeID,
+		Dir:          dir,
+		People:       len(g.order),
+		Files:        g.files,
+		Photos:       g.photoCount,
+	}
+	for _, p := range g.order {
+		if p.living {
+			result.Redacted++
+		}
+	}
+	return result, nil
+}
+
+// newGenerator 建立人物、家庭、子女和引用的索引
+func newGenerator(dir string, data *Data, opts Options) *generator {
+	g := &generator{
+		dir:        dir,
+		data:       data,
+		opts:       opts,
+		people:     map[int]*person{},
+		places:     map[int]string{},
+		familyByID: map[int]models.Family{},
+		families:   map[int][]models.Family{},
+		childRows:  map[int][]models.Child{},
+		children:   map[int][]childLink{},
+		citations:  map[models.EntityType]map[int][]models.Citation{},
+	}
+	for i := range data.People {
+		ind := &data.People[i]
+		if _, ok := g.people[ind.IndividualID]; ok {
+			continue
+		}
+		p := &person{ind: ind, surname: narrative.Surname(ind.FullName)}
+		g.people[ind.IndividualID] = p
+		g.order = append(g.order, p)
+	}
+	sort.Slice(g.order, func(i, j int) bool { return g.order[i].ind.IndividualID < g.order[j].ind.IndividualID })
+
+	for _, place := range data.Places {
+		g.places[place.PlaceID] = place.PlaceName
+	}
+	for _, event := range data.Events {
+		if p, ok := g.people[event.IndividualID]; ok {
+			p.events = append(p.events, event)
+		}
+	}
+	for _, p := range g.order {
+		sort.SliceStable(p.events, func(i, j int) bool { return eventBefore(p.events[i], p.events[j]) })
+	}
+
+	for _, family := range data.Families {
+		if _, ok := g.familyByID[family.FamilyID]; ok {
+			continue
+		}
+		g.familyByID[family.FamilyID] = family
+		for _, id := range partners(family) {
+			g.families[id] = append(g.families[id], family)
+		}
+	}
+	for id := range g.families {
+		list := g.families[id]
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].MarriageOrder != list[j].MarriageOrder {
+				return list[i].MarriageOrder < list[j].MarriageOrder
+			}
+			return list[i].FamilyID < list[j].FamilyID
+		})
+	}
+
+	// 子女：children 表与 father_id/mother_id 合并，同一子女只记一次
+	seen := map[[2]int]bool{}
+	for _, row := range data.Children {
+		g.childRows[row.IndividualID] = append(g.childRows[row.IndividualID], row)
+		for _, id := range partners(g.familyByID[row.FamilyID]) {
+			if !seen[[2]int{id, row.IndividualID}] {
+				seen[[2]int{id, row.IndividualID}] = true
+				g.children[id] = append(g.children[id], childLink{id: row.IndividualID, familyID: row.FamilyID, relationship: row.RelationshipToParents})
+			}
+		}
+	}
+	for _, p := range g.order {
+		for _, parentID := range []*int{p.ind.FatherID, p.ind.MotherID} {
+			if parentID != nil && !seen[[2]int{*parentID, p.ind.IndividualID}] {
+				seen[[2]int{*parentID, p.ind.IndividualID}] = true
+				g.children[*parentID] = append(g.children[*parentID], childLink{id: p.ind.IndividualID})
+			}
+		}
+	}
+
+	for _, c := range data.Citations {
+		if c.Source == nil {
+			continue
+		}
+		byID := g.citations[c.EntityType]
+		if byID == nil {
+			byID = map[int][]models.Citation{}
+			g.citations[c.EntityType] = byID
+		}
+		byID[c.EntityID] = append(byID[c.EntityID], c)
+	}
+	for _, byID := range g.citations {
+		for id := range byID {
+			list := byID[id]
+			sort.Slice(list, func(i, j int) bool { return list[i].CitationID < list[j].CitationID })
+		}
+	}
+
+	for _, p := range g.order {
+		p.living = g.isLiving(p)
+	}
+	return g
+}
+
+// isLiving 没有死亡记录且出生不足 LivingYears 年的人视为在世。
+// 没有出生日期时以最早出生的子女推算（早于子女 15 年），仍无法判断的按在世处理。
+func (g *generator) isLiving(p *person) bool {
+	ind := p.ind
+	if ind.DeathDate != nil || ind.DeathPlaceID != nil || ind.BurialPlaceID != nil ||
+		(ind.DeathPlace != nil && *ind.DeathPlace != "") || (ind.BurialPlace != nil && *ind.BurialPlace != "") {
+		return false
+	}
+	year := 0
+	for _, event := range p.events {
+		switch strings.ToLower(event.EventType) {
+		case "death", "burial":
+			return false
+		case "birth", "christening", "baptism":
+			if year == 0 && event.EventDate != nil {
+				year = event.EventDate.Year()
+			}
+		}
+	}
+	if ind.BirthDate != nil {
+		year = ind.BirthDate.Year()
+	}
+	if year == 0 {
+		for _, child := range g.children[ind.IndividualID] {
+			if c, ok := g.people[child.id]; ok && c.ind.BirthDate != nil {
+				if estimate := c.ind.BirthDate.Year() - 15; year == 0 || estimate < year {
+					year = estimate
+				}
+			}
+		}
+	}
+	if year == 0 {
+		return true
+	}
+	return year > g.opts.AsOf.Year()-g.opts.LivingYears
+}
+
+// loadPhotos 确定每人照片的地址，配置了 PhotoLoader 时下载到 photos/ 目录；
+// 在世的人不显示照片，读取失败或格式不支持的照片直接略过
+func (g *generator) loadPhotos() {
+	for _, p := range g.order {
+		if p.living || p.ind.PhotoURL == nil || strings.TrimSpace(*p.ind.PhotoURL) == "" {
+			continue
+		}
+		url := strings.TrimSpace(*p.ind.PhotoURL)
+		if g.opts.PhotoLoader == nil {
+			p.photo = url
+			continue
+		}
+		data, err := g.opts.PhotoLoader(url)
+		if err != nil {
+			continue
+		}
+		ext, ok := photoTypes[http.DetectContentType(data)]
+		if !ok {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Join(g.dir, "photos"), 0o755); err != nil {
+			continue
+		}
+		name := fmt.Sprintf("photos/%d%s", p.ind.IndividualID, ext)
+		if err := g.writeFile(name, data); err != nil {
+			continue
+		}
+		p.photo = name
+		g.photoCount++
+	}
+}
+
+// writeFile 写入站点目录下的文件
+func (g *generator) writeFile(name string, data []byte) error {
+	if err := os.WriteFile(filepath.Join(g.dir, filepath.FromSlash(name)), data, 0o644); err != nil {
+		return fmt.Errorf("写入 %s 失败: %w", name, err)
+	}
+	g.files++
+	return nil
+}
+
+// partners 家庭中的夫妻ID
+func partners(family models.Family) []int {
+	var ids []int
+	for _, id := range []*int{family.HusbandID, family.WifeID} {
+		if id != nil {
+			ids = append(ids, *id)
+		}
+	}
+	return ids
+}
+
+// eventBefore 事件按日期排序，无日期的排在最后
+func eventBefore(a, b models.Event) bool {
+	switch {
+	case a.EventDate == nil && b.EventDate == nil:
+		return a.EventID < b.EventID
+	case a.EventDate == nil:
+		return false
+	case b.EventDate == nil:
+		return true
+	case !a.EventDate.Equal(*b.EventDate):
+		return a.EventDate.Before(*b.EventDate)
+	}
+	return a.EventID < b.EventID
+}
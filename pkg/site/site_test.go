@@ -0,0 +1,106 @@
+package site
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"familytree/models"
+)
+
+func sampleData() *Data {
+	date := func(year int) *time.Time {
+		t := time.Date(year, 3, 1, 0, 0, 0, 0, time.UTC)
+		return &t
+	}
+	ids := []int{0, 1, 2, 3, 4, 5}
+	placeID := 9
+	source := &models.Source{SourceID: 1, Title: "张氏族谱"}
+	return &Data{
+		Tree: models.UserFamilyTree{FamilyTreeID: 1, FamilyTreeName: "张氏家族", RootPersonID: &ids[1]},
+		People: []models.Individual{
+			// 祖父没有出生日期，由子女的出生年份推断已不在世
+			{IndividualID: 1, FullName: "张大山", Gender: models.GenderMale, BirthPlaceID: &placeID},
+			{IndividualID: 2, FullName: "李秀英", Gender: models.GenderFemale, BirthDate: date(1902), DeathDate: date(1980)},
+			{IndividualID: 3, FullName: "张明", Gender: models.GenderMale, BirthDate: date(1915), FatherID: &ids[1], MotherID: &ids[2]},
+			{IndividualID: 4, FullName: "张小龙", Gender: models.GenderMale, BirthDate: date(1990), FatherID: &ids[3]},
+			{IndividualID: 5, FullName: "王丽", Gender: models.GenderFemale, BirthDate: date(1918)},
+		},
+		Families: []models.Family{
+			{FamilyID: 10, HusbandID: &ids[1], WifeID: &ids[2], MarriageDate: date(1922)},
+			{FamilyID: 11, HusbandID: &ids[1], WifeID: &ids[2]},
+		},
+		Children: []models.Child{
+			{FamilyID: 10, IndividualID: 3, RelationshipToParents: "biological"},
+			{FamilyID: 10, IndividualID: 5, RelationshipToParents: "adopted"},
+		},
+		Events: []models.Event{{EventID: 100, IndividualID: 3, EventType: "graduation", EventDate: date(1938), EventPlaceID: &placeID}},
+		Places: []models.Place{{PlaceID: placeID, PlaceName: "北京"}},
+		Citations: []models.Citation{
+			{CitationID: 1, SourceID: 1, EntityType: models.EntityTypeEvent, EntityID: 100, PageNumber: "卷二", Source: source},
+		},
+	}
+}
+
+func read(t *testing.T, dir, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestGenerate(t *testing.T) {
+	dir := t.TempDir()
+	opts := Options{AsOf: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	result, err := Generate(dir, sampleData(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.People != 5 || result.Redacted != 1 {
+		t.Errorf("在世判断错误: %+v", result)
+	}
+
+	person := read(t, dir, "people/3.html")
+	for _, s := range []string{
+		"<h1>张明</h1>",
+		`父亲：<a href="../people/1.html">张大山</a>`,
+		`<a href="../people/4.html">张（在世）</a></li>`,
+		"<td>毕业</td><td>北京</td>",
+		`<li id="src1" value="1">《张氏族谱》，卷二。</li>`,
+	} {
+		if !strings.Contains(person, s) {
+			t.Errorf("人物页缺少 %q:\n%s", s, person)
+		}
+	}
+	if root := read(t, dir, "people/1.html"); !strings.Contains(root, `王丽</a>（1918–）（收养）`) {
+		t.Errorf("收养子女未标注:\n%s", root)
+	}
+
+	living := read(t, dir, "people/4.html")
+	if strings.Contains(living, "张小龙") || strings.Contains(living, "1990") {
+		t.Errorf("在世人员信息未隐去:\n%s", living)
+	}
+	for _, name := range []string{"search-index.js", "surnames.html", "places.html"} {
+		if content := read(t, dir, name); strings.Contains(content, "张小龙") || strings.Contains(content, "people/4.html") {
+			t.Errorf("%s 包含在世人员", name)
+		}
+	}
+	if places := read(t, dir, "places.html"); !strings.Contains(places, "毕业，1938年3月1日") {
+		t.Errorf("地点索引缺少事件:\n%s", places)
+	}
+
+	// 同样的数据再生成一次，文件内容完全相同
+	again := t.TempDir()
+	if _, err := Generate(again, sampleData(), opts); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"index.html", "people/1.html", "people/3.html", "surnames.html", "places.html", "search-index.js"} {
+		if read(t, dir, name) != read(t, again, name) {
+			t.Errorf("%s 两次生成结果不同", name)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package site
+
+import "html/template"
+
+// templates 页面模板，所有链接都是相对路径，站点可以放在任意目录下
+var templates = template.Must(template.New("site").Parse(`
+{{- define "head" -}}
+<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{if ne .Title .Site}}{{.Title}} - {{end}}{{.Site}}</title>
+<link rel="stylesheet" href="{{.Root}}style.css">
+</head>
+<body>
+<nav><a href="{{.Root}}index.html">{{.Site}}</a> · <a href="{{.Root}}surnames.html">姓氏索引</a> · <a href="{{.Root}}places.html">地点索引</a> · <a href="{{.Root}}search.html">搜索</a></nav>
+<main>
+{{end -}}
+
+{{- define "foot" -}}
+</main>
+</body>
+</html>
+{{end -}}
+
+{{- define "link" -}}
+<a href="{{.Href}}">{{.Name}}</a>{{if .Lifespan}}（{{.Lifespan}}）{{end}}
+{{- end -}}
+
+{{- define "person" -}}
+{{template "head" .}}
+<h1>{{.Name}}</h1>
+{{if .Living}}<p class="notice">此人可能在世，为保护隐私不公开其信息。</p>
+{{end -}}
+{{if .Photo}}<img class="photo" src="{{.Photo}}" alt="{{.Name}}">
+{{end -}}
+{{with .Facts}}<table class="facts">
+{{range .}}<tr><th>{{.Label}}</th><td>{{.Value}}</td></tr>
+{{end}}</table>
+{{end -}}
+{{with .Parents}}<h2>父母</h2>
+<ul>
+{{range .}}<li>{{.Note}}：{{template "link" .}}</li>
+{{end}}</ul>
+{{end -}}
+{{with .Families}}<h2>配偶与子女</h2>
+{{range .}}<section class="family">
+<h3>{{if .Spouse}}配偶：{{template "link" .Spouse}}{{else}}配偶不详{{end}}</h3>
+{{if .Marriage}}<p>{{.Marriage}}</p>
+{{end -}}
+{{with .Children}}<ol>
+{{range .}}<li>{{template "link" .}}{{if .Note}}（{{.Note}}）{{end}}</li>
+{{end}}</ol>
+{{end -}}
+</section>
+{{end}}{{end -}}
+{{with .Events}}<h2>事件</h2>
+<table class="events">
+<tr><th>日期</th><th>事件</th><th>地点</th><th>说明</th></tr>
+{{range .}}<tr><td>{{.Date}}</td><td>{{.Name}}</td><td>{{.Place}}</td><td>{{.Description}}{{range .Notes}}<sup><a href="#src{{.}}">{{.}}</a></sup>{{end}}</td></tr>
+{{end}}</table>
+{{end -}}
+{{with .Sources}}<h2>来源</h2>
+<ol class="sources">
+{{range .}}<li id="src{{.Number}}" value="{{.Number}}">{{.Text}}</li>
+{{end}}</ol>
+{{end -}}
+{{template "foot" .}}
+{{- end -}}
+
+{{- define "home" -}}
+{{template "head" .}}
+<h1>{{.Site}}</h1>
+{{if .Description}}<p>{{.Description}}</p>
+{{end -}}
+<p>收录 {{.Public}} 人{{if .Redacted}}，另有 {{.Redacted}} 位可能在世的成员不公开信息{{end}}。</p>
+{{with .Start}}<p>起始人物：{{template "link" .}}</p>
+{{end -}}
+<h2>姓氏</h2>
+<ul class="surnames">
+{{range .Surnames}}<li><a href="surnames.html#{{.Anchor}}">{{.Name}}</a>（{{len .Entries}}）</li>
+{{end}}</ul>
+{{template "foot" .}}
+{{- end -}}
+
+{{- define "index" -}}
+{{template "head" .}}
+<h1>{{.Title}}</h1>
+<p class="toc">{{range .Groups}}<a href="#{{.Anchor}}">{{.Name}}</a> {{end}}</p>
+{{range .Groups}}<h2 id="{{.Anchor}}">{{.Name}}</h2>
+<ul>
+{{range .Entries}}<li>{{template "link" .}}{{if .Detail}}　{{.Detail}}{{end}}</li>
+{{end}}</ul>
+{{end -}}
+{{template "foot" .}}
+{{- end -}}
+
+{{- define "search" -}}
+{{template "head" .}}
+<h1>搜索</h1>
+<input id="q" type="search" placeholder="姓名、字号、年份或地点" autofocus>
+<p id="count"></p>
+<ul id="results"></ul>
+<noscript><p>搜索需要启用 JavaScript，也可以使用<a href="surnames.html">姓氏索引</a>。</p></noscript>
+<script src="search-index.js"></script>
+<script src="search.js"></script>
+{{template "foot" .}}
+{{- end -}}
+`))
+
+// styleSheet 全站样式
+const styleSheet = `body { margin: 0; font-family: "Noto Serif CJK SC", "Songti SC", serif; color: #222; background: #fdfcf8; line-height: 1.7; }
+nav { padding: 0.6em 1.5em; background: #7a2e1d; color: #f5e9dc; }
+nav a { color: #fff; text-decoration: none; }
+main { max-width: 52em; margin: 0 auto; padding: 1em 1.5em 3em; }
+h1 { border-bottom: 2px solid #7a2e1d; padding-bottom: 0.2em; }
+h2 { color: #7a2e1d; margin-top: 1.6em; }
+a { color: #7a2e1d; }
+table { border-collapse: collapse; margin: 0.5em 0; }
+th, td { border: 1px solid #ddd; padding: 0.3em 0.7em; text-align: left; vertical-align: top; }
+th { background: #f3ede4; white-space: nowrap; }
+.photo { float: right; max-width: 12em; margin: 0 0 1em 1em; border: 1px solid #ccc; }
+.notice { color: #666; font-style: italic; }
+.family { margin-left: 1em; }
+.toc a { margin-right: 0.6em; }
+.surnames li { display: inline-block; margin-right: 1.2em; }
+.sources { font-size: 0.9em; }
+#q { width: 100%; font-size: 1.1em; padding: 0.4em; box-sizing: border-box; }
+`
+
+// searchScript 浏览器端搜索，索引由 search-index.js 提供
+const searchScript = `(function () {
+  var index = window.SEARCH_INDEX || [];
+  var input = document.getElementById('q');
+  var list = document.getElementById('results');
+  var count = document.getElementById('count');
+
+  function haystack(entry) {
+    return [entry.name, entry.alt || '', entry.years || '', entry.places || ''].join(' ').toLowerCase();
+  }
+
+  function render() {
+    var terms = input.value.trim().toLowerCase().split(/\s+/).filter(Boolean);
+    list.innerHTML = '';
+    if (!terms.length) {
+      count.textContent = '';
+      return;
+    }
+    var hits = index.filter(function (entry) {
+      var text = haystack(entry);
+      return terms.every(function (term) { return text.indexOf(term) >= 0; });
+    });
+    count.textContent = '找到 ' + hits.length + ' 人';
+    hits.slice(0, 200).forEach(function (entry) {
+      var item = document.createElement('li');
+      var link = document.createElement('a');
+      link.href = entry.url;
+      link.textContent = entry.name;
+      item.appendChild(link);
+      var details = [entry.years, entry.alt, entry.places].filter(Boolean).join('，');
+      if (details) {
+        item.appendChild(document.createTextNode('（' + details + '）'));
+      }
+      list.appendChild(item);
+    });
+  }
+
+  input.addEventListener('input', render);
+  var query = new URLSearchParams(window.location.search).get('q');
+  if (query) {
+    input.value = query;
+  }
+  render();
+})();
+`
@@ -0,0 +1,280 @@
+// Package spreadsheet 读写 CSV 与 XLSX 表格
+//
+// 表格的第一个非空行是表头，之后每个非空行是一条记录，记录保留其在表格中的行号（从 1 开始，
+// 与 Excel 中显示的一致），便于指出出错的行。CSV 可以是 UTF-8（可带 BOM）或 Excel 中文版保存的
+// GB18030，分隔符为逗号、分号或制表符。XLSX 中设置了日期格式的单元格读作 YYYY-MM-DD。
+//
+// 写出时逐行写入，适合导出大量记录。
+package spreadsheet
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// Format 表格格式
+type Format string
+
+const (
+	FormatCSV  Format = "csv"
+	FormatXLSX Format = "xlsx"
+)
+
+// FormatFromName 按文件扩展名判断格式
+func FormatFromName(name string) (Format, bool) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv", ".txt":
+		return FormatCSV, true
+	case ".xlsx":
+		return FormatXLSX, true
+	}
+	return "", false
+}
+
+// Row 一条记录
+type Row struct {
+	Number int      // 在表格中的行号
+	Cells  []string // 与表头对齐，缺少的单元格为空字符串
+}
+
+// Value 第 i 列的值，已去掉首尾空白
+func (r Row) Value(i int) string {
+	if i < 0 || i >= len(r.Cells) {
+		return ""
+	}
+	return strings.TrimSpace(r.Cells[i])
+}
+
+// Table 读取的表格
+type Table struct {
+	Sheet  string // XLSX 的工作表名称
+	Header []string
+	Rows   []Row
+}
+
+// Column 表头为 name 的列序号，不存在时返回 -1
+func (t *Table) Column(name string) int {
+	for i, header := range t.Header {
+		if header == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// ReadOptions 读取选项
+type ReadOptions struct {
+	Sheet   string // XLSX 的工作表，为空时读取第一个
+	MaxRows int    // 最多读取的记录数，为 0 时不限；超出时返回错误
+}
+
+// Read 读取表格
+func Read(r io.Reader, format Format, opts ReadOptions) (*Table, error) {
+	var (
+		sheet string
+		rows  []Row
+		err   error
+	)
+	switch format {
+	case FormatCSV:
+		rows, err = readCSV(r)
+	case FormatXLSX:
+		sheet, rows, err = readXLSX(r, opts.Sheet)
+	default:
+		return nil, fmt.Errorf("不支持的表格格式: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	table := &Table{Sheet: sheet}
+	for _, row := range rows {
+		if isEmpty(row.Cells) {
+			continue
+		}
+		if table.Header == nil {
+			table.Header = make([]string, len(row.Cells))
+			for j, cell := range row.Cells {
+				table.Header[j] = strings.TrimSpace(cell)
+			}
+			continue
+		}
+		if opts.MaxRows > 0 && len(table.Rows) >= opts.MaxRows {
+			return nil, fmt.Errorf("表格超过 %d 行", opts.MaxRows)
+		}
+		cells := make([]string, len(table.Header))
+		copy(cells, row.Cells)
+		table.Rows = append(table.Rows, Row{Number: row.Number, Cells: cells})
+	}
+	if table.Header == nil {
+		return nil, fmt.Errorf("表格为空")
+	}
+	return table, nil
+}
+
+// readCSV 读取 CSV 的全部记录。encoding/csv 跳过空行，行号按记录在文件中的位置计算，与 Excel 打开时一致
+func readCSV(r io.Reader) ([]Row, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("读取文件失败: %v", err)
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		if data, err = simplifiedchinese.GB18030.NewDecoder().Bytes(data); err != nil {
+			return nil, fmt.Errorf("无法识别文件编码，请保存为 UTF-8: %v", err)
+		}
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = sniffDelimiter(data)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	var rows []Row
+	number, endLine := 0, 0
+	for {
+		cells, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("解析 CSV 失败: %v", err)
+		}
+		// 与上一条记录之间的空行各占一行；单元格中的换行不另占行
+		line, _ := reader.FieldPos(0)
+		number += line - endLine
+		last := len(cells) - 1
+		endLine, _ = reader.FieldPos(last)
+		endLine += strings.Count(cells[last], "\n")
+		rows = append(rows, Row{Number: number, Cells: cells})
+	}
+}
+
+// sniffDelimiter 按第一行中出现最多的字符选择分隔符，默认逗号
+func sniffDelimiter(data []byte) rune {
+	line := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		line = data[:i]
+	}
+	delimiter, most := ',', bytes.Count(line, []byte{','})
+	for _, c := range []rune{';', '\t'} {
+		if n := bytes.Count(line, []byte(string(c))); n > most {
+			delimiter, most = c, n
+		}
+	}
+	return delimiter
+}
+
+// readXLSX 读取工作表的全部行，日期格式的单元格转换为 YYYY-MM-DD
+func readXLSX(r io.Reader, sheet string) (string, []Row, error) {
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return "", nil, fmt.Errorf("打开 XLSX 失败: %v", err)
+	}
+	defer f.Close()
+
+	if sheet == "" {
+		sheets := f.GetSheetList()
+		if len(sheets) == 0 {
+			return "", nil, fmt.Errorf("XLSX 中没有工作表")
+		}
+		sheet = sheets[0]
+	} else if index, err := f.GetSheetIndex(sheet); err != nil || index < 0 {
+		return "", nil, fmt.Errorf("工作表 %q 不存在", sheet)
+	}
+
+	rows, err := f.GetRows(sheet, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return "", nil, fmt.Errorf("读取工作表失败: %v", err)
+	}
+
+	date1904 := false
+	if props, err := f.GetWorkbookProps(); err == nil && props.Date1904 != nil {
+		date1904 = *props.Date1904
+	}
+	dateStyles := make(map[int]bool)
+	for i, cells := range rows {
+		for j, cell := range cells {
+			serial, err := strconv.ParseFloat(cell, 64)
+			if err != nil {
+				continue
+			}
+			name, _ := excelize.CoordinatesToCellName(j+1, i+1)
+			styleID, err := f.GetCellStyle(sheet, name)
+			if err != nil {
+				continue
+			}
+			isDate, ok := dateStyles[styleID]
+			if !ok {
+				isDate = isDateStyle(f, styleID)
+				dateStyles[styleID] = isDate
+			}
+			if !isDate {
+				continue
+			}
+			if t, err := excelize.ExcelDateToTime(serial, date1904); err == nil {
+				cells[j] = t.Format("2006-01-02")
+			}
+		}
+	}
+	result := make([]Row, len(rows))
+	for i, cells := range rows {
+		result[i] = Row{Number: i + 1, Cells: cells}
+	}
+	return sheet, result, nil
+}
+
+// isDateStyle 样式的数字格式是否为日期：内置的日期格式（含简体中文的日期格式，不含时间格式），或包含年、日的自定义格式
+func isDateStyle(f *excelize.File, styleID int) bool {
+	style, err := f.GetStyle(styleID)
+	if err != nil || style == nil {
+		return false
+	}
+	switch {
+	case style.NumFmt >= 14 && style.NumFmt <= 17,
+		style.NumFmt == 22,
+		style.NumFmt >= 27 && style.NumFmt <= 31,
+		style.NumFmt == 36,
+		style.NumFmt >= 50 && style.NumFmt <= 54,
+		style.NumFmt == 57 || style.NumFmt == 58:
+		return true
+	}
+	if style.CustomNumFmt == nil {
+		return false
+	}
+	// 去掉引号中的文字和方括号中的颜色、区域设置后再判断
+	var code strings.Builder
+	quoted, bracketed := false, false
+	for _, c := range *style.CustomNumFmt {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case !quoted && c == '[':
+			bracketed = true
+		case !quoted && c == ']':
+			bracketed = false
+		case !quoted && !bracketed:
+			code.WriteRune(c)
+		}
+	}
+	return strings.ContainsAny(strings.ToLower(code.String()), "yd年日")
+}
+
+// isEmpty 行中是否全为空白
+func isEmpty(cells []string) bool {
+	for _, cell := range cells {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
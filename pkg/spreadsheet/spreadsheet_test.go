@@ -0,0 +1,134 @@
+package spreadsheet
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func TestReadCSV(t *testing.T) {
+	gb, err := simplifiedchinese.GB18030.NewEncoder().String("姓名;性别\n\n张三;男\n李四\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string]string{
+		"UTF-8 带 BOM": "\xef\xbb\xbf姓名,性别\n\n张三,男\n李四\n",
+		"GB18030 分号":  gb,
+	} {
+		table, err := Read(strings.NewReader(data), FormatCSV, ReadOptions{})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(table.Header, []string{"姓名", "性别"}) {
+			t.Errorf("%s: 表头 %q", name, table.Header)
+		}
+		want := []Row{{Number: 3, Cells: []string{"张三", "男"}}, {Number: 4, Cells: []string{"李四", ""}}}
+		if !reflect.DeepEqual(table.Rows, want) {
+			t.Errorf("%s: 记录 %+v", name, table.Rows)
+		}
+	}
+
+	// 单元格中的换行不另占行
+	table, err := Read(strings.NewReader("姓名,备注\n甲,\"长房\n次子\"\n\n乙,\n"), FormatCSV, ReadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(table.Rows) != 2 || table.Rows[0].Number != 2 || table.Rows[1].Number != 4 || table.Rows[0].Value(1) != "长房\n次子" {
+		t.Errorf("多行单元格: %+v", table.Rows)
+	}
+
+	if _, err := Read(strings.NewReader("姓名\n甲\n乙\n丙\n"), FormatCSV, ReadOptions{MaxRows: 2}); err == nil {
+		t.Error("超过行数限制时应返回错误")
+	}
+	if _, err := Read(strings.NewReader("\n\n"), FormatCSV, ReadOptions{}); err == nil {
+		t.Error("空表格应返回错误")
+	}
+}
+
+func TestReadXLSX(t *testing.T) {
+	f := excelize.NewFile()
+	f.SetSheetRow("Sheet1", "A1", &[]interface{}{"姓名", "出生", "备注"})
+	f.SetSheetRow("Sheet1", "A2", &[]interface{}{"张三", 1930, 20000})
+	f.SetSheetRow("Sheet1", "A3", &[]interface{}{"李四", 20000, "长房"})
+	builtin, _ := f.NewStyle(&excelize.Style{NumFmt: 14})
+	f.SetCellStyle("Sheet1", "B3", "B3", builtin)
+	format := `yyyy"年"m"月"d"日"`
+	custom, _ := f.NewStyle(&excelize.Style{CustomNumFmt: &format})
+	f.SetCellStyle("Sheet1", "C2", "C2", custom)
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	table, err := Read(bytes.NewReader(buf.Bytes()), FormatXLSX, ReadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table.Sheet != "Sheet1" {
+		t.Errorf("工作表 %q", table.Sheet)
+	}
+	// 没有日期格式的数字保持原样，日期格式的转换为 YYYY-MM-DD
+	want := []Row{
+		{Number: 2, Cells: []string{"张三", "1930", "1954-10-03"}},
+		{Number: 3, Cells: []string{"李四", "1954-10-03", "长房"}},
+	}
+	if !reflect.DeepEqual(table.Rows, want) {
+		t.Errorf("记录 %+v", table.Rows)
+	}
+
+	if _, err := Read(bytes.NewReader(buf.Bytes()), FormatXLSX, ReadOptions{Sheet: "不存在"}); err == nil {
+		t.Error("不存在的工作表应返回错误")
+	}
+}
+
+func TestFormatFromName(t *testing.T) {
+	for name, want := range map[string]Format{"家谱.CSV": FormatCSV, "a.xlsx": FormatXLSX, "a.xls": ""} {
+		if got, _ := FormatFromName(name); got != want {
+			t.Errorf("%s: %q", name, got)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	for _, format := range []Format{FormatCSV, FormatXLSX} {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, format, "成员", []string{"编号", "姓名", "备注"})
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		w.Write([]interface{}{1, "张三", "=1+1"})
+		w.Write([]interface{}{2, "李四", nil})
+		if err := w.Close(); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+
+		// 写出的表格可以原样读回；CSV 中以 = 开头的文字加了单引号
+		table, err := Read(bytes.NewReader(buf.Bytes()), format, ReadOptions{})
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		formula := "=1+1"
+		if format == FormatCSV {
+			formula = "'=1+1"
+			if !bytes.HasPrefix(buf.Bytes(), []byte("\xef\xbb\xbf")) {
+				t.Errorf("CSV 应带 BOM")
+			}
+		} else if table.Sheet != "成员" {
+			t.Errorf("工作表 %q", table.Sheet)
+		}
+		want := []Row{{Number: 2, Cells: []string{"1", "张三", formula}}, {Number: 3, Cells: []string{"2", "李四", ""}}}
+		if !reflect.DeepEqual(table.Header, []string{"编号", "姓名", "备注"}) || !reflect.DeepEqual(table.Rows, want) {
+			t.Errorf("%s: %q %+v", format, table.Header, table.Rows)
+		}
+	}
+
+	if _, err := NewWriter(io.Discard, "xls", "", nil); err == nil {
+		t.Error("不支持的格式应返回错误")
+	}
+}
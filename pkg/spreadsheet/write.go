@@ -0,0 +1,156 @@
+package spreadsheet
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// ContentType 格式对应的 MIME 类型
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "application/octet-stream"
+}
+
+// Writer 逐行写出表格，单元格可以是字符串、整数或 nil（空单元格）
+type Writer interface {
+	Write(cells []interface{}) error
+	// Close 写出剩余内容；XLSX 在此时才写出整个文件
+	Close() error
+}
+
+// NewWriter 创建表格写出器并写出表头。CSV 带 UTF-8 BOM，Excel 可以直接打开；
+// XLSX 的行先写入临时文件，内存占用与行数无关
+func NewWriter(w io.Writer, format Format, sheet string, header []string) (Writer, error) {
+	cells := make([]interface{}, len(header))
+	for i, h := range header {
+		cells[i] = h
+	}
+
+	var writer Writer
+	switch format {
+	case FormatCSV:
+		buf := bufio.NewWriter(w)
+		if _, err := buf.WriteString("\xef\xbb\xbf"); err != nil {
+			return nil, err
+		}
+		writer = &csvWriter{buf: buf, csv: csv.NewWriter(buf)}
+	case FormatXLSX:
+		xw, err := newXLSXWriter(w, sheet)
+		if err != nil {
+			return nil, err
+		}
+		writer = xw
+	default:
+		return nil, fmt.Errorf("不支持的表格格式: %s", format)
+	}
+	if err := writer.Write(cells); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+// csvWriter CSV 写出器
+type csvWriter struct {
+	buf    *bufio.Writer
+	csv    *csv.Writer
+	record []string
+}
+
+func (c *csvWriter) Write(cells []interface{}) error {
+	c.record = c.record[:0]
+	for _, cell := range cells {
+		c.record = append(c.record, csvCell(cell))
+	}
+	return c.csv.Write(c.record)
+}
+
+func (c *csvWriter) Close() error {
+	c.csv.Flush()
+	if err := c.csv.Error(); err != nil {
+		return err
+	}
+	return c.buf.Flush()
+}
+
+// csvCell 单元格文字。以 = + - @ 开头的文字前加单引号，避免 Excel 把它当作公式执行
+func csvCell(cell interface{}) string {
+	switch v := cell.(type) {
+	case nil:
+		return ""
+	case string:
+		if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+			return "'" + v
+		}
+		return v
+	}
+	return fmt.Sprint(cell)
+}
+
+// xlsxWriter XLSX 写出器
+type xlsxWriter struct {
+	out    io.Writer
+	file   *excelize.File
+	stream *excelize.StreamWriter
+	row    int
+	bold   int
+}
+
+func newXLSXWriter(w io.Writer, sheet string) (*xlsxWriter, error) {
+	f := excelize.NewFile()
+	if sheet == "" {
+		sheet = "Sheet1"
+	} else if err := f.SetSheetName("Sheet1", sheet); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("设置工作表名称失败: %v", err)
+	}
+	stream, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("创建工作表失败: %v", err)
+	}
+	bold, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("创建样式失败: %v", err)
+	}
+	return &xlsxWriter{out: w, file: f, stream: stream, bold: bold}, nil
+}
+
+// Write 第一行（表头）加粗
+func (x *xlsxWriter) Write(cells []interface{}) error {
+	x.row++
+	values := make([]interface{}, len(cells))
+	for i, cell := range cells {
+		if x.row == 1 {
+			values[i] = excelize.Cell{StyleID: x.bold, Value: cell}
+		} else {
+			values[i] = cell
+		}
+	}
+	name, err := excelize.CoordinatesToCellName(1, x.row)
+	if err != nil {
+		return err
+	}
+	return x.stream.SetRow(name, values)
+}
+
+func (x *xlsxWriter) Close() error {
+	defer x.file.Close()
+	if err := x.stream.Flush(); err != nil {
+		return fmt.Errorf("写出工作表失败: %v", err)
+	}
+	if err := x.file.Write(x.out); err != nil {
+		return fmt.Errorf("写出 XLSX 失败: %v", err)
+	}
+	return nil
+}
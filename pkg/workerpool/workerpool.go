@@ -88,6 +88,18 @@ func (p *Pool) Submit(task Task) {
 	p.taskChan <- task
 }
 
+// TrySubmit 提交任务，队列已满时不等待，返回 false
+func (p *Pool) TrySubmit(task Task) bool {
+	p.wg.Add(1)
+	select {
+	case p.taskChan <- task:
+		return true
+	default:
+		p.wg.Done()
+		return false
+	}
+}
+
 // Wait 等待所有任务完成
 func (p *Pool) Wait() error {
 	p.wg.Wait()
@@ -0,0 +1,475 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"familytree/models"
+	"familytree/pkg/middleware"
+)
+
+// sqlExecutor *sql.DB 与 *sql.Tx 共有的方法，变更记录与业务写入在同一事务中完成
+type sqlExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// auditSpec 一类被记录变更的记录：表名、主键和快照查询（参数为主键）
+type auditSpec struct {
+	table    string
+	keys     []string
+	snapshot string
+}
+
+// where 按主键定位记录的条件及参数
+func (s auditSpec) where(keys []int) (string, []interface{}) {
+	conditions := make([]string, len(s.keys))
+	args := make([]interface{}, len(keys))
+	for i, key := range s.keys {
+		conditions[i] = key + " = ?"
+		args[i] = keys[i]
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// individualSnapshot 个人快照的查询，一并包含字、号
+const individualSnapshot = `
+	SELECT i.*,
+	       (SELECT name FROM individual_names WHERE individual_id = i.individual_id AND name_type = 'courtesy') AS courtesy_name,
+	       (SELECT name FROM individual_names WHERE individual_id = i.individual_id AND name_type = 'art') AS art_name
+	FROM individuals i`
+
+// auditSpecs 各类记录的表结构。地点、来源、引用和备注目前没有写入接口，不记录变更历史。
+// 回收站中的记录视为不存在，移入回收站记为删除，恢复记为新建
+var auditSpecs = map[models.EntityType]auditSpec{
+	models.EntityTypeIndividual: {"individuals", []string{"individual_id"}, individualSnapshot + ` WHERE i.individual_id = ? AND i.deleted_at IS NULL`},
+	models.EntityTypeFamily:     {"families", []string{"family_id"}, `SELECT * FROM families WHERE family_id = ? AND deleted_at IS NULL`},
+	models.EntityTypeChild:      {"children", []string{"family_id", "individual_id"}, `SELECT * FROM children WHERE family_id = ? AND individual_id = ? AND deleted_at IS NULL`},
+	models.EntityTypeEvent:      {"events", []string{"event_id"}, `SELECT * FROM events WHERE event_id = ? AND deleted_at IS NULL`},
+}
+
+// auditIgnored 不参与比较的字段，版本号随每次修改变化，同样不算作字段变更；删除标记由回收站维护
+var auditIgnored = map[string]bool{
+	"created_at": true, "updated_at": true, "version": true,
+	"deleted_at": true, "deleted_by": true, "trash_id": true,
+}
+
+// auditRecord 记录在某一时刻的全部字段及所属家族树
+type auditRecord struct {
+	columns []string
+	data    map[string]interface{}
+	treeID  *int
+}
+
+// auditTarget 一条被修改的记录及其修改前的快照，新建的记录没有快照
+type auditTarget struct {
+	entity models.EntityType
+	keys   []int
+	before *auditRecord
+}
+
+// auditor 一次写操作的操作人与变更集
+type auditor struct {
+	userID    *int
+	changeSet string
+	err       error // 生成变更集ID失败时在记录时返回
+}
+
+// newAuditor 从上下文取出操作人和变更集，HTTP 请求之外的调用各自生成变更集
+func newAuditor(ctx context.Context) auditor {
+	a := auditor{}
+	if user, ok := middleware.GetUserFromContext(ctx); ok {
+		a.userID = &user.UserID
+	}
+	if changeSet, ok := middleware.GetChangeSetFromContext(ctx); ok {
+		a.changeSet = changeSet
+	} else {
+		a.changeSet, a.err = middleware.NewChangeSetID()
+	}
+	return a
+}
+
+// auditTargetOf 读取记录修改前的快照
+func auditTargetOf(ctx context.Context, q sqlExecutor, entity models.EntityType, keys ...int) (auditTarget, error) {
+	before, err := auditSnapshot(ctx, q, entity, keys...)
+	return auditTarget{entity: entity, keys: keys, before: before}, err
+}
+
+// auditTargets 按查询结果中的主键批量读取快照，用于记录删除时一并消失的关联记录
+func auditTargets(ctx context.Context, q sqlExecutor, entity models.EntityType, query string, args ...interface{}) ([]auditTarget, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询关联记录失败: %v", err)
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+	var keyList [][]int
+	for rows.Next() {
+		keys := make([]int, len(columns))
+		dest := make([]interface{}, len(keys))
+		for i := range keys {
+			dest[i] = &keys[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("扫描关联记录失败: %v", err)
+		}
+		keyList = append(keyList, keys)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	targets := make([]auditTarget, 0, len(keyList))
+	for _, keys := range keyList {
+		target, err := auditTargetOf(ctx, q, entity, keys...)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// record 读取记录修改后的快照，与修改前比较后写入变更记录；没有实际变化时不记录
+func (a auditor) record(ctx context.Context, q sqlExecutor, targets ...auditTarget) error {
+	if a.err != nil {
+		return a.err
+	}
+	for _, t := range targets {
+		after, err := auditSnapshot(ctx, q, t.entity, t.keys...)
+		if err != nil {
+			return err
+		}
+
+		var action string
+		switch {
+		case t.before == nil && after == nil:
+			continue
+		case t.before == nil:
+			action = models.AuditActionCreate
+		case after == nil:
+			action = models.AuditActionDelete
+		default:
+			action = models.AuditActionUpdate
+		}
+		changes := auditDiff(t.before, after)
+		if action == models.AuditActionUpdate && len(changes) == 0 {
+			continue
+		}
+
+		treeID := (*int)(nil)
+		if after != nil {
+			treeID = after.treeID
+		}
+		if treeID == nil && t.before != nil {
+			treeID = t.before.treeID
+		}
+		changesJSON, err := json.Marshal(changes)
+		if err != nil {
+			return fmt.Errorf("序列化变更失败: %v", err)
+		}
+		_, err = q.ExecContext(ctx, `
+			INSERT INTO audit_log (change_set, family_tree_id, entity_type, entity_id, action, user_id, changes, before_data, after_data, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, a.changeSet, treeID, string(t.entity), auditEntityID(t.keys...), action, a.userID,
+			string(changesJSON), auditJSON(t.before), auditJSON(after), time.Now())
+		if err != nil {
+			return fmt.Errorf("写入变更记录失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// auditEntityID 记录的主键，复合主键以 / 连接
+func auditEntityID(keys ...int) string {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = strconv.Itoa(key)
+	}
+	return strings.Join(parts, "/")
+}
+
+// auditSnapshot 读取记录当前的全部字段，记录不存在时返回 nil
+func auditSnapshot(ctx context.Context, q sqlExecutor, entity models.EntityType, keys ...int) (*auditRecord, error) {
+	spec, ok := auditSpecs[entity]
+	if !ok {
+		return nil, fmt.Errorf("不支持记录 %s 的变更", entity)
+	}
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+
+	rows, err := q.QueryContext(ctx, spec.snapshot, args...)
+	if err != nil {
+		return nil, fmt.Errorf("读取 %s 快照失败: %v", entity, err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, fmt.Errorf("扫描 %s 快照失败: %v", entity, err)
+	}
+	rows.Close()
+
+	record := &auditRecord{columns: columns, data: make(map[string]interface{}, len(columns))}
+	for i, column := range columns {
+		record.data[column] = auditValue(values[i])
+	}
+	if record.treeID, err = auditTreeID(ctx, q, entity, record.data); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// auditValue 统一数据库取出的值，日期只保留到日
+func auditValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []byte:
+		return string(v)
+	case time.Time:
+		if v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 && v.Nanosecond() == 0 {
+			return v.Format("2006-01-02")
+		}
+		return v.Format(time.RFC3339)
+	}
+	return v
+}
+
+// auditTreeID 记录所属的家族树。家庭、子女、事件以成员所在的家族树为准，引用以来源为准，备注以所注记录为准
+func auditTreeID(ctx context.Context, q sqlExecutor, entity models.EntityType, data map[string]interface{}) (*int, error) {
+	lookup := func(query string, args ...interface{}) (*int, error) {
+		var treeID sql.NullInt64
+		err := q.QueryRowContext(ctx, query, args...).Scan(&treeID)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, fmt.Errorf("查询所属家族树失败: %v", err)
+		}
+		if !treeID.Valid {
+			return nil, nil
+		}
+		id := int(treeID.Int64)
+		return &id, nil
+	}
+	spouses := func(family map[string]interface{}) (*int, error) {
+		treeID, err := lookup(`SELECT family_tree_id FROM individuals WHERE individual_id IN (?, ?) AND family_tree_id IS NOT NULL LIMIT 1`,
+			family["husband_id"], family["wife_id"])
+		if treeID != nil || err != nil {
+			return treeID, err
+		}
+		return auditOptionalInt(family["family_tree_id"]), nil
+	}
+
+	switch entity {
+	case models.EntityTypeIndividual:
+		return auditOptionalInt(data["family_tree_id"]), nil
+	case models.EntityTypeFamily:
+		return spouses(data)
+	case models.EntityTypeChild, models.EntityTypeEvent:
+		return lookup(`SELECT family_tree_id FROM individuals WHERE individual_id = ?`, data["individual_id"])
+	}
+	return nil, nil
+}
+
+// auditInt 快照中的整数字段
+func auditInt(v interface{}) int {
+	switch v := v.(type) {
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	case string:
+		n, _ := strconv.Atoi(v)
+		return n
+	}
+	return 0
+}
+
+// auditOptionalInt 快照中可为空的整数字段
+func auditOptionalInt(v interface{}) *int {
+	if v == nil {
+		return nil
+	}
+	n := auditInt(v)
+	return &n
+}
+
+// sortedKeys 按字母顺序排列的字段名
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// auditDiff 逐字段比较前后快照
+func auditDiff(before, after *auditRecord) []models.FieldChange {
+	var columns []string
+	seen := map[string]bool{}
+	for _, record := range []*auditRecord{before, after} {
+		if record == nil {
+			continue
+		}
+		for _, column := range record.columns {
+			if !seen[column] && !auditIgnored[column] {
+				seen[column] = true
+				columns = append(columns, column)
+			}
+		}
+	}
+
+	changes := []models.FieldChange{}
+	for _, column := range columns {
+		var oldValue, newValue interface{}
+		if before != nil {
+			oldValue = before.data[column]
+		}
+		if after != nil {
+			newValue = after.data[column]
+		}
+		if auditEqual(oldValue, newValue) {
+			continue
+		}
+		changes = append(changes, models.FieldChange{Field: column, Old: oldValue, New: newValue})
+	}
+	return changes
+}
+
+// auditEqual 按 JSON 表示比较两个值，避免 int64 与 float64 之类的类型差异
+func auditEqual(a, b interface{}) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return string(ja) == string(jb)
+}
+
+// auditJSON 快照的 JSON 表示，没有快照时为 NULL
+func auditJSON(record *auditRecord) interface{} {
+	if record == nil {
+		return nil
+	}
+	b, err := json.Marshal(record.data)
+	if err != nil {
+		return nil
+	}
+	return string(b)
+}
+
+// GetAuditEntries 按条件查询变更记录，新的在前
+func (r *SQLiteRepository) GetAuditEntries(ctx context.Context, query models.AuditQuery) ([]models.AuditEntry, int, error) {
+	var where []string
+	var args []interface{}
+	if query.FamilyTreeID > 0 {
+		where = append(where, "a.family_tree_id = ?")
+		args = append(args, query.FamilyTreeID)
+	}
+	if query.UserID > 0 {
+		where = append(where, "a.user_id = ?")
+		args = append(args, query.UserID)
+	}
+	if query.EntityType != "" {
+		where = append(where, "a.entity_type = ?")
+		args = append(args, string(query.EntityType))
+	}
+	if query.EntityID != "" {
+		where = append(where, "a.entity_id = ?")
+		args = append(args, query.EntityID)
+	}
+	if query.ChangeSet != "" {
+		where = append(where, "a.change_set = ?")
+		args = append(args, query.ChangeSet)
+	}
+	if query.Since != nil {
+		where = append(where, "a.created_at >= ?")
+		args = append(args, *query.Since)
+	}
+	if query.Until != nil {
+		where = append(where, "a.created_at < ?")
+		args = append(args, *query.Until)
+	}
+	return r.getAuditEntries(ctx, where, args, query.Limit, query.Offset)
+}
+
+// getAuditEntries 按 WHERE 条件分页查询变更记录，limit 不大于 0 时不限条数
+func (r *SQLiteRepository) getAuditEntries(ctx context.Context, where []string, args []interface{}, limit, offset int) ([]models.AuditEntry, int, error) {
+	clause := ""
+	if len(where) > 0 {
+		clause = "WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int
+	if err := r.conn(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM audit_log a "+clause, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("统计变更记录失败: %v", err)
+	}
+
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := r.conn(ctx).QueryContext(ctx, `
+		SELECT a.audit_id, a.change_set, a.family_tree_id, a.entity_type, a.entity_id, a.action,
+		       a.user_id, COALESCE(u.username, ''), a.changes, a.before_data, a.after_data, a.created_at
+		FROM audit_log a LEFT JOIN users u ON u.user_id = a.user_id
+		`+clause+`
+		ORDER BY a.audit_id DESC
+		LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询变更记录失败: %v", err)
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var entry models.AuditEntry
+		var treeID, userID sql.NullInt64
+		var entityType, changes string
+		var before, after sql.NullString
+		if err := rows.Scan(&entry.AuditID, &entry.ChangeSet, &treeID, &entityType, &entry.EntityID, &entry.Action,
+			&userID, &entry.Username, &changes, &before, &after, &entry.CreatedAt); err != nil {
+			return nil, 0, fmt.Errorf("扫描变更记录失败: %v", err)
+		}
+		entry.EntityType = models.EntityType(entityType)
+		if treeID.Valid {
+			id := int(treeID.Int64)
+			entry.FamilyTreeID = &id
+		}
+		if userID.Valid {
+			id := int(userID.Int64)
+			entry.UserID = &id
+		}
+		if err := json.Unmarshal([]byte(changes), &entry.Changes); err != nil {
+			return nil, 0, fmt.Errorf("解析变更内容失败: %v", err)
+		}
+		if before.Valid {
+			json.Unmarshal([]byte(before.String), &entry.Before)
+		}
+		if after.Valid {
+			json.Unmarshal([]byte(after.String), &entry.After)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, total, rows.Err()
+}
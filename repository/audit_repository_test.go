@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"familytree/models"
+	"familytree/pkg/middleware"
+)
+
+func TestAuditTrail(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.WithValue(context.Background(), middleware.UserContextKey, &models.AuthContext{UserID: 7})
+	ctx = withChangeSet(t, ctx)
+	changeSet, _ := middleware.GetChangeSetFromContext(ctx)
+
+	birth := time.Date(1950, 1, 1, 0, 0, 0, 0, time.UTC)
+	person, err := repo.CreateIndividual(ctx, &models.Individual{FullName: "张三", Gender: models.GenderMale, BirthDate: &birth})
+	if err != nil {
+		t.Fatalf("创建个人失败: %v", err)
+	}
+
+	corrected := time.Date(1950, 2, 1, 0, 0, 0, 0, time.UTC)
+	person.BirthDate = &corrected
+	person.Occupation = "教师"
+	if _, err := repo.UpdateIndividual(ctx, person.IndividualID, person); err != nil {
+		t.Fatalf("更新个人失败: %v", err)
+	}
+	// 内容不变的更新不产生记录
+	if _, err := repo.UpdateIndividual(ctx, person.IndividualID, person); err != nil {
+		t.Fatalf("更新个人失败: %v", err)
+	}
+
+	entries, total, err := repo.GetAuditEntries(ctx, models.AuditQuery{
+		EntityType: models.EntityTypeIndividual,
+		EntityID:   auditEntityID(person.IndividualID),
+	})
+	if err != nil {
+		t.Fatalf("查询变更记录失败: %v", err)
+	}
+	if total != 2 || len(entries) != 2 {
+		t.Fatalf("变更记录数: got %d, want 2: %+v", total, entries)
+	}
+
+	update := entries[0]
+	if update.Action != models.AuditActionUpdate || update.ChangeSet != changeSet ||
+		update.UserID == nil || *update.UserID != 7 || update.FamilyTreeID == nil || *update.FamilyTreeID != 1 {
+		t.Errorf("更新记录错误: %+v", update)
+	}
+	want := map[string][2]interface{}{
+		"birth_date": {"1950-01-01", "1950-02-01"},
+		"occupation": {"", "教师"},
+	}
+	if len(update.Changes) != len(want) {
+		t.Fatalf("字段变更: got %+v", update.Changes)
+	}
+	for _, change := range update.Changes {
+		w, ok := want[change.Field]
+		if !ok || change.Old != w[0] || change.New != w[1] {
+			t.Errorf("字段 %s: got %v → %v, want %v → %v", change.Field, change.Old, change.New, w[0], w[1])
+		}
+	}
+	if entries[1].Action != models.AuditActionCreate || entries[1].Before != nil || entries[1].After["full_name"] != "张三" {
+		t.Errorf("创建记录错误: %+v", entries[1])
+	}
+
+	// 同一变更集中的多条记录
+	family, err := repo.CreateFamily(ctx, &models.Family{HusbandID: &person.IndividualID, MarriageOrder: 1})
+	if err != nil {
+		t.Fatalf("创建家庭失败: %v", err)
+	}
+	child := insertPerson(t, repo, "张小", "male", &person.IndividualID, nil)
+	if _, err := repo.CreateChild(ctx, &models.Child{FamilyID: family.FamilyID, IndividualID: child, RelationshipToParents: "biological"}); err != nil {
+		t.Fatalf("创建子女关系失败: %v", err)
+	}
+	deleteCtx := withChangeSet(t, ctx)
+	if err := repo.DeleteChild(deleteCtx, family.FamilyID, child); err != nil {
+		t.Fatalf("删除子女关系失败: %v", err)
+	}
+	if err := repo.DeleteFamily(deleteCtx, family.FamilyID); err != nil {
+		t.Fatalf("删除家庭失败: %v", err)
+	}
+	deleteSet, _ := middleware.GetChangeSetFromContext(deleteCtx)
+	deleted, _, err := repo.GetAuditEntries(ctx, models.AuditQuery{ChangeSet: deleteSet})
+	if err != nil {
+		t.Fatalf("查询变更集失败: %v", err)
+	}
+	if len(deleted) != 2 || deleted[0].EntityType != models.EntityTypeFamily || deleted[0].Action != models.AuditActionDelete ||
+		deleted[1].EntityID != auditEntityID(family.FamilyID, child) || deleted[1].Before["relationship_type"] != "biological" {
+		t.Errorf("删除记录错误: %+v", deleted)
+	}
+	if deleted[0].FamilyTreeID == nil || *deleted[0].FamilyTreeID != 1 {
+		t.Errorf("家庭所属家族树错误: %+v", deleted[0])
+	}
+
+	byUser, total, err := repo.GetAuditEntries(ctx, models.AuditQuery{UserID: 7, Limit: 2})
+	if err != nil {
+		t.Fatalf("按用户查询失败: %v", err)
+	}
+	if len(byUser) != 2 || total < 5 {
+		t.Errorf("按用户查询: got %d 条，共 %d 条", len(byUser), total)
+	}
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"familytree/models"
+)
+
+// SaveCalendarFeed 保存用户的订阅令牌摘要，已有订阅时替换旧令牌
+func (r *SQLiteRepository) SaveCalendarFeed(ctx context.Context, userID int, tokenHash string) (*models.CalendarFeed, error) {
+	now := time.Now()
+	_, err := r.conn(ctx).ExecContext(ctx, `
+		INSERT INTO calendar_feeds (user_id, token_hash, created_at, last_used_at)
+		VALUES (?, ?, ?, NULL)
+		ON CONFLICT(user_id) DO UPDATE SET
+			token_hash = excluded.token_hash,
+			created_at = excluded.created_at,
+			last_used_at = NULL
+	`, userID, tokenHash, now)
+	if err != nil {
+		return nil, fmt.Errorf("保存日历订阅失败: %v", err)
+	}
+	return &models.CalendarFeed{CreatedAt: now}, nil
+}
+
+// GetCalendarFeed 获取用户的订阅信息，没有订阅时返回 nil
+func (r *SQLiteRepository) GetCalendarFeed(ctx context.Context, userID int) (*models.CalendarFeed, error) {
+	var feed models.CalendarFeed
+	var lastUsed sql.NullTime
+	err := r.conn(ctx).QueryRowContext(ctx, `
+		SELECT created_at, last_used_at FROM calendar_feeds WHERE user_id = ?
+	`, userID).Scan(&feed.CreatedAt, &lastUsed)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询日历订阅失败: %v", err)
+	}
+	if lastUsed.Valid {
+		feed.LastUsedAt = &lastUsed.Time
+	}
+	return &feed, nil
+}
+
+// GetCalendarFeedUserID 根据令牌摘要查找用户并记录访问时间，令牌无效时返回 0
+func (r *SQLiteRepository) GetCalendarFeedUserID(ctx context.Context, tokenHash string) (int, error) {
+	var userID int
+	err := r.conn(ctx).QueryRowContext(ctx, `SELECT user_id FROM calendar_feeds WHERE token_hash = ?`, tokenHash).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("查询日历订阅失败: %v", err)
+	}
+	if _, err := r.conn(ctx).ExecContext(ctx, `UPDATE calendar_feeds SET last_used_at = ? WHERE user_id = ?`, time.Now(), userID); err != nil {
+		return 0, fmt.Errorf("更新日历订阅失败: %v", err)
+	}
+	return userID, nil
+}
+
+// DeleteCalendarFeed 取消用户的订阅，旧链接立即失效
+func (r *SQLiteRepository) DeleteCalendarFeed(ctx context.Context, userID int) error {
+	if _, err := r.conn(ctx).ExecContext(ctx, `DELETE FROM calendar_feeds WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("删除日历订阅失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,603 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"familytree/models"
+)
+
+// 世系闭包表
+//
+// lineage_edges 记录父母-子女边，ref_count 为该边的来源数量
+// （individuals.father_id/mother_id 以及 children 表中的家庭子女记录）。
+// individual_closure 记录每对祖先-后代在每个代数上的路径数，
+// 每个人都有一条 depth = 0 的自反记录。
+//
+// 所有维护都由触发器在写入语句内完成，因此与业务写入处于同一事务中。
+
+// circularLineageMessage 形成循环时触发器抛出的错误信息
+const circularLineageMessage = "circular lineage"
+
+var lineageClosureTables = []string{
+	`CREATE TABLE IF NOT EXISTS lineage_edges (
+		parent_id INTEGER NOT NULL,
+		child_id INTEGER NOT NULL,
+		ref_count INTEGER NOT NULL DEFAULT 1,
+		PRIMARY KEY (parent_id, child_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_lineage_edges_child ON lineage_edges(child_id)`,
+	`CREATE TABLE IF NOT EXISTS individual_closure (
+		ancestor_id INTEGER NOT NULL,
+		descendant_id INTEGER NOT NULL,
+		depth INTEGER NOT NULL,
+		path_count INTEGER NOT NULL DEFAULT 1,
+		PRIMARY KEY (ancestor_id, descendant_id, depth)
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_individual_closure_descendant ON individual_closure(descendant_id, depth)`,
+}
+
+// lineageEdgeTriggers 边增删时维护闭包表
+var lineageEdgeTriggers = []string{
+	`CREATE TRIGGER IF NOT EXISTS lineage_edge_insert
+		AFTER INSERT ON lineage_edges
+		FOR EACH ROW
+	BEGIN
+		SELECT RAISE(ABORT, '` + circularLineageMessage + `')
+		WHERE EXISTS (
+			SELECT 1 FROM individual_closure
+			WHERE ancestor_id = NEW.child_id AND descendant_id = NEW.parent_id
+		);
+		INSERT INTO individual_closure (ancestor_id, descendant_id, depth, path_count)
+		SELECT a.ancestor_id, d.descendant_id, a.depth + d.depth + 1, a.path_count * d.path_count
+		FROM individual_closure a, individual_closure d
+		WHERE a.descendant_id = NEW.parent_id AND d.ancestor_id = NEW.child_id
+		ON CONFLICT (ancestor_id, descendant_id, depth) DO UPDATE SET path_count = path_count + excluded.path_count;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS lineage_edge_delete
+		AFTER DELETE ON lineage_edges
+		FOR EACH ROW
+	BEGIN
+		UPDATE individual_closure SET path_count = path_count - COALESCE((
+			SELECT SUM(a.path_count * d.path_count)
+			FROM individual_closure a, individual_closure d
+			WHERE a.ancestor_id = individual_closure.ancestor_id AND a.descendant_id = OLD.parent_id
+			  AND d.ancestor_id = OLD.child_id AND d.descendant_id = individual_closure.descendant_id
+			  AND a.depth + d.depth + 1 = individual_closure.depth
+		), 0)
+		WHERE depth > 0
+		  AND ancestor_id IN (SELECT ancestor_id FROM individual_closure WHERE descendant_id = OLD.parent_id)
+		  AND descendant_id IN (SELECT descendant_id FROM individual_closure WHERE ancestor_id = OLD.child_id);
+		DELETE FROM individual_closure
+		WHERE path_count <= 0
+		  AND ancestor_id IN (SELECT ancestor_id FROM individual_closure WHERE descendant_id = OLD.parent_id)
+		  AND descendant_id IN (SELECT descendant_id FROM individual_closure WHERE ancestor_id = OLD.child_id);
+	END`,
+}
+
+// lineageSourceTriggers 个人、家庭和子女记录变化时维护边。回收站中的记录不产生边：
+// 边两端的个人都未删除时才存在，来源数只计未删除的父母字段和未删除家庭中未删除的子女记录。
+// 删除个人时去掉与其相连的全部边，恢复时按现有来源重新加入
+var lineageSourceTriggers = []string{
+	`CREATE TRIGGER IF NOT EXISTS lineage_individual_insert
+		AFTER INSERT ON individuals
+		FOR EACH ROW
+		WHEN NEW.deleted_at IS NULL
+	BEGIN
+		INSERT OR IGNORE INTO individual_closure (ancestor_id, descendant_id, depth, path_count)
+		VALUES (NEW.individual_id, NEW.individual_id, 0, 1);
+		INSERT INTO lineage_edges (parent_id, child_id, ref_count)
+		SELECT NEW.father_id, NEW.individual_id, 1 WHERE ` + liveIndividual("NEW.father_id") + `
+		ON CONFLICT (parent_id, child_id) DO UPDATE SET ref_count = ref_count + 1;
+		INSERT INTO lineage_edges (parent_id, child_id, ref_count)
+		SELECT NEW.mother_id, NEW.individual_id, 1 WHERE ` + liveIndividual("NEW.mother_id") + `
+		ON CONFLICT (parent_id, child_id) DO UPDATE SET ref_count = ref_count + 1;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS lineage_individual_update
+		AFTER UPDATE OF father_id, mother_id ON individuals
+		FOR EACH ROW
+		WHEN NEW.deleted_at IS NULL AND (OLD.father_id IS NOT NEW.father_id OR OLD.mother_id IS NOT NEW.mother_id)
+	BEGIN
+		UPDATE lineage_edges SET ref_count = ref_count - 1
+		WHERE OLD.father_id IS NOT NEW.father_id AND parent_id = OLD.father_id AND child_id = OLD.individual_id;
+		UPDATE lineage_edges SET ref_count = ref_count - 1
+		WHERE OLD.mother_id IS NOT NEW.mother_id AND parent_id = OLD.mother_id AND child_id = OLD.individual_id;
+		DELETE FROM lineage_edges WHERE child_id = OLD.individual_id AND ref_count <= 0;
+		INSERT INTO lineage_edges (parent_id, child_id, ref_count)
+		SELECT NEW.father_id, NEW.individual_id, 1
+		WHERE OLD.father_id IS NOT NEW.father_id AND ` + liveIndividual("NEW.father_id") + `
+		ON CONFLICT (parent_id, child_id) DO UPDATE SET ref_count = ref_count + 1;
+		INSERT INTO lineage_edges (parent_id, child_id, ref_count)
+		SELECT NEW.mother_id, NEW.individual_id, 1
+		WHERE OLD.mother_id IS NOT NEW.mother_id AND ` + liveIndividual("NEW.mother_id") + `
+		ON CONFLICT (parent_id, child_id) DO UPDATE SET ref_count = ref_count + 1;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS lineage_individual_delete
+		AFTER DELETE ON individuals
+		FOR EACH ROW
+	BEGIN
+		DELETE FROM lineage_edges WHERE parent_id = OLD.individual_id OR child_id = OLD.individual_id;
+		DELETE FROM individual_closure WHERE ancestor_id = OLD.individual_id OR descendant_id = OLD.individual_id;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS lineage_individual_trash
+		AFTER UPDATE OF deleted_at ON individuals
+		FOR EACH ROW
+		WHEN OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL
+	BEGIN
+		DELETE FROM lineage_edges WHERE parent_id = OLD.individual_id OR child_id = OLD.individual_id;
+		DELETE FROM individual_closure WHERE ancestor_id = OLD.individual_id OR descendant_id = OLD.individual_id;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS lineage_individual_restore
+		AFTER UPDATE OF deleted_at ON individuals
+		FOR EACH ROW
+		WHEN OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL
+	BEGIN
+		INSERT OR IGNORE INTO individual_closure (ancestor_id, descendant_id, depth, path_count)
+		VALUES (NEW.individual_id, NEW.individual_id, 0, 1);
+		INSERT INTO lineage_edges (parent_id, child_id, ref_count)
+		SELECT parent_id, child_id, COUNT(*) FROM (` + lineageSourcesQuery + `)
+		WHERE parent_id = NEW.individual_id OR child_id = NEW.individual_id
+		GROUP BY parent_id, child_id;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS lineage_child_insert
+		AFTER INSERT ON children
+		FOR EACH ROW
+		WHEN NEW.deleted_at IS NULL
+	BEGIN` + lineageChildEdgesInsert + `
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS lineage_child_delete
+		AFTER DELETE ON children
+		FOR EACH ROW
+		WHEN OLD.deleted_at IS NULL
+	BEGIN` + lineageChildEdgesDelete + `
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS lineage_child_trash
+		AFTER UPDATE OF deleted_at ON children
+		FOR EACH ROW
+		WHEN OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL
+	BEGIN` + lineageChildEdgesDelete + `
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS lineage_child_restore
+		AFTER UPDATE OF deleted_at ON children
+		FOR EACH ROW
+		WHEN OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL
+	BEGIN` + lineageChildEdgesInsert + `
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS lineage_family_update
+		AFTER UPDATE OF husband_id, wife_id ON families
+		FOR EACH ROW
+		WHEN NEW.deleted_at IS NULL AND (OLD.husband_id IS NOT NEW.husband_id OR OLD.wife_id IS NOT NEW.wife_id)
+	BEGIN
+		UPDATE lineage_edges SET ref_count = ref_count - 1
+		WHERE OLD.husband_id IS NOT NEW.husband_id AND parent_id = OLD.husband_id
+		  AND child_id IN (SELECT individual_id FROM children WHERE family_id = OLD.family_id AND deleted_at IS NULL);
+		UPDATE lineage_edges SET ref_count = ref_count - 1
+		WHERE OLD.wife_id IS NOT NEW.wife_id AND parent_id = OLD.wife_id
+		  AND child_id IN (SELECT individual_id FROM children WHERE family_id = OLD.family_id AND deleted_at IS NULL);
+		DELETE FROM lineage_edges WHERE parent_id IN (OLD.husband_id, OLD.wife_id) AND ref_count <= 0;
+		INSERT INTO lineage_edges (parent_id, child_id, ref_count)
+		SELECT NEW.husband_id, c.individual_id, 1 FROM children c JOIN individuals i ON i.individual_id = c.individual_id
+		WHERE c.family_id = NEW.family_id AND c.deleted_at IS NULL AND i.deleted_at IS NULL
+		  AND OLD.husband_id IS NOT NEW.husband_id AND ` + liveIndividual("NEW.husband_id") + `
+		ON CONFLICT (parent_id, child_id) DO UPDATE SET ref_count = ref_count + 1;
+		INSERT INTO lineage_edges (parent_id, child_id, ref_count)
+		SELECT NEW.wife_id, c.individual_id, 1 FROM children c JOIN individuals i ON i.individual_id = c.individual_id
+		WHERE c.family_id = NEW.family_id AND c.deleted_at IS NULL AND i.deleted_at IS NULL
+		  AND OLD.wife_id IS NOT NEW.wife_id AND ` + liveIndividual("NEW.wife_id") + `
+		ON CONFLICT (parent_id, child_id) DO UPDATE SET ref_count = ref_count + 1;
+	END`,
+	// 在删除前处理，此时仍能查到家庭的子女记录；之后删除子女记录时家庭已不存在，不会重复扣减
+	`CREATE TRIGGER IF NOT EXISTS lineage_family_delete
+		BEFORE DELETE ON families
+		FOR EACH ROW
+		WHEN OLD.deleted_at IS NULL
+	BEGIN` + lineageFamilyEdgesDelete + `
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS lineage_family_trash
+		AFTER UPDATE OF deleted_at ON families
+		FOR EACH ROW
+		WHEN OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL
+	BEGIN` + lineageFamilyEdgesDelete + `
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS lineage_family_restore
+		AFTER UPDATE OF deleted_at ON families
+		FOR EACH ROW
+		WHEN OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL
+	BEGIN
+		INSERT INTO lineage_edges (parent_id, child_id, ref_count)
+		SELECT NEW.husband_id, c.individual_id, 1 FROM children c JOIN individuals i ON i.individual_id = c.individual_id
+		WHERE c.family_id = NEW.family_id AND c.deleted_at IS NULL AND i.deleted_at IS NULL AND ` + liveIndividual("NEW.husband_id") + `
+		ON CONFLICT (parent_id, child_id) DO UPDATE SET ref_count = ref_count + 1;
+		INSERT INTO lineage_edges (parent_id, child_id, ref_count)
+		SELECT NEW.wife_id, c.individual_id, 1 FROM children c JOIN individuals i ON i.individual_id = c.individual_id
+		WHERE c.family_id = NEW.family_id AND c.deleted_at IS NULL AND i.deleted_at IS NULL AND ` + liveIndividual("NEW.wife_id") + `
+		ON CONFLICT (parent_id, child_id) DO UPDATE SET ref_count = ref_count + 1;
+	END`,
+}
+
+// lineageChildEdgesInsert 新增或恢复子女记录时，家庭未删除则为夫妻到子女加边
+const lineageChildEdgesInsert = `
+		INSERT INTO lineage_edges (parent_id, child_id, ref_count)
+		SELECT f.husband_id, NEW.individual_id, 1 FROM families f
+		WHERE f.family_id = NEW.family_id AND f.deleted_at IS NULL
+		  AND ` + `EXISTS (SELECT 1 FROM individuals WHERE individual_id = f.husband_id AND deleted_at IS NULL)` + `
+		  AND ` + `EXISTS (SELECT 1 FROM individuals WHERE individual_id = NEW.individual_id AND deleted_at IS NULL)` + `
+		ON CONFLICT (parent_id, child_id) DO UPDATE SET ref_count = ref_count + 1;
+		INSERT INTO lineage_edges (parent_id, child_id, ref_count)
+		SELECT f.wife_id, NEW.individual_id, 1 FROM families f
+		WHERE f.family_id = NEW.family_id AND f.deleted_at IS NULL
+		  AND ` + `EXISTS (SELECT 1 FROM individuals WHERE individual_id = f.wife_id AND deleted_at IS NULL)` + `
+		  AND ` + `EXISTS (SELECT 1 FROM individuals WHERE individual_id = NEW.individual_id AND deleted_at IS NULL)` + `
+		ON CONFLICT (parent_id, child_id) DO UPDATE SET ref_count = ref_count + 1;`
+
+// lineageChildEdgesDelete 删除子女记录或将其移入回收站时，家庭未删除则扣减夫妻到子女的边。
+// 两端有人已删除时边本来就不存在，扣减不影响任何记录
+const lineageChildEdgesDelete = `
+		UPDATE lineage_edges SET ref_count = ref_count - 1
+		WHERE child_id = OLD.individual_id
+		  AND parent_id = (SELECT husband_id FROM families WHERE family_id = OLD.family_id AND deleted_at IS NULL);
+		UPDATE lineage_edges SET ref_count = ref_count - 1
+		WHERE child_id = OLD.individual_id
+		  AND parent_id = (SELECT wife_id FROM families WHERE family_id = OLD.family_id AND deleted_at IS NULL);
+		DELETE FROM lineage_edges WHERE child_id = OLD.individual_id AND ref_count <= 0;`
+
+// lineageFamilyEdgesDelete 删除家庭或将其移入回收站时扣减夫妻到未删除子女记录的边
+const lineageFamilyEdgesDelete = `
+		UPDATE lineage_edges SET ref_count = ref_count - 1
+		WHERE parent_id = OLD.husband_id
+		  AND child_id IN (SELECT individual_id FROM children WHERE family_id = OLD.family_id AND deleted_at IS NULL);
+		UPDATE lineage_edges SET ref_count = ref_count - 1
+		WHERE parent_id = OLD.wife_id
+		  AND child_id IN (SELECT individual_id FROM children WHERE family_id = OLD.family_id AND deleted_at IS NULL);
+		DELETE FROM lineage_edges WHERE parent_id IN (OLD.husband_id, OLD.wife_id) AND ref_count <= 0;`
+
+// liveIndividual 个人存在且不在回收站中的条件
+func liveIndividual(id string) string {
+	return "EXISTS (SELECT 1 FROM individuals WHERE individual_id = " + id + " AND deleted_at IS NULL)"
+}
+
+// dropLineageClosureTriggers 删除全部维护触发器。触发器不全即表示闭包表已过期，下次启用时重建
+var dropLineageClosureTriggers = []string{
+	`DROP TRIGGER IF EXISTS lineage_individual_insert`,
+	`DROP TRIGGER IF EXISTS lineage_individual_update`,
+	`DROP TRIGGER IF EXISTS lineage_individual_delete`,
+	`DROP TRIGGER IF EXISTS lineage_individual_trash`,
+	`DROP TRIGGER IF EXISTS lineage_individual_restore`,
+	`DROP TRIGGER IF EXISTS lineage_child_insert`,
+	`DROP TRIGGER IF EXISTS lineage_child_delete`,
+	`DROP TRIGGER IF EXISTS lineage_child_trash`,
+	`DROP TRIGGER IF EXISTS lineage_child_restore`,
+	`DROP TRIGGER IF EXISTS lineage_family_update`,
+	`DROP TRIGGER IF EXISTS lineage_family_delete`,
+	`DROP TRIGGER IF EXISTS lineage_family_trash`,
+	`DROP TRIGGER IF EXISTS lineage_family_restore`,
+	`DROP TRIGGER IF EXISTS lineage_edge_insert`,
+	`DROP TRIGGER IF EXISTS lineage_edge_delete`,
+}
+
+// dropLineageClosureTables 删除闭包表，只在重建时使用
+var dropLineageClosureTables = []string{
+	`DROP TABLE IF EXISTS individual_closure`,
+	`DROP TABLE IF EXISTS lineage_edges`,
+}
+
+// lineageSourcesQuery 全部父母-子女边的来源：未删除个人的父母字段，未删除家庭中未删除的子女记录，两端的个人都未删除
+const lineageSourcesQuery = `
+		SELECT i.father_id AS parent_id, i.individual_id AS child_id FROM individuals i
+		JOIN individuals p ON p.individual_id = i.father_id
+		WHERE i.deleted_at IS NULL AND p.deleted_at IS NULL
+		UNION ALL
+		SELECT i.mother_id, i.individual_id FROM individuals i
+		JOIN individuals p ON p.individual_id = i.mother_id
+		WHERE i.deleted_at IS NULL AND p.deleted_at IS NULL
+		UNION ALL
+		SELECT f.husband_id, c.individual_id FROM children c
+		JOIN families f ON f.family_id = c.family_id
+		JOIN individuals p ON p.individual_id = f.husband_id
+		JOIN individuals i ON i.individual_id = c.individual_id
+		WHERE c.deleted_at IS NULL AND f.deleted_at IS NULL AND p.deleted_at IS NULL AND i.deleted_at IS NULL
+		UNION ALL
+		SELECT f.wife_id, c.individual_id FROM children c
+		JOIN families f ON f.family_id = c.family_id
+		JOIN individuals p ON p.individual_id = f.wife_id
+		JOIN individuals i ON i.individual_id = c.individual_id
+		WHERE c.deleted_at IS NULL AND f.deleted_at IS NULL AND p.deleted_at IS NULL AND i.deleted_at IS NULL`
+
+// lineageSourceEdgesQuery 从个人父母字段和家庭子女记录汇总父母-子女边及其来源数
+const lineageSourceEdgesQuery = `
+	SELECT parent_id, child_id, COUNT(*) FROM (` + lineageSourcesQuery + `
+	)
+	GROUP BY parent_id, child_id
+	ORDER BY parent_id, child_id
+`
+
+// EnableLineageClosure 启用闭包表；首次启用或停用过（触发器不全）时会完整重建，
+// 事先用 rebuild-lineage 重建过且之后未停用的闭包表直接使用
+func (r *SQLiteRepository) EnableLineageClosure(ctx context.Context) error {
+	count, err := r.lineageClosureTriggerCount(ctx)
+	if err != nil {
+		return err
+	}
+
+	if count < len(lineageEdgeTriggers)+len(lineageSourceTriggers) {
+		if _, err := r.RebuildLineageClosure(ctx); err != nil {
+			return err
+		}
+	}
+
+	r.lineageClosure.Store(true)
+	return nil
+}
+
+// DisableLineageClosure 停用闭包表：只删除触发器，保留表中的数据。停用期间的写入不再同步，
+// 缺少触发器即表示闭包表已过期，下次启用时重建。触发器本来就不存在时不做任何修改
+func (r *SQLiteRepository) DisableLineageClosure(ctx context.Context) error {
+	r.lineageClosure.Store(false)
+	count, err := r.lineageClosureTriggerCount(ctx)
+	if err != nil || count == 0 {
+		return err
+	}
+	for _, stmt := range dropLineageClosureTriggers {
+		if _, err := r.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("删除闭包表触发器失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// lineageClosureTriggerCount 现有的闭包表维护触发器数量
+func (r *SQLiteRepository) lineageClosureTriggerCount(ctx context.Context) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'lineage_%'").Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("检查闭包表触发器失败: %v", err)
+	}
+	return count, nil
+}
+
+// RebuildLineageClosure 在一个事务中从现有数据完整重建闭包表
+func (r *SQLiteRepository) RebuildLineageClosure(ctx context.Context) (*models.LineageClosureRebuildResult, error) {
+	start := time.Now()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	// 先删除全部触发器和表，批量装载完成后再创建来源触发器
+	var schema []string
+	for _, stmts := range [][]string{dropLineageClosureTriggers, dropLineageClosureTables, lineageClosureTables, lineageEdgeTriggers} {
+		schema = append(schema, stmts...)
+	}
+	for _, stmt := range schema {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("创建闭包表失败: %v", err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO individual_closure (ancestor_id, descendant_id, depth, path_count)
+		SELECT individual_id, individual_id, 0, 1 FROM individuals WHERE deleted_at IS NULL
+	`); err != nil {
+		return nil, fmt.Errorf("初始化闭包表失败: %v", err)
+	}
+
+	edges, refCounts, err := loadLineageSourceEdges(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.LineageClosureRebuildResult{}
+	for _, edge := range topologicalEdgeOrder(edges) {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO lineage_edges (parent_id, child_id, ref_count) VALUES (?, ?, ?)`,
+			edge.ParentID, edge.ChildID, refCounts[edge])
+		if err != nil {
+			if isCircularLineageError(err) {
+				result.SkippedEdges = append(result.SkippedEdges, edge)
+				continue
+			}
+			return nil, fmt.Errorf("写入世系边失败: %v", err)
+		}
+		result.EdgeCount++
+	}
+
+	for _, stmt := range lineageSourceTriggers {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("创建闭包表触发器失败: %v", err)
+		}
+	}
+
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM individuals WHERE deleted_at IS NULL").Scan(&result.IndividualCount); err != nil {
+		return nil, fmt.Errorf("统计个人数量失败: %v", err)
+	}
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM individual_closure").Scan(&result.ClosureRows); err != nil {
+		return nil, fmt.Errorf("统计闭包表失败: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %v", err)
+	}
+
+	result.Duration = time.Since(start)
+	return result, nil
+}
+
+// loadLineageSourceEdges 读取所有来源汇总后的边
+func loadLineageSourceEdges(ctx context.Context, tx *sql.Tx) ([]models.LineageEdge, map[models.LineageEdge]int, error) {
+	rows, err := tx.QueryContext(ctx, lineageSourceEdgesQuery)
+	if err != nil {
+		return nil, nil, fmt.Errorf("查询世系边失败: %v", err)
+	}
+	defer rows.Close()
+
+	var edges []models.LineageEdge
+	refCounts := make(map[models.LineageEdge]int)
+	for rows.Next() {
+		var edge models.LineageEdge
+		var refCount int
+		if err := rows.Scan(&edge.ParentID, &edge.ChildID, &refCount); err != nil {
+			return nil, nil, fmt.Errorf("扫描世系边失败: %v", err)
+		}
+		edges = append(edges, edge)
+		refCounts[edge] = refCount
+	}
+
+	return edges, refCounts, rows.Err()
+}
+
+// topologicalEdgeOrder 按父母先于子女的顺序排列边
+//
+// 插入边 P->C 时 C 还没有后代，触发器只需连接 P 的祖先，
+// 重建代价与祖先总数成正比。循环中的边排在最后，由触发器拒绝。
+func topologicalEdgeOrder(edges []models.LineageEdge) []models.LineageEdge {
+	outgoing := make(map[int][]models.LineageEdge)
+	indegree := make(map[int]int)
+	for _, edge := range edges {
+		outgoing[edge.ParentID] = append(outgoing[edge.ParentID], edge)
+		indegree[edge.ChildID]++
+		if _, ok := indegree[edge.ParentID]; !ok {
+			indegree[edge.ParentID] = 0
+		}
+	}
+
+	var queue []int
+	for id, degree := range indegree {
+		if degree == 0 {
+			queue = append(queue, id)
+		}
+	}
+	sort.Ints(queue)
+
+	ordered := make([]models.LineageEdge, 0, len(edges))
+	emitted := make(map[models.LineageEdge]bool, len(edges))
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, edge := range outgoing[id] {
+			ordered = append(ordered, edge)
+			emitted[edge] = true
+			indegree[edge.ChildID]--
+			if indegree[edge.ChildID] == 0 {
+				queue = append(queue, edge.ChildID)
+			}
+		}
+	}
+
+	for _, edge := range edges {
+		if !emitted[edge] {
+			ordered = append(ordered, edge)
+		}
+	}
+
+	return ordered
+}
+
+// isCircularLineageError 判断是否为闭包表触发器拒绝的循环关系
+func isCircularLineageError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), circularLineageMessage)
+}
+
+// IsAncestor 判断 ancestorID 是否为 descendantID 的祖先（不限代数）
+func (r *SQLiteRepository) IsAncestor(ctx context.Context, ancestorID, descendantID int) (bool, error) {
+	var exists bool
+	var err error
+	if r.lineageClosure.Load() {
+		err = r.conn(ctx).QueryRowContext(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM individual_closure
+				WHERE ancestor_id = ? AND descendant_id = ? AND depth > 0
+			)
+		`, ancestorID, descendantID).Scan(&exists)
+	} else {
+		// 只按个人去重，即使数据中存在循环也能终止；与闭包表一致，不经过回收站中的个人
+		err = r.conn(ctx).QueryRowContext(ctx, `
+			WITH RECURSIVE ancestry(individual_id) AS (
+				SELECT ?1`+ancestryParentSteps("", "", "")+`
+			)
+			SELECT EXISTS (
+				SELECT 1 FROM ancestry a JOIN individuals i ON i.individual_id = a.individual_id
+				WHERE a.individual_id = ?2 AND ?2 <> ?1 AND i.deleted_at IS NULL
+			)
+		`, descendantID, ancestorID).Scan(&exists)
+	}
+	if err != nil {
+		return false, fmt.Errorf("查询祖先关系失败: %v", err)
+	}
+	return exists, nil
+}
+
+// ancestryParentSteps 祖先递归查询 ancestry 的递归部分：沿 father_id/mother_id 以及未删除家庭中
+// 未删除的子女记录向上一代，与闭包表的边来源一致。before、after 为父母列前后的其他列，where 为附加条件
+func ancestryParentSteps(before, after, where string) string {
+	var steps strings.Builder
+	for _, parent := range []string{"i.father_id", "i.mother_id"} {
+		steps.WriteString(`
+				UNION
+				SELECT ` + before + parent + after + `
+				FROM ancestry a JOIN individuals i ON i.individual_id = a.individual_id
+				WHERE ` + parent + ` IS NOT NULL AND i.deleted_at IS NULL` + where)
+	}
+	for _, parent := range []string{"f.husband_id", "f.wife_id"} {
+		steps.WriteString(`
+				UNION
+				SELECT ` + before + parent + after + `
+				FROM ancestry a JOIN individuals i ON i.individual_id = a.individual_id
+				JOIN children c ON c.individual_id = i.individual_id AND c.deleted_at IS NULL
+				JOIN families f ON f.family_id = c.family_id AND f.deleted_at IS NULL
+				WHERE ` + parent + ` IS NOT NULL AND i.deleted_at IS NULL` + where)
+	}
+	return steps.String()
+}
+
+// GetCommonAncestors 获取两人的共同祖先（包括两人自身互为祖先的情况）及各自相隔的最少代数
+func (r *SQLiteRepository) GetCommonAncestors(ctx context.Context, individualID1, individualID2 int, generations int) ([]models.CommonAncestor, error) {
+	var rows *sql.Rows
+	var err error
+	if r.lineageClosure.Load() {
+		rows, err = r.conn(ctx).QueryContext(ctx, `
+			SELECT a.ancestor_id, MIN(a.depth), MIN(b.depth)
+			FROM individual_closure a
+			JOIN individual_closure b ON b.ancestor_id = a.ancestor_id AND b.descendant_id = ?2
+			WHERE a.descendant_id = ?1 AND a.depth <= ?3 AND b.depth <= ?3
+			GROUP BY a.ancestor_id
+			ORDER BY MIN(a.depth) + MIN(b.depth), a.ancestor_id
+		`, individualID1, individualID2, generations)
+	} else {
+		rows, err = r.conn(ctx).QueryContext(ctx, `
+			WITH RECURSIVE ancestry(origin, individual_id, depth) AS (
+				SELECT ?1, ?1, 0
+				UNION
+				SELECT ?2, ?2, 0`+ancestryParentSteps("a.origin, ", ", a.depth + 1", " AND a.depth < ?3")+`
+			)
+			SELECT a.individual_id, MIN(a.depth), MIN(b.depth)
+			FROM ancestry a
+			JOIN ancestry b ON b.individual_id = a.individual_id AND b.origin = ?2
+			JOIN individuals i ON i.individual_id = a.individual_id
+			WHERE a.origin = ?1 AND i.deleted_at IS NULL
+			GROUP BY a.individual_id
+			ORDER BY MIN(a.depth) + MIN(b.depth), a.individual_id
+		`, individualID1, individualID2, generations)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询共同祖先失败: %v", err)
+	}
+	defer rows.Close()
+
+	var ancestors []models.CommonAncestor
+	for rows.Next() {
+		var ancestor models.CommonAncestor
+		if err := rows.Scan(&ancestor.AncestorID, &ancestor.Generations1, &ancestor.Generations2); err != nil {
+			return nil, fmt.Errorf("扫描共同祖先失败: %v", err)
+		}
+		ancestors = append(ancestors, ancestor)
+	}
+
+	return ancestors, rows.Err()
+}
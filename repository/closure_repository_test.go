@@ -0,0 +1,322 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// closureSnapshot 读取闭包表和边表的全部内容用于比较
+func closureSnapshot(t *testing.T, repo *SQLiteRepository) []string {
+	t.Helper()
+	rows, err := repo.db.Query(`
+		SELECT 'c', ancestor_id, descendant_id, depth, path_count FROM individual_closure
+		UNION ALL
+		SELECT 'e', parent_id, child_id, 0, ref_count FROM lineage_edges
+		ORDER BY 1, 2, 3, 4
+	`)
+	if err != nil {
+		t.Fatalf("读取闭包表失败: %v", err)
+	}
+	defer rows.Close()
+
+	var snapshot []string
+	for rows.Next() {
+		var kind string
+		var a, b, depth, count int
+		if err := rows.Scan(&kind, &a, &b, &depth, &count); err != nil {
+			t.Fatalf("扫描闭包表失败: %v", err)
+		}
+		snapshot = append(snapshot, fmt.Sprintf("%s %d %d %d %d", kind, a, b, depth, count))
+	}
+	return snapshot
+}
+
+// assertClosureMatchesRebuild 增量维护的结果必须与完整重建一致
+func assertClosureMatchesRebuild(t *testing.T, repo *SQLiteRepository, step string) {
+	t.Helper()
+	incremental := closureSnapshot(t, repo)
+	if _, err := repo.RebuildLineageClosure(context.Background()); err != nil {
+		t.Fatalf("%s: 重建失败: %v", step, err)
+	}
+	if rebuilt := closureSnapshot(t, repo); !reflect.DeepEqual(incremental, rebuilt) {
+		t.Fatalf("%s: 增量维护结果与重建结果不一致\n增量: %v\n重建: %v", step, incremental, rebuilt)
+	}
+}
+
+func TestLineageClosureMaintenance(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	if err := repo.EnableLineageClosure(ctx); err != nil {
+		t.Fatalf("启用闭包表失败: %v", err)
+	}
+
+	grandfather := insertPerson(t, repo, "祖父", "male", nil, nil)
+	grandmother := insertPerson(t, repo, "祖母", "female", nil, nil)
+	father := insertPerson(t, repo, "父亲", "male", &grandfather, &grandmother)
+	mother := insertPerson(t, repo, "母亲", "female", nil, nil)
+	child := insertPerson(t, repo, "子女", "male", &father, nil)
+	assertClosureMatchesRebuild(t, repo, "插入个人")
+
+	if _, err := repo.db.Exec(`UPDATE individuals SET mother_id = ? WHERE individual_id = ?`, mother, child); err != nil {
+		t.Fatalf("更新母亲失败: %v", err)
+	}
+	assertClosureMatchesRebuild(t, repo, "更新父母")
+
+	// 家庭子女记录与父母字段指向同一条边时只计一次路径
+	result, err := repo.db.Exec(`INSERT INTO families (husband_id, wife_id) VALUES (?, ?)`, father, mother)
+	if err != nil {
+		t.Fatalf("创建家庭失败: %v", err)
+	}
+	familyID, _ := result.LastInsertId()
+	adopted := insertPerson(t, repo, "养子", "male", nil, nil)
+	for _, id := range []int{child, adopted} {
+		if _, err := repo.db.Exec(`INSERT INTO children (family_id, individual_id) VALUES (?, ?)`, familyID, id); err != nil {
+			t.Fatalf("添加子女失败: %v", err)
+		}
+	}
+	assertClosureMatchesRebuild(t, repo, "添加家庭子女")
+
+	isAncestor, err := repo.IsAncestor(ctx, grandfather, adopted)
+	if err != nil || !isAncestor {
+		t.Fatalf("祖父应为养子的祖先: %v %v", isAncestor, err)
+	}
+
+	if _, err := repo.db.Exec(`UPDATE families SET husband_id = NULL WHERE family_id = ?`, familyID); err != nil {
+		t.Fatalf("更新家庭失败: %v", err)
+	}
+	assertClosureMatchesRebuild(t, repo, "更新家庭成员")
+
+	if _, err := repo.db.Exec(`DELETE FROM children WHERE family_id = ? AND individual_id = ?`, familyID, adopted); err != nil {
+		t.Fatalf("删除子女失败: %v", err)
+	}
+	if _, err := repo.db.Exec(`DELETE FROM families WHERE family_id = ?`, familyID); err != nil {
+		t.Fatalf("删除家庭失败: %v", err)
+	}
+	assertClosureMatchesRebuild(t, repo, "删除家庭")
+
+	// 形成循环的修改会被触发器拒绝，原数据保持不变
+	_, err = repo.db.Exec(`UPDATE individuals SET father_id = ? WHERE individual_id = ?`, child, grandfather)
+	if !isCircularLineageError(err) {
+		t.Fatalf("应拒绝循环关系，实际错误: %v", err)
+	}
+
+	if _, err := repo.db.Exec(`UPDATE individuals SET father_id = NULL WHERE individual_id = ?`, child); err != nil {
+		t.Fatalf("清除父亲失败: %v", err)
+	}
+	if _, err := repo.db.Exec(`DELETE FROM individuals WHERE individual_id = ?`, father); err != nil {
+		t.Fatalf("删除个人失败: %v", err)
+	}
+	assertClosureMatchesRebuild(t, repo, "删除个人")
+}
+
+func TestLineageClosureTrash(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	if err := repo.EnableLineageClosure(ctx); err != nil {
+		t.Fatalf("启用闭包表失败: %v", err)
+	}
+
+	grandfather := insertPerson(t, repo, "祖父", "male", nil, nil)
+	father := insertPerson(t, repo, "父亲", "male", &grandfather, nil)
+	mother := insertPerson(t, repo, "母亲", "female", nil, nil)
+	child := insertPerson(t, repo, "子女", "male", &father, nil)
+	result, err := repo.db.Exec(`INSERT INTO families (husband_id, wife_id) VALUES (?, ?)`, father, mother)
+	if err != nil {
+		t.Fatalf("创建家庭失败: %v", err)
+	}
+	familyID, _ := result.LastInsertId()
+	if _, err := repo.db.Exec(`INSERT INTO children (family_id, individual_id) VALUES (?, ?)`, familyID, child); err != nil {
+		t.Fatalf("添加子女失败: %v", err)
+	}
+	assertClosureMatchesRebuild(t, repo, "建立家庭")
+
+	// 父亲移入回收站后，祖父与子女之间不再有世系
+	if err := repo.DeleteIndividual(ctx, father); err != nil {
+		t.Fatalf("删除个人失败: %v", err)
+	}
+	assertClosureMatchesRebuild(t, repo, "删除父亲")
+	if isAncestor, _ := repo.IsAncestor(ctx, grandfather, child); isAncestor {
+		t.Error("经过回收站中个人的世系不应存在")
+	}
+	if err := repo.DeleteFamily(ctx, int(familyID)); err != nil {
+		t.Fatalf("删除家庭失败: %v", err)
+	}
+	assertClosureMatchesRebuild(t, repo, "删除家庭")
+	if err := repo.DeleteIndividual(ctx, child); err != nil {
+		t.Fatalf("删除个人失败: %v", err)
+	}
+	assertClosureMatchesRebuild(t, repo, "删除子女")
+
+	items, _, err := repo.GetTrashItems(ctx, 1, 10, 0)
+	if err != nil || len(items) != 3 {
+		t.Fatalf("回收站: %+v, %v", items, err)
+	}
+	for i, item := range items {
+		if conflicts, err := repo.RestoreTrashItem(ctx, item.TrashID); err != nil || len(conflicts) != 0 {
+			t.Fatalf("恢复失败: %+v, %v", conflicts, err)
+		}
+		assertClosureMatchesRebuild(t, repo, fmt.Sprintf("恢复第 %d 条", i+1))
+	}
+	if isAncestor, _ := repo.IsAncestor(ctx, grandfather, child); !isAncestor {
+		t.Error("恢复后祖父应为子女的祖先")
+	}
+
+	if err := repo.DeleteIndividual(ctx, father); err != nil {
+		t.Fatalf("删除个人失败: %v", err)
+	}
+	items, _, _ = repo.GetTrashItems(ctx, 1, 10, 0)
+	if err := repo.PurgeTrashItem(ctx, items[0].TrashID); err != nil {
+		t.Fatalf("清除失败: %v", err)
+	}
+	assertClosureMatchesRebuild(t, repo, "清除父亲")
+}
+
+func TestLineageClosureMatchesRecursiveQueries(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	pedigreeID := seedPedigree(t, repo, 4)
+	descendantID := seedDescendants(t, repo, 4, 2)
+
+	// 只经由家庭子女记录连接的子女：养子的祖先经过家庭接上完整的祖先树，
+	// 始祖家庭中另有一位父母字段与子女记录重复的亲生子女
+	family := func(husband int) (int, int) {
+		wife := insertPerson(t, repo, "妻子", "female", nil, nil)
+		result, err := repo.db.Exec(`INSERT INTO families (husband_id, wife_id) VALUES (?, ?)`, husband, wife)
+		if err != nil {
+			t.Fatalf("创建家庭失败: %v", err)
+		}
+		familyID, _ := result.LastInsertId()
+		return int(familyID), wife
+	}
+	addChild := func(familyID, childID int) {
+		if _, err := repo.db.Exec(`INSERT INTO children (family_id, individual_id) VALUES (?, ?)`, familyID, childID); err != nil {
+			t.Fatalf("添加子女失败: %v", err)
+		}
+	}
+	pedigreeFamily, _ := family(pedigreeID)
+	ancestorID := insertPerson(t, repo, "养子", "male", nil, nil)
+	addChild(pedigreeFamily, ancestorID)
+
+	rootFamily, rootWife := family(descendantID)
+	var bornID int
+	if err := repo.db.QueryRow(`SELECT MIN(individual_id) FROM individuals WHERE father_id = ?`, descendantID).Scan(&bornID); err != nil {
+		t.Fatalf("查询子女失败: %v", err)
+	}
+	adoptedID := insertPerson(t, repo, "养女", "female", nil, nil)
+	addChild(rootFamily, bornID)
+	addChild(rootFamily, adoptedID)
+
+	queries := func() (ancestors, descendants []string) {
+		ancestorLineage, err := repo.GetAncestorLineage(ctx, ancestorID, 10)
+		if err != nil {
+			t.Fatalf("GetAncestorLineage: %v", err)
+		}
+		for _, entry := range ancestorLineage {
+			ancestors = append(ancestors, fmt.Sprintf("%d %d %d %s",
+				entry.Individual.IndividualID, entry.Generation, entry.LinkedID, entry.ParentRole))
+		}
+		descendantLineage, err := repo.GetDescendantLineage(ctx, descendantID, 3)
+		if err != nil {
+			t.Fatalf("GetDescendantLineage: %v", err)
+		}
+		for _, entry := range descendantLineage {
+			descendants = append(descendants, fmt.Sprintf("%d %d %d %s",
+				entry.Individual.IndividualID, entry.Generation, entry.LinkedID, entry.ParentRole))
+		}
+		return ancestors, descendants
+	}
+	// relations 经由子女记录的祖先关系和共同祖先
+	relations := func() []string {
+		var result []string
+		for _, pair := range [][2]int{{pedigreeID, ancestorID}, {rootWife, bornID}, {rootWife, adoptedID}, {descendantID, pedigreeID}} {
+			isAncestor, err := repo.IsAncestor(ctx, pair[0], pair[1])
+			if err != nil {
+				t.Fatalf("IsAncestor: %v", err)
+			}
+			result = append(result, fmt.Sprintf("%d>%d %v", pair[0], pair[1], isAncestor))
+		}
+		common, err := repo.GetCommonAncestors(ctx, bornID, adoptedID, 10)
+		if err != nil {
+			t.Fatalf("GetCommonAncestors: %v", err)
+		}
+		for _, ancestor := range common {
+			result = append(result, fmt.Sprintf("%d %d %d", ancestor.AncestorID, ancestor.Generations1, ancestor.Generations2))
+		}
+		return result
+	}
+
+	recursiveAncestors, recursiveDescendants := queries()
+	recursiveRelations := relations()
+	if len(recursiveAncestors) != 32 {
+		t.Errorf("养子应经由家庭接上养父母及其祖先: %v", recursiveAncestors)
+	}
+	wantRelations := []string{
+		fmt.Sprintf("%d>%d true", pedigreeID, ancestorID), fmt.Sprintf("%d>%d true", rootWife, bornID),
+		fmt.Sprintf("%d>%d true", rootWife, adoptedID), fmt.Sprintf("%d>%d false", descendantID, pedigreeID),
+		fmt.Sprintf("%d 1 1", descendantID), fmt.Sprintf("%d 1 1", rootWife),
+	}
+	if !reflect.DeepEqual(recursiveRelations, wantRelations) {
+		t.Errorf("递归查询的祖先关系: got %v, want %v", recursiveRelations, wantRelations)
+	}
+
+	if err := repo.EnableLineageClosure(ctx); err != nil {
+		t.Fatalf("启用闭包表失败: %v", err)
+	}
+	closureAncestors, closureDescendants := queries()
+	if closureRelations := relations(); !reflect.DeepEqual(recursiveRelations, closureRelations) {
+		t.Errorf("祖先关系不一致\n递归: %v\n闭包: %v", recursiveRelations, closureRelations)
+	}
+
+	if !reflect.DeepEqual(recursiveAncestors, closureAncestors) {
+		t.Errorf("祖先查询结果不一致\n递归: %v\n闭包: %v", recursiveAncestors, closureAncestors)
+	}
+	if !reflect.DeepEqual(recursiveDescendants, closureDescendants) {
+		t.Errorf("后代查询结果不一致\n递归: %v\n闭包: %v", recursiveDescendants, closureDescendants)
+	}
+}
+
+func TestLineageClosureDisableKeepsTables(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+	father := insertPerson(t, repo, "父亲", "male", nil, nil)
+
+	// 事先重建后启用，直接使用已有的闭包表
+	if _, err := repo.RebuildLineageClosure(ctx); err != nil {
+		t.Fatalf("重建失败: %v", err)
+	}
+	child := insertPerson(t, repo, "子女", "male", &father, nil)
+	if err := repo.EnableLineageClosure(ctx); err != nil {
+		t.Fatalf("启用闭包表失败: %v", err)
+	}
+	if ok, err := repo.IsAncestor(ctx, father, child); err != nil || !ok {
+		t.Fatalf("重建后写入的关系应已同步: %v %v", ok, err)
+	}
+
+	// 停用只删除触发器，表保留；再次停用不做任何修改
+	for i := 0; i < 2; i++ {
+		if err := repo.DisableLineageClosure(ctx); err != nil {
+			t.Fatalf("停用闭包表失败: %v", err)
+		}
+	}
+	var triggers, tables int
+	repo.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'lineage_%'`).Scan(&triggers)
+	repo.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name IN ('lineage_edges', 'individual_closure')`).Scan(&tables)
+	if triggers != 0 || tables != 2 {
+		t.Fatalf("停用后触发器 %d 个，表 %d 个", triggers, tables)
+	}
+
+	// 停用期间的写入不同步，再次启用时重建
+	grandchild := insertPerson(t, repo, "孙", "male", &child, nil)
+	if err := repo.EnableLineageClosure(ctx); err != nil {
+		t.Fatalf("再次启用闭包表失败: %v", err)
+	}
+	if ok, err := repo.IsAncestor(ctx, father, grandchild); err != nil || !ok {
+		t.Fatalf("再次启用后应重建闭包表: %v %v", ok, err)
+	}
+	assertClosureMatchesRebuild(t, repo, "再次启用")
+}
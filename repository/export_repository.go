@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"familytree/models"
+)
+
+// 表格导出
+//
+// 每种数据集一条查询，地点和父母、配偶等姓名在 SQL 中关联得出，逐行交给回调写出，不把整棵树读入内存。
+// 家庭和子女关系的归属与快照一致：家庭以夫妻所在的家族树为准，子女关系以子女所在的家族树为准。
+// 回收站中的记录不导出。
+
+// exportDate 日期列取前 10 位，兼容带时间的写法
+func exportDate(column string) string {
+	return fmt.Sprintf("COALESCE(substr(%s, 1, 10), '')", column)
+}
+
+// exportSpouse 家庭中丈夫（h）或妻子（w）的ID和姓名，在回收站中的按空导出
+func exportSpouse(alias string) string {
+	return fmt.Sprintf("CASE WHEN %[1]s.deleted_at IS NULL THEN %[1]s.individual_id END, "+
+		"CASE WHEN %[1]s.deleted_at IS NULL THEN COALESCE(%[1]s.full_name, '') ELSE '' END", alias)
+}
+
+// exportSearch 与个人搜索相同的条件：姓名或备注包含 query，aliases 为个人表的别名，任一人符合即可
+func exportSearch(filter models.ExportFilter, aliases ...string) (string, []interface{}) {
+	if filter.Query == "" {
+		return "", nil
+	}
+	pattern := "%" + filter.Query + "%"
+	var conditions []string
+	var args []interface{}
+	for _, alias := range aliases {
+		conditions = append(conditions, fmt.Sprintf("%[1]s.full_name LIKE ? OR %[1]s.notes LIKE ?", alias))
+		args = append(args, pattern, pattern)
+	}
+	return " AND (" + strings.Join(conditions, " OR ") + ")", args
+}
+
+// exportRows 执行查询并逐行调用 scan，scan 或回调返回错误时停止
+func (r *SQLiteRepository) exportRows(ctx context.Context, query string, args []interface{}, scan func(rows *sql.Rows) error) error {
+	rows, err := r.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("查询导出数据失败: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ExportPeople 逐个导出家族树中的个人，按ID排列
+func (r *SQLiteRepository) ExportPeople(ctx context.Context, familyTreeID int, filter models.ExportFilter, fn func(*models.ExportPerson) error) error {
+	search, searchArgs := exportSearch(filter, "i")
+	query := `
+		SELECT i.individual_id, i.full_name, i.gender,
+		       ` + exportDate("i.birth_date") + `, COALESCE(bp.place_name, i.birth_place, ''),
+		       ` + exportDate("i.death_date") + `, COALESCE(dp.place_name, i.death_place, ''),
+		       COALESCE(up.place_name, i.burial_place, ''),
+		       COALESCE(i.occupation, ''), COALESCE(i.notes, ''),
+		       fa.individual_id, COALESCE(fa.full_name, ''), mo.individual_id, COALESCE(mo.full_name, ''),
+		       COALESCE((
+		           SELECT group_concat(s.full_name, '、' ORDER BY f.marriage_order, f.family_id)
+		           FROM families f
+		           JOIN individuals s ON s.individual_id = CASE WHEN f.husband_id = i.individual_id THEN f.wife_id ELSE f.husband_id END
+		           WHERE i.individual_id IN (f.husband_id, f.wife_id) AND f.deleted_at IS NULL AND s.deleted_at IS NULL
+		       ), '')
+		FROM individuals i
+		LEFT JOIN places bp ON bp.place_id = i.birth_place_id
+		LEFT JOIN places dp ON dp.place_id = i.death_place_id
+		LEFT JOIN places up ON up.place_id = i.burial_place_id
+		LEFT JOIN individuals fa ON fa.individual_id = i.father_id AND fa.deleted_at IS NULL
+		LEFT JOIN individuals mo ON mo.individual_id = i.mother_id AND mo.deleted_at IS NULL
+		WHERE i.family_tree_id = ? AND i.deleted_at IS NULL` + search + `
+		ORDER BY i.individual_id`
+
+	args := append([]interface{}{familyTreeID}, searchArgs...)
+	return r.exportRows(ctx, query, args, func(rows *sql.Rows) error {
+		var p models.ExportPerson
+		if err := rows.Scan(&p.IndividualID, &p.FullName, &p.Gender,
+			&p.BirthDate, &p.BirthPlace, &p.DeathDate, &p.DeathPlace, &p.BurialPlace,
+			&p.Occupation, &p.Notes, &p.FatherID, &p.FatherName, &p.MotherID, &p.MotherName, &p.Spouses); err != nil {
+			return fmt.Errorf("扫描个人信息失败: %v", err)
+		}
+		return fn(&p)
+	})
+}
+
+// ExportFamilies 逐个导出家族树中的家庭，按ID排列
+func (r *SQLiteRepository) ExportFamilies(ctx context.Context, familyTreeID int, filter models.ExportFilter, fn func(*models.ExportFamily) error) error {
+	search, searchArgs := exportSearch(filter, "h", "w")
+	query := `
+		SELECT f.family_id, ` + exportSpouse("h") + `, ` + exportSpouse("w") + `,
+		       COALESCE(f.marriage_order, 1),
+		       ` + exportDate("f.marriage_date") + `, COALESCE(mp.place_name, ''),
+		       ` + exportDate("f.divorce_date") + `, COALESCE(dp.place_name, ''),
+		       (SELECT COUNT(*) FROM children c WHERE c.family_id = f.family_id AND c.deleted_at IS NULL),
+		       COALESCE(f.notes, '')
+		FROM families f
+		LEFT JOIN individuals h ON h.individual_id = f.husband_id
+		LEFT JOIN individuals w ON w.individual_id = f.wife_id
+		LEFT JOIN places mp ON mp.place_id = f.marriage_place_id
+		LEFT JOIN places dp ON dp.place_id = f.divorce_place_id
+		WHERE f.deleted_at IS NULL AND (h.family_tree_id = ? OR w.family_tree_id = ?
+		       OR (f.family_tree_id = ? AND h.family_tree_id IS NULL AND w.family_tree_id IS NULL))` + search + `
+		ORDER BY f.family_id`
+
+	args := append([]interface{}{familyTreeID, familyTreeID, familyTreeID}, searchArgs...)
+	return r.exportRows(ctx, query, args, func(rows *sql.Rows) error {
+		var f models.ExportFamily
+		if err := rows.Scan(&f.FamilyID, &f.HusbandID, &f.HusbandName, &f.WifeID, &f.WifeName, &f.MarriageOrder,
+			&f.MarriageDate, &f.MarriagePlace, &f.DivorceDate, &f.DivorcePlace, &f.Children, &f.Notes); err != nil {
+			return fmt.Errorf("扫描家庭信息失败: %v", err)
+		}
+		return fn(&f)
+	})
+}
+
+// ExportChildren 逐条导出家族树中的子女关系，按家庭、排行排列
+func (r *SQLiteRepository) ExportChildren(ctx context.Context, familyTreeID int, filter models.ExportFilter, fn func(*models.ExportChild) error) error {
+	search, searchArgs := exportSearch(filter, "i")
+	query := `
+		SELECT c.family_id, c.individual_id, i.full_name, i.gender, ` + exportDate("i.birth_date") + `,
+		       COALESCE(c.relationship_type, ''),
+		       ` + exportSpouse("h") + `, ` + exportSpouse("w") + `
+		FROM children c
+		JOIN individuals i ON i.individual_id = c.individual_id
+		JOIN families f ON f.family_id = c.family_id
+		LEFT JOIN individuals h ON h.individual_id = f.husband_id
+		LEFT JOIN individuals w ON w.individual_id = f.wife_id
+		WHERE i.family_tree_id = ? AND c.deleted_at IS NULL` + search + `
+		ORDER BY c.family_id, c.birth_order IS NULL, c.birth_order, i.birth_date IS NULL, i.birth_date, c.individual_id`
+
+	args := append([]interface{}{familyTreeID}, searchArgs...)
+	return r.exportRows(ctx, query, args, func(rows *sql.Rows) error {
+		var c models.ExportChild
+		if err := rows.Scan(&c.FamilyID, &c.IndividualID, &c.FullName, &c.Gender, &c.BirthDate, &c.Relationship,
+			&c.FatherID, &c.FatherName, &c.MotherID, &c.MotherName); err != nil {
+			return fmt.Errorf("扫描子女关系失败: %v", err)
+		}
+		return fn(&c)
+	})
+}
+
+// ExportEvents 逐个导出家族树中的事件，按人、日期排列
+func (r *SQLiteRepository) ExportEvents(ctx context.Context, familyTreeID int, filter models.ExportFilter, fn func(*models.ExportEvent) error) error {
+	search, searchArgs := exportSearch(filter, "i")
+	query := `
+		SELECT e.event_id, e.individual_id, i.full_name, e.event_type, ` + exportDate("e.event_date") + `,
+		       COALESCE(p.place_name, ''), COALESCE(e.description, ''), COALESCE(e.notes, '')
+		FROM events e
+		JOIN individuals i ON i.individual_id = e.individual_id
+		LEFT JOIN places p ON p.place_id = e.place_id
+		WHERE i.family_tree_id = ? AND e.deleted_at IS NULL` + search + `
+		ORDER BY e.individual_id, e.event_date IS NULL, e.event_date, e.event_id`
+
+	args := append([]interface{}{familyTreeID}, searchArgs...)
+	return r.exportRows(ctx, query, args, func(rows *sql.Rows) error {
+		var e models.ExportEvent
+		if err := rows.Scan(&e.EventID, &e.IndividualID, &e.FullName, &e.EventType, &e.EventDate,
+			&e.Place, &e.Description, &e.Notes); err != nil {
+			return fmt.Errorf("扫描事件失败: %v", err)
+		}
+		return fn(&e)
+	})
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"familytree/models"
+)
+
+func TestExport(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+	mustExec := func(query string, args ...interface{}) int {
+		t.Helper()
+		result, err := repo.db.Exec(query, args...)
+		if err != nil {
+			t.Fatalf("执行失败: %v", err)
+		}
+		id, _ := result.LastInsertId()
+		return int(id)
+	}
+
+	// 示例数据位于 1 号家族树，测试数据单独建树
+	userID := mustExec(`INSERT INTO users (username, email, password, full_name) VALUES ('export', 'export@example.com', 'x', '导出')`)
+	treeID := mustExec(`INSERT INTO user_family_trees (user_id, family_tree_name) VALUES (?, '导出测试')`, userID)
+	placeID := mustExec(`INSERT INTO places (place_name) VALUES ('北京')`)
+	fatherID := insertPerson(t, repo, "张父", "male", nil, nil)
+	motherID := insertPerson(t, repo, "李母", "female", nil, nil)
+	secondID := insertPerson(t, repo, "王继母", "female", nil, nil)
+	childID := insertPerson(t, repo, "张三", "male", &fatherID, &motherID)
+	mustExec(`UPDATE individuals SET family_tree_id = ? WHERE individual_id >= ?`, treeID, fatherID)
+	mustExec(`UPDATE individuals SET birth_date = '1950-02-01 00:00:00', birth_place_id = ?, death_place = '上海' WHERE individual_id = ?`, placeID, childID)
+	other := insertPerson(t, repo, "张外人", "male", nil, nil)
+
+	familyID := mustExec(`INSERT INTO families (husband_id, wife_id, marriage_order, marriage_date, marriage_place_id) VALUES (?, ?, 1, '1948-05-01', ?)`, fatherID, motherID, placeID)
+	mustExec(`INSERT INTO families (husband_id, wife_id, marriage_order) VALUES (?, ?, 2)`, fatherID, secondID)
+	mustExec(`INSERT INTO children (family_id, individual_id, relationship_type) VALUES (?, ?, 'biological')`, familyID, childID)
+	mustExec(`INSERT INTO events (individual_id, event_type, event_date, place_id) VALUES (?, 'graduation', '1970-07-01', ?)`, childID, placeID)
+	mustExec(`INSERT INTO events (individual_id, event_type) VALUES (?, 'birth')`, other)
+
+	var people []models.ExportPerson
+	err := repo.ExportPeople(ctx, treeID, models.ExportFilter{}, func(p *models.ExportPerson) error {
+		people = append(people, *p)
+		return nil
+	})
+	if err != nil || len(people) != 4 {
+		t.Fatalf("导出个人错误: %v %+v", err, people)
+	}
+	if p := people[0]; p.FullName != "张父" || p.Spouses != "李母、王继母" {
+		t.Errorf("配偶应按婚姻次序排列: %+v", p)
+	}
+	if p := people[3]; p.BirthDate != "1950-02-01" || p.BirthPlace != "北京" || p.DeathPlace != "上海" ||
+		p.FatherName != "张父" || p.MotherName != "李母" || p.MotherID == nil || *p.MotherID != motherID {
+		t.Errorf("地点和父母应解析为名称: %+v", p)
+	}
+
+	// 筛选条件与个人搜索相同
+	var names []string
+	repo.ExportPeople(ctx, treeID, models.ExportFilter{Query: "张"}, func(p *models.ExportPerson) error {
+		names = append(names, p.FullName)
+		return nil
+	})
+	if len(names) != 2 || names[0] != "张父" || names[1] != "张三" {
+		t.Errorf("筛选结果 %v", names)
+	}
+
+	var families []models.ExportFamily
+	repo.ExportFamilies(ctx, treeID, models.ExportFilter{Query: "李"}, func(f *models.ExportFamily) error {
+		families = append(families, *f)
+		return nil
+	})
+	if len(families) != 1 || families[0].HusbandName != "张父" || families[0].WifeName != "李母" ||
+		families[0].MarriageDate != "1948-05-01" || families[0].MarriagePlace != "北京" || families[0].Children != 1 {
+		t.Errorf("导出家庭错误: %+v", families)
+	}
+
+	var children []models.ExportChild
+	repo.ExportChildren(ctx, treeID, models.ExportFilter{}, func(c *models.ExportChild) error {
+		children = append(children, *c)
+		return nil
+	})
+	if len(children) != 1 || children[0].FullName != "张三" || children[0].FatherName != "张父" || children[0].MotherName != "李母" {
+		t.Errorf("导出子女关系错误: %+v", children)
+	}
+
+	var events []models.ExportEvent
+	repo.ExportEvents(ctx, treeID, models.ExportFilter{}, func(e *models.ExportEvent) error {
+		events = append(events, *e)
+		return nil
+	})
+	if len(events) != 1 || events[0].FullName != "张三" || events[0].Place != "北京" || events[0].EventDate != "1970-07-01" {
+		t.Errorf("只应导出该家族树的事件: %+v", events)
+	}
+}
@@ -0,0 +1,233 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"familytree/models"
+)
+
+// 世系递归查询
+//
+// 父母来自 father_id/mother_id 以及未删除家庭中未删除的子女记录的夫妻，与闭包表的边来源一致。
+// 子女记录中与父母字段重复的父母只经由父母字段计入，角色按父母的性别确定。
+// 递归部分的 UNION 会按 (个人, 代数, 连接人, 角色) 去重，
+// 因此祖先重叠不会导致结果成倍增长；代数上限同时防止了
+// 错误数据中的循环关系造成无限递归。回收站中的个人既不出现在结果中，也不再向上或向下延伸。
+
+const ancestorLineageQuery = `
+	WITH RECURSIVE lineage(individual_id, generation, linked_id, parent_role) AS (
+		SELECT individual_id, 0, NULL, NULL FROM individuals WHERE individual_id = ?1 AND deleted_at IS NULL
+		UNION
+		SELECT i.father_id, l.generation + 1, i.individual_id, 'father'
+		FROM lineage l JOIN individuals i ON i.individual_id = l.individual_id
+		WHERE i.father_id IS NOT NULL AND i.deleted_at IS NULL AND l.generation < ?2
+		UNION
+		SELECT i.mother_id, l.generation + 1, i.individual_id, 'mother'
+		FROM lineage l JOIN individuals i ON i.individual_id = l.individual_id
+		WHERE i.mother_id IS NOT NULL AND i.deleted_at IS NULL AND l.generation < ?2
+		UNION
+		SELECT p.individual_id, l.generation + 1, i.individual_id, CASE WHEN p.gender = 'female' THEN 'mother' ELSE 'father' END
+		FROM lineage l JOIN individuals i ON i.individual_id = l.individual_id
+		JOIN children c ON c.individual_id = i.individual_id AND c.deleted_at IS NULL
+		JOIN families f ON f.family_id = c.family_id AND f.deleted_at IS NULL
+		JOIN individuals p ON p.individual_id = f.husband_id
+		WHERE i.deleted_at IS NULL AND l.generation < ?2
+		  AND p.individual_id IS NOT i.father_id AND p.individual_id IS NOT i.mother_id
+		UNION
+		SELECT p.individual_id, l.generation + 1, i.individual_id, CASE WHEN p.gender = 'female' THEN 'mother' ELSE 'father' END
+		FROM lineage l JOIN individuals i ON i.individual_id = l.individual_id
+		JOIN children c ON c.individual_id = i.individual_id AND c.deleted_at IS NULL
+		JOIN families f ON f.family_id = c.family_id AND f.deleted_at IS NULL
+		JOIN individuals p ON p.individual_id = f.wife_id
+		WHERE i.deleted_at IS NULL AND l.generation < ?2
+		  AND p.individual_id IS NOT i.father_id AND p.individual_id IS NOT i.mother_id
+	)
+	SELECT i.individual_id, i.full_name, i.gender, i.birth_date, i.birth_place, i.birth_place_id,
+	       i.death_date, i.death_place, i.death_place_id, i.burial_place_id,
+	       i.occupation, i.notes, i.photo_url, i.father_id, i.mother_id, i.version, i.created_at, i.updated_at,
+	       l.generation, l.linked_id, l.parent_role
+	FROM lineage l JOIN individuals i ON i.individual_id = l.individual_id
+	WHERE l.generation > 0 AND i.deleted_at IS NULL
+	ORDER BY l.generation, l.linked_id, l.parent_role, i.individual_id
+`
+
+const descendantLineageQuery = `
+	WITH RECURSIVE lineage(individual_id, generation, linked_id, parent_role) AS (
+		SELECT individual_id, 0, NULL, NULL FROM individuals WHERE individual_id = ?1 AND deleted_at IS NULL
+		UNION
+		SELECT i.individual_id, l.generation + 1, i.father_id, 'father'
+		FROM lineage l JOIN individuals i ON i.father_id = l.individual_id
+		WHERE i.deleted_at IS NULL AND l.generation < ?2
+		UNION
+		SELECT i.individual_id, l.generation + 1, i.mother_id, 'mother'
+		FROM lineage l JOIN individuals i ON i.mother_id = l.individual_id
+		WHERE i.deleted_at IS NULL AND l.generation < ?2
+		UNION
+		SELECT i.individual_id, l.generation + 1, p.individual_id, CASE WHEN p.gender = 'female' THEN 'mother' ELSE 'father' END
+		FROM lineage l JOIN individuals p ON p.individual_id = l.individual_id
+		JOIN families f ON f.husband_id = p.individual_id AND f.deleted_at IS NULL
+		JOIN children c ON c.family_id = f.family_id AND c.deleted_at IS NULL
+		JOIN individuals i ON i.individual_id = c.individual_id
+		WHERE i.deleted_at IS NULL AND l.generation < ?2
+		  AND p.individual_id IS NOT i.father_id AND p.individual_id IS NOT i.mother_id
+		UNION
+		SELECT i.individual_id, l.generation + 1, p.individual_id, CASE WHEN p.gender = 'female' THEN 'mother' ELSE 'father' END
+		FROM lineage l JOIN individuals p ON p.individual_id = l.individual_id
+		JOIN families f ON f.wife_id = p.individual_id AND f.deleted_at IS NULL
+		JOIN children c ON c.family_id = f.family_id AND c.deleted_at IS NULL
+		JOIN individuals i ON i.individual_id = c.individual_id
+		WHERE i.deleted_at IS NULL AND l.generation < ?2
+		  AND p.individual_id IS NOT i.father_id AND p.individual_id IS NOT i.mother_id
+	)
+	SELECT i.individual_id, i.full_name, i.gender, i.birth_date, i.birth_place, i.birth_place_id,
+	       i.death_date, i.death_place, i.death_place_id, i.burial_place_id,
+	       i.occupation, i.notes, i.photo_url, i.father_id, i.mother_id, i.version, i.created_at, i.updated_at,
+	       l.generation, l.linked_id, l.parent_role
+	FROM lineage l JOIN individuals i ON i.individual_id = l.individual_id
+	WHERE l.generation > 0
+	ORDER BY l.generation, l.linked_id, i.birth_date, i.individual_id
+`
+
+// closureAncestorLineageQuery 基于闭包表的祖先查询：祖先 A 位于第 d 代，
+// 连接边的子女 X 必须是起点的第 d-1 代祖先（或起点本身）
+const closureAncestorLineageQuery = `
+	SELECT i.individual_id, i.full_name, i.gender, i.birth_date, i.birth_place, i.birth_place_id,
+	       i.death_date, i.death_place, i.death_place_id, i.burial_place_id,
+	       i.occupation, i.notes, i.photo_url, i.father_id, i.mother_id, i.version, i.created_at, i.updated_at,
+	       c.depth, e.child_id,
+	       CASE WHEN x.father_id = e.parent_id THEN 'father'
+	            WHEN x.mother_id = e.parent_id THEN 'mother'
+	            WHEN i.gender = 'female' THEN 'mother'
+	            ELSE 'father' END AS parent_role
+	FROM individual_closure c
+	JOIN lineage_edges e ON e.parent_id = c.ancestor_id
+	JOIN individual_closure cx ON cx.ancestor_id = e.child_id
+	     AND cx.descendant_id = c.descendant_id AND cx.depth = c.depth - 1
+	JOIN individuals i ON i.individual_id = c.ancestor_id
+	JOIN individuals x ON x.individual_id = e.child_id
+	WHERE c.descendant_id = ?1 AND c.depth BETWEEN 1 AND ?2
+	ORDER BY c.depth, e.child_id, parent_role, i.individual_id
+`
+
+// closureDescendantLineageQuery 基于闭包表的后代查询：后代 D 位于第 d 代，
+// 连接边的父母 P 必须是起点的第 d-1 代后代（或起点本身）
+const closureDescendantLineageQuery = `
+	SELECT i.individual_id, i.full_name, i.gender, i.birth_date, i.birth_place, i.birth_place_id,
+	       i.death_date, i.death_place, i.death_place_id, i.burial_place_id,
+	       i.occupation, i.notes, i.photo_url, i.father_id, i.mother_id, i.version, i.created_at, i.updated_at,
+	       c.depth, e.parent_id,
+	       CASE WHEN i.father_id = e.parent_id THEN 'father'
+	            WHEN i.mother_id = e.parent_id THEN 'mother'
+	            WHEN p.gender = 'female' THEN 'mother'
+	            ELSE 'father' END AS parent_role
+	FROM individual_closure c
+	JOIN lineage_edges e ON e.child_id = c.descendant_id
+	JOIN individual_closure cp ON cp.ancestor_id = c.ancestor_id
+	     AND cp.descendant_id = e.parent_id AND cp.depth = c.depth - 1
+	JOIN individuals i ON i.individual_id = c.descendant_id
+	JOIN individuals p ON p.individual_id = e.parent_id
+	WHERE c.ancestor_id = ?1 AND c.depth BETWEEN 1 AND ?2
+	ORDER BY c.depth, e.parent_id, i.birth_date, i.individual_id
+`
+
+// GetAncestorLineage 一次查询获取祖先及其代数和连接边，启用闭包表时直接查表
+func (r *SQLiteRepository) GetAncestorLineage(ctx context.Context, individualID int, generations int) ([]models.LineageEntry, error) {
+	query := ancestorLineageQuery
+	if r.lineageClosure.Load() {
+		query = closureAncestorLineageQuery
+	}
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, individualID, generations)
+	if err != nil {
+		return nil, fmt.Errorf("查询祖先世系失败: %v", err)
+	}
+	defer rows.Close()
+
+	return scanLineageEntries(rows)
+}
+
+// GetDescendantLineage 一次查询获取后代及其代数和连接边，启用闭包表时直接查表
+func (r *SQLiteRepository) GetDescendantLineage(ctx context.Context, individualID int, generations int) ([]models.LineageEntry, error) {
+	query := descendantLineageQuery
+	if r.lineageClosure.Load() {
+		query = closureDescendantLineageQuery
+	}
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, individualID, generations)
+	if err != nil {
+		return nil, fmt.Errorf("查询后代世系失败: %v", err)
+	}
+	defer rows.Close()
+
+	return scanLineageEntries(rows)
+}
+
+// scanLineageEntries 扫描世系查询结果
+func scanLineageEntries(rows *sql.Rows) ([]models.LineageEntry, error) {
+	var entries []models.LineageEntry
+	for rows.Next() {
+		var entry models.LineageEntry
+		individual := &entry.Individual
+		err := rows.Scan(
+			&individual.IndividualID, &individual.FullName, &individual.Gender,
+			&individual.BirthDate, &individual.BirthPlace, &individual.BirthPlaceID, &individual.DeathDate,
+			&individual.DeathPlace, &individual.DeathPlaceID, &individual.BurialPlaceID, &individual.Occupation, &individual.Notes,
+			&individual.PhotoURL, &individual.FatherID, &individual.MotherID,
+			&individual.Version,
+			&individual.CreatedAt, &individual.UpdatedAt,
+			&entry.Generation, &entry.LinkedID, &entry.ParentRole)
+
+		if err != nil {
+			return nil, fmt.Errorf("扫描世系信息失败: %v", err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// GetParentIDs 批量获取父母ID，合并 father_id/mother_id 与 children 表中家庭的夫妻，回收站中的父母不计入
+func (r *SQLiteRepository) GetParentIDs(ctx context.Context, ids []int) (map[int][]int, error) {
+	result := make(map[int][]int)
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	placeholders, list := inClause(ids)
+	var args []interface{}
+	for i := 0; i < 4; i++ {
+		args = append(args, list...)
+	}
+	rows, err := r.conn(ctx).QueryContext(ctx, fmt.Sprintf(`
+		SELECT i.individual_id, i.father_id FROM individuals i JOIN individuals p ON p.individual_id = i.father_id
+		WHERE i.individual_id IN (%[1]s) AND p.deleted_at IS NULL
+		UNION
+		SELECT i.individual_id, i.mother_id FROM individuals i JOIN individuals p ON p.individual_id = i.mother_id
+		WHERE i.individual_id IN (%[1]s) AND p.deleted_at IS NULL
+		UNION
+		SELECT c.individual_id, f.husband_id FROM children c JOIN families f ON f.family_id = c.family_id
+		JOIN individuals p ON p.individual_id = f.husband_id
+		WHERE c.individual_id IN (%[1]s) AND c.deleted_at IS NULL AND f.deleted_at IS NULL AND p.deleted_at IS NULL
+		UNION
+		SELECT c.individual_id, f.wife_id FROM children c JOIN families f ON f.family_id = c.family_id
+		JOIN individuals p ON p.individual_id = f.wife_id
+		WHERE c.individual_id IN (%[1]s) AND c.deleted_at IS NULL AND f.deleted_at IS NULL AND p.deleted_at IS NULL
+		ORDER BY 1, 2
+	`, placeholders), args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询父母失败: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var childID, parentID int
+		if err := rows.Scan(&childID, &parentID); err != nil {
+			return nil, fmt.Errorf("扫描父母失败: %v", err)
+		}
+		result[childID] = append(result[childID], parentID)
+	}
+	return result, rows.Err()
+}
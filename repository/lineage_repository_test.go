@@ -0,0 +1,281 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"familytree/pkg/middleware"
+)
+
+func TestMain(m *testing.M) {
+	// 初始化脚本按相对路径 sql/init.sql 读取，需要在项目根目录运行
+	if err := os.Chdir(".."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// newTestRepository 在临时目录中创建测试数据库
+func newTestRepository(tb testing.TB) *SQLiteRepository {
+	tb.Helper()
+	repo, err := NewSQLiteRepository(filepath.Join(tb.TempDir(), "test.db"))
+	if err != nil {
+		tb.Fatalf("创建测试数据库失败: %v", err)
+	}
+	tb.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+// withChangeSet 为一次修改分配新的变更集
+func withChangeSet(tb testing.TB, ctx context.Context) context.Context {
+	tb.Helper()
+	ctx, err := middleware.WithChangeSet(ctx)
+	if err != nil {
+		tb.Fatalf("生成变更集失败: %v", err)
+	}
+	return ctx
+}
+
+// insertPerson 插入一个只含姓名、性别和父母的个人
+func insertPerson(tb testing.TB, repo *SQLiteRepository, name, gender string, fatherID, motherID *int) int {
+	tb.Helper()
+	result, err := repo.db.Exec(
+		`INSERT INTO individuals (full_name, gender, occupation, notes, father_id, mother_id) VALUES (?, ?, '', '', ?, ?)`,
+		name, gender, fatherID, motherID)
+	if err != nil {
+		tb.Fatalf("插入个人失败: %v", err)
+	}
+	id, _ := result.LastInsertId()
+	return int(id)
+}
+
+// seedPedigree 生成带有 generations 代完整祖先的个人，返回其ID
+func seedPedigree(tb testing.TB, repo *SQLiteRepository, generations int) int {
+	tb.Helper()
+	var build func(gen int) *int
+	build = func(gen int) *int {
+		if gen > generations {
+			return nil
+		}
+		father := build(gen + 1)
+		mother := build(gen + 1)
+		id := insertPerson(tb, repo, "祖先", "male", father, mother)
+		return &id
+	}
+	return *build(0)
+}
+
+// seedDescendants 生成 generations 代、每人 width 个子女的后代，返回始祖ID
+func seedDescendants(tb testing.TB, repo *SQLiteRepository, generations, width int) int {
+	tb.Helper()
+	rootID := insertPerson(tb, repo, "始祖", "male", nil, nil)
+	current := []int{rootID}
+	for gen := 1; gen <= generations; gen++ {
+		var next []int
+		for _, parentID := range current {
+			parent := parentID
+			for i := 0; i < width; i++ {
+				next = append(next, insertPerson(tb, repo, "后代", "male", &parent, nil))
+			}
+		}
+		current = next
+	}
+	return rootID
+}
+
+func TestLineageMatchesRecursiveQueries(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	// 构造一个表亲婚配的小家族：曾祖父母的两个孙辈结婚，其子女出现祖先重叠
+	greatGrandfather := insertPerson(t, repo, "曾祖父", "male", nil, nil)
+	greatGrandmother := insertPerson(t, repo, "曾祖母", "female", nil, nil)
+	son := insertPerson(t, repo, "长子", "male", &greatGrandfather, &greatGrandmother)
+	daughter := insertPerson(t, repo, "次女", "female", &greatGrandfather, &greatGrandmother)
+	cousinA := insertPerson(t, repo, "堂兄", "male", &son, nil)
+	cousinB := insertPerson(t, repo, "表妹", "female", nil, &daughter)
+	child := insertPerson(t, repo, "子女", "male", &cousinA, &cousinB)
+
+	lineage, err := repo.GetAncestorLineage(ctx, child, 10)
+	if err != nil {
+		t.Fatalf("GetAncestorLineage: %v", err)
+	}
+	recursive, err := repo.GetAncestors(ctx, child, 10)
+	if err != nil {
+		t.Fatalf("GetAncestors: %v", err)
+	}
+
+	lineageIDs := make(map[int]bool)
+	for _, entry := range lineage {
+		lineageIDs[entry.Individual.IndividualID] = true
+	}
+	recursiveIDs := make(map[int]bool)
+	for _, individual := range recursive {
+		recursiveIDs[individual.IndividualID] = true
+	}
+	if len(lineageIDs) != len(recursiveIDs) {
+		t.Fatalf("祖先数量不一致: CTE=%d 递归=%d", len(lineageIDs), len(recursiveIDs))
+	}
+	for id := range recursiveIDs {
+		if !lineageIDs[id] {
+			t.Errorf("CTE 结果缺少祖先 %d", id)
+		}
+	}
+
+	// 曾祖父经由父亲和母亲两条边到达，均为第3代
+	var edges []int
+	for _, entry := range lineage {
+		if entry.Individual.IndividualID == greatGrandfather {
+			if entry.Generation != 3 || entry.ParentRole != "father" {
+				t.Errorf("曾祖父的代数/角色错误: %+v", entry)
+			}
+			edges = append(edges, entry.LinkedID)
+		}
+	}
+	sort.Ints(edges)
+	if len(edges) != 2 || edges[0] != son || edges[1] != daughter {
+		t.Errorf("曾祖父的连接边错误: %v", edges)
+	}
+
+	descendants, err := repo.GetDescendantLineage(ctx, greatGrandfather, 1)
+	if err != nil {
+		t.Fatalf("GetDescendantLineage: %v", err)
+	}
+	if len(descendants) != 2 {
+		t.Errorf("限定1代时应只返回子女，实际 %d 条", len(descendants))
+	}
+}
+
+func BenchmarkAncestors(b *testing.B) {
+	repo := newTestRepository(b)
+	ctx := context.Background()
+	rootID := seedPedigree(b, repo, 9)
+
+	b.Run("Recursive", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := repo.GetAncestors(ctx, rootID, 10); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("CTE", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := repo.GetAncestorLineage(ctx, rootID, 10); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkDescendants(b *testing.B) {
+	repo := newTestRepository(b)
+	ctx := context.Background()
+	rootID := seedDescendants(b, repo, 8, 2)
+
+	b.Run("Recursive", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := repo.GetDescendants(ctx, rootID, 10); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("CTE", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := repo.GetDescendantLineage(ctx, rootID, 10); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkDeepLineage(b *testing.B) {
+	repo := newTestRepository(b)
+	ctx := context.Background()
+
+	// 25代单传世系，超出旧实现10代的上限
+	rootID := seedDescendants(b, repo, 25, 1)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		entries, err := repo.GetDescendantLineage(ctx, rootID, 25)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(entries) != 25 {
+			b.Fatalf("应返回25代，实际 %d", len(entries))
+		}
+	}
+}
+
+func TestGetParentIDs(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	father := insertPerson(t, repo, "父亲", "male", nil, nil)
+	mother := insertPerson(t, repo, "母亲", "female", nil, nil)
+	child := insertPerson(t, repo, "亲生", "male", &father, nil)
+	adopted := insertPerson(t, repo, "养子", "male", nil, nil)
+
+	result, err := repo.db.Exec(`INSERT INTO families (husband_id, wife_id) VALUES (?, ?)`, father, mother)
+	if err != nil {
+		t.Fatal(err)
+	}
+	familyID, _ := result.LastInsertId()
+	for _, id := range []int{child, adopted} {
+		if _, err := repo.db.Exec(`INSERT INTO children (family_id, individual_id) VALUES (?, ?)`, familyID, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	parents, err := repo.GetParentIDs(ctx, []int{father, child, adopted})
+	if err != nil {
+		t.Fatalf("查询父母失败: %v", err)
+	}
+	want := []int{father, mother}
+	for _, id := range []int{child, adopted} {
+		if len(parents[id]) != 2 || parents[id][0] != want[0] || parents[id][1] != want[1] {
+			t.Errorf("%d 的父母: got %v, want %v", id, parents[id], want)
+		}
+	}
+	if len(parents[father]) != 0 {
+		t.Errorf("父亲不应有父母: %v", parents[father])
+	}
+}
+
+func TestBatchQueriesLargeIDLists(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	father := insertPerson(t, repo, "父亲", "male", nil, nil)
+	child := insertPerson(t, repo, "子女", "male", &father, nil)
+	if _, err := repo.db.Exec(`INSERT INTO families (husband_id) VALUES (?)`, father); err != nil {
+		t.Fatal(err)
+	}
+
+	// 超过 SQLite 的参数个数上限 32766
+	ids := make([]int, 40000)
+	for i := range ids {
+		ids[i] = i + 1
+	}
+	parents, err := repo.GetParentIDs(ctx, ids)
+	if err != nil || len(parents[child]) != 1 {
+		t.Errorf("批量查询父母: %v, %v", parents[child], err)
+	}
+	families, err := repo.GetFamiliesByIndividualIDs(ctx, ids)
+	found := false
+	for _, family := range families {
+		found = found || (family.HusbandID != nil && *family.HusbandID == father)
+	}
+	if err != nil || !found {
+		t.Errorf("批量查询家庭: %d, %v", len(families), err)
+	}
+	var count int
+	repo.db.QueryRow(`SELECT COUNT(*) FROM individuals`).Scan(&count)
+	people, err := repo.GetIndividualsByIDs(ctx, ids)
+	if err != nil || len(people) != count {
+		t.Errorf("批量查询个人: %d, want %d, %v", len(people), count, err)
+	}
+}
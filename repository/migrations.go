@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"fmt"
+)
+
+// migration 一次结构变更。init.sql 只在新库上执行，已有数据库依靠这里的迁移补齐新表和新字段
+type migration struct {
+	version    int
+	name       string
+	statements []string
+}
+
+// migrations 按版本号递增排列，已发布的迁移不要修改，只能追加
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "individual_names",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS individual_names (
+				individual_id INTEGER NOT NULL,
+				name_type TEXT NOT NULL CHECK(name_type IN ('courtesy', 'art')),
+				name TEXT NOT NULL,
+				PRIMARY KEY (individual_id, name_type),
+				FOREIGN KEY (individual_id) REFERENCES individuals(individual_id) ON DELETE CASCADE
+			)`,
+			`CREATE TRIGGER IF NOT EXISTS trg_individual_names_delete
+			AFTER DELETE ON individuals
+			BEGIN
+				DELETE FROM individual_names WHERE individual_id = OLD.individual_id;
+			END`,
+		},
+	},
+	{
+		version: 2,
+		name:    "calendar_feeds",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS calendar_feeds (
+				user_id INTEGER PRIMARY KEY,
+				token_hash TEXT NOT NULL UNIQUE,
+				created_at DATETIME NOT NULL,
+				last_used_at DATETIME,
+				FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+			)`,
+		},
+	},
+	{
+		version: 3,
+		name:    "audit_log",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS audit_log (
+				audit_id INTEGER PRIMARY KEY AUTOINCREMENT,
+				change_set TEXT NOT NULL,
+				family_tree_id INTEGER,
+				entity_type TEXT NOT NULL,
+				entity_id TEXT NOT NULL,
+				action TEXT NOT NULL CHECK(action IN ('create', 'update', 'delete')),
+				user_id INTEGER,
+				changes TEXT NOT NULL,
+				before_data TEXT,
+				after_data TEXT,
+				created_at DATETIME NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_audit_log_entity ON audit_log(entity_type, entity_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_audit_log_tree ON audit_log(family_tree_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_audit_log_user ON audit_log(user_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_audit_log_change_set ON audit_log(change_set)`,
+		},
+	},
+	{
+		// 删除为标记删除：记录留在原表，deleted_at 非空即在回收站中，trash_id 指向所属的回收站记录
+		version: 4,
+		name:    "soft_delete",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS trash (
+				trash_id INTEGER PRIMARY KEY AUTOINCREMENT,
+				family_tree_id INTEGER,
+				entity_type TEXT NOT NULL,
+				entity_id TEXT NOT NULL,
+				label TEXT NOT NULL,
+				user_id INTEGER,
+				change_set TEXT NOT NULL,
+				deleted_at DATETIME NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_trash_tree ON trash(family_tree_id, deleted_at)`,
+			`CREATE INDEX IF NOT EXISTS idx_trash_entity ON trash(entity_type, entity_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_trash_deleted_at ON trash(deleted_at)`,
+			`ALTER TABLE individuals ADD COLUMN deleted_at DATETIME`,
+			`ALTER TABLE individuals ADD COLUMN deleted_by INTEGER`,
+			`ALTER TABLE individuals ADD COLUMN trash_id INTEGER`,
+			`ALTER TABLE families ADD COLUMN deleted_at DATETIME`,
+			`ALTER TABLE families ADD COLUMN deleted_by INTEGER`,
+			`ALTER TABLE families ADD COLUMN trash_id INTEGER`,
+			`ALTER TABLE children ADD COLUMN deleted_at DATETIME`,
+			`ALTER TABLE children ADD COLUMN deleted_by INTEGER`,
+			`ALTER TABLE children ADD COLUMN trash_id INTEGER`,
+			`ALTER TABLE events ADD COLUMN deleted_at DATETIME`,
+			`ALTER TABLE events ADD COLUMN deleted_by INTEGER`,
+			`ALTER TABLE events ADD COLUMN trash_id INTEGER`,
+			`CREATE INDEX IF NOT EXISTS idx_individuals_trash ON individuals(trash_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_families_trash ON families(trash_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_children_trash ON children(trash_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_events_trash ON events(trash_id)`,
+		},
+	},
+	{
+		version: 5,
+		name:    "tree_snapshots",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS tree_snapshots (
+				snapshot_id INTEGER PRIMARY KEY AUTOINCREMENT,
+				family_tree_id INTEGER NOT NULL,
+				name TEXT NOT NULL,
+				description TEXT NOT NULL DEFAULT '',
+				user_id INTEGER,
+				data TEXT NOT NULL,
+				individual_count INTEGER NOT NULL,
+				family_count INTEGER NOT NULL,
+				child_count INTEGER NOT NULL,
+				created_at DATETIME NOT NULL,
+				UNIQUE (family_tree_id, name),
+				FOREIGN KEY (family_tree_id) REFERENCES user_family_trees(family_tree_id) ON DELETE CASCADE
+			)`,
+		},
+	},
+	{
+		// 只有个人和家庭有按版本更新的写入接口，版本号只加在这两张表上
+		version: 6,
+		name:    "row_versions",
+		statements: []string{
+			`ALTER TABLE individuals ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+			`ALTER TABLE families ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+		},
+	},
+	{
+		// 世系查询按子女记录找父母
+		version: 7,
+		name:    "children_individual_index",
+		statements: []string{
+			`CREATE INDEX IF NOT EXISTS idx_children_individual ON children(individual_id)`,
+		},
+	},
+}
+
+// applyMigrations 执行尚未应用的迁移，每个迁移在单独的事务中完成
+func (r *SQLiteRepository) applyMigrations() error {
+	if _, err := r.db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)
+	`); err != nil {
+		return fmt.Errorf("创建迁移记录表失败: %v", err)
+	}
+
+	var current int
+	if err := r.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("读取迁移版本失败: %v", err)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		tx, err := r.db.Begin()
+		if err != nil {
+			return fmt.Errorf("开始迁移事务失败: %v", err)
+		}
+		for _, stmt := range m.statements {
+			if _, err := tx.Exec(stmt); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("执行迁移 %d_%s 失败: %v", m.version, m.name, err)
+			}
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, m.version, m.name); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("记录迁移 %d_%s 失败: %v", m.version, m.name, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("提交迁移 %d_%s 失败: %v", m.version, m.name, err)
+		}
+	}
+
+	return nil
+}
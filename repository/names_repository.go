@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"familytree/models"
+	"familytree/pkg/database"
+)
+
+// GetAlternateNames 批量获取个人的字、号，没有记录的人不出现在结果中
+func (r *SQLiteRepository) GetAlternateNames(ctx context.Context, ids []int) (map[int]models.AlternateNames, error) {
+	result := make(map[int]models.AlternateNames)
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	placeholders, args := inClause(ids)
+	rows, err := r.conn(ctx).QueryContext(ctx, fmt.Sprintf(`
+		SELECT individual_id, name_type, name FROM individual_names
+		WHERE individual_id IN (%s)
+	`, placeholders), args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询字号失败: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var nameType, name string
+		if err := rows.Scan(&id, &nameType, &name); err != nil {
+			return nil, fmt.Errorf("扫描字号失败: %v", err)
+		}
+		names := result[id]
+		switch nameType {
+		case "courtesy":
+			names.CourtesyName = name
+		case "art":
+			names.ArtName = name
+		}
+		result[id] = names
+	}
+	return result, rows.Err()
+}
+
+// SetAlternateNames 保存个人的字、号，空字符串表示删除
+func (r *SQLiteRepository) SetAlternateNames(ctx context.Context, individualID int, names models.AlternateNames) error {
+	tx, err := database.Begin(ctx, r.db)
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	target, err := auditTargetOf(ctx, tx, models.EntityTypeIndividual, individualID)
+	if err != nil {
+		return err
+	}
+
+	if err := saveAlternateNames(ctx, tx, individualID, names); err != nil {
+		return err
+	}
+	if err := bumpVersion(ctx, tx, models.EntityTypeIndividual, individualID); err != nil {
+		return err
+	}
+
+	if err := newAuditor(ctx).record(ctx, tx, target); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %v", err)
+	}
+	return nil
+}
+
+// saveAlternateNames 在给定事务中写入字、号
+func saveAlternateNames(ctx context.Context, q sqlExecutor, individualID int, names models.AlternateNames) error {
+	var err error
+	for nameType, name := range map[string]string{"courtesy": names.CourtesyName, "art": names.ArtName} {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			_, err = q.ExecContext(ctx, `DELETE FROM individual_names WHERE individual_id = ? AND name_type = ?`, individualID, nameType)
+		} else {
+			_, err = q.ExecContext(ctx, `
+				INSERT INTO individual_names (individual_id, name_type, name) VALUES (?, ?, ?)
+				ON CONFLICT (individual_id, name_type) DO UPDATE SET name = excluded.name
+			`, individualID, nameType, name)
+		}
+		if err != nil {
+			return fmt.Errorf("保存字号失败: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"familytree/models"
+)
+
+// ownershipQueries 个人和家庭所属家族树的查询。家庭的归属与变更历史一致：以夫妻所在的家族树为准，
+// 夫妻都不属于任何家族树时取家庭自身的家族树。回收站中的个人和家庭视为不存在
+var ownershipQueries = map[models.EntityType]string{
+	models.EntityTypeIndividual: `
+		SELECT individual_id, family_tree_id FROM individuals
+		WHERE individual_id IN (%s) AND family_tree_id IS NOT NULL AND deleted_at IS NULL`,
+	models.EntityTypeFamily: `
+		SELECT f.family_id, COALESCE(h.family_tree_id, w.family_tree_id, f.family_tree_id)
+		FROM families f
+		LEFT JOIN individuals h ON h.individual_id = f.husband_id
+		LEFT JOIN individuals w ON w.individual_id = f.wife_id
+		WHERE f.family_id IN (%s) AND f.deleted_at IS NULL AND COALESCE(h.family_tree_id, w.family_tree_id, f.family_tree_id) IS NOT NULL`,
+}
+
+// GetOwningTreeIDs 个人或家庭所属的家族树，不存在或不属于任何家族树的记录不在结果中
+func (r *SQLiteRepository) GetOwningTreeIDs(ctx context.Context, entity models.EntityType, ids []int) (map[int]int, error) {
+	query, ok := ownershipQueries[entity]
+	if !ok {
+		return nil, fmt.Errorf("不支持的记录类型: %s", entity)
+	}
+	trees := make(map[int]int, len(ids))
+	if len(ids) == 0 {
+		return trees, nil
+	}
+
+	placeholders, args := inClause(ids)
+	rows, err := r.conn(ctx).QueryContext(ctx, fmt.Sprintf(query, placeholders), args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询所属家族树失败: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, treeID int
+		if err := rows.Scan(&id, &treeID); err != nil {
+			return nil, fmt.Errorf("扫描所属家族树失败: %v", err)
+		}
+		trees[id] = treeID
+	}
+	return trees, rows.Err()
+}
@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"familytree/models"
+)
+
+func TestGetOwningTreeIDs(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	loose := insertPerson(t, repo, "无归属", "male", nil, nil)
+	if _, err := repo.db.Exec(`UPDATE individuals SET family_tree_id = NULL WHERE individual_id = ?`, loose); err != nil {
+		t.Fatalf("更新失败: %v", err)
+	}
+	people, err := repo.GetOwningTreeIDs(ctx, models.EntityTypeIndividual, []int{1, 2, loose, 999999})
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if len(people) != 2 || people[1] != 1 || people[2] != 1 {
+		t.Errorf("只应包含属于家族树的个人: %v", people)
+	}
+
+	// 夫妻都不属于任何家族树时取家庭自身的家族树
+	result, err := repo.db.Exec(`INSERT INTO families (husband_id, wife_id, marriage_order, family_tree_id) VALUES (?, NULL, 1, 1)`, loose)
+	if err != nil {
+		t.Fatalf("创建家庭失败: %v", err)
+	}
+	familyID, _ := result.LastInsertId()
+	families, err := repo.GetOwningTreeIDs(ctx, models.EntityTypeFamily, []int{1, int(familyID)})
+	if err != nil || len(families) != 2 || families[1] != 1 || families[int(familyID)] != 1 {
+		t.Errorf("家庭所属家族树错误: %v %v", families, err)
+	}
+
+	if _, err := repo.GetOwningTreeIDs(ctx, models.EntityTypeEvent, []int{1}); err == nil {
+		t.Error("不支持的记录类型应返回错误")
+	}
+}
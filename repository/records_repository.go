@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"familytree/models"
+)
+
+// inClause 生成 IN 子句中的子查询和参数。ID 列表作为一个 JSON 数组参数传入，
+// 整棵树的ID也不会超过 SQLite 的参数个数上限
+func inClause(ids []int) (string, []interface{}) {
+	data, _ := json.Marshal(ids)
+	return "SELECT value FROM json_each(?)", []interface{}{string(data)}
+}
+
+// GetEventsByIndividualIDs 批量获取多人的事件，按人、日期排列
+func (r *SQLiteRepository) GetEventsByIndividualIDs(ctx context.Context, ids []int) ([]models.Event, error) {
+	if len(ids) == 0 {
+		return []models.Event{}, nil
+	}
+
+	placeholders, args := inClause(ids)
+	rows, err := r.conn(ctx).QueryContext(ctx, fmt.Sprintf(`
+		SELECT event_id, individual_id, event_type, event_date, place_id,
+		COALESCE(description, ''), COALESCE(notes, ''), created_at, updated_at
+		FROM events WHERE individual_id IN (%s) AND deleted_at IS NULL
+		ORDER BY individual_id, event_date IS NULL, event_date, event_id
+	`, placeholders), args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询事件失败: %v", err)
+	}
+	defer rows.Close()
+
+	var events []models.Event
+	for rows.Next() {
+		var event models.Event
+		if err := rows.Scan(&event.EventID, &event.IndividualID, &event.EventType, &event.EventDate,
+			&event.EventPlaceID, &event.Description, &event.Notes, &event.CreatedAt, &event.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("扫描事件失败: %v", err)
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// GetPlacesByIDs 批量获取地点
+func (r *SQLiteRepository) GetPlacesByIDs(ctx context.Context, ids []int) ([]models.Place, error) {
+	if len(ids) == 0 {
+		return []models.Place{}, nil
+	}
+
+	placeholders, args := inClause(ids)
+	rows, err := r.conn(ctx).QueryContext(ctx, fmt.Sprintf(`
+		SELECT place_id, place_name, latitude, longitude, COALESCE(notes, ''), created_at, updated_at
+		FROM places WHERE place_id IN (%s)
+		ORDER BY place_id
+	`, placeholders), args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询地点失败: %v", err)
+	}
+	defer rows.Close()
+
+	var places []models.Place
+	for rows.Next() {
+		var place models.Place
+		if err := rows.Scan(&place.PlaceID, &place.PlaceName, &place.Latitude, &place.Longitude,
+			&place.Notes, &place.CreatedAt, &place.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("扫描地点失败: %v", err)
+		}
+		places = append(places, place)
+	}
+	return places, rows.Err()
+}
+
+// GetPlacesByNames 按名称批量获取家族树中的地点
+func (r *SQLiteRepository) GetPlacesByNames(ctx context.Context, familyTreeID int, names []string) ([]models.Place, error) {
+	if len(names) == 0 {
+		return []models.Place{}, nil
+	}
+
+	args := make([]interface{}, 0, len(names)+1)
+	args = append(args, familyTreeID)
+	for _, name := range names {
+		args = append(args, name)
+	}
+	rows, err := r.conn(ctx).QueryContext(ctx, fmt.Sprintf(`
+		SELECT place_id, place_name, latitude, longitude, COALESCE(notes, ''), created_at, updated_at
+		FROM places WHERE family_tree_id = ? AND place_name IN (%s)
+		ORDER BY place_id
+	`, strings.Repeat("?,", len(names)-1)+"?"), args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询地点失败: %v", err)
+	}
+	defer rows.Close()
+
+	var places []models.Place
+	for rows.Next() {
+		var place models.Place
+		if err := rows.Scan(&place.PlaceID, &place.PlaceName, &place.Latitude, &place.Longitude,
+			&place.Notes, &place.CreatedAt, &place.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("扫描地点失败: %v", err)
+		}
+		places = append(places, place)
+	}
+	return places, rows.Err()
+}
+
+// GetCitationsByEntities 批量获取某类实体的引用，同时带出信息来源
+func (r *SQLiteRepository) GetCitationsByEntities(ctx context.Context, entityType models.EntityType, ids []int) ([]models.Citation, error) {
+	if len(ids) == 0 {
+		return []models.Citation{}, nil
+	}
+
+	placeholders, args := inClause(ids)
+	// 数据库中的实体类型为小写
+	args = append([]interface{}{strings.ToLower(string(entityType))}, args...)
+	rows, err := r.conn(ctx).QueryContext(ctx, fmt.Sprintf(`
+		SELECT c.citation_id, c.source_id, c.entity_id, COALESCE(c.page_number, ''), COALESCE(c.notes, ''),
+		c.created_at, c.updated_at,
+		s.title, COALESCE(s.author, ''), s.publication_date, COALESCE(s.publisher, ''),
+		COALESCE(s.repository_name, ''), COALESCE(s.notes, ''), s.created_at, s.updated_at
+		FROM citations c
+		JOIN sources s ON s.source_id = c.source_id
+		WHERE c.entity_type = ? AND c.entity_id IN (%s)
+		ORDER BY c.entity_id, c.citation_id
+	`, placeholders), args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询引用失败: %v", err)
+	}
+	defer rows.Close()
+
+	var citations []models.Citation
+	for rows.Next() {
+		citation := models.Citation{EntityType: entityType, Source: &models.Source{}}
+		source := citation.Source
+		var published sql.NullString
+		if err := rows.Scan(&citation.CitationID, &citation.SourceID, &citation.EntityID, &citation.PageNumber,
+			&citation.Notes, &citation.CreatedAt, &citation.UpdatedAt,
+			&source.Title, &source.Author, &published, &source.Publisher,
+			&source.Location, &source.Notes, &source.CreatedAt, &source.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("扫描引用失败: %v", err)
+		}
+		source.SourceID = citation.SourceID
+		source.PublicationYear = publicationYear(published.String)
+		citations = append(citations, citation)
+	}
+	return citations, rows.Err()
+}
+
+// publicationYear 从出版日期中取年份，出版日期可能只填了年份
+func publicationYear(date string) *int {
+	if len(date) < 4 {
+		return nil
+	}
+	year, err := strconv.Atoi(date[:4])
+	if err != nil {
+		return nil
+	}
+	return &year
+}
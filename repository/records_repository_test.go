@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"familytree/models"
+)
+
+func TestRecordQueries(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+	personID := insertPerson(t, repo, "张三", "male", nil, nil)
+
+	mustExec := func(query string, args ...interface{}) int {
+		t.Helper()
+		result, err := repo.db.Exec(query, args...)
+		if err != nil {
+			t.Fatalf("执行失败: %v", err)
+		}
+		id, _ := result.LastInsertId()
+		return int(id)
+	}
+	placeID := mustExec(`INSERT INTO places (place_name) VALUES ('北京')`)
+	eventID := mustExec(`INSERT INTO events (individual_id, event_type, event_date, place_id) VALUES (?, 'graduation', '1948-07-01', ?)`, personID, placeID)
+	sourceID := mustExec(`INSERT INTO sources (title, author, publication_date, repository_name) VALUES ('张氏族谱', '张某', '1936-01-01', '国家图书馆')`)
+	mustExec(`INSERT INTO citations (source_id, entity_type, entity_id, page_number) VALUES (?, 'event', ?, '卷三')`, sourceID, eventID)
+
+	events, err := repo.GetEventsByIndividualIDs(ctx, []int{personID})
+	if err != nil || len(events) != 1 || events[0].EventPlaceID == nil || *events[0].EventPlaceID != placeID {
+		t.Fatalf("事件查询错误: %v %+v", err, events)
+	}
+	places, err := repo.GetPlacesByIDs(ctx, []int{placeID})
+	if err != nil || len(places) != 1 || places[0].PlaceName != "北京" {
+		t.Fatalf("地点查询错误: %v %+v", err, places)
+	}
+
+	citations, err := repo.GetCitationsByEntities(ctx, models.EntityTypeEvent, []int{eventID})
+	if err != nil || len(citations) != 1 {
+		t.Fatalf("引用查询错误: %v %+v", err, citations)
+	}
+	c := citations[0]
+	if c.EntityType != models.EntityTypeEvent || c.PageNumber != "卷三" || c.Source.Title != "张氏族谱" ||
+		c.Source.PublicationYear == nil || *c.Source.PublicationYear != 1936 || c.Source.Location != "国家图书馆" {
+		t.Errorf("引用内容错误: %+v %+v", c, c.Source)
+	}
+
+	if citations, err := repo.GetCitationsByEntities(ctx, models.EntityTypeIndividual, []int{eventID}); err != nil || len(citations) != 0 {
+		t.Errorf("不应匹配其他实体类型: %v %d", err, len(citations))
+	}
+}
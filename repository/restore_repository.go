@@ -0,0 +1,285 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"familytree/models"
+	"familytree/pkg/database"
+)
+
+// alternateNameColumns 个人快照中来自 individual_names 的字段
+var alternateNameColumns = map[string]bool{"courtesy_name": true, "art_name": true}
+
+// GetAuditEntry 根据ID获取变更记录，不存在时返回 nil
+func (r *SQLiteRepository) GetAuditEntry(ctx context.Context, auditID int) (*models.AuditEntry, error) {
+	entries, _, err := r.getAuditEntries(ctx, []string{"a.audit_id = ?"}, []interface{}{auditID}, 1, 0)
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+	return &entries[0], nil
+}
+
+// RestoreRecords 在同一事务中把一组记录依次恢复到指定状态，恢复本身也记入变更历史。
+// 记录当前的值既不是预期值也不是目标值时视为冲突；有冲突且未强制时回滚全部修改
+func (r *SQLiteRepository) RestoreRecords(ctx context.Context, restores []models.RecordRestore, force bool) ([]models.RevertConflict, error) {
+	tx, err := database.Begin(ctx, r.db)
+	if err != nil {
+		return nil, fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	conflicts, err := restoreRecords(ctx, tx, newAuditor(ctx), restores)
+	if err != nil {
+		return nil, err
+	}
+	if len(conflicts) > 0 && !force {
+		return conflicts, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %v", err)
+	}
+	return conflicts, nil
+}
+
+// restoreRecords 依次恢复一组记录并返回冲突。要删除的个人或家庭移入回收站；
+// 要重新创建的记录在回收站中时清除删除标记，引用的个人、家庭不存在时记为冲突并跳过
+func restoreRecords(ctx context.Context, q sqlExecutor, audit auditor, restores []models.RecordRestore) ([]models.RevertConflict, error) {
+	conflicts := []models.RevertConflict{}
+	for _, restore := range restores {
+		spec, ok := auditSpecs[restore.EntityType]
+		if !ok {
+			return nil, fmt.Errorf("不支持恢复 %s", restore.EntityType)
+		}
+		keys, err := parseAuditEntityID(restore.EntityID, len(spec.keys))
+		if err != nil {
+			return nil, err
+		}
+
+		target, err := auditTargetOf(ctx, q, restore.EntityType, keys...)
+		if err != nil {
+			return nil, err
+		}
+		conflicts = append(conflicts, restoreConflicts(restore, target.before)...)
+
+		if _, ok := trashDependents[restore.EntityType]; ok && restore.Target == nil && target.before != nil {
+			if err := trashRecords(ctx, q, audit, target); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if target.before == nil && restore.Target != nil {
+			record := models.TrashRecord{EntityType: restore.EntityType, EntityID: restore.EntityID}
+			missing, err := missingReferences(ctx, q, record, restore.Target)
+			if err != nil {
+				return nil, err
+			}
+			if len(missing) > 0 {
+				conflicts = append(conflicts, missing...)
+				continue
+			}
+		}
+
+		if err := restoreRecord(ctx, q, restore.EntityType, spec, keys, target.before, restore.Target); err != nil {
+			return nil, err
+		}
+		if err := audit.record(ctx, q, target); err != nil {
+			return nil, err
+		}
+	}
+	return conflicts, nil
+}
+
+// restoreConflicts 比较记录当前的值与预期值
+func restoreConflicts(restore models.RecordRestore, current *auditRecord) []models.RevertConflict {
+	conflict := models.RevertConflict{EntityType: restore.EntityType, EntityID: restore.EntityID}
+	switch {
+	case restore.Expected == nil && current == nil:
+		return nil
+	case restore.Expected == nil:
+		conflict.Reason = "记录已被重新创建"
+		return []models.RevertConflict{conflict}
+	case current == nil:
+		if restore.Target == nil {
+			return nil
+		}
+		conflict.Reason = "记录已被删除"
+		return []models.RevertConflict{conflict}
+	}
+
+	var conflicts []models.RevertConflict
+	for _, field := range sortedKeys(restore.Expected) {
+		if auditIgnored[field] {
+			continue
+		}
+		value := current.data[field]
+		expected := restore.Expected[field]
+		if auditEqual(value, expected) || (restore.Target != nil && auditEqual(value, restore.Target[field])) {
+			continue
+		}
+		c := conflict
+		c.Field, c.Expected, c.Current = field, expected, value
+		c.Reason = "字段在之后又被修改"
+		conflicts = append(conflicts, c)
+	}
+	return conflicts
+}
+
+// restoreRecord 把一条记录写成目标状态：目标为空时删除，记录在回收站中时先清除删除标记，
+// 记录已被永久删除时按目标插入，之后只更新不同的字段
+func restoreRecord(ctx context.Context, q sqlExecutor, entity models.EntityType, spec auditSpec, keys []int, current *auditRecord, target map[string]interface{}) error {
+	whereClause, keyArgs := spec.where(keys)
+	if current == nil && target != nil {
+		undeleted, err := undeleteRecord(ctx, q, spec, keys)
+		if err != nil {
+			return err
+		}
+		if undeleted {
+			if current, err = auditSnapshot(ctx, q, entity, keys...); err != nil {
+				return err
+			}
+		}
+	}
+
+	if target == nil {
+		if current == nil {
+			return nil
+		}
+		if _, err := q.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE %s", spec.table, whereClause), keyArgs...); err != nil {
+			return fmt.Errorf("删除 %s 失败: %v", entity, err)
+		}
+		return nil
+	}
+
+	columns, err := tableColumns(ctx, q, spec.table)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	var args []interface{}
+	if current == nil {
+		for _, column := range sortedKeys(target) {
+			if columns[column] {
+				names = append(names, column)
+				args = append(args, restoreValue(target[column]))
+			}
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ")
+		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", spec.table, strings.Join(names, ", "), placeholders)
+		if _, err := q.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("恢复 %s 失败: %v", entity, err)
+		}
+	} else {
+		for _, column := range sortedKeys(target) {
+			if columns[column] && !auditIgnored[column] && !auditEqual(current.data[column], target[column]) {
+				names = append(names, column+" = ?")
+				args = append(args, restoreValue(target[column]))
+			}
+		}
+		if len(names) > 0 {
+			if columns["updated_at"] {
+				names = append(names, "updated_at = ?")
+				args = append(args, time.Now())
+			}
+			if columns["version"] {
+				names = append(names, "version = version + 1")
+			}
+			query := fmt.Sprintf("UPDATE %s SET %s WHERE %s", spec.table, strings.Join(names, ", "), whereClause)
+			if _, err := q.ExecContext(ctx, query, append(args, keyArgs...)...); err != nil {
+				return fmt.Errorf("恢复 %s 失败: %v", entity, err)
+			}
+		}
+	}
+
+	if entity == models.EntityTypeIndividual {
+		var currentData map[string]interface{}
+		if current != nil {
+			currentData = current.data
+		}
+		changed := false
+		for column := range alternateNameColumns {
+			changed = changed || !auditEqual(currentData[column], target[column])
+		}
+		if changed {
+			alternateNames := models.AlternateNames{
+				CourtesyName: restoreString(target["courtesy_name"]),
+				ArtName:      restoreString(target["art_name"]),
+			}
+			if err := saveAlternateNames(ctx, q, keys[0], alternateNames); err != nil {
+				return err
+			}
+			// 只改了字号时记录本身没有更新，版本号单独加一
+			if current != nil && len(names) == 0 {
+				return bumpVersion(ctx, q, entity, keys[0])
+			}
+		}
+	}
+	return nil
+}
+
+// bumpVersion 记录的关联数据（如字号）变化时把记录的版本号加一
+func bumpVersion(ctx context.Context, q sqlExecutor, entity models.EntityType, id int) error {
+	spec := auditSpecs[entity]
+	query := fmt.Sprintf("UPDATE %s SET version = version + 1 WHERE %s = ?", spec.table, spec.keys[0])
+	if _, err := q.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("更新 %s 版本失败: %v", entity, err)
+	}
+	return nil
+}
+
+// tableColumns 表中实际存在的列，恢复时只写这些列
+func tableColumns(ctx context.Context, q sqlExecutor, table string) (map[string]bool, error) {
+	rows, err := q.QueryContext(ctx, fmt.Sprintf("SELECT name FROM pragma_table_info('%s')", table))
+	if err != nil {
+		return nil, fmt.Errorf("读取 %s 表结构失败: %v", table, err)
+	}
+	defer rows.Close()
+
+	columns := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+// restoreValue 快照经 JSON 往返后整数变成了 float64，写回前还原
+func restoreValue(v interface{}) interface{} {
+	if f, ok := v.(float64); ok && f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return int64(f)
+	}
+	return v
+}
+
+// restoreString 快照中可为空的文本字段
+func restoreString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return ""
+}
+
+// parseAuditEntityID 解析 auditEntityID 生成的主键
+func parseAuditEntityID(entityID string, n int) ([]int, error) {
+	parts := strings.Split(entityID, "/")
+	if len(parts) != n {
+		return nil, fmt.Errorf("无效的记录ID: %s", entityID)
+	}
+	keys := make([]int, n)
+	for i, part := range parts {
+		key, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("无效的记录ID: %s", entityID)
+		}
+		keys[i] = key
+	}
+	return keys, nil
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"familytree/models"
+	"familytree/pkg/middleware"
+)
+
+func TestRestoreRecords(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.WithValue(context.Background(), middleware.UserContextKey, &models.AuthContext{UserID: 7})
+
+	person, err := repo.CreateIndividual(withChangeSet(t, ctx), &models.Individual{FullName: "李四", Gender: models.GenderMale})
+	if err != nil {
+		t.Fatalf("创建个人失败: %v", err)
+	}
+	entityID := auditEntityID(person.IndividualID)
+	person.Occupation = "教师"
+	if _, err := repo.UpdateIndividual(withChangeSet(t, ctx), person.IndividualID, person); err != nil {
+		t.Fatalf("更新个人失败: %v", err)
+	}
+	person.Occupation = "医生"
+	if _, err := repo.UpdateIndividual(withChangeSet(t, ctx), person.IndividualID, person); err != nil {
+		t.Fatalf("更新个人失败: %v", err)
+	}
+
+	entries, _, err := repo.GetAuditEntries(ctx, models.AuditQuery{EntityType: models.EntityTypeIndividual, EntityID: entityID})
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("查询变更记录: %d 条, %v", len(entries), err)
+	}
+	first := entries[1]
+	undo := models.RecordRestore{
+		EntityType: models.EntityTypeIndividual,
+		EntityID:   entityID,
+		Expected:   map[string]interface{}{"occupation": first.Changes[0].New},
+		Target:     map[string]interface{}{"occupation": first.Changes[0].Old},
+	}
+
+	// 职业在之后又被修改，撤销第一次修改时报告冲突且不做任何修改
+	conflicts, err := repo.RestoreRecords(ctx, []models.RecordRestore{undo}, false)
+	if err != nil {
+		t.Fatalf("撤销失败: %v", err)
+	}
+	if len(conflicts) != 1 || conflicts[0].Field != "occupation" || conflicts[0].Expected != "教师" || conflicts[0].Current != "医生" {
+		t.Fatalf("冲突: %+v", conflicts)
+	}
+	current, err := repo.GetIndividualByID(ctx, person.IndividualID)
+	if err != nil || current.Occupation != "医生" {
+		t.Fatalf("有冲突时不应修改: %+v, %v", current, err)
+	}
+	if _, total, _ := repo.GetAuditEntries(ctx, models.AuditQuery{EntityID: entityID, EntityType: models.EntityTypeIndividual}); total != 3 {
+		t.Errorf("有冲突时不应写入变更记录，共 %d 条", total)
+	}
+
+	// 强制撤销
+	if _, err := repo.RestoreRecords(ctx, []models.RecordRestore{undo}, true); err != nil {
+		t.Fatalf("强制撤销失败: %v", err)
+	}
+	if current, _ = repo.GetIndividualByID(ctx, person.IndividualID); current.Occupation != "" {
+		t.Errorf("职业: got %q, want 空", current.Occupation)
+	}
+
+	// 删除后按删除前的快照恢复
+	if err := repo.DeleteIndividual(withChangeSet(t, ctx), person.IndividualID); err != nil {
+		t.Fatalf("删除个人失败: %v", err)
+	}
+	deleted, _, err := repo.GetAuditEntries(ctx, models.AuditQuery{EntityType: models.EntityTypeIndividual, EntityID: entityID, Limit: 1})
+	if err != nil || len(deleted) != 1 || deleted[0].Action != models.AuditActionDelete {
+		t.Fatalf("删除记录: %+v, %v", deleted, err)
+	}
+	restore := models.RecordRestore{EntityType: models.EntityTypeIndividual, EntityID: entityID, Target: deleted[0].Before}
+	if conflicts, err := repo.RestoreRecords(ctx, []models.RecordRestore{restore}, false); err != nil || len(conflicts) != 0 {
+		t.Fatalf("恢复删除的个人: %+v, %v", conflicts, err)
+	}
+	if current, err = repo.GetIndividualByID(ctx, person.IndividualID); err != nil || current.FullName != "李四" {
+		t.Errorf("恢复后的个人: %+v, %v", current, err)
+	}
+
+	// 再次恢复同一快照时记录已存在，报告冲突
+	if conflicts, err := repo.RestoreRecords(ctx, []models.RecordRestore{restore}, false); err != nil || len(conflicts) != 1 {
+		t.Errorf("重复恢复: %+v, %v", conflicts, err)
+	}
+}
@@ -0,0 +1,394 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"familytree/models"
+	"familytree/pkg/database"
+)
+
+// 家族树快照
+//
+// 快照保存家族树中全部个人（含字、号）、家庭、子女关系和事件的完整记录，格式与变更记录中的快照相同。
+// 家庭和子女关系的归属与变更记录一致：家庭以夫妻所在的家族树为准，子女关系和事件以所属个人所在的家族树为准。
+
+// treeStateQueries 读取家族树全部记录的查询，参数均为家族树ID。回收站中的记录不在快照中
+var treeStateQueries = []struct {
+	entity models.EntityType
+	query  string
+	args   int
+}{
+	{models.EntityTypeIndividual, individualSnapshot + ` WHERE i.family_tree_id = ? AND i.deleted_at IS NULL`, 1},
+	{models.EntityTypeFamily, `
+		SELECT f.* FROM families f
+		WHERE f.deleted_at IS NULL AND (
+		   EXISTS (SELECT 1 FROM individuals i WHERE i.individual_id IN (f.husband_id, f.wife_id) AND i.family_tree_id = ?)
+		   OR (f.family_tree_id = ? AND NOT EXISTS (
+		       SELECT 1 FROM individuals i WHERE i.individual_id IN (f.husband_id, f.wife_id) AND i.family_tree_id IS NOT NULL)))`, 2},
+	{models.EntityTypeChild, `
+		SELECT c.* FROM children c JOIN individuals i ON i.individual_id = c.individual_id
+		WHERE i.family_tree_id = ? AND c.deleted_at IS NULL`, 1},
+	{models.EntityTypeEvent, `
+		SELECT e.* FROM events e JOIN individuals i ON i.individual_id = e.individual_id
+		WHERE i.family_tree_id = ? AND e.deleted_at IS NULL`, 1},
+}
+
+// CreateSnapshot 保存家族树当前的全部记录
+func (r *SQLiteRepository) CreateSnapshot(ctx context.Context, snapshot *models.TreeSnapshot) (*models.TreeSnapshot, error) {
+	tx, err := database.Begin(ctx, r.db)
+	if err != nil {
+		return nil, fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	state, err := treeState(ctx, tx, snapshot.FamilyTreeID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("序列化快照失败: %v", err)
+	}
+
+	snapshot.IndividualCount = len(state.Individuals)
+	snapshot.FamilyCount = len(state.Families)
+	snapshot.ChildCount = len(state.Children)
+	snapshot.CreatedAt = time.Now()
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO tree_snapshots (family_tree_id, name, description, user_id, data, individual_count, family_count, child_count, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, snapshot.FamilyTreeID, snapshot.Name, snapshot.Description, snapshot.UserID, string(data),
+		snapshot.IndividualCount, snapshot.FamilyCount, snapshot.ChildCount, snapshot.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("保存快照失败: %v", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("获取快照ID失败: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %v", err)
+	}
+	snapshot.SnapshotID = int(id)
+	return snapshot, nil
+}
+
+// GetSnapshots 家族树的全部快照，新的在前
+func (r *SQLiteRepository) GetSnapshots(ctx context.Context, familyTreeID int) ([]models.TreeSnapshot, error) {
+	return r.getSnapshots(ctx, "s.family_tree_id = ?", familyTreeID)
+}
+
+// GetSnapshot 根据ID获取快照，不存在时返回 nil
+func (r *SQLiteRepository) GetSnapshot(ctx context.Context, snapshotID int) (*models.TreeSnapshot, error) {
+	snapshots, err := r.getSnapshots(ctx, "s.snapshot_id = ?", snapshotID)
+	if err != nil || len(snapshots) == 0 {
+		return nil, err
+	}
+	return &snapshots[0], nil
+}
+
+// getSnapshots 按条件查询快照，不读取记录内容
+func (r *SQLiteRepository) getSnapshots(ctx context.Context, where string, args ...interface{}) ([]models.TreeSnapshot, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, `
+		SELECT s.snapshot_id, s.family_tree_id, s.name, s.description, s.user_id, COALESCE(u.username, ''),
+		       s.individual_count, s.family_count, s.child_count, s.created_at
+		FROM tree_snapshots s LEFT JOIN users u ON u.user_id = s.user_id
+		WHERE `+where+`
+		ORDER BY s.snapshot_id DESC
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询快照失败: %v", err)
+	}
+	defer rows.Close()
+
+	snapshots := []models.TreeSnapshot{}
+	for rows.Next() {
+		var s models.TreeSnapshot
+		var userID sql.NullInt64
+		if err := rows.Scan(&s.SnapshotID, &s.FamilyTreeID, &s.Name, &s.Description, &userID, &s.Username,
+			&s.IndividualCount, &s.FamilyCount, &s.ChildCount, &s.CreatedAt); err != nil {
+			return nil, fmt.Errorf("扫描快照失败: %v", err)
+		}
+		if userID.Valid {
+			id := int(userID.Int64)
+			s.UserID = &id
+		}
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, rows.Err()
+}
+
+// GetSnapshotState 快照中保存的全部记录
+func (r *SQLiteRepository) GetSnapshotState(ctx context.Context, snapshotID int) (*models.TreeState, error) {
+	var data string
+	err := r.conn(ctx).QueryRowContext(ctx, `SELECT data FROM tree_snapshots WHERE snapshot_id = ?`, snapshotID).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("快照不存在")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取快照失败: %v", err)
+	}
+	var state models.TreeState
+	if err := json.Unmarshal([]byte(data), &state); err != nil {
+		return nil, fmt.Errorf("解析快照失败: %v", err)
+	}
+	return &state, nil
+}
+
+// GetTreeState 家族树当前的全部记录，格式与快照相同
+func (r *SQLiteRepository) GetTreeState(ctx context.Context, familyTreeID int) (*models.TreeState, error) {
+	return treeState(ctx, r.db, familyTreeID)
+}
+
+// DeleteSnapshot 删除快照
+func (r *SQLiteRepository) DeleteSnapshot(ctx context.Context, snapshotID int) error {
+	result, err := r.conn(ctx).ExecContext(ctx, `DELETE FROM tree_snapshots WHERE snapshot_id = ?`, snapshotID)
+	if err != nil {
+		return fmt.Errorf("删除快照失败: %v", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("获取影响行数失败: %v", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("快照不存在")
+	}
+	return nil
+}
+
+// RollbackToSnapshot 在同一事务中把家族树恢复到快照时的状态：之后新增的记录移入回收站，恢复之后删除的记录，
+// 修改过的记录改回快照中的值。全部修改记入同一变更集，可以整体撤销
+func (r *SQLiteRepository) RollbackToSnapshot(ctx context.Context, snapshotID int) error {
+	snapshot, err := r.GetSnapshot(ctx, snapshotID)
+	if err != nil {
+		return err
+	}
+	if snapshot == nil {
+		return fmt.Errorf("快照不存在")
+	}
+	target, err := r.GetSnapshotState(ctx, snapshotID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := database.Begin(ctx, r.db)
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	// 个人之间、家庭与个人之间互相引用，外键检查推迟到提交时
+	if _, err := tx.ExecContext(ctx, `PRAGMA defer_foreign_keys = ON`); err != nil {
+		return fmt.Errorf("设置外键检查失败: %v", err)
+	}
+	current, err := treeState(ctx, tx, snapshot.FamilyTreeID)
+	if err != nil {
+		return err
+	}
+
+	// 之后新增的个人、家庭移入回收站；回收站中的个人恢复后，其事件、子女关系逐条恢复，全部恢复后回收站记录才删除
+	conflicts, err := restoreRecords(ctx, tx, newAuditor(ctx), snapshotRestores(current, target))
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("回滚时记录发生变化: %s %s", conflicts[0].EntityType, conflicts[0].EntityID)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %v", err)
+	}
+	return nil
+}
+
+// snapshotRestores 从当前状态恢复到目标状态所需的修改。
+// 先删除事件、子女关系、家庭、个人，再按个人、家庭、子女关系、事件的顺序新增和修改；父母先于子女插入。
+// 早期的快照不含事件，这时保留当前的事件
+func snapshotRestores(current, target *models.TreeState) []models.RecordRestore {
+	type section struct {
+		entity          models.EntityType
+		current, target map[string]map[string]interface{}
+	}
+	sections := []section{
+		{models.EntityTypeIndividual, current.Individuals, target.Individuals},
+		{models.EntityTypeFamily, current.Families, target.Families},
+		{models.EntityTypeChild, current.Children, target.Children},
+	}
+	if target.Events != nil {
+		sections = append(sections, section{models.EntityTypeEvent, current.Events, target.Events})
+	}
+
+	var removals, upserts []models.RecordRestore
+	for i := len(sections) - 1; i >= 0; i-- {
+		s := sections[i]
+		ids := snapshotIDs(s.current)
+		if s.entity == models.EntityTypeIndividual {
+			ids = parentsFirst(ids, s.current)
+			for l, r := 0, len(ids)-1; l < r; l, r = l+1, r-1 {
+				ids[l], ids[r] = ids[r], ids[l]
+			}
+		}
+		for _, id := range ids {
+			if _, ok := s.target[id]; !ok {
+				removals = append(removals, models.RecordRestore{EntityType: s.entity, EntityID: id, Expected: s.current[id]})
+			}
+		}
+	}
+	for _, s := range sections {
+		var inserts, updates []models.RecordRestore
+		ids := snapshotIDs(s.target)
+		if s.entity == models.EntityTypeIndividual {
+			ids = parentsFirst(ids, s.target)
+		}
+		for _, id := range ids {
+			record, ok := s.current[id]
+			switch {
+			case !ok:
+				inserts = append(inserts, models.RecordRestore{EntityType: s.entity, EntityID: id, Target: s.target[id]})
+			case !auditEqual(withoutIgnored(record), withoutIgnored(s.target[id])):
+				updates = append(updates, models.RecordRestore{EntityType: s.entity, EntityID: id, Expected: record, Target: s.target[id]})
+			}
+		}
+		upserts = append(append(upserts, inserts...), updates...)
+	}
+	return append(removals, upserts...)
+}
+
+// parentsFirst 把个人按父母在前的顺序排列，父母不在列表中时保持原顺序
+func parentsFirst(ids []string, records map[string]map[string]interface{}) []string {
+	ordered := make([]string, 0, len(ids))
+	visited := map[string]bool{}
+	var visit func(id string)
+	visit = func(id string) {
+		if visited[id] {
+			return
+		}
+		visited[id] = true
+		for _, column := range []string{"father_id", "mother_id"} {
+			if parent := snapshotKey(records[id][column]); parent != "" {
+				if _, ok := records[parent]; ok {
+					visit(parent)
+				}
+			}
+		}
+		ordered = append(ordered, id)
+	}
+	for _, id := range ids {
+		visit(id)
+	}
+	return ordered
+}
+
+// withoutIgnored 去掉不参与比较的字段
+func withoutIgnored(record map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(record))
+	for column, value := range record {
+		if !auditIgnored[column] {
+			result[column] = value
+		}
+	}
+	return result
+}
+
+// snapshotKey 快照中的ID字段转为记录ID，空值返回空字符串
+func snapshotKey(v interface{}) string {
+	switch v := restoreValue(v).(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case string:
+		return v
+	}
+	return ""
+}
+
+// treeState 读取家族树当前的全部个人、家庭、子女关系和事件
+func treeState(ctx context.Context, q sqlExecutor, familyTreeID int) (*models.TreeState, error) {
+	state := &models.TreeState{}
+	for _, s := range treeStateQueries {
+		args := make([]interface{}, s.args)
+		for i := range args {
+			args[i] = familyTreeID
+		}
+		records, err := snapshotRows(ctx, q, s.entity, s.query, args...)
+		if err != nil {
+			return nil, err
+		}
+		switch s.entity {
+		case models.EntityTypeIndividual:
+			state.Individuals = records
+		case models.EntityTypeFamily:
+			state.Families = records
+		case models.EntityTypeChild:
+			state.Children = records
+		case models.EntityTypeEvent:
+			state.Events = records
+		}
+	}
+	return state, nil
+}
+
+// snapshotRows 批量读取记录快照，按记录ID索引
+func snapshotRows(ctx context.Context, q sqlExecutor, entity models.EntityType, query string, args ...interface{}) (map[string]map[string]interface{}, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("读取 %s 失败: %v", entity, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	keys := auditSpecs[entity].keys
+	records := map[string]map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("扫描 %s 失败: %v", entity, err)
+		}
+
+		data := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			data[column] = auditValue(values[i])
+		}
+		ids := make([]int, len(keys))
+		for i, key := range keys {
+			id, ok := data[key].(int64)
+			if !ok {
+				return nil, fmt.Errorf("%s 的主键 %s 无效", entity, key)
+			}
+			ids[i] = int(id)
+		}
+		records[auditEntityID(ids...)] = data
+	}
+	return records, rows.Err()
+}
+
+// snapshotIDs 记录ID按数值排序，复合主键逐段比较
+func snapshotIDs(records map[string]map[string]interface{}) []string {
+	ids := make([]string, 0, len(records))
+	for id := range records {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, _ := parseAuditEntityID(ids[i], strings.Count(ids[i], "/")+1)
+		b, _ := parseAuditEntityID(ids[j], strings.Count(ids[j], "/")+1)
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	return ids
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"familytree/models"
+	"familytree/pkg/middleware"
+)
+
+func TestSnapshotRollback(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.WithValue(context.Background(), middleware.UserContextKey, &models.AuthContext{UserID: 7})
+
+	leaf, err := repo.CreateIndividual(ctx, &models.Individual{FullName: "赵甲", Gender: models.GenderMale})
+	if err != nil {
+		t.Fatalf("创建个人失败: %v", err)
+	}
+	if _, err := repo.db.Exec(`INSERT INTO events (individual_id, event_type) VALUES (?, 'birth')`, leaf.IndividualID); err != nil {
+		t.Fatalf("添加事件失败: %v", err)
+	}
+	snapshot, err := repo.CreateSnapshot(ctx, &models.TreeSnapshot{FamilyTreeID: 1, Name: "导入前"})
+	if err != nil {
+		t.Fatalf("创建快照失败: %v", err)
+	}
+	if snapshot.IndividualCount == 0 || snapshot.FamilyCount == 0 || snapshot.ChildCount == 0 {
+		t.Fatalf("快照内容: %+v", snapshot)
+	}
+	before, err := repo.GetTreeState(ctx, 1)
+	if err != nil {
+		t.Fatalf("读取家族树失败: %v", err)
+	}
+
+	// 快照之后：修改、新增、删除个人（连同事件），删除子女关系，新增事件
+	var familyID, childID int
+	if err := repo.db.QueryRow(`SELECT family_id, individual_id FROM children ORDER BY family_id, individual_id LIMIT 1`).Scan(&familyID, &childID); err != nil {
+		t.Fatalf("读取子女关系失败: %v", err)
+	}
+	person, err := repo.GetIndividualByID(ctx, childID)
+	if err != nil {
+		t.Fatalf("读取个人失败: %v", err)
+	}
+	person.FullName = "改名"
+	if _, err := repo.UpdateIndividual(ctx, childID, person); err != nil {
+		t.Fatalf("更新个人失败: %v", err)
+	}
+	added, err := repo.CreateIndividual(ctx, &models.Individual{FullName: "赵乙", Gender: models.GenderMale, FatherID: &childID})
+	if err != nil {
+		t.Fatalf("创建个人失败: %v", err)
+	}
+	if err := repo.DeleteIndividual(ctx, leaf.IndividualID); err != nil {
+		t.Fatalf("删除个人失败: %v", err)
+	}
+	if err := repo.DeleteChild(ctx, familyID, childID); err != nil {
+		t.Fatalf("删除子女关系失败: %v", err)
+	}
+	if _, err := repo.db.Exec(`INSERT INTO events (individual_id, event_type) VALUES (?, 'death')`, childID); err != nil {
+		t.Fatalf("添加事件失败: %v", err)
+	}
+	if changes := snapshotRestores(before, mustTreeState(t, repo)); len(changes) != 6 {
+		t.Fatalf("快照之后的修改: got %d, want 6: %+v", len(changes), changes)
+	}
+	// 早期的快照不含事件，回滚时保留当前的事件
+	legacy := *before
+	legacy.Events = nil
+	if changes := snapshotRestores(mustTreeState(t, repo), &legacy); len(changes) != 4 {
+		t.Errorf("不含事件的快照: got %d, want 4: %+v", len(changes), changes)
+	}
+
+	rollbackCtx := withChangeSet(t, ctx)
+	if err := repo.RollbackToSnapshot(rollbackCtx, snapshot.SnapshotID); err != nil {
+		t.Fatalf("回滚失败: %v", err)
+	}
+	if changes := snapshotRestores(mustTreeState(t, repo), before); len(changes) != 0 {
+		t.Errorf("回滚后仍有差异: %+v", changes)
+	}
+	if _, err := repo.GetIndividualByID(ctx, added.IndividualID); err == nil {
+		t.Error("快照之后新增的个人应被删除")
+	}
+	if events, _ := repo.GetEventsByIndividualIDs(ctx, []int{leaf.IndividualID}); len(events) != 1 {
+		t.Errorf("恢复的个人应带回其事件: %+v", events)
+	}
+	// 恢复的个人连同事件移出回收站，新增的个人移入回收站
+	if items, _, _ := repo.GetTrashItems(ctx, 1, 10, 0); len(items) != 1 || items[0].EntityID != auditEntityID(added.IndividualID) {
+		t.Errorf("回滚后的回收站: %+v", items)
+	}
+
+	changeSet, _ := middleware.GetChangeSetFromContext(rollbackCtx)
+	entries, _, err := repo.GetAuditEntries(ctx, models.AuditQuery{ChangeSet: changeSet})
+	if err != nil || len(entries) != 6 {
+		t.Errorf("回滚的变更记录: %d 条, %v", len(entries), err)
+	}
+}
+
+// mustTreeState 读取家族树 1 当前的全部记录
+func mustTreeState(t *testing.T, repo *SQLiteRepository) *models.TreeState {
+	t.Helper()
+	state, err := repo.GetTreeState(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("读取家族树失败: %v", err)
+	}
+	return state
+}
@@ -8,9 +8,11 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"familytree/models"
+	"familytree/pkg/database"
 
 	_ "modernc.org/sqlite"
 )
@@ -29,11 +31,15 @@ type SQLiteRepository struct {
 	maxOpenConns    int
 	maxIdleConns    int
 	connMaxLifetime time.Duration
+
+	// 是否使用世系闭包表加速祖先/后代查询
+	lineageClosure atomic.Bool
 }
 
-// NewSQLiteRepository 创建新的SQLite存储库
+// NewSQLiteRepository 创建新的SQLite存储库。连接池中有多个连接，
+// 写事务以 BEGIN IMMEDIATE 开始并等待锁释放，见 database.SQLiteDSN
 func NewSQLiteRepository(dbPath string) (*SQLiteRepository, error) {
-	db, err := sql.Open("sqlite", dbPath)
+	db, err := sql.Open("sqlite", database.SQLiteDSN(dbPath))
 	if err != nil {
 		return nil, fmt.Errorf("打开数据库失败: %v", err)
 	}
@@ -61,6 +67,11 @@ func NewSQLiteRepository(dbPath string) (*SQLiteRepository, error) {
 		return nil, fmt.Errorf("初始化数据库失败: %v", err)
 	}
 
+	// 补齐已有数据库缺少的表结构
+	if err := repo.applyMigrations(); err != nil {
+		return nil, fmt.Errorf("数据库迁移失败: %v", err)
+	}
+
 	// 初始化预处理语句
 	if err := repo.initPreparedStatements(); err != nil {
 		return nil, fmt.Errorf("初始化预处理语句失败: %v", err)
@@ -75,15 +86,15 @@ func (r *SQLiteRepository) initPreparedStatements() error {
 		"get_individual_by_id": `
 			SELECT individual_id, full_name, gender, birth_date, birth_place, birth_place_id,
 			       death_date, death_place, death_place_id, burial_place_id,
-			       occupation, notes, photo_url, father_id, mother_id, created_at, updated_at
-			FROM individuals WHERE individual_id = ?
+			       occupation, notes, photo_url, father_id, mother_id, version, created_at, updated_at
+			FROM individuals WHERE individual_id = ? AND deleted_at IS NULL
 		`,
 		"search_individuals": `
 			SELECT individual_id, full_name, gender, birth_date, birth_place, birth_place_id,
 			       death_date, death_place, death_place_id, burial_place_id,
-			       occupation, notes, photo_url, father_id, mother_id, created_at, updated_at
+			       occupation, notes, photo_url, father_id, mother_id, version, created_at, updated_at
 			FROM individuals 
-			WHERE full_name LIKE ? OR notes LIKE ?
+			WHERE deleted_at IS NULL AND (full_name LIKE ? OR notes LIKE ?)
 			LIMIT ? OFFSET ?
 		`,
 		"create_individual": `
@@ -98,27 +109,26 @@ func (r *SQLiteRepository) initPreparedStatements() error {
 				full_name = ?, gender = ?, birth_date = ?, birth_place = ?,
 				birth_place_id = ?, death_date = ?, death_place = ?,
 				death_place_id = ?, burial_place_id = ?, occupation = ?, notes = ?,
-				photo_url = ?, father_id = ?, mother_id = ?, updated_at = ?
-			WHERE individual_id = ?
-		`,
-		"delete_individual": `
-			DELETE FROM individuals WHERE individual_id = ?
+				photo_url = ?, father_id = ?, mother_id = ?, updated_at = ?,
+				version = version + 1
+			WHERE individual_id = ? AND deleted_at IS NULL AND (? = 0 OR version = ?)
+			RETURNING version
 		`,
 		"get_children_by_parent": `
 			SELECT individual_id, full_name, gender, birth_date, birth_place, birth_place_id,
 			       death_date, death_place, death_place_id, burial_place_id,
-			       occupation, notes, photo_url, father_id, mother_id, created_at, updated_at
+			       occupation, notes, photo_url, father_id, mother_id, version, created_at, updated_at
 			FROM individuals 
-			WHERE father_id = ? OR mother_id = ?
+			WHERE (father_id = ? OR mother_id = ?) AND deleted_at IS NULL
 		`,
 		"get_spouses": `
 			SELECT i.individual_id, i.full_name, i.gender, i.birth_date, i.birth_place, i.birth_place_id,
 			       i.death_date, i.death_place, i.death_place_id, i.burial_place_id,
-			       i.occupation, i.notes, i.photo_url, i.father_id, i.mother_id, i.created_at, i.updated_at
+			       i.occupation, i.notes, i.photo_url, i.father_id, i.mother_id, i.version, i.created_at, i.updated_at
 			FROM individuals i
 			JOIN families f ON (f.husband_id = i.individual_id OR f.wife_id = i.individual_id)
 			WHERE (f.husband_id = ? OR f.wife_id = ?)
-			AND i.individual_id != ?
+			AND i.individual_id != ? AND i.deleted_at IS NULL AND f.deleted_at IS NULL
 		`,
 	}
 
@@ -158,11 +168,17 @@ func (r *SQLiteRepository) CreateIndividual(ctx context.Context, individual *mod
 		return nil, err
 	}
 
+	tx, err := database.Begin(ctx, r.db)
+	if err != nil {
+		return nil, fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
 	now := time.Now()
 	individual.CreatedAt = now
 	individual.UpdatedAt = now
 
-	result, err := stmt.ExecContext(ctx,
+	result, err := tx.StmtContext(ctx, stmt).ExecContext(ctx,
 		individual.FullName,
 		individual.Gender,
 		individual.BirthDate,
@@ -189,7 +205,15 @@ func (r *SQLiteRepository) CreateIndividual(ctx context.Context, individual *mod
 		return nil, err
 	}
 
+	if err := newAuditor(ctx).record(ctx, tx, auditTarget{entity: models.EntityTypeIndividual, keys: []int{int(id)}}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %v", err)
+	}
+
 	individual.IndividualID = int(id)
+	individual.Version = 1
 	return individual, nil
 }
 
@@ -201,7 +225,7 @@ func (r *SQLiteRepository) GetIndividualByID(ctx context.Context, id int) (*mode
 	}
 
 	var individual models.Individual
-	err = stmt.QueryRowContext(ctx, id).Scan(
+	err = database.Stmt(ctx, stmt).QueryRowContext(ctx, id).Scan(
 		&individual.IndividualID,
 		&individual.FullName,
 		&individual.Gender,
@@ -217,6 +241,7 @@ func (r *SQLiteRepository) GetIndividualByID(ctx context.Context, id int) (*mode
 		&individual.PhotoURL,
 		&individual.FatherID,
 		&individual.MotherID,
+		&individual.Version,
 		&individual.CreatedAt,
 		&individual.UpdatedAt,
 	)
@@ -230,16 +255,43 @@ func (r *SQLiteRepository) GetIndividualByID(ctx context.Context, id int) (*mode
 	return &individual, nil
 }
 
-// UpdateIndividual 更新个人信息
+// GetIndividualVersion 获取个人的当前版本号，回收站中的个人视为不存在
+func (r *SQLiteRepository) GetIndividualVersion(ctx context.Context, id int) (int, error) {
+	var version int
+	err := r.conn(ctx).QueryRowContext(ctx,
+		`SELECT version FROM individuals WHERE individual_id = ? AND deleted_at IS NULL`, id).Scan(&version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("个人信息不存在")
+		}
+		return 0, err
+	}
+	return version, nil
+}
+
+// UpdateIndividual 更新个人信息，版本号加一。individual.Version 非零且与当前版本不一致时返回 models.ErrVersionConflict
 func (r *SQLiteRepository) UpdateIndividual(ctx context.Context, id int, individual *models.Individual) (*models.Individual, error) {
 	stmt, err := r.getStmt("update_individual")
 	if err != nil {
 		return nil, err
 	}
 
+	tx, err := database.Begin(ctx, r.db)
+	if err != nil {
+		return nil, fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	target, err := auditTargetOf(ctx, tx, models.EntityTypeIndividual, id)
+	if err != nil {
+		return nil, err
+	}
+
 	individual.UpdatedAt = time.Now()
 
-	result, err := stmt.ExecContext(ctx,
+	// 版本非零时只在记录未被他人修改的情况下更新
+	var version int
+	err = tx.StmtContext(ctx, stmt).QueryRowContext(ctx,
 		individual.FullName,
 		individual.Gender,
 		individual.BirthDate,
@@ -256,43 +308,52 @@ func (r *SQLiteRepository) UpdateIndividual(ctx context.Context, id int, individ
 		individual.MotherID,
 		individual.UpdatedAt,
 		id,
-	)
+		individual.Version,
+		individual.Version,
+	).Scan(&version)
+	if err == sql.ErrNoRows {
+		if target.before == nil {
+			return nil, fmt.Errorf("个人信息不存在")
+		}
+		return nil, models.ErrVersionConflict
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
+	if err := newAuditor(ctx).record(ctx, tx, target); err != nil {
 		return nil, err
 	}
-	if rowsAffected == 0 {
-		return nil, fmt.Errorf("个人信息不存在")
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %v", err)
 	}
 
 	individual.IndividualID = id
+	individual.Version = version
 	return individual, nil
 }
 
-// DeleteIndividual 删除个人信息
+// DeleteIndividual 把个人连同其子女关系和事件移入回收站。父母、配偶关系保留在原记录中，恢复后随之恢复
 func (r *SQLiteRepository) DeleteIndividual(ctx context.Context, id int) error {
-	stmt, err := r.getStmt("delete_individual")
+	tx, err := database.Begin(ctx, r.db)
 	if err != nil {
-		return err
+		return fmt.Errorf("开始事务失败: %v", err)
 	}
+	defer tx.Rollback()
 
-	result, err := stmt.ExecContext(ctx, id)
+	target, err := auditTargetOf(ctx, tx, models.EntityTypeIndividual, id)
 	if err != nil {
 		return err
 	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
+	if target.before == nil {
+		return fmt.Errorf("个人信息不存在")
+	}
+	if err := trashRecords(ctx, tx, newAuditor(ctx), target); err != nil {
 		return err
 	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("个人信息不存在")
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %v", err)
 	}
-
 	return nil
 }
 
@@ -304,7 +365,7 @@ func (r *SQLiteRepository) SearchIndividuals(ctx context.Context, query string,
 	}
 
 	searchPattern := "%" + query + "%"
-	rows, err := stmt.QueryContext(ctx, searchPattern, searchPattern, limit, offset)
+	rows, err := database.Stmt(ctx, stmt).QueryContext(ctx, searchPattern, searchPattern, limit, offset)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -329,6 +390,7 @@ func (r *SQLiteRepository) SearchIndividuals(ctx context.Context, query string,
 			&individual.PhotoURL,
 			&individual.FatherID,
 			&individual.MotherID,
+			&individual.Version,
 			&individual.CreatedAt,
 			&individual.UpdatedAt,
 		)
@@ -340,7 +402,7 @@ func (r *SQLiteRepository) SearchIndividuals(ctx context.Context, query string,
 
 	// 获取总数
 	var total int
-	err = r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM individuals WHERE full_name LIKE ? OR notes LIKE ?", searchPattern, searchPattern).Scan(&total)
+	err = r.conn(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM individuals WHERE deleted_at IS NULL AND (full_name LIKE ? OR notes LIKE ?)", searchPattern, searchPattern).Scan(&total)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -356,13 +418,13 @@ func (r *SQLiteRepository) SearchIndividualsForUser(ctx context.Context, userID
 	querySQL := `
 		SELECT individual_id, full_name, gender, birth_date, birth_place, birth_place_id,
 		       death_date, death_place, death_place_id, burial_place_id,
-		       occupation, notes, photo_url, father_id, mother_id, created_at, updated_at
+		       occupation, notes, photo_url, father_id, mother_id, version, created_at, updated_at
 		FROM individuals 
-		WHERE user_id = ? AND (full_name LIKE ? OR notes LIKE ?)
+		WHERE user_id = ? AND deleted_at IS NULL AND (full_name LIKE ? OR notes LIKE ?)
 		LIMIT ? OFFSET ?
 	`
 
-	rows, err := r.db.QueryContext(ctx, querySQL, userID, searchPattern, searchPattern, limit, offset)
+	rows, err := r.conn(ctx).QueryContext(ctx, querySQL, userID, searchPattern, searchPattern, limit, offset)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -387,6 +449,7 @@ func (r *SQLiteRepository) SearchIndividualsForUser(ctx context.Context, userID
 			&individual.PhotoURL,
 			&individual.FatherID,
 			&individual.MotherID,
+			&individual.Version,
 			&individual.CreatedAt,
 			&individual.UpdatedAt,
 		)
@@ -398,8 +461,8 @@ func (r *SQLiteRepository) SearchIndividualsForUser(ctx context.Context, userID
 
 	// 获取总数（用户隔离）
 	var total int
-	countSQL := "SELECT COUNT(*) FROM individuals WHERE user_id = ? AND (full_name LIKE ? OR notes LIKE ?)"
-	err = r.db.QueryRowContext(ctx, countSQL, userID, searchPattern, searchPattern).Scan(&total)
+	countSQL := "SELECT COUNT(*) FROM individuals WHERE user_id = ? AND deleted_at IS NULL AND (full_name LIKE ? OR notes LIKE ?)"
+	err = r.conn(ctx).QueryRowContext(ctx, countSQL, userID, searchPattern, searchPattern).Scan(&total)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -414,7 +477,7 @@ func (r *SQLiteRepository) GetIndividualsByParentID(ctx context.Context, parentI
 		return nil, err
 	}
 
-	rows, err := stmt.QueryContext(ctx, parentID, parentID)
+	rows, err := database.Stmt(ctx, stmt).QueryContext(ctx, parentID, parentID)
 	if err != nil {
 		return nil, err
 	}
@@ -439,6 +502,7 @@ func (r *SQLiteRepository) GetIndividualsByParentID(ctx context.Context, parentI
 			&individual.PhotoURL,
 			&individual.FatherID,
 			&individual.MotherID,
+			&individual.Version,
 			&individual.CreatedAt,
 			&individual.UpdatedAt,
 		)
@@ -457,19 +521,14 @@ func (r *SQLiteRepository) GetIndividualsByIDs(ctx context.Context, ids []int) (
 		return []models.Individual{}, nil
 	}
 
-	placeholders := strings.Repeat("?,", len(ids)-1) + "?"
+	placeholders, args := inClause(ids)
 	query := fmt.Sprintf(`
 		SELECT individual_id, full_name, gender, birth_date, birth_place, birth_place_id, death_date,
-		death_place, death_place_id, burial_place_id, occupation, notes, photo_url, father_id, mother_id, created_at, updated_at
-		FROM individuals WHERE individual_id IN (%s)
+		death_place, death_place_id, burial_place_id, occupation, notes, photo_url, father_id, mother_id, version, created_at, updated_at
+		FROM individuals WHERE individual_id IN (%s) AND deleted_at IS NULL
 	`, placeholders)
 
-	args := make([]interface{}, len(ids))
-	for i, id := range ids {
-		args[i] = id
-	}
-
-	rows, err := r.db.QueryContext(ctx, query, args...)
+	rows, err := r.conn(ctx).QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("查询个人信息列表失败: %v", err)
 	}
@@ -483,6 +542,7 @@ func (r *SQLiteRepository) GetIndividualsByIDs(ctx context.Context, ids []int) (
 			&individual.BirthDate, &individual.BirthPlace, &individual.BirthPlaceID, &individual.DeathDate,
 			&individual.DeathPlace, &individual.DeathPlaceID, &individual.BurialPlaceID, &individual.Occupation, &individual.Notes,
 			&individual.PhotoURL, &individual.FatherID, &individual.MotherID,
+			&individual.Version,
 			&individual.CreatedAt, &individual.UpdatedAt)
 
 		if err != nil {
@@ -495,6 +555,42 @@ func (r *SQLiteRepository) GetIndividualsByIDs(ctx context.Context, ids []int) (
 	return individuals, nil
 }
 
+// GetIndividualsByFamilyTreeID 获取家族树中的所有个人信息
+func (r *SQLiteRepository) GetIndividualsByFamilyTreeID(ctx context.Context, familyTreeID int) ([]models.Individual, error) {
+	query := `
+		SELECT individual_id, full_name, gender, birth_date, birth_place, birth_place_id, death_date,
+		death_place, death_place_id, burial_place_id, occupation, notes, photo_url, father_id, mother_id, version, created_at, updated_at
+		FROM individuals WHERE family_tree_id = ? AND deleted_at IS NULL
+		ORDER BY individual_id
+	`
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, familyTreeID)
+	if err != nil {
+		return nil, fmt.Errorf("查询家族树成员失败: %v", err)
+	}
+	defer rows.Close()
+
+	var individuals []models.Individual
+	for rows.Next() {
+		var individual models.Individual
+		err := rows.Scan(
+			&individual.IndividualID, &individual.FullName, &individual.Gender,
+			&individual.BirthDate, &individual.BirthPlace, &individual.BirthPlaceID, &individual.DeathDate,
+			&individual.DeathPlace, &individual.DeathPlaceID, &individual.BurialPlaceID, &individual.Occupation, &individual.Notes,
+			&individual.PhotoURL, &individual.FatherID, &individual.MotherID,
+			&individual.Version,
+			&individual.CreatedAt, &individual.UpdatedAt)
+
+		if err != nil {
+			return nil, fmt.Errorf("扫描个人信息失败: %v", err)
+		}
+
+		individuals = append(individuals, individual)
+	}
+
+	return individuals, rows.Err()
+}
+
 // GetParents 获取个人的父母信息
 func (r *SQLiteRepository) GetParents(ctx context.Context, individualID int) (*models.Individual, *models.Individual, error) {
 	individual, err := r.GetIndividualByID(ctx, individualID)
@@ -524,16 +620,16 @@ func (r *SQLiteRepository) GetSiblings(ctx context.Context, individualID int) ([
 
 	query := `
 		SELECT individual_id, full_name, gender, birth_date, birth_place, birth_place_id, death_date,
-		death_place, death_place_id, burial_place_id, occupation, notes, photo_url, father_id, mother_id, created_at, updated_at
+		death_place, death_place_id, burial_place_id, occupation, notes, photo_url, father_id, mother_id, version, created_at, updated_at
 		FROM individuals 
-		WHERE individual_id != ? AND (
+		WHERE individual_id != ? AND deleted_at IS NULL AND (
 			(father_id = ? AND father_id IS NOT NULL) OR 
 			(mother_id = ? AND mother_id IS NOT NULL)
 		)
 		ORDER BY birth_date
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, individualID, individual.FatherID, individual.MotherID)
+	rows, err := r.conn(ctx).QueryContext(ctx, query, individualID, individual.FatherID, individual.MotherID)
 	if err != nil {
 		return nil, fmt.Errorf("查询兄弟姐妹失败: %v", err)
 	}
@@ -547,6 +643,7 @@ func (r *SQLiteRepository) GetSiblings(ctx context.Context, individualID int) ([
 			&sibling.BirthDate, &sibling.BirthPlace, &sibling.BirthPlaceID, &sibling.DeathDate,
 			&sibling.DeathPlace, &sibling.DeathPlaceID, &sibling.BurialPlaceID, &sibling.Occupation, &sibling.Notes,
 			&sibling.PhotoURL, &sibling.FatherID, &sibling.MotherID,
+			&sibling.Version,
 			&sibling.CreatedAt, &sibling.UpdatedAt)
 
 		if err != nil {
@@ -566,7 +663,7 @@ func (r *SQLiteRepository) GetSpouses(ctx context.Context, individualID int) ([]
 		return nil, err
 	}
 
-	rows, err := stmt.QueryContext(ctx, individualID, individualID, individualID)
+	rows, err := database.Stmt(ctx, stmt).QueryContext(ctx, individualID, individualID, individualID)
 	if err != nil {
 		return nil, err
 	}
@@ -591,6 +688,7 @@ func (r *SQLiteRepository) GetSpouses(ctx context.Context, individualID int) ([]
 			&spouse.PhotoURL,
 			&spouse.FatherID,
 			&spouse.MotherID,
+			&spouse.Version,
 			&spouse.CreatedAt,
 			&spouse.UpdatedAt,
 		)
@@ -710,7 +808,13 @@ func (r *SQLiteRepository) CreateFamily(ctx context.Context, family *models.Fami
 		VALUES (?, ?, ?, ?, ?, ?, ?)
 	`
 
-	result, err := r.db.ExecContext(ctx, query,
+	tx, err := database.Begin(ctx, r.db)
+	if err != nil {
+		return nil, fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query,
 		family.HusbandID, family.WifeID, family.MarriageOrder, family.MarriageDate,
 		family.MarriagePlaceID, family.DivorceDate, family.Notes)
 
@@ -723,7 +827,15 @@ func (r *SQLiteRepository) CreateFamily(ctx context.Context, family *models.Fami
 		return nil, fmt.Errorf("获取新插入ID失败: %v", err)
 	}
 
+	if err := newAuditor(ctx).record(ctx, tx, auditTarget{entity: models.EntityTypeFamily, keys: []int{int(id)}}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %v", err)
+	}
+
 	family.FamilyID = int(id)
+	family.Version = 1
 	family.CreatedAt = time.Now()
 	family.UpdatedAt = time.Now()
 
@@ -734,17 +846,17 @@ func (r *SQLiteRepository) CreateFamily(ctx context.Context, family *models.Fami
 func (r *SQLiteRepository) GetFamilyByID(ctx context.Context, id int) (*models.Family, error) {
 	query := `
 		SELECT family_id, husband_id, wife_id, marriage_order, marriage_date, marriage_place_id, 
-		divorce_date, notes, created_at, updated_at
-		FROM families WHERE family_id = ?
+		divorce_date, notes, version, created_at, updated_at
+		FROM families WHERE family_id = ? AND deleted_at IS NULL
 	`
 
 	var family models.Family
-	row := r.db.QueryRowContext(ctx, query, id)
+	row := r.conn(ctx).QueryRowContext(ctx, query, id)
 
 	err := row.Scan(
 		&family.FamilyID, &family.HusbandID, &family.WifeID, &family.MarriageOrder,
 		&family.MarriageDate, &family.MarriagePlaceID, &family.DivorceDate,
-		&family.Notes, &family.CreatedAt, &family.UpdatedAt)
+		&family.Notes, &family.Version, &family.CreatedAt, &family.UpdatedAt)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -753,47 +865,118 @@ func (r *SQLiteRepository) GetFamilyByID(ctx context.Context, id int) (*models.F
 		return nil, fmt.Errorf("查询家庭关系失败: %v", err)
 	}
 
+	if err := r.loadFamilyRelations(ctx, &family); err != nil {
+		return nil, err
+	}
 	return &family, nil
 }
 
-// UpdateFamily 更新家庭关系
+// loadFamilyRelations 填充家庭的夫妻、结婚地点和子女关系，已删除的个人不填充
+func (r *SQLiteRepository) loadFamilyRelations(ctx context.Context, family *models.Family) error {
+	var spouseIDs []int
+	for _, id := range []*int{family.HusbandID, family.WifeID} {
+		if id != nil {
+			spouseIDs = append(spouseIDs, *id)
+		}
+	}
+	spouses, err := r.GetIndividualsByIDs(ctx, spouseIDs)
+	if err != nil {
+		return err
+	}
+	for i := range spouses {
+		switch id := spouses[i].IndividualID; {
+		case family.HusbandID != nil && id == *family.HusbandID:
+			family.Husband = &spouses[i]
+		case family.WifeID != nil && id == *family.WifeID:
+			family.Wife = &spouses[i]
+		}
+	}
+
+	if family.MarriagePlaceID != nil {
+		places, err := r.GetPlacesByIDs(ctx, []int{*family.MarriagePlaceID})
+		if err != nil {
+			return err
+		}
+		if len(places) > 0 {
+			family.MarriagePlace = &places[0]
+		}
+	}
+
+	family.Children, err = r.GetChildrenByFamilyID(ctx, family.FamilyID)
+	return err
+}
+
+// UpdateFamily 更新家庭关系，版本号加一。family.Version 非零且与当前版本不一致时返回 models.ErrVersionConflict
 func (r *SQLiteRepository) UpdateFamily(ctx context.Context, id int, family *models.Family) (*models.Family, error) {
 	query := `
 		UPDATE families SET 
 		husband_id = ?, wife_id = ?, marriage_order = ?, marriage_date = ?, marriage_place_id = ?, 
-		divorce_date = ?, notes = ?, updated_at = CURRENT_TIMESTAMP
-		WHERE family_id = ?
+		divorce_date = ?, notes = ?, updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE family_id = ? AND deleted_at IS NULL AND (? = 0 OR version = ?)
 	`
 
-	_, err := r.db.ExecContext(ctx, query,
+	tx, err := database.Begin(ctx, r.db)
+	if err != nil {
+		return nil, fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	target, err := auditTargetOf(ctx, tx, models.EntityTypeFamily, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// 版本非零时只在记录未被他人修改的情况下更新
+	result, err := tx.ExecContext(ctx, query,
 		family.HusbandID, family.WifeID, family.MarriageOrder, family.MarriageDate,
-		family.MarriagePlaceID, family.DivorceDate, family.Notes, id)
+		family.MarriagePlaceID, family.DivorceDate, family.Notes, id, family.Version, family.Version)
 
 	if err != nil {
 		return nil, fmt.Errorf("更新家庭关系失败: %v", err)
 	}
 
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("获取影响行数失败: %v", err)
+	}
+	if affected == 0 {
+		if target.before == nil {
+			return nil, fmt.Errorf("家庭关系不存在")
+		}
+		return nil, models.ErrVersionConflict
+	}
+
+	if err := newAuditor(ctx).record(ctx, tx, target); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %v", err)
+	}
+
 	return r.GetFamilyByID(ctx, id)
 }
 
-// DeleteFamily 删除家庭关系
+// DeleteFamily 把家庭连同其子女关系移入回收站
 func (r *SQLiteRepository) DeleteFamily(ctx context.Context, id int) error {
-	query := `DELETE FROM families WHERE family_id = ?`
-
-	result, err := r.db.ExecContext(ctx, query, id)
+	tx, err := database.Begin(ctx, r.db)
 	if err != nil {
-		return fmt.Errorf("删除家庭关系失败: %v", err)
+		return fmt.Errorf("开始事务失败: %v", err)
 	}
+	defer tx.Rollback()
 
-	affected, err := result.RowsAffected()
+	target, err := auditTargetOf(ctx, tx, models.EntityTypeFamily, id)
 	if err != nil {
-		return fmt.Errorf("获取影响行数失败: %v", err)
+		return err
 	}
-
-	if affected == 0 {
+	if target.before == nil {
 		return fmt.Errorf("家庭关系不存在")
 	}
-
+	if err := trashRecords(ctx, tx, newAuditor(ctx), target); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %v", err)
+	}
 	return nil
 }
 
@@ -801,12 +984,12 @@ func (r *SQLiteRepository) DeleteFamily(ctx context.Context, id int) error {
 func (r *SQLiteRepository) GetFamiliesByIndividualID(ctx context.Context, individualID int) ([]models.Family, error) {
 	query := `
 		SELECT family_id, husband_id, wife_id, marriage_order, marriage_date, marriage_place_id, 
-		divorce_date, notes, created_at, updated_at
-		FROM families WHERE husband_id = ? OR wife_id = ?
+		divorce_date, notes, version, created_at, updated_at
+		FROM families WHERE (husband_id = ? OR wife_id = ?) AND deleted_at IS NULL
 		ORDER BY marriage_order, created_at
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, individualID, individualID)
+	rows, err := r.conn(ctx).QueryContext(ctx, query, individualID, individualID)
 	if err != nil {
 		return nil, fmt.Errorf("查询家庭关系失败: %v", err)
 	}
@@ -818,7 +1001,7 @@ func (r *SQLiteRepository) GetFamiliesByIndividualID(ctx context.Context, indivi
 		err := rows.Scan(
 			&family.FamilyID, &family.HusbandID, &family.WifeID, &family.MarriageOrder,
 			&family.MarriageDate, &family.MarriagePlaceID, &family.DivorceDate,
-			&family.Notes, &family.CreatedAt, &family.UpdatedAt)
+			&family.Notes, &family.Version, &family.CreatedAt, &family.UpdatedAt)
 
 		if err != nil {
 			return nil, fmt.Errorf("扫描家庭关系失败: %v", err)
@@ -830,14 +1013,60 @@ func (r *SQLiteRepository) GetFamiliesByIndividualID(ctx context.Context, indivi
 	return families, nil
 }
 
+// GetFamiliesByIndividualIDs 批量获取多人参与的家庭关系
+func (r *SQLiteRepository) GetFamiliesByIndividualIDs(ctx context.Context, individualIDs []int) ([]models.Family, error) {
+	if len(individualIDs) == 0 {
+		return []models.Family{}, nil
+	}
+
+	placeholders, list := inClause(individualIDs)
+	query := fmt.Sprintf(`
+		SELECT family_id, husband_id, wife_id, marriage_order, marriage_date, marriage_place_id,
+		divorce_date, COALESCE(notes, ''), version, created_at, updated_at
+		FROM families WHERE (husband_id IN (%s) OR wife_id IN (%s)) AND deleted_at IS NULL
+		ORDER BY marriage_order, family_id
+	`, placeholders, placeholders)
+
+	args := append(list, list...)
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询家庭关系失败: %v", err)
+	}
+	defer rows.Close()
+
+	var families []models.Family
+	for rows.Next() {
+		var family models.Family
+		err := rows.Scan(
+			&family.FamilyID, &family.HusbandID, &family.WifeID, &family.MarriageOrder,
+			&family.MarriageDate, &family.MarriagePlaceID, &family.DivorceDate,
+			&family.Notes, &family.Version, &family.CreatedAt, &family.UpdatedAt)
+
+		if err != nil {
+			return nil, fmt.Errorf("扫描家庭关系失败: %v", err)
+		}
+
+		families = append(families, family)
+	}
+
+	return families, rows.Err()
+}
+
 // CreateChild 创建子女关系
 func (r *SQLiteRepository) CreateChild(ctx context.Context, child *models.Child) (*models.Child, error) {
 	query := `
-		INSERT INTO children (family_id, individual_id, relationship_to_parents)
+		INSERT INTO children (family_id, individual_id, relationship_type)
 		VALUES (?, ?, ?)
 	`
 
-	result, err := r.db.ExecContext(ctx, query,
+	tx, err := database.Begin(ctx, r.db)
+	if err != nil {
+		return nil, fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query,
 		child.FamilyID, child.IndividualID, child.RelationshipToParents)
 
 	if err != nil {
@@ -849,6 +1078,14 @@ func (r *SQLiteRepository) CreateChild(ctx context.Context, child *models.Child)
 		return nil, fmt.Errorf("获取新插入ID失败: %v", err)
 	}
 
+	target := auditTarget{entity: models.EntityTypeChild, keys: []int{child.FamilyID, child.IndividualID}}
+	if err := newAuditor(ctx).record(ctx, tx, target); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %v", err)
+	}
+
 	child.ChildID = int(id)
 	child.CreatedAt = time.Now()
 	child.UpdatedAt = time.Now()
@@ -858,9 +1095,20 @@ func (r *SQLiteRepository) CreateChild(ctx context.Context, child *models.Child)
 
 // DeleteChild 删除子女关系
 func (r *SQLiteRepository) DeleteChild(ctx context.Context, familyID, individualID int) error {
-	query := `DELETE FROM children WHERE family_id = ? AND individual_id = ?`
+	query := `DELETE FROM children WHERE family_id = ? AND individual_id = ? AND deleted_at IS NULL`
+
+	tx, err := database.Begin(ctx, r.db)
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
 
-	result, err := r.db.ExecContext(ctx, query, familyID, individualID)
+	target, err := auditTargetOf(ctx, tx, models.EntityTypeChild, familyID, individualID)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, query, familyID, individualID)
 	if err != nil {
 		return fmt.Errorf("删除子女关系失败: %v", err)
 	}
@@ -874,18 +1122,25 @@ func (r *SQLiteRepository) DeleteChild(ctx context.Context, familyID, individual
 		return fmt.Errorf("子女关系不存在")
 	}
 
+	if err := newAuditor(ctx).record(ctx, tx, target); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %v", err)
+	}
 	return nil
 }
 
-// GetChildrenByFamilyID 获取家庭的所有子女
+// GetChildrenByFamilyID 获取家庭的所有子女。children 表没有 child_id 和 updated_at 列：
+// ChildID 取 rowid；子女关系建立后不再修改，UpdatedAt 即 created_at
 func (r *SQLiteRepository) GetChildrenByFamilyID(ctx context.Context, familyID int) ([]models.Child, error) {
 	query := `
-		SELECT child_id, family_id, individual_id, relationship_to_parents, created_at, updated_at
-		FROM children WHERE family_id = ?
-		ORDER BY created_at
+		SELECT rowid, family_id, individual_id, COALESCE(relationship_type, ''), created_at, created_at
+		FROM children WHERE family_id = ? AND deleted_at IS NULL
+		ORDER BY birth_order, created_at
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, familyID)
+	rows, err := r.conn(ctx).QueryContext(ctx, query, familyID)
 	if err != nil {
 		return nil, fmt.Errorf("查询子女关系失败: %v", err)
 	}
@@ -908,6 +1163,42 @@ func (r *SQLiteRepository) GetChildrenByFamilyID(ctx context.Context, familyID i
 	return children, nil
 }
 
+// GetChildrenByFamilyIDs 批量获取多个家庭的子女关系，各列的取法与 GetChildrenByFamilyID 相同
+func (r *SQLiteRepository) GetChildrenByFamilyIDs(ctx context.Context, familyIDs []int) ([]models.Child, error) {
+	if len(familyIDs) == 0 {
+		return []models.Child{}, nil
+	}
+
+	placeholders, args := inClause(familyIDs)
+	query := fmt.Sprintf(`
+		SELECT rowid, family_id, individual_id, COALESCE(relationship_type, ''), created_at, created_at
+		FROM children WHERE family_id IN (%s) AND deleted_at IS NULL
+		ORDER BY family_id, birth_order, created_at
+	`, placeholders)
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询子女关系失败: %v", err)
+	}
+	defer rows.Close()
+
+	var children []models.Child
+	for rows.Next() {
+		var child models.Child
+		err := rows.Scan(
+			&child.ChildID, &child.FamilyID, &child.IndividualID,
+			&child.RelationshipToParents, &child.CreatedAt, &child.UpdatedAt)
+
+		if err != nil {
+			return nil, fmt.Errorf("扫描子女关系失败: %v", err)
+		}
+
+		children = append(children, child)
+	}
+
+	return children, rows.Err()
+}
+
 // Close 关闭数据库连接
 func (r *SQLiteRepository) Close() error {
 	r.stmtCache.Lock()
@@ -1050,6 +1341,11 @@ func (r *SQLiteRepository) CreateIndividualForUser(ctx context.Context, userID i
 	// 获取用户的默认家族树ID
 	var familyTreeID int = 1 // 默认值，可以后续扩展为真正获取用户的默认家族树
 
+	return r.CreateIndividualInTree(ctx, userID, familyTreeID, individual)
+}
+
+// CreateIndividualInTree 在指定的家族树中创建个人信息
+func (r *SQLiteRepository) CreateIndividualInTree(ctx context.Context, userID, familyTreeID int, individual *models.Individual) (*models.Individual, error) {
 	query := `
 		INSERT INTO individuals (
 			full_name, gender, birth_date, birth_place, birth_place_id,
@@ -1059,11 +1355,17 @@ func (r *SQLiteRepository) CreateIndividualForUser(ctx context.Context, userID i
 		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
+	tx, err := database.Begin(ctx, r.db)
+	if err != nil {
+		return nil, fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
 	now := time.Now()
 	individual.CreatedAt = now
 	individual.UpdatedAt = now
 
-	result, err := r.db.ExecContext(ctx, query,
+	result, err := tx.ExecContext(ctx, query,
 		individual.FullName,
 		individual.Gender,
 		individual.BirthDate,
@@ -1092,6 +1394,14 @@ func (r *SQLiteRepository) CreateIndividualForUser(ctx context.Context, userID i
 		return nil, err
 	}
 
+	if err := newAuditor(ctx).record(ctx, tx, auditTarget{entity: models.EntityTypeIndividual, keys: []int{int(id)}}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %v", err)
+	}
+
 	individual.IndividualID = int(id)
+	individual.Version = 1
 	return individual, nil
 }
@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"familytree/models"
+)
+
+func TestRowVersions(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	individual, err := repo.CreateIndividual(ctx, &models.Individual{FullName: "赵甲", Gender: models.GenderMale})
+	if err != nil {
+		t.Fatalf("创建个人失败: %v", err)
+	}
+	id := individual.IndividualID
+	if individual.Version != 1 {
+		t.Fatalf("新建个人的版本: %d", individual.Version)
+	}
+
+	// 不带版本时直接更新，版本号加一
+	individual.Occupation = "农"
+	individual.Version = 0
+	updated, err := repo.UpdateIndividual(ctx, id, individual)
+	if err != nil {
+		t.Fatalf("更新个人失败: %v", err)
+	}
+	if updated.Version != 2 {
+		t.Fatalf("更新后的版本: %d", updated.Version)
+	}
+
+	// 按过期的版本更新被拒绝，记录保持不变
+	stale := *updated
+	stale.Occupation = "商"
+	stale.Version = 1
+	if _, err := repo.UpdateIndividual(ctx, id, &stale); err != models.ErrVersionConflict {
+		t.Fatalf("过期版本更新: %v", err)
+	}
+	current, err := repo.GetIndividualByID(ctx, id)
+	if err != nil {
+		t.Fatalf("查询个人失败: %v", err)
+	}
+	if current.Version != 2 || current.Occupation != "农" {
+		t.Fatalf("拒绝更新后的记录: 版本 %d 职业 %q", current.Version, current.Occupation)
+	}
+
+	stale.Version = 2
+	if updated, err = repo.UpdateIndividual(ctx, id, &stale); err != nil || updated.Version != 3 {
+		t.Fatalf("按当前版本更新: %v %+v", err, updated)
+	}
+	if _, err := repo.UpdateIndividual(ctx, id+1000, &stale); err == nil || err == models.ErrVersionConflict {
+		t.Fatalf("更新不存在的个人: %v", err)
+	}
+
+	// 修改字号同样改变版本
+	if err := repo.SetAlternateNames(ctx, id, models.AlternateNames{CourtesyName: "子乙"}); err != nil {
+		t.Fatalf("保存字号失败: %v", err)
+	}
+	if current, _ = repo.GetIndividualByID(ctx, id); current.Version != 4 {
+		t.Fatalf("修改字号后的版本: %d", current.Version)
+	}
+
+	// 版本号不算作字段变更
+	entries, _, err := repo.GetAuditEntries(ctx, models.AuditQuery{EntityType: models.EntityTypeIndividual, EntityID: strconv.Itoa(id), Limit: 50})
+	if err != nil {
+		t.Fatalf("查询变更历史失败: %v", err)
+	}
+	for _, entry := range entries {
+		for _, change := range entry.Changes {
+			if change.Field == "version" {
+				t.Fatalf("变更历史包含版本号: %+v", entry)
+			}
+		}
+	}
+
+	family, err := repo.CreateFamily(ctx, &models.Family{HusbandID: &id, MarriageOrder: 1})
+	if err != nil {
+		t.Fatalf("创建家庭失败: %v", err)
+	}
+	family.Notes = "续弦"
+	if _, err := repo.UpdateFamily(ctx, family.FamilyID, family); err != nil {
+		t.Fatalf("更新家庭失败: %v", err)
+	}
+	if _, err := repo.UpdateFamily(ctx, family.FamilyID, family); err != models.ErrVersionConflict {
+		t.Fatalf("过期版本更新家庭: %v", err)
+	}
+	if current, _ := repo.GetFamilyByID(ctx, family.FamilyID); current.Version != 2 || current.Notes != "续弦" {
+		t.Fatalf("家庭: %+v", current)
+	}
+}
+
+func TestChildColumns(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+	fatherID := insertPerson(t, repo, "赵父", "male", nil, nil)
+	childID := insertPerson(t, repo, "赵子", "male", &fatherID, nil)
+	family, err := repo.CreateFamily(ctx, &models.Family{HusbandID: &fatherID, MarriageOrder: 1})
+	if err != nil {
+		t.Fatalf("创建家庭失败: %v", err)
+	}
+
+	// 关系写入 relationship_type 列，ChildID 为 rowid
+	created, err := repo.CreateChild(ctx, &models.Child{FamilyID: family.FamilyID, IndividualID: childID, RelationshipToParents: "生子"})
+	if err != nil {
+		t.Fatalf("创建子女关系失败: %v", err)
+	}
+	var relationship string
+	if err := repo.db.QueryRow(`SELECT relationship_type FROM children WHERE rowid = ?`, created.ChildID).Scan(&relationship); err != nil || relationship != "生子" {
+		t.Fatalf("写入的关系: %v %q", err, relationship)
+	}
+
+	children, err := repo.GetChildrenByFamilyID(ctx, family.FamilyID)
+	if err != nil || len(children) != 1 {
+		t.Fatalf("查询子女关系失败: %v %+v", err, children)
+	}
+	byIDs, err := repo.GetChildrenByFamilyIDs(ctx, []int{family.FamilyID})
+	if err != nil || len(byIDs) != 1 || byIDs[0] != children[0] {
+		t.Fatalf("批量查询结果不一致: %v %+v %+v", err, byIDs, children)
+	}
+	c := children[0]
+	if c.ChildID != created.ChildID || c.IndividualID != childID || c.RelationshipToParents != "生子" ||
+		c.CreatedAt.IsZero() || !c.UpdatedAt.Equal(c.CreatedAt) {
+		t.Errorf("子女关系各列: %+v", c)
+	}
+}
+
+func TestGetFamilyByIDRelations(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+	husbandID := insertPerson(t, repo, "周父", "male", nil, nil)
+	wifeID := insertPerson(t, repo, "吴母", "female", nil, nil)
+	childID := insertPerson(t, repo, "周子", "male", &husbandID, &wifeID)
+	result, err := repo.db.Exec(`INSERT INTO places (place_name) VALUES ('杭州')`)
+	if err != nil {
+		t.Fatalf("插入地点失败: %v", err)
+	}
+	placeID64, _ := result.LastInsertId()
+	placeID := int(placeID64)
+
+	created, err := repo.CreateFamily(ctx, &models.Family{HusbandID: &husbandID, WifeID: &wifeID, MarriageOrder: 1, MarriagePlaceID: &placeID})
+	if err != nil {
+		t.Fatalf("创建家庭失败: %v", err)
+	}
+	if _, err := repo.CreateChild(ctx, &models.Child{FamilyID: created.FamilyID, IndividualID: childID, RelationshipToParents: "biological"}); err != nil {
+		t.Fatalf("创建子女关系失败: %v", err)
+	}
+
+	family, err := repo.GetFamilyByID(ctx, created.FamilyID)
+	if err != nil {
+		t.Fatalf("查询家庭失败: %v", err)
+	}
+	if family.Husband == nil || family.Husband.FullName != "周父" || family.Wife == nil || family.Wife.FullName != "吴母" {
+		t.Errorf("夫妻未填充: %+v %+v", family.Husband, family.Wife)
+	}
+	if family.MarriagePlace == nil || family.MarriagePlace.PlaceName != "杭州" {
+		t.Errorf("结婚地点未填充: %+v", family.MarriagePlace)
+	}
+	if len(family.Children) != 1 || family.Children[0].IndividualID != childID {
+		t.Errorf("子女关系未填充: %+v", family.Children)
+	}
+
+	// 已删除的妻子不再填充
+	if err := repo.DeleteIndividual(ctx, wifeID); err != nil {
+		t.Fatalf("删除个人失败: %v", err)
+	}
+	if family, err = repo.GetFamilyByID(ctx, created.FamilyID); err != nil || family.Wife != nil || family.Husband == nil {
+		t.Errorf("删除妻子后: %v %+v", err, family)
+	}
+}
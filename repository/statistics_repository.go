@@ -0,0 +1,408 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"familytree/models"
+	"familytree/pkg/narrative"
+)
+
+// 家族树统计
+//
+// 所有数字都由 SQL 聚合得出，不把成员读入内存。日期列兼容 YYYY-MM-DD 和带时间的写法，
+// 统一取前 10 位参与计算；年龄以 365.2425 天为一年，保留一位小数。
+
+// maxGenerationDepth 推算世代时的最大递归深度，防止循环关系导致无限递归
+const maxGenerationDepth = 200
+
+// statsPeopleCTE 家族树成员（不含回收站中的个人），birth/death 为规范化后的日期
+const statsPeopleCTE = `
+	people AS (
+		SELECT individual_id, trim(full_name) AS full_name, gender, occupation,
+			NULLIF(substr(birth_date, 1, 10), '') AS birth,
+			NULLIF(substr(death_date, 1, 10), '') AS death,
+			birth_place, birth_place_id, father_id, mother_id,
+			(COALESCE(death_date, '') <> '' OR death_place_id IS NOT NULL OR burial_place_id IS NOT NULL
+				OR COALESCE(death_place, '') <> '' OR COALESCE(burial_place, '') <> '') AS deceased
+		FROM individuals WHERE family_tree_id = ? AND deleted_at IS NULL
+	)`
+
+// statsFamiliesCTE 至少一方属于该家族树的家庭
+const statsFamiliesCTE = `
+	tree_families AS (
+		SELECT * FROM families
+		WHERE deleted_at IS NULL
+		  AND (husband_id IN (SELECT individual_id FROM people) OR wife_id IN (SELECT individual_id FROM people))
+	)`
+
+// statsParentLinkCTE 父母-子女关系，合并 father_id/mother_id 与 children 表，回收站中的父母不计入
+const statsParentLinkCTE = `
+	live_people AS (SELECT individual_id FROM individuals WHERE deleted_at IS NULL),
+	parent_link(child, parent) AS (
+		SELECT individual_id, father_id FROM people WHERE father_id IN (SELECT individual_id FROM live_people)
+		UNION
+		SELECT individual_id, mother_id FROM people WHERE mother_id IN (SELECT individual_id FROM live_people)
+		UNION
+		SELECT c.individual_id, f.husband_id FROM children c
+		JOIN tree_families f ON f.family_id = c.family_id
+		WHERE c.deleted_at IS NULL AND f.husband_id IN (SELECT individual_id FROM live_people) AND c.individual_id IN (SELECT individual_id FROM people)
+		UNION
+		SELECT c.individual_id, f.wife_id FROM children c
+		JOIN tree_families f ON f.family_id = c.family_id
+		WHERE c.deleted_at IS NULL AND f.wife_id IN (SELECT individual_id FROM live_people) AND c.individual_id IN (SELECT individual_id FROM people)
+	)`
+
+// statsWith 组合查询用到的 CTE
+func statsWith(ctes ...string) string {
+	return "WITH RECURSIVE " + strings.Join(ctes, ",")
+}
+
+// GetTreeStatistics 家族树统计，top 为各类排行的条数
+func (r *SQLiteRepository) GetTreeStatistics(ctx context.Context, familyTreeID int, top int) (*models.TreeStatistics, error) {
+	stats := &models.TreeStatistics{FamilyTreeID: familyTreeID}
+
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"总数", func() error { return r.statsTotals(ctx, familyTreeID, stats) }},
+		{"性别", func() error {
+			var err error
+			stats.Genders, err = r.statsCounts(ctx, statsWith(statsPeopleCTE)+`
+				SELECT gender, COUNT(*) FROM people GROUP BY gender ORDER BY COUNT(*) DESC, gender`, familyTreeID)
+			return err
+		}},
+		{"世代", func() error { return r.statsGenerations(ctx, familyTreeID, stats) }},
+		{"寿命", func() error { return r.statsLifespans(ctx, familyTreeID, stats) }},
+		{"婚育年龄", func() error { return r.statsAges(ctx, familyTreeID, stats) }},
+		{"子女数", func() error { return r.statsChildren(ctx, familyTreeID, stats) }},
+		{"姓名", func() error { return r.statsNames(ctx, familyTreeID, top, stats) }},
+		{"职业", func() error {
+			var err error
+			stats.Occupations, err = r.statsCounts(ctx, statsWith(statsPeopleCTE)+`
+				SELECT trim(occupation) AS key, COUNT(*) FROM people
+				WHERE COALESCE(trim(occupation), '') <> ''
+				GROUP BY key ORDER BY COUNT(*) DESC, key LIMIT ?`, familyTreeID, top)
+			return err
+		}},
+		{"出生地", func() error {
+			var err error
+			stats.BirthPlaces, err = r.statsCounts(ctx, statsWith(statsPeopleCTE)+`
+				SELECT COALESCE(NULLIF(trim(pl.place_name), ''), NULLIF(trim(p.birth_place), '')) AS key, COUNT(*)
+				FROM people p LEFT JOIN places pl ON pl.place_id = p.birth_place_id
+				WHERE key IS NOT NULL
+				GROUP BY key ORDER BY COUNT(*) DESC, key LIMIT ?`, familyTreeID, top)
+			return err
+		}},
+		{"出生世纪", func() error {
+			var err error
+			stats.Centuries, err = r.statsCounts(ctx, statsWith(statsPeopleCTE)+`
+				SELECT (CAST(substr(birth, 1, 4) AS INTEGER) - 1) / 100 + 1 AS century, COUNT(*)
+				FROM people WHERE birth IS NOT NULL AND CAST(substr(birth, 1, 4) AS INTEGER) > 0
+				GROUP BY century ORDER BY century`, familyTreeID)
+			for i := range stats.Centuries {
+				stats.Centuries[i].Key += "世纪"
+			}
+			return err
+		}},
+		{"纪录", func() error { return r.statsRecords(ctx, familyTreeID, stats) }},
+	}
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			return nil, fmt.Errorf("统计%s失败: %v", step.name, err)
+		}
+	}
+	return stats, nil
+}
+
+// statsTotals 人数、家庭数与在世人数
+func (r *SQLiteRepository) statsTotals(ctx context.Context, familyTreeID int, stats *models.TreeStatistics) error {
+	err := r.conn(ctx).QueryRowContext(ctx, statsWith(statsPeopleCTE, statsFamiliesCTE)+`
+		SELECT
+			(SELECT COUNT(*) FROM people),
+			(SELECT COUNT(*) FROM tree_families),
+			(SELECT COALESCE(SUM(deceased), 0) FROM people)
+	`, familyTreeID).Scan(&stats.Individuals, &stats.Families, &stats.Deceased)
+	stats.Living = stats.Individuals - stats.Deceased
+	return err
+}
+
+// statsCounts 执行返回 (key, count) 的查询
+func (r *SQLiteRepository) statsCounts(ctx context.Context, query string, args ...interface{}) ([]models.StatCount, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []models.StatCount{}
+	for rows.Next() {
+		var key sql.NullString
+		var c models.StatCount
+		if err := rows.Scan(&key, &c.Count); err != nil {
+			return nil, err
+		}
+		c.Key = key.String
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// statsGenerations 按世代统计人数。没有已知父母的人为第 1 世，其余取各条父系、母系路径中最长的一条；
+// 没有父母记录的姻亲与配偶同世
+func (r *SQLiteRepository) statsGenerations(ctx context.Context, familyTreeID int, stats *models.TreeStatistics) error {
+	rows, err := r.conn(ctx).QueryContext(ctx, statsWith(statsPeopleCTE, statsFamiliesCTE, statsParentLinkCTE, `
+		descent(id, gen) AS (
+			SELECT individual_id, 1 FROM people WHERE individual_id NOT IN (SELECT child FROM parent_link)
+			UNION
+			SELECT pl.child, d.gen + 1 FROM descent d JOIN parent_link pl ON pl.parent = d.id
+			WHERE d.gen < ?
+		)`, `
+		blood AS (SELECT id, MAX(gen) AS gen FROM descent GROUP BY id)`, `
+		spouse_gen AS (
+			SELECT p.individual_id AS id, MAX(b.gen) AS gen
+			FROM people p
+			JOIN tree_families f ON p.individual_id IN (f.husband_id, f.wife_id)
+			JOIN blood b ON b.id = CASE WHEN f.husband_id = p.individual_id THEN f.wife_id ELSE f.husband_id END
+			WHERE p.individual_id NOT IN (SELECT child FROM parent_link)
+			GROUP BY p.individual_id
+		)`)+`
+		SELECT COALESCE(MAX(b.gen, COALESCE(s.gen, 0)), 0) AS generation, COUNT(*),
+			SUM(p.gender = 'male'), SUM(p.gender = 'female'), SUM(p.gender NOT IN ('male', 'female'))
+		FROM people p
+		LEFT JOIN blood b ON b.id = p.individual_id
+		LEFT JOIN spouse_gen s ON s.id = p.individual_id
+		GROUP BY generation ORDER BY generation
+	`, familyTreeID, maxGenerationDepth)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	stats.Generations = []models.GenerationStat{}
+	for rows.Next() {
+		var g models.GenerationStat
+		if err := rows.Scan(&g.Generation, &g.Total, &g.Male, &g.Female, &g.Unknown); err != nil {
+			return err
+		}
+		stats.Generations = append(stats.Generations, g)
+	}
+	return rows.Err()
+}
+
+// statsLifespans 已故者按出生年代统计寿命
+func (r *SQLiteRepository) statsLifespans(ctx context.Context, familyTreeID int, stats *models.TreeStatistics) error {
+	rows, err := r.conn(ctx).QueryContext(ctx, statsWith(statsPeopleCTE)+`
+		SELECT CAST(substr(birth, 1, 4) AS INTEGER) / 10 * 10 AS decade, COUNT(*),
+			ROUND(AVG(age), 1), ROUND(MIN(age), 1), ROUND(MAX(age), 1)
+		FROM (
+			SELECT birth, (julianday(death) - julianday(birth)) / 365.2425 AS age
+			FROM people WHERE birth IS NOT NULL AND death IS NOT NULL
+		)
+		WHERE age >= 0
+		GROUP BY decade ORDER BY decade
+	`, familyTreeID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	stats.LifespanByDecade = []models.LifespanStat{}
+	for rows.Next() {
+		var l models.LifespanStat
+		if err := rows.Scan(&l.Decade, &l.Count, &l.Average, &l.Min, &l.Max); err != nil {
+			return err
+		}
+		stats.LifespanByDecade = append(stats.LifespanByDecade, l)
+	}
+	return rows.Err()
+}
+
+// statsAges 初婚年龄与生育第一个子女的年龄，按性别统计
+func (r *SQLiteRepository) statsAges(ctx context.Context, familyTreeID int, stats *models.TreeStatistics) error {
+	var err error
+	stats.MarriageAge, err = r.statsAgeRows(ctx, statsWith(statsPeopleCTE, statsFamiliesCTE, `
+		marriages(id, married) AS (
+			SELECT husband_id, substr(marriage_date, 1, 10) FROM tree_families
+			WHERE husband_id IS NOT NULL AND marriage_date IS NOT NULL
+			UNION ALL
+			SELECT wife_id, substr(marriage_date, 1, 10) FROM tree_families
+			WHERE wife_id IS NOT NULL AND marriage_date IS NOT NULL
+		)`)+`
+		SELECT gender, COUNT(*), ROUND(AVG(age), 1), ROUND(MIN(age), 1), ROUND(MAX(age), 1)
+		FROM (
+			SELECT p.gender, (julianday(MIN(m.married)) - julianday(p.birth)) / 365.2425 AS age
+			FROM people p JOIN marriages m ON m.id = p.individual_id
+			WHERE p.birth IS NOT NULL
+			GROUP BY p.individual_id
+		)
+		WHERE age >= 0
+		GROUP BY gender ORDER BY gender
+	`, familyTreeID)
+	if err != nil {
+		return err
+	}
+
+	stats.FirstChildAge, err = r.statsAgeRows(ctx, statsWith(statsPeopleCTE, statsFamiliesCTE, statsParentLinkCTE)+`
+		SELECT gender, COUNT(*), ROUND(AVG(age), 1), ROUND(MIN(age), 1), ROUND(MAX(age), 1)
+		FROM (
+			SELECT parent.gender, (julianday(MIN(child.birth)) - julianday(parent.birth)) / 365.2425 AS age
+			FROM parent_link pl
+			JOIN people parent ON parent.individual_id = pl.parent
+			JOIN people child ON child.individual_id = pl.child
+			WHERE parent.birth IS NOT NULL AND child.birth IS NOT NULL
+			GROUP BY parent.individual_id
+		)
+		WHERE age >= 0
+		GROUP BY gender ORDER BY gender
+	`, familyTreeID)
+	return err
+}
+
+// statsAgeRows 执行返回 (gender, count, avg, min, max) 的查询
+func (r *SQLiteRepository) statsAgeRows(ctx context.Context, query string, args ...interface{}) ([]models.AgeStat, error) {
+	rows, err := r.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ages := []models.AgeStat{}
+	for rows.Next() {
+		var a models.AgeStat
+		if err := rows.Scan(&a.Gender, &a.Count, &a.Average, &a.Min, &a.Max); err != nil {
+			return nil, err
+		}
+		ages = append(ages, a)
+	}
+	return ages, rows.Err()
+}
+
+// statsChildren 每个家庭的子女数分布，子女来自 children 表以及父母均与夫妻一致的 father_id/mother_id
+func (r *SQLiteRepository) statsChildren(ctx context.Context, familyTreeID int, stats *models.TreeStatistics) error {
+	rows, err := r.conn(ctx).QueryContext(ctx, statsWith(statsPeopleCTE, statsFamiliesCTE, `
+		family_children(family_id, individual_id) AS (
+			SELECT c.family_id, c.individual_id FROM children c
+			JOIN tree_families f ON f.family_id = c.family_id
+			WHERE c.deleted_at IS NULL
+			UNION
+			SELECT f.family_id, p.individual_id FROM tree_families f
+			JOIN people p ON p.father_id = f.husband_id AND p.mother_id = f.wife_id
+		)`, `
+		counts AS (
+			SELECT f.family_id, COUNT(fc.individual_id) AS n
+			FROM tree_families f LEFT JOIN family_children fc ON fc.family_id = f.family_id
+			GROUP BY f.family_id
+		)`)+`
+		SELECT n, COUNT(*) FROM counts GROUP BY n ORDER BY n
+	`, familyTreeID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	result := models.ChildrenStat{Distribution: []models.StatCount{}}
+	total := 0
+	for rows.Next() {
+		var n, families int
+		if err := rows.Scan(&n, &families); err != nil {
+			return err
+		}
+		result.Distribution = append(result.Distribution, models.StatCount{Key: fmt.Sprint(n), Count: families})
+		result.Families += families
+		total += n * families
+		if n > result.Max {
+			result.Max = n
+		}
+	}
+	if result.Families > 0 {
+		result.Average = math.Round(float64(total)/float64(result.Families)*10) / 10
+	}
+	stats.ChildrenPerFamily = result
+	return rows.Err()
+}
+
+// statsNames 姓氏与名字的频次，常见复姓取前两字
+func (r *SQLiteRepository) statsNames(ctx context.Context, familyTreeID int, top int, stats *models.TreeStatistics) error {
+	placeholders := strings.Repeat("?,", len(narrative.CompoundSurnames)-1) + "?"
+	args := []interface{}{familyTreeID}
+	for _, s := range narrative.CompoundSurnames {
+		args = append(args, s)
+	}
+	names := statsWith(statsPeopleCTE, fmt.Sprintf(`
+		names AS (
+			SELECT full_name,
+				CASE WHEN length(full_name) > 2 AND substr(full_name, 1, 2) IN (%s)
+					THEN substr(full_name, 1, 2) ELSE substr(full_name, 1, 1) END AS surname
+			FROM people WHERE full_name <> ''
+		)`, placeholders))
+
+	var err error
+	if stats.Surnames, err = r.statsCounts(ctx, names+`
+		SELECT surname, COUNT(*) FROM names
+		GROUP BY surname ORDER BY COUNT(*) DESC, surname LIMIT ?`, append(args, top)...); err != nil {
+		return err
+	}
+	stats.GivenNames, err = r.statsCounts(ctx, names+`
+		SELECT substr(full_name, length(surname) + 1) AS given, COUNT(*) FROM names
+		WHERE given <> ''
+		GROUP BY given ORDER BY COUNT(*) DESC, given LIMIT ?`, append(args, top)...)
+	return err
+}
+
+// statsRecords 寿命最长、最短，出生最早、最晚，以及在世者中最年长的人
+func (r *SQLiteRepository) statsRecords(ctx context.Context, familyTreeID int, stats *models.TreeStatistics) error {
+	lifespan := `(julianday(death) - julianday(birth)) / 365.2425`
+	queries := []struct {
+		kind, age, where, order string
+	}{
+		{models.RecordLongestLived, lifespan, "birth IS NOT NULL AND death IS NOT NULL AND " + lifespan + " >= 0", lifespan + " DESC"},
+		{models.RecordShortestLived, lifespan, "birth IS NOT NULL AND death IS NOT NULL AND " + lifespan + " >= 0", lifespan + " ASC"},
+		{models.RecordEarliestBirth, "NULL", "birth IS NOT NULL", "birth ASC"},
+		{models.RecordLatestBirth, "NULL", "birth IS NOT NULL", "birth DESC"},
+		{models.RecordOldestLiving, `(julianday('now') - julianday(birth)) / 365.2425`, "birth IS NOT NULL AND NOT deceased", "birth ASC"},
+	}
+
+	stats.Records = []models.StatRecord{}
+	for _, q := range queries {
+		var rec models.StatRecord
+		var birth, death sql.NullString
+		var age sql.NullFloat64
+		err := r.conn(ctx).QueryRowContext(ctx, statsWith(statsPeopleCTE)+fmt.Sprintf(`
+			SELECT individual_id, full_name, birth, death, ROUND(%s, 1)
+			FROM people WHERE %s
+			ORDER BY %s, individual_id LIMIT 1
+		`, q.age, q.where, q.order), familyTreeID).Scan(&rec.IndividualID, &rec.FullName, &birth, &death, &age)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		rec.Type = q.kind
+		rec.BirthDate = parseStatsDate(birth)
+		rec.DeathDate = parseStatsDate(death)
+		if age.Valid {
+			rec.Age = &age.Float64
+		}
+		stats.Records = append(stats.Records, rec)
+	}
+	return nil
+}
+
+// parseStatsDate 解析规范化后的日期，无法解析时返回 nil
+func parseStatsDate(s sql.NullString) *time.Time {
+	if !s.Valid {
+		return nil
+	}
+	t, err := time.Parse("2006-01-02", s.String)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"familytree/models"
+)
+
+func TestGetTreeStatistics(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	mustExec := func(query string, args ...interface{}) int {
+		t.Helper()
+		result, err := repo.db.Exec(query, args...)
+		if err != nil {
+			t.Fatalf("执行失败: %v", err)
+		}
+		id, _ := result.LastInsertId()
+		return int(id)
+	}
+	// 示例数据位于 1 号家族树，测试数据单独建树
+	userID := mustExec(`INSERT INTO users (username, email, password, full_name) VALUES ('stats', 'stats@example.com', 'x', '统计')`)
+	treeID := mustExec(`INSERT INTO user_family_trees (user_id, family_tree_name) VALUES (?, '统计测试')`, userID)
+	person := func(name, gender, birth, death, occupation string, fatherID, motherID interface{}) int {
+		var b, d interface{}
+		if birth != "" {
+			b = birth
+		}
+		if death != "" {
+			d = death
+		}
+		return mustExec(`INSERT INTO individuals (full_name, gender, birth_date, death_date, occupation, notes, father_id, mother_id, birth_place, family_tree_id)
+			VALUES (?, ?, ?, ?, ?, '', ?, ?, '北京', ?)`, name, gender, b, d, occupation, fatherID, motherID, treeID)
+	}
+
+	// 第 1 世：张大、王氏；第 2 世：张二（及其妻欧阳春，无父母记录）；第 3 世：张三（收养，只记在 children 表）
+	grandpa := person("张大", "male", "1900-01-01", "1980-01-01", "农民", nil, nil)
+	grandma := person("王氏", "female", "1902-06-01", "1962-06-01", "", nil, nil)
+	father := person("张二", "male", "1925-01-01", "", "教师", grandpa, grandma)
+	mother := person("欧阳春", "female", "1930-01-01 00:00:00 +0000 UTC", "", "教师", nil, nil)
+	child := person("张三", "male", "2001-05-01", "", "", nil, nil)
+
+	mustExec(`INSERT INTO families (husband_id, wife_id, marriage_date) VALUES (?, ?, '1920-01-01')`, grandpa, grandma)
+	family := mustExec(`INSERT INTO families (husband_id, wife_id, marriage_date) VALUES (?, ?, '1950-01-01')`, father, mother)
+	mustExec(`INSERT INTO children (family_id, individual_id, relationship_type) VALUES (?, ?, 'adopted')`, family, child)
+
+	stats, err := repo.GetTreeStatistics(ctx, treeID, 10)
+	if err != nil {
+		t.Fatalf("统计失败: %v", err)
+	}
+
+	if stats.Individuals != 5 || stats.Families != 2 || stats.Deceased != 2 || stats.Living != 3 {
+		t.Errorf("总数错误: %+v", stats)
+	}
+
+	wantGenerations := []models.GenerationStat{
+		{Generation: 1, Total: 2, Male: 1, Female: 1},
+		{Generation: 2, Total: 2, Male: 1, Female: 1},
+		{Generation: 3, Total: 1, Male: 1},
+	}
+	if len(stats.Generations) != len(wantGenerations) {
+		t.Fatalf("世代错误: %+v", stats.Generations)
+	}
+	for i, want := range wantGenerations {
+		if stats.Generations[i] != want {
+			t.Errorf("第 %d 世: got %+v, want %+v", i+1, stats.Generations[i], want)
+		}
+	}
+
+	if len(stats.LifespanByDecade) != 1 || stats.LifespanByDecade[0].Decade != 1900 ||
+		stats.LifespanByDecade[0].Count != 2 || stats.LifespanByDecade[0].Max != 80 || stats.LifespanByDecade[0].Min != 60 {
+		t.Errorf("寿命统计错误: %+v", stats.LifespanByDecade)
+	}
+
+	if len(stats.MarriageAge) != 2 || stats.MarriageAge[0].Gender != models.GenderFemale || stats.MarriageAge[0].Count != 2 {
+		t.Errorf("初婚年龄错误: %+v", stats.MarriageAge)
+	}
+	if len(stats.FirstChildAge) != 2 {
+		t.Errorf("生育年龄错误: %+v", stats.FirstChildAge)
+	}
+
+	if c := stats.ChildrenPerFamily; c.Families != 2 || c.Max != 1 || c.Average != 1 {
+		t.Errorf("子女数错误: %+v", c)
+	}
+
+	if len(stats.Surnames) != 3 || stats.Surnames[0] != (models.StatCount{Key: "张", Count: 3}) {
+		t.Errorf("姓氏错误: %+v", stats.Surnames)
+	}
+	foundCompound := false
+	for _, s := range stats.Surnames {
+		foundCompound = foundCompound || s.Key == "欧阳"
+	}
+	if !foundCompound {
+		t.Errorf("复姓未识别: %+v", stats.Surnames)
+	}
+	if len(stats.Occupations) != 2 || stats.Occupations[0] != (models.StatCount{Key: "教师", Count: 2}) {
+		t.Errorf("职业错误: %+v", stats.Occupations)
+	}
+	if len(stats.Centuries) != 3 || stats.Centuries[0] != (models.StatCount{Key: "19世纪", Count: 1}) || stats.Centuries[1].Count != 3 {
+		t.Errorf("世纪分布错误: %+v", stats.Centuries)
+	}
+
+	records := map[string]models.StatRecord{}
+	for _, rec := range stats.Records {
+		records[rec.Type] = rec
+	}
+	if records[models.RecordLongestLived].IndividualID != grandpa || records[models.RecordShortestLived].IndividualID != grandma {
+		t.Errorf("寿命纪录错误: %+v", stats.Records)
+	}
+	if records[models.RecordLatestBirth].IndividualID != child || records[models.RecordOldestLiving].IndividualID != father {
+		t.Errorf("出生纪录错误: %+v", stats.Records)
+	}
+}
@@ -0,0 +1,484 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"familytree/models"
+	"familytree/pkg/database"
+)
+
+// 回收站
+//
+// 删除个人或家庭时不删除记录，而是连同其子女关系、事件一起标记删除：deleted_at、deleted_by 记录删除时间和操作人，
+// trash_id 指向 trash 表中的这次删除。所有查询、世系遍历和闭包表都排除已标记删除的记录，
+// 其他记录对它们的引用（父母、配偶）保持不变，恢复时清除标记即可还原全部关系。清除时才真正删除记录
+
+// trashReference 恢复时必须存在的关联记录。live 为真时关联记录还不能在回收站中：
+// 子女关系和事件依附于个人、家庭，而父母、配偶在回收站中时关系只是暂时隐藏
+type trashReference struct {
+	column string
+	entity models.EntityType
+	live   bool
+}
+
+// trashReferences 各类记录引用的其他记录
+var trashReferences = map[models.EntityType][]trashReference{
+	models.EntityTypeIndividual: {{"father_id", models.EntityTypeIndividual, false}, {"mother_id", models.EntityTypeIndividual, false}},
+	models.EntityTypeFamily:     {{"husband_id", models.EntityTypeIndividual, false}, {"wife_id", models.EntityTypeIndividual, false}},
+	models.EntityTypeChild:      {{"family_id", models.EntityTypeFamily, true}, {"individual_id", models.EntityTypeIndividual, true}},
+	models.EntityTypeEvent:      {{"individual_id", models.EntityTypeIndividual, true}},
+}
+
+// trashDependent 随个人或家庭一起移入回收站的记录，查询参数为个人或家庭的ID
+type trashDependent struct {
+	entity models.EntityType
+	query  string
+}
+
+// trashDependents 个人的子女关系和事件，家庭的子女关系
+var trashDependents = map[models.EntityType][]trashDependent{
+	models.EntityTypeIndividual: {
+		{models.EntityTypeChild, `SELECT family_id, individual_id FROM children WHERE individual_id = ? AND deleted_at IS NULL`},
+		{models.EntityTypeEvent, `SELECT event_id FROM events WHERE individual_id = ? AND deleted_at IS NULL`},
+	},
+	models.EntityTypeFamily: {
+		{models.EntityTypeChild, `SELECT family_id, individual_id FROM children WHERE family_id = ? AND deleted_at IS NULL`},
+	},
+}
+
+// trashTables 回收站中的记录所在的表，恢复和清除时依次处理
+var trashTables = []string{"individuals", "families", "children", "events"}
+
+// trashRecordsQuery 一次删除中的全部记录，依次为个人、家庭、子女关系和事件，参数为 trash_id
+var trashRecordsQuery = fmt.Sprintf(`
+	SELECT '%s', CAST(individual_id AS TEXT) FROM individuals WHERE trash_id = ?1
+	UNION ALL SELECT '%s', CAST(family_id AS TEXT) FROM families WHERE trash_id = ?1
+	UNION ALL SELECT '%s', family_id || '/' || individual_id FROM children WHERE trash_id = ?1
+	UNION ALL SELECT '%s', CAST(event_id AS TEXT) FROM events WHERE trash_id = ?1`,
+	models.EntityTypeIndividual, models.EntityTypeFamily, models.EntityTypeChild, models.EntityTypeEvent)
+
+// trashRecords 把个人或家庭连同依附的记录移入回收站并记入变更历史
+func trashRecords(ctx context.Context, q sqlExecutor, audit auditor, target auditTarget) error {
+	targets := []auditTarget{target}
+	for _, dependent := range trashDependents[target.entity] {
+		dependents, err := auditTargets(ctx, q, dependent.entity, dependent.query, target.keys[0])
+		if err != nil {
+			return err
+		}
+		targets = append(targets, dependents...)
+	}
+	if err := audit.moveToTrash(ctx, q, targets...); err != nil {
+		return err
+	}
+	return audit.record(ctx, q, targets...)
+}
+
+// moveToTrash 新建回收站记录并标记删除各条记录，第一条为被删除的个人或家庭，其余为随之删除的记录
+func (a auditor) moveToTrash(ctx context.Context, q sqlExecutor, targets ...auditTarget) error {
+	if a.err != nil {
+		return a.err
+	}
+	main := targets[0]
+	if main.before == nil {
+		return nil
+	}
+	label, err := trashLabel(ctx, q, main)
+	if err != nil {
+		return err
+	}
+
+	deletedAt := time.Now()
+	result, err := q.ExecContext(ctx, `
+		INSERT INTO trash (family_tree_id, entity_type, entity_id, label, user_id, change_set, deleted_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, main.before.treeID, string(main.entity), auditEntityID(main.keys...), label, a.userID, a.changeSet, deletedAt)
+	if err != nil {
+		return fmt.Errorf("放入回收站失败: %v", err)
+	}
+	trashID, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("获取回收站记录ID失败: %v", err)
+	}
+
+	for _, t := range targets {
+		if t.before == nil {
+			continue
+		}
+		spec := auditSpecs[t.entity]
+		where, args := spec.where(t.keys)
+		query := fmt.Sprintf("UPDATE %s SET deleted_at = ?, deleted_by = ?, trash_id = ? WHERE %s AND deleted_at IS NULL", spec.table, where)
+		if _, err := q.ExecContext(ctx, query, append([]interface{}{deletedAt, a.userID, trashID}, args...)...); err != nil {
+			return fmt.Errorf("标记删除 %s 失败: %v", t.entity, err)
+		}
+	}
+	return nil
+}
+
+// trashLabel 回收站中显示的名称：个人的姓名，家庭的夫妻姓名
+func trashLabel(ctx context.Context, q sqlExecutor, target auditTarget) (string, error) {
+	data := target.before.data
+	if target.entity != models.EntityTypeFamily {
+		return restoreString(data["full_name"]), nil
+	}
+
+	var names []string
+	for _, column := range []string{"husband_id", "wife_id"} {
+		if data[column] == nil {
+			continue
+		}
+		var name string
+		err := q.QueryRowContext(ctx, `SELECT full_name FROM individuals WHERE individual_id = ?`, data[column]).Scan(&name)
+		if err != nil && err != sql.ErrNoRows {
+			return "", fmt.Errorf("查询配偶姓名失败: %v", err)
+		}
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Sprintf("家庭 %s", auditEntityID(target.keys...)), nil
+	}
+	return strings.Join(names, "与") + "的家庭", nil
+}
+
+// GetTrashItems 家族树回收站中的记录，最近删除的在前
+func (r *SQLiteRepository) GetTrashItems(ctx context.Context, familyTreeID, limit, offset int) ([]models.TrashItem, int, error) {
+	return r.getTrashItems(ctx, "t.family_tree_id = ?", []interface{}{familyTreeID}, limit, offset)
+}
+
+// GetTrashItem 根据ID获取回收站中的记录，不存在时返回 nil
+func (r *SQLiteRepository) GetTrashItem(ctx context.Context, trashID int) (*models.TrashItem, error) {
+	items, _, err := r.getTrashItems(ctx, "t.trash_id = ?", []interface{}{trashID}, 1, 0)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return &items[0], nil
+}
+
+// getTrashItems 按条件分页查询回收站
+func (r *SQLiteRepository) getTrashItems(ctx context.Context, where string, args []interface{}, limit, offset int) ([]models.TrashItem, int, error) {
+	var total int
+	if err := r.conn(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM trash t WHERE "+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("统计回收站记录失败: %v", err)
+	}
+
+	rows, err := r.conn(ctx).QueryContext(ctx, `
+		SELECT t.trash_id, t.family_tree_id, t.entity_type, t.entity_id, t.label,
+		       t.user_id, COALESCE(u.username, ''), t.change_set, t.deleted_at
+		FROM trash t LEFT JOIN users u ON u.user_id = t.user_id
+		WHERE `+where+`
+		ORDER BY t.trash_id DESC
+		LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询回收站失败: %v", err)
+	}
+	defer rows.Close()
+
+	items := []models.TrashItem{}
+	for rows.Next() {
+		var item models.TrashItem
+		var treeID, userID sql.NullInt64
+		var entityType string
+		if err := rows.Scan(&item.TrashID, &treeID, &entityType, &item.EntityID, &item.Label,
+			&userID, &item.DeletedByName, &item.ChangeSet, &item.DeletedAt); err != nil {
+			return nil, 0, fmt.Errorf("扫描回收站记录失败: %v", err)
+		}
+		item.EntityType = models.EntityType(entityType)
+		if treeID.Valid {
+			id := int(treeID.Int64)
+			item.FamilyTreeID = &id
+		}
+		if userID.Valid {
+			id := int(userID.Int64)
+			item.DeletedBy = &id
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	rows.Close()
+
+	for i := range items {
+		if items[i].Records, err = trashItemRecords(ctx, r.conn(ctx), items[i].TrashID); err != nil {
+			return nil, 0, err
+		}
+	}
+	return items, total, nil
+}
+
+// trashItemRecords 一次删除中仍在回收站中的记录
+func trashItemRecords(ctx context.Context, q sqlExecutor, trashID int) ([]models.TrashRecord, error) {
+	rows, err := q.QueryContext(ctx, trashRecordsQuery, trashID)
+	if err != nil {
+		return nil, fmt.Errorf("查询回收站中的记录失败: %v", err)
+	}
+	defer rows.Close()
+
+	records := []models.TrashRecord{}
+	for rows.Next() {
+		var record models.TrashRecord
+		var entityType string
+		if err := rows.Scan(&entityType, &record.EntityID); err != nil {
+			return nil, fmt.Errorf("扫描回收站中的记录失败: %v", err)
+		}
+		record.EntityType = models.EntityType(entityType)
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// RestoreTrashItem 在同一事务中清除回收站记录中各条记录的删除标记，恢复记入变更历史。
+// 子女关系或事件所属的个人、家庭仍在回收站中时返回冲突，不做任何修改
+func (r *SQLiteRepository) RestoreTrashItem(ctx context.Context, trashID int) ([]models.RevertConflict, error) {
+	item, err := r.GetTrashItem(ctx, trashID)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, fmt.Errorf("回收站记录不存在")
+	}
+
+	tx, err := database.Begin(ctx, r.db)
+	if err != nil {
+		return nil, fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	targets := make([]auditTarget, 0, len(item.Records))
+	for _, record := range item.Records {
+		spec := auditSpecs[record.EntityType]
+		keys, err := parseAuditEntityID(record.EntityID, len(spec.keys))
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, auditTarget{entity: record.EntityType, keys: keys})
+	}
+
+	// 按个人、家庭、子女关系、事件的顺序恢复，检查子女关系和事件时本次恢复的个人、家庭已不在回收站中
+	for _, table := range trashTables {
+		query := fmt.Sprintf("UPDATE %s SET deleted_at = NULL, deleted_by = NULL, trash_id = NULL WHERE trash_id = ?", table)
+		if _, err := tx.ExecContext(ctx, query, trashID); err != nil {
+			return nil, fmt.Errorf("恢复回收站中的记录失败: %v", err)
+		}
+	}
+	conflicts := []models.RevertConflict{}
+	for _, record := range item.Records {
+		data, err := trashReferenceValues(ctx, tx, record)
+		if err != nil {
+			return nil, err
+		}
+		missing, err := missingReferences(ctx, tx, record, data)
+		if err != nil {
+			return nil, err
+		}
+		conflicts = append(conflicts, missing...)
+	}
+	if len(conflicts) > 0 {
+		return conflicts, nil
+	}
+
+	if err := newAuditor(ctx).record(ctx, tx, targets...); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM trash WHERE trash_id = ?`, trashID); err != nil {
+		return nil, fmt.Errorf("删除回收站记录失败: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %v", err)
+	}
+	return conflicts, nil
+}
+
+// trashReferenceValues 读取记录中引用其他记录的字段
+func trashReferenceValues(ctx context.Context, q sqlExecutor, record models.TrashRecord) (map[string]interface{}, error) {
+	refs := trashReferences[record.EntityType]
+	spec := auditSpecs[record.EntityType]
+	keys, err := parseAuditEntityID(record.EntityID, len(spec.keys))
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]string, len(refs))
+	values := make([]interface{}, len(refs))
+	dest := make([]interface{}, len(refs))
+	for i, ref := range refs {
+		columns[i] = ref.column
+		dest[i] = &values[i]
+	}
+	where, args := spec.where(keys)
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s", strings.Join(columns, ", "), spec.table, where)
+	if err := q.QueryRowContext(ctx, query, args...).Scan(dest...); err != nil {
+		return nil, fmt.Errorf("读取关联记录失败: %v", err)
+	}
+	data := make(map[string]interface{}, len(refs))
+	for i, column := range columns {
+		data[column] = values[i]
+	}
+	return data, nil
+}
+
+// missingReferences 检查记录引用的个人、家庭是否存在，子女关系和事件引用的还不能在回收站中
+func missingReferences(ctx context.Context, q sqlExecutor, record models.TrashRecord, data map[string]interface{}) ([]models.RevertConflict, error) {
+	var conflicts []models.RevertConflict
+	for _, ref := range trashReferences[record.EntityType] {
+		value := data[ref.column]
+		if value == nil {
+			continue
+		}
+		spec := auditSpecs[ref.entity]
+		query := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE %s = ?", spec.table, spec.keys[0])
+		if ref.live {
+			query += " AND deleted_at IS NULL"
+		}
+		var exists bool
+		if err := q.QueryRowContext(ctx, query+")", restoreValue(value)).Scan(&exists); err != nil {
+			return nil, fmt.Errorf("检查关联记录失败: %v", err)
+		}
+		if !exists {
+			reason := "引用的记录已被永久删除"
+			if ref.live {
+				reason = "引用的记录已被删除，请先从回收站恢复"
+			}
+			conflicts = append(conflicts, models.RevertConflict{
+				EntityType: record.EntityType,
+				EntityID:   record.EntityID,
+				Field:      ref.column,
+				Expected:   value,
+				Reason:     reason,
+			})
+		}
+	}
+	return conflicts, nil
+}
+
+// undeleteRecord 清除回收站中一条记录的删除标记，记录不在回收站中时返回 false
+func undeleteRecord(ctx context.Context, q sqlExecutor, spec auditSpec, keys []int) (bool, error) {
+	where, args := spec.where(keys)
+	var trashID sql.NullInt64
+	query := fmt.Sprintf("SELECT trash_id FROM %s WHERE %s AND deleted_at IS NOT NULL", spec.table, where)
+	err := q.QueryRowContext(ctx, query, args...).Scan(&trashID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("查询回收站中的记录失败: %v", err)
+	}
+
+	query = fmt.Sprintf("UPDATE %s SET deleted_at = NULL, deleted_by = NULL, trash_id = NULL WHERE %s", spec.table, where)
+	if _, err := q.ExecContext(ctx, query, args...); err != nil {
+		return false, fmt.Errorf("恢复回收站中的记录失败: %v", err)
+	}
+	if trashID.Valid {
+		if err := dropRestoredTrash(ctx, q, trashID.Int64); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// dropRestoredTrash 回收站记录中的记录全部恢复后删除该回收站记录，还有记录未恢复时保留
+func dropRestoredTrash(ctx context.Context, q sqlExecutor, trashID int64) error {
+	_, err := q.ExecContext(ctx, `DELETE FROM trash WHERE trash_id = ?1 AND NOT EXISTS (`+trashRecordsQuery+`)`, trashID)
+	if err != nil {
+		return fmt.Errorf("删除回收站记录失败: %v", err)
+	}
+	return nil
+}
+
+// purgeStatements 永久删除一次删除中的记录：先去掉其他记录对被删除个人的引用，
+// 再删除依附于被删除个人、家庭的子女关系、事件和字号，最后删除记录本身，参数为 trash_id
+var purgeStatements = []string{
+	`UPDATE individuals SET father_id = NULL WHERE father_id IN (SELECT individual_id FROM individuals WHERE trash_id = ?1)`,
+	`UPDATE individuals SET mother_id = NULL WHERE mother_id IN (SELECT individual_id FROM individuals WHERE trash_id = ?1)`,
+	`UPDATE families SET husband_id = NULL WHERE husband_id IN (SELECT individual_id FROM individuals WHERE trash_id = ?1)`,
+	`UPDATE families SET wife_id = NULL WHERE wife_id IN (SELECT individual_id FROM individuals WHERE trash_id = ?1)`,
+	`UPDATE user_family_trees SET root_person_id = NULL WHERE root_person_id IN (SELECT individual_id FROM individuals WHERE trash_id = ?1)`,
+	`DELETE FROM children WHERE trash_id = ?1
+		OR family_id IN (SELECT family_id FROM families WHERE trash_id = ?1)
+		OR individual_id IN (SELECT individual_id FROM individuals WHERE trash_id = ?1)`,
+	`DELETE FROM events WHERE trash_id = ?1 OR individual_id IN (SELECT individual_id FROM individuals WHERE trash_id = ?1)`,
+	`DELETE FROM individual_names WHERE individual_id IN (SELECT individual_id FROM individuals WHERE trash_id = ?1)`,
+	`DELETE FROM families WHERE trash_id = ?1`,
+	`DELETE FROM individuals WHERE trash_id = ?1`,
+	`DELETE FROM trash WHERE trash_id = ?1`,
+}
+
+// purgeTrashItem 永久删除回收站记录及其中的记录，返回是否存在
+func purgeTrashItem(ctx context.Context, q sqlExecutor, trashID int) (bool, error) {
+	var exists bool
+	if err := q.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM trash WHERE trash_id = ?)`, trashID).Scan(&exists); err != nil {
+		return false, fmt.Errorf("查询回收站记录失败: %v", err)
+	}
+	if !exists {
+		return false, nil
+	}
+	for _, statement := range purgeStatements {
+		if _, err := q.ExecContext(ctx, statement, trashID); err != nil {
+			return false, fmt.Errorf("清除回收站记录失败: %v", err)
+		}
+	}
+	return true, nil
+}
+
+// PurgeTrashItem 从回收站中永久删除
+func (r *SQLiteRepository) PurgeTrashItem(ctx context.Context, trashID int) error {
+	tx, err := database.Begin(ctx, r.db)
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	exists, err := purgeTrashItem(ctx, tx, trashID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("回收站记录不存在")
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %v", err)
+	}
+	return nil
+}
+
+// PurgeTrash 永久删除在指定时间之前删除的记录，返回清除的条数
+func (r *SQLiteRepository) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	tx, err := database.Begin(ctx, r.db)
+	if err != nil {
+		return 0, fmt.Errorf("开始事务失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT trash_id FROM trash WHERE deleted_at < ?`, before)
+	if err != nil {
+		return 0, fmt.Errorf("查询过期回收站记录失败: %v", err)
+	}
+	var trashIDs []int
+	for rows.Next() {
+		var trashID int
+		if err := rows.Scan(&trashID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("扫描过期回收站记录失败: %v", err)
+		}
+		trashIDs = append(trashIDs, trashID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, trashID := range trashIDs {
+		if _, err := purgeTrashItem(ctx, tx, trashID); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("提交事务失败: %v", err)
+	}
+	return len(trashIDs), nil
+}
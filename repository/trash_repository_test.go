@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"familytree/models"
+	"familytree/pkg/middleware"
+)
+
+func TestTrash(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.WithValue(context.Background(), middleware.UserContextKey, &models.AuthContext{UserID: 7})
+
+	father, err := repo.CreateIndividual(ctx, &models.Individual{FullName: "王父", Gender: models.GenderMale})
+	if err != nil {
+		t.Fatalf("创建个人失败: %v", err)
+	}
+	son, err := repo.CreateIndividual(ctx, &models.Individual{FullName: "王子", Gender: models.GenderMale, FatherID: &father.IndividualID})
+	if err != nil {
+		t.Fatalf("创建个人失败: %v", err)
+	}
+	family, err := repo.CreateFamily(ctx, &models.Family{HusbandID: &father.IndividualID, MarriageOrder: 1})
+	if err != nil {
+		t.Fatalf("创建家庭失败: %v", err)
+	}
+	if _, err := repo.CreateChild(ctx, &models.Child{FamilyID: family.FamilyID, IndividualID: son.IndividualID}); err != nil {
+		t.Fatalf("添加子女失败: %v", err)
+	}
+	if _, err := repo.db.Exec(`INSERT INTO events (individual_id, event_type) VALUES (?, 'birth')`, son.IndividualID); err != nil {
+		t.Fatalf("添加事件失败: %v", err)
+	}
+
+	// 有子女、有家庭的父亲也可以删除，儿子和家庭仍指向他
+	if err := repo.DeleteIndividual(ctx, father.IndividualID); err != nil {
+		t.Fatalf("删除个人失败: %v", err)
+	}
+	if _, err := repo.GetIndividualByID(ctx, father.IndividualID); err == nil {
+		t.Error("删除的个人仍然可以查到")
+	}
+	current, err := repo.GetIndividualByID(ctx, son.IndividualID)
+	if err != nil || current.FatherID == nil || *current.FatherID != father.IndividualID {
+		t.Fatalf("删除父亲不应修改子女: %+v, %v", current, err)
+	}
+	if parent, _, _ := repo.GetParents(ctx, son.IndividualID); parent != nil {
+		t.Errorf("回收站中的父亲不应查到: %+v", parent)
+	}
+
+	// 再删除儿子（连同子女关系和事件）和家庭
+	if err := repo.DeleteIndividual(ctx, son.IndividualID); err != nil {
+		t.Fatalf("删除个人失败: %v", err)
+	}
+	if err := repo.DeleteFamily(ctx, family.FamilyID); err != nil {
+		t.Fatalf("删除家庭失败: %v", err)
+	}
+	if events, _ := repo.GetEventsByIndividualIDs(ctx, []int{son.IndividualID}); len(events) != 0 {
+		t.Errorf("回收站中的事件不应查到: %+v", events)
+	}
+
+	items, total, err := repo.GetTrashItems(ctx, 1, 10, 0)
+	if err != nil {
+		t.Fatalf("查询回收站失败: %v", err)
+	}
+	if total != 3 || items[0].Label != "王父的家庭" || items[1].Label != "王子" || items[2].Label != "王父" {
+		t.Fatalf("回收站: %d 条 %+v", total, items)
+	}
+	if records := items[1].Records; len(records) != 3 || records[0].EntityType != models.EntityTypeIndividual ||
+		records[1].EntityType != models.EntityTypeChild || records[2].EntityType != models.EntityTypeEvent {
+		t.Errorf("随个人删除的记录: %+v", records)
+	}
+	if items[0].DeletedBy == nil || *items[0].DeletedBy != 7 {
+		t.Errorf("删除人: %+v", items[0].DeletedBy)
+	}
+	familyItem, sonItem, fatherItem := items[0].TrashID, items[1].TrashID, items[2].TrashID
+
+	// 家庭仍在回收站中，儿子的子女关系不能恢复，整条记录都不恢复
+	conflicts, err := repo.RestoreTrashItem(ctx, sonItem)
+	if err != nil {
+		t.Fatalf("恢复失败: %v", err)
+	}
+	if len(conflicts) != 1 || conflicts[0].EntityType != models.EntityTypeChild || conflicts[0].Field != "family_id" {
+		t.Fatalf("冲突: %+v", conflicts)
+	}
+	if _, err := repo.GetIndividualByID(ctx, son.IndividualID); err == nil {
+		t.Error("有冲突时不应恢复")
+	}
+
+	for _, id := range []int{familyItem, sonItem, fatherItem} {
+		if conflicts, err := repo.RestoreTrashItem(ctx, id); err != nil || len(conflicts) != 0 {
+			t.Fatalf("恢复失败: %+v, %v", conflicts, err)
+		}
+	}
+	children, err := repo.GetIndividualsByParentID(ctx, father.IndividualID)
+	if err != nil || len(children) != 1 || children[0].IndividualID != son.IndividualID {
+		t.Errorf("恢复后的子女: %+v, %v", children, err)
+	}
+	if familyChildren, _ := repo.GetChildrenByFamilyID(ctx, family.FamilyID); len(familyChildren) != 1 {
+		t.Errorf("恢复后的家庭子女: %+v", familyChildren)
+	}
+	if events, _ := repo.GetEventsByIndividualIDs(ctx, []int{son.IndividualID}); len(events) != 1 {
+		t.Errorf("恢复后的事件: %+v", events)
+	}
+	if _, total, _ := repo.GetTrashItems(ctx, 1, 10, 0); total != 0 {
+		t.Errorf("恢复后回收站仍有 %d 条", total)
+	}
+
+	// 永久删除父亲后，子女和家庭不再指向他
+	if err := repo.DeleteIndividual(ctx, father.IndividualID); err != nil {
+		t.Fatalf("删除个人失败: %v", err)
+	}
+	items, _, _ = repo.GetTrashItems(ctx, 1, 10, 0)
+	if err := repo.PurgeTrashItem(ctx, items[0].TrashID); err != nil {
+		t.Fatalf("清除失败: %v", err)
+	}
+	if current, _ := repo.GetIndividualByID(ctx, son.IndividualID); current.FatherID != nil {
+		t.Errorf("清除后子女的父亲: %v", *current.FatherID)
+	}
+	if current, _ := repo.GetFamilyByID(ctx, family.FamilyID); current.HusbandID != nil {
+		t.Errorf("清除后家庭的丈夫: %v", *current.HusbandID)
+	}
+
+	// 过期清除连同子女关系和事件一起删除
+	if err := repo.DeleteIndividual(ctx, son.IndividualID); err != nil {
+		t.Fatalf("删除个人失败: %v", err)
+	}
+	if n, err := repo.PurgeTrash(ctx, time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Errorf("未过期的记录不应清除: %d, %v", n, err)
+	}
+	if n, err := repo.PurgeTrash(ctx, time.Now().Add(time.Second)); err != nil || n != 1 {
+		t.Errorf("过期清除: %d, %v", n, err)
+	}
+	var remaining int
+	if err := repo.db.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM individuals WHERE individual_id IN (?, ?))
+		     + (SELECT COUNT(*) FROM children WHERE individual_id = ?)
+		     + (SELECT COUNT(*) FROM events WHERE individual_id = ?)
+	`, father.IndividualID, son.IndividualID, son.IndividualID, son.IndividualID).Scan(&remaining); err != nil || remaining != 0 {
+		t.Errorf("清除后仍有 %d 条记录, %v", remaining, err)
+	}
+	if err := repo.PurgeTrashItem(ctx, sonItem); err == nil {
+		t.Error("清除不存在的回收站记录应当报错")
+	}
+}
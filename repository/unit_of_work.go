@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+
+	"familytree/pkg/database"
+)
+
+// 工作单元
+//
+// 服务层通过 WithinTransaction 把多步操作放进一个事务：事务保存在 ctx 中，
+// 所有数据访问方法都经由 conn、database.Stmt 和 database.Begin 使用它。
+// 方法内部原有的事务在工作单元中变为保存点，方法失败只撤销自己的修改，整体由工作单元提交或回滚。
+
+// WithinTransaction 在一个事务中执行 fn，fn 返回错误时其中的全部修改回滚
+func (r *SQLiteRepository) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return database.WithTransaction(ctx, r.db, fn)
+}
+
+// conn 当前工作单元的事务，不在工作单元中时使用连接池
+func (r *SQLiteRepository) conn(ctx context.Context) sqlExecutor {
+	return database.Conn(ctx, r.db)
+}
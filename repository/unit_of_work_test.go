@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	"familytree/models"
+)
+
+func TestWithinTransaction(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	father, err := repo.CreateIndividual(ctx, &models.Individual{FullName: "钱父", Gender: models.GenderMale})
+	if err != nil {
+		t.Fatalf("创建个人失败: %v", err)
+	}
+
+	// fn 返回错误时，其中各个方法的修改连同变更记录一起回滚
+	var sonID, familyID int
+	failure := errors.New("中途失败")
+	err = repo.WithinTransaction(ctx, func(ctx context.Context) error {
+		son, err := repo.CreateIndividual(ctx, &models.Individual{FullName: "钱子", Gender: models.GenderMale, FatherID: &father.IndividualID})
+		if err != nil {
+			return err
+		}
+		sonID = son.IndividualID
+		family, err := repo.CreateFamily(ctx, &models.Family{HusbandID: &father.IndividualID, MarriageOrder: 1})
+		if err != nil {
+			return err
+		}
+		familyID = family.FamilyID
+		// 事务中的读取能看到尚未提交的修改
+		children, err := repo.GetIndividualsByParentID(ctx, father.IndividualID)
+		if err != nil || len(children) != 1 {
+			t.Errorf("事务中的子女: %v %+v", err, children)
+		}
+		return failure
+	})
+	if err != failure {
+		t.Fatalf("事务返回: %v", err)
+	}
+	if _, err := repo.GetIndividualByID(ctx, sonID); err == nil {
+		t.Error("回滚后个人仍然存在")
+	}
+	if _, err := repo.GetFamilyByID(ctx, familyID); err == nil {
+		t.Error("回滚后家庭仍然存在")
+	}
+	entries, _, err := repo.GetAuditEntries(ctx, models.AuditQuery{EntityType: models.EntityTypeIndividual, EntityID: strconv.Itoa(sonID), Limit: 10})
+	if err != nil || len(entries) != 0 {
+		t.Errorf("回滚后的变更记录: %v %+v", err, entries)
+	}
+
+	// 方法内部失败只撤销到自己的保存点，已完成的修改随工作单元一起提交
+	err = repo.WithinTransaction(ctx, func(ctx context.Context) error {
+		son, err := repo.CreateIndividual(ctx, &models.Individual{FullName: "钱子", Gender: models.GenderMale, FatherID: &father.IndividualID})
+		if err != nil {
+			return err
+		}
+		sonID = son.IndividualID
+		stale := *father
+		stale.Version = 99
+		if _, err := repo.UpdateIndividual(ctx, father.IndividualID, &stale); err != models.ErrVersionConflict {
+			t.Errorf("过期版本更新: %v", err)
+		}
+		return repo.WithinTransaction(ctx, func(ctx context.Context) error {
+			_, err := repo.CreateFamily(ctx, &models.Family{HusbandID: &father.IndividualID, MarriageOrder: 1})
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatalf("事务失败: %v", err)
+	}
+	if _, err := repo.GetIndividualByID(ctx, sonID); err != nil {
+		t.Errorf("提交后个人不存在: %v", err)
+	}
+	families, err := repo.GetFamiliesByIndividualID(ctx, father.IndividualID)
+	if err != nil || len(families) != 1 {
+		t.Errorf("提交后的家庭: %v %+v", err, families)
+	}
+}
+
+func TestConcurrentWriteTransactions(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	father, err := repo.CreateIndividual(ctx, &models.Individual{FullName: "孙父", Gender: models.GenderMale})
+	if err != nil {
+		t.Fatalf("创建个人失败: %v", err)
+	}
+
+	// 多个事务同时先读后写，各自在不同连接上执行，都应等待锁而不是返回 SQLITE_BUSY
+	const writers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- repo.WithinTransaction(ctx, func(ctx context.Context) error {
+				if _, err := repo.GetIndividualsByParentID(ctx, father.IndividualID); err != nil {
+					return err
+				}
+				for j := 0; j < 5; j++ {
+					name := "孙子" + strconv.Itoa(i) + "-" + strconv.Itoa(j)
+					if _, err := repo.CreateIndividual(ctx, &models.Individual{FullName: name, Gender: models.GenderMale, FatherID: &father.IndividualID}); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("并发事务失败: %v", err)
+		}
+	}
+
+	children, err := repo.GetIndividualsByParentID(ctx, father.IndividualID)
+	if err != nil || len(children) != writers*5 {
+		t.Errorf("子女数: %v %d", err, len(children))
+	}
+}
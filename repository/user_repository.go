@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"familytree/models"
+	"familytree/pkg/database"
 )
 
 // UserRepository用户存储库方法 - 扩展SQLiteRepository
@@ -22,7 +23,7 @@ func (r *SQLiteRepository) CreateUser(ctx context.Context, user *models.User) (*
 	user.CreatedAt = now
 	user.UpdatedAt = now
 
-	result, err := r.db.ExecContext(ctx, query,
+	result, err := r.conn(ctx).ExecContext(ctx, query,
 		user.Username,
 		user.Email,
 		user.Password,
@@ -53,7 +54,7 @@ func (r *SQLiteRepository) GetUserByID(ctx context.Context, id int) (*models.Use
 	`
 
 	var user models.User
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
+	err := r.conn(ctx).QueryRowContext(ctx, query, id).Scan(
 		&user.UserID,
 		&user.Username,
 		&user.Email,
@@ -82,7 +83,7 @@ func (r *SQLiteRepository) GetUserByUsername(ctx context.Context, username strin
 	`
 
 	var user models.User
-	err := r.db.QueryRowContext(ctx, query, username).Scan(
+	err := r.conn(ctx).QueryRowContext(ctx, query, username).Scan(
 		&user.UserID,
 		&user.Username,
 		&user.Email,
@@ -111,7 +112,7 @@ func (r *SQLiteRepository) GetUserByEmail(ctx context.Context, email string) (*m
 	`
 
 	var user models.User
-	err := r.db.QueryRowContext(ctx, query, email).Scan(
+	err := r.conn(ctx).QueryRowContext(ctx, query, email).Scan(
 		&user.UserID,
 		&user.Username,
 		&user.Email,
@@ -142,7 +143,7 @@ func (r *SQLiteRepository) UpdateUser(ctx context.Context, id int, user *models.
 
 	user.UpdatedAt = time.Now()
 
-	result, err := r.db.ExecContext(ctx, query,
+	result, err := r.conn(ctx).ExecContext(ctx, query,
 		user.Username,
 		user.Email,
 		user.FullName,
@@ -175,7 +176,7 @@ func (r *SQLiteRepository) UpdatePassword(ctx context.Context, userID int, hashe
 		WHERE user_id = ?
 	`
 
-	result, err := r.db.ExecContext(ctx, query, hashedPassword, time.Now(), userID)
+	result, err := r.conn(ctx).ExecContext(ctx, query, hashedPassword, time.Now(), userID)
 	if err != nil {
 		return fmt.Errorf("更新密码失败: %v", err)
 	}
@@ -195,7 +196,7 @@ func (r *SQLiteRepository) UpdatePassword(ctx context.Context, userID int, hashe
 func (r *SQLiteRepository) DeleteUser(ctx context.Context, id int) error {
 	query := `DELETE FROM users WHERE user_id = ?`
 
-	result, err := r.db.ExecContext(ctx, query, id)
+	result, err := r.conn(ctx).ExecContext(ctx, query, id)
 	if err != nil {
 		return fmt.Errorf("删除用户失败: %v", err)
 	}
@@ -218,7 +219,7 @@ func (r *SQLiteRepository) CreateFamilyTree(ctx context.Context, familyTree *mod
 	// 如果设置为默认家族树，先取消其他家族树的默认状态
 	if familyTree.IsDefault {
 		updateQuery := `UPDATE user_family_trees SET is_default = 0 WHERE user_id = ?`
-		_, err := r.db.ExecContext(ctx, updateQuery, familyTree.UserID)
+		_, err := r.conn(ctx).ExecContext(ctx, updateQuery, familyTree.UserID)
 		if err != nil {
 			return nil, fmt.Errorf("更新默认家族树状态失败: %v", err)
 		}
@@ -233,7 +234,7 @@ func (r *SQLiteRepository) CreateFamilyTree(ctx context.Context, familyTree *mod
 	familyTree.CreatedAt = now
 	familyTree.UpdatedAt = now
 
-	result, err := r.db.ExecContext(ctx, query,
+	result, err := r.conn(ctx).ExecContext(ctx, query,
 		familyTree.UserID,
 		familyTree.FamilyTreeName,
 		familyTree.Description,
@@ -263,7 +264,7 @@ func (r *SQLiteRepository) GetFamilyTreeByID(ctx context.Context, id int) (*mode
 	`
 
 	var familyTree models.UserFamilyTree
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
+	err := r.conn(ctx).QueryRowContext(ctx, query, id).Scan(
 		&familyTree.FamilyTreeID,
 		&familyTree.UserID,
 		&familyTree.FamilyTreeName,
@@ -291,7 +292,7 @@ func (r *SQLiteRepository) GetUserFamilyTrees(ctx context.Context, userID int) (
 		ORDER BY is_default DESC, created_at DESC
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, userID)
+	rows, err := r.conn(ctx).QueryContext(ctx, query, userID)
 	if err != nil {
 		return nil, fmt.Errorf("查询用户家族树失败: %v", err)
 	}
@@ -327,7 +328,7 @@ func (r *SQLiteRepository) GetDefaultFamilyTree(ctx context.Context, userID int)
 	`
 
 	var familyTree models.UserFamilyTree
-	err := r.db.QueryRowContext(ctx, query, userID).Scan(
+	err := r.conn(ctx).QueryRowContext(ctx, query, userID).Scan(
 		&familyTree.FamilyTreeID,
 		&familyTree.UserID,
 		&familyTree.FamilyTreeName,
@@ -350,7 +351,7 @@ func (r *SQLiteRepository) GetDefaultFamilyTree(ctx context.Context, userID int)
 // SetDefaultFamilyTree 设置默认家族树
 func (r *SQLiteRepository) SetDefaultFamilyTree(ctx context.Context, userID int, familyTreeID int) error {
 	// 开始事务
-	tx, err := r.db.BeginTx(ctx, nil)
+	tx, err := database.Begin(ctx, r.db)
 	if err != nil {
 		return fmt.Errorf("开始事务失败: %v", err)
 	}
@@ -390,7 +391,7 @@ func (r *SQLiteRepository) UpdateFamilyTree(ctx context.Context, id int, familyT
 
 	familyTree.UpdatedAt = time.Now()
 
-	result, err := r.db.ExecContext(ctx, query,
+	result, err := r.conn(ctx).ExecContext(ctx, query,
 		familyTree.FamilyTreeName,
 		familyTree.Description,
 		familyTree.RootPersonID,
@@ -417,7 +418,7 @@ func (r *SQLiteRepository) UpdateFamilyTree(ctx context.Context, id int, familyT
 func (r *SQLiteRepository) DeleteFamilyTree(ctx context.Context, id int) error {
 	query := `DELETE FROM user_family_trees WHERE family_tree_id = ?`
 
-	result, err := r.db.ExecContext(ctx, query, id)
+	result, err := r.conn(ctx).ExecContext(ctx, query, id)
 	if err != nil {
 		return fmt.Errorf("删除家族树失败: %v", err)
 	}
@@ -0,0 +1,24 @@
+package services
+
+import (
+	"context"
+
+	"familytree/interfaces"
+	"familytree/models"
+	"familytree/pkg/errors"
+)
+
+// ownedFamilyTree 读取家族树并校验属于该用户
+func ownedFamilyTree(ctx context.Context, familyTreeRepo interfaces.FamilyTreeRepository, userID, familyTreeID int) (*models.UserFamilyTree, error) {
+	if familyTreeID <= 0 {
+		return nil, errors.New(errors.ErrCodeInvalidInput, "无效的家族树ID")
+	}
+	tree, err := familyTreeRepo.GetFamilyTreeByID(ctx, familyTreeID)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeNotFound, "家族树不存在")
+	}
+	if tree.UserID != userID {
+		return nil, errors.New(errors.ErrCodeForbidden, "无权访问该家族树")
+	}
+	return tree, nil
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"sort"
+
+	"familytree/models"
+	"familytree/pkg/errors"
+)
+
+// GetAlternateNames 获取个人的字、号
+func (s *IndividualService) GetAlternateNames(ctx context.Context, id int) (*models.AlternateNames, error) {
+	if _, err := s.repo.GetIndividualByID(ctx, id); err != nil {
+		return nil, err
+	}
+	names, err := s.repo.GetAlternateNames(ctx, []int{id})
+	if err != nil {
+		return nil, err
+	}
+	result := names[id]
+	return &result, nil
+}
+
+// UpdateAlternateNames 更新个人的字、号，留空表示删除。字号属于个人，version 与个人的版本比较
+func (s *IndividualService) UpdateAlternateNames(ctx context.Context, id int, names *models.AlternateNames, version *int) (*models.AlternateNames, error) {
+	if names == nil {
+		return nil, errors.New(errors.ErrCodeInvalidInput, "缺少字号信息")
+	}
+	return inTransaction(ctx, s.uow, func(ctx context.Context) (*models.AlternateNames, error) {
+		individual, err := s.repo.GetIndividualByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkVersion(version, individual.Version); err != nil {
+			return nil, err
+		}
+		if err := s.repo.SetAlternateNames(ctx, id, *names); err != nil {
+			return nil, err
+		}
+		return s.GetAlternateNames(ctx, id)
+	})
+}
+
+// attachAlternateNames 为已加载的个人批量填充字、号
+func (s *IndividualService) attachAlternateNames(ctx context.Context, people map[int]models.Individual) error {
+	ids := make([]int, 0, len(people))
+	for id := range people {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	names, err := s.repo.GetAlternateNames(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for id, n := range names {
+		person := people[id]
+		if n.CourtesyName != "" {
+			courtesy := n.CourtesyName
+			person.CourtesyName = &courtesy
+		}
+		if n.ArtName != "" {
+			art := n.ArtName
+			person.ArtName = &art
+		}
+		people[id] = person
+	}
+	return nil
+}
@@ -0,0 +1,418 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"familytree/interfaces"
+	"familytree/models"
+	"familytree/pkg/errors"
+	"familytree/repository"
+)
+
+// maxBatchOperations 一次批量请求的最大操作数
+const maxBatchOperations = 500
+
+// BatchService 批量操作服务
+type BatchService struct {
+	individualService interfaces.IndividualService
+	familyService     interfaces.FamilyService
+	individualRepo    interfaces.IndividualRepository
+	ownershipRepo     interfaces.OwnershipRepository
+	familyTreeRepo    interfaces.FamilyTreeRepository
+	uow               interfaces.UnitOfWork
+	cache             *repository.CacheRepository
+}
+
+// NewBatchService 创建批量操作服务。individualService 应是不带缓存的服务，
+// 批量操作在事务提交后统一清除涉及的个人缓存；cache 为 nil 表示未启用缓存
+func NewBatchService(individualService interfaces.IndividualService, familyService interfaces.FamilyService, individualRepo interfaces.IndividualRepository,
+	ownershipRepo interfaces.OwnershipRepository, familyTreeRepo interfaces.FamilyTreeRepository, uow interfaces.UnitOfWork,
+	cache *repository.CacheRepository) interfaces.BatchService {
+	return &BatchService{
+		cache:             cache,
+		individualService: individualService,
+		familyService:     familyService,
+		individualRepo:    individualRepo,
+		ownershipRepo:     ownershipRepo,
+		familyTreeRepo:    familyTreeRepo,
+		uow:               uow,
+	}
+}
+
+// Execute 按顺序在同一事务中执行批量操作，任一步失败时全部回滚，错误信息指出失败的是第几步。
+// 操作引用的个人和家庭都必须属于该用户的家族树，本批中创建的记录除外
+func (s *BatchService) Execute(ctx context.Context, userID int, req *models.BatchRequest) (*models.BatchResult, error) {
+	if len(req.Operations) == 0 {
+		return nil, errors.New(errors.ErrCodeInvalidInput, "没有要执行的操作")
+	}
+	if len(req.Operations) > maxBatchOperations {
+		return nil, errors.New(errors.ErrCodeInvalidInput, fmt.Sprintf("一次最多执行 %d 个操作", maxBatchOperations))
+	}
+
+	access := &batchAccess{service: s, userID: userID, records: map[batchRecord]bool{}, trees: map[int]bool{}, touched: map[int]bool{}}
+	result, err := inTransaction(ctx, s.uow, func(ctx context.Context) (*models.BatchResult, error) {
+		result := &models.BatchResult{
+			IDs:     make(map[string]int),
+			Results: make([]models.BatchOperationResult, 0, len(req.Operations)),
+		}
+		for i, op := range req.Operations {
+			if op.TempID != "" {
+				if op.Op != models.BatchOpCreate && !(op.Op == models.BatchOpLink && op.Type == models.BatchTypeSpouse) {
+					return nil, batchError(i, op, errors.New(errors.ErrCodeInvalidInput, "只有创建个人、家庭或配偶关系时可以指定临时ID"))
+				}
+				if _, exists := result.IDs[op.TempID]; exists {
+					return nil, batchError(i, op, errors.New(errors.ErrCodeInvalidInput, fmt.Sprintf("临时ID %q 重复", op.TempID)))
+				}
+			}
+
+			id, err := s.execute(ctx, access, op, result.IDs)
+			if err != nil {
+				return nil, batchError(i, op, err)
+			}
+			if op.TempID != "" {
+				result.IDs[op.TempID] = id
+			}
+			result.Results = append(result.Results, models.BatchOperationResult{
+				Index:  i,
+				Op:     op.Op,
+				Type:   op.Type,
+				TempID: op.TempID,
+				ID:     id,
+			})
+		}
+		return result, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 事务提交后再清除缓存，避免其他请求在提交前把旧数据重新写入缓存
+	for id := range access.touched {
+		invalidateIndividualCache(ctx, s.cache, id)
+	}
+	return result, nil
+}
+
+// execute 执行一步操作，返回其记录ID
+func (s *BatchService) execute(ctx context.Context, access *batchAccess, op models.BatchOperation, ids map[string]int) (int, error) {
+	switch op.Op + " " + op.Type {
+	case models.BatchOpCreate + " " + models.BatchTypeIndividual:
+		var req models.CreateIndividualRequest
+		if err := decodeBatchData(op.Data, ids, &req); err != nil {
+			return 0, err
+		}
+		if err := access.check(ctx, models.EntityTypeIndividual, req.FatherID, req.MotherID); err != nil {
+			return 0, err
+		}
+		individual, err := s.individualService.CreateForUser(ctx, access.userID, &req)
+		if err != nil {
+			return 0, err
+		}
+		access.created(models.EntityTypeIndividual, individual.IndividualID)
+		access.touch(req.FatherID, req.MotherID)
+		return individual.IndividualID, nil
+
+	case models.BatchOpUpdate + " " + models.BatchTypeIndividual:
+		id, err := resolveBatchID(op.ID, ids)
+		if err != nil {
+			return 0, err
+		}
+		var req models.UpdateIndividualRequest
+		if err := decodeBatchData(op.Data, ids, &req); err != nil {
+			return 0, err
+		}
+		if err := access.check(ctx, models.EntityTypeIndividual, &id, req.FatherID, req.MotherID); err != nil {
+			return 0, err
+		}
+		if _, err := s.individualService.Update(ctx, id, &req); err != nil {
+			return 0, err
+		}
+		access.touch(&id, req.FatherID, req.MotherID)
+		return id, nil
+
+	case models.BatchOpDelete + " " + models.BatchTypeIndividual:
+		id, err := resolveBatchID(op.ID, ids)
+		if err != nil {
+			return 0, err
+		}
+		if err := access.check(ctx, models.EntityTypeIndividual, &id); err != nil {
+			return 0, err
+		}
+		access.touch(&id)
+		return id, s.individualService.Delete(ctx, id, nil)
+
+	case models.BatchOpCreate + " " + models.BatchTypeFamily:
+		var req models.CreateFamilyRequest
+		if err := decodeBatchData(op.Data, ids, &req); err != nil {
+			return 0, err
+		}
+		if err := access.check(ctx, models.EntityTypeIndividual, req.HusbandID, req.WifeID); err != nil {
+			return 0, err
+		}
+		family, err := s.familyService.CreateFamily(ctx, &req)
+		if err != nil {
+			return 0, err
+		}
+		access.created(models.EntityTypeFamily, family.FamilyID)
+		access.touch(req.HusbandID, req.WifeID)
+		return family.FamilyID, nil
+
+	case models.BatchOpUpdate + " " + models.BatchTypeFamily:
+		id, err := resolveBatchID(op.ID, ids)
+		if err != nil {
+			return 0, err
+		}
+		var req models.CreateFamilyRequest
+		if err := decodeBatchData(op.Data, ids, &req); err != nil {
+			return 0, err
+		}
+		if err := access.check(ctx, models.EntityTypeFamily, &id); err != nil {
+			return 0, err
+		}
+		if err := access.check(ctx, models.EntityTypeIndividual, req.HusbandID, req.WifeID); err != nil {
+			return 0, err
+		}
+		if err := access.touchFamily(ctx, id); err != nil {
+			return 0, err
+		}
+		if _, err := s.familyService.Update(ctx, id, &req); err != nil {
+			return 0, err
+		}
+		access.touch(req.HusbandID, req.WifeID)
+		return id, nil
+
+	case models.BatchOpDelete + " " + models.BatchTypeFamily:
+		id, err := resolveBatchID(op.ID, ids)
+		if err != nil {
+			return 0, err
+		}
+		if err := access.check(ctx, models.EntityTypeFamily, &id); err != nil {
+			return 0, err
+		}
+		if err := access.touchFamily(ctx, id); err != nil {
+			return 0, err
+		}
+		return id, s.familyService.Delete(ctx, id, nil)
+
+	case models.BatchOpLink + " " + models.BatchTypeSpouse:
+		var link models.BatchLink
+		if err := decodeBatchData(op.Data, ids, &link); err != nil {
+			return 0, err
+		}
+		if err := access.check(ctx, models.EntityTypeIndividual, &link.IndividualID, &link.SpouseID); err != nil {
+			return 0, err
+		}
+		family, err := s.familyService.AddSpouse(ctx, link.IndividualID, link.SpouseID)
+		if err != nil {
+			return 0, err
+		}
+		access.created(models.EntityTypeFamily, family.FamilyID)
+		access.touch(&link.IndividualID, &link.SpouseID)
+		return family.FamilyID, nil
+
+	case models.BatchOpLink + " " + models.BatchTypeChild:
+		var link models.BatchLink
+		if err := decodeBatchData(op.Data, ids, &link); err != nil {
+			return 0, err
+		}
+		if err := access.check(ctx, models.EntityTypeFamily, &link.FamilyID); err != nil {
+			return 0, err
+		}
+		if err := access.check(ctx, models.EntityTypeIndividual, &link.ChildID); err != nil {
+			return 0, err
+		}
+		return link.ChildID, s.linkChild(ctx, access, link)
+	}
+	return 0, errors.New(errors.ErrCodeInvalidInput, fmt.Sprintf("不支持的操作 %q %q", op.Op, op.Type))
+}
+
+// linkChild 把子女加入家庭，子女的父亲或母亲为空时设为该家庭的丈夫或妻子
+func (s *BatchService) linkChild(ctx context.Context, access *batchAccess, link models.BatchLink) error {
+	if err := s.familyService.AddChild(ctx, link.FamilyID, link.ChildID, link.Relationship); err != nil {
+		return err
+	}
+	family, err := s.familyService.GetByID(ctx, link.FamilyID)
+	if err != nil {
+		return err
+	}
+	access.touch(&link.ChildID, family.HusbandID, family.WifeID)
+	child, err := s.individualRepo.GetIndividualByID(ctx, link.ChildID)
+	if err != nil {
+		return errors.Wrap(err, errors.ErrCodeNotFound, "子女信息不存在")
+	}
+
+	var req models.UpdateIndividualRequest
+	if child.FatherID == nil && family.HusbandID != nil {
+		req.FatherID = family.HusbandID
+	}
+	if child.MotherID == nil && family.WifeID != nil {
+		req.MotherID = family.WifeID
+	}
+	if req.FatherID == nil && req.MotherID == nil {
+		return nil
+	}
+	// 家庭的归属以丈夫为准，妻子可能属于其他家族树
+	if err := access.check(ctx, models.EntityTypeIndividual, req.FatherID, req.MotherID); err != nil {
+		return err
+	}
+	_, err = s.individualService.Update(ctx, link.ChildID, &req)
+	return err
+}
+
+// batchRecord 批量操作引用的一条个人或家庭记录
+type batchRecord struct {
+	entity models.EntityType
+	id     int
+}
+
+// batchAccess 记录已校验的记录和家族树，同一批中重复引用时不再查询
+type batchAccess struct {
+	service *BatchService
+	userID  int
+	records map[batchRecord]bool
+	trees   map[int]bool
+	touched map[int]bool // 本批修改过的个人，提交后清除其缓存
+}
+
+// touch 记下被修改的个人；nil 或 0 表示未填写
+func (a *batchAccess) touch(ids ...*int) {
+	for _, id := range ids {
+		if id != nil && *id > 0 {
+			a.touched[*id] = true
+		}
+	}
+}
+
+// touchFamily 记下家庭修改前的丈夫和妻子
+func (a *batchAccess) touchFamily(ctx context.Context, familyID int) error {
+	family, err := a.service.familyService.GetByID(ctx, familyID)
+	if err != nil {
+		return err
+	}
+	a.touch(family.HusbandID, family.WifeID)
+	return nil
+}
+
+// created 本批创建的记录属于该用户，之后引用时无需校验
+func (a *batchAccess) created(entity models.EntityType, id int) {
+	a.records[batchRecord{entity, id}] = true
+}
+
+// check 校验记录都属于该用户的家族树；nil 或 0 表示未填写，留给各操作自己校验
+func (a *batchAccess) check(ctx context.Context, entity models.EntityType, ids ...*int) error {
+	var pending []int
+	for _, id := range ids {
+		if id != nil && *id > 0 && !a.records[batchRecord{entity, *id}] {
+			pending = append(pending, *id)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	trees, err := a.service.ownershipRepo.GetOwningTreeIDs(ctx, entity, pending)
+	if err != nil {
+		return errors.Wrap(err, errors.ErrCodeInternalError, "查询所属家族树失败")
+	}
+	for _, id := range pending {
+		treeID, ok := trees[id]
+		if !ok {
+			return batchForbidden(entity, id)
+		}
+		if !a.trees[treeID] {
+			if _, err := ownedFamilyTree(ctx, a.service.familyTreeRepo, a.userID, treeID); err != nil {
+				return batchForbidden(entity, id)
+			}
+			a.trees[treeID] = true
+		}
+		a.records[batchRecord{entity, id}] = true
+	}
+	return nil
+}
+
+// batchForbidden 记录不存在与不属于该用户时返回同一错误，不透露其他用户的记录是否存在
+func batchForbidden(entity models.EntityType, id int) error {
+	name := "个人"
+	if entity == models.EntityTypeFamily {
+		name = "家庭"
+	}
+	return errors.New(errors.ErrCodeForbidden, fmt.Sprintf("无权修改%s %d", name, id))
+}
+
+// resolveBatchID 解析操作的记录ID：数字，或引用之前创建的记录的 "$临时ID"
+func resolveBatchID(raw json.RawMessage, ids map[string]int) (int, error) {
+	if len(raw) == 0 {
+		return 0, errors.New(errors.ErrCodeInvalidInput, "缺少记录ID")
+	}
+	var ref string
+	if err := json.Unmarshal(raw, &ref); err == nil {
+		return resolveTempID(ref, ids)
+	}
+	var id int
+	if err := json.Unmarshal(raw, &id); err != nil || id <= 0 {
+		return 0, errors.ErrInvalidID
+	}
+	return id, nil
+}
+
+// resolveTempID 查找 "$临时ID" 对应的实际ID，只能引用之前的操作创建的记录
+func resolveTempID(ref string, ids map[string]int) (int, error) {
+	name, ok := strings.CutPrefix(ref, "$")
+	if !ok {
+		return 0, errors.New(errors.ErrCodeInvalidInput, fmt.Sprintf("无效的记录ID %q，临时ID须以 $ 开头", ref))
+	}
+	id, ok := ids[name]
+	if !ok {
+		return 0, errors.New(errors.ErrCodeInvalidInput, fmt.Sprintf("临时ID %q 未在之前的操作中定义", name))
+	}
+	return id, nil
+}
+
+// decodeBatchData 把 data 中 id 及以 _id 结尾的字段里的 "$临时ID" 替换为实际ID，再解析到 v
+func decodeBatchData(data json.RawMessage, ids map[string]int, v interface{}) error {
+	if len(data) == 0 {
+		return errors.New(errors.ErrCodeInvalidInput, "缺少 data")
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var fields map[string]interface{}
+	if err := decoder.Decode(&fields); err != nil {
+		return errors.New(errors.ErrCodeInvalidInput, "无效的 data", err.Error())
+	}
+	for key, value := range fields {
+		ref, ok := value.(string)
+		if !ok || (key != "id" && !strings.HasSuffix(key, "_id")) {
+			continue
+		}
+		id, err := resolveTempID(ref, ids)
+		if err != nil {
+			return err
+		}
+		fields[key] = id
+	}
+
+	resolved, err := json.Marshal(fields)
+	if err != nil {
+		return errors.Wrap(err, errors.ErrCodeInternalError, "处理 data 失败")
+	}
+	if err := json.Unmarshal(resolved, v); err != nil {
+		return errors.New(errors.ErrCodeInvalidInput, "无效的 data", err.Error())
+	}
+	return nil
+}
+
+// batchError 在错误信息前注明失败的操作，保留原错误码。不是应用错误的按内部错误返回，
+// 信息中只有失败的是第几步，原错误写入日志
+func batchError(index int, op models.BatchOperation, err error) error {
+	prefix := fmt.Sprintf("operations[%d]（%s %s）失败", index, op.Op, op.Type)
+	if appErr, ok := err.(*errors.AppError); ok {
+		return errors.New(appErr.Code, prefix+": "+appErr.Message, appErr.Details)
+	}
+	log.Printf("批量操作 %s: %v", prefix, err)
+	return errors.New(errors.ErrCodeInternalError, prefix)
+}
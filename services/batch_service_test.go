@@ -0,0 +1,225 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"familytree/interfaces"
+	"familytree/models"
+	"familytree/pkg/errors"
+	"familytree/repository"
+)
+
+func TestMain(m *testing.M) {
+	// 初始化脚本按相对路径 sql/init.sql 读取，需要在项目根目录运行
+	if err := os.Chdir(".."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// newTestRepository 在临时目录中创建测试数据库，示例数据属于 1 号用户的 1 号家族树
+func newTestRepository(tb testing.TB) *repository.SQLiteRepository {
+	tb.Helper()
+	repo, err := repository.NewSQLiteRepository(filepath.Join(tb.TempDir(), "test.db"))
+	if err != nil {
+		tb.Fatalf("创建测试数据库失败: %v", err)
+	}
+	tb.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+// newTestTree 创建另一个用户及其家族树
+func newTestTree(tb testing.TB, repo *repository.SQLiteRepository, username string) (userID, familyTreeID int) {
+	tb.Helper()
+	ctx := context.Background()
+	user, err := repo.CreateUser(ctx, &models.User{Username: username, Email: username + "@example.com", Password: "x", IsActive: true})
+	if err != nil {
+		tb.Fatalf("创建用户失败: %v", err)
+	}
+	tree, err := repo.CreateFamilyTree(ctx, &models.UserFamilyTree{UserID: user.UserID, FamilyTreeName: username})
+	if err != nil {
+		tb.Fatalf("创建家族树失败: %v", err)
+	}
+	return user.UserID, tree.FamilyTreeID
+}
+
+func newTestBatchService(repo *repository.SQLiteRepository) interfaces.BatchService {
+	individualService := NewIndividualService(repo, repo, repo)
+	return NewBatchService(individualService, NewFamilyService(repo, repo, repo), repo, repo, repo, repo, nil)
+}
+
+// batchOps 按 JSON 编写操作列表
+func batchOps(tb testing.TB, raw string) *models.BatchRequest {
+	tb.Helper()
+	var req models.BatchRequest
+	if err := json.Unmarshal([]byte(raw), &req); err != nil {
+		tb.Fatalf("解析操作失败: %v", err)
+	}
+	return &req
+}
+
+// treeSize 家族树中的人数
+func treeSize(tb testing.TB, repo *repository.SQLiteRepository, familyTreeID int) int {
+	tb.Helper()
+	people, err := repo.GetIndividualsByFamilyTreeID(context.Background(), familyTreeID)
+	if err != nil {
+		tb.Fatalf("查询家族树成员失败: %v", err)
+	}
+	return len(people)
+}
+
+func TestBatchTempIDs(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+	service := newTestBatchService(repo)
+
+	result, err := service.Execute(ctx, 1, batchOps(t, `{"operations": [
+		{"op": "create", "type": "individual", "temp_id": "father", "data": {"full_name": "张三", "gender": "male"}},
+		{"op": "create", "type": "individual", "temp_id": "mother", "data": {"full_name": "李氏", "gender": "female"}},
+		{"op": "link", "type": "spouse", "temp_id": "family", "data": {"individual_id": "$father", "spouse_id": "$mother"}},
+		{"op": "create", "type": "individual", "temp_id": "son", "data": {"full_name": "张四", "gender": "male", "father_id": "$father", "mother_id": "$mother"}},
+		{"op": "update", "type": "individual", "id": "$son", "data": {"occupation": "教师"}}
+	]}`))
+	if err != nil {
+		t.Fatalf("批量操作失败: %v", err)
+	}
+	if len(result.IDs) != 4 || len(result.Results) != 5 {
+		t.Fatalf("临时ID %v，结果 %+v", result.IDs, result.Results)
+	}
+	if result.Results[4].ID != result.IDs["son"] {
+		t.Errorf("修改的应是 $son: %+v", result.Results[4])
+	}
+
+	son, err := repo.GetIndividualByID(ctx, result.IDs["son"])
+	if err != nil {
+		t.Fatalf("查询子女失败: %v", err)
+	}
+	if son.FatherID == nil || *son.FatherID != result.IDs["father"] || son.MotherID == nil || *son.MotherID != result.IDs["mother"] {
+		t.Errorf("父母应解析为新建的个人: %+v", son)
+	}
+	if son.Occupation != "教师" {
+		t.Errorf("修改未生效: %q", son.Occupation)
+	}
+	family, err := repo.GetFamilyByID(ctx, result.IDs["family"])
+	if err != nil || family.HusbandID == nil || *family.HusbandID != result.IDs["father"] || *family.WifeID != result.IDs["mother"] {
+		t.Errorf("家庭的夫妻应为新建的个人: %+v %v", family, err)
+	}
+}
+
+func TestBatchUnknownRef(t *testing.T) {
+	repo := newTestRepository(t)
+	service := newTestBatchService(repo)
+	before := treeSize(t, repo, 1)
+
+	tests := []struct {
+		name string
+		ops  string
+	}{
+		{"未定义", `{"operations": [
+			{"op": "create", "type": "individual", "temp_id": "a", "data": {"full_name": "张三", "gender": "male"}},
+			{"op": "create", "type": "individual", "data": {"full_name": "张四", "gender": "male", "father_id": "$nobody"}}
+		]}`},
+		{"引用之后的操作", `{"operations": [
+			{"op": "create", "type": "individual", "temp_id": "a", "data": {"full_name": "张三", "gender": "male"}},
+			{"op": "update", "type": "individual", "id": "$b", "data": {"occupation": "农民"}},
+			{"op": "create", "type": "individual", "temp_id": "b", "data": {"full_name": "张四", "gender": "male"}}
+		]}`},
+		{"缺少 $", `{"operations": [
+			{"op": "create", "type": "individual", "temp_id": "a", "data": {"full_name": "张三", "gender": "male"}},
+			{"op": "delete", "type": "individual", "id": "a"}
+		]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.Execute(context.Background(), 1, batchOps(t, tt.ops))
+			appErr, ok := err.(*errors.AppError)
+			if !ok || appErr.Code != errors.ErrCodeInvalidInput {
+				t.Fatalf("应返回输入错误: %v", err)
+			}
+			if !strings.HasPrefix(appErr.Message, "operations[1]") {
+				t.Errorf("错误应指出第 2 步: %q", appErr.Message)
+			}
+			if size := treeSize(t, repo, 1); size != before {
+				t.Errorf("失败的批量操作应全部回滚: %d -> %d", before, size)
+			}
+		})
+	}
+}
+
+func TestBatchRollback(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+	service := newTestBatchService(repo)
+	before := treeSize(t, repo, 1)
+	original, err := repo.GetIndividualByID(ctx, 1)
+	if err != nil {
+		t.Fatalf("查询个人失败: %v", err)
+	}
+
+	// 第 3 步姓名为空，服务层返回的不是应用错误
+	_, err = service.Execute(ctx, 1, batchOps(t, `{"operations": [
+		{"op": "create", "type": "individual", "temp_id": "a", "data": {"full_name": "张三", "gender": "male"}},
+		{"op": "update", "type": "individual", "id": 1, "data": {"occupation": "回滚前的修改"}},
+		{"op": "create", "type": "individual", "data": {"full_name": "", "gender": "male", "father_id": "$a"}}
+	]}`))
+	appErr, ok := err.(*errors.AppError)
+	if !ok || appErr.Code != errors.ErrCodeInternalError {
+		t.Fatalf("应返回内部错误: %v", err)
+	}
+	if appErr.Message != "operations[2]（create individual）失败" || appErr.Details != "" {
+		t.Errorf("内部错误只应注明失败的操作: %+v", appErr)
+	}
+
+	if size := treeSize(t, repo, 1); size != before {
+		t.Errorf("第 1 步创建的个人应回滚: %d -> %d", before, size)
+	}
+	current, err := repo.GetIndividualByID(ctx, 1)
+	if err != nil {
+		t.Fatalf("查询个人失败: %v", err)
+	}
+	if current.Occupation != original.Occupation || current.Version != original.Version {
+		t.Errorf("第 2 步的修改应回滚: %q -> %q", original.Occupation, current.Occupation)
+	}
+}
+
+func TestBatchOwnership(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+	service := newTestBatchService(repo)
+	userID, treeID := newTestTree(t, repo, "batch")
+	own, err := repo.CreateIndividualInTree(ctx, userID, treeID, &models.Individual{FullName: "王五", Gender: models.GenderMale})
+	if err != nil {
+		t.Fatalf("创建个人失败: %v", err)
+	}
+
+	// 示例数据属于 1 号用户，其他用户不能通过任何字段引用
+	for _, ops := range []string{
+		`{"operations": [{"op": "update", "type": "individual", "id": 1, "data": {"occupation": "x"}}]}`,
+		`{"operations": [{"op": "delete", "type": "family", "id": 1}]}`,
+		`{"operations": [{"op": "link", "type": "spouse", "data": {"individual_id": ` + strconv.Itoa(own.IndividualID) + `, "spouse_id": 2}}]}`,
+		`{"operations": [{"op": "link", "type": "child", "data": {"family_id": 1, "child_id": ` + strconv.Itoa(own.IndividualID) + `}}]}`,
+		`{"operations": [{"op": "update", "type": "individual", "id": ` + strconv.Itoa(own.IndividualID) + `, "data": {"father_id": 1}}]}`,
+		`{"operations": [{"op": "update", "type": "individual", "id": 999999, "data": {"occupation": "x"}}]}`,
+	} {
+		_, err := service.Execute(ctx, userID, batchOps(t, ops))
+		if appErr, ok := err.(*errors.AppError); !ok || appErr.Code != errors.ErrCodeForbidden {
+			t.Errorf("%s: 应拒绝访问，得到 %v", ops, err)
+		}
+	}
+
+	// 自己家族树中的记录和本批创建的记录可以修改
+	result, err := service.Execute(ctx, userID, batchOps(t, `{"operations": [
+		{"op": "update", "type": "individual", "id": `+strconv.Itoa(own.IndividualID)+`, "data": {"occupation": "医生"}},
+		{"op": "create", "type": "individual", "temp_id": "wife", "data": {"full_name": "赵氏", "gender": "female"}},
+		{"op": "link", "type": "spouse", "data": {"individual_id": `+strconv.Itoa(own.IndividualID)+`, "spouse_id": "$wife"}}
+	]}`))
+	if err != nil || len(result.Results) != 3 {
+		t.Fatalf("应允许修改自己的记录: %v", err)
+	}
+}
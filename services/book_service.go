@@ -0,0 +1,366 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"familytree/interfaces"
+	"familytree/models"
+	"familytree/pkg/book"
+	"familytree/pkg/errors"
+	"familytree/pkg/workerpool"
+)
+
+const (
+	// defaultBookGenerations 默认收录的后代代数
+	defaultBookGenerations = 10
+	// bookBuildTimeout 单本书的生成时限，照片较多的大部头也应在此时间内完成
+	bookBuildTimeout = 30 * time.Minute
+	// maxPhotoSize 单张照片的大小上限
+	maxPhotoSize = 10 << 20
+	// defaultMaxBookJobsPerUser 每个用户同时排队或生成中的任务数上限
+	defaultMaxBookJobsPerUser = 2
+)
+
+// BookServiceConfig 书籍生成配置
+type BookServiceConfig struct {
+	FontPath       string
+	OutputDir      string
+	Retention      time.Duration
+	MaxJobsPerUser int
+}
+
+// BookService 家谱书籍生成服务，任务保存在内存中，生成的文件按保留时长清理
+type BookService struct {
+	individualService interfaces.IndividualService
+	recordRepo        interfaces.RecordRepository
+	pool              *workerpool.Pool
+	config            BookServiceConfig
+	photoClient       *http.Client
+
+	mu   sync.Mutex
+	jobs map[string]*bookJob
+}
+
+// bookJob 任务及其内部状态
+type bookJob struct {
+	models.BookJob
+	userID  int
+	request models.BookRequest
+	path    string
+}
+
+// NewBookService 创建书籍生成服务，pool 为空时在独立的 goroutine 中生成
+func NewBookService(individualService interfaces.IndividualService, recordRepo interfaces.RecordRepository,
+	pool *workerpool.Pool, config BookServiceConfig) interfaces.BookService {
+	if config.OutputDir == "" {
+		config.OutputDir = filepath.Join(os.TempDir(), "familytree-books")
+	}
+	if config.Retention <= 0 {
+		config.Retention = 24 * time.Hour
+	}
+	if config.MaxJobsPerUser <= 0 {
+		config.MaxJobsPerUser = defaultMaxBookJobsPerUser
+	}
+	return &BookService{
+		individualService: individualService,
+		recordRepo:        recordRepo,
+		pool:              pool,
+		config:            config,
+		photoClient:       newPhotoClient(),
+		jobs:              make(map[string]*bookJob),
+	}
+}
+
+// StartBook 提交书籍生成任务。用户未完成的任务达到上限时返回 429，工作池队列已满时返回 503，都不等待
+func (s *BookService) StartBook(ctx context.Context, userID, rootID int, req *models.BookRequest) (*models.BookJob, error) {
+	if rootID <= 0 {
+		return nil, errors.ErrInvalidID
+	}
+	if s.config.FontPath == "" {
+		return nil, errors.New(errors.ErrCodeInvalidInput, "未配置书籍字体，请设置 BOOK_FONT_PATH")
+	}
+	if req == nil {
+		req = &models.BookRequest{}
+	}
+	if req.Generations < 0 {
+		return nil, errors.New(errors.ErrCodeInvalidInput, "代数不能为负数")
+	}
+
+	root, err := s.individualService.GetByID(ctx, rootID)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "创建书籍任务失败")
+	}
+	job := &bookJob{
+		BookJob: models.BookJob{
+			JobID:     id,
+			RootID:    rootID,
+			Title:     strings.TrimSpace(req.Title),
+			Status:    models.BookJobPending,
+			CreatedAt: time.Now(),
+		},
+		userID:  userID,
+		request: *req,
+	}
+	if job.Title == "" {
+		job.Title = root.FullName + "家谱"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeExpiredLocked()
+	if s.activeJobsLocked(userID) >= s.config.MaxJobsPerUser {
+		return nil, errors.New(errors.ErrCodeTooMany, "未完成的书籍任务过多，请等待之前的任务完成")
+	}
+
+	task := &bookTask{service: s, job: job}
+	if s.pool == nil {
+		go task.Execute()
+	} else if !s.pool.TrySubmit(task) {
+		return nil, errors.New(errors.ErrCodeUnavailable, "书籍生成任务繁忙，请稍后重试")
+	}
+	// 任务开始执行前需要取得锁，登记任务时不会已在运行
+	s.jobs[id] = job
+	snapshot := job.BookJob
+	return &snapshot, nil
+}
+
+// activeJobsLocked 用户排队或生成中的任务数，调用方需持有锁
+func (s *BookService) activeJobsLocked(userID int) int {
+	count := 0
+	for _, job := range s.jobs {
+		if job.userID == userID && job.CompletedAt == nil {
+			count++
+		}
+	}
+	return count
+}
+
+// GetBookJob 查询书籍生成任务，只能查看自己提交的任务
+func (s *BookService) GetBookJob(ctx context.Context, userID int, jobID string) (*models.BookJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok || job.userID != userID {
+		return nil, errors.New(errors.ErrCodeNotFound, "书籍任务不存在")
+	}
+	snapshot := job.BookJob
+	return &snapshot, nil
+}
+
+// OpenBook 打开已生成的书籍文件，调用方负责关闭
+func (s *BookService) OpenBook(ctx context.Context, userID int, jobID string) (*models.BookJob, io.ReadCloser, error) {
+	job, err := s.GetBookJob(ctx, userID, jobID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if job.Status != models.BookJobCompleted {
+		return nil, nil, errors.New(errors.ErrCodeInvalidInput, "书籍尚未生成完成")
+	}
+
+	s.mu.Lock()
+	path := s.jobs[jobID].path
+	s.mu.Unlock()
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, errors.ErrCodeNotFound, "书籍文件已被清理")
+	}
+	return job, file, nil
+}
+
+// removeExpiredLocked 清理超过保留时长的任务和文件，调用方需持有锁
+func (s *BookService) removeExpiredLocked() {
+	deadline := time.Now().Add(-s.config.Retention)
+	for id, job := range s.jobs {
+		if job.CompletedAt != nil && job.CompletedAt.Before(deadline) {
+			if job.path != "" {
+				os.Remove(job.path)
+			}
+			delete(s.jobs, id)
+		}
+	}
+}
+
+// update 在锁内修改任务状态
+func (s *BookService) update(job *bookJob, fn func(job *bookJob)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(job)
+}
+
+// bookTask 工作池中执行的书籍生成任务
+type bookTask struct {
+	service *BookService
+	job     *bookJob
+}
+
+// Execute 生成书籍。错误记录在任务中而不返回：工作池的错误通道只在 Wait 时读取，
+// 长期运行的服务中返回错误会逐渐占满通道并阻塞工作器
+func (t *bookTask) Execute() error {
+	s, job := t.service, t.job
+	s.update(job, func(job *bookJob) { job.Status = models.BookJobRunning })
+
+	result, path, err := s.build(job)
+	now := time.Now()
+	s.update(job, func(job *bookJob) {
+		job.CompletedAt = &now
+		if err != nil {
+			job.Status, job.Error = models.BookJobFailed, err.Error()
+			if appErr, ok := err.(*errors.AppError); ok {
+				job.Error = appErr.Message
+			}
+			return
+		}
+		job.Status, job.path = models.BookJobCompleted, path
+		job.Pages, job.People = result.Pages, result.People
+		if info, err := os.Stat(path); err == nil {
+			job.Size = info.Size()
+		}
+	})
+	return nil
+}
+
+// build 加载书籍内容并写入文件
+func (s *BookService) build(job *bookJob) (*book.Result, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), bookBuildTimeout)
+	defer cancel()
+
+	generations := job.request.Generations
+	if generations == 0 {
+		generations = defaultBookGenerations
+	}
+	hourglass, err := s.individualService.GetHourglass(ctx, job.RootID, 0, generations)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := s.loadBookData(ctx, hourglass.Tree)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := os.MkdirAll(s.config.OutputDir, 0o755); err != nil {
+		return nil, "", fmt.Errorf("创建书籍目录失败: %v", err)
+	}
+	file, err := os.CreateTemp(s.config.OutputDir, "book-*.pdf")
+	if err != nil {
+		return nil, "", fmt.Errorf("创建书籍文件失败: %v", err)
+	}
+
+	opts := book.Options{
+		Title:       job.Title,
+		Subtitle:    job.request.Subtitle,
+		Compiler:    job.request.Compiler,
+		Date:        job.CreatedAt,
+		FontPath:    s.config.FontPath,
+		Photos:      job.request.IncludePhotos == nil || *job.request.IncludePhotos,
+		PhotoLoader: s.loadPhoto,
+	}
+	result, err := book.Write(file, data, opts)
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("写入书籍文件失败: %v", closeErr)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return nil, "", err
+	}
+	return result, file.Name(), nil
+}
+
+// loadBookData 批量加载后代树中所有人的事件、地点和引用
+func (s *BookService) loadBookData(ctx context.Context, root *models.HourglassNode) (*book.Data, error) {
+	var individualIDs, familyIDs, placeIDs []int
+	seen := map[int]bool{}
+	addPlace := func(ids ...*int) {
+		for _, id := range ids {
+			if id != nil {
+				placeIDs = append(placeIDs, *id)
+			}
+		}
+	}
+	addPerson := func(person *models.Individual) {
+		if !seen[person.IndividualID] {
+			seen[person.IndividualID] = true
+			individualIDs = append(individualIDs, person.IndividualID)
+			addPlace(person.BirthPlaceID, person.DeathPlaceID, person.BurialPlaceID)
+		}
+	}
+	var walk func(node *models.HourglassNode)
+	walk = func(node *models.HourglassNode) {
+		addPerson(&node.Individual)
+		for i := range node.Families {
+			family := &node.Families[i]
+			if family.Spouse != nil {
+				addPerson(family.Spouse)
+			}
+			if family.Family != nil {
+				familyIDs = append(familyIDs, family.Family.FamilyID)
+				addPlace(family.Family.MarriagePlaceID)
+			}
+			for j := range family.Children {
+				walk(&family.Children[j])
+			}
+		}
+	}
+	walk(root)
+
+	events, err := s.recordRepo.GetEventsByIndividualIDs(ctx, individualIDs)
+	if err != nil {
+		return nil, err
+	}
+	eventIDs := make([]int, 0, len(events))
+	for _, event := range events {
+		eventIDs = append(eventIDs, event.EventID)
+		addPlace(event.EventPlaceID)
+	}
+	places, err := s.recordRepo.GetPlacesByIDs(ctx, placeIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &book.Data{Root: root, Events: events, Places: places}
+	for _, entity := range []struct {
+		entityType models.EntityType
+		ids        []int
+	}{
+		{models.EntityTypeIndividual, individualIDs},
+		{models.EntityTypeFamily, familyIDs},
+		{models.EntityTypeEvent, eventIDs},
+	} {
+		citations, err := s.recordRepo.GetCitationsByEntities(ctx, entity.entityType, entity.ids)
+		if err != nil {
+			return nil, err
+		}
+		data.Citations = append(data.Citations, citations...)
+	}
+	return data, nil
+}
+
+// loadPhoto 下载照片，只支持 http(s) 地址
+func (s *BookService) loadPhoto(url string) ([]byte, error) {
+	return fetchPhoto(s.photoClient, url)
+}
+
+// newJobID 随机任务ID
+func newJobID() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,382 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"familytree/interfaces"
+	"familytree/models"
+	"familytree/pkg/errors"
+	"familytree/pkg/lunar"
+)
+
+// 纪念日查询的默认与最大天数，订阅日历包含此前一个月和此后一年
+const (
+	defaultCalendarDays = 30
+	maxCalendarDays     = 366
+	feedPastDays        = 30
+	feedFutureDays      = 365
+)
+
+// calendarLivingYears 没有死亡记录但出生超过该年数的人按已故处理，与静态网站一致
+const calendarLivingYears = 100
+
+// anniversaryOrder 同一天内的排列顺序
+var anniversaryOrder = map[string]int{
+	models.AnniversaryBirthday: 0,
+	models.AnniversaryWedding:  1,
+	models.AnniversaryDeath:    2,
+}
+
+// CalendarService 生日与纪念日日历服务
+type CalendarService struct {
+	individualRepo interfaces.IndividualRepository
+	familyRepo     interfaces.FamilyRepository
+	familyTreeRepo interfaces.FamilyTreeRepository
+	feedRepo       interfaces.CalendarFeedRepository
+}
+
+// NewCalendarService 创建生日与纪念日日历服务
+func NewCalendarService(individualRepo interfaces.IndividualRepository, familyRepo interfaces.FamilyRepository, familyTreeRepo interfaces.FamilyTreeRepository, feedRepo interfaces.CalendarFeedRepository) interfaces.CalendarService {
+	return &CalendarService{
+		individualRepo: individualRepo,
+		familyRepo:     familyRepo,
+		familyTreeRepo: familyTreeRepo,
+		feedRepo:       feedRepo,
+	}
+}
+
+// GetAnniversaries 列出家族树在一段时间内的生日、结婚纪念日和忌日
+func (s *CalendarService) GetAnniversaries(ctx context.Context, userID, familyTreeID int, opts models.CalendarOptions) (*models.AnniversaryCalendar, error) {
+	if familyTreeID <= 0 {
+		return nil, errors.New(errors.ErrCodeInvalidInput, "无效的家族树ID")
+	}
+	if opts.Days <= 0 {
+		opts.Days = defaultCalendarDays
+	}
+	if opts.Days > maxCalendarDays {
+		return nil, errors.New(errors.ErrCodeInvalidInput, fmt.Sprintf("查询天数不能超过 %d", maxCalendarDays))
+	}
+	for _, c := range opts.Calendars {
+		if c != models.CalendarGregorian && c != models.CalendarLunar {
+			return nil, errors.New(errors.ErrCodeInvalidInput, "calendar 只能是 gregorian 或 lunar")
+		}
+	}
+	for _, t := range opts.Types {
+		if _, ok := anniversaryOrder[t]; !ok {
+			return nil, errors.New(errors.ErrCodeInvalidInput, "types 只能包含 birthday、wedding、death")
+		}
+	}
+
+	tree, err := ownedFamilyTree(ctx, s.familyTreeRepo, userID, familyTreeID)
+	if err != nil {
+		return nil, err
+	}
+
+	from := opts.From
+	if from.IsZero() {
+		from = time.Now()
+	}
+	from = dateOnly(from)
+	to := from.AddDate(0, 0, opts.Days-1)
+
+	entries, err := s.treeAnniversaries(ctx, familyTreeID, from, to, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &models.AnniversaryCalendar{
+		FamilyTreeID: familyTreeID,
+		Name:         tree.FamilyTreeName,
+		From:         from,
+		To:           to,
+		Entries:      entries,
+	}, nil
+}
+
+// CreateFeed 生成新的订阅令牌，数据库只保存其 SHA-256 摘要
+func (s *CalendarService) CreateFeed(ctx context.Context, userID int) (*models.CalendarFeed, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "生成订阅令牌失败")
+	}
+	token := hex.EncodeToString(buf)
+
+	feed, err := s.feedRepo.SaveCalendarFeed(ctx, userID, feedTokenHash(token))
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "保存日历订阅失败")
+	}
+	feed.Token = token
+	return feed, nil
+}
+
+// GetFeedInfo 获取订阅的创建和最近访问时间，令牌本身无法再次取回
+func (s *CalendarService) GetFeedInfo(ctx context.Context, userID int) (*models.CalendarFeed, error) {
+	feed, err := s.feedRepo.GetCalendarFeed(ctx, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "查询日历订阅失败")
+	}
+	if feed == nil {
+		return nil, errors.New(errors.ErrCodeNotFound, "尚未创建日历订阅")
+	}
+	return feed, nil
+}
+
+// RevokeFeed 取消订阅
+func (s *CalendarService) RevokeFeed(ctx context.Context, userID int) error {
+	if err := s.feedRepo.DeleteCalendarFeed(ctx, userID); err != nil {
+		return errors.Wrap(err, errors.ErrCodeInternalError, "取消日历订阅失败")
+	}
+	return nil
+}
+
+// GetFeed 按订阅令牌生成用户全部家族树此前一个月到此后一年的纪念日
+func (s *CalendarService) GetFeed(ctx context.Context, token string) (*models.AnniversaryCalendar, error) {
+	if token == "" {
+		return nil, errors.New(errors.ErrCodeUnauthorized, "无效的订阅令牌")
+	}
+	userID, err := s.feedRepo.GetCalendarFeedUserID(ctx, feedTokenHash(token))
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "查询日历订阅失败")
+	}
+	if userID == 0 {
+		return nil, errors.New(errors.ErrCodeNotFound, "订阅不存在或已失效")
+	}
+
+	trees, err := s.familyTreeRepo.GetUserFamilyTrees(ctx, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "加载家族树失败")
+	}
+
+	today := dateOnly(time.Now())
+	from := today.AddDate(0, 0, -feedPastDays)
+	to := today.AddDate(0, 0, feedFutureDays)
+	result := &models.AnniversaryCalendar{Name: "家族纪念日", From: from, To: to, Entries: []models.Anniversary{}}
+	if len(trees) == 1 {
+		result.Name = trees[0].FamilyTreeName + "纪念日"
+	}
+	for _, tree := range trees {
+		entries, err := s.treeAnniversaries(ctx, tree.FamilyTreeID, from, to, models.CalendarOptions{})
+		if err != nil {
+			return nil, err
+		}
+		result.Entries = append(result.Entries, entries...)
+	}
+	sortAnniversaries(result.Entries)
+	return result, nil
+}
+
+// treeAnniversaries 计算一棵家族树在 [from, to] 内的纪念日
+func (s *CalendarService) treeAnniversaries(ctx context.Context, familyTreeID int, from, to time.Time, opts models.CalendarOptions) ([]models.Anniversary, error) {
+	individuals, err := s.individualRepo.GetIndividualsByFamilyTreeID(ctx, familyTreeID)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "加载家族树成员失败")
+	}
+	people := make(map[int]*models.Individual, len(individuals))
+	ids := make([]int, 0, len(individuals))
+	for i := range individuals {
+		people[individuals[i].IndividualID] = &individuals[i]
+		ids = append(ids, individuals[i].IndividualID)
+	}
+
+	var families []models.Family
+	if wants(opts.Types, models.AnniversaryWedding) && len(ids) > 0 {
+		if families, err = s.familyRepo.GetFamiliesByIndividualIDs(ctx, ids); err != nil {
+			return nil, errors.Wrap(err, errors.ErrCodeInternalError, "加载家庭关系失败")
+		}
+	}
+
+	c := anniversaryCollector{familyTreeID: familyTreeID, from: from, to: to, calendars: opts.Calendars, entries: []models.Anniversary{}}
+	for _, person := range individuals {
+		deceased := isDeceased(&person, to)
+		if wants(opts.Types, models.AnniversaryBirthday) && person.BirthDate != nil {
+			c.add(*person.BirthDate, func(a *models.Anniversary) {
+				a.Type = models.AnniversaryBirthday
+				a.IndividualID = person.IndividualID
+				a.Deceased = deceased
+				if deceased {
+					a.Title = fmt.Sprintf("%s 诞辰 %d 周年", person.FullName, a.Years)
+				} else {
+					a.Title = fmt.Sprintf("%s %d 岁生日", person.FullName, a.Years)
+				}
+			})
+		}
+		if wants(opts.Types, models.AnniversaryDeath) && person.DeathDate != nil {
+			c.add(*person.DeathDate, func(a *models.Anniversary) {
+				a.Type = models.AnniversaryDeath
+				a.IndividualID = person.IndividualID
+				a.Deceased = true
+				a.Title = fmt.Sprintf("%s 逝世 %d 周年忌日", person.FullName, a.Years)
+			})
+		}
+	}
+
+	// 离婚或一方已故的婚姻不再提醒结婚纪念日；家庭可能经多名成员重复查出
+	seen := map[int]bool{}
+	for _, family := range families {
+		if seen[family.FamilyID] || family.MarriageDate == nil || family.DivorceDate != nil {
+			continue
+		}
+		seen[family.FamilyID] = true
+		var names []string
+		ended := false
+		for _, id := range []*int{family.HusbandID, family.WifeID} {
+			if id == nil {
+				continue
+			}
+			spouse, ok := people[*id]
+			if !ok {
+				continue
+			}
+			names = append(names, spouse.FullName)
+			if isDeceased(spouse, to) {
+				ended = true
+			}
+		}
+		if ended || len(names) == 0 {
+			continue
+		}
+		familyID := family.FamilyID
+		c.add(*family.MarriageDate, func(a *models.Anniversary) {
+			a.Type = models.AnniversaryWedding
+			a.FamilyID = familyID
+			a.Title = fmt.Sprintf("%s 结婚 %d 周年", strings.Join(names, "、"), a.Years)
+		})
+	}
+
+	sortAnniversaries(c.entries)
+	return c.entries, nil
+}
+
+// anniversaryCollector 将原始日期展开为查询区间内每一次公历和农历纪念日
+type anniversaryCollector struct {
+	familyTreeID int
+	from, to     time.Time
+	calendars    []string
+	entries      []models.Anniversary
+}
+
+// add 计算 original 在区间内的纪念日，fill 填写类型、标题等字段（此时 Years 已确定）
+func (c *anniversaryCollector) add(original time.Time, fill func(a *models.Anniversary)) {
+	original = dateOnly(original)
+	if wants(c.calendars, models.CalendarGregorian) {
+		for year := c.from.Year(); year <= c.to.Year(); year++ {
+			date := solarAnniversary(original, year)
+			if year <= original.Year() || date.Before(c.from) || date.After(c.to) {
+				continue
+			}
+			a := models.Anniversary{
+				Date:         date,
+				Calendar:     models.CalendarGregorian,
+				Years:        year - original.Year(),
+				OriginalDate: original,
+				FamilyTreeID: c.familyTreeID,
+			}
+			fill(&a)
+			c.entries = append(c.entries, a)
+		}
+	}
+
+	if wants(c.calendars, models.CalendarLunar) {
+		born, err := lunar.FromSolar(original)
+		if err != nil {
+			return // 超出农历换算范围的日期只按公历计算
+		}
+		// 农历年比公历年晚一到两个月开始，区间起点所在公历年的前一个农历年也可能落在区间内
+		for year := c.from.Year() - 1; year <= c.to.Year(); year++ {
+			if year <= born.Year {
+				continue
+			}
+			day, err := lunar.Anniversary(born, year)
+			if err != nil {
+				continue
+			}
+			date, err := lunar.ToSolar(day)
+			if err != nil || date.Before(c.from) || date.After(c.to) {
+				continue
+			}
+			a := models.Anniversary{
+				Date:         date,
+				Calendar:     models.CalendarLunar,
+				Years:        year - born.Year,
+				LunarDate:    day.String(),
+				OriginalDate: original,
+				FamilyTreeID: c.familyTreeID,
+			}
+			fill(&a)
+			a.Title += "（农历" + a.LunarDate + "）"
+			c.entries = append(c.entries, a)
+		}
+	}
+}
+
+// solarAnniversary 公历纪念日，2 月 29 日在平年记为 2 月 28 日
+func solarAnniversary(original time.Time, year int) time.Time {
+	if original.Month() == time.February && original.Day() == 29 && !isLeapYear(year) {
+		return time.Date(year, time.February, 28, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(year, original.Month(), original.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// isLeapYear 公历闰年
+func isLeapYear(year int) bool {
+	return year%4 == 0 && (year%100 != 0 || year%400 == 0)
+}
+
+// isDeceased 有死亡记录，或出生已超过 calendarLivingYears 年
+func isDeceased(person *models.Individual, asOf time.Time) bool {
+	if person.DeathDate != nil || person.DeathPlaceID != nil || person.BurialPlaceID != nil ||
+		(person.DeathPlace != nil && *person.DeathPlace != "") || (person.BurialPlace != nil && *person.BurialPlace != "") {
+		return true
+	}
+	return person.BirthDate != nil && person.BirthDate.Year() <= asOf.Year()-calendarLivingYears
+}
+
+// sortAnniversaries 按日期排列，同一天内依次为生日、结婚纪念日、忌日
+func sortAnniversaries(entries []models.Anniversary) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		if a.Type != b.Type {
+			return anniversaryOrder[a.Type] < anniversaryOrder[b.Type]
+		}
+		if a.IndividualID != b.IndividualID {
+			return a.IndividualID < b.IndividualID
+		}
+		if a.FamilyID != b.FamilyID {
+			return a.FamilyID < b.FamilyID
+		}
+		return a.Calendar < b.Calendar
+	})
+}
+
+// wants 选项为空表示全部
+func wants(options []string, value string) bool {
+	if len(options) == 0 {
+		return true
+	}
+	for _, option := range options {
+		if option == value {
+			return true
+		}
+	}
+	return false
+}
+
+// dateOnly 去掉时间部分，统一为 UTC 零点
+func dateOnly(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// feedTokenHash 订阅令牌的摘要
+func feedTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"context"
+
+	"familytree/interfaces"
+	"familytree/models"
+	"familytree/pkg/errors"
+	"familytree/pkg/middleware"
+)
+
+// withChangeSet 取出本次请求的变更集，HTTP 请求之外调用时分配新的变更集，恢复、回滚据此查询自身执行的修改
+func withChangeSet(ctx context.Context) (context.Context, string, error) {
+	if changeSet, ok := middleware.GetChangeSetFromContext(ctx); ok {
+		return ctx, changeSet, nil
+	}
+	ctx, err := middleware.WithChangeSet(ctx)
+	if err != nil {
+		return ctx, "", errors.Wrap(err, errors.ErrCodeInternalError, "生成变更集失败")
+	}
+	changeSet, _ := middleware.GetChangeSetFromContext(ctx)
+	return ctx, changeSet, nil
+}
+
+// changeSetEntries 变更集中的全部修改，按发生顺序排列
+func changeSetEntries(ctx context.Context, auditRepo interfaces.AuditRepository, changeSet string) ([]models.AuditEntry, error) {
+	entries, _, err := auditRepo.GetAuditEntries(ctx, models.AuditQuery{ChangeSet: changeSet})
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "查询变更集失败")
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+// revertResult 恢复的结果：有冲突且未强制执行时只返回冲突，否则附上本次执行的全部修改
+func revertResult(ctx context.Context, auditRepo interfaces.AuditRepository, changeSet string, conflicts []models.RevertConflict, applied bool) (*models.RevertResult, error) {
+	result := &models.RevertResult{Applied: applied, Conflicts: conflicts, Changes: []models.AuditEntry{}}
+	if !applied {
+		return result, nil
+	}
+	changes, err := changeSetEntries(ctx, auditRepo, changeSet)
+	if err != nil {
+		return nil, err
+	}
+	result.ChangeSet = changeSet
+	result.Changes = append(result.Changes, changes...)
+	return result, nil
+}
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"familytree/interfaces"
+	"familytree/models"
+	"familytree/pkg/errors"
+	"familytree/pkg/narrative"
+	"familytree/pkg/spreadsheet"
+)
+
+// exportColumn 导出表格的一列，value 取记录中该列的值，nil 为空单元格
+type exportColumn[T any] struct {
+	key    string
+	header string
+	value  func(*T) interface{}
+}
+
+// 个人的表头与导入时推测列映射用的表头一致，导出的表格可以直接再导入
+var exportPersonColumns = []exportColumn[models.ExportPerson]{
+	{"id", "编号", func(p *models.ExportPerson) interface{} { return p.IndividualID }},
+	{"full_name", "姓名", func(p *models.ExportPerson) interface{} { return p.FullName }},
+	{"gender", "性别", func(p *models.ExportPerson) interface{} { return exportGender(p.Gender) }},
+	{"birth_date", "出生日期", func(p *models.ExportPerson) interface{} { return p.BirthDate }},
+	{"birth_place", "出生地", func(p *models.ExportPerson) interface{} { return p.BirthPlace }},
+	{"death_date", "去世日期", func(p *models.ExportPerson) interface{} { return p.DeathDate }},
+	{"death_place", "去世地点", func(p *models.ExportPerson) interface{} { return p.DeathPlace }},
+	{"burial_place", "安葬地点", func(p *models.ExportPerson) interface{} { return p.BurialPlace }},
+	{"occupation", "职业", func(p *models.ExportPerson) interface{} { return p.Occupation }},
+	{"notes", "备注", func(p *models.ExportPerson) interface{} { return p.Notes }},
+	{"father_id", "父亲编号", func(p *models.ExportPerson) interface{} { return exportID(p.FatherID) }},
+	{"father", "父亲", func(p *models.ExportPerson) interface{} { return p.FatherName }},
+	{"mother_id", "母亲编号", func(p *models.ExportPerson) interface{} { return exportID(p.MotherID) }},
+	{"mother", "母亲", func(p *models.ExportPerson) interface{} { return p.MotherName }},
+	{"spouses", "配偶", func(p *models.ExportPerson) interface{} { return p.Spouses }},
+}
+
+var exportFamilyColumns = []exportColumn[models.ExportFamily]{
+	{"id", "家庭编号", func(f *models.ExportFamily) interface{} { return f.FamilyID }},
+	{"husband_id", "丈夫编号", func(f *models.ExportFamily) interface{} { return exportID(f.HusbandID) }},
+	{"husband", "丈夫", func(f *models.ExportFamily) interface{} { return f.HusbandName }},
+	{"wife_id", "妻子编号", func(f *models.ExportFamily) interface{} { return exportID(f.WifeID) }},
+	{"wife", "妻子", func(f *models.ExportFamily) interface{} { return f.WifeName }},
+	{"marriage_order", "婚姻次序", func(f *models.ExportFamily) interface{} { return f.MarriageOrder }},
+	{"marriage_date", "结婚日期", func(f *models.ExportFamily) interface{} { return f.MarriageDate }},
+	{"marriage_place", "结婚地点", func(f *models.ExportFamily) interface{} { return f.MarriagePlace }},
+	{"divorce_date", "离婚日期", func(f *models.ExportFamily) interface{} { return f.DivorceDate }},
+	{"divorce_place", "离婚地点", func(f *models.ExportFamily) interface{} { return f.DivorcePlace }},
+	{"children", "子女数", func(f *models.ExportFamily) interface{} { return f.Children }},
+	{"notes", "备注", func(f *models.ExportFamily) interface{} { return f.Notes }},
+}
+
+var exportChildColumns = []exportColumn[models.ExportChild]{
+	{"family_id", "家庭编号", func(c *models.ExportChild) interface{} { return c.FamilyID }},
+	{"child_id", "子女编号", func(c *models.ExportChild) interface{} { return c.IndividualID }},
+	{"child", "子女", func(c *models.ExportChild) interface{} { return c.FullName }},
+	{"gender", "性别", func(c *models.ExportChild) interface{} { return exportGender(c.Gender) }},
+	{"birth_date", "出生日期", func(c *models.ExportChild) interface{} { return c.BirthDate }},
+	{"relationship", "关系", func(c *models.ExportChild) interface{} { return c.Relationship }},
+	{"father_id", "父亲编号", func(c *models.ExportChild) interface{} { return exportID(c.FatherID) }},
+	{"father", "父亲", func(c *models.ExportChild) interface{} { return c.FatherName }},
+	{"mother_id", "母亲编号", func(c *models.ExportChild) interface{} { return exportID(c.MotherID) }},
+	{"mother", "母亲", func(c *models.ExportChild) interface{} { return c.MotherName }},
+}
+
+var exportEventColumns = []exportColumn[models.ExportEvent]{
+	{"id", "事件编号", func(e *models.ExportEvent) interface{} { return e.EventID }},
+	{"individual_id", "个人编号", func(e *models.ExportEvent) interface{} { return e.IndividualID }},
+	{"individual", "姓名", func(e *models.ExportEvent) interface{} { return e.FullName }},
+	{"event_type", "事件类型", func(e *models.ExportEvent) interface{} { return e.EventType }},
+	{"event_name", "事件名称", func(e *models.ExportEvent) interface{} { return narrative.EventName(e.EventType) }},
+	{"event_date", "日期", func(e *models.ExportEvent) interface{} { return e.EventDate }},
+	{"place", "地点", func(e *models.ExportEvent) interface{} { return e.Place }},
+	{"description", "描述", func(e *models.ExportEvent) interface{} { return e.Description }},
+	{"notes", "备注", func(e *models.ExportEvent) interface{} { return e.Notes }},
+}
+
+// exportSheets 各数据集在 XLSX 中的工作表名称
+var exportSheets = map[string]string{
+	models.ExportDatasetPeople:   "成员",
+	models.ExportDatasetFamilies: "家庭",
+	models.ExportDatasetChildren: "子女",
+	models.ExportDatasetEvents:   "事件",
+}
+
+// exportGenders 性别的中文写法，与导入时接受的写法一致
+var exportGenders = map[models.Gender]string{
+	models.GenderMale:    "男",
+	models.GenderFemale:  "女",
+	models.GenderOther:   "其他",
+	models.GenderUnknown: "未知",
+}
+
+// ExportService 表格导出服务
+type ExportService struct {
+	exportRepo     interfaces.ExportRepository
+	familyTreeRepo interfaces.FamilyTreeRepository
+}
+
+// NewExportService 创建表格导出服务
+func NewExportService(exportRepo interfaces.ExportRepository, familyTreeRepo interfaces.FamilyTreeRepository) interfaces.ExportService {
+	return &ExportService{
+		exportRepo:     exportRepo,
+		familyTreeRepo: familyTreeRepo,
+	}
+}
+
+// Columns 数据集可以选择的列，按默认顺序排列
+func (s *ExportService) Columns(dataset string) ([]models.ExportColumn, error) {
+	switch dataset {
+	case models.ExportDatasetPeople:
+		return describeExportColumns(exportPersonColumns), nil
+	case models.ExportDatasetFamilies:
+		return describeExportColumns(exportFamilyColumns), nil
+	case models.ExportDatasetChildren:
+		return describeExportColumns(exportChildColumns), nil
+	case models.ExportDatasetEvents:
+		return describeExportColumns(exportEventColumns), nil
+	}
+	return nil, unknownExportDataset(dataset)
+}
+
+// Export 校验权限、格式和所选的列后，逐行把数据集写到 w。校验失败时不写出任何内容；
+// 写出过程中出错时已写出的部分无法撤回
+func (s *ExportService) Export(ctx context.Context, userID, familyTreeID int, req *models.ExportRequest, w io.Writer) error {
+	if _, err := ownedFamilyTree(ctx, s.familyTreeRepo, userID, familyTreeID); err != nil {
+		return err
+	}
+	format := spreadsheet.Format(strings.ToLower(req.Format))
+	if format == "" {
+		format = spreadsheet.FormatCSV
+	}
+	if format != spreadsheet.FormatCSV && format != spreadsheet.FormatXLSX {
+		return errors.New(errors.ErrCodeInvalidInput, fmt.Sprintf("不支持的导出格式 %q，可选 csv、xlsx", req.Format))
+	}
+
+	target := exportTarget{w: w, format: format, sheet: exportSheets[req.Dataset], keys: req.Columns}
+	switch req.Dataset {
+	case models.ExportDatasetPeople:
+		return writeExport(target, exportPersonColumns, func(fn func(*models.ExportPerson) error) error {
+			return s.exportRepo.ExportPeople(ctx, familyTreeID, req.Filter, fn)
+		})
+	case models.ExportDatasetFamilies:
+		return writeExport(target, exportFamilyColumns, func(fn func(*models.ExportFamily) error) error {
+			return s.exportRepo.ExportFamilies(ctx, familyTreeID, req.Filter, fn)
+		})
+	case models.ExportDatasetChildren:
+		return writeExport(target, exportChildColumns, func(fn func(*models.ExportChild) error) error {
+			return s.exportRepo.ExportChildren(ctx, familyTreeID, req.Filter, fn)
+		})
+	case models.ExportDatasetEvents:
+		return writeExport(target, exportEventColumns, func(fn func(*models.ExportEvent) error) error {
+			return s.exportRepo.ExportEvents(ctx, familyTreeID, req.Filter, fn)
+		})
+	}
+	return unknownExportDataset(req.Dataset)
+}
+
+// exportTarget 导出的目标和所选的列
+type exportTarget struct {
+	w      io.Writer
+	format spreadsheet.Format
+	sheet  string
+	keys   []string
+}
+
+// writeExport 按所选的列写出表头，再由 run 逐行回调写出记录
+func writeExport[T any](target exportTarget, columns []exportColumn[T], run func(fn func(*T) error) error) error {
+	selected, err := selectExportColumns(columns, target.keys)
+	if err != nil {
+		return err
+	}
+	header := make([]string, len(selected))
+	for i, column := range selected {
+		header[i] = column.header
+	}
+
+	writer, err := spreadsheet.NewWriter(target.w, target.format, target.sheet, header)
+	if err != nil {
+		return errors.Wrap(err, errors.ErrCodeInternalError, "写出表格失败")
+	}
+	cells := make([]interface{}, len(selected))
+	err = run(func(record *T) error {
+		for i, column := range selected {
+			cells[i] = column.value(record)
+		}
+		return writer.Write(cells)
+	})
+	if err != nil {
+		return errors.Wrap(err, errors.ErrCodeInternalError, "导出数据失败")
+	}
+	if err := writer.Close(); err != nil {
+		return errors.Wrap(err, errors.ErrCodeInternalError, "写出表格失败")
+	}
+	return nil
+}
+
+// selectExportColumns 按 keys 的顺序选出列，keys 为空时选出全部列
+func selectExportColumns[T any](columns []exportColumn[T], keys []string) ([]exportColumn[T], error) {
+	if len(keys) == 0 {
+		return columns, nil
+	}
+	selected := make([]exportColumn[T], 0, len(keys))
+	for _, key := range keys {
+		found := false
+		for _, column := range columns {
+			if column.key == key {
+				selected = append(selected, column)
+				found = true
+				break
+			}
+		}
+		if !found {
+			available := make([]string, len(columns))
+			for i, column := range columns {
+				available[i] = column.key
+			}
+			return nil, errors.New(errors.ErrCodeInvalidInput, fmt.Sprintf("未知的列 %q，可选 %s", key, strings.Join(available, ", ")))
+		}
+	}
+	return selected, nil
+}
+
+// describeExportColumns 列的名称和表头
+func describeExportColumns[T any](columns []exportColumn[T]) []models.ExportColumn {
+	result := make([]models.ExportColumn, len(columns))
+	for i, column := range columns {
+		result[i] = models.ExportColumn{Key: column.key, Header: column.header}
+	}
+	return result
+}
+
+// unknownExportDataset 不支持的数据集
+func unknownExportDataset(dataset string) error {
+	return errors.New(errors.ErrCodeInvalidInput, fmt.Sprintf("不支持的导出数据 %q，可选 %s、%s、%s、%s", dataset,
+		models.ExportDatasetPeople, models.ExportDatasetFamilies, models.ExportDatasetChildren, models.ExportDatasetEvents))
+}
+
+// exportID 可为空的ID，为空时是空单元格
+func exportID(id *int) interface{} {
+	if id == nil {
+		return nil
+	}
+	return *id
+}
+
+// exportGender 性别的中文写法
+func exportGender(gender models.Gender) string {
+	if name, ok := exportGenders[gender]; ok {
+		return name
+	}
+	return string(gender)
+}
@@ -13,18 +13,27 @@ import (
 type FamilyService struct {
 	repo           interfaces.FamilyRepository
 	individualRepo interfaces.IndividualRepository
+	uow            interfaces.UnitOfWork
 }
 
 // NewFamilyService 创建新的家庭关系服务
-func NewFamilyService(repo interfaces.FamilyRepository, individualRepo interfaces.IndividualRepository) interfaces.FamilyService {
+func NewFamilyService(repo interfaces.FamilyRepository, individualRepo interfaces.IndividualRepository, uow interfaces.UnitOfWork) interfaces.FamilyService {
 	return &FamilyService{
 		repo:           repo,
 		individualRepo: individualRepo,
+		uow:            uow,
 	}
 }
 
-// CreateFamily 创建家庭关系
+// CreateFamily 创建家庭关系，婚姻顺序的计算与创建在同一事务中完成
 func (s *FamilyService) CreateFamily(ctx context.Context, req *models.CreateFamilyRequest) (*models.Family, error) {
+	return inTransaction(ctx, s.uow, func(ctx context.Context) (*models.Family, error) {
+		return s.createFamily(ctx, req)
+	})
+}
+
+// createFamily 创建家庭关系
+func (s *FamilyService) createFamily(ctx context.Context, req *models.CreateFamilyRequest) (*models.Family, error) {
 	// 验证输入
 	if req.HusbandID == nil && req.WifeID == nil {
 		return nil, fmt.Errorf("至少需要指定丈夫或妻子")
@@ -120,6 +129,9 @@ func (s *FamilyService) Update(ctx context.Context, id int, req *models.CreateFa
 	if err != nil {
 		return nil, err
 	}
+	if err := checkVersion(req.Version, current.Version); err != nil {
+		return nil, err
+	}
 
 	// 更新家庭记录
 	family := &models.Family{
@@ -133,41 +145,39 @@ func (s *FamilyService) Update(ctx context.Context, id int, req *models.CreateFa
 		Notes:           req.Notes,
 		CreatedAt:       current.CreatedAt,
 		UpdatedAt:       time.Now(),
+		Version:         expectedVersion(req.Version),
 	}
 
-	return s.repo.UpdateFamily(ctx, id, family)
+	updated, err := s.repo.UpdateFamily(ctx, id, family)
+	if err != nil {
+		return nil, versionError(err)
+	}
+	return updated, nil
+}
+
+// Delete 删除家庭关系，检查与删除在同一事务中完成
+func (s *FamilyService) Delete(ctx context.Context, id int, version *int) error {
+	return s.uow.WithinTransaction(ctx, func(ctx context.Context) error {
+		return s.delete(ctx, id, version)
+	})
 }
 
-// Delete 删除家庭关系
-func (s *FamilyService) Delete(ctx context.Context, id int) error {
+// delete 删除家庭关系
+func (s *FamilyService) delete(ctx context.Context, id int, version *int) error {
 	if id <= 0 {
 		return fmt.Errorf("无效的家庭ID")
 	}
 
 	// 检查家庭关系是否存在
-	_, err := s.repo.GetFamilyByID(ctx, id)
+	family, err := s.repo.GetFamilyByID(ctx, id)
 	if err != nil {
 		return fmt.Errorf("家庭关系不存在")
 	}
-
-	// 检查是否有子女记录
-	children, err := s.repo.GetChildrenByFamilyID(ctx, id)
-	if err != nil {
-		return fmt.Errorf("检查子女关系失败: %v", err)
-	}
-	if len(children) > 0 {
-		return fmt.Errorf("该家庭有子女记录，不能删除。请先删除或转移子女关系")
-	}
-
-	// 先清理所有相关的子女关系记录
-	for _, child := range children {
-		err := s.repo.DeleteChild(ctx, id, child.IndividualID)
-		if err != nil {
-			return fmt.Errorf("删除子女关系记录失败: %v", err)
-		}
+	if err := checkVersion(version, family.Version); err != nil {
+		return err
 	}
 
-	// 删除家庭关系
+	// 家庭连同其子女关系移入回收站
 	return s.repo.DeleteFamily(ctx, id)
 }
 
@@ -198,8 +208,15 @@ func (s *FamilyService) GetByIndividualID(ctx context.Context, individualID int)
 	return s.repo.GetFamiliesByIndividualID(ctx, individualID)
 }
 
-// AddSpouse 添加配偶关系
+// AddSpouse 添加配偶关系，重复检查、婚姻顺序的计算与创建在同一事务中完成
 func (s *FamilyService) AddSpouse(ctx context.Context, individualID, spouseID int) (*models.Family, error) {
+	return inTransaction(ctx, s.uow, func(ctx context.Context) (*models.Family, error) {
+		return s.addSpouse(ctx, individualID, spouseID)
+	})
+}
+
+// addSpouse 添加配偶关系
+func (s *FamilyService) addSpouse(ctx context.Context, individualID, spouseID int) (*models.Family, error) {
 	if individualID <= 0 || spouseID <= 0 {
 		return nil, fmt.Errorf("无效的个人ID")
 	}
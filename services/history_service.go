@@ -0,0 +1,248 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"familytree/interfaces"
+	"familytree/models"
+	"familytree/pkg/errors"
+	"familytree/pkg/middleware"
+)
+
+// 变更历史分页的默认与最大条数
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 500
+)
+
+// historyEntityTypes 记录变更历史的记录类型
+var historyEntityTypes = map[models.EntityType]bool{
+	models.EntityTypeIndividual: true,
+	models.EntityTypeFamily:     true,
+	models.EntityTypeChild:      true,
+	models.EntityTypeEvent:      true,
+}
+
+// HistoryService 变更历史服务
+type HistoryService struct {
+	auditRepo      interfaces.AuditRepository
+	familyTreeRepo interfaces.FamilyTreeRepository
+}
+
+// NewHistoryService 创建变更历史服务
+func NewHistoryService(auditRepo interfaces.AuditRepository, familyTreeRepo interfaces.FamilyTreeRepository) interfaces.HistoryService {
+	return &HistoryService{
+		auditRepo:      auditRepo,
+		familyTreeRepo: familyTreeRepo,
+	}
+}
+
+// GetEntityHistory 某条记录的变更历史，记录所在家族树的所有者可以查看
+func (s *HistoryService) GetEntityHistory(ctx context.Context, userID int, entityType models.EntityType, entityID string, limit, offset int) ([]models.AuditEntry, int, error) {
+	if !historyEntityTypes[entityType] {
+		return nil, 0, errors.New(errors.ErrCodeInvalidInput, "不支持的记录类型")
+	}
+	if entityID == "" {
+		return nil, 0, errors.ErrInvalidID
+	}
+	query := models.AuditQuery{EntityType: entityType, EntityID: entityID, Limit: limit, Offset: offset}
+	if err := normalizeAuditPage(&query); err != nil {
+		return nil, 0, err
+	}
+
+	entries, total, err := s.auditRepo.GetAuditEntries(ctx, query)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, errors.ErrCodeInternalError, "查询变更历史失败")
+	}
+	if err := s.checkEntries(ctx, userID, entries); err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+// GetTreeHistory 家族树的变更历史，只有家族树的所有者可以查看
+func (s *HistoryService) GetTreeHistory(ctx context.Context, userID, familyTreeID int, query models.AuditQuery) ([]models.AuditEntry, int, error) {
+	if familyTreeID <= 0 {
+		return nil, 0, errors.New(errors.ErrCodeInvalidInput, "无效的家族树ID")
+	}
+	if query.EntityType != "" && !historyEntityTypes[query.EntityType] {
+		return nil, 0, errors.New(errors.ErrCodeInvalidInput, "不支持的记录类型")
+	}
+	if err := normalizeAuditPage(&query); err != nil {
+		return nil, 0, err
+	}
+	if _, err := ownedFamilyTree(ctx, s.familyTreeRepo, userID, familyTreeID); err != nil {
+		return nil, 0, err
+	}
+
+	query.FamilyTreeID = familyTreeID
+	entries, total, err := s.auditRepo.GetAuditEntries(ctx, query)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, errors.ErrCodeInternalError, "查询变更历史失败")
+	}
+	return entries, total, nil
+}
+
+// GetUserHistory 用户本人做过的修改
+func (s *HistoryService) GetUserHistory(ctx context.Context, userID int, query models.AuditQuery) ([]models.AuditEntry, int, error) {
+	if query.EntityType != "" && !historyEntityTypes[query.EntityType] {
+		return nil, 0, errors.New(errors.ErrCodeInvalidInput, "不支持的记录类型")
+	}
+	if err := normalizeAuditPage(&query); err != nil {
+		return nil, 0, err
+	}
+
+	query.UserID = userID
+	entries, total, err := s.auditRepo.GetAuditEntries(ctx, query)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, errors.ErrCodeInternalError, "查询变更历史失败")
+	}
+	return entries, total, nil
+}
+
+// GetChangeSet 一个变更集中的全部修改，按发生顺序排列
+func (s *HistoryService) GetChangeSet(ctx context.Context, userID int, changeSet string) ([]models.AuditEntry, error) {
+	if changeSet == "" {
+		return nil, errors.New(errors.ErrCodeInvalidInput, "无效的变更集ID")
+	}
+	entries, err := changeSetEntries(ctx, s.auditRepo, changeSet)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, errors.New(errors.ErrCodeNotFound, "变更集不存在")
+	}
+	if err := s.checkEntries(ctx, userID, entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// RevertRecord 把个人或家庭恢复到某条变更之后的状态。
+// 当前记录与最近一条变更记录不一致（有未记录的修改）时报告冲突，force 为真时仍然覆盖
+func (s *HistoryService) RevertRecord(ctx context.Context, userID int, entityType models.EntityType, entityID string, req *models.RevertRequest) (*models.RevertResult, error) {
+	if entityType != models.EntityTypeIndividual && entityType != models.EntityTypeFamily {
+		return nil, errors.New(errors.ErrCodeInvalidInput, "只能恢复个人或家庭")
+	}
+	if req.AuditID <= 0 {
+		return nil, errors.New(errors.ErrCodeInvalidInput, "请指定要恢复到的变更记录 audit_id")
+	}
+
+	version, err := s.auditRepo.GetAuditEntry(ctx, req.AuditID)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "查询变更记录失败")
+	}
+	if version == nil || version.EntityType != entityType || version.EntityID != entityID {
+		return nil, errors.New(errors.ErrCodeNotFound, "该记录没有这条变更记录")
+	}
+	if version.After == nil {
+		return nil, errors.New(errors.ErrCodeInvalidInput, "这条变更删除了记录，请选择更早的版本，或撤销该变更集")
+	}
+
+	latest, _, err := s.auditRepo.GetAuditEntries(ctx, models.AuditQuery{EntityType: entityType, EntityID: entityID, Limit: 1})
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "查询变更历史失败")
+	}
+	if err := s.checkEntries(ctx, userID, append(latest, *version)); err != nil {
+		return nil, err
+	}
+
+	restore := models.RecordRestore{EntityType: entityType, EntityID: entityID, Expected: latest[0].After, Target: version.After}
+	return s.restore(ctx, []models.RecordRestore{restore}, req.Force)
+}
+
+// UndoChangeSet 按相反顺序撤销一个变更集中的全部修改：新建的删除、删除的恢复、修改的字段改回原值。
+// 之后又被修改过的字段报告为冲突，force 为真时仍然覆盖
+func (s *HistoryService) UndoChangeSet(ctx context.Context, userID int, changeSet string, req *models.RevertRequest) (*models.RevertResult, error) {
+	if changeSet == "" {
+		return nil, errors.New(errors.ErrCodeInvalidInput, "无效的变更集ID")
+	}
+	if current, ok := middleware.GetChangeSetFromContext(ctx); ok && current == changeSet {
+		return nil, errors.New(errors.ErrCodeInvalidInput, "不能撤销当前请求自身的变更集")
+	}
+
+	// 查询结果按时间倒序，正好是撤销的顺序
+	entries, _, err := s.auditRepo.GetAuditEntries(ctx, models.AuditQuery{ChangeSet: changeSet})
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "查询变更集失败")
+	}
+	if len(entries) == 0 {
+		return nil, errors.New(errors.ErrCodeNotFound, "变更集不存在")
+	}
+	if err := s.checkEntries(ctx, userID, entries); err != nil {
+		return nil, err
+	}
+
+	restores := make([]models.RecordRestore, 0, len(entries))
+	for _, entry := range entries {
+		restore := models.RecordRestore{EntityType: entry.EntityType, EntityID: entry.EntityID}
+		switch entry.Action {
+		case models.AuditActionCreate:
+			restore.Expected = entry.After
+		case models.AuditActionDelete:
+			restore.Target = entry.Before
+		default:
+			restore.Expected = map[string]interface{}{}
+			restore.Target = map[string]interface{}{}
+			for _, change := range entry.Changes {
+				restore.Expected[change.Field] = change.New
+				restore.Target[change.Field] = change.Old
+			}
+		}
+		restores = append(restores, restore)
+	}
+	return s.restore(ctx, restores, req.Force)
+}
+
+// restore 执行恢复，恢复本身记在新的变更集下
+func (s *HistoryService) restore(ctx context.Context, restores []models.RecordRestore, force bool) (*models.RevertResult, error) {
+	ctx, changeSet, err := withChangeSet(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts, err := s.auditRepo.RestoreRecords(ctx, restores, force)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "恢复失败")
+	}
+	return revertResult(ctx, s.auditRepo, changeSet, conflicts, force || len(conflicts) == 0)
+}
+
+// checkEntries 变更记录所属的家族树都必须属于该用户，不属于任何家族树的记录只有操作人本人可以查看
+func (s *HistoryService) checkEntries(ctx context.Context, userID int, entries []models.AuditEntry) error {
+	checked := map[int]bool{}
+	for _, entry := range entries {
+		if entry.FamilyTreeID == nil {
+			if entry.UserID == nil || *entry.UserID != userID {
+				return errors.New(errors.ErrCodeForbidden, "无权查看该变更记录")
+			}
+			continue
+		}
+		if checked[*entry.FamilyTreeID] {
+			continue
+		}
+		if _, err := ownedFamilyTree(ctx, s.familyTreeRepo, userID, *entry.FamilyTreeID); err != nil {
+			return err
+		}
+		checked[*entry.FamilyTreeID] = true
+	}
+	return nil
+}
+
+// normalizeAuditPage 补齐默认条数并检查分页参数
+func normalizeAuditPage(query *models.AuditQuery) error {
+	if query.Limit <= 0 {
+		query.Limit = defaultHistoryLimit
+	}
+	if query.Limit > maxHistoryLimit {
+		return errors.New(errors.ErrCodeInvalidInput, fmt.Sprintf("limit 不能超过 %d", maxHistoryLimit))
+	}
+	if query.Offset < 0 {
+		return errors.New(errors.ErrCodeInvalidInput, "offset 不能为负数")
+	}
+	if query.Since != nil && query.Until != nil && !query.Until.After(*query.Since) {
+		return errors.New(errors.ErrCodeInvalidInput, "until 必须晚于 since")
+	}
+	return nil
+}
@@ -0,0 +1,471 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"familytree/models"
+)
+
+// GetHourglass 获取沙漏图：向上若干代祖先、向下若干代后代（按家庭分组并附带配偶）
+func (s *IndividualService) GetHourglass(ctx context.Context, rootID int, ancestorGenerations, descendantGenerations int) (*models.Hourglass, error) {
+	if rootID <= 0 {
+		return nil, fmt.Errorf("无效的根节点ID")
+	}
+	ancestorGenerations = s.boundGenerations(ancestorGenerations)
+	descendantGenerations = s.boundGenerations(descendantGenerations)
+
+	root, err := s.repo.GetIndividualByID(ctx, rootID)
+	if err != nil {
+		return nil, err
+	}
+
+	view := &hourglassView{
+		people:        map[int]models.Individual{root.IndividualID: *root},
+		ancestors:     map[int]bool{},
+		childrenOf:    map[int][]int{},
+		familiesOf:    map[int][]models.Family{},
+		childFamilies: map[int][]int{},
+		childRelation: map[[2]int]string{},
+	}
+
+	if ancestorGenerations > 0 {
+		entries, err := s.repo.GetAncestorLineage(ctx, rootID, ancestorGenerations)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			view.people[entry.Individual.IndividualID] = entry.Individual
+			view.ancestors[entry.Individual.IndividualID] = true
+		}
+	}
+
+	if descendantGenerations > 0 {
+		entries, err := s.repo.GetDescendantLineage(ctx, rootID, descendantGenerations)
+		if err != nil {
+			return nil, err
+		}
+		linked := make(map[[2]int]bool)
+		for _, entry := range entries {
+			childID := entry.Individual.IndividualID
+			view.people[childID] = entry.Individual
+			if key := [2]int{entry.LinkedID, childID}; !linked[key] {
+				linked[key] = true
+				view.childrenOf[entry.LinkedID] = append(view.childrenOf[entry.LinkedID], childID)
+			}
+		}
+	}
+
+	if err := s.loadHourglassFamilies(ctx, view); err != nil {
+		return nil, err
+	}
+	if err := s.attachAlternateNames(ctx, view.people); err != nil {
+		return nil, err
+	}
+
+	rootPerson := view.people[rootID]
+	tree := view.buildDescendant(&rootPerson, 0, descendantGenerations)
+	tree.Father, tree.Mother = view.buildParents(&rootPerson, 0, ancestorGenerations)
+
+	return &models.Hourglass{
+		RootID:                rootID,
+		AncestorGenerations:   ancestorGenerations,
+		DescendantGenerations: descendantGenerations,
+		Tree:                  &tree,
+		Graph:                 view.buildGraph(&tree),
+	}, nil
+}
+
+// boundGenerations 沙漏图允许 0 代（只展开一侧），负数按 0 处理
+func (s *IndividualService) boundGenerations(generations int) int {
+	if generations < 0 {
+		return 0
+	}
+	if generations > s.config.MaxGenerations {
+		return s.config.MaxGenerations
+	}
+	return generations
+}
+
+// loadHourglassFamilies 批量加载图中所有人的家庭、子女记录和配偶
+func (s *IndividualService) loadHourglassFamilies(ctx context.Context, view *hourglassView) error {
+	ids := make([]int, 0, len(view.people))
+	for id := range view.people {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	families, err := s.familyRepo.GetFamiliesByIndividualIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	familyIDs := make([]int, 0, len(families))
+	var missing []int
+	for _, family := range families {
+		familyIDs = append(familyIDs, family.FamilyID)
+		for _, partnerID := range []*int{family.HusbandID, family.WifeID} {
+			if partnerID == nil {
+				continue
+			}
+			view.familiesOf[*partnerID] = append(view.familiesOf[*partnerID], family)
+			if _, ok := view.people[*partnerID]; !ok {
+				missing = append(missing, *partnerID)
+			}
+		}
+	}
+
+	// 没有家庭记录的子女，其另一位父母也作为配偶显示
+	for parentID, childIDs := range view.childrenOf {
+		for _, childID := range childIDs {
+			if otherID := otherParentID(view.people[childID], parentID); otherID != 0 {
+				if _, ok := view.people[otherID]; !ok {
+					missing = append(missing, otherID)
+				}
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		spouses, err := s.repo.GetIndividualsByIDs(ctx, missing)
+		if err != nil {
+			return err
+		}
+		for _, spouse := range spouses {
+			view.people[spouse.IndividualID] = spouse
+		}
+	}
+
+	children, err := s.familyRepo.GetChildrenByFamilyIDs(ctx, familyIDs)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		view.childFamilies[child.IndividualID] = append(view.childFamilies[child.IndividualID], child.FamilyID)
+		view.childRelation[[2]int{child.FamilyID, child.IndividualID}] = child.RelationshipToParents
+	}
+
+	return nil
+}
+
+// hourglassView 构建沙漏图所需的已加载数据
+type hourglassView struct {
+	people        map[int]models.Individual
+	ancestors     map[int]bool
+	childrenOf    map[int][]int
+	familiesOf    map[int][]models.Family
+	childFamilies map[int][]int     // 子女ID -> 子女记录所在家庭
+	childRelation map[[2]int]string // (家庭ID, 子女ID) -> 子女关系类型
+}
+
+// buildParents 向上展开父母，祖先代数用负数表示
+func (v *hourglassView) buildParents(person *models.Individual, generation, remaining int) (*models.HourglassNode, *models.HourglassNode) {
+	if remaining <= 0 {
+		return nil, nil
+	}
+
+	build := func(parentID *int) *models.HourglassNode {
+		if parentID == nil || !v.ancestors[*parentID] {
+			return nil
+		}
+		parent := v.people[*parentID]
+		node := &models.HourglassNode{Individual: parent, Generation: generation - 1}
+		node.Father, node.Mother = v.buildParents(&parent, generation-1, remaining-1)
+		return node
+	}
+
+	return build(person.FatherID), build(person.MotherID)
+}
+
+// buildDescendant 向下展开家庭：按婚姻次序列出家庭，子女归入对应家庭
+func (v *hourglassView) buildDescendant(person *models.Individual, generation, remaining int) models.HourglassNode {
+	node := models.HourglassNode{Individual: *person, Generation: generation}
+
+	families := v.familiesOf[person.IndividualID]
+	groups := make([]models.HourglassFamily, len(families))
+	byFamilyID := make(map[int]int, len(families))
+	for i := range families {
+		family := families[i]
+		groups[i].Family = &family
+		groups[i].Spouse = v.person(spouseID(&family, person.IndividualID))
+		byFamilyID[family.FamilyID] = i
+	}
+
+	// 找不到家庭记录的子女按另一位父母分组
+	unmatched := make(map[int]int)
+	var unmatchedOrder []int
+
+	if remaining > 0 {
+		for _, childID := range v.childrenOf[person.IndividualID] {
+			child := v.people[childID]
+			childNode := v.buildDescendant(&child, generation+1, remaining-1)
+
+			if index, ok := v.familyForChild(person.IndividualID, &child, families, byFamilyID); ok {
+				groups[index].Children = append(groups[index].Children, childNode)
+				continue
+			}
+
+			otherID := otherParentID(child, person.IndividualID)
+			index, ok := unmatched[otherID]
+			if !ok {
+				index = len(groups)
+				unmatched[otherID] = index
+				unmatchedOrder = append(unmatchedOrder, otherID)
+				groups = append(groups, models.HourglassFamily{Spouse: v.person(otherID)})
+			}
+			groups[index].Children = append(groups[index].Children, childNode)
+		}
+	}
+
+	node.Families = groups
+	return node
+}
+
+// familyForChild 确定子女所属的家庭：优先使用子女记录，其次按另一位父母匹配配偶
+func (v *hourglassView) familyForChild(parentID int, child *models.Individual, families []models.Family, byFamilyID map[int]int) (int, bool) {
+	for _, familyID := range v.childFamilies[child.IndividualID] {
+		if index, ok := byFamilyID[familyID]; ok {
+			return index, true
+		}
+	}
+
+	otherID := otherParentID(*child, parentID)
+	if otherID == 0 {
+		return 0, false
+	}
+	for i := range families {
+		if spouseID(&families[i], parentID) == otherID {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// person 获取已加载的个人，ID 为 0 或未加载时返回 nil
+func (v *hourglassView) person(id int) *models.Individual {
+	if id == 0 {
+		return nil
+	}
+	person, ok := v.people[id]
+	if !ok {
+		return nil
+	}
+	return &person
+}
+
+// spouseID 获取家庭中另一方的ID，没有时返回 0
+func spouseID(family *models.Family, individualID int) int {
+	if family.HusbandID != nil && *family.HusbandID == individualID {
+		if family.WifeID != nil {
+			return *family.WifeID
+		}
+		return 0
+	}
+	if family.HusbandID != nil {
+		return *family.HusbandID
+	}
+	return 0
+}
+
+// otherParentID 获取子女的另一位父母ID，没有时返回 0
+func otherParentID(child models.Individual, parentID int) int {
+	if child.FatherID != nil && *child.FatherID == parentID {
+		if child.MotherID != nil {
+			return *child.MotherID
+		}
+		return 0
+	}
+	if child.FatherID != nil {
+		return *child.FatherID
+	}
+	return 0
+}
+
+// hourglassGraph 由嵌套树生成去重的平铺图
+type hourglassGraph struct {
+	view  *hourglassView
+	graph *models.FamilyGraph
+	nodes map[string]bool
+	edges map[string]bool
+}
+
+// buildGraph 生成平铺的个人-家庭图
+func (v *hourglassView) buildGraph(root *models.HourglassNode) *models.FamilyGraph {
+	g := &hourglassGraph{
+		view:  v,
+		graph: &models.FamilyGraph{Nodes: []models.GraphNode{}, Edges: []models.GraphEdge{}},
+		nodes: make(map[string]bool),
+		edges: make(map[string]bool),
+	}
+	g.addAncestors(root)
+	g.addDescendants(root)
+	return g.graph
+}
+
+// addAncestors 添加父母及其结合的家庭节点
+func (g *hourglassGraph) addAncestors(node *models.HourglassNode) {
+	childKey := g.addIndividual(&node.Individual, node.Generation)
+	if node.Father == nil && node.Mother == nil {
+		return
+	}
+
+	var fatherID, motherID int
+	if node.Father != nil {
+		fatherID = node.Father.Individual.IndividualID
+	}
+	if node.Mother != nil {
+		motherID = node.Mother.Individual.IndividualID
+	}
+
+	family := g.view.findFamily(fatherID, motherID)
+	familyKey := g.addFamily(family, node.Generation-1, fatherID, motherID)
+	g.addEdge(familyKey, childKey, models.GraphEdgeChild, g.view.relationFor(family, node.Individual.IndividualID))
+
+	for _, parent := range []*models.HourglassNode{node.Father, node.Mother} {
+		if parent == nil {
+			continue
+		}
+		g.addAncestors(parent)
+		g.addEdge(individualKey(parent.Individual.IndividualID), familyKey, models.GraphEdgePartner, partnerRole(family, &parent.Individual))
+	}
+}
+
+// addDescendants 添加家庭、配偶和子女节点
+func (g *hourglassGraph) addDescendants(node *models.HourglassNode) {
+	personKey := g.addIndividual(&node.Individual, node.Generation)
+
+	for _, group := range node.Families {
+		var spouseID int
+		if group.Spouse != nil {
+			spouseID = group.Spouse.IndividualID
+		}
+
+		familyKey := g.addFamily(group.Family, node.Generation, node.Individual.IndividualID, spouseID)
+		g.addEdge(personKey, familyKey, models.GraphEdgePartner, partnerRole(group.Family, &node.Individual))
+		if group.Spouse != nil {
+			spouseKey := g.addIndividual(group.Spouse, node.Generation)
+			g.addEdge(spouseKey, familyKey, models.GraphEdgePartner, partnerRole(group.Family, group.Spouse))
+		}
+
+		for i := range group.Children {
+			child := &group.Children[i]
+			g.addDescendants(child)
+			g.addEdge(familyKey, individualKey(child.Individual.IndividualID), models.GraphEdgeChild,
+				g.view.relationFor(group.Family, child.Individual.IndividualID))
+		}
+	}
+}
+
+// addIndividual 添加个人节点（已存在时跳过）
+func (g *hourglassGraph) addIndividual(person *models.Individual, generation int) string {
+	key := individualKey(person.IndividualID)
+	if !g.nodes[key] {
+		g.nodes[key] = true
+		individual := *person
+		g.graph.Nodes = append(g.graph.Nodes, models.GraphNode{
+			ID:         key,
+			Type:       models.GraphNodeIndividual,
+			Generation: generation,
+			Individual: &individual,
+		})
+	}
+	return key
+}
+
+// addFamily 添加家庭节点；没有家庭记录时用双方ID生成稳定的虚拟节点
+func (g *hourglassGraph) addFamily(family *models.Family, generation int, partnerIDs ...int) string {
+	var key string
+	if family != nil {
+		key = "F" + strconv.Itoa(family.FamilyID)
+	} else {
+		var ids []int
+		for _, id := range partnerIDs {
+			if id != 0 {
+				ids = append(ids, id)
+			}
+		}
+		sort.Ints(ids)
+		parts := make([]string, len(ids))
+		for i, id := range ids {
+			parts[i] = strconv.Itoa(id)
+		}
+		key = "U" + strings.Join(parts, "_")
+	}
+
+	if !g.nodes[key] {
+		g.nodes[key] = true
+		g.graph.Nodes = append(g.graph.Nodes, models.GraphNode{
+			ID:         key,
+			Type:       models.GraphNodeFamily,
+			Generation: generation,
+			Family:     family,
+		})
+	}
+	return key
+}
+
+// addEdge 添加边（已存在时跳过）
+func (g *hourglassGraph) addEdge(from, to, edgeType, role string) {
+	key := from + ">" + to
+	if g.edges[key] {
+		return
+	}
+	g.edges[key] = true
+	g.graph.Edges = append(g.graph.Edges, models.GraphEdge{From: from, To: to, Type: edgeType, Role: role})
+}
+
+// findFamily 查找父母双方对应的家庭记录
+func (v *hourglassView) findFamily(fatherID, motherID int) *models.Family {
+	partnerID := fatherID
+	if partnerID == 0 {
+		partnerID = motherID
+	}
+	for _, family := range v.familiesOf[partnerID] {
+		husband, wife := 0, 0
+		if family.HusbandID != nil {
+			husband = *family.HusbandID
+		}
+		if family.WifeID != nil {
+			wife = *family.WifeID
+		}
+		if husband == fatherID && wife == motherID {
+			return &family
+		}
+	}
+	return nil
+}
+
+// relationFor 获取子女记录中的关系类型
+func (v *hourglassView) relationFor(family *models.Family, childID int) string {
+	if family == nil {
+		return ""
+	}
+	return v.childRelation[[2]int{family.FamilyID, childID}]
+}
+
+// partnerRole 个人在家庭中的角色
+func partnerRole(family *models.Family, person *models.Individual) string {
+	if family != nil {
+		if family.HusbandID != nil && *family.HusbandID == person.IndividualID {
+			return "husband"
+		}
+		if family.WifeID != nil && *family.WifeID == person.IndividualID {
+			return "wife"
+		}
+	}
+	switch person.Gender {
+	case models.GenderMale:
+		return "husband"
+	case models.GenderFemale:
+		return "wife"
+	}
+	return "partner"
+}
+
+// individualKey 个人节点ID
+func individualKey(id int) string {
+	return "I" + strconv.Itoa(id)
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"familytree/interfaces"
+	"familytree/models"
+)
+
+// fakeLineageRepo 内存中的个人、家庭和子女记录，只实现沙漏图用到的查询
+type fakeLineageRepo struct {
+	interfaces.IndividualRepository
+	interfaces.FamilyRepository
+	people   []models.Individual
+	families []models.Family
+	children []models.Child
+	names    map[int]models.AlternateNames
+}
+
+func (r *fakeLineageRepo) find(id int) *models.Individual {
+	for i := range r.people {
+		if r.people[i].IndividualID == id {
+			person := r.people[i]
+			return &person
+		}
+	}
+	return nil
+}
+
+func (r *fakeLineageRepo) GetIndividualByID(ctx context.Context, id int) (*models.Individual, error) {
+	if person := r.find(id); person != nil {
+		return person, nil
+	}
+	return nil, fmt.Errorf("个人信息不存在")
+}
+
+func (r *fakeLineageRepo) GetIndividualsByIDs(ctx context.Context, ids []int) ([]models.Individual, error) {
+	var people []models.Individual
+	for _, id := range ids {
+		if person := r.find(id); person != nil {
+			people = append(people, *person)
+		}
+	}
+	return people, nil
+}
+
+func (r *fakeLineageRepo) GetAncestorLineage(ctx context.Context, id int, generations int) ([]models.LineageEntry, error) {
+	var entries []models.LineageEntry
+	level := []int{id}
+	for generation := 1; generation <= generations && len(level) > 0; generation++ {
+		var next []int
+		for _, childID := range level {
+			child := r.find(childID)
+			for role, parentID := range map[string]*int{"father": child.FatherID, "mother": child.MotherID} {
+				if parent := r.parent(parentID); parent != nil {
+					entries = append(entries, models.LineageEntry{Individual: *parent, Generation: generation, LinkedID: childID, ParentRole: role})
+					next = append(next, parent.IndividualID)
+				}
+			}
+		}
+		level = next
+	}
+	return entries, nil
+}
+
+func (r *fakeLineageRepo) parent(id *int) *models.Individual {
+	if id == nil {
+		return nil
+	}
+	return r.find(*id)
+}
+
+func (r *fakeLineageRepo) GetDescendantLineage(ctx context.Context, id int, generations int) ([]models.LineageEntry, error) {
+	var entries []models.LineageEntry
+	level := []int{id}
+	for generation := 1; generation <= generations && len(level) > 0; generation++ {
+		var next []int
+		for _, parentID := range level {
+			for _, child := range r.people {
+				if (child.FatherID != nil && *child.FatherID == parentID) || (child.MotherID != nil && *child.MotherID == parentID) {
+					entries = append(entries, models.LineageEntry{Individual: child, Generation: generation, LinkedID: parentID})
+					next = append(next, child.IndividualID)
+				}
+			}
+		}
+		level = next
+	}
+	return entries, nil
+}
+
+func (r *fakeLineageRepo) GetAlternateNames(ctx context.Context, ids []int) (map[int]models.AlternateNames, error) {
+	return r.names, nil
+}
+
+func (r *fakeLineageRepo) GetFamiliesByIndividualIDs(ctx context.Context, individualIDs []int) ([]models.Family, error) {
+	ids := map[int]bool{}
+	for _, id := range individualIDs {
+		ids[id] = true
+	}
+	var families []models.Family
+	for _, family := range r.families {
+		if (family.HusbandID != nil && ids[*family.HusbandID]) || (family.WifeID != nil && ids[*family.WifeID]) {
+			families = append(families, family)
+		}
+	}
+	return families, nil
+}
+
+func (r *fakeLineageRepo) GetChildrenByFamilyIDs(ctx context.Context, familyIDs []int) ([]models.Child, error) {
+	var children []models.Child
+	for _, child := range r.children {
+		for _, id := range familyIDs {
+			if child.FamilyID == id {
+				children = append(children, child)
+			}
+		}
+	}
+	return children, nil
+}
+
+func TestHourglass(t *testing.T) {
+	person := func(id int, gender models.Gender, fatherID, motherID int) models.Individual {
+		p := pedigreePerson(id, fatherID, motherID)
+		p.Gender = gender
+		return p
+	}
+	repo := &fakeLineageRepo{
+		people: []models.Individual{
+			person(1, models.GenderMale, 2, 3),
+			person(2, models.GenderMale, 0, 0), person(3, models.GenderFemale, 0, 0),
+			person(4, models.GenderFemale, 0, 0), person(6, models.GenderFemale, 0, 0), person(9, models.GenderFemale, 0, 0),
+			person(5, models.GenderMale, 1, 4), person(7, models.GenderMale, 1, 6), person(8, models.GenderMale, 1, 9),
+			person(11, models.GenderMale, 5, 0),
+		},
+		families: []models.Family{
+			{FamilyID: 10, HusbandID: intPtr(2), WifeID: intPtr(3), MarriageOrder: 1},
+			{FamilyID: 20, HusbandID: intPtr(1), WifeID: intPtr(4), MarriageOrder: 1},
+			{FamilyID: 21, HusbandID: intPtr(1), WifeID: intPtr(6), MarriageOrder: 2},
+		},
+		// 7 没有子女记录，按母亲归入家庭 21；8 的母亲 9 没有家庭记录
+		children: []models.Child{
+			{FamilyID: 10, IndividualID: 1, RelationshipToParents: "birth"},
+			{FamilyID: 20, IndividualID: 5, RelationshipToParents: "adopted"},
+		},
+		names: map[int]models.AlternateNames{1: {CourtesyName: "子明"}},
+	}
+	service := NewIndividualService(repo, repo, nil)
+
+	hourglass, err := service.GetHourglass(context.Background(), 1, 1, 1)
+	if err != nil {
+		t.Fatalf("获取沙漏图失败: %v", err)
+	}
+
+	tree := hourglass.Tree
+	if tree.Individual.CourtesyName == nil || *tree.Individual.CourtesyName != "子明" {
+		t.Errorf("根节点应带有字: %+v", tree.Individual)
+	}
+	if tree.Father == nil || tree.Father.Individual.IndividualID != 2 || tree.Father.Generation != -1 ||
+		tree.Mother == nil || tree.Mother.Individual.IndividualID != 3 {
+		t.Errorf("父母: %+v, %+v", tree.Father, tree.Mother)
+	}
+
+	// 家庭按记录顺序列出，没有家庭记录的子女按另一位父母分组排在最后
+	type group struct {
+		familyID, spouseID int
+		children           []int
+	}
+	var groups []group
+	for _, f := range tree.Families {
+		g := group{}
+		if f.Family != nil {
+			g.familyID = f.Family.FamilyID
+		}
+		if f.Spouse != nil {
+			g.spouseID = f.Spouse.IndividualID
+		}
+		for _, child := range f.Children {
+			g.children = append(g.children, child.Individual.IndividualID)
+			if len(child.Families) != 0 && len(child.Families[0].Children) != 0 {
+				t.Errorf("超出代数的孙辈不应展开: %+v", child.Families)
+			}
+		}
+		groups = append(groups, g)
+	}
+	want := []group{{20, 4, []int{5}}, {21, 6, []int{7}}, {0, 9, []int{8}}}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("家庭分组: got %+v, want %+v", groups, want)
+	}
+
+	// 平铺图中每个人、每个家庭只出现一次
+	var nodes []string
+	generations := map[string]int{}
+	for _, node := range hourglass.Graph.Nodes {
+		nodes = append(nodes, node.ID)
+		generations[node.ID] = node.Generation
+	}
+	sort.Strings(nodes)
+	wantNodes := []string{"F10", "F20", "F21", "I1", "I2", "I3", "I4", "I5", "I6", "I7", "I8", "I9", "U1_9"}
+	if !reflect.DeepEqual(nodes, wantNodes) {
+		t.Errorf("节点: got %v, want %v", nodes, wantNodes)
+	}
+	if generations["F10"] != -1 || generations["U1_9"] != 0 || generations["I8"] != 1 {
+		t.Errorf("节点代数: %v", generations)
+	}
+
+	edges := map[string]string{}
+	for _, edge := range hourglass.Graph.Edges {
+		edges[edge.From+">"+edge.To] = edge.Type + ":" + edge.Role
+	}
+	wantEdges := map[string]string{
+		"F10>I1": "child:birth", "I2>F10": "partner:husband", "I3>F10": "partner:wife",
+		"I1>F20": "partner:husband", "I4>F20": "partner:wife", "F20>I5": "child:adopted",
+		"I1>F21": "partner:husband", "I6>F21": "partner:wife", "F21>I7": "child:",
+		"I1>U1_9": "partner:husband", "I9>U1_9": "partner:wife", "U1_9>I8": "child:",
+	}
+	if !reflect.DeepEqual(edges, wantEdges) {
+		t.Errorf("边: got %v, want %v", edges, wantEdges)
+	}
+	if len(hourglass.Graph.Edges) != len(wantEdges) {
+		t.Errorf("边重复: %+v", hourglass.Graph.Edges)
+	}
+}
@@ -0,0 +1,856 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"familytree/interfaces"
+	"familytree/models"
+	"familytree/pkg/errors"
+	"familytree/pkg/middleware"
+	"familytree/pkg/spreadsheet"
+)
+
+// 表格导入的限制
+const (
+	maxImportRows    = 5000
+	importSampleRows = 5
+)
+
+// importColumnAliases 推测列映射时各字段可能的表头，不区分大小写
+var importColumnAliases = []struct {
+	field   func(m *models.ImportMapping) *string
+	headers []string
+}{
+	{func(m *models.ImportMapping) *string { return &m.RowID }, []string{"编号", "序号", "id", "row_id"}},
+	{func(m *models.ImportMapping) *string { return &m.FullName }, []string{"姓名", "名字", "全名", "name", "full_name", "full name"}},
+	{func(m *models.ImportMapping) *string { return &m.Gender }, []string{"性别", "gender", "sex"}},
+	{func(m *models.ImportMapping) *string { return &m.BirthDate }, []string{"出生日期", "生日", "出生", "birth_date", "birth date", "born"}},
+	{func(m *models.ImportMapping) *string { return &m.BirthPlace }, []string{"出生地", "出生地点", "birth_place", "birth place"}},
+	{func(m *models.ImportMapping) *string { return &m.DeathDate }, []string{"去世日期", "逝世日期", "死亡日期", "卒", "death_date", "death date", "died"}},
+	{func(m *models.ImportMapping) *string { return &m.DeathPlace }, []string{"去世地点", "逝世地点", "death_place", "death place"}},
+	{func(m *models.ImportMapping) *string { return &m.Occupation }, []string{"职业", "occupation"}},
+	{func(m *models.ImportMapping) *string { return &m.Notes }, []string{"备注", "说明", "notes", "note"}},
+	{func(m *models.ImportMapping) *string { return &m.Father }, []string{"父亲", "父", "father"}},
+	{func(m *models.ImportMapping) *string { return &m.Mother }, []string{"母亲", "母", "mother"}},
+	{func(m *models.ImportMapping) *string { return &m.Spouse }, []string{"配偶", "spouse"}},
+}
+
+// importGenders 性别列可以填写的值
+var importGenders = map[string]models.Gender{
+	"男": models.GenderMale, "男性": models.GenderMale, "m": models.GenderMale, "male": models.GenderMale,
+	"女": models.GenderFemale, "女性": models.GenderFemale, "f": models.GenderFemale, "female": models.GenderFemale,
+	"其他": models.GenderOther, "other": models.GenderOther,
+	"": models.GenderUnknown, "未知": models.GenderUnknown, "不详": models.GenderUnknown, "unknown": models.GenderUnknown,
+}
+
+// importDatePattern 年、年月或年月日，分隔符为 - / . 或 年月日
+var importDatePattern = regexp.MustCompile(`^(\d{1,4})(?:[-/.年](\d{1,2})(?:[-/.月](\d{1,2})日?)?月?)?年?$`)
+
+// ImportService 表格导入服务
+type ImportService struct {
+	individualRepo interfaces.IndividualRepository
+	familyRepo     interfaces.FamilyRepository
+	recordRepo     interfaces.RecordRepository
+	familyTreeRepo interfaces.FamilyTreeRepository
+	uow            interfaces.UnitOfWork
+}
+
+// NewImportService 创建表格导入服务
+func NewImportService(individualRepo interfaces.IndividualRepository, familyRepo interfaces.FamilyRepository, recordRepo interfaces.RecordRepository, familyTreeRepo interfaces.FamilyTreeRepository, uow interfaces.UnitOfWork) interfaces.ImportService {
+	return &ImportService{
+		individualRepo: individualRepo,
+		familyRepo:     familyRepo,
+		recordRepo:     recordRepo,
+		familyTreeRepo: familyTreeRepo,
+		uow:            uow,
+	}
+}
+
+// Columns 读取上传的表格，返回表头、前几行和按表头推测的列映射
+func (s *ImportService) Columns(ctx context.Context, userID, familyTreeID int, file io.Reader, filename, sheet string) (*models.ImportColumns, error) {
+	if _, err := ownedFamilyTree(ctx, s.familyTreeRepo, userID, familyTreeID); err != nil {
+		return nil, err
+	}
+	table, err := readImportTable(file, filename, sheet)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := &models.ImportColumns{
+		Sheet:   table.Sheet,
+		Columns: table.Header,
+		Sample:  [][]string{},
+		Rows:    len(table.Rows),
+		Mapping: suggestImportMapping(table.Header),
+	}
+	for i := 0; i < len(table.Rows) && i < importSampleRows; i++ {
+		columns.Sample = append(columns.Sample, table.Rows[i].Cells)
+	}
+	return columns, nil
+}
+
+// Import 按列映射校验每一行，没有错误且不是预览时在一个事务中导入：新建个人，与已有的人匹配的行只补充其空缺的父母，
+// 再为父母和配偶建立家庭（婚姻）及子女关系。任一行有错误时不做任何修改
+func (s *ImportService) Import(ctx context.Context, userID, familyTreeID int, file io.Reader, filename string, req *models.ImportRequest) (*models.ImportResult, error) {
+	if _, err := ownedFamilyTree(ctx, s.familyTreeRepo, userID, familyTreeID); err != nil {
+		return nil, err
+	}
+	table, err := readImportTable(file, filename, req.Sheet)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := resolveImportColumns(table, req.Mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.DryRun {
+		plan, err := s.plan(ctx, familyTreeID, table, columns, !req.NoMatch)
+		if err != nil {
+			return nil, err
+		}
+		return plan.result(true), nil
+	}
+
+	// 校验和导入在同一事务中，校验时读取的已有记录与导入时一致
+	return inTransaction(ctx, s.uow, func(ctx context.Context) (*models.ImportResult, error) {
+		plan, err := s.plan(ctx, familyTreeID, table, columns, !req.NoMatch)
+		if err != nil {
+			return nil, err
+		}
+		result := plan.result(false)
+		if result.Summary.Invalid > 0 {
+			return result, nil
+		}
+		if result.Summary.Families, err = s.apply(ctx, userID, familyTreeID, plan); err != nil {
+			return nil, err
+		}
+		result.Applied = true
+		result.ChangeSet, _ = middleware.GetChangeSetFromContext(ctx)
+		return result, nil
+	})
+}
+
+// readImportTable 按文件扩展名读取 CSV 或 XLSX
+func readImportTable(file io.Reader, filename, sheet string) (*spreadsheet.Table, error) {
+	format, ok := spreadsheet.FormatFromName(filename)
+	if !ok {
+		return nil, errors.New(errors.ErrCodeInvalidInput, "只支持 CSV 和 XLSX 文件")
+	}
+	table, err := spreadsheet.Read(file, format, spreadsheet.ReadOptions{Sheet: sheet, MaxRows: maxImportRows})
+	if err != nil {
+		return nil, errors.New(errors.ErrCodeInvalidInput, err.Error())
+	}
+	return table, nil
+}
+
+// suggestImportMapping 按表头推测列映射，每列只映射一次
+func suggestImportMapping(header []string) models.ImportMapping {
+	var mapping models.ImportMapping
+	used := make(map[string]bool)
+	for _, alias := range importColumnAliases {
+		for _, column := range header {
+			if used[column] || !containsFold(alias.headers, column) {
+				continue
+			}
+			*alias.field(&mapping) = column
+			used[column] = true
+			break
+		}
+	}
+	return mapping
+}
+
+// containsFold names 中是否有与 s 不区分大小写相同的
+func containsFold(names []string, s string) bool {
+	for _, name := range names {
+		if strings.EqualFold(name, strings.TrimSpace(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// importColumns 映射到的列序号，未映射的为 -1
+type importColumns struct {
+	rowID, fullName, gender, birthDate, birthPlace, deathDate, deathPlace, occupation, notes, father, mother, spouse int
+}
+
+// resolveImportColumns 把列映射中的表头转换为列序号，姓名列必须映射
+func resolveImportColumns(table *spreadsheet.Table, mapping models.ImportMapping) (*importColumns, error) {
+	if mapping.FullName == "" {
+		return nil, errors.New(errors.ErrCodeInvalidInput, "必须指定姓名列")
+	}
+	var missing []string
+	column := func(header string) int {
+		if header == "" {
+			return -1
+		}
+		i := table.Column(header)
+		if i < 0 {
+			missing = append(missing, header)
+		}
+		return i
+	}
+	columns := &importColumns{
+		rowID:      column(mapping.RowID),
+		fullName:   column(mapping.FullName),
+		gender:     column(mapping.Gender),
+		birthDate:  column(mapping.BirthDate),
+		birthPlace: column(mapping.BirthPlace),
+		deathDate:  column(mapping.DeathDate),
+		deathPlace: column(mapping.DeathPlace),
+		occupation: column(mapping.Occupation),
+		notes:      column(mapping.Notes),
+		father:     column(mapping.Father),
+		mother:     column(mapping.Mother),
+		spouse:     column(mapping.Spouse),
+	}
+	if len(missing) > 0 {
+		return nil, errors.New(errors.ErrCodeInvalidInput, fmt.Sprintf("表格中没有列: %s", strings.Join(missing, "、")))
+	}
+	return columns, nil
+}
+
+// importRef 父母或配偶：表格中的一行，或家族树中已有的人
+type importRef struct {
+	row      *importRow
+	existing *models.Individual
+}
+
+// key 区分不同的人：与已有的人匹配的行和直接引用已有的人相同
+func (r *importRef) key() string {
+	if r.existing != nil {
+		return "i" + strconv.Itoa(r.existing.IndividualID)
+	}
+	if r.row.match != nil {
+		return "i" + strconv.Itoa(r.row.match.IndividualID)
+	}
+	return "r" + strconv.Itoa(r.row.result.Row)
+}
+
+// gender 引用的人的性别
+func (r *importRef) gender() models.Gender {
+	if r.existing != nil {
+		return r.existing.Gender
+	}
+	return r.row.individual.Gender
+}
+
+// name 引用的人的姓名
+func (r *importRef) name() string {
+	if r.existing != nil {
+		return r.existing.FullName
+	}
+	return r.row.individual.FullName
+}
+
+// id 引用的人的个人ID，表格中的行须已导入
+func (r *importRef) id() int {
+	if r.existing != nil {
+		return r.existing.IndividualID
+	}
+	return r.row.id()
+}
+
+// importRow 表格中的一行
+type importRow struct {
+	result     *models.ImportRowResult
+	cells      spreadsheet.Row
+	key        string
+	individual models.Individual
+	birthPlace string
+	deathPlace string
+
+	father, mother, spouse *importRef
+	match                  *models.Individual // 匹配到的已有个人
+	setFather, setMother   bool               // 为匹配到的个人补充空缺的父母
+}
+
+// id 匹配到的已有个人或导入后新建的个人
+func (r *importRow) id() int {
+	if r.result.IndividualID == nil {
+		return 0
+	}
+	return *r.result.IndividualID
+}
+
+func (r *importRow) errorf(format string, args ...interface{}) {
+	r.result.Errors = append(r.result.Errors, fmt.Sprintf(format, args...))
+}
+
+func (r *importRow) warnf(format string, args ...interface{}) {
+	r.result.Warnings = append(r.result.Warnings, fmt.Sprintf(format, args...))
+}
+
+// importFamily 导入时要建立的家庭（婚姻），child 不为空时同时建立子女关系
+type importFamily struct {
+	husband, wife *importRef
+	child         *importRow
+}
+
+// importPlan 校验后的导入计划
+type importPlan struct {
+	rows     []*importRow
+	results  []models.ImportRowResult
+	families []importFamily
+	newPairs int
+}
+
+// result 按计划生成的结果，此时尚未导入
+func (p *importPlan) result(dryRun bool) *models.ImportResult {
+	result := &models.ImportResult{DryRun: dryRun, Rows: p.results}
+	result.Summary.Rows = len(p.results)
+	for _, row := range p.results {
+		switch {
+		case len(row.Errors) > 0:
+			result.Summary.Invalid++
+		case row.Action == models.ImportActionCreate:
+			result.Summary.Create++
+		case row.Action == models.ImportActionMatch:
+			result.Summary.Match++
+		}
+	}
+	result.Summary.Families = p.newPairs
+	return result
+}
+
+// plan 解析并校验每一行，匹配已有的人，解析父母和配偶的引用，列出要建立的家庭
+func (s *ImportService) plan(ctx context.Context, familyTreeID int, table *spreadsheet.Table, columns *importColumns, match bool) (*importPlan, error) {
+	existing, err := s.individualRepo.GetIndividualsByFamilyTreeID(ctx, familyTreeID)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "查询家族树成员失败")
+	}
+	existingByName := make(map[string][]*models.Individual)
+	for i := range existing {
+		existingByName[existing[i].FullName] = append(existingByName[existing[i].FullName], &existing[i])
+	}
+
+	plan := &importPlan{results: make([]models.ImportRowResult, len(table.Rows))}
+	byKey := make(map[string]*importRow)
+	byName := make(map[string][]*importRow)
+	for i, cells := range table.Rows {
+		plan.results[i] = models.ImportRowResult{Row: cells.Number, FullName: cells.Value(columns.fullName)}
+		row := parseImportRow(cells, columns, &plan.results[i])
+		plan.rows = append(plan.rows, row)
+		if other, exists := byKey[row.key]; exists {
+			row.errorf("编号 %s 与第 %d 行重复", row.key, other.result.Row)
+		} else {
+			byKey[row.key] = row
+		}
+		if row.individual.FullName != "" {
+			byName[row.individual.FullName] = append(byName[row.individual.FullName], row)
+		}
+	}
+
+	// 与家族树中已有的人匹配：姓名相同，性别和出生年份不矛盾
+	if match {
+		matchedBy := make(map[int]*importRow)
+		for _, row := range plan.rows {
+			if row.individual.FullName == "" {
+				continue
+			}
+			var candidates []*models.Individual
+			for _, person := range existingByName[row.individual.FullName] {
+				if sameImportPerson(&row.individual, person) {
+					candidates = append(candidates, person)
+				}
+			}
+			switch {
+			case len(candidates) == 1:
+				if other, ok := matchedBy[candidates[0].IndividualID]; ok {
+					row.errorf("与第 %d 行匹配到同一人（ID %d）", other.result.Row, candidates[0].IndividualID)
+					continue
+				}
+				row.match = candidates[0]
+				matchedBy[row.match.IndividualID] = row
+			case len(candidates) > 1:
+				ids := make([]string, len(candidates))
+				for i, candidate := range candidates {
+					ids[i] = strconv.Itoa(candidate.IndividualID)
+				}
+				row.errorf("家族树中有 %d 个可能是同一人的“%s”（ID %s），请补充性别或出生日期以区分", len(candidates), row.individual.FullName, strings.Join(ids, "、"))
+			}
+		}
+	}
+
+	resolve := func(row *importRow, column int, role string) *importRef {
+		value := row.cells.Value(column)
+		if value == "" {
+			return nil
+		}
+		ref, msg := resolveImportRef(value, byKey, byName, existingByName)
+		if msg != "" {
+			row.errorf("%s%s", role, msg)
+			return nil
+		}
+		if ref.row == row || (ref.existing != nil && row.match != nil && ref.existing.IndividualID == row.match.IndividualID) {
+			row.errorf("%s不能是本人", role)
+			return nil
+		}
+		return ref
+	}
+
+	for _, row := range plan.rows {
+		row.father = resolve(row, columns.father, "父亲")
+		row.mother = resolve(row, columns.mother, "母亲")
+		row.spouse = resolve(row, columns.spouse, "配偶")
+
+		if row.father != nil && row.father.gender() == models.GenderFemale {
+			row.errorf("父亲“%s”是女性", row.father.name())
+		}
+		if row.mother != nil && row.mother.gender() == models.GenderMale {
+			row.errorf("母亲“%s”是男性", row.mother.name())
+		}
+		if row.father != nil && row.mother != nil && row.father.key() == row.mother.key() {
+			row.errorf("父亲和母亲不能是同一个人")
+		}
+
+		if row.match != nil {
+			row.setFather = row.checkMatchedParent(row.father, row.match.FatherID, "父亲")
+			row.setMother = row.checkMatchedParent(row.mother, row.match.MotherID, "母亲")
+		}
+	}
+
+	// 表格中的父母关系不能形成循环
+	for _, row := range plan.rows {
+		if row.inParentCycle() {
+			row.errorf("父母关系形成循环")
+		}
+	}
+
+	for _, row := range plan.rows {
+		if len(row.result.Errors) > 0 {
+			continue
+		}
+		if row.match != nil {
+			row.result.Action = models.ImportActionMatch
+			row.result.IndividualID = &row.match.IndividualID
+		} else {
+			row.result.Action = models.ImportActionCreate
+		}
+	}
+
+	// 家庭：父母双全的行为父母建立婚姻和子女关系，配偶列建立婚姻，同一对夫妻只建立一次
+	pairs := make(map[string]bool)
+	addFamily := func(family importFamily) error {
+		key := family.husband.key() + "-" + family.wife.key()
+		if family.child == nil && pairs[key] {
+			return nil
+		}
+		if !pairs[key] {
+			pairs[key] = true
+			married, err := s.married(ctx, family.husband, family.wife)
+			if err != nil {
+				return errors.Wrap(err, errors.ErrCodeInternalError, "查询家庭关系失败")
+			}
+			if !married {
+				plan.newPairs++
+			}
+		}
+		plan.families = append(plan.families, family)
+		return nil
+	}
+	for _, row := range plan.rows {
+		if row.father != nil && row.mother != nil {
+			if err := addFamily(importFamily{husband: row.father, wife: row.mother, child: row}); err != nil {
+				return nil, err
+			}
+		}
+		if row.spouse == nil {
+			continue
+		}
+		self := &importRef{row: row}
+		husband, wife, msg := importCouple(self, row.spouse)
+		if msg != "" {
+			row.errorf("%s", msg)
+			row.result.Action = ""
+			row.result.IndividualID = nil
+			continue
+		}
+		if err := addFamily(importFamily{husband: husband, wife: wife}); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// married 两人是否已有婚姻，任一方是新建的个人时为否
+func (s *ImportService) married(ctx context.Context, husband, wife *importRef) (bool, error) {
+	husbandKey, wifeKey := husband.key(), wife.key()
+	if husbandKey[0] != 'i' || wifeKey[0] != 'i' {
+		return false, nil
+	}
+	husbandID, _ := strconv.Atoi(husbandKey[1:])
+	wifeID, _ := strconv.Atoi(wifeKey[1:])
+	family, err := s.findFamily(ctx, husbandID, wifeID)
+	return family != nil, err
+}
+
+// checkMatchedParent 匹配到的个人已有不同的父（母）亲时给出警告，返回是否需要补充
+func (r *importRow) checkMatchedParent(parent *importRef, current *int, role string) bool {
+	if parent == nil {
+		return false
+	}
+	if current == nil {
+		return true
+	}
+	if parent.key() != "i"+strconv.Itoa(*current) {
+		r.warnf("已有%s（ID %d），表格中的“%s”未导入为%s", role, *current, parent.name(), role)
+	}
+	return false
+}
+
+// inParentCycle 沿表格中的父母向上是否会回到本行
+func (r *importRow) inParentCycle() bool {
+	seen := make(map[*importRow]bool)
+	pending := []*importRow{r}
+	for len(pending) > 0 {
+		row := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		for _, parent := range []*importRef{row.father, row.mother} {
+			if parent == nil || parent.row == nil {
+				continue
+			}
+			if parent.row == r {
+				return true
+			}
+			if !seen[parent.row] {
+				seen[parent.row] = true
+				pending = append(pending, parent.row)
+			}
+		}
+	}
+	return false
+}
+
+// parseImportRow 解析一行的字段，格式错误记在行的错误中
+func parseImportRow(cells spreadsheet.Row, columns *importColumns, result *models.ImportRowResult) *importRow {
+	row := &importRow{result: result, cells: cells, key: strconv.Itoa(cells.Number)}
+	if columns.rowID >= 0 {
+		if row.key = cells.Value(columns.rowID); row.key == "" {
+			row.errorf("编号为空")
+		}
+	}
+
+	row.individual.FullName = cells.Value(columns.fullName)
+	if row.individual.FullName == "" {
+		row.errorf("姓名为空")
+	}
+
+	gender, ok := importGenders[strings.ToLower(cells.Value(columns.gender))]
+	if !ok {
+		row.errorf("无法识别的性别“%s”", cells.Value(columns.gender))
+	}
+	row.individual.Gender = gender
+
+	parseDate := func(column int, role string) *time.Time {
+		value := cells.Value(column)
+		if value == "" {
+			return nil
+		}
+		date, partial, ok := parseImportDate(value)
+		if !ok {
+			row.errorf("无法识别的%s“%s”", role, value)
+			return nil
+		}
+		if partial {
+			row.warnf("%s“%s”不完整，缺少的月、日按 1 计", role, value)
+		}
+		return date
+	}
+	row.individual.BirthDate = parseDate(columns.birthDate, "出生日期")
+	row.individual.DeathDate = parseDate(columns.deathDate, "去世日期")
+	if row.individual.BirthDate != nil && row.individual.DeathDate != nil && row.individual.DeathDate.Before(*row.individual.BirthDate) {
+		row.errorf("去世日期早于出生日期")
+	}
+
+	row.birthPlace = cells.Value(columns.birthPlace)
+	row.deathPlace = cells.Value(columns.deathPlace)
+	row.individual.Occupation = cells.Value(columns.occupation)
+	row.individual.Notes = cells.Value(columns.notes)
+	return row
+}
+
+// parseImportDate 解析 YYYY-MM-DD、YYYY/M/D、YYYY年M月D日 以及只有年或年月的日期，partial 表示缺少月或日
+func parseImportDate(value string) (date *time.Time, partial bool, ok bool) {
+	value = strings.TrimSpace(value)
+	if i := strings.IndexAny(value, " T"); i > 0 {
+		value = value[:i]
+	}
+	m := importDatePattern.FindStringSubmatch(value)
+	if m == nil {
+		return nil, false, false
+	}
+	year, _ := strconv.Atoi(m[1])
+	month, day := 1, 1
+	if m[2] != "" {
+		month, _ = strconv.Atoi(m[2])
+	}
+	if m[3] != "" {
+		day, _ = strconv.Atoi(m[3])
+	}
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if year == 0 || t.Month() != time.Month(month) || t.Day() != day || t.After(time.Now()) {
+		return nil, false, false
+	}
+	return &t, m[3] == "", true
+}
+
+// sameImportPerson 表格中的人是否可能是已有的这个人：性别和出生年份都已知时必须相同
+func sameImportPerson(row *models.Individual, person *models.Individual) bool {
+	if knownGender(row.Gender) && knownGender(person.Gender) && row.Gender != person.Gender {
+		return false
+	}
+	if row.BirthDate != nil && person.BirthDate != nil && row.BirthDate.Year() != person.BirthDate.Year() {
+		return false
+	}
+	return true
+}
+
+// knownGender 性别是否为男或女
+func knownGender(gender models.Gender) bool {
+	return gender == models.GenderMale || gender == models.GenderFemale
+}
+
+// resolveImportRef 解析父母、配偶列的值："#编号" 引用表格中的行，否则按姓名先在表格中、再在家族树中查找，
+// 找不到或有多个同名时返回错误说明
+func resolveImportRef(value string, byKey map[string]*importRow, byName map[string][]*importRow, existingByName map[string][]*models.Individual) (*importRef, string) {
+	if key, ok := strings.CutPrefix(value, "#"); ok {
+		row, exists := byKey[strings.TrimSpace(key)]
+		if !exists {
+			return nil, fmt.Sprintf("引用的 %s 在表格中不存在", value)
+		}
+		return &importRef{row: row}, ""
+	}
+
+	switch rows := byName[value]; len(rows) {
+	case 1:
+		return &importRef{row: rows[0]}, ""
+	case 0:
+	default:
+		return nil, fmt.Sprintf("“%s”在表格中有 %d 行，请用 #编号 引用", value, len(rows))
+	}
+	switch people := existingByName[value]; len(people) {
+	case 1:
+		return &importRef{existing: people[0]}, ""
+	case 0:
+		return nil, fmt.Sprintf("“%s”不在表格和家族树中", value)
+	default:
+		return nil, fmt.Sprintf("家族树中有 %d 个“%s”，请在表格中加入此人并用 #编号 引用", len(people), value)
+	}
+}
+
+// importCouple 按性别确定夫妻，一方性别未知时按另一方确定
+func importCouple(self, spouse *importRef) (husband, wife *importRef, msg string) {
+	selfGender, spouseGender := self.gender(), spouse.gender()
+	switch {
+	case selfGender == models.GenderMale && spouseGender != models.GenderMale,
+		selfGender != models.GenderFemale && spouseGender == models.GenderFemale:
+		return self, spouse, ""
+	case selfGender == models.GenderFemale && spouseGender != models.GenderFemale,
+		selfGender != models.GenderMale && spouseGender == models.GenderMale:
+		return spouse, self, ""
+	case knownGender(selfGender) && selfGender == spouseGender:
+		return nil, nil, fmt.Sprintf("与配偶“%s”性别相同", spouse.name())
+	}
+	return nil, nil, fmt.Sprintf("无法确定与配偶“%s”中的丈夫和妻子，请填写性别", spouse.name())
+}
+
+// apply 按计划导入：先父母后子女地新建个人，为匹配到的个人补充父母，再建立家庭和子女关系，返回新建的家庭数
+func (s *ImportService) apply(ctx context.Context, userID, familyTreeID int, plan *importPlan) (int, error) {
+	places, err := s.placeIDs(ctx, familyTreeID, plan.rows)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, row := range plan.rows {
+		if row.match != nil {
+			row.individual = *row.match
+		}
+	}
+
+	var create func(row *importRow) error
+	create = func(row *importRow) error {
+		if row.result.IndividualID != nil {
+			return nil
+		}
+		individual := row.individual
+		for _, parent := range []struct {
+			ref *importRef
+			id  **int
+		}{{row.father, &individual.FatherID}, {row.mother, &individual.MotherID}} {
+			if parent.ref == nil {
+				continue
+			}
+			if parent.ref.row != nil {
+				if err := create(parent.ref.row); err != nil {
+					return err
+				}
+			}
+			id := parent.ref.id()
+			*parent.id = &id
+		}
+
+		if row.birthPlace != "" {
+			individual.BirthPlace = &row.birthPlace
+			individual.BirthPlaceID = places[row.birthPlace]
+		}
+		if row.deathPlace != "" {
+			individual.DeathPlace = &row.deathPlace
+			individual.DeathPlaceID = places[row.deathPlace]
+		}
+
+		created, err := s.individualRepo.CreateIndividualInTree(ctx, userID, familyTreeID, &individual)
+		if err != nil {
+			return fmt.Errorf("第 %d 行导入失败: %v", row.result.Row, err)
+		}
+		row.individual = *created
+		row.result.IndividualID = &created.IndividualID
+		return nil
+	}
+	for _, row := range plan.rows {
+		if err := create(row); err != nil {
+			return 0, errors.Wrap(err, errors.ErrCodeInternalError, "导入失败")
+		}
+	}
+
+	for _, row := range plan.rows {
+		if !row.setFather && !row.setMother {
+			continue
+		}
+		individual := *row.match
+		if row.setFather {
+			id := row.father.id()
+			individual.FatherID = &id
+		}
+		if row.setMother {
+			id := row.mother.id()
+			individual.MotherID = &id
+		}
+		updated, err := s.individualRepo.UpdateIndividual(ctx, individual.IndividualID, &individual)
+		if err != nil {
+			return 0, errors.Wrap(err, errors.ErrCodeInternalError, fmt.Sprintf("第 %d 行补充父母失败", row.result.Row))
+		}
+		row.individual = *updated
+	}
+
+	created := 0
+	for _, family := range plan.families {
+		husbandID, wifeID := family.husband.id(), family.wife.id()
+		existing, err := s.findFamily(ctx, husbandID, wifeID)
+		if err != nil {
+			return 0, errors.Wrap(err, errors.ErrCodeInternalError, "查询家庭关系失败")
+		}
+		if existing == nil {
+			if existing, err = s.createFamily(ctx, husbandID, wifeID); err != nil {
+				return 0, errors.Wrap(err, errors.ErrCodeInternalError, "创建家庭关系失败")
+			}
+			created++
+		}
+		if family.child != nil {
+			if err := s.linkImportedChild(ctx, existing, family.child); err != nil {
+				return 0, errors.Wrap(err, errors.ErrCodeInternalError, fmt.Sprintf("第 %d 行创建子女关系失败", family.child.result.Row))
+			}
+		}
+	}
+	return created, nil
+}
+
+// placeIDs 表格中出生地、去世地对应的家族树中的地点，只有一个同名地点时才关联
+func (s *ImportService) placeIDs(ctx context.Context, familyTreeID int, rows []*importRow) (map[string]*int, error) {
+	var names []string
+	seen := make(map[string]bool)
+	for _, row := range rows {
+		for _, name := range []string{row.birthPlace, row.deathPlace} {
+			if name != "" && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	places, err := s.recordRepo.GetPlacesByNames(ctx, familyTreeID, names)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "查询地点失败")
+	}
+
+	ids := make(map[string]*int)
+	count := make(map[string]int)
+	for i := range places {
+		ids[places[i].PlaceName] = &places[i].PlaceID
+		count[places[i].PlaceName]++
+	}
+	for name, n := range count {
+		if n > 1 {
+			delete(ids, name)
+		}
+	}
+	return ids, nil
+}
+
+// findFamily 两人之间的家庭，没有时返回 nil
+func (s *ImportService) findFamily(ctx context.Context, husbandID, wifeID int) (*models.Family, error) {
+	families, err := s.familyRepo.GetFamiliesByIndividualID(ctx, husbandID)
+	if err != nil {
+		return nil, err
+	}
+	for i, family := range families {
+		if family.HusbandID != nil && *family.HusbandID == husbandID && family.WifeID != nil && *family.WifeID == wifeID {
+			return &families[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// createFamily 建立婚姻，婚姻顺序排在丈夫已有的婚姻之后
+func (s *ImportService) createFamily(ctx context.Context, husbandID, wifeID int) (*models.Family, error) {
+	families, err := s.familyRepo.GetFamiliesByIndividualID(ctx, husbandID)
+	if err != nil {
+		return nil, err
+	}
+	marriageOrder := 1
+	for _, family := range families {
+		if family.HusbandID != nil && *family.HusbandID == husbandID && family.MarriageOrder >= marriageOrder {
+			marriageOrder = family.MarriageOrder + 1
+		}
+	}
+	return s.familyRepo.CreateFamily(ctx, &models.Family{
+		HusbandID:     &husbandID,
+		WifeID:        &wifeID,
+		MarriageOrder: marriageOrder,
+	})
+}
+
+// linkImportedChild 子女的父母正是这对夫妻且尚未建立子女关系时建立
+func (s *ImportService) linkImportedChild(ctx context.Context, family *models.Family, row *importRow) error {
+	individual := row.individual
+	if individual.FatherID == nil || individual.MotherID == nil ||
+		*individual.FatherID != *family.HusbandID || *individual.MotherID != *family.WifeID {
+		return nil
+	}
+	children, err := s.familyRepo.GetChildrenByFamilyID(ctx, family.FamilyID)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if child.IndividualID == individual.IndividualID {
+			return nil
+		}
+	}
+	child := &models.Child{
+		FamilyID:              family.FamilyID,
+		IndividualID:          individual.IndividualID,
+		RelationshipToParents: "生子",
+	}
+	if individual.Gender == models.GenderFemale {
+		child.RelationshipToParents = "生女"
+	}
+	_, err = s.familyRepo.CreateChild(ctx, child)
+	return err
+}
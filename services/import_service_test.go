@@ -0,0 +1,205 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"familytree/interfaces"
+	"familytree/models"
+	"familytree/repository"
+)
+
+// importHeader 测试表格的表头，按表头推测的映射覆盖全部列
+const importHeader = "编号,姓名,性别,出生日期,父亲,母亲,配偶\n"
+
+// runImport 以 CSV 内容导入到家族树
+func runImport(tb testing.TB, service interfaces.ImportService, userID, familyTreeID int, csv string, req models.ImportRequest) *models.ImportResult {
+	tb.Helper()
+	result, err := service.Import(context.Background(), userID, familyTreeID, strings.NewReader(csv), "people.csv", &req)
+	if err != nil {
+		tb.Fatalf("导入失败: %v", err)
+	}
+	return result
+}
+
+// importMapping 测试表格的列映射
+func importMapping() models.ImportMapping {
+	return suggestImportMapping(strings.Split(strings.TrimSpace(importHeader), ","))
+}
+
+func TestImportColumns(t *testing.T) {
+	repo := newTestRepository(t)
+	userID, familyTreeID := newTestTree(t, repo, "columns")
+	service := NewImportService(repo, repo, repo, repo, repo)
+
+	columns, err := service.Columns(context.Background(), userID, familyTreeID,
+		strings.NewReader("ID,Full Name,性别,born,备注,Unknown\n1,陈一,男,1950,,x\n"), "people.csv", "")
+	if err != nil {
+		t.Fatalf("读取表头失败: %v", err)
+	}
+	want := models.ImportMapping{RowID: "ID", FullName: "Full Name", Gender: "性别", BirthDate: "born", Notes: "备注"}
+	if columns.Mapping != want || columns.Rows != 1 || len(columns.Sample) != 1 {
+		t.Errorf("列映射: %+v", columns)
+	}
+
+	// 姓名列必须映射，映射的列必须在表格中
+	for _, mapping := range []models.ImportMapping{{Gender: "性别"}, {FullName: "姓名", Father: "父"}} {
+		req := &models.ImportRequest{Mapping: mapping}
+		if _, err := service.Import(context.Background(), userID, familyTreeID, strings.NewReader(importHeader), "people.csv", req); err == nil {
+			t.Errorf("%+v: 应返回错误", mapping)
+		}
+	}
+}
+
+func TestImportDryRunAndApply(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+	userID, familyTreeID := newTestTree(t, repo, "import")
+	service := NewImportService(repo, repo, repo, repo, repo)
+	csv := importHeader +
+		"1,陈父,男,1920,,,#2\n" +
+		"2,陈母,女,1922,,,\n" +
+		"3,陈子,男,1950/3/5,#1,陈母,\n"
+
+	// 预览只校验，不做修改
+	result := runImport(t, service, userID, familyTreeID, csv, models.ImportRequest{Mapping: importMapping(), DryRun: true})
+	want := models.ImportSummary{Rows: 3, Create: 3, Families: 1}
+	if result.Summary != want || result.Applied || !result.DryRun {
+		t.Fatalf("预览结果: %+v", result)
+	}
+	if size := treeSize(t, repo, familyTreeID); size != 0 {
+		t.Fatalf("预览不应导入: %d", size)
+	}
+
+	result = runImport(t, service, userID, familyTreeID, csv, models.ImportRequest{Mapping: importMapping()})
+	if result.Summary != want || !result.Applied {
+		t.Fatalf("导入结果: %+v", result)
+	}
+	if size := treeSize(t, repo, familyTreeID); size != 3 {
+		t.Fatalf("应导入 3 人: %d", size)
+	}
+	ids := make([]int, 3)
+	for i, row := range result.Rows {
+		if row.IndividualID == nil {
+			t.Fatalf("第 %d 行没有个人ID: %+v", row.Row, row)
+		}
+		ids[i] = *row.IndividualID
+	}
+	child, err := repo.GetIndividualByID(ctx, ids[2])
+	if err != nil || child.FatherID == nil || *child.FatherID != ids[0] || child.MotherID == nil || *child.MotherID != ids[1] {
+		t.Fatalf("子女的父母: %+v, %v", child, err)
+	}
+	if child.BirthDate == nil || child.BirthDate.Format("2006-01-02") != "1950-03-05" {
+		t.Errorf("出生日期: %v", child.BirthDate)
+	}
+	families, err := repo.GetFamiliesByIndividualID(ctx, ids[0])
+	if err != nil || len(families) != 1 || *families[0].WifeID != ids[1] {
+		t.Fatalf("配偶列和父母应只建立一个家庭: %+v, %v", families, err)
+	}
+	children, err := repo.GetChildrenByFamilyID(ctx, families[0].FamilyID)
+	if err != nil || len(children) != 1 || children[0].IndividualID != ids[2] {
+		t.Errorf("子女关系: %+v, %v", children, err)
+	}
+}
+
+func TestImportMatching(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+	userID, familyTreeID := newTestTree(t, repo, "matching")
+	service := NewImportService(repo, repo, repo, repo, repo)
+	create := func(name string, gender models.Gender) int {
+		t.Helper()
+		person, err := repo.CreateIndividualInTree(ctx, userID, familyTreeID, &models.Individual{FullName: name, Gender: gender})
+		if err != nil {
+			t.Fatalf("创建个人失败: %v", err)
+		}
+		return person.IndividualID
+	}
+	father := create("陈父", models.GenderMale)
+	son := create("陈子", models.GenderMale)
+	create("陈二", models.GenderMale)
+	create("陈二", models.GenderMale)
+	create("陈三", models.GenderFemale)
+
+	// 陈子与已有的人匹配，补充空缺的父亲；陈二有两个可能的人；性别不同的陈三不匹配
+	csv := importHeader +
+		"1,陈子,男,,陈父,,\n" +
+		"2,陈二,,,,,\n" +
+		"3,陈三,男,,,,\n"
+	result := runImport(t, service, userID, familyTreeID, csv, models.ImportRequest{Mapping: importMapping(), DryRun: true})
+	actions := []string{result.Rows[0].Action, result.Rows[1].Action, result.Rows[2].Action}
+	if !reflect.DeepEqual(actions, []string{models.ImportActionMatch, "", models.ImportActionCreate}) {
+		t.Fatalf("匹配结果: %+v", result.Rows)
+	}
+	if *result.Rows[0].IndividualID != son || len(result.Rows[1].Errors) != 1 {
+		t.Errorf("匹配结果: %+v", result.Rows)
+	}
+
+	result = runImport(t, service, userID, familyTreeID, importHeader+"1,陈子,男,,陈父,,\n", models.ImportRequest{Mapping: importMapping()})
+	if !result.Applied || result.Summary.Match != 1 || result.Summary.Create != 0 {
+		t.Fatalf("导入结果: %+v", result)
+	}
+	if person, err := repo.GetIndividualByID(ctx, son); err != nil || person.FatherID == nil || *person.FatherID != father {
+		t.Errorf("应为匹配到的个人补充父亲: %+v, %v", person, err)
+	}
+
+	// 不匹配时每行都新建
+	result = runImport(t, service, userID, familyTreeID, importHeader+"1,陈二,男,,,,\n", models.ImportRequest{Mapping: importMapping(), DryRun: true, NoMatch: true})
+	if result.Summary.Create != 1 || result.Summary.Invalid != 0 {
+		t.Errorf("不匹配时应新建: %+v", result.Summary)
+	}
+}
+
+func TestImportParentCycle(t *testing.T) {
+	repo := newTestRepository(t)
+	userID, familyTreeID := newTestTree(t, repo, "cycle")
+	service := NewImportService(repo, repo, repo, repo, repo)
+
+	csv := importHeader +
+		"1,甲,男,,#2,,\n" +
+		"2,乙,男,,#1,,\n" +
+		"3,丙,男,,#1,,\n"
+	result := runImport(t, service, userID, familyTreeID, csv, models.ImportRequest{Mapping: importMapping()})
+	if result.Applied || result.Summary.Invalid != 2 || result.Summary.Create != 1 {
+		t.Fatalf("父母循环应拒绝导入: %+v", result)
+	}
+	for _, row := range result.Rows[:2] {
+		if !reflect.DeepEqual(row.Errors, []string{"父母关系形成循环"}) {
+			t.Errorf("第 %d 行: %+v", row.Row, row.Errors)
+		}
+	}
+	if size := treeSize(t, repo, familyTreeID); size != 0 {
+		t.Errorf("有错误时不应导入: %d", size)
+	}
+}
+
+// failingFamilyRepo 建立家庭时失败，其余操作使用测试数据库
+type failingFamilyRepo struct {
+	*repository.SQLiteRepository
+}
+
+func (r failingFamilyRepo) CreateFamily(ctx context.Context, family *models.Family) (*models.Family, error) {
+	return nil, fmt.Errorf("模拟的数据库错误")
+}
+
+func TestImportRollback(t *testing.T) {
+	repo := newTestRepository(t)
+	userID, familyTreeID := newTestTree(t, repo, "rollback")
+	service := NewImportService(repo, failingFamilyRepo{repo}, repo, repo, repo)
+
+	// 个人已新建后建立家庭失败，整个导入回滚
+	csv := importHeader +
+		"1,陈父,男,,,,\n" +
+		"2,陈母,女,,,,\n" +
+		"3,陈子,男,,#1,#2,\n"
+	req := &models.ImportRequest{Mapping: importMapping()}
+	if _, err := service.Import(context.Background(), userID, familyTreeID, strings.NewReader(csv), "people.csv", req); err == nil {
+		t.Fatal("建立家庭失败时应返回错误")
+	}
+	if size := treeSize(t, repo, familyTreeID); size != 0 {
+		t.Errorf("已新建的个人应回滚: %d", size)
+	}
+}
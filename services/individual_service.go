@@ -9,22 +9,54 @@ import (
 	"familytree/models"
 )
 
+// IndividualServiceConfig 个人信息服务配置
+type IndividualServiceConfig struct {
+	// 祖先、后代和家族树查询允许的最大代数
+	MaxGenerations int
+}
+
+// DefaultIndividualServiceConfig 返回默认的个人信息服务配置
+func DefaultIndividualServiceConfig() IndividualServiceConfig {
+	return IndividualServiceConfig{
+		MaxGenerations: 30,
+	}
+}
+
 // IndividualService 个人信息服务
 type IndividualService struct {
 	repo       interfaces.IndividualRepository
 	familyRepo interfaces.FamilyRepository
+	uow        interfaces.UnitOfWork
+	config     IndividualServiceConfig
 }
 
 // NewIndividualService 创建个人信息服务
-func NewIndividualService(repo interfaces.IndividualRepository, familyRepo interfaces.FamilyRepository) interfaces.IndividualService {
+func NewIndividualService(repo interfaces.IndividualRepository, familyRepo interfaces.FamilyRepository, uow interfaces.UnitOfWork) interfaces.IndividualService {
+	return NewIndividualServiceWithConfig(repo, familyRepo, uow, DefaultIndividualServiceConfig())
+}
+
+// NewIndividualServiceWithConfig 使用指定配置创建个人信息服务
+func NewIndividualServiceWithConfig(repo interfaces.IndividualRepository, familyRepo interfaces.FamilyRepository, uow interfaces.UnitOfWork, config IndividualServiceConfig) interfaces.IndividualService {
+	if config.MaxGenerations <= 0 {
+		config.MaxGenerations = DefaultIndividualServiceConfig().MaxGenerations
+	}
 	return &IndividualService{
 		repo:       repo,
 		familyRepo: familyRepo,
+		uow:        uow,
+		config:     config,
 	}
 }
 
-// Create 创建个人信息
+// Create 创建个人信息，父母的婚姻关系、子女关系与个人在同一事务中创建
 func (s *IndividualService) Create(ctx context.Context, req *models.CreateIndividualRequest) (*models.Individual, error) {
+	return inTransaction(ctx, s.uow, func(ctx context.Context) (*models.Individual, error) {
+		return s.create(ctx, req)
+	})
+}
+
+// create 创建个人信息
+func (s *IndividualService) create(ctx context.Context, req *models.CreateIndividualRequest) (*models.Individual, error) {
 	// 验证必填字段
 	if req.FullName == "" {
 		return nil, fmt.Errorf("姓名不能为空")
@@ -136,23 +168,26 @@ func (s *IndividualService) Create(ctx context.Context, req *models.CreateIndivi
 	if req.FatherID != nil && req.MotherID != nil {
 		// 查找父母的家庭关系
 		families, err := s.familyRepo.GetFamiliesByIndividualID(ctx, *req.FatherID)
-		if err == nil {
-			for _, family := range families {
-				if family.HusbandID != nil && *family.HusbandID == *req.FatherID &&
-					family.WifeID != nil && *family.WifeID == *req.MotherID {
-					// 创建子女关系记录
-					child := &models.Child{
-						FamilyID:              family.FamilyID,
-						IndividualID:          createdIndividual.IndividualID,
-						RelationshipToParents: "生子",
-					}
-					if createdIndividual.Gender == models.GenderFemale {
-						child.RelationshipToParents = "生女"
-					}
+		if err != nil {
+			return nil, fmt.Errorf("查询父母家庭关系失败: %v", err)
+		}
+		for _, family := range families {
+			if family.HusbandID != nil && *family.HusbandID == *req.FatherID &&
+				family.WifeID != nil && *family.WifeID == *req.MotherID {
+				// 创建子女关系记录
+				child := &models.Child{
+					FamilyID:              family.FamilyID,
+					IndividualID:          createdIndividual.IndividualID,
+					RelationshipToParents: "生子",
+				}
+				if createdIndividual.Gender == models.GenderFemale {
+					child.RelationshipToParents = "生女"
+				}
 
-					s.familyRepo.CreateChild(ctx, child)
-					break
+				if _, err := s.familyRepo.CreateChild(ctx, child); err != nil {
+					return nil, fmt.Errorf("创建子女关系失败: %v", err)
 				}
+				break
 			}
 		}
 	}
@@ -160,8 +195,15 @@ func (s *IndividualService) Create(ctx context.Context, req *models.CreateIndivi
 	return createdIndividual, nil
 }
 
-// CreateForUser 创建个人信息（用户隔离版本）
+// CreateForUser 创建个人信息（用户隔离版本），与 Create 一样在一个事务中完成
 func (s *IndividualService) CreateForUser(ctx context.Context, userID int, req *models.CreateIndividualRequest) (*models.Individual, error) {
+	return inTransaction(ctx, s.uow, func(ctx context.Context) (*models.Individual, error) {
+		return s.createForUser(ctx, userID, req)
+	})
+}
+
+// createForUser 创建个人信息（用户隔离版本）
+func (s *IndividualService) createForUser(ctx context.Context, userID int, req *models.CreateIndividualRequest) (*models.Individual, error) {
 	// 验证必填字段
 	if req.FullName == "" {
 		return nil, fmt.Errorf("姓名不能为空")
@@ -273,23 +315,26 @@ func (s *IndividualService) CreateForUser(ctx context.Context, userID int, req *
 	if req.FatherID != nil && req.MotherID != nil {
 		// 查找父母的家庭关系
 		families, err := s.familyRepo.GetFamiliesByIndividualID(ctx, *req.FatherID)
-		if err == nil {
-			for _, family := range families {
-				if family.HusbandID != nil && *family.HusbandID == *req.FatherID &&
-					family.WifeID != nil && *family.WifeID == *req.MotherID {
-					// 创建子女关系记录
-					child := &models.Child{
-						FamilyID:              family.FamilyID,
-						IndividualID:          createdIndividual.IndividualID,
-						RelationshipToParents: "生子",
-					}
-					if createdIndividual.Gender == models.GenderFemale {
-						child.RelationshipToParents = "生女"
-					}
+		if err != nil {
+			return nil, fmt.Errorf("查询父母家庭关系失败: %v", err)
+		}
+		for _, family := range families {
+			if family.HusbandID != nil && *family.HusbandID == *req.FatherID &&
+				family.WifeID != nil && *family.WifeID == *req.MotherID {
+				// 创建子女关系记录
+				child := &models.Child{
+					FamilyID:              family.FamilyID,
+					IndividualID:          createdIndividual.IndividualID,
+					RelationshipToParents: "生子",
+				}
+				if createdIndividual.Gender == models.GenderFemale {
+					child.RelationshipToParents = "生女"
+				}
 
-					s.familyRepo.CreateChild(ctx, child)
-					break
+				if _, err := s.familyRepo.CreateChild(ctx, child); err != nil {
+					return nil, fmt.Errorf("创建子女关系失败: %v", err)
 				}
+				break
 			}
 		}
 	}
@@ -305,8 +350,15 @@ func (s *IndividualService) GetByID(ctx context.Context, id int) (*models.Indivi
 	return s.repo.GetIndividualByID(ctx, id)
 }
 
-// Update 更新个人信息
+// Update 更新个人信息，性别变化时子女的父母关系随之调整，全部在一个事务中完成
 func (s *IndividualService) Update(ctx context.Context, id int, req *models.UpdateIndividualRequest) (*models.Individual, error) {
+	return inTransaction(ctx, s.uow, func(ctx context.Context) (*models.Individual, error) {
+		return s.update(ctx, id, req)
+	})
+}
+
+// update 更新个人信息
+func (s *IndividualService) update(ctx context.Context, id int, req *models.UpdateIndividualRequest) (*models.Individual, error) {
 	if id <= 0 {
 		return nil, fmt.Errorf("无效的个人ID")
 	}
@@ -368,6 +420,9 @@ func (s *IndividualService) Update(ctx context.Context, id int, req *models.Upda
 	if err != nil {
 		return nil, err
 	}
+	if err := checkVersion(req.Version, current.Version); err != nil {
+		return nil, err
+	}
 
 	// 检查性别是否变更
 	var newGender models.Gender
@@ -485,46 +540,29 @@ func (s *IndividualService) Update(ctx context.Context, id int, req *models.Upda
 		PhotoURL:     req.PhotoURL,
 		FatherID:     req.FatherID,
 		MotherID:     req.MotherID,
+		Version:      expectedVersion(req.Version),
 	}
 
-	return s.repo.UpdateIndividual(ctx, id, individual)
+	updated, err := s.repo.UpdateIndividual(ctx, id, individual)
+	if err != nil {
+		return nil, versionError(err)
+	}
+	return updated, nil
 }
 
 // validateNoCircularRelationship 验证不存在循环关系
 func (s *IndividualService) validateNoCircularRelationship(ctx context.Context, childID, parentID int, parentType string) error {
-	// 使用广度优先搜索检测循环
-	visited := make(map[int]bool)
-	queue := []int{parentID}
-
-	for len(queue) > 0 {
-		currentID := queue[0]
-		queue = queue[1:]
-
-		// 如果已访问过，跳过
-		if visited[currentID] {
-			continue
-		}
-
-		// 如果找到了子女ID，说明存在循环
-		if currentID == childID {
-			return fmt.Errorf("检测到循环关系：不能将此人设为%s，因为会形成循环父母关系", parentType)
-		}
-
-		visited[currentID] = true
-
-		// 获取当前人的父母
-		individual, err := s.repo.GetIndividualByID(ctx, currentID)
-		if err != nil {
-			continue // 如果获取失败，忽略（可能是数据不存在）
-		}
+	// 子女本身或子女的后代都不能成为其父母
+	if childID == parentID {
+		return fmt.Errorf("检测到循环关系：不能将此人设为%s，因为会形成循环父母关系", parentType)
+	}
 
-		// 将父母加入队列继续检查
-		if individual.FatherID != nil && !visited[*individual.FatherID] {
-			queue = append(queue, *individual.FatherID)
-		}
-		if individual.MotherID != nil && !visited[*individual.MotherID] {
-			queue = append(queue, *individual.MotherID)
-		}
+	isAncestor, err := s.repo.IsAncestor(ctx, childID, parentID)
+	if err != nil {
+		return fmt.Errorf("检查循环关系失败: %v", err)
+	}
+	if isAncestor {
+		return fmt.Errorf("检测到循环关系：不能将此人设为%s，因为会形成循环父母关系", parentType)
 	}
 
 	return nil
@@ -554,60 +592,29 @@ func getGenderValue(ptr *models.Gender, defaultValue models.Gender) models.Gende
 	return defaultValue
 }
 
-// Delete 删除个人信息
-func (s *IndividualService) Delete(ctx context.Context, id int) error {
+// Delete 删除个人信息，检查与删除在同一事务中完成
+func (s *IndividualService) Delete(ctx context.Context, id int, version *int) error {
+	return s.uow.WithinTransaction(ctx, func(ctx context.Context) error {
+		return s.delete(ctx, id, version)
+	})
+}
+
+// delete 把个人移入回收站
+func (s *IndividualService) delete(ctx context.Context, id int, version *int) error {
 	if id <= 0 {
 		return fmt.Errorf("无效的个人ID")
 	}
 
 	// 检查个人是否存在
-	_, err := s.repo.GetIndividualByID(ctx, id)
+	individual, err := s.repo.GetIndividualByID(ctx, id)
 	if err != nil {
 		return fmt.Errorf("个人信息不存在")
 	}
-
-	// 检查是否有子女
-	children, err := s.repo.GetIndividualsByParentID(ctx, id)
-	if err != nil {
-		return fmt.Errorf("检查子女关系失败: %v", err)
-	}
-	if len(children) > 0 {
-		return fmt.Errorf("该个人有子女记录，不能删除。请先删除或转移其子女关系")
-	}
-
-	// 检查是否作为配偶存在于家庭关系中
-	families, err := s.familyRepo.GetFamiliesByIndividualID(ctx, id)
-	if err != nil {
-		return fmt.Errorf("检查家庭关系失败: %v", err)
-	}
-	if len(families) > 0 {
-		return fmt.Errorf("该个人仍存在于家庭关系中，不能删除。请先删除相关的家庭关系")
-	}
-
-	// 检查其他人是否将此人设为父亲或母亲
-	// 通过查询所有个人信息来检查father_id和mother_id字段
-	allIndividuals, _, err := s.repo.SearchIndividuals(ctx, "", 10000, 0) // 获取大量数据来检查
-	if err != nil {
-		return fmt.Errorf("检查父母关系失败: %v", err)
+	if err := checkVersion(version, individual.Version); err != nil {
+		return err
 	}
 
-	for _, person := range allIndividuals {
-		if (person.FatherID != nil && *person.FatherID == id) ||
-			(person.MotherID != nil && *person.MotherID == id) {
-			return fmt.Errorf("该个人被其他人设置为父亲或母亲，不能删除。请先调整相关的父母关系")
-		}
-	}
-
-	// 清理该人作为子女的记录（从子女关系表中删除）
-	for _, family := range families {
-		err := s.familyRepo.DeleteChild(ctx, family.FamilyID, id)
-		if err != nil {
-			// 如果删除失败，记录但不阻止整个删除操作
-			fmt.Printf("警告：清理子女关系记录失败: %v\n", err)
-		}
-	}
-
-	// 执行删除
+	// 个人连同其子女关系和事件移入回收站；子女的父母、家庭的夫妻仍指向此人，恢复后关系随之恢复
 	return s.repo.DeleteIndividual(ctx, id)
 }
 
@@ -738,91 +745,36 @@ func (s *IndividualService) GetSpouses(ctx context.Context, id int) ([]models.In
 
 // GetAncestors 获取个人的所有祖先
 func (s *IndividualService) GetAncestors(ctx context.Context, id int, generations int) ([]models.Individual, error) {
-	if id <= 0 {
-		return nil, fmt.Errorf("无效的个人ID")
-	}
-	if generations <= 0 {
-		generations = 5 // 默认5代
-	}
-	if generations > 10 {
-		generations = 10 // 最多10代
-	}
-
-	var ancestors []models.Individual
-	visited := make(map[int]bool)
-
-	var getAncestorsRecursive func(int, int) error
-	getAncestorsRecursive = func(currentID int, gen int) error {
-		if gen <= 0 || visited[currentID] {
-			return nil
-		}
-
-		visited[currentID] = true
-		father, mother, err := s.GetParents(ctx, currentID)
-		if err != nil {
-			return err
-		}
-
-		if father != nil {
-			ancestors = append(ancestors, *father)
-			if err := getAncestorsRecursive(father.IndividualID, gen-1); err != nil {
-				return err
-			}
-		}
-
-		if mother != nil {
-			ancestors = append(ancestors, *mother)
-			if err := getAncestorsRecursive(mother.IndividualID, gen-1); err != nil {
-				return err
-			}
-		}
-
-		return nil
+	entries, err := s.GetAncestorLineage(ctx, id, generations)
+	if err != nil {
+		return nil, err
 	}
-
-	err := getAncestorsRecursive(id, generations)
-	return ancestors, err
+	return uniqueLineageIndividuals(entries), nil
 }
 
 // GetDescendants 获取个人的所有后代
 func (s *IndividualService) GetDescendants(ctx context.Context, id int, generations int) ([]models.Individual, error) {
+	entries, err := s.GetDescendantLineage(ctx, id, generations)
+	if err != nil {
+		return nil, err
+	}
+	return uniqueLineageIndividuals(entries), nil
+}
+
+// GetAncestorLineage 获取带代数和父母边的祖先世系
+func (s *IndividualService) GetAncestorLineage(ctx context.Context, id int, generations int) ([]models.LineageEntry, error) {
 	if id <= 0 {
 		return nil, fmt.Errorf("无效的个人ID")
 	}
-	if generations <= 0 {
-		generations = 5 // 默认5代
-	}
-	if generations > 10 {
-		generations = 10 // 最多10代
-	}
-
-	var descendants []models.Individual
-	visited := make(map[int]bool)
-
-	var getDescendantsRecursive func(int, int) error
-	getDescendantsRecursive = func(currentID int, gen int) error {
-		if gen <= 0 || visited[currentID] {
-			return nil
-		}
-
-		visited[currentID] = true
-		children, err := s.repo.GetIndividualsByParentID(ctx, currentID)
-		if err != nil {
-			return err
-		}
-
-		for _, child := range children {
-			descendants = append(descendants, child)
-			if err := getDescendantsRecursive(child.IndividualID, gen-1); err != nil {
-				return err
-			}
-		}
+	return s.repo.GetAncestorLineage(ctx, id, s.clampGenerations(generations, 5))
+}
 
-		return nil
+// GetDescendantLineage 获取带代数和父母边的后代世系
+func (s *IndividualService) GetDescendantLineage(ctx context.Context, id int, generations int) ([]models.LineageEntry, error) {
+	if id <= 0 {
+		return nil, fmt.Errorf("无效的个人ID")
 	}
-
-	err := getDescendantsRecursive(id, generations)
-	return descendants, err
+	return s.repo.GetDescendantLineage(ctx, id, s.clampGenerations(generations, 5))
 }
 
 // GetFamilyTree 获取家族树
@@ -830,42 +782,84 @@ func (s *IndividualService) GetFamilyTree(ctx context.Context, rootID int, gener
 	if rootID <= 0 {
 		return nil, fmt.Errorf("无效的根节点ID")
 	}
-	if generations <= 0 {
-		generations = 3 // 默认3代
-	}
-	if generations > 10 {
-		generations = 10 // 最多10代，防止无限递归
-	}
+	generations = s.clampGenerations(generations, 3)
 
 	individual, err := s.repo.GetIndividualByID(ctx, rootID)
 	if err != nil {
 		return nil, err
 	}
 
-	node := &models.FamilyTreeNode{
-		Individual: individual,
+	entries, err := s.repo.GetDescendantLineage(ctx, rootID, generations)
+	if err != nil {
+		return nil, err
 	}
 
-	if generations > 0 {
-		children, err := s.repo.GetIndividualsByParentID(ctx, rootID)
-		if err != nil {
-			return nil, err
+	// 按父母分组子女，同一子女经由父亲和母亲各出现一次时只保留一份
+	people := make(map[int]models.Individual)
+	childrenOf := make(map[int][]int)
+	linked := make(map[[2]int]bool)
+	for _, entry := range entries {
+		childID := entry.Individual.IndividualID
+		people[childID] = entry.Individual
+		key := [2]int{entry.LinkedID, childID}
+		if linked[key] {
+			continue
 		}
+		linked[key] = true
+		childrenOf[entry.LinkedID] = append(childrenOf[entry.LinkedID], childID)
+	}
 
-		for _, child := range children {
-			childNode, err := s.GetFamilyTree(ctx, child.IndividualID, generations-1)
-			if err != nil {
-				return nil, err
-			}
-			node.Children = append(node.Children, *childNode)
+	var build func(person *models.Individual, remaining int) models.FamilyTreeNode
+	build = func(person *models.Individual, remaining int) models.FamilyTreeNode {
+		node := models.FamilyTreeNode{Individual: person}
+		if remaining <= 0 {
+			return node
 		}
+		for _, childID := range childrenOf[person.IndividualID] {
+			child := people[childID]
+			node.Children = append(node.Children, build(&child, remaining-1))
+		}
+		return node
 	}
 
-	return node, nil
+	root := build(individual, generations)
+	return &root, nil
+}
+
+// clampGenerations 规范化代数参数：非正数使用默认值，超出上限时截断
+func (s *IndividualService) clampGenerations(generations, defaultGenerations int) int {
+	if generations <= 0 {
+		generations = defaultGenerations
+	}
+	if generations > s.config.MaxGenerations {
+		generations = s.config.MaxGenerations
+	}
+	return generations
 }
 
-// AddParent 向上添加父母
+// uniqueLineageIndividuals 按首次出现（即最近的代数）去重世系中的个人
+func uniqueLineageIndividuals(entries []models.LineageEntry) []models.Individual {
+	seen := make(map[int]bool, len(entries))
+	individuals := make([]models.Individual, 0, len(entries))
+	for _, entry := range entries {
+		if seen[entry.Individual.IndividualID] {
+			continue
+		}
+		seen[entry.Individual.IndividualID] = true
+		individuals = append(individuals, entry.Individual)
+	}
+	return individuals
+}
+
+// AddParent 向上添加父母：创建父母、更新全部兄弟姐妹、创建父母之间的婚姻在一个事务中完成，任何一步失败都不留下修改
 func (s *IndividualService) AddParent(ctx context.Context, childID int, req *models.AddParentRequest) (*models.Individual, error) {
+	return inTransaction(ctx, s.uow, func(ctx context.Context) (*models.Individual, error) {
+		return s.addParent(ctx, childID, req)
+	})
+}
+
+// addParent 向上添加父母
+func (s *IndividualService) addParent(ctx context.Context, childID int, req *models.AddParentRequest) (*models.Individual, error) {
 	if childID <= 0 {
 		return nil, fmt.Errorf("无效的子女ID")
 	}
@@ -928,14 +922,11 @@ func (s *IndividualService) AddParent(ctx context.Context, childID int, req *mod
 	// 获取所有兄弟姐妹（包括当前子女）
 	siblings, err := s.findSiblingsForParentUpdate(ctx, childID)
 	if err != nil {
-		// 如果获取兄弟姐妹失败，至少更新当前子女
-		siblings = []models.Individual{*child}
-		fmt.Printf("警告: 获取兄弟姐妹失败，只更新当前子女: %v\n", err)
+		return nil, fmt.Errorf("获取兄弟姐妹失败: %v", err)
 	}
 
 	// 更新所有兄弟姐妹的父母关系
-	var failedUpdates []string
-	for _, sibling := range siblings {
+	for i, sibling := range siblings {
 		updateReq := &models.UpdateIndividualRequest{
 			FullName:      &sibling.FullName,
 			Gender:        &sibling.Gender,
@@ -960,23 +951,16 @@ func (s *IndividualService) AddParent(ctx context.Context, childID int, req *mod
 			updateReq.MotherID = &createdParent.IndividualID
 		}
 
-		_, err = s.Update(ctx, sibling.IndividualID, updateReq)
+		updated, err := s.update(ctx, sibling.IndividualID, updateReq)
 		if err != nil {
-			failedUpdates = append(failedUpdates, fmt.Sprintf("%s(ID:%d)", sibling.FullName, sibling.IndividualID))
-			fmt.Printf("警告: 更新%s的父母关系失败: %v\n", sibling.FullName, err)
+			return nil, fmt.Errorf("更新%s的父母关系失败: %v", sibling.FullName, err)
 		}
-	}
-
-	// 如果有更新失败的情况，记录但不回滚
-	if len(failedUpdates) > 0 {
-		fmt.Printf("警告: 以下成员的父母关系更新失败: %v\n", failedUpdates)
+		siblings[i] = *updated
 	}
 
 	// 检查并创建父母之间的夫妻关系
-	err = s.ensureParentsMarriageForAllSiblings(ctx, siblings)
-	if err != nil {
-		// 记录警告但不影响主要操作
-		fmt.Printf("警告: 创建父母夫妻关系失败: %v\n", err)
+	if err := s.ensureParentsMarriageForAllSiblings(ctx, siblings); err != nil {
+		return nil, err
 	}
 
 	return createdParent, nil
@@ -1056,9 +1040,9 @@ func (s *IndividualService) ensureParentsMarriageForAllSiblings(ctx context.Cont
 		}
 	}
 
-	// 如果仍然没有完整的父母信息，无法创建夫妻关系
+	// 只有父亲或母亲一方时不需要创建夫妻关系
 	if fatherID == nil || motherID == nil {
-		return fmt.Errorf("无法找到完整的父母信息来创建夫妻关系")
+		return nil
 	}
 
 	// 检查父母之间是否已经有夫妻关系
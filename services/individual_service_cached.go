@@ -14,18 +14,21 @@ import (
 // CachedIndividualService 带缓存的个人信息服务
 type CachedIndividualService struct {
 	service    interfaces.IndividualService
+	repo       interfaces.IndividualRepository
 	cache      *repository.CacheRepository
 	objectPool *objectpool.IndividualPool
 	treePool   *objectpool.FamilyTreeNodePool
 }
 
-// NewCachedIndividualService 创建带缓存的个人信息服务
+// NewCachedIndividualService 创建带缓存的个人信息服务，repo 用于校验缓存中记录的版本
 func NewCachedIndividualService(
 	service interfaces.IndividualService,
+	repo interfaces.IndividualRepository,
 	cache *repository.CacheRepository,
 ) interfaces.IndividualService {
 	return &CachedIndividualService{
 		service:    service,
+		repo:       repo,
 		cache:      cache,
 		objectPool: objectpool.NewIndividualPool(),
 		treePool:   objectpool.NewFamilyTreeNodePool(),
@@ -74,7 +77,8 @@ func (s *CachedIndividualService) CreateForUser(ctx context.Context, userID int,
 	return individual, nil
 }
 
-// GetByID 获取个人信息（带缓存）
+// GetByID 获取个人信息（带缓存）。撤销、恢复、回滚、导入等写入不经过本服务，
+// 缓存中的记录只在版本号与数据库一致时使用，返回的版本可直接作为 ETag
 func (s *CachedIndividualService) GetByID(ctx context.Context, id int) (*models.Individual, error) {
 	if id <= 0 {
 		return nil, errors.ErrInvalidID
@@ -84,8 +88,12 @@ func (s *CachedIndividualService) GetByID(ctx context.Context, id int) (*models.
 	if s.cache != nil {
 		cached, err := s.cache.GetIndividual(ctx, id)
 		if err == nil && cached != nil {
-			log.Printf("缓存命中：个人信息 ID=%d", id)
-			return cached, nil
+			version, err := s.repo.GetIndividualVersion(ctx, id)
+			if err == nil && version == cached.Version {
+				log.Printf("缓存命中：个人信息 ID=%d", id)
+				return cached, nil
+			}
+			s.invalidateRelatedCache(ctx, id)
 		}
 	}
 
@@ -116,6 +124,10 @@ func (s *CachedIndividualService) Update(ctx context.Context, id int, req *model
 	// 调用原服务
 	individual, err := s.service.Update(ctx, id, req)
 	if err != nil {
+		// 版本不一致时缓存中的记录可能已过期，立即清除，之后读取的是当前版本
+		if err == errors.ErrVersionMismatch {
+			s.invalidateRelatedCache(ctx, id)
+		}
 		return nil, err
 	}
 
@@ -128,13 +140,13 @@ func (s *CachedIndividualService) Update(ctx context.Context, id int, req *model
 }
 
 // Delete 删除个人信息（删除后清除相关缓存）
-func (s *CachedIndividualService) Delete(ctx context.Context, id int) error {
+func (s *CachedIndividualService) Delete(ctx context.Context, id int, version *int) error {
 	if id <= 0 {
 		return errors.ErrInvalidID
 	}
 
 	// 调用原服务
-	err := s.service.Delete(ctx, id)
+	err := s.service.Delete(ctx, id, version)
 	if err != nil {
 		return err
 	}
@@ -211,6 +223,60 @@ func (s *CachedIndividualService) GetDescendants(ctx context.Context, id int, ge
 	return s.service.GetDescendants(ctx, id, generations)
 }
 
+// GetAncestorLineage 获取祖先世系
+func (s *CachedIndividualService) GetAncestorLineage(ctx context.Context, id int, generations int) ([]models.LineageEntry, error) {
+	if id <= 0 {
+		return nil, errors.ErrInvalidID
+	}
+
+	return s.service.GetAncestorLineage(ctx, id, generations)
+}
+
+// GetDescendantLineage 获取后代世系
+func (s *CachedIndividualService) GetDescendantLineage(ctx context.Context, id int, generations int) ([]models.LineageEntry, error) {
+	if id <= 0 {
+		return nil, errors.ErrInvalidID
+	}
+
+	return s.service.GetDescendantLineage(ctx, id, generations)
+}
+
+// GetRelationship 计算两人之间的血缘关系
+func (s *CachedIndividualService) GetRelationship(ctx context.Context, id1, id2 int) (*models.Relationship, error) {
+	if id1 <= 0 || id2 <= 0 {
+		return nil, errors.ErrInvalidID
+	}
+
+	return s.service.GetRelationship(ctx, id1, id2)
+}
+
+// GetHourglass 获取沙漏图
+func (s *CachedIndividualService) GetHourglass(ctx context.Context, rootID int, ancestorGenerations, descendantGenerations int) (*models.Hourglass, error) {
+	if rootID <= 0 {
+		return nil, errors.ErrInvalidID
+	}
+
+	return s.service.GetHourglass(ctx, rootID, ancestorGenerations, descendantGenerations)
+}
+
+// GetAlternateNames 获取个人的字、号
+func (s *CachedIndividualService) GetAlternateNames(ctx context.Context, id int) (*models.AlternateNames, error) {
+	if id <= 0 {
+		return nil, errors.ErrInvalidID
+	}
+
+	return s.service.GetAlternateNames(ctx, id)
+}
+
+// UpdateAlternateNames 更新个人的字、号
+func (s *CachedIndividualService) UpdateAlternateNames(ctx context.Context, id int, names *models.AlternateNames, version *int) (*models.AlternateNames, error) {
+	if id <= 0 {
+		return nil, errors.ErrInvalidID
+	}
+
+	return s.service.UpdateAlternateNames(ctx, id, names, version)
+}
+
 // GetFamilyTree 获取家族树（带缓存）
 func (s *CachedIndividualService) GetFamilyTree(ctx context.Context, rootID int, generations int) (*models.FamilyTreeNode, error) {
 	if rootID <= 0 {
@@ -268,17 +334,22 @@ func (s *CachedIndividualService) AddParent(ctx context.Context, childID int, re
 
 // invalidateRelatedCache 清除相关缓存
 func (s *CachedIndividualService) invalidateRelatedCache(ctx context.Context, id int) {
-	if s.cache == nil {
+	invalidateIndividualCache(ctx, s.cache, id)
+}
+
+// invalidateIndividualCache 清除个人及以其为根的家族树缓存，cache 为 nil 时不做任何事
+func invalidateIndividualCache(ctx context.Context, cache *repository.CacheRepository, id int) {
+	if cache == nil {
 		return
 	}
 
 	// 清除个人缓存
-	if err := s.cache.DeleteIndividual(ctx, id); err != nil {
+	if err := cache.DeleteIndividual(ctx, id); err != nil {
 		log.Printf("清除个人缓存失败 ID=%d: %v", id, err)
 	}
 
 	// 清除家族树缓存（以此人为根节点）
-	if err := s.cache.DeleteFamilyTree(ctx, id); err != nil {
+	if err := cache.DeleteFamilyTree(ctx, id); err != nil {
 		log.Printf("清除家族树缓存失败 RootID=%d: %v", id, err)
 	}
 
@@ -0,0 +1,289 @@
+package services
+
+import (
+	"context"
+	"sort"
+
+	"familytree/interfaces"
+	"familytree/models"
+	"familytree/pkg/errors"
+)
+
+// PedigreeService 家谱结构分析服务
+type PedigreeService struct {
+	individualRepo interfaces.IndividualRepository
+	familyTreeRepo interfaces.FamilyTreeRepository
+}
+
+// NewPedigreeService 创建家谱结构分析服务
+func NewPedigreeService(individualRepo interfaces.IndividualRepository, familyTreeRepo interfaces.FamilyTreeRepository) interfaces.PedigreeService {
+	return &PedigreeService{
+		individualRepo: individualRepo,
+		familyTreeRepo: familyTreeRepo,
+	}
+}
+
+// AnalyzeFamilyTree 分析家族树中的循环关系与祖先重叠
+func (s *PedigreeService) AnalyzeFamilyTree(ctx context.Context, userID, familyTreeID int, rootID *int) (*models.PedigreeAnalysis, error) {
+	if _, err := ownedFamilyTree(ctx, s.familyTreeRepo, userID, familyTreeID); err != nil {
+		return nil, err
+	}
+
+	individuals, err := s.individualRepo.GetIndividualsByFamilyTreeID(ctx, familyTreeID)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "加载家族树成员失败")
+	}
+
+	graph := newPedigreeGraph(individuals)
+	if rootID != nil {
+		if _, ok := graph.people[*rootID]; !ok {
+			return nil, errors.New(errors.ErrCodeNotFound, "指定的根节点不在该家族树中")
+		}
+	}
+
+	// 必须先检测循环，祖先重叠统计会跳过循环成员
+	cycles := graph.findCycles()
+	collapses := graph.findCollapses(rootID)
+
+	return &models.PedigreeAnalysis{
+		FamilyTreeID:    familyTreeID,
+		RootPersonID:    rootID,
+		IndividualCount: len(individuals),
+		Cycles:          cycles,
+		Collapses:       collapses,
+	}, nil
+}
+
+// pedigreeGraph 以子女指向父母的有向图
+type pedigreeGraph struct {
+	people   map[int]*models.Individual
+	ids      []int
+	parents  map[int][]int
+	children map[int][]int
+	cyclic   map[int]bool
+}
+
+// newPedigreeGraph 根据个人信息中的 father_id/mother_id 构建关系图
+func newPedigreeGraph(individuals []models.Individual) *pedigreeGraph {
+	g := &pedigreeGraph{
+		people:   make(map[int]*models.Individual, len(individuals)),
+		parents:  make(map[int][]int),
+		children: make(map[int][]int),
+		cyclic:   make(map[int]bool),
+	}
+
+	for i := range individuals {
+		person := &individuals[i]
+		g.people[person.IndividualID] = person
+		g.ids = append(g.ids, person.IndividualID)
+	}
+	sort.Ints(g.ids)
+
+	for _, id := range g.ids {
+		person := g.people[id]
+		for _, parentID := range []*int{person.FatherID, person.MotherID} {
+			if parentID == nil {
+				continue
+			}
+			// 只统计同一家族树内的父母关系
+			if _, ok := g.people[*parentID]; !ok {
+				continue
+			}
+			g.parents[id] = append(g.parents[id], *parentID)
+			g.children[*parentID] = append(g.children[*parentID], id)
+		}
+	}
+
+	return g
+}
+
+// findCycles 使用 Tarjan 强连通分量算法查找循环祖先关系
+func (g *pedigreeGraph) findCycles() []models.PedigreeCycle {
+	index := 0
+	indices := make(map[int]int)
+	lowlink := make(map[int]int)
+	onStack := make(map[int]bool)
+	var stack []int
+	var cycles []models.PedigreeCycle
+
+	var strongConnect func(id int)
+	strongConnect = func(id int) {
+		indices[id] = index
+		lowlink[id] = index
+		index++
+		stack = append(stack, id)
+		onStack[id] = true
+
+		for _, parentID := range g.parents[id] {
+			if _, visited := indices[parentID]; !visited {
+				strongConnect(parentID)
+				if lowlink[parentID] < lowlink[id] {
+					lowlink[id] = lowlink[parentID]
+				}
+			} else if onStack[parentID] && indices[parentID] < lowlink[id] {
+				lowlink[id] = indices[parentID]
+			}
+		}
+
+		if lowlink[id] != indices[id] {
+			return
+		}
+
+		var component []int
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			component = append(component, top)
+			if top == id {
+				break
+			}
+		}
+
+		if len(component) > 1 || g.isOwnParent(id) {
+			sort.Ints(component)
+			cycle := models.PedigreeCycle{IndividualIDs: component}
+			for _, memberID := range component {
+				g.cyclic[memberID] = true
+				cycle.Members = append(cycle.Members, *g.people[memberID])
+			}
+			cycles = append(cycles, cycle)
+		}
+	}
+
+	for _, id := range g.ids {
+		if _, visited := indices[id]; !visited {
+			strongConnect(id)
+		}
+	}
+
+	return cycles
+}
+
+// isOwnParent 检查某人是否被设为自己的父母
+func (g *pedigreeGraph) isOwnParent(id int) bool {
+	for _, parentID := range g.parents[id] {
+		if parentID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// ancestorPaths 祖先路径统计：祖先ID -> 代数 -> 路径数
+type ancestorPaths map[int]map[int]int
+
+// findCollapses 查找祖先重叠，需在 findCycles 之后调用以跳过循环成员
+//
+// 对每个人，报告经由其不同父母都能到达的每一位共同祖先，
+// 这样同一重叠只会在父母双方血缘汇合的那一代被报告一次；
+// 最近的汇合点（没有子女同样是共同祖先）标记为 Nearest。
+func (g *pedigreeGraph) findCollapses(rootID *int) []models.PedigreeCollapse {
+	memo := make(map[int]ancestorPaths)
+
+	var pathsOf func(id int) ancestorPaths
+	pathsOf = func(id int) ancestorPaths {
+		if paths, ok := memo[id]; ok {
+			return paths
+		}
+
+		paths := make(ancestorPaths)
+		for _, parentID := range g.parents[id] {
+			if g.cyclic[parentID] {
+				continue
+			}
+			addPath(paths, parentID, 1, 1)
+			for ancestorID, byGeneration := range pathsOf(parentID) {
+				for generation, count := range byGeneration {
+					addPath(paths, ancestorID, generation+1, count)
+				}
+			}
+		}
+
+		memo[id] = paths
+		return paths
+	}
+
+	// 确定需要分析的后代范围
+	candidates := g.ids
+	if rootID != nil {
+		candidates = []int{*rootID}
+		for ancestorID := range pathsOf(*rootID) {
+			candidates = append(candidates, ancestorID)
+		}
+		sort.Ints(candidates)
+	}
+
+	var collapses []models.PedigreeCollapse
+	for _, id := range candidates {
+		if g.cyclic[id] || len(g.parents[id]) < 2 {
+			continue
+		}
+
+		// 统计每个祖先可由几位父母到达
+		reachedBy := make(map[int]int)
+		for _, parentID := range g.parents[id] {
+			if g.cyclic[parentID] {
+				continue
+			}
+			seen := map[int]bool{parentID: true}
+			for ancestorID := range pathsOf(parentID) {
+				seen[ancestorID] = true
+			}
+			for ancestorID := range seen {
+				reachedBy[ancestorID]++
+			}
+		}
+
+		common := make(map[int]bool)
+		for ancestorID, count := range reachedBy {
+			if count > 1 {
+				common[ancestorID] = true
+			}
+		}
+
+		paths := pathsOf(id)
+		for ancestorID := range common {
+			collapse := models.PedigreeCollapse{
+				Descendant: *g.people[id],
+				Ancestor:   *g.people[ancestorID],
+				Nearest:    !g.hasCommonChild(ancestorID, common),
+			}
+			for generation, count := range paths[ancestorID] {
+				collapse.PathCount += count
+				collapse.Generations = append(collapse.Generations, generation)
+			}
+			sort.Ints(collapse.Generations)
+			collapses = append(collapses, collapse)
+		}
+	}
+
+	sort.Slice(collapses, func(i, j int) bool {
+		if collapses[i].Descendant.IndividualID != collapses[j].Descendant.IndividualID {
+			return collapses[i].Descendant.IndividualID < collapses[j].Descendant.IndividualID
+		}
+		return collapses[i].Ancestor.IndividualID < collapses[j].Ancestor.IndividualID
+	})
+
+	return collapses
+}
+
+// hasCommonChild 检查祖先是否有子女同样是共同祖先（即该祖先不是最近的汇合点）
+func (g *pedigreeGraph) hasCommonChild(ancestorID int, common map[int]bool) bool {
+	for _, childID := range g.children[ancestorID] {
+		if common[childID] {
+			return true
+		}
+	}
+	return false
+}
+
+// addPath 累加一条到达祖先的路径
+func addPath(paths ancestorPaths, ancestorID, generation, count int) {
+	byGeneration, ok := paths[ancestorID]
+	if !ok {
+		byGeneration = make(map[int]int)
+		paths[ancestorID] = byGeneration
+	}
+	byGeneration[generation] += count
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"familytree/models"
+)
+
+// pedigreePerson 按ID和父母ID构造个人，0 表示没有
+func pedigreePerson(id, fatherID, motherID int) models.Individual {
+	person := models.Individual{IndividualID: id}
+	if fatherID != 0 {
+		person.FatherID = intPtr(fatherID)
+	}
+	if motherID != 0 {
+		person.MotherID = intPtr(motherID)
+	}
+	return person
+}
+
+// collapseKey 祖先重叠的后代、祖先、路径数、代数与是否为最近的汇合点
+type collapseKey struct {
+	descendant, ancestor, paths int
+	generations                 []int
+	nearest                     bool
+}
+
+func TestPedigreeGraph(t *testing.T) {
+	// 堂兄妹婚姻：1、2 的子女 3、4 各自的子女 5、7 结婚生下 9；10 是 1 的父亲
+	cousins := []models.Individual{
+		pedigreePerson(1, 10, 0), pedigreePerson(2, 0, 0), pedigreePerson(10, 0, 0),
+		pedigreePerson(3, 1, 2), pedigreePerson(4, 1, 2),
+		pedigreePerson(6, 0, 0), pedigreePerson(8, 0, 0),
+		pedigreePerson(5, 3, 6), pedigreePerson(7, 8, 4),
+		pedigreePerson(9, 5, 7),
+	}
+
+	tests := []struct {
+		name        string
+		individuals []models.Individual
+		root        *int
+		cycles      [][]int
+		collapses   []collapseKey
+	}{
+		{
+			name:        "互为父母",
+			individuals: []models.Individual{pedigreePerson(1, 2, 0), pedigreePerson(2, 1, 0), pedigreePerson(3, 1, 0)},
+			cycles:      [][]int{{1, 2}},
+		},
+		{
+			name:        "自己是自己的父亲",
+			individuals: []models.Individual{pedigreePerson(1, 1, 0), pedigreePerson(2, 1, 0)},
+			cycles:      [][]int{{1}},
+		},
+		{
+			// 更远的 10 同样经由两条路径到达，其子女 1 也是共同祖先，不是最近的汇合点
+			name:        "堂兄妹婚姻",
+			individuals: cousins,
+			collapses:   []collapseKey{{9, 1, 2, []int{3}, true}, {9, 2, 2, []int{3}, true}, {9, 10, 2, []int{4}, false}},
+		},
+		{
+			name:        "从后代之一出发不含重叠",
+			individuals: cousins,
+			root:        intPtr(5),
+		},
+		{
+			name:        "从重叠的后代出发",
+			individuals: cousins,
+			root:        intPtr(9),
+			collapses:   []collapseKey{{9, 1, 2, []int{3}, true}, {9, 2, 2, []int{3}, true}, {9, 10, 2, []int{4}, false}},
+		},
+		{
+			name: "没有重叠",
+			individuals: []models.Individual{
+				pedigreePerson(1, 0, 0), pedigreePerson(2, 0, 0), pedigreePerson(3, 0, 0), pedigreePerson(4, 0, 0),
+				pedigreePerson(5, 1, 2), pedigreePerson(6, 3, 4), pedigreePerson(7, 5, 6),
+			},
+		},
+		{
+			// 3、4 唯一的共同祖先 1 在循环中，循环成员不参与重叠统计
+			name: "循环下方的后代",
+			individuals: []models.Individual{
+				pedigreePerson(1, 2, 0), pedigreePerson(2, 1, 0),
+				pedigreePerson(3, 1, 0), pedigreePerson(4, 1, 0), pedigreePerson(5, 3, 4),
+			},
+			cycles: [][]int{{1, 2}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			individuals := append([]models.Individual(nil), tt.individuals...)
+			graph := newPedigreeGraph(individuals)
+
+			var cycles [][]int
+			for _, cycle := range graph.findCycles() {
+				cycles = append(cycles, cycle.IndividualIDs)
+				if len(cycle.Members) != len(cycle.IndividualIDs) {
+					t.Errorf("循环成员与ID不一致: %+v", cycle)
+				}
+			}
+			if !reflect.DeepEqual(cycles, tt.cycles) {
+				t.Errorf("循环: got %v, want %v", cycles, tt.cycles)
+			}
+
+			var collapses []collapseKey
+			for _, c := range graph.findCollapses(tt.root) {
+				collapses = append(collapses, collapseKey{c.Descendant.IndividualID, c.Ancestor.IndividualID, c.PathCount, c.Generations, c.Nearest})
+			}
+			if !reflect.DeepEqual(collapses, tt.collapses) {
+				t.Errorf("祖先重叠: got %+v, want %+v", collapses, tt.collapses)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// photoBlockedPrefixes 全局单播地址中仍不允许访问的网段：本网络、运营商 NAT、协议分配、基准测试和 NAT64
+var photoBlockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// newPhotoClient 下载照片的 HTTP 客户端。照片地址由用户填写，每次连接时检查 DNS 解析后的地址，
+// 拒绝回环、内网、链路本地等地址，重定向和重新解析同样经过检查。不使用代理，否则检查的是代理地址
+func newPhotoClient() *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: checkPhotoAddress}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: 15 * time.Second, Transport: transport}
+}
+
+// checkPhotoAddress 连接前检查目标地址是否为公网地址
+func checkPhotoAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !publicAddress(addr) {
+		return fmt.Errorf("不允许访问的照片地址: %s", host)
+	}
+	return nil
+}
+
+// publicAddress 是否为可以访问的公网地址
+func publicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range photoBlockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// fetchPhoto 下载 http(s) 照片，超过 maxPhotoSize 的照片返回错误
+func fetchPhoto(client *http.Client, url string) ([]byte, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("不支持的照片地址: %s", url)
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("下载照片失败: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPhotoSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxPhotoSize {
+		return nil, fmt.Errorf("照片超过大小上限")
+	}
+	return data, nil
+}
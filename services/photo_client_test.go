@@ -0,0 +1,53 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestPublicAddress(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"100.64.0.1", false},
+		{"::ffff:127.0.0.1", false},
+		{"224.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := publicAddress(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("publicAddress(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestFetchPhotoRejectsLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("photo"))
+	}))
+	defer server.Close()
+
+	// 测试服务器本身可以访问，经照片客户端下载时应在连接前被拒绝
+	if _, err := fetchPhoto(server.Client(), server.URL); err != nil {
+		t.Fatalf("普通客户端下载失败: %v", err)
+	}
+	if _, err := fetchPhoto(newPhotoClient(), server.URL); err == nil {
+		t.Error("回环地址应被拒绝")
+	}
+	if _, err := fetchPhoto(newPhotoClient(), "file:///etc/passwd"); err == nil {
+		t.Error("非 http(s) 地址应被拒绝")
+	}
+}
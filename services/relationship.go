@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"familytree/models"
+)
+
+// GetRelationship 计算两人之间的血缘关系，描述 id2 是 id1 的什么人
+func (s *IndividualService) GetRelationship(ctx context.Context, id1, id2 int) (*models.Relationship, error) {
+	if id1 <= 0 || id2 <= 0 {
+		return nil, fmt.Errorf("无效的个人ID")
+	}
+
+	person1, err := s.repo.GetIndividualByID(ctx, id1)
+	if err != nil {
+		return nil, err
+	}
+	person2, err := s.repo.GetIndividualByID(ctx, id2)
+	if err != nil {
+		return nil, err
+	}
+
+	relationship := &models.Relationship{Person1: person1, Person2: person2}
+	if id1 == id2 {
+		relationship.Related = true
+		relationship.Description = "本人"
+		return relationship, nil
+	}
+
+	ancestors, err := s.repo.GetCommonAncestors(ctx, id1, id2, s.config.MaxGenerations)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ancestors) == 0 {
+		relationship.Description = "无已知血缘关系"
+		spouses, err := s.repo.GetSpouses(ctx, id1)
+		if err != nil {
+			return nil, err
+		}
+		for _, spouse := range spouses {
+			if spouse.IndividualID == id2 {
+				relationship.Description = "配偶"
+				break
+			}
+		}
+		return relationship, nil
+	}
+
+	// 只保留最近的共同祖先（结果已按两边代数之和排序）
+	nearest := ancestors[0].Generations1 + ancestors[0].Generations2
+	ids := []int{}
+	for _, ancestor := range ancestors {
+		if ancestor.Generations1+ancestor.Generations2 != nearest {
+			break
+		}
+		relationship.CommonAncestors = append(relationship.CommonAncestors, ancestor)
+		ids = append(ids, ancestor.AncestorID)
+	}
+
+	people, err := s.repo.GetIndividualsByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]*models.Individual, len(people))
+	for i := range people {
+		byID[people[i].IndividualID] = &people[i]
+	}
+	for i := range relationship.CommonAncestors {
+		relationship.CommonAncestors[i].Ancestor = byID[relationship.CommonAncestors[i].AncestorID]
+	}
+
+	half := false
+	if len(ids) == 1 && nearest == 2 && ancestors[0].Generations1 == 1 {
+		if half, err = s.halfSiblings(ctx, id1, id2, ids[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	relationship.Related = true
+	relationship.Description = describeKinship(relationship.CommonAncestors, person2.Gender, half)
+	return relationship, nil
+}
+
+// halfSiblings 只有一位共同父母的两人是否为同父异母或同母异父：两人都记录了另一位父母且不是同一人。
+// 另一位父母没有记录时无法判断，按兄弟姐妹处理
+func (s *IndividualService) halfSiblings(ctx context.Context, id1, id2, commonParentID int) (bool, error) {
+	parents, err := s.repo.GetParentIDs(ctx, []int{id1, id2})
+	if err != nil {
+		return false, err
+	}
+	others := func(id int) map[int]bool {
+		result := make(map[int]bool)
+		for _, parentID := range parents[id] {
+			if parentID != commonParentID {
+				result[parentID] = true
+			}
+		}
+		return result
+	}
+	others1, others2 := others(id1), others(id2)
+	if len(others1) == 0 || len(others2) == 0 {
+		return false, nil
+	}
+	for parentID := range others1 {
+		if others2[parentID] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// describeKinship 根据与最近共同祖先相隔的代数生成亲属称谓，half 表示只有一位共同父母的兄弟姐妹
+func describeKinship(nearest []models.CommonAncestor, gender models.Gender, half bool) string {
+	up, down := nearest[0].Generations1, nearest[0].Generations2
+
+	switch {
+	case up == 0:
+		return descendantTerm(down, gender)
+	case down == 0:
+		return ancestorTerm(up, gender)
+	case up == 1 && down == 1:
+		term := genderedTerm(gender, "兄弟", "姐妹", "兄弟姐妹")
+		if half {
+			parent := nearest[0].Ancestor
+			if parent != nil && parent.Gender == models.GenderFemale {
+				return "同母异父的" + term
+			}
+			return "同父异母的" + term
+		}
+		return term
+	case down == 1:
+		// 对方是自己某位祖先的兄弟姐妹
+		if up == 2 {
+			return genderedTerm(gender, "伯父/叔父/舅父", "姑母/姨母", "父母的兄弟姐妹")
+		}
+		return ancestorTerm(up-1, "") + "的兄弟姐妹"
+	case up == 1:
+		// 对方是自己兄弟姐妹的后代
+		if down == 2 {
+			return genderedTerm(gender, "侄子/外甥", "侄女/外甥女", "兄弟姐妹的子女")
+		}
+		return "兄弟姐妹的" + descendantTerm(down-1, "")
+	}
+
+	degree := up - 1
+	if down < up {
+		degree = down - 1
+	}
+	term := fmt.Sprintf("%s代堂表亲", chineseNumber(degree))
+	if degree == 1 {
+		term = genderedTerm(gender, "堂表兄弟", "堂表姐妹", "堂表兄弟姐妹")
+	}
+	switch {
+	case down < up:
+		term += fmt.Sprintf("（长%s辈）", chineseNumber(up-down))
+	case down > up:
+		term += fmt.Sprintf("（晚%s辈）", chineseNumber(down-up))
+	}
+	return term
+}
+
+// ancestorTerm 直系祖先称谓
+func ancestorTerm(generations int, gender models.Gender) string {
+	switch generations {
+	case 1:
+		return genderedTerm(gender, "父亲", "母亲", "父母")
+	case 2:
+		return genderedTerm(gender, "祖父", "祖母", "祖父母")
+	case 3:
+		return genderedTerm(gender, "曾祖父", "曾祖母", "曾祖父母")
+	case 4:
+		return genderedTerm(gender, "高祖父", "高祖母", "高祖父母")
+	}
+	return fmt.Sprintf("%s世祖", chineseNumber(generations))
+}
+
+// descendantTerm 直系后代称谓
+func descendantTerm(generations int, gender models.Gender) string {
+	switch generations {
+	case 1:
+		return genderedTerm(gender, "儿子", "女儿", "子女")
+	case 2:
+		return genderedTerm(gender, "孙子", "孙女", "孙辈")
+	case 3:
+		return genderedTerm(gender, "曾孙", "曾孙女", "曾孙辈")
+	case 4:
+		return genderedTerm(gender, "玄孙", "玄孙女", "玄孙辈")
+	}
+	return fmt.Sprintf("%s世孙", chineseNumber(generations))
+}
+
+// genderedTerm 按性别选择称谓，性别未知时使用通称
+func genderedTerm(gender models.Gender, male, female, neutral string) string {
+	switch gender {
+	case models.GenderMale:
+		return male
+	case models.GenderFemale:
+		return female
+	}
+	return neutral
+}
+
+// chineseNumber 将 1-99 的整数转为中文数字
+func chineseNumber(n int) string {
+	digits := []string{"零", "一", "二", "三", "四", "五", "六", "七", "八", "九"}
+	switch {
+	case n < 0 || n >= 100:
+		return fmt.Sprintf("%d", n)
+	case n < 10:
+		return digits[n]
+	case n == 10:
+		return "十"
+	case n < 20:
+		return "十" + digits[n%10]
+	case n%10 == 0:
+		return digits[n/10] + "十"
+	}
+	return digits[n/10] + "十" + digits[n%10]
+}
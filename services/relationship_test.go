@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"familytree/models"
+)
+
+func TestSiblingRelationship(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+	create := func(name string, gender models.Gender, fatherID, motherID *int) int {
+		t.Helper()
+		person, err := repo.CreateIndividual(ctx, &models.Individual{FullName: name, Gender: gender, FatherID: fatherID, MotherID: motherID})
+		if err != nil {
+			t.Fatalf("创建个人失败: %v", err)
+		}
+		return person.IndividualID
+	}
+	father := create("林父", models.GenderMale, nil, nil)
+	mother1 := create("林母", models.GenderFemale, nil, nil)
+	mother2 := create("继母", models.GenderFemale, nil, nil)
+	elder := create("林甲", models.GenderMale, &father, &mother1)
+	younger := create("林乙", models.GenderMale, &father, &mother2)
+	unknown := create("林丙", models.GenderFemale, &father, nil)
+	onlyFather := create("林丁", models.GenderMale, &father, nil)
+	service := NewIndividualService(repo, repo, repo)
+
+	tests := []struct {
+		name     string
+		id1, id2 int
+		want     string
+	}{
+		{"另一位父母不同", elder, younger, "同父异母的兄弟"},
+		// 另一位父母没有记录时无法判断是否同母
+		{"一方缺少母亲", elder, unknown, "姐妹"},
+		{"双方都缺少母亲", unknown, onlyFather, "兄弟"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			relationship, err := service.GetRelationship(ctx, tt.id1, tt.id2)
+			if err != nil {
+				t.Fatalf("计算关系失败: %v", err)
+			}
+			if relationship.Description != tt.want {
+				t.Errorf("got %q, want %q", relationship.Description, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,361 @@
+package services
+
+import (
+	"context"
+	"sort"
+
+	"familytree/interfaces"
+	"familytree/models"
+	"familytree/pkg/errors"
+	"familytree/pkg/report"
+)
+
+// ReportService 世系报告服务，世系来自 GetDescendantLineage/GetAncestorLineage
+type ReportService struct {
+	individualService interfaces.IndividualService
+	individualRepo    interfaces.IndividualRepository
+	familyRepo        interfaces.FamilyRepository
+	recordRepo        interfaces.RecordRepository
+}
+
+// NewReportService 创建世系报告服务
+func NewReportService(individualService interfaces.IndividualService, individualRepo interfaces.IndividualRepository,
+	familyRepo interfaces.FamilyRepository, recordRepo interfaces.RecordRepository) interfaces.ReportService {
+	return &ReportService{
+		individualService: individualService,
+		individualRepo:    individualRepo,
+		familyRepo:        familyRepo,
+		recordRepo:        recordRepo,
+	}
+}
+
+// GetReport 生成世系报告
+func (s *ReportService) GetReport(ctx context.Context, individualID int, opts models.ReportOptions) (*models.Report, error) {
+	if individualID <= 0 {
+		return nil, errors.ErrInvalidID
+	}
+	if err := normalizeReportOptions(&opts); err != nil {
+		return nil, err
+	}
+
+	root, err := s.individualService.GetByID(ctx, individualID)
+	if err != nil {
+		return nil, err
+	}
+	var lineage []models.LineageEntry
+	if opts.Type == models.ReportAncestor {
+		lineage, err = s.individualService.GetAncestorLineage(ctx, individualID, opts.Generations)
+	} else {
+		lineage, err = s.individualService.GetDescendantLineage(ctx, individualID, opts.Generations)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.loadReportData(ctx, root, lineage)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Type == models.ReportAncestor {
+		return report.BuildAncestors(data), nil
+	}
+	return report.BuildDescendants(data, opts), nil
+}
+
+// normalizeReportOptions 校验报告选项并填充默认值
+func normalizeReportOptions(opts *models.ReportOptions) error {
+	if opts.Generations < 0 {
+		return errors.New(errors.ErrCodeInvalidInput, "代数不能为负数")
+	}
+	switch opts.Type {
+	case "":
+		opts.Type = models.ReportDescendant
+	case models.ReportDescendant, models.ReportAncestor:
+	default:
+		return errors.New(errors.ErrCodeInvalidInput, "type 只能是 descendant 或 ancestor")
+	}
+
+	if opts.Type == models.ReportAncestor {
+		if opts.Numbering != "" && opts.Numbering != models.NumberingAhnentafel {
+			return errors.New(errors.ErrCodeInvalidInput, "祖先报告只支持 ahnentafel 编号")
+		}
+		opts.Style, opts.Numbering = "", models.NumberingAhnentafel
+		return nil
+	}
+
+	switch opts.Style {
+	case "":
+		opts.Style = models.ReportStyleRegister
+	case models.ReportStyleRegister, models.ReportStyleNGSQ:
+	default:
+		return errors.New(errors.ErrCodeInvalidInput, "style 只能是 register 或 ngsq")
+	}
+	switch opts.Numbering {
+	case "":
+		opts.Numbering = models.NumberingRegister
+	case models.NumberingRegister, models.NumberingHenry, models.NumberingDAboville:
+	default:
+		return errors.New(errors.ErrCodeInvalidInput, "后代报告的 numbering 只能是 register、henry 或 daboville")
+	}
+	return nil
+}
+
+// loadReportData 批量加载世系中所有人的家庭、配偶（及配偶的父母）、事件、地点和引用
+func (s *ReportService) loadReportData(ctx context.Context, root *models.Individual, lineage []models.LineageEntry) (*report.Data, error) {
+	data := &report.Data{Root: *root, Lineage: lineage}
+	known := map[int]bool{root.IndividualID: true}
+	ids := []int{root.IndividualID}
+	for _, entry := range lineage {
+		if id := entry.Individual.IndividualID; !known[id] {
+			known[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	families, err := s.familyRepo.GetFamiliesByIndividualIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	data.Families = families
+
+	// 配偶和子女的另一位父母
+	var missing []int
+	need := func(id *int) {
+		if id != nil && !known[*id] {
+			known[*id] = true
+			missing = append(missing, *id)
+		}
+	}
+	for _, family := range families {
+		need(family.HusbandID)
+		need(family.WifeID)
+	}
+	for _, entry := range lineage {
+		need(entry.Individual.FatherID)
+		need(entry.Individual.MotherID)
+	}
+	for round := 0; round < 2 && len(missing) > 0; round++ {
+		people, err := s.individualRepo.GetIndividualsByIDs(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		data.People = append(data.People, people...)
+		// 第二轮加载配偶的父母，用于“某某之女”的叙述
+		missing = nil
+		for _, person := range people {
+			need(person.FatherID)
+			need(person.MotherID)
+		}
+	}
+
+	var placeIDs []int
+	addPlace := func(list ...*int) {
+		for _, id := range list {
+			if id != nil {
+				placeIDs = append(placeIDs, *id)
+			}
+		}
+	}
+	everyone := append([]models.Individual{*root}, data.People...)
+	for _, entry := range lineage {
+		everyone = append(everyone, entry.Individual)
+	}
+	for _, person := range everyone {
+		addPlace(person.BirthPlaceID, person.DeathPlaceID, person.BurialPlaceID)
+	}
+	familyIDs := make([]int, 0, len(families))
+	for _, family := range families {
+		familyIDs = append(familyIDs, family.FamilyID)
+		addPlace(family.MarriagePlaceID)
+	}
+
+	if err := s.attachReportNames(ctx, data); err != nil {
+		return nil, err
+	}
+
+	events, err := s.recordRepo.GetEventsByIndividualIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	data.Events = events
+	eventIDs := make([]int, 0, len(events))
+	for _, event := range events {
+		eventIDs = append(eventIDs, event.EventID)
+		addPlace(event.EventPlaceID)
+	}
+	if data.Places, err = s.recordRepo.GetPlacesByIDs(ctx, placeIDs); err != nil {
+		return nil, err
+	}
+
+	for _, entity := range []struct {
+		entityType models.EntityType
+		ids        []int
+	}{
+		{models.EntityTypeIndividual, ids},
+		{models.EntityTypeFamily, familyIDs},
+		{models.EntityTypeEvent, eventIDs},
+	} {
+		citations, err := s.recordRepo.GetCitationsByEntities(ctx, entity.entityType, entity.ids)
+		if err != nil {
+			return nil, err
+		}
+		data.Citations = append(data.Citations, citations...)
+	}
+	return data, nil
+}
+
+// attachReportNames 为报告中的人物填充字、号
+func (s *ReportService) attachReportNames(ctx context.Context, data *report.Data) error {
+	ids := []int{data.Root.IndividualID}
+	for _, entry := range data.Lineage {
+		ids = append(ids, entry.Individual.IndividualID)
+	}
+	for _, person := range data.People {
+		ids = append(ids, person.IndividualID)
+	}
+	sort.Ints(ids)
+
+	names, err := s.individualRepo.GetAlternateNames(ctx, ids)
+	if err != nil {
+		return err
+	}
+	attach := func(person *models.Individual) {
+		n, ok := names[person.IndividualID]
+		if !ok {
+			return
+		}
+		if n.CourtesyName != "" {
+			courtesy := n.CourtesyName
+			person.CourtesyName = &courtesy
+		}
+		if n.ArtName != "" {
+			art := n.ArtName
+			person.ArtName = &art
+		}
+	}
+	attach(&data.Root)
+	for i := range data.Lineage {
+		attach(&data.Lineage[i].Individual)
+	}
+	for i := range data.People {
+		attach(&data.People[i])
+	}
+	return nil
+}
+
+// GetFamilyGroupSheet 生成家庭表
+func (s *ReportService) GetFamilyGroupSheet(ctx context.Context, familyID int) (*models.FamilyGroupSheet, error) {
+	if familyID <= 0 {
+		return nil, errors.ErrInvalidID
+	}
+	// 家庭记录中已填充夫妻、结婚地点和子女关系
+	family, err := s.familyRepo.GetFamilyByID(ctx, familyID)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeNotFound, "家庭关系不存在")
+	}
+
+	// 夫妻和子女
+	var members []int
+	var people []models.Individual
+	for _, spouse := range []*models.Individual{family.Husband, family.Wife} {
+		if spouse != nil {
+			members = append(members, spouse.IndividualID)
+			people = append(people, *spouse)
+		}
+	}
+	childIDs := make([]int, 0, len(family.Children))
+	for _, child := range family.Children {
+		childIDs = append(childIDs, child.IndividualID)
+	}
+	members = append(members, childIDs...)
+	childPeople, err := s.individualRepo.GetIndividualsByIDs(ctx, childIDs)
+	if err != nil {
+		return nil, err
+	}
+	people = append(people, childPeople...)
+	data := &report.Data{People: people}
+
+	// 子女的家庭用于列出配偶，夫妻的家庭记录中已包含本家庭
+	childFamilies, err := s.familyRepo.GetFamiliesByIndividualIDs(ctx, childIDs)
+	if err != nil {
+		return nil, err
+	}
+	data.Families = append([]models.Family{*family}, childFamilies...)
+
+	// 夫妻的父母与子女的配偶
+	known := map[int]bool{}
+	for _, person := range people {
+		known[person.IndividualID] = true
+	}
+	var relatives []int
+	need := func(id *int) {
+		if id != nil && !known[*id] {
+			known[*id] = true
+			relatives = append(relatives, *id)
+		}
+	}
+	for _, person := range people {
+		if (family.HusbandID != nil && person.IndividualID == *family.HusbandID) ||
+			(family.WifeID != nil && person.IndividualID == *family.WifeID) {
+			need(person.FatherID)
+			need(person.MotherID)
+		}
+	}
+	for _, f := range childFamilies {
+		need(f.HusbandID)
+		need(f.WifeID)
+	}
+	if len(relatives) > 0 {
+		others, err := s.individualRepo.GetIndividualsByIDs(ctx, relatives)
+		if err != nil {
+			return nil, err
+		}
+		data.People = append(data.People, others...)
+	}
+	if err := s.attachReportNames(ctx, data); err != nil {
+		return nil, err
+	}
+
+	events, err := s.recordRepo.GetEventsByIndividualIDs(ctx, members)
+	if err != nil {
+		return nil, err
+	}
+	data.Events = events
+
+	placeIDs := []int{}
+	eventIDs := make([]int, 0, len(events))
+	addPlace := func(list ...*int) {
+		for _, id := range list {
+			if id != nil {
+				placeIDs = append(placeIDs, *id)
+			}
+		}
+	}
+	addPlace(family.MarriagePlaceID)
+	for _, person := range people {
+		addPlace(person.BirthPlaceID, person.DeathPlaceID, person.BurialPlaceID)
+	}
+	for _, event := range events {
+		eventIDs = append(eventIDs, event.EventID)
+		addPlace(event.EventPlaceID)
+	}
+	if data.Places, err = s.recordRepo.GetPlacesByIDs(ctx, placeIDs); err != nil {
+		return nil, err
+	}
+
+	for _, entity := range []struct {
+		entityType models.EntityType
+		ids        []int
+	}{
+		{models.EntityTypeIndividual, members},
+		{models.EntityTypeFamily, []int{familyID}},
+		{models.EntityTypeEvent, eventIDs},
+	} {
+		citations, err := s.recordRepo.GetCitationsByEntities(ctx, entity.entityType, entity.ids)
+		if err != nil {
+			return nil, err
+		}
+		data.Citations = append(data.Citations, citations...)
+	}
+	return report.BuildFamilyGroupSheet(family, data), nil
+}
@@ -0,0 +1,516 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"familytree/interfaces"
+	"familytree/models"
+	"familytree/pkg/errors"
+	"familytree/pkg/narrative"
+)
+
+// 研究缺口查询的默认与最大条数
+const (
+	defaultGapLimit = 100
+	maxGapLimit     = 1000
+)
+
+// completenessWeights 评分项及权重，合计 100
+var completenessWeights = []struct {
+	key, label string
+	weight     int
+}{
+	{models.CompletenessBirthDate, "出生日期", 15},
+	{models.CompletenessDeathDate, "去世日期", 10},
+	{models.CompletenessBirthPlace, "出生地点", 10},
+	{models.CompletenessDeathPlace, "去世地点", 5},
+	{models.CompletenessParents, "父母", 20},
+	{models.CompletenessSpouse, "配偶", 10},
+	{models.CompletenessSources, "来源", 20},
+	{models.CompletenessPhoto, "照片", 10},
+}
+
+// gapOrder 同一代数内缺口的排列顺序
+var gapOrder = map[string]int{
+	models.GapEndOfLine:        0,
+	models.GapMissingBirthDate: 1,
+	models.GapUnsourcedFact:    2,
+}
+
+// ResearchService 资料完整度与研究缺口服务
+type ResearchService struct {
+	individualRepo interfaces.IndividualRepository
+	familyRepo     interfaces.FamilyRepository
+	recordRepo     interfaces.RecordRepository
+	familyTreeRepo interfaces.FamilyTreeRepository
+}
+
+// NewResearchService 创建资料完整度与研究缺口服务
+func NewResearchService(individualRepo interfaces.IndividualRepository, familyRepo interfaces.FamilyRepository,
+	recordRepo interfaces.RecordRepository, familyTreeRepo interfaces.FamilyTreeRepository) interfaces.ResearchService {
+	return &ResearchService{
+		individualRepo: individualRepo,
+		familyRepo:     familyRepo,
+		recordRepo:     recordRepo,
+		familyTreeRepo: familyTreeRepo,
+	}
+}
+
+// researchData 评分与缺口查询所需的资料
+type researchData struct {
+	people   []models.Individual
+	byID     map[int]*models.Individual
+	parents  map[int][]int
+	spouses  map[int][]int
+	events   map[int][]models.Event
+	citedInd map[int]bool
+	citedEvt map[int]bool
+	asOf     time.Time
+}
+
+// fact 一项需要来源支持的事实
+type fact struct {
+	key      string // birth、death 或事件类型
+	eventID  int
+	sourced  bool
+	describe string
+}
+
+// GetCompleteness 个人资料的完整度评分
+func (s *ResearchService) GetCompleteness(ctx context.Context, individualID int) (*models.Completeness, error) {
+	if individualID <= 0 {
+		return nil, errors.ErrInvalidID
+	}
+	person, err := s.individualRepo.GetIndividualByID(ctx, individualID)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeNotFound, "个人信息不存在")
+	}
+	data, err := s.loadResearchData(ctx, []models.Individual{*person})
+	if err != nil {
+		return nil, err
+	}
+	result := data.completeness(&data.people[0])
+	return &result, nil
+}
+
+// GetTreeCompleteness 家族树全体成员的完整度评分，得分低的排在前面
+func (s *ResearchService) GetTreeCompleteness(ctx context.Context, userID, familyTreeID int) (*models.TreeCompleteness, error) {
+	if _, err := ownedFamilyTree(ctx, s.familyTreeRepo, userID, familyTreeID); err != nil {
+		return nil, err
+	}
+	data, err := s.loadTree(ctx, familyTreeID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.TreeCompleteness{FamilyTreeID: familyTreeID, People: make([]models.Completeness, 0, len(data.people))}
+	total := 0
+	for i := range data.people {
+		c := data.completeness(&data.people[i])
+		total += c.Score
+		result.People = append(result.People, c)
+	}
+	sort.SliceStable(result.People, func(i, j int) bool {
+		if result.People[i].Score != result.People[j].Score {
+			return result.People[i].Score < result.People[j].Score
+		}
+		return result.People[i].IndividualID < result.People[j].IndividualID
+	})
+	if len(result.People) > 0 {
+		result.Average = math.Round(float64(total)/float64(len(result.People))*10) / 10
+	}
+	return result, nil
+}
+
+// GetResearchGaps 列出研究缺口，按与起始人物相隔的代数排列，没有关联的人排在最后
+func (s *ResearchService) GetResearchGaps(ctx context.Context, userID, familyTreeID int, opts models.GapOptions) (*models.ResearchGaps, error) {
+	for _, t := range opts.Types {
+		if _, ok := gapOrder[t]; !ok {
+			return nil, errors.New(errors.ErrCodeInvalidInput, "types 只能包含 end_of_line、missing_birth_date、unsourced_fact")
+		}
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = defaultGapLimit
+	}
+	if opts.Limit > maxGapLimit {
+		return nil, errors.New(errors.ErrCodeInvalidInput, fmt.Sprintf("limit 不能超过 %d", maxGapLimit))
+	}
+
+	tree, err := ownedFamilyTree(ctx, s.familyTreeRepo, userID, familyTreeID)
+	if err != nil {
+		return nil, err
+	}
+	rootID := opts.RootID
+	if rootID == nil {
+		rootID = tree.RootPersonID
+	}
+	if rootID == nil {
+		return nil, errors.New(errors.ErrCodeInvalidInput, "家族树未设置起始人物，请指定 root_id")
+	}
+
+	data, err := s.loadTree(ctx, familyTreeID)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := data.byID[*rootID]; !ok {
+		return nil, errors.New(errors.ErrCodeNotFound, "起始人物不在该家族树中")
+	}
+
+	distance := data.distances(*rootID)
+	var gaps []models.ResearchGap
+	add := func(gapType string, person *models.Individual, f *fact, description string) {
+		if !wants(opts.Types, gapType) {
+			return
+		}
+		d, ok := distance[person.IndividualID]
+		if !ok {
+			d = -1
+		}
+		gap := models.ResearchGap{
+			Type:         gapType,
+			IndividualID: person.IndividualID,
+			FullName:     person.FullName,
+			Distance:     d,
+			Description:  description,
+		}
+		if f != nil {
+			gap.Fact = f.key
+			gap.EventID = f.eventID
+		}
+		gaps = append(gaps, gap)
+	}
+
+	for _, id := range data.ancestors(*rootID) {
+		person := data.byID[id]
+		if len(data.parents[id]) == 0 {
+			add(models.GapEndOfLine, person, nil, "没有已知的父母")
+		}
+	}
+	for i := range data.people {
+		person := &data.people[i]
+		if data.birthDate(person) == nil {
+			add(models.GapMissingBirthDate, person, nil, "缺少出生日期")
+		}
+		for _, f := range data.facts(person) {
+			if !f.sourced {
+				f := f
+				add(models.GapUnsourcedFact, person, &f, f.describe+"没有来源")
+			}
+		}
+	}
+
+	sort.SliceStable(gaps, func(i, j int) bool {
+		a, b := gaps[i], gaps[j]
+		if a.Distance != b.Distance {
+			if a.Distance < 0 || b.Distance < 0 {
+				return b.Distance < 0
+			}
+			return a.Distance < b.Distance
+		}
+		if a.Type != b.Type {
+			return gapOrder[a.Type] < gapOrder[b.Type]
+		}
+		if a.IndividualID != b.IndividualID {
+			return a.IndividualID < b.IndividualID
+		}
+		return a.EventID < b.EventID
+	})
+
+	result := &models.ResearchGaps{FamilyTreeID: familyTreeID, RootPersonID: *rootID, Total: len(gaps), Gaps: gaps}
+	if result.Gaps == nil {
+		result.Gaps = []models.ResearchGap{}
+	}
+	if len(result.Gaps) > opts.Limit {
+		result.Gaps = result.Gaps[:opts.Limit]
+	}
+	return result, nil
+}
+
+// loadTree 加载家族树全体成员的资料
+func (s *ResearchService) loadTree(ctx context.Context, familyTreeID int) (*researchData, error) {
+	people, err := s.individualRepo.GetIndividualsByFamilyTreeID(ctx, familyTreeID)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "加载家族树成员失败")
+	}
+	return s.loadResearchData(ctx, people)
+}
+
+// loadResearchData 批量加载父母、配偶、事件和引用
+func (s *ResearchService) loadResearchData(ctx context.Context, people []models.Individual) (*researchData, error) {
+	data := &researchData{
+		people:   people,
+		byID:     make(map[int]*models.Individual, len(people)),
+		spouses:  map[int][]int{},
+		events:   map[int][]models.Event{},
+		citedInd: map[int]bool{},
+		citedEvt: map[int]bool{},
+		asOf:     time.Now(),
+	}
+	ids := make([]int, 0, len(people))
+	for i := range people {
+		data.byID[people[i].IndividualID] = &people[i]
+		ids = append(ids, people[i].IndividualID)
+	}
+	if len(ids) == 0 {
+		data.parents = map[int][]int{}
+		return data, nil
+	}
+
+	var err error
+	if data.parents, err = s.individualRepo.GetParentIDs(ctx, ids); err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "加载父母失败")
+	}
+
+	families, err := s.familyRepo.GetFamiliesByIndividualIDs(ctx, ids)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "加载家庭关系失败")
+	}
+	for _, family := range families {
+		if family.HusbandID != nil && family.WifeID != nil {
+			data.spouses[*family.HusbandID] = append(data.spouses[*family.HusbandID], *family.WifeID)
+			data.spouses[*family.WifeID] = append(data.spouses[*family.WifeID], *family.HusbandID)
+		}
+	}
+
+	events, err := s.recordRepo.GetEventsByIndividualIDs(ctx, ids)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "加载事件失败")
+	}
+	eventIDs := make([]int, 0, len(events))
+	for _, event := range events {
+		data.events[event.IndividualID] = append(data.events[event.IndividualID], event)
+		eventIDs = append(eventIDs, event.EventID)
+	}
+
+	citations, err := s.recordRepo.GetCitationsByEntities(ctx, models.EntityTypeIndividual, ids)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "加载引用失败")
+	}
+	for _, c := range citations {
+		data.citedInd[c.EntityID] = true
+	}
+	if len(eventIDs) > 0 {
+		if citations, err = s.recordRepo.GetCitationsByEntities(ctx, models.EntityTypeEvent, eventIDs); err != nil {
+			return nil, errors.Wrap(err, errors.ErrCodeInternalError, "加载引用失败")
+		}
+		for _, c := range citations {
+			data.citedEvt[c.EntityID] = true
+		}
+	}
+	return data, nil
+}
+
+// completeness 计算一个人的完整度
+func (d *researchData) completeness(person *models.Individual) models.Completeness {
+	deceased := d.deceased(person)
+	facts := d.facts(person)
+
+	result := models.Completeness{IndividualID: person.IndividualID, FullName: person.FullName}
+	earned := 0.0
+	for _, w := range completenessWeights {
+		item := models.CompletenessItem{Key: w.key, Label: w.label, Weight: w.weight, Applicable: true}
+		ratio := 0.0
+		switch w.key {
+		case models.CompletenessBirthDate:
+			ratio = present(d.birthDate(person) != nil)
+		case models.CompletenessDeathDate:
+			item.Applicable = deceased
+			ratio = present(!deceased || person.DeathDate != nil || d.eventDate(person, "death") != nil)
+		case models.CompletenessBirthPlace:
+			ratio = present(person.BirthPlaceID != nil || nonEmpty(person.BirthPlace) || d.eventPlace(person, "birth", "christening", "baptism"))
+		case models.CompletenessDeathPlace:
+			item.Applicable = deceased
+			ratio = present(!deceased || person.DeathPlaceID != nil || nonEmpty(person.DeathPlace) ||
+				person.BurialPlaceID != nil || nonEmpty(person.BurialPlace) || d.eventPlace(person, "death", "burial"))
+		case models.CompletenessParents:
+			known := len(d.parents[person.IndividualID])
+			if known > 2 {
+				known = 2
+			}
+			ratio = float64(known) / 2
+			item.Detail = fmt.Sprintf("已知 %d 位", known)
+		case models.CompletenessSpouse:
+			ratio = present(len(d.spouses[person.IndividualID]) > 0)
+		case models.CompletenessSources:
+			sourced := 0
+			for _, f := range facts {
+				if f.sourced {
+					sourced++
+				}
+			}
+			if len(facts) > 0 {
+				ratio = float64(sourced) / float64(len(facts))
+			}
+			item.Detail = fmt.Sprintf("%d/%d 项事实有来源", sourced, len(facts))
+		case models.CompletenessPhoto:
+			ratio = present(nonEmpty(person.PhotoURL))
+		}
+		item.Earned = math.Round(float64(w.weight)*ratio*10) / 10
+		earned += item.Earned
+		if ratio < 1 {
+			result.Missing = append(result.Missing, w.label)
+		}
+		result.Items = append(result.Items, item)
+	}
+	result.Score = int(math.Round(earned))
+	return result
+}
+
+// facts 需要来源支持的事实：出生、去世（个人记录或对应事件）以及其他事件。
+// 出生、去世以个人或对应事件上的引用为来源
+func (d *researchData) facts(person *models.Individual) []fact {
+	var facts []fact
+	vitals := []struct {
+		key, label string
+		present    bool
+	}{
+		{"birth", "出生", person.BirthDate != nil || person.BirthPlaceID != nil || nonEmpty(person.BirthPlace)},
+		{"death", "去世", person.DeathDate != nil || person.DeathPlaceID != nil || nonEmpty(person.DeathPlace)},
+	}
+	for _, v := range vitals {
+		f := fact{key: v.key, sourced: d.citedInd[person.IndividualID], describe: v.label}
+		present := v.present
+		for _, event := range d.events[person.IndividualID] {
+			if strings.EqualFold(event.EventType, v.key) {
+				present = true
+				if f.eventID == 0 {
+					f.eventID = event.EventID
+				}
+				f.sourced = f.sourced || d.citedEvt[event.EventID]
+			}
+		}
+		if present {
+			facts = append(facts, f)
+		}
+	}
+	for _, event := range d.events[person.IndividualID] {
+		eventType := strings.ToLower(event.EventType)
+		if eventType == "birth" || eventType == "death" {
+			continue
+		}
+		describe := narrative.EventName(event.EventType)
+		if event.EventDate != nil {
+			describe = narrative.FormatDate(event.EventDate) + describe
+		}
+		facts = append(facts, fact{key: event.EventType, eventID: event.EventID, sourced: d.citedEvt[event.EventID], describe: describe})
+	}
+	return facts
+}
+
+// birthDate 出生日期，个人记录没有时取出生、洗礼事件的日期
+func (d *researchData) birthDate(person *models.Individual) *time.Time {
+	if person.BirthDate != nil {
+		return person.BirthDate
+	}
+	return d.eventDate(person, "birth", "christening", "baptism")
+}
+
+// eventDate 第一个指定类型且有日期的事件的日期
+func (d *researchData) eventDate(person *models.Individual, types ...string) *time.Time {
+	for _, event := range d.events[person.IndividualID] {
+		if event.EventDate != nil && matchesType(event.EventType, types) {
+			return event.EventDate
+		}
+	}
+	return nil
+}
+
+// eventPlace 是否有指定类型且有地点的事件
+func (d *researchData) eventPlace(person *models.Individual, types ...string) bool {
+	for _, event := range d.events[person.IndividualID] {
+		if event.EventPlaceID != nil && matchesType(event.EventType, types) {
+			return true
+		}
+	}
+	return false
+}
+
+// deceased 有死亡或安葬记录，或出生已超过 calendarLivingYears 年
+func (d *researchData) deceased(person *models.Individual) bool {
+	if isDeceased(person, d.asOf) {
+		return true
+	}
+	for _, event := range d.events[person.IndividualID] {
+		if matchesType(event.EventType, []string{"death", "burial"}) {
+			return true
+		}
+	}
+	if birth := d.birthDate(person); birth != nil {
+		return birth.Year() <= d.asOf.Year()-calendarLivingYears
+	}
+	return false
+}
+
+// ancestors 起始人物及其全部祖先，按代数由近及远
+func (d *researchData) ancestors(rootID int) []int {
+	seen := map[int]bool{rootID: true}
+	queue := []int{rootID}
+	for i := 0; i < len(queue); i++ {
+		for _, parentID := range d.parents[queue[i]] {
+			if _, ok := d.byID[parentID]; ok && !seen[parentID] {
+				seen[parentID] = true
+				queue = append(queue, parentID)
+			}
+		}
+	}
+	return queue
+}
+
+// distances 每人与起始人物相隔的代数：沿父母、子女关系每步计 1，配偶关系不计
+func (d *researchData) distances(rootID int) map[int]int {
+	children := map[int][]int{}
+	for childID, parentIDs := range d.parents {
+		for _, parentID := range parentIDs {
+			children[parentID] = append(children[parentID], childID)
+		}
+	}
+
+	// 0-1 BFS：配偶边放在队首，父母子女边放在队尾
+	dist := map[int]int{rootID: 0}
+	deque := []int{rootID}
+	for len(deque) > 0 {
+		id := deque[0]
+		deque = deque[1:]
+		for _, spouseID := range d.spouses[id] {
+			if old, ok := dist[spouseID]; !ok || dist[id] < old {
+				dist[spouseID] = dist[id]
+				deque = append([]int{spouseID}, deque...)
+			}
+		}
+		for _, next := range append(append([]int{}, d.parents[id]...), children[id]...) {
+			if old, ok := dist[next]; !ok || dist[id]+1 < old {
+				dist[next] = dist[id] + 1
+				deque = append(deque, next)
+			}
+		}
+	}
+	return dist
+}
+
+// matchesType 事件类型是否属于 types（不区分大小写）
+func matchesType(eventType string, types []string) bool {
+	for _, t := range types {
+		if strings.EqualFold(eventType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// present 有则满分
+func present(ok bool) float64 {
+	if ok {
+		return 1
+	}
+	return 0
+}
+
+// nonEmpty 字符串指针非空
+func nonEmpty(s *string) bool {
+	return s != nil && strings.TrimSpace(*s) != ""
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"familytree/models"
+)
+
+func TestCompleteness(t *testing.T) {
+	asOf := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	date := func(year int) *time.Time {
+		d := time.Date(year, 6, 1, 0, 0, 0, 0, time.UTC)
+		return &d
+	}
+	text := func(s string) *string { return &s }
+
+	tests := []struct {
+		name    string
+		person  models.Individual
+		parents []int
+		spouses []int
+		events  []models.Event
+		// 个人、事件 10 是否有引用
+		citedInd, citedEvt bool
+		score              int
+		missing            []string
+	}{
+		{
+			// 在世的人不要求去世日期和地点；出生没有来源
+			name:    "在世",
+			person:  models.Individual{IndividualID: 1, BirthDate: date(1990), BirthPlace: text("苏州")},
+			parents: []int{2},
+			spouses: []int{3},
+			score:   60,
+			missing: []string{"父母", "来源", "照片"},
+		},
+		{
+			// 去世事件说明已故，个人上的引用作为出生、去世的来源
+			name:     "由事件判定已故",
+			person:   models.Individual{IndividualID: 1, BirthDate: date(1950), PhotoURL: text("/photos/1.jpg")},
+			parents:  []int{2, 3},
+			events:   []models.Event{{EventID: 10, IndividualID: 1, EventType: "Death", EventDate: date(2000), EventPlaceID: intPtr(5)}},
+			citedInd: true,
+			score:    80,
+			missing:  []string{"出生地点", "配偶"},
+		},
+		{
+			// 出生日期取自出生事件；只有一半的事实有来源，父母超过两位按两位计
+			name:     "部分有来源",
+			person:   models.Individual{IndividualID: 1},
+			parents:  []int{2, 3, 4},
+			events:   []models.Event{{EventID: 10, IndividualID: 1, EventType: "birth", EventDate: date(1990)}, {EventID: 11, IndividualID: 1, EventType: "marriage"}},
+			citedEvt: true,
+			score:    60,
+			missing:  []string{"出生地点", "配偶", "来源", "照片"},
+		},
+		{
+			name:    "没有资料",
+			person:  models.Individual{IndividualID: 1},
+			score:   15,
+			missing: []string{"出生日期", "出生地点", "父母", "配偶", "来源", "照片"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := &researchData{
+				people:   []models.Individual{tt.person},
+				parents:  map[int][]int{1: tt.parents},
+				spouses:  map[int][]int{1: tt.spouses},
+				events:   map[int][]models.Event{1: tt.events},
+				citedInd: map[int]bool{1: tt.citedInd},
+				citedEvt: map[int]bool{10: tt.citedEvt},
+				asOf:     asOf,
+			}
+			got := data.completeness(&data.people[0])
+			if got.Score != tt.score || !reflect.DeepEqual(got.Missing, tt.missing) {
+				t.Errorf("得分 %d，缺少 %v；want %d，%v\n%+v", got.Score, got.Missing, tt.score, tt.missing, got.Items)
+			}
+		})
+	}
+}
+
+func TestResearchGaps(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+	userID, familyTreeID := newTestTree(t, repo, "research")
+	service := NewResearchService(repo, repo, repo, repo)
+
+	born := time.Date(1950, 1, 1, 0, 0, 0, 0, time.UTC)
+	create := func(person models.Individual) int {
+		t.Helper()
+		created, err := repo.CreateIndividualInTree(ctx, userID, familyTreeID, &person)
+		if err != nil {
+			t.Fatalf("创建个人失败: %v", err)
+		}
+		return created.IndividualID
+	}
+	father := create(models.Individual{FullName: "郑父", Gender: models.GenderMale})
+	mother := create(models.Individual{FullName: "郑母", Gender: models.GenderFemale, BirthDate: &born})
+	root := create(models.Individual{FullName: "郑甲", Gender: models.GenderMale, BirthDate: &born, FatherID: &father, MotherID: &mother})
+	wife := create(models.Individual{FullName: "钱氏", Gender: models.GenderFemale})
+	child := create(models.Individual{FullName: "郑乙", Gender: models.GenderMale, FatherID: &root, MotherID: &wife})
+	other := create(models.Individual{FullName: "无关", Gender: models.GenderMale})
+	if _, err := repo.CreateFamily(ctx, &models.Family{HusbandID: &root, WifeID: &wife, MarriageOrder: 1}); err != nil {
+		t.Fatalf("创建家庭失败: %v", err)
+	}
+
+	type gap struct {
+		gapType    string
+		individual int
+		distance   int
+	}
+	list := func(opts models.GapOptions) ([]gap, int) {
+		t.Helper()
+		opts.RootID = &root
+		result, err := service.GetResearchGaps(ctx, userID, familyTreeID, opts)
+		if err != nil {
+			t.Fatalf("查询研究缺口失败: %v", err)
+		}
+		var gaps []gap
+		for _, g := range result.Gaps {
+			gaps = append(gaps, gap{g.Type, g.IndividualID, g.Distance})
+		}
+		return gaps, result.Total
+	}
+
+	// 配偶与本人同代；同一代内依次为断线、缺出生日期、事实无来源；没有关联的人排在最后
+	got, total := list(models.GapOptions{})
+	want := []gap{
+		{models.GapMissingBirthDate, wife, 0},
+		{models.GapUnsourcedFact, root, 0},
+		{models.GapEndOfLine, father, 1},
+		{models.GapEndOfLine, mother, 1},
+		{models.GapMissingBirthDate, father, 1},
+		{models.GapMissingBirthDate, child, 1},
+		{models.GapUnsourcedFact, mother, 1},
+		{models.GapMissingBirthDate, other, -1},
+	}
+	if !reflect.DeepEqual(got, want) || total != len(want) {
+		t.Errorf("研究缺口:\n got %v\nwant %v", got, want)
+	}
+
+	got, total = list(models.GapOptions{Types: []string{models.GapEndOfLine}, Limit: 1})
+	if !reflect.DeepEqual(got, want[2:3]) || total != 2 {
+		t.Errorf("按类型筛选并限制条数: %v, total %d", got, total)
+	}
+
+	if _, err := service.GetResearchGaps(ctx, userID, familyTreeID, models.GapOptions{RootID: &root, Types: []string{"unknown"}}); err == nil {
+		t.Error("未知的缺口类型应返回错误")
+	}
+}
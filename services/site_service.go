@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"familytree/interfaces"
+	"familytree/models"
+	"familytree/pkg/errors"
+	"familytree/pkg/site"
+)
+
+// SiteService 静态网站生成服务
+type SiteService struct {
+	individualRepo interfaces.IndividualRepository
+	familyRepo     interfaces.FamilyRepository
+	recordRepo     interfaces.RecordRepository
+	familyTreeRepo interfaces.FamilyTreeRepository
+	photoClient    *http.Client
+}
+
+// NewSiteService 创建静态网站生成服务
+func NewSiteService(individualRepo interfaces.IndividualRepository, familyRepo interfaces.FamilyRepository,
+	recordRepo interfaces.RecordRepository, familyTreeRepo interfaces.FamilyTreeRepository) interfaces.SiteService {
+	return &SiteService{
+		individualRepo: individualRepo,
+		familyRepo:     familyRepo,
+		recordRepo:     recordRepo,
+		familyTreeRepo: familyTreeRepo,
+		photoClient:    newPhotoClient(),
+	}
+}
+
+// GenerateSite 加载家族树全部成员及其家庭、事件、地点和引用，生成静态网站
+func (s *SiteService) GenerateSite(ctx context.Context, familyTreeID int, dir string, opts models.SiteOptions) (*models.SiteResult, error) {
+	if familyTreeID <= 0 {
+		return nil, errors.ErrInvalidID
+	}
+	if strings.TrimSpace(dir) == "" {
+		return nil, errors.New(errors.ErrCodeInvalidInput, "输出目录不能为空")
+	}
+	if opts.LivingYears < 0 {
+		return nil, errors.New(errors.ErrCodeInvalidInput, "在世年限不能为负数")
+	}
+
+	tree, err := s.familyTreeRepo.GetFamilyTreeByID(ctx, familyTreeID)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeNotFound, "家族树不存在")
+	}
+	data, err := s.loadSiteData(ctx, tree)
+	if err != nil {
+		return nil, err
+	}
+
+	siteOpts := site.Options{AsOf: opts.AsOf, LivingYears: opts.LivingYears}
+	if opts.Photos {
+		siteOpts.PhotoLoader = func(url string) ([]byte, error) {
+			return fetchPhoto(s.photoClient, url)
+		}
+	}
+	result, err := site.Generate(dir, data, siteOpts)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "生成静态网站失败")
+	}
+	return result, nil
+}
+
+// loadSiteData 批量加载家族树成员的家庭、子女、字号、事件、地点和引用
+func (s *SiteService) loadSiteData(ctx context.Context, tree *models.UserFamilyTree) (*site.Data, error) {
+	people, err := s.individualRepo.GetIndividualsByFamilyTreeID(ctx, tree.FamilyTreeID)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "加载家族树成员失败")
+	}
+	data := &site.Data{Tree: *tree, People: people}
+	ids := make([]int, 0, len(people))
+	for _, person := range people {
+		ids = append(ids, person.IndividualID)
+	}
+	if len(ids) == 0 {
+		return data, nil
+	}
+
+	names, err := s.individualRepo.GetAlternateNames(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range data.People {
+		n, ok := names[data.People[i].IndividualID]
+		if !ok {
+			continue
+		}
+		if n.CourtesyName != "" {
+			courtesy := n.CourtesyName
+			data.People[i].CourtesyName = &courtesy
+		}
+		if n.ArtName != "" {
+			art := n.ArtName
+			data.People[i].ArtName = &art
+		}
+	}
+
+	if data.Families, err = s.familyRepo.GetFamiliesByIndividualIDs(ctx, ids); err != nil {
+		return nil, err
+	}
+	familyIDs := make([]int, 0, len(data.Families))
+	for _, family := range data.Families {
+		familyIDs = append(familyIDs, family.FamilyID)
+	}
+	if data.Children, err = s.familyRepo.GetChildrenByFamilyIDs(ctx, familyIDs); err != nil {
+		return nil, err
+	}
+	if data.Events, err = s.recordRepo.GetEventsByIndividualIDs(ctx, ids); err != nil {
+		return nil, err
+	}
+
+	var placeIDs []int
+	addPlace := func(list ...*int) {
+		for _, id := range list {
+			if id != nil {
+				placeIDs = append(placeIDs, *id)
+			}
+		}
+	}
+	for _, person := range people {
+		addPlace(person.BirthPlaceID, person.DeathPlaceID, person.BurialPlaceID)
+	}
+	for _, family := range data.Families {
+		addPlace(family.MarriagePlaceID)
+	}
+	eventIDs := make([]int, 0, len(data.Events))
+	for _, event := range data.Events {
+		eventIDs = append(eventIDs, event.EventID)
+		addPlace(event.EventPlaceID)
+	}
+	if data.Places, err = s.recordRepo.GetPlacesByIDs(ctx, placeIDs); err != nil {
+		return nil, err
+	}
+
+	for _, entity := range []struct {
+		entityType models.EntityType
+		ids        []int
+	}{
+		{models.EntityTypeIndividual, ids},
+		{models.EntityTypeFamily, familyIDs},
+		{models.EntityTypeEvent, eventIDs},
+	} {
+		citations, err := s.recordRepo.GetCitationsByEntities(ctx, entity.entityType, entity.ids)
+		if err != nil {
+			return nil, err
+		}
+		data.Citations = append(data.Citations, citations...)
+	}
+	return data, nil
+}
@@ -0,0 +1,346 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"familytree/interfaces"
+	"familytree/models"
+	"familytree/pkg/errors"
+)
+
+// 快照名称的最大长度（字符）
+const maxSnapshotName = 100
+
+// currentStateName 差异中表示当前状态
+const currentStateName = "current"
+
+// snapshotIgnored 比较时忽略的字段
+var snapshotIgnored = map[string]bool{"created_at": true, "updated_at": true}
+
+// SnapshotService 家族树快照服务
+type SnapshotService struct {
+	snapshotRepo   interfaces.SnapshotRepository
+	familyTreeRepo interfaces.FamilyTreeRepository
+}
+
+// NewSnapshotService 创建家族树快照服务
+func NewSnapshotService(snapshotRepo interfaces.SnapshotRepository, familyTreeRepo interfaces.FamilyTreeRepository) interfaces.SnapshotService {
+	return &SnapshotService{
+		snapshotRepo:   snapshotRepo,
+		familyTreeRepo: familyTreeRepo,
+	}
+}
+
+// CreateSnapshot 保存家族树当前状态的命名快照，同一家族树中名称不能重复
+func (s *SnapshotService) CreateSnapshot(ctx context.Context, userID, familyTreeID int, req *models.CreateSnapshotRequest) (*models.TreeSnapshot, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, errors.New(errors.ErrCodeInvalidInput, "快照名称不能为空")
+	}
+	if utf8.RuneCountInString(name) > maxSnapshotName {
+		return nil, errors.New(errors.ErrCodeInvalidInput, "快照名称不能超过100个字符")
+	}
+	if _, err := ownedFamilyTree(ctx, s.familyTreeRepo, userID, familyTreeID); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.snapshotRepo.GetSnapshots(ctx, familyTreeID)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "查询快照失败")
+	}
+	for _, snapshot := range existing {
+		if snapshot.Name == name {
+			return nil, errors.New(errors.ErrCodeAlreadyExists, "该家族树已有同名快照")
+		}
+	}
+
+	snapshot, err := s.snapshotRepo.CreateSnapshot(ctx, &models.TreeSnapshot{
+		FamilyTreeID: familyTreeID,
+		Name:         name,
+		Description:  strings.TrimSpace(req.Description),
+		UserID:       &userID,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "保存快照失败")
+	}
+	return snapshot, nil
+}
+
+// GetSnapshots 家族树的全部快照，新的在前
+func (s *SnapshotService) GetSnapshots(ctx context.Context, userID, familyTreeID int) ([]models.TreeSnapshot, error) {
+	if _, err := ownedFamilyTree(ctx, s.familyTreeRepo, userID, familyTreeID); err != nil {
+		return nil, err
+	}
+	snapshots, err := s.snapshotRepo.GetSnapshots(ctx, familyTreeID)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "查询快照失败")
+	}
+	return snapshots, nil
+}
+
+// DeleteSnapshot 删除快照，不影响家族树中的记录
+func (s *SnapshotService) DeleteSnapshot(ctx context.Context, userID, snapshotID int) error {
+	if _, err := s.getSnapshot(ctx, userID, snapshotID); err != nil {
+		return err
+	}
+	if err := s.snapshotRepo.DeleteSnapshot(ctx, snapshotID); err != nil {
+		return errors.Wrap(err, errors.ErrCodeInternalError, "删除快照失败")
+	}
+	return nil
+}
+
+// DiffSnapshot 比较快照与另一个快照（toSnapshotID 为 0 时与当前状态），列出从前者到后者的变化
+func (s *SnapshotService) DiffSnapshot(ctx context.Context, userID, snapshotID, toSnapshotID int) (*models.TreeDiff, error) {
+	from, err := s.getSnapshot(ctx, userID, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	fromState, err := s.snapshotRepo.GetSnapshotState(ctx, snapshotID)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "读取快照失败")
+	}
+
+	toName := currentStateName
+	var toState *models.TreeState
+	if toSnapshotID > 0 {
+		to, err := s.getSnapshot(ctx, userID, toSnapshotID)
+		if err != nil {
+			return nil, err
+		}
+		if to.FamilyTreeID != from.FamilyTreeID {
+			return nil, errors.New(errors.ErrCodeInvalidInput, "只能比较同一家族树的快照")
+		}
+		toName = to.Name
+		toState, err = s.snapshotRepo.GetSnapshotState(ctx, toSnapshotID)
+	} else {
+		toState, err = s.snapshotRepo.GetTreeState(ctx, from.FamilyTreeID)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "读取家族树失败")
+	}
+
+	return diffTreeStates(from.Name, toName, fromState, toState), nil
+}
+
+// RollbackToSnapshot 把家族树恢复到快照时的状态，返回执行的修改。回滚是一个变更集，可以通过撤销变更集复原
+func (s *SnapshotService) RollbackToSnapshot(ctx context.Context, userID, snapshotID int) (*models.SnapshotRollbackResult, error) {
+	snapshot, err := s.getSnapshot(ctx, userID, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.snapshotRepo.GetSnapshotState(ctx, snapshotID)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "读取快照失败")
+	}
+	current, err := s.snapshotRepo.GetTreeState(ctx, snapshot.FamilyTreeID)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "读取家族树失败")
+	}
+
+	ctx, changeSet, err := withChangeSet(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.snapshotRepo.RollbackToSnapshot(ctx, snapshotID); err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "回滚失败")
+	}
+	return &models.SnapshotRollbackResult{
+		ChangeSet: changeSet,
+		Diff:      diffTreeStates(currentStateName, snapshot.Name, current, target),
+	}, nil
+}
+
+// getSnapshot 读取快照并校验家族树属于该用户
+func (s *SnapshotService) getSnapshot(ctx context.Context, userID, snapshotID int) (*models.TreeSnapshot, error) {
+	if snapshotID <= 0 {
+		return nil, errors.ErrInvalidID
+	}
+	snapshot, err := s.snapshotRepo.GetSnapshot(ctx, snapshotID)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "查询快照失败")
+	}
+	if snapshot == nil {
+		return nil, errors.New(errors.ErrCodeNotFound, "快照不存在")
+	}
+	if _, err := ownedFamilyTree(ctx, s.familyTreeRepo, userID, snapshot.FamilyTreeID); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// diffTreeStates 比较两个版本：个人的增删改，家庭（婚姻）和子女关系的增删改，以及事件的增删改。
+// 个人的父母字段变化作为个人的字段变化列出；任一版本是不含事件的早期快照时不比较事件
+func diffTreeStates(fromName, toName string, from, to *models.TreeState) *models.TreeDiff {
+	diff := &models.TreeDiff{From: fromName, To: toName, People: []models.RecordDiff{}, Relationships: []models.RecordDiff{}, Events: []models.RecordDiff{}}
+	names := func(id interface{}) string {
+		key := stateKey(id)
+		for _, state := range []*models.TreeState{to, from} {
+			if person, ok := state.Individuals[key]; ok {
+				if name, _ := person["full_name"].(string); name != "" {
+					return name
+				}
+			}
+		}
+		return key
+	}
+	familyLabel := func(family map[string]interface{}) string {
+		var spouses []string
+		for _, column := range []string{"husband_id", "wife_id"} {
+			if family[column] != nil {
+				spouses = append(spouses, names(family[column]))
+			}
+		}
+		return strings.Join(spouses, "与") + "的家庭"
+	}
+
+	type section struct {
+		entity   models.EntityType
+		from, to map[string]map[string]interface{}
+		label    func(record map[string]interface{}) string
+	}
+	sections := []section{
+		{models.EntityTypeIndividual, from.Individuals, to.Individuals, func(r map[string]interface{}) string {
+			return names(r["individual_id"])
+		}},
+		{models.EntityTypeFamily, from.Families, to.Families, familyLabel},
+		{models.EntityTypeChild, from.Children, to.Children, func(r map[string]interface{}) string {
+			label := names(r["individual_id"])
+			for _, state := range []*models.TreeState{to, from} {
+				if family, ok := state.Families[stateKey(r["family_id"])]; ok {
+					return label + "（" + familyLabel(family) + "的子女）"
+				}
+			}
+			return label
+		}},
+	}
+	if from.Events != nil && to.Events != nil {
+		sections = append(sections, section{models.EntityTypeEvent, from.Events, to.Events, func(r map[string]interface{}) string {
+			eventType, _ := r["event_type"].(string)
+			return names(r["individual_id"]) + "（" + eventType + "）"
+		}})
+	}
+
+	for _, section := range sections {
+		for _, id := range stateIDs(section.from, section.to) {
+			before, inFrom := section.from[id]
+			after, inTo := section.to[id]
+			record := models.RecordDiff{EntityType: section.entity, EntityID: id}
+			switch {
+			case !inFrom:
+				record.Change, record.Label = models.DiffAdded, section.label(after)
+			case !inTo:
+				record.Change, record.Label = models.DiffRemoved, section.label(before)
+			default:
+				record.Changes = diffFields(before, after)
+				if len(record.Changes) == 0 {
+					continue
+				}
+				record.Change, record.Label = models.DiffChanged, section.label(after)
+			}
+
+			switch section.entity {
+			case models.EntityTypeIndividual:
+				diff.People = append(diff.People, record)
+				countDiff(record.Change, &diff.Summary.PeopleAdded, &diff.Summary.PeopleRemoved, &diff.Summary.PeopleChanged)
+			case models.EntityTypeEvent:
+				diff.Events = append(diff.Events, record)
+				countDiff(record.Change, &diff.Summary.EventsAdded, &diff.Summary.EventsRemoved, &diff.Summary.EventsChanged)
+			default:
+				diff.Relationships = append(diff.Relationships, record)
+				countDiff(record.Change, &diff.Summary.RelationshipsAdded, &diff.Summary.RelationshipsRemoved, &diff.Summary.RelationshipsChanged)
+			}
+		}
+	}
+	return diff
+}
+
+// countDiff 按变化类型计数
+func countDiff(change string, added, removed, changed *int) {
+	switch change {
+	case models.DiffAdded:
+		*added++
+	case models.DiffRemoved:
+		*removed++
+	default:
+		*changed++
+	}
+}
+
+// diffFields 逐字段比较两个版本的记录，字段按名称排序
+func diffFields(before, after map[string]interface{}) []models.FieldChange {
+	fields := map[string]bool{}
+	for _, record := range []map[string]interface{}{before, after} {
+		for field := range record {
+			if !snapshotIgnored[field] {
+				fields[field] = true
+			}
+		}
+	}
+	sorted := make([]string, 0, len(fields))
+	for field := range fields {
+		sorted = append(sorted, field)
+	}
+	sort.Strings(sorted)
+
+	var changes []models.FieldChange
+	for _, field := range sorted {
+		a, _ := json.Marshal(before[field])
+		b, _ := json.Marshal(after[field])
+		if string(a) != string(b) {
+			changes = append(changes, models.FieldChange{Field: field, Old: before[field], New: after[field]})
+		}
+	}
+	return changes
+}
+
+// stateIDs 两个版本中全部记录的ID，按数值排序，复合主键逐段比较
+func stateIDs(a, b map[string]map[string]interface{}) []string {
+	seen := map[string]bool{}
+	var ids []string
+	for _, records := range []map[string]map[string]interface{}{a, b} {
+		for id := range records {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	parts := func(id string) []int {
+		var keys []int
+		for _, part := range strings.Split(id, "/") {
+			key, _ := strconv.Atoi(part)
+			keys = append(keys, key)
+		}
+		return keys
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := parts(ids[i]), parts(ids[j])
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	return ids
+}
+
+// stateKey 快照中的ID字段转为记录ID
+func stateKey(v interface{}) string {
+	switch v := v.(type) {
+	case float64:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case int:
+		return strconv.Itoa(v)
+	case string:
+		return v
+	}
+	return ""
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"familytree/interfaces"
+	"familytree/models"
+	"familytree/pkg/errors"
+)
+
+// 统计排行的默认与最大条数
+const (
+	defaultStatisticsTop = 10
+	maxStatisticsTop     = 100
+)
+
+// StatisticsService 家族树统计服务
+type StatisticsService struct {
+	statisticsRepo interfaces.StatisticsRepository
+	familyTreeRepo interfaces.FamilyTreeRepository
+}
+
+// NewStatisticsService 创建家族树统计服务
+func NewStatisticsService(statisticsRepo interfaces.StatisticsRepository, familyTreeRepo interfaces.FamilyTreeRepository) interfaces.StatisticsService {
+	return &StatisticsService{
+		statisticsRepo: statisticsRepo,
+		familyTreeRepo: familyTreeRepo,
+	}
+}
+
+// GetTreeStatistics 家族树统计，只有家族树的所有者可以查看
+func (s *StatisticsService) GetTreeStatistics(ctx context.Context, userID, familyTreeID int, top int) (*models.TreeStatistics, error) {
+	if familyTreeID <= 0 {
+		return nil, errors.New(errors.ErrCodeInvalidInput, "无效的家族树ID")
+	}
+	if top <= 0 {
+		top = defaultStatisticsTop
+	}
+	if top > maxStatisticsTop {
+		return nil, errors.New(errors.ErrCodeInvalidInput, fmt.Sprintf("top 不能超过 %d", maxStatisticsTop))
+	}
+
+	if _, err := ownedFamilyTree(ctx, s.familyTreeRepo, userID, familyTreeID); err != nil {
+		return nil, err
+	}
+
+	stats, err := s.statisticsRepo.GetTreeStatistics(ctx, familyTreeID, top)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "统计家族树失败")
+	}
+	return stats, nil
+}
@@ -0,0 +1,506 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"familytree/interfaces"
+	"familytree/models"
+	"familytree/pkg/errors"
+	"familytree/pkg/narrative"
+)
+
+// TimelineService 个人时间线服务，亲属来自 GetParents/GetSiblings/GetSpouses/GetChildren
+type TimelineService struct {
+	individualService interfaces.IndividualService
+	individualRepo    interfaces.IndividualRepository
+	familyRepo        interfaces.FamilyRepository
+	recordRepo        interfaces.RecordRepository
+	history           []historicalEvent
+}
+
+// historicalEvent 解析过日期的历史事件
+type historicalEvent struct {
+	models.HistoricalEvent
+	start time.Time
+	end   time.Time // 没有结束日期时等于 start 所在时段的末尾
+}
+
+// relative 时间线中的一位亲属
+type relative struct {
+	ind      models.Individual
+	relation string
+}
+
+// categoryOrder 同一天的条目按本人、亲属、历史排序
+var categoryOrder = map[string]int{
+	models.TimelineOwn:        0,
+	models.TimelineFamily:     1,
+	models.TimelineHistorical: 2,
+}
+
+// NewTimelineService 创建个人时间线服务，history 中日期无效的历史事件会被忽略
+func NewTimelineService(individualService interfaces.IndividualService, individualRepo interfaces.IndividualRepository,
+	familyRepo interfaces.FamilyRepository, recordRepo interfaces.RecordRepository, history []models.HistoricalEvent) interfaces.TimelineService {
+	s := &TimelineService{
+		individualService: individualService,
+		individualRepo:    individualRepo,
+		familyRepo:        familyRepo,
+		recordRepo:        recordRepo,
+	}
+	for _, event := range history {
+		if parsed, err := parseHistoricalEvent(event); err == nil {
+			s.history = append(s.history, parsed)
+		}
+	}
+	sort.SliceStable(s.history, func(i, j int) bool { return s.history[i].start.Before(s.history[j].start) })
+	return s
+}
+
+// LoadHistoricalEvents 读取本地历史事件列表（JSON 数组）
+func LoadHistoricalEvents(path string) ([]models.HistoricalEvent, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var events []models.HistoricalEvent
+	if err := json.Unmarshal(data, &events); err != nil {
+		return nil, fmt.Errorf("解析历史事件失败: %v", err)
+	}
+	for i, event := range events {
+		if strings.TrimSpace(event.Title) == "" {
+			return nil, fmt.Errorf("第 %d 条历史事件缺少标题", i+1)
+		}
+		if _, err := parseHistoricalEvent(event); err != nil {
+			return nil, fmt.Errorf("历史事件 %s: %v", event.Title, err)
+		}
+	}
+	return events, nil
+}
+
+// parseHistoricalEvent 解析历史事件的起止日期
+func parseHistoricalEvent(event models.HistoricalEvent) (historicalEvent, error) {
+	start, startEnd, err := parseHistoryDate(event.Date)
+	if err != nil {
+		return historicalEvent{}, err
+	}
+	parsed := historicalEvent{HistoricalEvent: event, start: start, end: startEnd}
+	if event.EndDate != "" {
+		_, end, err := parseHistoryDate(event.EndDate)
+		if err != nil {
+			return historicalEvent{}, err
+		}
+		if end.Before(start) {
+			return historicalEvent{}, fmt.Errorf("结束日期早于开始日期")
+		}
+		parsed.end = end
+	}
+	return parsed, nil
+}
+
+// parseHistoryDate 解析 YYYY、YYYY-MM 或 YYYY-MM-DD，返回该时段的第一天和最后一天
+func parseHistoryDate(value string) (first, last time.Time, err error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []struct {
+		format string
+		years  int
+		months int
+		days   int
+	}{
+		{"2006-01-02", 0, 0, 1},
+		{"2006-01", 0, 1, 0},
+		{"2006", 1, 0, 0},
+	} {
+		if t, err := time.Parse(layout.format, value); err == nil {
+			return t, t.AddDate(layout.years, layout.months, layout.days).Add(-time.Nanosecond), nil
+		}
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("无效的日期 %q，应为 YYYY、YYYY-MM 或 YYYY-MM-DD", value)
+}
+
+// GetTimeline 生成个人时间线。亲属事件只保留本人在世期间发生的，历史事件与本人一生有交集时才列出
+func (s *TimelineService) GetTimeline(ctx context.Context, individualID int, includeHistory bool) (*models.Timeline, error) {
+	if individualID <= 0 {
+		return nil, errors.ErrInvalidID
+	}
+	person, err := s.individualService.GetByID(ctx, individualID)
+	if err != nil {
+		return nil, err
+	}
+	relatives, err := s.loadRelatives(ctx, person)
+	if err != nil {
+		return nil, err
+	}
+	people := map[int]*models.Individual{person.IndividualID: person}
+	ids := []int{person.IndividualID}
+	for i := range relatives {
+		ind := &relatives[i].ind
+		if _, ok := people[ind.IndividualID]; !ok {
+			people[ind.IndividualID] = ind
+			ids = append(ids, ind.IndividualID)
+		}
+	}
+
+	events, err := s.recordRepo.GetEventsByIndividualIDs(ctx, []int{individualID})
+	if err != nil {
+		return nil, err
+	}
+	families, err := s.familyRepo.GetFamiliesByIndividualIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	// 亲属的配偶不在亲属之列，单独加载姓名
+	var missing []int
+	for _, family := range families {
+		for _, id := range []*int{family.HusbandID, family.WifeID} {
+			if id == nil {
+				continue
+			}
+			if _, ok := people[*id]; !ok {
+				people[*id] = nil
+				missing = append(missing, *id)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		others, err := s.individualRepo.GetIndividualsByIDs(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		for i := range others {
+			people[others[i].IndividualID] = &others[i]
+		}
+	}
+
+	places, err := s.loadPlaces(ctx, person, relatives, events, families)
+	if err != nil {
+		return nil, err
+	}
+	placeName := func(id *int, text *string) string {
+		if id != nil {
+			if name, ok := places[*id]; ok {
+				return name
+			}
+		}
+		if text != nil {
+			return strings.TrimSpace(*text)
+		}
+		return ""
+	}
+
+	var entries []models.TimelineEntry
+	// 本人事件：事件表中没有出生、去世记录时使用个人信息中的日期
+	ownTypes := map[string]bool{}
+	ownDates := map[string]bool{} // 事件类型与日期，用于跳过事件表中已有的婚姻记录
+	for _, event := range events {
+		eventType := strings.ToLower(event.EventType)
+		ownTypes[eventType] = true
+		if event.EventDate != nil {
+			ownDates[eventType+event.EventDate.Format("2006-01-02")] = true
+		}
+		entries = append(entries, models.TimelineEntry{
+			Date:         event.EventDate,
+			Category:     models.TimelineOwn,
+			EventType:    eventType,
+			Title:        narrative.EventName(event.EventType),
+			Description:  event.Description,
+			Place:        placeName(event.EventPlaceID, nil),
+			IndividualID: person.IndividualID,
+			EventID:      event.EventID,
+		})
+	}
+	if !ownTypes["birth"] && person.BirthDate != nil {
+		entries = append(entries, models.TimelineEntry{Date: person.BirthDate, Category: models.TimelineOwn, EventType: "birth",
+			Title: "出生", Place: placeName(person.BirthPlaceID, person.BirthPlace), IndividualID: person.IndividualID})
+	}
+	if !ownTypes["death"] && person.DeathDate != nil {
+		entries = append(entries, models.TimelineEntry{Date: person.DeathDate, Category: models.TimelineOwn, EventType: "death",
+			Title: "逝世", Place: placeName(person.DeathPlaceID, person.DeathPlace), IndividualID: person.IndividualID})
+	}
+
+	// 婚姻：本人的婚姻记为本人事件（事件表中已有的不重复），亲属的婚姻记为家庭事件
+	relationOf := map[int]string{}
+	for _, r := range relatives {
+		if _, ok := relationOf[r.ind.IndividualID]; !ok {
+			relationOf[r.ind.IndividualID] = r.relation
+		}
+	}
+	describe := func(id int) string {
+		p := people[id]
+		if p == nil {
+			return ""
+		}
+		return relationOf[id] + p.FullName
+	}
+	seenFamily := map[int]bool{}
+	for _, family := range families {
+		if seenFamily[family.FamilyID] {
+			continue
+		}
+		seenFamily[family.FamilyID] = true
+		husband, wife := 0, 0
+		if family.HusbandID != nil {
+			husband = *family.HusbandID
+		}
+		if family.WifeID != nil {
+			wife = *family.WifeID
+		}
+
+		if husband == individualID || wife == individualID {
+			spouse := husband + wife - individualID
+			for _, item := range []struct {
+				date      *time.Time
+				eventType string
+				verb      string
+			}{
+				{family.MarriageDate, "marriage", "结婚"},
+				{family.DivorceDate, "divorce", "离婚"},
+			} {
+				if item.date == nil || ownDates[item.eventType+item.date.Format("2006-01-02")] {
+					continue
+				}
+				title := item.verb
+				if name := describe(spouse); name != "" {
+					title = "与" + name + item.verb
+				}
+				entries = append(entries, models.TimelineEntry{Date: item.date, Category: models.TimelineOwn, EventType: item.eventType,
+					Title: title, Place: placeName(family.MarriagePlaceID, nil), IndividualID: individualID})
+			}
+			continue
+		}
+
+		if family.MarriageDate == nil {
+			continue
+		}
+		entry := models.TimelineEntry{Date: family.MarriageDate, Category: models.TimelineFamily, EventType: "marriage",
+			Place: placeName(family.MarriagePlaceID, nil)}
+		var names []string
+		for _, id := range []int{husband, wife} {
+			if name := describe(id); name != "" {
+				names = append(names, name)
+			}
+			if entry.IndividualID == 0 && relationOf[id] != "" {
+				entry.IndividualID, entry.Relation = id, relationOf[id]
+			}
+		}
+		if relationOf[husband] == "父亲" && relationOf[wife] == "母亲" {
+			entry.Relation = "父母"
+		}
+		entry.Title = strings.Join(names, "与") + "结婚"
+		entries = append(entries, entry)
+	}
+
+	// 亲属的出生与去世
+	for _, r := range relatives {
+		ind := r.ind
+		if ind.BirthDate != nil {
+			entries = append(entries, models.TimelineEntry{Date: ind.BirthDate, Category: models.TimelineFamily, EventType: "birth",
+				Title: r.relation + ind.FullName + "出生", Place: placeName(ind.BirthPlaceID, ind.BirthPlace),
+				IndividualID: ind.IndividualID, Relation: r.relation})
+		}
+		if ind.DeathDate != nil {
+			entries = append(entries, models.TimelineEntry{Date: ind.DeathDate, Category: models.TimelineFamily, EventType: "death",
+				Title: r.relation + ind.FullName + "逝世", Place: placeName(ind.DeathPlaceID, ind.DeathPlace),
+				IndividualID: ind.IndividualID, Relation: r.relation})
+		}
+	}
+
+	// 只保留本人在世期间的亲属事件
+	kept := entries[:0]
+	for _, entry := range entries {
+		if entry.Category == models.TimelineFamily && entry.Date != nil &&
+			((person.BirthDate != nil && entry.Date.Before(*person.BirthDate)) ||
+				(person.DeathDate != nil && entry.Date.After(*person.DeathDate))) {
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	entries = kept
+
+	if includeHistory {
+		entries = append(entries, s.historyWithin(person, entries)...)
+	}
+
+	for i := range entries {
+		entries[i].Age = ageAt(person.BirthDate, entries[i].Date)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i].Date, entries[j].Date
+		switch {
+		case a == nil || b == nil:
+			return a != nil && b == nil
+		case !a.Equal(*b):
+			return a.Before(*b)
+		}
+		return categoryOrder[entries[i].Category] < categoryOrder[entries[j].Category]
+	})
+	if entries == nil {
+		entries = []models.TimelineEntry{}
+	}
+	return &models.Timeline{Individual: person, Entries: entries}, nil
+}
+
+// loadRelatives 父母、兄弟姐妹、配偶和子女
+func (s *TimelineService) loadRelatives(ctx context.Context, person *models.Individual) ([]relative, error) {
+	id := person.IndividualID
+	father, mother, err := s.individualService.GetParents(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	siblings, err := s.individualService.GetSiblings(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	spouses, err := s.individualService.GetSpouses(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	children, err := s.individualService.GetChildren(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var relatives []relative
+	seen := map[int]bool{id: true}
+	add := func(ind models.Individual, relation string) {
+		if !seen[ind.IndividualID] {
+			seen[ind.IndividualID] = true
+			relatives = append(relatives, relative{ind: ind, relation: relation})
+		}
+	}
+	if father != nil {
+		add(*father, "父亲")
+	}
+	if mother != nil {
+		add(*mother, "母亲")
+	}
+	for _, sibling := range siblings {
+		add(sibling, siblingRelation(person, &sibling))
+	}
+	for _, spouse := range spouses {
+		add(spouse, genderWord(spouse.Gender, "丈夫", "妻子", "配偶"))
+	}
+	for _, child := range children {
+		add(child, genderWord(child.Gender, "儿子", "女儿", "子女"))
+	}
+	return relatives, nil
+}
+
+// loadPlaces 批量加载时间线用到的地点名称
+func (s *TimelineService) loadPlaces(ctx context.Context, person *models.Individual, relatives []relative,
+	events []models.Event, families []models.Family) (map[int]string, error) {
+	var ids []int
+	add := func(list ...*int) {
+		for _, id := range list {
+			if id != nil {
+				ids = append(ids, *id)
+			}
+		}
+	}
+	add(person.BirthPlaceID, person.DeathPlaceID)
+	for _, r := range relatives {
+		add(r.ind.BirthPlaceID, r.ind.DeathPlaceID)
+	}
+	for _, event := range events {
+		add(event.EventPlaceID)
+	}
+	for _, family := range families {
+		add(family.MarriagePlaceID)
+	}
+	places, err := s.recordRepo.GetPlacesByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[int]string, len(places))
+	for _, place := range places {
+		names[place.PlaceID] = place.PlaceName
+	}
+	return names, nil
+}
+
+// historyWithin 与本人一生有交集的历史事件。没有出生日期时以最早的条目为起点，
+// 仍在世时以今天为终点
+func (s *TimelineService) historyWithin(person *models.Individual, entries []models.TimelineEntry) []models.TimelineEntry {
+	var start, end time.Time
+	if person.BirthDate != nil {
+		start = *person.BirthDate
+	}
+	if person.DeathDate != nil {
+		end = *person.DeathDate
+	}
+	for _, entry := range entries {
+		if entry.Date == nil {
+			continue
+		}
+		if person.BirthDate == nil && (start.IsZero() || entry.Date.Before(start)) {
+			start = *entry.Date
+		}
+	}
+	if start.IsZero() {
+		return nil
+	}
+	if end.IsZero() {
+		end = time.Now()
+	}
+
+	var result []models.TimelineEntry
+	for _, h := range s.history {
+		if h.start.After(end) || h.end.Before(start) {
+			continue
+		}
+		entry := models.TimelineEntry{
+			Category:    models.TimelineHistorical,
+			Title:       h.Title,
+			Description: h.Description,
+			Place:       h.Region,
+			EventType:   h.Category,
+		}
+		date := h.start
+		entry.Date = &date
+		if h.EndDate != "" {
+			endDate := h.end
+			entry.EndDate = &endDate
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
+// ageAt 某日的周岁，出生日期未知或早于出生时为空
+func ageAt(birth, date *time.Time) *int {
+	if birth == nil || date == nil || date.Before(*birth) {
+		return nil
+	}
+	age := date.Year() - birth.Year()
+	if date.Month() < birth.Month() || (date.Month() == birth.Month() && date.Day() < birth.Day()) {
+		age--
+	}
+	return &age
+}
+
+// siblingRelation 兄弟姐妹的称谓，出生日期未知时不分长幼
+func siblingRelation(person, sibling *models.Individual) string {
+	if person.BirthDate == nil || sibling.BirthDate == nil {
+		return genderWord(sibling.Gender, "兄弟", "姐妹", "兄弟姐妹")
+	}
+	if sibling.BirthDate.Before(*person.BirthDate) {
+		return genderWord(sibling.Gender, "哥哥", "姐姐", "兄弟姐妹")
+	}
+	return genderWord(sibling.Gender, "弟弟", "妹妹", "兄弟姐妹")
+}
+
+// genderWord 按性别选择称谓
+func genderWord(gender models.Gender, male, female, other string) string {
+	switch gender {
+	case models.GenderMale:
+		return male
+	case models.GenderFemale:
+		return female
+	}
+	return other
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"familytree/interfaces"
+	"familytree/models"
+)
+
+// fakeEventRepo 按个人返回给定的事件，其余查询使用测试数据库
+type fakeEventRepo struct {
+	interfaces.RecordRepository
+	events []models.Event
+}
+
+func (r *fakeEventRepo) GetEventsByIndividualIDs(ctx context.Context, ids []int) ([]models.Event, error) {
+	var events []models.Event
+	for _, event := range r.events {
+		for _, id := range ids {
+			if event.IndividualID == id {
+				events = append(events, event)
+			}
+		}
+	}
+	return events, nil
+}
+
+func TestTimeline(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+	date := func(value string) *time.Time {
+		d, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			t.Fatalf("解析日期失败: %v", err)
+		}
+		return &d
+	}
+	create := func(person models.Individual) *models.Individual {
+		t.Helper()
+		created, err := repo.CreateIndividual(ctx, &person)
+		if err != nil {
+			t.Fatalf("创建个人失败: %v", err)
+		}
+		return created
+	}
+
+	// 父亲生于本人出生前，母亲卒于本人去世后，只有父亲的去世在本人一生之内
+	father := create(models.Individual{FullName: "周父", Gender: models.GenderMale, BirthDate: date("1870-01-01"), DeathDate: date("1950-07-01")})
+	mother := create(models.Individual{FullName: "周母", Gender: models.GenderFemale, DeathDate: date("1970-01-01")})
+	person := create(models.Individual{FullName: "周甲", Gender: models.GenderMale, BirthDate: date("1900-05-10"), DeathDate: date("1960-03-01"),
+		FatherID: &father.IndividualID, MotherID: &mother.IndividualID})
+	create(models.Individual{FullName: "周妹", Gender: models.GenderFemale, BirthDate: date("1905-01-01"),
+		FatherID: &father.IndividualID, MotherID: &mother.IndividualID})
+	wife := create(models.Individual{FullName: "吴氏", Gender: models.GenderFemale})
+	create(models.Individual{FullName: "周乙", Gender: models.GenderMale, BirthDate: date("1926-02-01"),
+		FatherID: &person.IndividualID, MotherID: &wife.IndividualID})
+
+	if _, err := repo.CreateFamily(ctx, &models.Family{HusbandID: &father.IndividualID, WifeID: &mother.IndividualID, MarriageDate: date("1895-01-01"), MarriageOrder: 1}); err != nil {
+		t.Fatalf("创建家庭失败: %v", err)
+	}
+	if _, err := repo.CreateFamily(ctx, &models.Family{HusbandID: &person.IndividualID, WifeID: &wife.IndividualID, MarriageDate: date("1925-06-01"), MarriageOrder: 1}); err != nil {
+		t.Fatalf("创建家庭失败: %v", err)
+	}
+	records := &fakeEventRepo{RecordRepository: repo, events: []models.Event{
+		{EventID: 1, IndividualID: person.IndividualID, EventType: "graduation", EventDate: date("1918-05-09")},
+		{EventID: 2, IndividualID: person.IndividualID, EventType: "residence"},
+	}}
+
+	history := []models.HistoricalEvent{
+		{Date: "1890", Title: "早于出生"},
+		{Date: "1911-10-10", Title: "辛亥革命"},
+		{Date: "1925-06-01", Title: "同日的历史事件"},
+		{Date: "1937", EndDate: "1945", Title: "抗日战争"},
+		{Date: "1899", EndDate: "1901", Title: "跨越出生"},
+		{Date: "1970", Title: "晚于去世"},
+		{Date: "无效", Title: "日期无效"},
+	}
+	service := NewTimelineService(NewIndividualService(repo, repo, repo), repo, repo, records, history)
+
+	timeline, err := service.GetTimeline(ctx, person.IndividualID, true)
+	if err != nil {
+		t.Fatalf("生成时间线失败: %v", err)
+	}
+
+	type row struct {
+		title    string
+		category string
+		age      int // -1 表示没有年龄
+	}
+	var got []row
+	for _, entry := range timeline.Entries {
+		age := -1
+		if entry.Age != nil {
+			age = *entry.Age
+		}
+		got = append(got, row{entry.Title, entry.Category, age})
+	}
+	// 按日期排序，同一天本人在前、历史在后，没有日期的排在最后
+	want := []row{
+		{"跨越出生", models.TimelineHistorical, -1},
+		{"出生", models.TimelineOwn, 0},
+		{"妹妹周妹出生", models.TimelineFamily, 4},
+		{"辛亥革命", models.TimelineHistorical, 11},
+		{"毕业", models.TimelineOwn, 17},
+		{"与妻子吴氏结婚", models.TimelineOwn, 25},
+		{"同日的历史事件", models.TimelineHistorical, 25},
+		{"儿子周乙出生", models.TimelineFamily, 25},
+		{"抗日战争", models.TimelineHistorical, 36},
+		{"父亲周父逝世", models.TimelineFamily, 50},
+		{"逝世", models.TimelineOwn, 59},
+		{"居住", models.TimelineOwn, -1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("时间线:\n got %v\nwant %v", got, want)
+	}
+
+	timeline, err = service.GetTimeline(ctx, person.IndividualID, false)
+	if err != nil {
+		t.Fatalf("生成时间线失败: %v", err)
+	}
+	for _, entry := range timeline.Entries {
+		if entry.Category == models.TimelineHistorical {
+			t.Errorf("不含历史事件时仍列出: %+v", entry)
+		}
+	}
+}
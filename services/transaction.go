@@ -0,0 +1,18 @@
+package services
+
+import (
+	"context"
+
+	"familytree/interfaces"
+)
+
+// inTransaction 在工作单元中执行 fn 并返回其结果，fn 返回错误时其中的全部修改回滚
+func inTransaction[T any](ctx context.Context, uow interfaces.UnitOfWork, fn func(ctx context.Context) (T, error)) (T, error) {
+	var result T
+	err := uow.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		result, err = fn(ctx)
+		return err
+	})
+	return result, err
+}
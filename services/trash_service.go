@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"familytree/interfaces"
+	"familytree/models"
+	"familytree/pkg/errors"
+)
+
+// 回收站分页的默认与最大条数
+const (
+	defaultTrashLimit = 50
+	maxTrashLimit     = 200
+)
+
+// TrashService 回收站服务
+type TrashService struct {
+	trashRepo      interfaces.TrashRepository
+	auditRepo      interfaces.AuditRepository
+	familyTreeRepo interfaces.FamilyTreeRepository
+	retention      time.Duration
+}
+
+// NewTrashService 创建回收站服务，retention 为删除的记录保留的时长
+func NewTrashService(trashRepo interfaces.TrashRepository, auditRepo interfaces.AuditRepository, familyTreeRepo interfaces.FamilyTreeRepository, retention time.Duration) interfaces.TrashService {
+	if retention <= 0 {
+		retention = 30 * 24 * time.Hour
+	}
+	return &TrashService{
+		trashRepo:      trashRepo,
+		auditRepo:      auditRepo,
+		familyTreeRepo: familyTreeRepo,
+		retention:      retention,
+	}
+}
+
+// GetTrash 家族树回收站中的记录，只有家族树的所有者可以查看
+func (s *TrashService) GetTrash(ctx context.Context, userID, familyTreeID, limit, offset int) ([]models.TrashItem, int, error) {
+	if familyTreeID <= 0 {
+		return nil, 0, errors.New(errors.ErrCodeInvalidInput, "无效的家族树ID")
+	}
+	if limit <= 0 {
+		limit = defaultTrashLimit
+	}
+	if limit > maxTrashLimit {
+		return nil, 0, errors.New(errors.ErrCodeInvalidInput, fmt.Sprintf("limit 不能超过 %d", maxTrashLimit))
+	}
+	if offset < 0 {
+		return nil, 0, errors.New(errors.ErrCodeInvalidInput, "offset 不能为负数")
+	}
+	if _, err := ownedFamilyTree(ctx, s.familyTreeRepo, userID, familyTreeID); err != nil {
+		return nil, 0, err
+	}
+
+	items, total, err := s.trashRepo.GetTrashItems(ctx, familyTreeID, limit, offset)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, errors.ErrCodeInternalError, "查询回收站失败")
+	}
+	for i := range items {
+		items[i].PurgeAt = items[i].DeletedAt.Add(s.retention)
+	}
+	return items, total, nil
+}
+
+// Restore 清除删除标记，恢复记录及随之删除的子女关系和事件。
+// 子女关系所在的家庭或个人仍在回收站中时返回冲突，不做任何修改
+func (s *TrashService) Restore(ctx context.Context, userID, trashID int) (*models.RevertResult, error) {
+	if _, err := s.getItem(ctx, userID, trashID); err != nil {
+		return nil, err
+	}
+
+	ctx, changeSet, err := withChangeSet(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts, err := s.trashRepo.RestoreTrashItem(ctx, trashID)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "恢复失败")
+	}
+	return revertResult(ctx, s.auditRepo, changeSet, conflicts, len(conflicts) == 0)
+}
+
+// Purge 从回收站永久删除，之后不能再从回收站恢复
+func (s *TrashService) Purge(ctx context.Context, userID, trashID int) error {
+	if _, err := s.getItem(ctx, userID, trashID); err != nil {
+		return err
+	}
+	if err := s.trashRepo.PurgeTrashItem(ctx, trashID); err != nil {
+		return errors.Wrap(err, errors.ErrCodeInternalError, "清除回收站记录失败")
+	}
+	return nil
+}
+
+// PurgeExpired 清除超过保留期限的记录
+func (s *TrashService) PurgeExpired(ctx context.Context) (int, error) {
+	n, err := s.trashRepo.PurgeTrash(ctx, time.Now().Add(-s.retention))
+	if err != nil {
+		return 0, errors.Wrap(err, errors.ErrCodeInternalError, "清除过期回收站记录失败")
+	}
+	return n, nil
+}
+
+// getItem 读取回收站记录并校验权限：家族树的所有者，不属于任何家族树的记录只有删除人本人
+func (s *TrashService) getItem(ctx context.Context, userID, trashID int) (*models.TrashItem, error) {
+	if trashID <= 0 {
+		return nil, errors.ErrInvalidID
+	}
+	item, err := s.trashRepo.GetTrashItem(ctx, trashID)
+	if err != nil {
+		return nil, errors.Wrap(err, errors.ErrCodeInternalError, "查询回收站失败")
+	}
+	if item == nil {
+		return nil, errors.New(errors.ErrCodeNotFound, "回收站记录不存在")
+	}
+	if item.FamilyTreeID == nil {
+		if item.DeletedBy == nil || *item.DeletedBy != userID {
+			return nil, errors.New(errors.ErrCodeForbidden, "无权访问该回收站记录")
+		}
+		return item, nil
+	}
+	if _, err := ownedFamilyTree(ctx, s.familyTreeRepo, userID, *item.FamilyTreeID); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// StartTrashPurge 启动后台定时清除，立即执行一次，之后每隔 interval 执行；返回停止函数
+func StartTrashPurge(service interfaces.TrashService, interval time.Duration) func() {
+	done := make(chan struct{})
+	purge := func() {
+		n, err := service.PurgeExpired(context.Background())
+		if err != nil {
+			log.Printf("⚠️  清除过期回收站记录失败: %v", err)
+		} else if n > 0 {
+			log.Printf("🗑️  已清除 %d 条过期回收站记录", n)
+		}
+	}
+
+	go func() {
+		purge()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				purge()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"familytree/models"
+	"familytree/pkg/middleware"
+)
+
+func TestDeleteAndRestoreParent(t *testing.T) {
+	repo := newTestRepository(t)
+	userID, familyTreeID := newTestTree(t, repo, "trash")
+	ctx := context.WithValue(context.Background(), middleware.UserContextKey, &models.AuthContext{UserID: userID})
+	individuals := NewIndividualService(repo, repo, repo)
+	trash := NewTrashService(repo, repo, repo, time.Hour)
+
+	create := func(person *models.Individual) *models.Individual {
+		t.Helper()
+		created, err := repo.CreateIndividualInTree(ctx, userID, familyTreeID, person)
+		if err != nil {
+			t.Fatalf("创建个人失败: %v", err)
+		}
+		return created
+	}
+	father := create(&models.Individual{FullName: "李父", Gender: models.GenderMale})
+	mother := create(&models.Individual{FullName: "李母", Gender: models.GenderFemale})
+	son := create(&models.Individual{FullName: "李子", Gender: models.GenderMale, FatherID: &father.IndividualID, MotherID: &mother.IndividualID})
+	family, err := repo.CreateFamily(ctx, &models.Family{HusbandID: &father.IndividualID, WifeID: &mother.IndividualID, MarriageOrder: 1})
+	if err != nil {
+		t.Fatalf("创建家庭失败: %v", err)
+	}
+	if _, err := repo.CreateChild(ctx, &models.Child{FamilyID: family.FamilyID, IndividualID: son.IndividualID}); err != nil {
+		t.Fatalf("添加子女失败: %v", err)
+	}
+
+	// 有子女、有配偶的个人可以删除，子女和家庭保留
+	if err := individuals.Delete(ctx, father.IndividualID, nil); err != nil {
+		t.Fatalf("删除有子女的个人失败: %v", err)
+	}
+	if got, _, err := individuals.GetParents(ctx, son.IndividualID); err != nil || got != nil {
+		t.Errorf("回收站中的父亲不应查到: %+v, %v", got, err)
+	}
+	if children, err := repo.GetChildrenByFamilyID(ctx, family.FamilyID); err != nil || len(children) != 1 {
+		t.Errorf("删除父亲不应删除家庭的子女: %+v, %v", children, err)
+	}
+
+	items, total, err := trash.GetTrash(ctx, userID, familyTreeID, 0, 0)
+	if err != nil || total != 1 {
+		t.Fatalf("回收站应有一条记录: %+v, %d, %v", items, total, err)
+	}
+	result, err := trash.Restore(ctx, userID, items[0].TrashID)
+	if err != nil || len(result.Conflicts) != 0 {
+		t.Fatalf("恢复失败: %+v, %v", result, err)
+	}
+	got, _, err := individuals.GetParents(ctx, son.IndividualID)
+	if err != nil || got == nil || got.IndividualID != father.IndividualID {
+		t.Errorf("恢复后父子关系应随之恢复: %+v, %v", got, err)
+	}
+	if _, total, _ := trash.GetTrash(ctx, userID, familyTreeID, 0, 0); total != 0 {
+		t.Errorf("恢复后回收站应为空: %d", total)
+	}
+}
@@ -0,0 +1,30 @@
+package services
+
+import (
+	"familytree/models"
+	"familytree/pkg/errors"
+)
+
+// checkVersion 客户端带了读取时的版本（If-Match）时，与记录当前版本比较
+func checkVersion(expected *int, current int) error {
+	if expected != nil && *expected != current {
+		return errors.ErrVersionMismatch
+	}
+	return nil
+}
+
+// expectedVersion 交给数据访问层按版本更新的值，0 表示不检查
+func expectedVersion(expected *int) int {
+	if expected == nil {
+		return 0
+	}
+	return *expected
+}
+
+// versionError 检查通过后记录仍在写入前被他人修改时，同样返回版本不一致
+func versionError(err error) error {
+	if err == models.ErrVersionConflict {
+		return errors.ErrVersionMismatch
+	}
+	return err
+}
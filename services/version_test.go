@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"familytree/models"
+	"familytree/pkg/errors"
+)
+
+func TestVersionedNamesAndDelete(t *testing.T) {
+	repo := newTestRepository(t)
+	ctx := context.Background()
+	individuals := NewIndividualService(repo, repo, repo)
+	families := NewFamilyService(repo, repo, repo)
+	mismatch := func(err error) bool {
+		appErr, ok := err.(*errors.AppError)
+		return ok && appErr.Code == errors.ErrCodeVersionMismatch
+	}
+
+	person, err := repo.CreateIndividual(ctx, &models.Individual{FullName: "张三", Gender: models.GenderMale})
+	if err != nil {
+		t.Fatalf("创建个人失败: %v", err)
+	}
+	stale := person.Version
+
+	// 修改字号使个人的版本加一，之后按旧版本修改或删除都应失败
+	if _, err := individuals.UpdateAlternateNames(ctx, person.IndividualID, &models.AlternateNames{CourtesyName: "子明"}, &stale); err != nil {
+		t.Fatalf("按当前版本修改字号失败: %v", err)
+	}
+	if _, err := individuals.UpdateAlternateNames(ctx, person.IndividualID, &models.AlternateNames{CourtesyName: "子亮"}, &stale); !mismatch(err) {
+		t.Errorf("按旧版本修改字号应返回版本不一致: %v", err)
+	}
+	if names, _ := individuals.GetAlternateNames(ctx, person.IndividualID); names.CourtesyName != "子明" {
+		t.Errorf("版本不一致时不应修改: %+v", names)
+	}
+	if err := individuals.Delete(ctx, person.IndividualID, &stale); !mismatch(err) {
+		t.Errorf("按旧版本删除个人应返回版本不一致: %v", err)
+	}
+	current, err := individuals.GetByID(ctx, person.IndividualID)
+	if err != nil {
+		t.Fatalf("版本不一致时不应删除: %v", err)
+	}
+	if err := individuals.Delete(ctx, person.IndividualID, &current.Version); err != nil {
+		t.Errorf("按当前版本删除个人失败: %v", err)
+	}
+
+	family, err := repo.CreateFamily(ctx, &models.Family{HusbandID: intPtr(1), MarriageOrder: 9})
+	if err != nil {
+		t.Fatalf("创建家庭失败: %v", err)
+	}
+	wrong := family.Version + 1
+	if err := families.Delete(ctx, family.FamilyID, &wrong); !mismatch(err) {
+		t.Errorf("按错误版本删除家庭应返回版本不一致: %v", err)
+	}
+	if err := families.Delete(ctx, family.FamilyID, &family.Version); err != nil {
+		t.Errorf("按当前版本删除家庭失败: %v", err)
+	}
+}
+
+func intPtr(v int) *int { return &v }